@@ -132,6 +132,10 @@ type App struct {
 	upgradeOwnerID      string
 	doNotWaitForUpgrade bool
 
+	skipContentMACVerification bool
+	readVerifyProbability      float64
+	contentBloomFilter         bool
+
 	currentAction         string
 	onExitCallbacks       []func()
 	onFatalErrorCallbacks []func(err error)
@@ -151,6 +155,7 @@ type App struct {
 	show        commandShow
 	snapshot    commandSnapshot
 	manifest    commandManifest
+	metadata    commandMetadata
 	mount       commandMount
 	maintenance commandMaintenance
 	repository  commandRepository
@@ -257,6 +262,9 @@ func (c *App) setup(app *kingpin.Application) {
 	app.Flag("dump-allocator-stats", "Dump allocator stats at the end of execution.").Hidden().Envar(c.EnvName("KOPIA_DUMP_ALLOCATOR_STATS")).BoolVar(&c.dumpAllocatorStats)
 	app.Flag("upgrade-owner-id", "Repository format upgrade owner-id.").Hidden().Envar(c.EnvName("KOPIA_REPO_UPGRADE_OWNER_ID")).StringVar(&c.upgradeOwnerID)
 	app.Flag("upgrade-no-block", "Do not block when repository format upgrade is in progress, instead exit with a message.").Hidden().Default("false").Envar(c.EnvName("KOPIA_REPO_UPGRADE_NO_BLOCK")).BoolVar(&c.doNotWaitForUpgrade)
+	app.Flag("skip-content-mac-verification", "[DANGEROUS] Do not verify content MACs on read, tampered contents may go undetected. Only use with trusted storage.").Hidden().Envar(c.EnvName("KOPIA_SKIP_CONTENT_MAC_VERIFICATION")).BoolVar(&c.skipContentMACVerification)
+	app.Flag("read-verify-probability", "Fraction of content reads [0.0 .. 1.0] which additionally verify content hashes.").Hidden().Default("0").Envar(c.EnvName("KOPIA_READ_VERIFY_PROBABILITY")).Float64Var(&c.readVerifyProbability)
+	app.Flag("content-bloom-filter", "Keep a bloom filter of content IDs in memory to speed up lookups of absent contents.").Hidden().Envar(c.EnvName("KOPIA_CONTENT_BLOOM_FILTER")).BoolVar(&c.contentBloomFilter)
 
 	if c.enableTestOnlyFlags() {
 		app.Flag("ignore-missing-required-features", "Open repository despite missing features (VERY DANGEROUS, ONLY FOR TESTING)").Hidden().BoolVar(&c.testonlyIgnoreMissingRequiredFeatures)
@@ -291,6 +299,7 @@ func (c *App) setup(app *kingpin.Application) {
 	c.show.setup(c, app)
 	c.snapshot.setup(c, app)
 	c.manifest.setup(c, app)
+	c.metadata.setup(c, app)
 	c.policy.setup(c, app)
 	c.mount.setup(c, app)
 	c.maintenance.setup(c, app)
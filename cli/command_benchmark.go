@@ -11,10 +11,11 @@ type commandBenchmark struct {
 	encryption  commandBenchmarkEncryption
 	splitters   commandBenchmarkSplitters
 	ecc         commandBenchmarkEcc
+	storage     commandBenchmarkStorage
 }
 
 func (c *commandBenchmark) setup(svc appServices, parent commandParent) {
-	cmd := parent.Command("benchmark", "Commands to test performance of algorithms.")
+	cmd := parent.Command("benchmark", "Commands to test performance of algorithms and storage.")
 
 	c.compression.setup(svc, cmd)
 	c.crypto.setup(svc, cmd)
@@ -22,6 +23,7 @@ func (c *commandBenchmark) setup(svc appServices, parent commandParent) {
 	c.hashing.setup(svc, cmd)
 	c.encryption.setup(svc, cmd)
 	c.ecc.setup(svc, cmd)
+	c.storage.setup(svc, cmd)
 }
 
 type cryptoBenchResult struct {
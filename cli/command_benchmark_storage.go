@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	atunits "github.com/alecthomas/units"
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/storagebench"
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+)
+
+type commandBenchmarkStorage struct {
+	blockCount int
+	blockSize  atunits.Base2Bytes
+	listCount  int
+	parallel   int
+	cleanup    bool
+
+	out textOutput
+	jo  jsonOutput
+}
+
+func (c *commandBenchmarkStorage) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("storage", "Run storage backend throughput benchmarks against the connected repository storage")
+	cmd.Flag("block-count", "Number of blocks to write and read").Default("100").IntVar(&c.blockCount)
+	cmd.Flag("block-size", "Size of each block").Default("4MB").BytesVar(&c.blockSize)
+	cmd.Flag("list-count", "Number of times to list written blocks").Default("10").IntVar(&c.listCount)
+	cmd.Flag("parallel", "Number of parallel workers").Default("4").IntVar(&c.parallel)
+	cmd.Flag("cleanup", "Remove test blocks when finished").Default("true").BoolVar(&c.cleanup)
+	cmd.Action(svc.directRepositoryWriteAction(c.run))
+
+	c.out.setup(svc)
+	c.jo.setup(svc, cmd)
+}
+
+func (c *commandBenchmarkStorage) run(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	report, err := storagebench.Run(ctx, rep.BlobStorage(), storagebench.Options{
+		BlockCount: c.blockCount,
+		BlockSize:  int(c.blockSize),
+		ListCount:  c.listCount,
+		Parallel:   c.parallel,
+		Cleanup:    c.cleanup,
+	})
+	if err != nil {
+		return errors.Wrap(err, "storage benchmark failed")
+	}
+
+	if c.jo.jsonOutput {
+		c.out.printStdout("%s\n", c.jo.jsonBytes(report))
+		return nil
+	}
+
+	c.out.printStdout("%-8v %6v %14v %10v %10v %10v %10v %10v %10v\n", "Op", "Count", "Throughput", "Ops/s", "Min", "P50", "P90", "P99", "Max")
+	c.out.printStdout("-------------------------------------------------------------------------------------------------\n")
+
+	for _, s := range report.Operations {
+		throughput := "-"
+		if s.Bytes > 0 {
+			throughput = units.BytesStringBase2(int64(s.BytesPerSec)) + "/s"
+		}
+
+		c.out.printStdout("%-8v %6v %14v %10.1f %10v %10v %10v %10v %10v\n",
+			s.Operation,
+			s.Count,
+			throughput,
+			s.OpsPerSecond,
+			roundLatency(s.LatencyMin),
+			roundLatency(s.LatencyP50),
+			roundLatency(s.LatencyP90),
+			roundLatency(s.LatencyP99),
+			roundLatency(s.LatencyMax))
+	}
+
+	if !c.cleanup {
+		c.out.printStdout("\nTest blocks were left in storage with prefix: %v\n", report.Prefix)
+	}
+
+	return nil
+}
+
+func roundLatency(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
@@ -6,6 +6,9 @@
 	"path/filepath"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/storagebench"
 	"github.com/kopia/kopia/internal/testutil"
 	"github.com/kopia/kopia/tests/testenv"
 )
@@ -58,3 +61,20 @@ func TestCommandBenchmarkCompression(t *testing.T) {
 	e.RunAndExpectSuccess(t, "benchmark", "compression", "--data-file", testFile, "--repeat=2", "--verify-stable", "--print-options")
 	e.RunAndExpectSuccess(t, "benchmark", "compression", "--data-file", testFile, "--repeat=2", "--by-size")
 }
+
+func TestCommandBenchmarkStorage(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	blobsBefore := e.RunAndExpectSuccess(t, "blob", "list")
+
+	e.RunAndExpectSuccess(t, "benchmark", "storage", "--block-count=5", "--block-size=1KB", "--list-count=2")
+	require.Equal(t, blobsBefore, e.RunAndExpectSuccess(t, "blob", "list"))
+
+	e.RunAndExpectSuccess(t, "benchmark", "storage", "--block-count=5", "--block-size=1KB", "--no-cleanup", "--json")
+	require.Len(t, e.RunAndExpectSuccess(t, "blob", "list", "--prefix", string(storagebench.ReservedPrefix)), 5)
+}
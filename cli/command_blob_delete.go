@@ -7,25 +7,34 @@
 
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/format"
 )
 
 type commandBlobDelete struct {
 	blobIDs []string
+	dryRun  bool
 
 	svc appServices
+	out textOutput
 }
 
 func (c *commandBlobDelete) setup(svc appServices, parent commandParent) {
 	cmd := parent.Command("delete", "Delete blobs by ID").Alias("remove").Alias("rm")
 	cmd.Arg("blobIDs", "Blob IDs").Required().StringsVar(&c.blobIDs)
+	cmd.Flag("dry-run", "Do not delete, only validate blob IDs and print blobs that would be deleted").Short('n').BoolVar(&c.dryRun)
 	cmd.Action(svc.directRepositoryWriteAction(c.run))
 
 	c.svc = svc
+	c.out.setup(svc)
 }
 
 func (c *commandBlobDelete) run(ctx context.Context, rep repo.DirectRepositoryWriter) error {
 	c.svc.advancedCommand(ctx)
 
+	if c.dryRun {
+		return c.dryRunDelete(ctx, rep)
+	}
+
 	for _, b := range c.blobIDs {
 		err := rep.BlobStorage().DeleteBlob(ctx, blob.ID(b))
 		if err != nil {
@@ -35,3 +44,37 @@ func (c *commandBlobDelete) run(ctx context.Context, rep repo.DirectRepositoryWr
 
 	return nil
 }
+
+// dryRunDelete reports blobs that would be deleted, flagging the ones reserved for repository format,
+// and fails if any of them does not exist. It does not modify the storage.
+func (c *commandBlobDelete) dryRunDelete(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	var notFound int
+
+	for _, b := range c.blobIDs {
+		bm, err := rep.BlobStorage().GetMetadata(ctx, blob.ID(b))
+		if errors.Is(err, blob.ErrBlobNotFound) {
+			log(ctx).Errorf("blob %v not found", b)
+
+			notFound++
+
+			continue
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "error getting metadata of %v", b)
+		}
+
+		if format.IsReservedBlobID(bm.BlobID) {
+			c.out.printStdout("Would delete %v (%v bytes) - WARNING: reserved for repository format, deleting it will make the repository unusable\n", bm.BlobID, bm.Length)
+			continue
+		}
+
+		c.out.printStdout("Would delete %v (%v bytes)\n", bm.BlobID, bm.Length)
+	}
+
+	if notFound > 0 {
+		return errors.Errorf("%v of %v blobs not found", notFound, len(c.blobIDs))
+	}
+
+	return nil
+}
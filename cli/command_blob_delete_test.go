@@ -0,0 +1,37 @@
+package cli_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestBlobDeleteDryRun(t *testing.T) {
+	t.Parallel()
+
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+
+	blobsBefore := env.RunAndExpectSuccess(t, "blob", "list")
+	someQBlob := strings.Split(env.RunAndExpectSuccess(t, "blob", "list", "--prefix=q")[0], " ")[0]
+
+	out := env.RunAndExpectSuccess(t, "blob", "delete", "--advanced-commands=enabled", "--dry-run", someQBlob, "kopia.repository")
+	require.Len(t, out, 2)
+	require.Contains(t, out[0], "Would delete "+someQBlob)
+	require.NotContains(t, out[0], "WARNING")
+	require.Contains(t, out[1], "Would delete kopia.repository")
+	require.Contains(t, out[1], "WARNING: reserved for repository format")
+
+	// non-existent blobs are reported as failure.
+	env.RunAndExpectFailure(t, "blob", "delete", "--advanced-commands=enabled", "-n", someQBlob, "no-such-blob")
+
+	// nothing was deleted.
+	require.Equal(t, blobsBefore, env.RunAndExpectSuccess(t, "blob", "list"))
+
+	env.RunAndExpectSuccess(t, "blob", "delete", "--advanced-commands=enabled", someQBlob)
+	require.Len(t, env.RunAndExpectSuccess(t, "blob", "list"), len(blobsBefore)-1)
+}
@@ -11,10 +11,13 @@
 )
 
 type commandBlobGC struct {
-	delete   string
-	parallel int
-	prefix   string
-	safety   maintenance.SafetyParameters
+	delete           string
+	parallel         int
+	deleteParallel   int
+	deletesPerSecond float64
+	batchSize        int
+	prefix           string
+	safety           maintenance.SafetyParameters
 
 	svc appServices
 }
@@ -23,6 +26,9 @@ func (c *commandBlobGC) setup(svc appServices, parent commandParent) {
 	cmd := parent.Command("gc", "Garbage-collect unused blobs")
 	cmd.Flag("delete", "Whether to delete unused blobs").StringVar(&c.delete)
 	cmd.Flag("parallel", "Number of parallel blob scans").Default("16").IntVar(&c.parallel)
+	cmd.Flag("delete-parallel", "Number of parallel blob deletes (defaults to --parallel)").IntVar(&c.deleteParallel)
+	cmd.Flag("max-deletes-per-second", "Maximum number of blob deletes per second (0 means unlimited)").Float64Var(&c.deletesPerSecond)
+	cmd.Flag("delete-batch-size", "Number of blob deletes between saving progress").Default("1000").IntVar(&c.batchSize)
 	cmd.Flag("prefix", "Only GC blobs with given prefix").StringVar(&c.prefix)
 	safetyFlagVar(cmd, &c.safety)
 	cmd.Action(svc.directRepositoryWriteAction(c.run))
@@ -34,9 +40,12 @@ func (c *commandBlobGC) run(ctx context.Context, rep repo.DirectRepositoryWriter
 	c.svc.advancedCommand(ctx)
 
 	opts := maintenance.DeleteUnreferencedBlobsOptions{
-		DryRun:   c.delete != "yes",
-		Parallel: c.parallel,
-		Prefix:   blob.ID(c.prefix),
+		DryRun:           c.delete != "yes",
+		Parallel:         c.parallel,
+		DeleteParallel:   c.deleteParallel,
+		DeletesPerSecond: c.deletesPerSecond,
+		BatchSize:        c.batchSize,
+		Prefix:           blob.ID(c.prefix),
 	}
 
 	n, err := maintenance.DeleteUnreferencedBlobs(ctx, rep, opts, c.safety)
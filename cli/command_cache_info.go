@@ -49,6 +49,7 @@ func (c *commandCacheInfo) run(ctx context.Context, rep repo.Repository) error {
 	path2Limit := map[string]int64{
 		"contents":        opts.MaxCacheSizeBytes,
 		"metadata":        opts.MaxMetadataCacheSizeBytes,
+		"objects":         opts.MaxObjectCacheSizeBytes,
 		"server-contents": opts.MaxCacheSizeBytes,
 	}
 
@@ -15,6 +15,7 @@ type commandCacheSetParams struct {
 	directory              string
 	contentCacheSizeMB     int64
 	maxMetadataCacheSizeMB int64
+	maxObjectCacheSizeMB   int64
 	maxListCacheDuration   time.Duration
 	contentMinSweepAge     time.Duration
 	metadataMinSweepAge    time.Duration
@@ -35,6 +36,7 @@ func (c *commandCacheSetParams) setup(svc appServices, parent commandParent) {
 	cmd.Flag("content-cache-size-mb", "Size of local content cache").PlaceHolder("MB").Default("-1").Int64Var(&c.contentCacheSizeMB)
 	cmd.Flag("content-min-sweep-age", "Minimal age of content cache item to be subject to sweeping").DurationVar(&c.contentMinSweepAge)
 	cmd.Flag("metadata-cache-size-mb", "Size of local metadata cache").PlaceHolder("MB").Default("-1").Int64Var(&c.maxMetadataCacheSizeMB)
+	cmd.Flag("object-cache-size-mb", "Size of local cache of assembled large objects (0 - disabled)").PlaceHolder("MB").Default("-1").Int64Var(&c.maxObjectCacheSizeMB)
 	cmd.Flag("metadata-min-sweep-age", "Minimal age of metadata cache item to be subject to sweeping").DurationVar(&c.metadataMinSweepAge)
 	cmd.Flag("index-min-sweep-age", "Minimal age of index cache item to be subject to sweeping").DurationVar(&c.indexMinSweepAge)
 	cmd.Flag("max-list-cache-duration", "Duration of index cache").DurationVar(&c.maxListCacheDuration)
@@ -70,6 +72,13 @@ func (c *commandCacheSetParams) run(ctx context.Context, rep repo.RepositoryWrit
 		changed++
 	}
 
+	if v := c.maxObjectCacheSizeMB; v != -1 {
+		v *= 1e6 // convert MB to bytes
+		log(ctx).Infof("changing object cache size to %v", units.BytesStringBase10(v))
+		opts.MaxObjectCacheSizeBytes = v
+		changed++
+	}
+
 	if v := c.maxListCacheDuration; v != -1 {
 		log(ctx).Infof("changing list cache duration to %v", v)
 		opts.MaxListCacheDuration = content.DurationSeconds(v.Seconds())
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+)
+
+type commandContentExport struct {
+	contentID  string
+	outputFile string
+
+	jo  jsonOutput
+	out textOutput
+}
+
+func (c *commandContentExport) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("export", "Export raw stored bytes of a content and its index metadata for analysis, even if the content is corrupted.")
+	cmd.Arg("id", "ID of the content to export").Required().StringVar(&c.contentID)
+	cmd.Arg("file", "Output file for the raw content bytes").Required().StringVar(&c.outputFile)
+	cmd.Action(svc.directRepositoryWriteAction(c.run))
+
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+}
+
+func (c *commandContentExport) run(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	contentID, err := content.ParseID(c.contentID)
+	if err != nil {
+		return errors.Wrapf(err, "invalid content ID %v", c.contentID)
+	}
+
+	exp, err := rep.ContentManager().ExportContent(ctx, contentID)
+	if err != nil {
+		return errors.Wrapf(err, "error exporting content %v", contentID)
+	}
+
+	//nolint:gosec,gomnd
+	if err := os.WriteFile(c.outputFile, exp.RawData, 0o600); err != nil {
+		return errors.Wrap(err, "error writing output file")
+	}
+
+	if c.jo.jsonOutput {
+		c.out.printStdout("%s\n", c.jo.jsonBytes(exp))
+		return nil
+	}
+
+	c.out.printStdout("Content ID:       %v\n", exp.ContentID)
+	c.out.printStdout("Pack blob:        %v\n", exp.PackBlobID)
+	c.out.printStdout("Offset:           %v\n", exp.PackOffset)
+	c.out.printStdout("Packed length:    %v\n", exp.PackedLength)
+	c.out.printStdout("Original length:  %v\n", exp.OriginalLength)
+	c.out.printStdout("Compression:      %x\n", exp.CompressionHeaderID)
+	c.out.printStdout("Deleted:          %v\n", exp.Deleted)
+	c.out.printStdout("Expected hash:    %x\n", exp.ExpectedHash)
+	c.out.printStdout("Computed hash:    %x\n", exp.ComputedHash)
+
+	if exp.HashMatches {
+		c.out.printStdout("Status:           OK\n")
+	} else {
+		c.out.printStdout("Status:           INVALID: %v\n", exp.Error)
+	}
+
+	c.out.printStderr("Wrote %v raw bytes to %v\n", len(exp.RawData), c.outputFile)
+
+	return nil
+}
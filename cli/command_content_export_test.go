@@ -0,0 +1,91 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestContentExport(t *testing.T) {
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	dir := testutil.TempDirectory(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file1.txt"), bytes.Repeat([]byte{1, 2, 3, 4, 5}, 15000), 0o600))
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+	e.RunAndExpectSuccess(t, "snapshot", "create", dir)
+
+	var contentID string
+
+	for _, l := range e.RunAndExpectSuccess(t, "content", "list") {
+		if !strings.HasPrefix(l, "k") && !strings.HasPrefix(l, "x") {
+			contentID = l
+			break
+		}
+	}
+
+	require.NotEmpty(t, contentID)
+
+	outFile := filepath.Join(testutil.TempDirectory(t), "exported")
+
+	var exp content.ContentExport
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "content", "export", contentID, outFile, "--json"), &exp)
+	require.True(t, exp.HashMatches)
+	require.Equal(t, contentID, exp.ContentID.String())
+
+	raw, err := os.ReadFile(outFile)
+	require.NoError(t, err)
+	require.Len(t, raw, int(exp.PackedLength))
+
+	// corrupt the content in its pack blob.
+	packFile := findBlobFile(t, e.RepoDir, string(exp.PackBlobID))
+
+	packData, err := os.ReadFile(packFile)
+	require.NoError(t, err)
+	require.Equal(t, raw, packData[exp.PackOffset:exp.PackOffset+exp.PackedLength])
+
+	packData[exp.PackOffset+5] ^= 1
+	require.NoError(t, os.WriteFile(packFile, packData, 0o600))
+
+	lines := e.RunAndExpectSuccess(t, "content", "export", contentID, outFile)
+	mustGetLineContaining(t, lines, "INVALID")
+
+	raw, err = os.ReadFile(outFile)
+	require.NoError(t, err)
+	require.Equal(t, packData[exp.PackOffset:exp.PackOffset+exp.PackedLength], raw)
+
+	e.RunAndExpectFailure(t, "content", "export", "abcdef", outFile)
+}
+
+// findBlobFile returns the path of the file holding the provided blob in a filesystem repository.
+func findBlobFile(t *testing.T, repoDir, blobID string) string {
+	t.Helper()
+
+	var found string
+
+	require.NoError(t, filepath.Walk(repoDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		rel, _ := filepath.Rel(repoDir, path)
+		if strings.ReplaceAll(strings.TrimSuffix(rel, ".f"), string(filepath.Separator), "") == blobID {
+			found = path
+		}
+
+		return nil
+	}))
+
+	require.NotEmpty(t, found, "blob file not found")
+
+	return found
+}
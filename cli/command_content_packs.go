@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+)
+
+type commandContentPacks struct {
+	long bool
+	raw  bool
+
+	jo  jsonOutput
+	out textOutput
+}
+
+// PackContents describes a pack blob and the contents it holds.
+type PackContents struct {
+	PackID       blob.ID      `json:"packID"`
+	TotalSize    int64        `json:"totalSize"`
+	ContentCount int          `json:"contentCount"`
+	Contents     []content.ID `json:"contents"`
+}
+
+func (c *commandContentPacks) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("packs", "List packs and contents stored in each of them")
+	cmd.Flag("long", "Also list content IDs in each pack").Short('l').BoolVar(&c.long)
+	cmd.Flag("raw", "Raw numbers").Short('r').BoolVar(&c.raw)
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+	cmd.Action(svc.directRepositoryReadAction(c.run))
+}
+
+func (c *commandContentPacks) run(ctx context.Context, rep repo.DirectRepository) error {
+	packs, err := rep.ContentReader().ListPacks(ctx)
+	if err != nil {
+		return errors.Wrap(err, "error listing packs")
+	}
+
+	var jl jsonList
+
+	jl.begin(&c.jo)
+	defer jl.end()
+
+	for _, pi := range packs {
+		pc := PackContents{
+			PackID:       pi.PackID,
+			TotalSize:    pi.TotalSize,
+			ContentCount: pi.ContentCount,
+		}
+
+		for _, ci := range pi.ContentInfos {
+			pc.Contents = append(pc.Contents, ci.GetContentID())
+		}
+
+		if c.jo.jsonOutput {
+			jl.emit(pc)
+			continue
+		}
+
+		c.outputPack(pc)
+	}
+
+	return nil
+}
+
+func (c *commandContentPacks) outputPack(pc PackContents) {
+	size := units.BytesStringBase10(pc.TotalSize)
+	if c.raw {
+		size = strconv.FormatInt(pc.TotalSize, 10) //nolint:gomnd
+	}
+
+	c.out.printStdout("%v %v contents %v\n", pc.PackID, pc.ContentCount, size)
+
+	if c.long {
+		for _, cid := range pc.Contents {
+			c.out.printStdout("  %v\n", cid)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/cli"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestContentPacks(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	dir := testutil.TempDirectory(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file1.txt"), []byte("some unique content"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file2.txt"), []byte("some other content"), 0o600))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+	env.RunAndExpectSuccess(t, "snapshot", "create", dir)
+
+	var packs []cli.PackContents
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "content", "packs", "--json"), &packs)
+	require.NotEmpty(t, packs)
+
+	seen := map[content.ID]bool{}
+
+	for _, p := range packs {
+		require.Len(t, p.Contents, p.ContentCount)
+
+		for _, cid := range p.Contents {
+			require.False(t, seen[cid], "content %v listed in more than one pack", cid)
+			seen[cid] = true
+		}
+	}
+
+	contentIDs := env.RunAndExpectSuccess(t, "content", "list")
+
+	require.Len(t, seen, len(contentIDs))
+
+	for _, cid := range contentIDs {
+		parsed, err := content.ParseID(cid)
+		require.NoError(t, err)
+		require.True(t, seen[parsed], "content %v not listed in any pack", cid)
+	}
+
+	require.Len(t, env.RunAndExpectSuccess(t, "content", "packs"), len(packs))
+}
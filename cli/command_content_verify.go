@@ -2,13 +2,13 @@
 
 import (
 	"context"
-	"math/rand"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/timetrack"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/blob"
@@ -20,6 +20,8 @@ type commandContentVerify struct {
 	contentVerifyFull           bool
 	contentVerifyIncludeDeleted bool
 	contentVerifyPercent        float64
+	contentVerifySampleSeed     int64
+	contentVerifySequentialPack bool
 	progressInterval            time.Duration
 
 	contentRange contentRangeFlags
@@ -32,17 +34,20 @@ func (c *commandContentVerify) setup(svc appServices, parent commandParent) {
 	cmd.Flag("full", "Full verification (including download)").BoolVar(&c.contentVerifyFull)
 	cmd.Flag("include-deleted", "Include deleted contents").BoolVar(&c.contentVerifyIncludeDeleted)
 	cmd.Flag("download-percent", "Download a percentage of files [0.0 .. 100.0]").Float64Var(&c.contentVerifyPercent)
+	cmd.Flag("sample-seed", "Seed used to select downloaded contents, the same seed always selects the same contents (0==random)").Int64Var(&c.contentVerifySampleSeed)
+	cmd.Flag("sequential-packs", "Download entire pack blobs and verify all their contents in one pass, which reduces the number of storage requests, --download-percent selects a percentage of pack blobs").BoolVar(&c.contentVerifySequentialPack)
 	cmd.Flag("progress-interval", "Progress output interval").Default("3s").DurationVar(&c.progressInterval)
 	c.contentRange.setup(cmd)
 	cmd.Action(svc.directRepositoryReadAction(c.run))
 }
 
 func (c *commandContentVerify) run(ctx context.Context, rep repo.DirectRepository) error {
-	blobMap := map[blob.ID]blob.Metadata{}
-	downloadPercent := c.contentVerifyPercent
+	if c.contentVerifySequentialPack {
+		return c.runPacks(ctx, rep)
+	}
 
-	if c.contentVerifyFull {
-		downloadPercent = 100.0
+	if c.contentVerifyFull || c.contentVerifyPercent > 0 {
+		return c.runDownload(ctx, rep)
 	}
 
 	blobMap, err := blob.ReadBlobMap(ctx, rep.BlobReader())
@@ -84,7 +89,7 @@ func (c *commandContentVerify) run(ctx context.Context, rep repo.DirectRepositor
 		Parallel:       c.contentVerifyParallel,
 		IncludeDeleted: c.contentVerifyIncludeDeleted,
 	}, func(ci content.Info) error {
-		if err := c.contentVerify(ctx, rep.ContentReader(), ci, blobMap, downloadPercent); err != nil {
+		if err := c.contentVerify(ci, blobMap); err != nil {
 			log(ctx).Errorf("error %v", err)
 			atomic.AddInt32(errorCount, 1)
 		} else {
@@ -124,6 +129,154 @@ func (c *commandContentVerify) run(ctx context.Context, rep repo.DirectRepositor
 	return errors.Errorf("encountered %v errors", ec)
 }
 
+// runDownload verifies contents by downloading them, either all of them or a random sample.
+func (c *commandContentVerify) runDownload(ctx context.Context, rep repo.DirectRepository) error {
+	samplePercent := c.contentVerifyPercent
+	if c.contentVerifyFull {
+		samplePercent = 100
+	}
+
+	seed := c.contentVerifySampleSeed
+	if seed == 0 {
+		seed = clock.Now().UnixNano()
+	}
+
+	if samplePercent > 0 && samplePercent < 100 {
+		log(ctx).Infof("Verifying %v%% sample of contents with seed %v...", samplePercent, seed)
+	} else {
+		log(ctx).Infof("Verifying all contents...")
+	}
+
+	blobMap, err := blob.ReadBlobMap(ctx, rep.BlobReader())
+	if err != nil {
+		return errors.Wrap(err, "unable to read blob map")
+	}
+
+	rep.DisableIndexRefresh()
+
+	verifiedCount := new(int32)
+	errorCount := new(int32)
+	throttle := new(timetrack.Throttle)
+
+	res, err := content.VerifyContents(ctx, rep.ContentReader(), content.VerifyOptions{
+		BlobMap:        blobMap,
+		Range:          c.contentRange.contentIDRange(),
+		IncludeDeleted: c.contentVerifyIncludeDeleted,
+		Parallel:       c.contentVerifyParallel,
+		SamplePercent:  samplePercent,
+		Seed:           seed,
+		OnContentVerified: func(ci content.Info, err error) {
+			if err != nil {
+				log(ctx).Errorf("error %v", err)
+				atomic.AddInt32(errorCount, 1)
+			}
+
+			atomic.AddInt32(verifiedCount, 1)
+
+			if throttle.ShouldOutput(c.progressInterval) {
+				log(ctx).Infof("  Verified %v contents, %v errors...", atomic.LoadInt32(verifiedCount), atomic.LoadInt32(errorCount))
+			}
+		},
+		OnIndexBlobVerified: func(blobID blob.ID, err error) {
+			if err != nil {
+				log(ctx).Errorf("error %v", err)
+			}
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "error verifying contents")
+	}
+
+	log(ctx).Infof("Finished verifying %v of %v contents and %v index blobs, found %v errors, %v contents with invalid packs and %v invalid index blobs.",
+		res.VerifiedContents, res.TotalContents, res.VerifiedIndexBlobs, res.ErrorCount, res.InvalidPackErrorCount, res.IndexBlobErrorCount)
+	log(ctx).Infof("Estimated error rate: %.3f%%, at most %.3f%% with 95%% confidence.", 100*res.EstimatedErrorRate, 100*res.ErrorRateUpperBound)
+
+	if ec := res.ErrorCount + res.InvalidPackErrorCount + res.IndexBlobErrorCount; ec != 0 {
+		return errors.Errorf("encountered %v errors", ec)
+	}
+
+	return nil
+}
+
+// runPacks verifies contents by downloading entire pack blobs, either all of them or a random sample.
+func (c *commandContentVerify) runPacks(ctx context.Context, rep repo.DirectRepository) error {
+	seed := c.contentVerifySampleSeed
+	if seed == 0 {
+		seed = clock.Now().UnixNano()
+	}
+
+	if c.contentVerifyPercent > 0 && c.contentVerifyPercent < 100 {
+		log(ctx).Infof("Verifying contents of %v%% sample of pack blobs with seed %v...", c.contentVerifyPercent, seed)
+	} else {
+		log(ctx).Infof("Verifying contents of all pack blobs...")
+	}
+
+	rep.DisableIndexRefresh()
+
+	// pack verification only covers existing pack blobs, so check separately that no content references
+	// a missing pack blob, which does not require downloading anything.
+	blobMap, err := blob.ReadBlobMap(ctx, rep.BlobReader())
+	if err != nil {
+		return errors.Wrap(err, "unable to read blob map")
+	}
+
+	var invalidPackErrorCount int32
+
+	if err := rep.ContentReader().IterateContents(ctx, content.IterateOptions{
+		Parallel:       c.contentVerifyParallel,
+		IncludeDeleted: c.contentVerifyIncludeDeleted,
+	}, func(ci content.Info) error {
+		if err := c.contentVerify(ci, blobMap); err != nil {
+			log(ctx).Errorf("error %v", err)
+			atomic.AddInt32(&invalidPackErrorCount, 1)
+		}
+
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "iterate contents")
+	}
+
+	verifiedCount := new(int32)
+	errorCount := new(int32)
+	throttle := new(timetrack.Throttle)
+
+	res, err := content.VerifyPacks(ctx, rep.ContentReader(), content.VerifyPacksOptions{
+		IncludeDeleted: c.contentVerifyIncludeDeleted,
+		Parallel:       c.contentVerifyParallel,
+		SamplePercent:  c.contentVerifyPercent,
+		Seed:           seed,
+		OnContentVerified: func(ci content.Info, err error) {
+			if err != nil {
+				log(ctx).Errorf("error %v", err)
+				atomic.AddInt32(errorCount, 1)
+			}
+
+			atomic.AddInt32(verifiedCount, 1)
+
+			if throttle.ShouldOutput(c.progressInterval) {
+				log(ctx).Infof("  Verified %v contents, %v errors...", atomic.LoadInt32(verifiedCount), atomic.LoadInt32(errorCount))
+			}
+		},
+		OnPackVerified: func(packBlobID blob.ID, err error) {
+			if err != nil {
+				log(ctx).Errorf("error %v", err)
+			}
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "error verifying packs")
+	}
+
+	log(ctx).Infof("Finished verifying %v contents in %v of %v pack blobs, found %v errors, %v contents with invalid packs and %v invalid pack blobs.",
+		res.VerifiedContents, res.VerifiedPacks, res.TotalPacks, res.ErrorCount, atomic.LoadInt32(&invalidPackErrorCount), res.PackErrorCount)
+
+	if ec := res.ErrorCount + res.PackErrorCount + int(atomic.LoadInt32(&invalidPackErrorCount)); ec != 0 {
+		return errors.Errorf("encountered %v errors", ec)
+	}
+
+	return nil
+}
+
 func (c *commandContentVerify) getTotalContentCount(ctx context.Context, rep repo.DirectRepository, totalCount *int32) {
 	var tc int32
 
@@ -145,7 +298,7 @@ func (c *commandContentVerify) getTotalContentCount(ctx context.Context, rep rep
 	atomic.StoreInt32(totalCount, tc)
 }
 
-func (c *commandContentVerify) contentVerify(ctx context.Context, r content.Reader, ci content.Info, blobMap map[blob.ID]blob.Metadata, downloadPercent float64) error {
+func (c *commandContentVerify) contentVerify(ci content.Info, blobMap map[blob.ID]blob.Metadata) error {
 	bi, ok := blobMap[ci.GetPackBlobID()]
 	if !ok {
 		return errors.Errorf("content %v depends on missing blob %v", ci.GetContentID(), ci.GetPackBlobID())
@@ -155,14 +308,5 @@ func (c *commandContentVerify) contentVerify(ctx context.Context, r content.Read
 		return errors.Errorf("content %v out of bounds of its pack blob %v", ci.GetContentID(), ci.GetPackBlobID())
 	}
 
-	//nolint:gosec
-	if 100*rand.Float64() < downloadPercent {
-		if _, err := r.GetContent(ctx, ci.GetContentID()); err != nil {
-			return errors.Wrapf(err, "content %v is invalid", ci.GetContentID())
-		}
-
-		return nil
-	}
-
 	return nil
 }
@@ -23,6 +23,8 @@ func (s *formatSpecificTestSuite) TestContentVerify(t *testing.T) {
 	env.RunAndExpectSuccess(t, "content", "verify")
 	env.RunAndExpectSuccess(t, "snapshot", "create", dir)
 	env.RunAndExpectSuccess(t, "content", "verify", "--download-percent=30")
+	env.RunAndExpectSuccess(t, "content", "verify", "--download-percent=10", "--sample-seed=5")
+	env.RunAndExpectSuccess(t, "content", "verify", "--sequential-packs")
 
 	// delete one of 'p' blobs.
 	blobIDToDelete := strings.Split(env.RunAndExpectSuccess(t, "blob", "list", "--prefix=p")[0], " ")[0]
@@ -37,4 +39,8 @@ func (s *formatSpecificTestSuite) TestContentVerify(t *testing.T) {
 	mustGetLineContaining(t, verifyStderr, "missing blob "+blobIDToDelete)
 
 	env.RunAndExpectFailure(t, "content", "verify", "--full")
+
+	// missing packs are detected regardless of sampling.
+	env.RunAndExpectFailure(t, "content", "verify", "--download-percent=0.1")
+	env.RunAndExpectFailure(t, "content", "verify", "--sequential-packs")
 }
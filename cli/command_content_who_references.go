@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+type commandContentWhoReferences struct {
+	ids     []string
+	rebuild bool
+
+	out textOutput
+}
+
+func (c *commandContentWhoReferences) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("who-references", "Show paths of files and directories referencing given contents.")
+
+	cmd.Arg("id", "IDs of contents to look up").StringsVar(&c.ids)
+	cmd.Flag("rebuild", "Rebuild the content reference index from all snapshots before looking up").BoolVar(&c.rebuild)
+	cmd.Action(svc.repositoryWriterAction(c.run))
+
+	c.out.setup(svc)
+}
+
+func (c *commandContentWhoReferences) run(ctx context.Context, rep repo.RepositoryWriter) error {
+	if c.rebuild {
+		log(ctx).Infof("Rebuilding content reference index...")
+
+		if err := snapshotfs.RebuildContentReferences(ctx, rep); err != nil {
+			return errors.Wrap(err, "error rebuilding content reference index")
+		}
+	}
+
+	for _, id := range c.ids {
+		paths, err := repo.WhoReferences(ctx, rep, id)
+		if err != nil {
+			return errors.Wrapf(err, "error looking up references to %v", id)
+		}
+
+		for _, p := range paths {
+			c.out.printStdout("%v %v\n", id, p)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/cli"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestContentWhoReferences(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	dir := testutil.TempDirectory(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file1.txt"), []byte("some unique content"), 0o600))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+	env.RunAndExpectSuccess(t, "snapshot", "create", dir)
+
+	var snapshots []*cli.SnapshotManifest
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "snapshot", "list", "--json"), &snapshots)
+	require.Len(t, snapshots, 1)
+
+	// directory object IDs are the same as their content IDs.
+	oid := snapshots[0].RootObjectID().String()
+
+	env.RunAndExpectFailure(t, "content", "who-references", oid)
+
+	out := env.RunAndExpectSuccess(t, "content", "who-references", "--rebuild", oid)
+	require.Len(t, out, 1)
+	require.Equal(t, oid+" "+snapshots[0].Source.String(), out[0])
+}
@@ -13,6 +13,9 @@ type commandIndexOptimize struct {
 	optimizeDropDeletedOlderThan time.Duration
 	optimizeDropContents         []string
 	optimizeAllIndexes           bool
+	optimizeMaxClockSkew         time.Duration
+	optimizeFailOnClockSkew      bool
+	optimizeLockWait             time.Duration
 
 	svc appServices
 }
@@ -23,6 +26,9 @@ func (c *commandIndexOptimize) setup(svc appServices, parent commandParent) {
 	cmd.Flag("drop-deleted-older-than", "Drop deleted contents above given age").DurationVar(&c.optimizeDropDeletedOlderThan)
 	cmd.Flag("drop-contents", "Drop contents with given IDs").StringsVar(&c.optimizeDropContents)
 	cmd.Flag("all", "Optimize all indexes, even those above maximum size.").BoolVar(&c.optimizeAllIndexes)
+	cmd.Flag("max-clock-skew", "Maximum allowed difference between local and storage clocks when dropping deleted contents").DurationVar(&c.optimizeMaxClockSkew)
+	cmd.Flag("fail-on-clock-skew", "Refuse to drop deleted contents when local and storage clocks differ too much").BoolVar(&c.optimizeFailOnClockSkew)
+	cmd.Flag("lock-wait", "Maximum time to wait for index compaction by another client to finish, fail immediately when zero").DurationVar(&c.optimizeLockWait)
 	cmd.Action(svc.directRepositoryWriteAction(c.runOptimizeCommand))
 
 	c.svc = svc
@@ -37,9 +43,12 @@ func (c *commandIndexOptimize) runOptimizeCommand(ctx context.Context, rep repo.
 	}
 
 	opt := content.CompactOptions{
-		MaxSmallBlobs: c.optimizeMaxSmallBlobs,
-		AllIndexes:    c.optimizeAllIndexes,
-		DropContents:  contentIDs,
+		MaxSmallBlobs:   c.optimizeMaxSmallBlobs,
+		AllIndexes:      c.optimizeAllIndexes,
+		DropContents:    contentIDs,
+		MaxClockSkew:    c.optimizeMaxClockSkew,
+		FailOnClockSkew: c.optimizeFailOnClockSkew,
+		LockWaitTime:    c.optimizeLockWait,
 	}
 
 	if age := c.optimizeDropDeletedOlderThan; age > 0 {
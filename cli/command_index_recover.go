@@ -2,6 +2,7 @@
 
 import (
 	"context"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -15,12 +16,18 @@
 )
 
 type commandIndexRecover struct {
-	blobIDs       []string
-	blobPrefixes  []string
-	commit        bool
-	ignoreErrors  bool
-	parallel      int
-	deleteIndexes bool
+	blobIDs          []string
+	blobPrefixes     []string
+	commit           bool
+	ignoreErrors     bool
+	parallel         int
+	deleteIndexes    bool
+	verify           bool
+	batchSize        int
+	progressInterval time.Duration
+
+	pendingMutex      sync.Mutex
+	pendingCommitSize int
 
 	svc appServices
 }
@@ -33,6 +40,9 @@ func (c *commandIndexRecover) setup(svc appServices, parent commandParent) {
 	cmd.Flag("ignore-errors", "Ignore errors when recovering").BoolVar(&c.ignoreErrors)
 	cmd.Flag("delete-indexes", "Delete all indexes before recovering").BoolVar(&c.deleteIndexes)
 	cmd.Flag("commit", "Commit recovered content").BoolVar(&c.commit)
+	cmd.Flag("batch-size", "Write recovered index entries after this many contents to bound memory usage (0=at the end)").Default("0").IntVar(&c.batchSize)
+	cmd.Flag("progress-interval", "How often to report progress").Default("1s").DurationVar(&c.progressInterval)
+	cmd.Flag("verify", "Read entire pack blobs and only recover contents that can be decrypted and match their hashes").BoolVar(&c.verify)
 	cmd.Action(svc.directRepositoryWriteAction(c.run))
 
 	c.svc = svc
@@ -148,7 +158,7 @@ func (c *commandIndexRecover) recoverIndexesFromAllPacks(ctx context.Context, re
 				log(ctx).Debugf("worker %v got %v", worker, cnt)
 				cnt++
 
-				if tt.ShouldOutput(time.Second) {
+				if tt.ShouldOutput(c.progressInterval) {
 					if disc := atomic.LoadInt32(discoveredBlobCount); disc > 0 {
 						e, ok := est.Estimate(float64(finishedBlobs), float64(disc))
 						if ok {
@@ -183,7 +193,7 @@ func (c *commandIndexRecover) recoverIndexesFromAllPacks(ctx context.Context, re
 func (c *commandIndexRecover) recoverIndexFromSinglePackFile(ctx context.Context, rep repo.DirectRepositoryWriter, blobID blob.ID, length int64, processedBlobCount, recoveredContentCount *int32) error {
 	log(ctx).Debugf("recovering from %v", blobID)
 
-	recovered, err := rep.ContentManager().RecoverIndexFromPackBlob(ctx, blobID, length, c.commit)
+	recovered, invalid, err := c.recoverEntries(ctx, rep, blobID, length)
 	if err != nil {
 		if c.ignoreErrors {
 			return nil
@@ -196,5 +206,46 @@ func (c *commandIndexRecover) recoverIndexFromSinglePackFile(ctx context.Context
 	atomic.AddInt32(processedBlobCount, 1)
 	log(ctx).Debugf("Recovered %v entries from %v (commit=%v)", len(recovered), blobID, c.commit)
 
+	if err := c.maybeFlushBatch(ctx, rep, len(recovered)); err != nil {
+		return err
+	}
+
+	if invalid > 0 {
+		log(ctx).Errorf("Skipped %v invalid contents in %v", invalid, blobID)
+	}
+
 	return nil
 }
+
+// maybeFlushBatch writes committed index entries once the number of pending ones reaches the batch size.
+func (c *commandIndexRecover) maybeFlushBatch(ctx context.Context, rep repo.DirectRepositoryWriter, n int) error {
+	if !c.commit || c.batchSize <= 0 {
+		return nil
+	}
+
+	c.pendingMutex.Lock()
+	defer c.pendingMutex.Unlock()
+
+	c.pendingCommitSize += n
+	if c.pendingCommitSize < c.batchSize {
+		return nil
+	}
+
+	log(ctx).Debugf("writing batch of %v recovered index entries", c.pendingCommitSize)
+
+	c.pendingCommitSize = 0
+
+	return errors.Wrap(rep.ContentManager().Flush(ctx), "error writing recovered index entries")
+}
+
+func (c *commandIndexRecover) recoverEntries(ctx context.Context, rep repo.DirectRepositoryWriter, blobID blob.ID, length int64) ([]content.Info, int, error) {
+	if c.verify {
+		//nolint:wrapcheck
+		return rep.ContentManager().RecoverVerifiedIndexFromPackBlob(ctx, blobID, c.commit)
+	}
+
+	recovered, err := rep.ContentManager().RecoverIndexFromPackBlob(ctx, blobID, length, c.commit)
+
+	//nolint:wrapcheck
+	return recovered, 0, err
+}
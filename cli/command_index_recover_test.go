@@ -0,0 +1,78 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func (s *formatSpecificTestSuite) TestIndexRecoverVerify(t *testing.T) {
+	env := testenv.NewCLITest(t, s.formatFlags, testenv.NewInProcRunner(t))
+
+	dir := testutil.TempDirectory(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file1.txt"), bytes.Repeat([]byte{1, 2, 3, 4, 5}, 15000), 0o600))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+	env.RunAndExpectSuccess(t, "snapshot", "create", dir)
+
+	contentsBefore := env.RunAndExpectSuccess(t, "content", "list")
+
+	// delete all index blobs.
+	for _, prefix := range []string{"n", "x"} {
+		for _, l := range env.RunAndExpectSuccess(t, "blob", "list", "--prefix="+prefix) {
+			env.RunAndExpectSuccess(t, "blob", "delete", strings.Split(l, " ")[0])
+		}
+	}
+
+	// clear the cache which holds copies of deleted index blobs.
+	env.RunAndExpectSuccess(t, "cache", "clear")
+	require.Empty(t, env.RunAndExpectSuccess(t, "content", "list"))
+
+	// without --commit, nothing is recovered.
+	env.RunAndExpectSuccess(t, "index", "recover", "--verify")
+	require.Empty(t, env.RunAndExpectSuccess(t, "content", "list"))
+
+	env.RunAndExpectSuccess(t, "index", "recover", "--verify", "--commit")
+	require.Equal(t, contentsBefore, env.RunAndExpectSuccess(t, "content", "list"))
+
+	env.RunAndExpectSuccess(t, "snapshot", "verify")
+}
+
+func (s *formatSpecificTestSuite) TestIndexRecoverParallelBatches(t *testing.T) {
+	env := testenv.NewCLITest(t, s.formatFlags, testenv.NewInProcRunner(t))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+
+	// create several pack blobs.
+	for i := 0; i < 5; i++ {
+		dir := testutil.TempDirectory(t)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "file1.txt"), bytes.Repeat([]byte{byte(i), 2, 3, 4, 5}, 15000), 0o600))
+		env.RunAndExpectSuccess(t, "snapshot", "create", dir)
+	}
+
+	contentsBefore := env.RunAndExpectSuccess(t, "content", "list")
+
+	for _, prefix := range []string{"n", "x"} {
+		for _, l := range env.RunAndExpectSuccess(t, "blob", "list", "--prefix="+prefix) {
+			env.RunAndExpectSuccess(t, "blob", "delete", strings.Split(l, " ")[0])
+		}
+	}
+
+	env.RunAndExpectSuccess(t, "cache", "clear")
+	require.Empty(t, env.RunAndExpectSuccess(t, "content", "list"))
+
+	env.RunAndExpectSuccess(t, "index", "recover", "--commit", "--parallel=4", "--batch-size=1", "--progress-interval=1ms")
+	require.Equal(t, contentsBefore, env.RunAndExpectSuccess(t, "content", "list"))
+
+	// each batch was written as a separate index blob.
+	require.Greater(t, len(env.RunAndExpectSuccess(t, "index", "list")), 1)
+
+	env.RunAndExpectSuccess(t, "snapshot", "verify")
+}
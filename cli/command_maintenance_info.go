@@ -66,6 +66,20 @@ func (c *commandMaintenanceInfo) run(ctx context.Context, rep repo.DirectReposit
 	c.out.printStdout("  max age of logs: %v\n", cl.MaxAge)
 	c.out.printStdout("  max total size:  %v\n", units.BytesStringBase2(cl.MaxTotalSize))
 
+	c.out.printStdout("Blob Deletion:\n")
+
+	if v := p.BlobDeletion.Parallel; v > 0 {
+		c.out.printStdout("  parallel:        %v\n", v)
+	} else {
+		c.out.printStdout("  parallel:        (default)\n")
+	}
+
+	if v := p.BlobDeletion.MaxDeletesPerSecond; v > 0 {
+		c.out.printStdout("  max per second:  %v\n", v)
+	} else {
+		c.out.printStdout("  max per second:  (unlimited)\n")
+	}
+
 	c.out.printStdout("Recent Maintenance Runs:\n")
 
 	for run, timings := range s.Runs {
@@ -23,6 +23,9 @@ type commandMaintenanceSet struct {
 	maxRetainedLogCount       int
 	maxRetainedLogAge         time.Duration
 	maxTotalRetainedLogSizeMB int64
+
+	blobDeleteParallel      int
+	maxBlobDeletesPerSecond float64
 }
 
 func (c *commandMaintenanceSet) setup(svc appServices, parent commandParent) {
@@ -37,6 +40,9 @@ func (c *commandMaintenanceSet) setup(svc appServices, parent commandParent) {
 	c.maxRetainedLogAge = -1
 	c.maxTotalRetainedLogSizeMB = -1
 
+	c.blobDeleteParallel = -1
+	c.maxBlobDeletesPerSecond = -1
+
 	cmd.Flag("owner", "Set maintenance owner user@hostname").StringVar(&c.maintenanceSetOwner)
 
 	cmd.Flag("enable-quick", "Enable or disable quick maintenance").BoolListVar(&c.maintenanceSetEnableQuick)
@@ -52,9 +58,28 @@ func (c *commandMaintenanceSet) setup(svc appServices, parent commandParent) {
 	cmd.Flag("max-retained-log-age", "Set maximum age of log sessions to retain").DurationVar(&c.maxRetainedLogAge)
 	cmd.Flag("max-retained-log-size-mb", "Set maximum total size of log sessions").Int64Var(&c.maxTotalRetainedLogSizeMB)
 
+	cmd.Flag("blob-delete-parallel", "Set number of parallel deletes of unreferenced blobs (0 means default)").IntVar(&c.blobDeleteParallel)
+	cmd.Flag("max-blob-deletes-per-second", "Set maximum number of deletes of unreferenced blobs per second (0 means unlimited)").Float64Var(&c.maxBlobDeletesPerSecond)
+
 	cmd.Action(svc.directRepositoryWriteAction(c.run))
 }
 
+func (c *commandMaintenanceSet) setBlobDeletionParametersFromFlags(ctx context.Context, p *maintenance.Params, changed *bool) {
+	if v := c.blobDeleteParallel; v != -1 {
+		p.BlobDeletion.Parallel = v
+		*changed = true
+
+		log(ctx).Infof("Setting number of parallel blob deletes to %v.", v)
+	}
+
+	if v := c.maxBlobDeletesPerSecond; v != -1 {
+		p.BlobDeletion.MaxDeletesPerSecond = v
+		*changed = true
+
+		log(ctx).Infof("Setting maximum number of blob deletes per second to %v.", v)
+	}
+}
+
 func (c *commandMaintenanceSet) setLogCleanupParametersFromFlags(ctx context.Context, p *maintenance.Params, changed *bool) {
 	if v := c.maxRetainedLogCount; v != -1 {
 		cl := p.LogRetention.OrDefault()
@@ -138,6 +163,7 @@ func (c *commandMaintenanceSet) run(ctx context.Context, rep repo.DirectReposito
 	c.setMaintenanceEnabledAndIntervalFromFlags(ctx, &p.QuickCycle, "quick", c.maintenanceSetEnableQuick, c.maintenanceSetQuickFrequency, &changedParams)
 	c.setMaintenanceEnabledAndIntervalFromFlags(ctx, &p.FullCycle, "full", c.maintenanceSetEnableFull, c.maintenanceSetFullFrequency, &changedParams)
 	c.setLogCleanupParametersFromFlags(ctx, p, &changedParams)
+	c.setBlobDeletionParametersFromFlags(ctx, p, &changedParams)
 
 	if pauseDuration := c.maintenanceSetPauseQuick; pauseDuration != -1 {
 		s.NextQuickMaintenanceTime = rep.Time().Add(pauseDuration)
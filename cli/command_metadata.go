@@ -0,0 +1,13 @@
+package cli
+
+type commandMetadata struct {
+	show    commandMetadataShow
+	orphans commandMetadataOrphans
+}
+
+func (c *commandMetadata) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("metadata", "Low-level commands to inspect and clean up metadata items.").Hidden()
+
+	c.show.setup(svc, cmd)
+	c.orphans.setup(svc, cmd)
+}
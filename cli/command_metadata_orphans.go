@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/snapshot/snapshotgc"
+)
+
+type commandMetadataOrphans struct {
+	livePrefixes []string
+	liveIDs      []string
+	minAge       time.Duration
+
+	out textOutput
+}
+
+func (c *commandMetadataOrphans) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("orphans", "List metadata items not reachable from any snapshot or other live reference.")
+	cmd.Flag("live-prefix", "Prefix of metadata items which are always live").StringsVar(&c.livePrefixes)
+	cmd.Flag("live", "ID of metadata item which is live").StringsVar(&c.liveIDs)
+	cmd.Flag("min-age", "Minimum age of orphaned metadata items, newer items may belong to snapshots in progress").Default("24h").DurationVar(&c.minAge)
+	cmd.Action(svc.directRepositoryReadAction(c.run))
+
+	c.out.setup(svc)
+}
+
+func (c *commandMetadataOrphans) run(ctx context.Context, rep repo.DirectRepository) error {
+	opt := snapshotgc.OrphanedMetadataOptions{
+		MinAge: c.minAge,
+	}
+
+	for _, p := range c.livePrefixes {
+		prefix := content.IDPrefix(p)
+		if err := prefix.ValidateSingle(); err != nil || prefix == "" {
+			return errors.Errorf("invalid metadata item prefix %q", p)
+		}
+
+		opt.LivePrefixes = append(opt.LivePrefixes, prefix)
+	}
+
+	liveIDs, err := toContentIDs(c.liveIDs)
+	if err != nil {
+		return err
+	}
+
+	opt.LiveIDs = liveIDs
+
+	orphans, err := snapshotgc.FindOrphanedMetadata(ctx, rep, opt)
+	if err != nil {
+		return errors.Wrap(err, "error finding orphaned metadata items")
+	}
+
+	var totalBytes int64
+
+	for _, ci := range orphans {
+		c.out.printStdout("%v %v %v\n", ci.GetContentID(), ci.GetPackedLength(), formatTimestamp(ci.Timestamp()))
+
+		totalBytes += int64(ci.GetPackedLength())
+	}
+
+	log(ctx).Infof("Found %v orphaned metadata items (%v).", len(orphans), units.BytesStringBase10(totalBytes))
+
+	return nil
+}
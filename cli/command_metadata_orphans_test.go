@@ -0,0 +1,94 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestMetadataOrphans(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	liveDir := testutil.TempDirectory(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(liveDir, "sub"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(liveDir, "sub", "file1"), []byte("contents of file1"), 0o600))
+
+	orphanDir := testutil.TempDirectory(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(orphanDir, "sub1", "sub2"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(orphanDir, "sub1", "sub2", "file2"), []byte("contents of file2"), 0o600))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+
+	var liveMan, orphanMan snapshot.Manifest
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "snapshot", "create", liveDir, "--json"), &liveMan)
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "snapshot", "create", orphanDir, "--json"), &orphanMan)
+
+	liveItems := metadataItemsOfSnapshot(t, env, liveMan.RootObjectID())
+	orphanItems := metadataItemsOfSnapshot(t, env, orphanMan.RootObjectID())
+
+	require.Len(t, liveItems, 2)
+	require.Len(t, orphanItems, 3)
+
+	// all metadata items are reachable while both snapshots exist.
+	require.Empty(t, orphanIDs(env.RunAndExpectSuccess(t, "metadata", "orphans", "--min-age=0s")))
+
+	// deleting the snapshot manifest makes its directories unreachable.
+	env.RunAndExpectSuccess(t, "manifest", "rm", string(orphanMan.ID))
+
+	require.Equal(t, orphanItems, orphanIDs(env.RunAndExpectSuccess(t, "metadata", "orphans", "--min-age=0s")))
+
+	// recent items are never reported by default.
+	require.Empty(t, orphanIDs(env.RunAndExpectSuccess(t, "metadata", "orphans")))
+
+	// live references are not reported.
+	require.Empty(t, orphanIDs(env.RunAndExpectSuccess(t, "metadata", "orphans", "--min-age=0s", "--live-prefix=k")))
+	require.Equal(t, orphanItems[1:], orphanIDs(env.RunAndExpectSuccess(t, "metadata", "orphans", "--min-age=0s", "--live", orphanItems[0])))
+
+	env.RunAndExpectFailure(t, "metadata", "orphans", "--live-prefix=0")
+
+	// listing orphans never deletes them.
+	contents := env.RunAndExpectSuccess(t, "content", "ls")
+
+	for _, id := range append(liveItems, orphanItems...) {
+		require.Contains(t, contents, id)
+	}
+}
+
+// metadataItemsOfSnapshot returns sorted IDs of directory listings of the snapshot with the provided root.
+func metadataItemsOfSnapshot(t *testing.T, env *testenv.CLITest, rootID object.ID) []string {
+	t.Helper()
+
+	result := []string{rootID.String()}
+
+	for _, ent := range mustGetFileMap(t, env, rootID) {
+		if ent.Type == snapshot.EntryTypeDirectory {
+			result = append(result, ent.ObjectID.String())
+		}
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+func orphanIDs(lines []string) []string {
+	var result []string
+
+	for _, l := range lines {
+		result = append(result, strings.Fields(l)[0])
+	}
+
+	sort.Strings(result)
+
+	return result
+}
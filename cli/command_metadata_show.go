@@ -0,0 +1,17 @@
+package cli
+
+// commandMetadataShow is an alias of 'content show --json'.
+type commandMetadataShow struct {
+	commandContentShow
+}
+
+func (c *commandMetadataShow) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("show", "Show metadata items by ID (same as 'content show --json').")
+
+	cmd.Arg("id", "IDs of metadata items to show").Required().StringsVar(&c.ids)
+	cmd.Action(svc.directRepositoryReadAction(c.run))
+
+	c.indentJSON = true
+
+	c.out.setup(svc)
+}
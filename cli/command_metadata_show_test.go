@@ -0,0 +1,37 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/cli"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestMetadataShow(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	dir := testutil.TempDirectory(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file1.txt"), []byte("some file content"), 0o600))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+	env.RunAndExpectSuccess(t, "snapshot", "create", dir)
+
+	var snapshots []*cli.SnapshotManifest
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "snapshot", "list", "--json"), &snapshots)
+	require.Len(t, snapshots, 1)
+
+	// directory object IDs are the same as IDs of metadata contents storing the JSON listing.
+	itemID := snapshots[0].RootObjectID().String()
+
+	got := env.RunAndExpectSuccess(t, "metadata", "show", itemID)
+	require.Equal(t, env.RunAndExpectSuccess(t, "content", "show", "--json", itemID), got)
+	require.Contains(t, got, `      "name": "file1.txt",`)
+
+	env.RunAndExpectFailure(t, "metadata", "show", "not-a-valid-id")
+}
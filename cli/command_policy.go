@@ -13,21 +13,25 @@
 )
 
 type commandPolicy struct {
-	edit   commandPolicyEdit
-	list   commandPolicyList
-	delete commandPolicyDelete
-	set    commandPolicySet
-	show   commandPolicyShow
+	diff     commandPolicyDiff
+	edit     commandPolicyEdit
+	list     commandPolicyList
+	delete   commandPolicyDelete
+	set      commandPolicySet
+	show     commandPolicyShow
+	validate commandPolicyValidate
 }
 
 func (c *commandPolicy) setup(svc appServices, parent commandParent) {
 	cmd := parent.Command("policy", "Commands to manipulate snapshotting policies.").Alias("policies")
 
+	c.diff.setup(svc, cmd)
 	c.edit.setup(svc, cmd)
 	c.list.setup(svc, cmd)
 	c.delete.setup(svc, cmd)
 	c.set.setup(svc, cmd)
 	c.show.setup(svc, cmd)
+	c.validate.setup(svc, cmd)
 }
 
 type policyTargetFlags struct {
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+type commandPolicyDiff struct {
+	oldTarget string
+	newTarget string
+
+	jo  jsonOutput
+	out textOutput
+}
+
+func (c *commandPolicyDiff) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("diff", "Show differences between two policies.")
+	cmd.Arg("old", "Policy manifest ID or target ('user@host','@host','user@host:path', a local path or '(global)') whose effective policy is compared").Required().StringVar(&c.oldTarget)
+	cmd.Arg("new", "Policy manifest ID or target to compare against").Required().StringVar(&c.newTarget)
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+	cmd.Action(svc.repositoryReaderAction(c.run))
+}
+
+func (c *commandPolicyDiff) run(ctx context.Context, rep repo.Repository) error {
+	oldPolicy, err := loadPolicyForDiff(ctx, rep, c.oldTarget)
+	if err != nil {
+		return err
+	}
+
+	newPolicy, err := loadPolicyForDiff(ctx, rep, c.newTarget)
+	if err != nil {
+		return err
+	}
+
+	diffs := policy.Diff(oldPolicy, newPolicy)
+
+	if c.jo.jsonOutput {
+		c.out.printStdout("%s\n", c.jo.jsonBytes(diffs))
+		return nil
+	}
+
+	if len(diffs) == 0 {
+		c.out.printStderr("Policies are identical.\n")
+		return nil
+	}
+
+	for _, d := range diffs {
+		c.out.printStdout("%v: %v -> %v\n", d.Path, d.Old, d.New)
+	}
+
+	return nil
+}
+
+// loadPolicyForDiff returns the policy stored in a manifest with the provided ID or the effective policy
+// for the provided target.
+func loadPolicyForDiff(ctx context.Context, rep repo.Repository, ts string) (*policy.Policy, error) {
+	if p, err := policy.GetPolicyByID(ctx, rep, manifest.ID(ts)); err == nil {
+		return p, nil
+	}
+
+	target, err := snapshot.ParseSourceInfo(ts, rep.ClientOptions().Hostname, rep.ClientOptions().Username)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse source info: %q", ts)
+	}
+
+	effective, _, _, err := policy.GetEffectivePolicy(ctx, rep, target)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't get effective policy for %q", target)
+	}
+
+	return effective, nil
+}
@@ -0,0 +1,55 @@
+package cli_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/snapshot/policy"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestPolicyDiff(t *testing.T) {
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	dir1 := testutil.TempDirectory(t)
+	dir2 := testutil.TempDirectory(t)
+
+	// both directories inherit everything from the global policy.
+	require.Empty(t, e.RunAndExpectSuccess(t, "policy", "diff", dir1, dir2))
+
+	e.RunAndExpectSuccess(t, "policy", "set", dir1, "--keep-latest=5", "--max-parallel-file-reads=4")
+	e.RunAndExpectSuccess(t, "policy", "set", dir2, "--keep-latest=7", "--max-parallel-file-reads=4", "--add-ignore=*.tmp", "--compression=zstd")
+
+	require.Equal(t, []string{
+		`retention.keepLatest: 5 -> 7`,
+		`files.ignore: - -> ["*.tmp"]`,
+		`compression.compressorName: "none" -> "zstd"`,
+	}, e.RunAndExpectSuccess(t, "policy", "diff", dir1, dir2))
+
+	// policies referenced by manifest ID are compared as defined, without inherited values.
+	var policies []policy.TargetWithPolicy
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "policy", "list", "--json"), &policies)
+
+	ids := map[string]string{}
+
+	for _, p := range policies {
+		ids[p.Target.Path] = p.ID
+	}
+
+	require.NotEmpty(t, ids[dir1])
+	require.NotEmpty(t, ids[dir2])
+
+	require.Equal(t, []string{
+		`retention.keepLatest: 7 -> 5`,
+		`files.ignore: ["*.tmp"] -> -`,
+		`compression.compressorName: "zstd" -> -`,
+	}, e.RunAndExpectSuccess(t, "policy", "diff", ids[dir2], ids[dir1]))
+
+	e.RunAndExpectFailure(t, "policy", "diff", dir1)
+}
@@ -5,6 +5,7 @@
 	"sort"
 	"strconv"
 
+	"github.com/alecthomas/kingpin"
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/internal/units"
@@ -29,6 +30,12 @@ type commandPolicySet struct {
 
 func (c *commandPolicySet) setup(svc appServices, parent commandParent) {
 	cmd := parent.Command("set", "Set snapshot policy for a single directory, user@host or a global policy.")
+	c.setupFlags(cmd)
+
+	cmd.Action(svc.repositoryWriterAction(c.run))
+}
+
+func (c *commandPolicySet) setupFlags(cmd *kingpin.CmdClause) {
 	c.policyTargetFlags.setup(cmd)
 	cmd.Flag(inheritPolicyString, "Enable or disable inheriting policies from the parent").BoolListVar(&c.inherit)
 
@@ -40,8 +47,6 @@ func (c *commandPolicySet) setup(svc appServices, parent commandParent) {
 	c.policyRetentionFlags.setup(cmd)
 	c.policySchedulingFlags.setup(cmd)
 	c.policyUploadFlags.setup(cmd)
-
-	cmd.Action(svc.repositoryWriterAction(c.run))
 }
 
 //nolint:gochecknoglobals
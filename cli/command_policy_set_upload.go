@@ -12,12 +12,16 @@ type policyUploadFlags struct {
 	maxParallelUploads            string
 	maxParallelFileReads          string
 	parallelizeUploadAboveSizeMiB string
+	storeExtendedAttributes       string
+	storeACLs                     string
 }
 
 func (c *policyUploadFlags) setup(cmd *kingpin.CmdClause) {
 	cmd.Flag("max-parallel-file-reads", "Maximum number of parallel file reads").StringVar(&c.maxParallelFileReads)
 	cmd.Flag("max-parallel-snapshots", "Maximum number of parallel snapshots (server, KopiaUI only)").StringVar(&c.maxParallelUploads)
 	cmd.Flag("parallel-upload-above-size-mib", "Use parallel uploads above size").StringVar(&c.parallelizeUploadAboveSizeMiB)
+	cmd.Flag("store-xattrs", "Store extended attributes of files and directories ('true', 'false', 'inherit')").EnumVar(&c.storeExtendedAttributes, booleanEnumValues...)
+	cmd.Flag("store-acls", "Store POSIX access control lists of files and directories ('true', 'false', 'inherit')").EnumVar(&c.storeACLs, booleanEnumValues...)
 }
 
 func (c *policyUploadFlags) setUploadPolicyFromFlags(ctx context.Context, up *policy.UploadPolicy, changeCount *int) error {
@@ -33,5 +37,13 @@ func (c *policyUploadFlags) setUploadPolicyFromFlags(ctx context.Context, up *po
 		return err
 	}
 
+	if err := applyPolicyBoolPtr(ctx, "store extended attributes", &up.StoreExtendedAttributes, c.storeExtendedAttributes, changeCount); err != nil {
+		return err
+	}
+
+	if err := applyPolicyBoolPtr(ctx, "store ACLs", &up.StoreACLs, c.storeACLs, changeCount); err != nil {
+		return err
+	}
+
 	return nil
 }
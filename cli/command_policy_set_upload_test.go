@@ -1,6 +1,7 @@
 package cli_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -48,3 +49,38 @@ func TestSetUploadPolicy(t *testing.T) {
 	require.Contains(t, lines, " Max parallel file reads: - inherited from (global)")
 	require.Contains(t, lines, " Parallel upload above size: 2 GiB inherited from (global)")
 }
+
+func TestValidateUploadPolicy(t *testing.T) {
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	td := testutil.TempDirectory(t)
+
+	lines := e.RunAndExpectSuccess(t, "policy", "validate", "--global", "--max-parallel-snapshots=3", "--max-parallel-file-reads=8")
+	require.Len(t, lines, 1)
+	require.Contains(t, lines[0], "is valid")
+
+	e.RunAndExpectSuccess(t, "policy", "validate", td, "--parallel-upload-above-size-mib=100")
+
+	_, stderr, err := e.Run(t, true, "policy", "validate", "--global", "--max-parallel-file-reads=-1")
+	require.Error(t, err)
+	require.Contains(t, strings.Join(stderr, "\n"), "max parallel file reads must not be negative, got -1")
+
+	_, stderr, err = e.Run(t, true, "policy", "validate", "--global", "--max-parallel-snapshots=0")
+	require.Error(t, err)
+	require.Contains(t, strings.Join(stderr, "\n"), "max parallel snapshots must be at least 1, got 0")
+
+	_, stderr, err = e.Run(t, true, "policy", "validate", td, "--max-parallel-snapshots=2")
+	require.Error(t, err)
+	require.Contains(t, strings.Join(stderr, "\n"), "max parallel snapshots cannot be specified for paths")
+
+	// validation does not apply any changes.
+	lines = compressSpaces(e.RunAndExpectSuccess(t, "policy", "show", "--global"))
+	require.Contains(t, lines, " Max parallel snapshots (server/UI): 1 (defined for this target)")
+	require.Contains(t, lines, " Max parallel file reads: - (defined for this target)")
+
+	// invalid values are rejected by 'policy set' as well.
+	e.RunAndExpectFailure(t, "policy", "set", "--global", "--max-parallel-file-reads=-1")
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+type commandPolicyValidate struct {
+	commandPolicySet
+
+	out textOutput
+}
+
+func (c *commandPolicyValidate) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("validate", "Validate changes to snapshot policy without applying them.")
+	c.setupFlags(cmd)
+	c.out.setup(svc)
+
+	cmd.Action(svc.repositoryReaderAction(c.run))
+}
+
+func (c *commandPolicyValidate) run(ctx context.Context, rep repo.Repository) error {
+	targets, err := c.policyTargets(ctx, rep)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		p, err := policy.GetDefinedPolicy(ctx, rep, target)
+
+		switch {
+		case errors.Is(err, policy.ErrPolicyNotFound):
+			p = &policy.Policy{}
+		case err != nil:
+			return errors.Wrap(err, "could not get defined policy")
+		}
+
+		log(ctx).Infof("Validating policy for %v", target)
+
+		changeCount := 0
+		if err := c.setPolicyFromFlags(ctx, p, &changeCount); err != nil {
+			return err
+		}
+
+		if err := policy.ValidatePolicy(target, p); err != nil {
+			return errors.Wrapf(err, "invalid policy for %v", target)
+		}
+
+		c.out.printStdout("Policy for %v is valid.\n", target)
+	}
+
+	return nil
+}
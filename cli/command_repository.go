@@ -1,6 +1,7 @@
 package cli
 
 type commandRepository struct {
+	compare          commandRepositoryCompare
 	connect          commandRepositoryConnect
 	create           commandRepositoryCreate
 	disconnect       commandRepositoryDisconnect
@@ -18,6 +19,7 @@ type commandRepository struct {
 func (c *commandRepository) setup(svc advancedAppServices, parent commandParent) {
 	cmd := parent.Command("repository", "Commands to manipulate repository.").Alias("repo")
 
+	c.compare.setup(svc, cmd)
 	c.connect.setup(svc, cmd)
 	c.create.setup(svc, cmd)
 	c.disconnect.setup(svc, cmd)
@@ -9,13 +9,15 @@
 )
 
 type commandRepositoryChangePassword struct {
-	newPassword string
+	currentPassword string
+	newPassword     string
 
 	svc advancedAppServices
 }
 
 func (c *commandRepositoryChangePassword) setup(svc advancedAppServices, parent commandParent) {
 	cmd := parent.Command("change-password", "Change repository password")
+	cmd.Flag("current-password", "Current password, verified before changing it if provided").Envar(svc.EnvName("KOPIA_CURRENT_PASSWORD")).StringVar(&c.currentPassword)
 	cmd.Flag("new-password", "New password").Envar(svc.EnvName("KOPIA_NEW_PASSWORD")).StringVar(&c.newPassword)
 
 	c.svc = svc
@@ -23,6 +25,13 @@ func (c *commandRepositoryChangePassword) setup(svc advancedAppServices, parent
 }
 
 func (c *commandRepositoryChangePassword) run(ctx context.Context, rep repo.DirectRepositoryWriter) error {
+	// the repository may have been opened using persisted password, scripts can make sure the user knows it.
+	if c.currentPassword != "" {
+		if err := rep.FormatManager().VerifyPassword(c.currentPassword); err != nil {
+			return errors.Wrap(err, "unable to verify current password")
+		}
+	}
+
 	var newPass string
 
 	if c.newPassword == "" {
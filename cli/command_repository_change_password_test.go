@@ -28,6 +28,10 @@ func (s *formatSpecificTestSuite) TestRepositoryChangePassword(t *testing.T) {
 	env2.RunAndExpectSuccess(t, "repo", "connect", "filesystem", "--path", env1.RepoDir, "--disable-repository-format-cache")
 	env2.RunAndExpectSuccess(t, "snapshot", "ls")
 
+	// current password is verified when provided.
+	env1.RunAndExpectFailure(t, "repo", "change-password", "--current-password", "wrongPass", "--new-password", "newPass")
+	env2.RunAndExpectSuccess(t, "snapshot", "ls")
+
 	env1.RunAndExpectSuccess(t, "repo", "change-password", "--new-password", "newPass")
 
 	// at this point env2 stops working
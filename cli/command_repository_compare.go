@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+)
+
+type commandRepositoryCompare struct {
+	otherConfig   string
+	verifyPercent float64
+	maxListed     int
+
+	svc advancedAppServices
+	out textOutput
+	jo  jsonOutput
+}
+
+func (c *commandRepositoryCompare) setup(svc advancedAppServices, parent commandParent) {
+	cmd := parent.Command("compare", "Compare contents of this repository with another repository")
+	cmd.Flag("other-config", "Configuration file for the other repository").Required().ExistingFileVar(&c.otherConfig)
+	cmd.Flag("verify-percent", "Percentage of common contents to read and compare byte-for-byte").Default("0").Float64Var(&c.verifyPercent)
+	cmd.Flag("max-listed", "Maximum number of differing content IDs to list").Default("100").IntVar(&c.maxListed)
+	cmd.Action(svc.directRepositoryReadAction(c.run))
+
+	c.svc = svc
+	c.out.setup(svc)
+	c.jo.setup(svc, cmd)
+}
+
+func (c *commandRepositoryCompare) run(ctx context.Context, rep repo.DirectRepository) error {
+	other, err := c.openOtherRepo(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer other.Close(ctx) //nolint:errcheck
+
+	otherDirect, ok := other.(repo.DirectRepository)
+	if !ok {
+		return errors.Errorf("other repository must be directly connected to storage")
+	}
+
+	report, err := repo.CompareContents(ctx, rep, otherDirect, repo.CompareOptions{VerifyPercent: c.verifyPercent})
+	if err != nil {
+		return errors.Wrap(err, "error comparing repositories")
+	}
+
+	if c.jo.jsonOutput {
+		c.out.printStdout("%s\n", c.jo.jsonBytes(report))
+	} else {
+		c.out.printStdout("Contents in this repository:  %v\n", report.SourceContentCount)
+		c.out.printStdout("Contents in other repository: %v\n", report.OtherContentCount)
+		c.out.printStdout("Verified contents:            %v\n", report.VerifiedCount)
+
+		c.printIDs("Only in this repository", report.OnlyInSource)
+		c.printIDs("Only in other repository", report.OnlyInOther)
+		c.printIDs("Mismatched", report.Mismatched)
+	}
+
+	if !report.Equivalent() {
+		return errors.Errorf("repositories are not equivalent")
+	}
+
+	return nil
+}
+
+func (c *commandRepositoryCompare) printIDs(title string, ids []content.ID) {
+	if len(ids) == 0 {
+		return
+	}
+
+	c.out.printStdout("%v: %v\n", title, len(ids))
+
+	for i, cid := range ids {
+		if i >= c.maxListed {
+			c.out.printStdout("  ... and %v more\n", len(ids)-i)
+			break
+		}
+
+		c.out.printStdout("  %v\n", cid)
+	}
+}
+
+func (c *commandRepositoryCompare) openOtherRepo(ctx context.Context) (repo.Repository, error) {
+	pass, err := c.svc.passwordPersistenceStrategy().GetPassword(ctx, c.otherConfig)
+	if err != nil {
+		pass, err = c.svc.getPasswordFromFlags(ctx, false, false)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "other repository password")
+	}
+
+	other, err := repo.Open(ctx, c.otherConfig, pass, c.svc.optionsFromFlags(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't open other repository")
+	}
+
+	return other, nil
+}
@@ -0,0 +1,35 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositoryCompare(t *testing.T) {
+	t.Parallel()
+
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+	other := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+	otherConfig := filepath.Join(other.ConfigDir, ".kopia.config")
+
+	dir := testutil.TempDirectory(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file1.txt"), []byte("some data"), 0o600))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+	env.RunAndExpectSuccess(t, "snapshot", "create", dir)
+
+	// the other connection points at the same storage, so both are equivalent.
+	other.RunAndExpectSuccess(t, "repo", "connect", "filesystem", "--path", env.RepoDir)
+	env.RunAndExpectSuccess(t, "repo", "compare", "--other-config", otherConfig, "--verify-percent=100")
+
+	// a separate repository with different contents is not equivalent.
+	other.RunAndExpectSuccess(t, "repo", "disconnect")
+	other.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", other.RepoDir)
+	env.RunAndExpectFailure(t, "repo", "compare", "--other-config", otherConfig)
+}
@@ -5,8 +5,10 @@
 	"time"
 
 	"github.com/alecthomas/kingpin"
+	atunits "github.com/alecthomas/units"
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/ecc"
@@ -28,7 +30,16 @@ type commandRepositoryCreate struct {
 	createBlockEncryptionFormat   string
 	createBlockECCFormat          string
 	createBlockECCOverheadPercent int
+	createContentMAC              bool
+	createHashSalt                string
+	createEnvelopeEncryption      bool
 	createSplitter                string
+	createSplitterMinSize         atunits.Base2Bytes
+	createSplitterAvgSize         atunits.Base2Bytes
+	createSplitterMaxSize         atunits.Base2Bytes
+	createMaxObjectSizeMB         int64
+	createMaxIndirectFanout       int
+	createInlineContentThreshold  int
 	createOnly                    bool
 	createFormatVersion           int
 	retentionMode                 string
@@ -46,7 +57,16 @@ func (c *commandRepositoryCreate) setup(svc advancedAppServices, parent commandP
 	cmd.Flag("encryption", "Content encryption algorithm.").PlaceHolder("ALGO").Default(encryption.DefaultAlgorithm).EnumVar(&c.createBlockEncryptionFormat, encryption.SupportedAlgorithms(false)...)
 	cmd.Flag("ecc", "[EXPERIMENTAL] Error correction algorithm.").PlaceHolder("ALGO").Default(ecc.DefaultAlgorithm).EnumVar(&c.createBlockECCFormat, ecc.SupportedAlgorithms()...)
 	cmd.Flag("ecc-overhead-percent", "[EXPERIMENTAL] How much space overhead can be used for error correction, in percentage. Use 0 to disable ECC.").Default("0").IntVar(&c.createBlockECCOverheadPercent)
+	cmd.Flag("content-mac", "[EXPERIMENTAL] Attach keyed MAC to each stored content, verified on read.").BoolVar(&c.createContentMAC)
+	cmd.Flag("hash-salt", "[EXPERIMENTAL] Repository-specific salt mixed into content hashes, so that identical contents get different IDs in other repositories.").StringVar(&c.createHashSalt)
+	cmd.Flag("envelope-encryption", "[EXPERIMENTAL] Encrypt each content with a random data key wrapped by the master key.").BoolVar(&c.createEnvelopeEncryption)
 	cmd.Flag("object-splitter", "The splitter to use for new objects in the repository").Default(splitter.DefaultAlgorithm).EnumVar(&c.createSplitter, splitter.SupportedAlgorithms()...)
+	cmd.Flag("splitter-min-size", "Minimum chunk size of the content-defined splitter, defaults to half of the average.").BytesVar(&c.createSplitterMinSize)
+	cmd.Flag("splitter-avg-size", "Average (target) chunk size of the content-defined splitter, must be a power of two.").BytesVar(&c.createSplitterAvgSize)
+	cmd.Flag("splitter-max-size", "Maximum chunk size of the content-defined splitter, defaults to twice the average.").BytesVar(&c.createSplitterMaxSize)
+	cmd.Flag("max-object-size-mb", "Maximum size of objects written to the repository in MB, 0 means unlimited.").Int64Var(&c.createMaxObjectSizeMB)
+	cmd.Flag("max-indirect-fanout", "Maximum number of entries in a single index object of large objects, 0 means unlimited.").Hidden().IntVar(&c.createMaxIndirectFanout)
+	cmd.Flag("inline-content-threshold", "Store objects shorter than the given number of bytes directly in their IDs, 0 disables inlining.").IntVar(&c.createInlineContentThreshold)
 	cmd.Flag("create-only", "Create repository, but don't connect to it.").Short('c').BoolVar(&c.createOnly)
 	cmd.Flag("format-version", "Force a particular repository format version (1 or 2, 0==default)").IntVar(&c.createFormatVersion)
 	cmd.Flag("retention-mode", "Set the blob retention-mode for supported storage backends.").EnumVar(&c.retentionMode, blob.Governance.String(), blob.Compliance.String())
@@ -89,10 +109,19 @@ func (c *commandRepositoryCreate) newRepositoryOptionsFromFlags() *repo.NewRepos
 			Encryption:         c.createBlockEncryptionFormat,
 			ECC:                c.createBlockECCFormat,
 			ECCOverheadPercent: c.createBlockECCOverheadPercent,
+			ContentMAC:         c.createContentMAC,
+			HashSalt:           []byte(c.createHashSalt),
+			EnvelopeEncryption: c.createEnvelopeEncryption,
 		},
 
 		ObjectFormat: format.ObjectFormat{
-			Splitter: c.createSplitter,
+			Splitter:      c.createSplitter,
+			MaxObjectSize: c.createMaxObjectSizeMB << 20, //nolint:gomnd
+
+			SplitterParameters: c.splitterParametersFromFlags(),
+
+			MaxIndirectFanout:      c.createMaxIndirectFanout,
+			InlineContentThreshold: c.createInlineContentThreshold,
 		},
 
 		RetentionMode:   blob.RetentionMode(c.retentionMode),
@@ -100,6 +129,21 @@ func (c *commandRepositoryCreate) newRepositoryOptionsFromFlags() *repo.NewRepos
 	}
 }
 
+// splitterParametersFromFlags returns splitter parameters or nil if none of the chunk sizes was specified.
+func (c *commandRepositoryCreate) splitterParametersFromFlags() *splitter.Parameters {
+	if c.createSplitterMinSize == 0 && c.createSplitterAvgSize == 0 && c.createSplitterMaxSize == 0 {
+		return nil
+	}
+
+	p := splitter.Parameters{
+		MinSize: int(c.createSplitterMinSize),
+		AvgSize: int(c.createSplitterAvgSize),
+		MaxSize: int(c.createSplitterMaxSize),
+	}.WithDefaults()
+
+	return &p
+}
+
 func (c *commandRepositoryCreate) ensureEmpty(ctx context.Context, s blob.Storage) error {
 	hasDataError := errors.Errorf("has data")
 
@@ -134,14 +178,43 @@ func (c *commandRepositoryCreate) runCreateCommandWithStorage(ctx context.Contex
 	}
 
 	log(ctx).Infof("  block hash:          %v", options.BlockFormat.Hash)
-	log(ctx).Infof("  encryption:          %v", options.BlockFormat.Encryption)
+	if options.BlockFormat.EnvelopeEncryption {
+		log(ctx).Infof("  encryption:          envelope")
+	} else {
+		log(ctx).Infof("  encryption:          %v", options.BlockFormat.Encryption)
+	}
 
 	if options.BlockFormat.ECC != "" && options.BlockFormat.ECCOverheadPercent > 0 {
 		log(ctx).Infof("  ecc:                 %v with %v%% overhead", options.BlockFormat.ECC, options.BlockFormat.ECCOverheadPercent)
 	}
 
+	if options.BlockFormat.ContentMAC {
+		log(ctx).Infof("  content MAC:         enabled")
+	}
+
+	if len(options.BlockFormat.HashSalt) > 0 {
+		log(ctx).Infof("  hash salt:           enabled")
+	}
+
 	log(ctx).Infof("  splitter:            %v", options.ObjectFormat.Splitter)
 
+	if p := options.ObjectFormat.SplitterParameters; p != nil {
+		log(ctx).Infof("  splitter chunks:     min %v avg %v max %v",
+			units.BytesStringBase2(int64(p.MinSize)), units.BytesStringBase2(int64(p.AvgSize)), units.BytesStringBase2(int64(p.MaxSize)))
+	}
+
+	if options.ObjectFormat.MaxObjectSize > 0 {
+		log(ctx).Infof("  max object size:     %v", units.BytesStringBase2(options.ObjectFormat.MaxObjectSize))
+	}
+
+	if options.ObjectFormat.MaxIndirectFanout > 0 {
+		log(ctx).Infof("  max indirect fanout: %v", options.ObjectFormat.MaxIndirectFanout)
+	}
+
+	if options.ObjectFormat.InlineContentThreshold > 0 {
+		log(ctx).Infof("  inline threshold:    %v", options.ObjectFormat.InlineContentThreshold)
+	}
+
 	if err := repo.Initialize(ctx, st, options, pass); err != nil {
 		return errors.Wrap(err, "cannot initialize repository")
 	}
@@ -0,0 +1,37 @@
+package cli_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/cli"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/splitter"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRepositoryCreateSplitterParameters(t *testing.T) {
+	t.Parallel()
+
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	// chunk sizes must be ordered and the average must be specified.
+	e.RunAndExpectFailure(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--splitter-min-size=64KB", "--splitter-avg-size=32KB", "--splitter-max-size=128KB")
+	e.RunAndExpectFailure(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--splitter-avg-size=64KB", "--splitter-max-size=32KB")
+	e.RunAndExpectFailure(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--splitter-max-size=64KB")
+	e.RunAndExpectFailure(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--splitter-avg-size=48KB")
+	e.RunAndExpectFailure(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--object-splitter=FIXED-1M", "--splitter-avg-size=64KB")
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--object-splitter=DYNAMIC-1M-RABINKARP", "--splitter-min-size=40KB", "--splitter-avg-size=64KB")
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+
+	var rs cli.RepositoryStatus
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "repo", "status", "--json"), &rs)
+
+	require.Equal(t, "DYNAMIC-1M-RABINKARP", rs.ObjectFormat.Splitter)
+	require.Equal(t, &splitter.Parameters{MinSize: 40 << 10, AvgSize: 64 << 10, MaxSize: 128 << 10}, rs.ObjectFormat.SplitterParameters)
+
+	require.Contains(t, e.RunAndExpectSuccess(t, "repo", "status"), "Splitter chunks:     min 40 KiB avg 64 KiB max 128 KiB")
+}
@@ -16,6 +16,8 @@ type commandRepositoryRepair struct {
 	repairCommandRecoverFormatBlob         string
 	repairCommandRecoverFormatBlobPrefixes []string
 	repairDryRun                           bool
+
+	svc advancedAppServices
 }
 
 func (c *commandRepositoryRepair) setup(svc advancedAppServices, parent commandParent) {
@@ -25,6 +27,8 @@ func (c *commandRepositoryRepair) setup(svc advancedAppServices, parent commandP
 	cmd.Flag("recover-format-block-prefixes", "Prefixes of file names").StringsVar(&c.repairCommandRecoverFormatBlobPrefixes)
 	cmd.Flag("dry-run", "Do not modify repository").Short('n').BoolVar(&c.repairDryRun)
 
+	c.svc = svc
+
 	for _, prov := range svc.storageProviders() {
 		f := prov.NewFlags()
 		cc := cmd.Command(prov.Name, "Repair repository in "+prov.Description)
@@ -62,7 +66,20 @@ func (c *commandRepositoryRepair) runRepairCommandWithStorage(ctx context.Contex
 		defer tmp.Close()
 
 		if err := st.GetBlob(ctx, format.KopiaRepositoryBlobID, 0, -1, &tmp); err == nil {
-			log(ctx).Infof("format blob already exists, not recovering, pass --recover-format=yes")
+			pass, err := c.svc.getPasswordFromFlags(ctx, false, false)
+			if err != nil {
+				return errors.Wrap(err, "unable to get password to verify format blob")
+			}
+
+			if verr := format.VerifyKopiaRepositoryBlob(tmp.ToByteSlice(), pass); !errors.Is(verr, format.ErrFormatBlobIntegrity) {
+				log(ctx).Infof("format blob already exists, not recovering, pass --recover-format=yes")
+				return nil
+			}
+
+			log(ctx).Infof("format blob is corrupted")
+		}
+
+		if c.restoreFormatBlobFromSecondary(ctx, st) {
 			return nil
 		}
 
@@ -78,6 +95,43 @@ func (c *commandRepositoryRepair) runRepairCommandWithStorage(ctx context.Contex
 	return c.recoverFormatBlob(ctx, st, prefixes)
 }
 
+// restoreFormatBlobFromSecondary attempts to restore the format blob from its secondary copy and returns true on success.
+func (c *commandRepositoryRepair) restoreFormatBlobFromSecondary(ctx context.Context, st blob.Storage) bool {
+	log(ctx).Infof("looking for secondary copy of format blob...")
+
+	pass, err := c.svc.getPasswordFromFlags(ctx, false, false)
+	if err != nil {
+		log(ctx).Infof("unable to get password to verify secondary copy: %v", err)
+		return false
+	}
+
+	if c.repairDryRun {
+		var tmp gather.WriteBuffer
+		defer tmp.Close()
+
+		if err := st.GetBlob(ctx, format.KopiaRepositorySecondaryBlobID, 0, -1, &tmp); err != nil {
+			return false
+		}
+
+		if err := format.VerifyKopiaRepositoryBlob(tmp.ToByteSlice(), pass); err != nil {
+			return false
+		}
+
+		log(ctx).Infof("format blob can be restored from %v", format.KopiaRepositorySecondaryBlobID)
+
+		return true
+	}
+
+	if err := format.RestoreKopiaRepositoryBlobFromSecondary(ctx, st, pass); err != nil {
+		log(ctx).Infof("unable to restore from secondary copy: %v", err)
+		return false
+	}
+
+	log(ctx).Infof("restored format blob from %v", format.KopiaRepositorySecondaryBlobID)
+
+	return true
+}
+
 func (c *commandRepositoryRepair) recoverFormatBlob(ctx context.Context, st blob.Storage, prefixes []string) error {
 	errSuccess := errors.New("success")
 
@@ -16,10 +16,11 @@
 )
 
 type commandRepositorySetParameters struct {
-	maxPackSizeMB      int
-	indexFormatVersion int
-	retentionMode      string
-	retentionPeriod    time.Duration
+	maxPackSizeMB       int
+	indexFormatVersion  int
+	maxIndexBlockSizeMB int
+	retentionMode       string
+	retentionPeriod     time.Duration
 
 	epochRefreshFrequency    time.Duration
 	epochMinDuration         time.Duration
@@ -43,6 +44,7 @@ func (c *commandRepositorySetParameters) setup(svc appServices, parent commandPa
 
 	cmd.Flag("max-pack-size-mb", "Set max pack file size").PlaceHolder("MB").IntVar(&c.maxPackSizeMB)
 	cmd.Flag("index-version", "Set version of index format used for writing").IntVar(&c.indexFormatVersion)
+	cmd.Flag("max-index-block-size-mb", "Set target size of index blobs written").PlaceHolder("MB").IntVar(&c.maxIndexBlockSizeMB)
 	cmd.Flag("retention-mode", "Set the blob retention-mode for supported storage backends.").EnumVar(&c.retentionMode, "none", blob.Governance.String(), blob.Compliance.String())
 	cmd.Flag("retention-period", "Set the blob retention-period for supported storage backends.").DurationVar(&c.retentionPeriod)
 
@@ -158,6 +160,7 @@ func (c *commandRepositorySetParameters) run(ctx context.Context, rep repo.Direc
 
 	c.setSizeMBParameter(ctx, c.maxPackSizeMB, "maximum pack size", &mp.MaxPackSize, &anyChange)
 	c.setIntParameter(ctx, c.indexFormatVersion, "index format version", &mp.IndexVersion, &anyChange)
+	c.setSizeMBParameter(ctx, c.maxIndexBlockSizeMB, "maximum index block size", &mp.MaxIndexBlockSize, &anyChange)
 
 	if c.retentionMode == "none" {
 		if blobcfg.IsRetentionEnabled() {
@@ -183,6 +183,12 @@ func (c *commandRepositoryStatus) run(ctx context.Context, rep repo.Repository)
 	c.out.printStdout("Hash:                %v\n", contentFormat.GetHashFunction())
 	c.out.printStdout("Encryption:          %v\n", contentFormat.GetEncryptionAlgorithm())
 	c.out.printStdout("Splitter:            %v\n", dr.ObjectFormat().Splitter)
+
+	if p := dr.ObjectFormat().SplitterParameters; p != nil {
+		c.out.printStdout("Splitter chunks:     min %v avg %v max %v\n",
+			units.BytesStringBase2(int64(p.MinSize)), units.BytesStringBase2(int64(p.AvgSize)), units.BytesStringBase2(int64(p.MaxSize)))
+	}
+
 	c.out.printStdout("Format version:      %v\n", mp.Version)
 	c.out.printStdout("Content compression: %v\n", mp.IndexVersion >= index.Version2)
 	c.out.printStdout("Password changes:    %v\n", contentFormat.SupportsPasswordChange())
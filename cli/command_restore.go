@@ -117,6 +117,7 @@ type commandRestore struct {
 	restoreSkipTimes              bool
 	restoreSkipOwners             bool
 	restoreSkipPermissions        bool
+	restoreSkipXattrs             bool
 	restoreIncremental            bool
 	restoreIgnoreErrors           bool
 	restoreShallowAtDepth         int32
@@ -141,6 +142,7 @@ func (c *commandRestore) setup(svc appServices, parent commandParent) {
 	cmd.Flag("skip-owners", "Skip owners during restore").BoolVar(&c.restoreSkipOwners)
 	cmd.Flag("skip-permissions", "Skip permissions during restore").BoolVar(&c.restoreSkipPermissions)
 	cmd.Flag("skip-times", "Skip times during restore").BoolVar(&c.restoreSkipTimes)
+	cmd.Flag("skip-xattrs", "Skip extended attributes and ACLs during restore").BoolVar(&c.restoreSkipXattrs)
 	cmd.Flag("ignore-permission-errors", "Ignore permission errors").Default("true").BoolVar(&c.restoreIgnorePermissionErrors)
 	cmd.Flag("write-files-atomically", "Write files atomically to disk, ensuring they are either fully committed, or not written at all, preventing partially written files").Default("false").BoolVar(&c.restoreWriteFilesAtomically)
 	cmd.Flag("ignore-errors", "Ignore all errors").BoolVar(&c.restoreIgnoreErrors)
@@ -258,6 +260,7 @@ func (c *commandRestore) restoreOutput(ctx context.Context, rep repo.Repository)
 			SkipOwners:             c.restoreSkipOwners,
 			SkipPermissions:        c.restoreSkipPermissions,
 			SkipTimes:              c.restoreSkipTimes,
+			SkipExtendedAttributes: c.restoreSkipXattrs,
 			WriteSparseFiles:       c.restoreWriteSparseFiles,
 		}
 
@@ -479,7 +482,7 @@ func (c *commandRestore) tryToConvertPathToID(ctx context.Context, rep repo.Repo
 		return "", errors.Errorf("the source must contain a path element")
 	}
 
-	manifestIDs, err := findSnapshotsForSource(ctx, rep, si, map[string]string{})
+	manifestIDs, err := findSnapshotsForSource(ctx, rep, si, snapshot.ListFilter{})
 	if err != nil {
 		return "", err
 	}
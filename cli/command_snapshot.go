@@ -1,34 +1,44 @@
 package cli
 
 type commandSnapshot struct {
+	checkpoints commandSnapshotCheckpoints
 	copyHistory commandSnapshotCopyMoveHistory
 	moveHistory commandSnapshotCopyMoveHistory
 	create      commandSnapshotCreate
 	delete      commandSnapshotDelete
+	duplicates  commandSnapshotDuplicates
 	estimate    commandSnapshotEstimate
 	expire      commandSnapshotExpire
+	export      commandSnapshotExport
 	fix         commandSnapshotFix
 	gc          commandSnapshotGC
+	info        commandSnapshotInfo
 	list        commandSnapshotList
 	migrate     commandSnapshotMigrate
 	pin         commandSnapshotPin
 	restore     commandSnapshotRestore
+	usage       commandSnapshotUsage
 	verify      commandSnapshotVerify
 }
 
 func (c *commandSnapshot) setup(svc advancedAppServices, parent commandParent) {
 	cmd := parent.Command("snapshot", "Commands to manipulate snapshots.").Alias("snap")
+	c.checkpoints.setup(svc, cmd)
 	c.copyHistory.setup(svc, cmd, false)
 	c.moveHistory.setup(svc, cmd, true)
 	c.create.setup(svc, cmd)
 	c.delete.setup(svc, cmd)
+	c.duplicates.setup(svc, cmd)
 	c.estimate.setup(svc, cmd)
 	c.expire.setup(svc, cmd)
+	c.export.setup(svc, cmd)
 	c.fix.setup(svc, cmd)
 	c.gc.setup(svc, cmd)
+	c.info.setup(svc, cmd)
 	c.list.setup(svc, cmd)
 	c.migrate.setup(svc, cmd)
 	c.pin.setup(svc, cmd)
 	c.restore.setup(svc, cmd)
+	c.usage.setup(svc, cmd)
 	c.verify.setup(svc, cmd)
 }
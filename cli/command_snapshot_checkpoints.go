@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+type commandSnapshotCheckpoints struct {
+	list  commandSnapshotCheckpointsList
+	prune commandSnapshotCheckpointsPrune
+}
+
+func (c *commandSnapshotCheckpoints) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("checkpoints", "Commands to manage checkpoints of interrupted uploads")
+
+	c.list.setup(svc, cmd)
+	c.prune.setup(svc, cmd)
+}
+
+// checkpointSource returns the source specified by the given path or nil if the path is empty.
+func checkpointSource(rep repo.Repository, path string) (*snapshot.SourceInfo, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	src, err := snapshot.ParseSourceInfo(path, rep.ClientOptions().Hostname, rep.ClientOptions().Username)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to parse %q", path)
+	}
+
+	return &src, nil
+}
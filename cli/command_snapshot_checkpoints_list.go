@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+type commandSnapshotCheckpointsList struct {
+	source string
+
+	out textOutput
+}
+
+func (c *commandSnapshotCheckpointsList) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("list", "List checkpoints of interrupted uploads").Alias("ls")
+	cmd.Arg("source", "List checkpoints for given source only").StringVar(&c.source)
+	cmd.Action(svc.repositoryReaderAction(c.run))
+	c.out.setup(svc)
+}
+
+func (c *commandSnapshotCheckpointsList) run(ctx context.Context, rep repo.Repository) error {
+	src, err := checkpointSource(rep, c.source)
+	if err != nil {
+		return err
+	}
+
+	checkpoints, err := snapshot.ListCheckpoints(ctx, rep, src)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	now := clock.Now()
+
+	for _, m := range checkpoints {
+		started := m.StartTime.ToTime()
+
+		c.out.printStdout("%v %v %v (%v ago) %v\n", m.ID, m.Source, formatTimestamp(started), now.Sub(started).Truncate(time.Second), m.IncompleteReason)
+	}
+
+	return nil
+}
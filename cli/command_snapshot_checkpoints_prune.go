@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+)
+
+type commandSnapshotCheckpointsPrune struct {
+	source    string
+	olderThan time.Duration
+}
+
+func (c *commandSnapshotCheckpointsPrune) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("prune", "Remove stale checkpoints of interrupted uploads")
+	cmd.Arg("source", "Prune checkpoints for given source only").StringVar(&c.source)
+	cmd.Flag("older-than", "Remove checkpoints started before given age").Required().DurationVar(&c.olderThan)
+	cmd.Action(svc.repositoryWriterAction(c.run))
+}
+
+func (c *commandSnapshotCheckpointsPrune) run(ctx context.Context, rep repo.RepositoryWriter) error {
+	if c.olderThan <= 0 {
+		return errors.Errorf("--older-than must be positive")
+	}
+
+	src, err := checkpointSource(rep, c.source)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := snapshot.PruneCheckpoints(ctx, rep, src, clock.Now().Add(-c.olderThan))
+
+	for _, m := range deleted {
+		log(ctx).Infof("Deleted checkpoint %v of %v started at %v", m.ID, m.Source, formatTimestamp(m.StartTime.ToTime()))
+	}
+
+	return errors.Wrap(err, "error pruning checkpoints")
+}
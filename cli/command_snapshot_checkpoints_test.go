@@ -0,0 +1,34 @@
+package cli_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestSnapshotCheckpoints(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	srcdir := testutil.TempDirectory(t)
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", srcdir)
+
+	// complete snapshots are not checkpoints.
+	require.Empty(t, e.RunAndExpectSuccess(t, "snapshot", "checkpoints", "list"))
+	require.Empty(t, e.RunAndExpectSuccess(t, "snapshot", "checkpoints", "list", srcdir))
+
+	e.RunAndExpectFailure(t, "snapshot", "checkpoints", "prune")
+	e.RunAndExpectFailure(t, "snapshot", "checkpoints", "prune", "--older-than=0s")
+	e.RunAndExpectSuccess(t, "snapshot", "checkpoints", "prune", "--older-than=24h", srcdir)
+
+	require.Len(t, e.RunAndExpectSuccess(t, "snapshot", "list", srcdir), 2)
+}
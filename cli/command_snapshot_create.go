@@ -11,6 +11,7 @@
 
 	"github.com/kopia/kopia/fs"
 	"github.com/kopia/kopia/fs/virtualfs"
+	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/snapshot"
 	"github.com/kopia/kopia/snapshot/policy"
@@ -35,9 +36,11 @@ type commandSnapshotCreate struct {
 	snapshotCreateForceEnableActions      bool
 	snapshotCreateForceDisableActions     bool
 	snapshotCreateStdinFileName           string
+	snapshotCreateStdinName               string
 	snapshotCreateCheckpointUploadLimitMB int64
 	snapshotCreateTags                    []string
 	flushPerSource                        bool
+	computeSummary                        bool
 
 	pins []string
 
@@ -65,8 +68,10 @@ func (c *commandSnapshotCreate) setup(svc appServices, parent commandParent) {
 	cmd.Flag("force-enable-actions", "Enable snapshot actions even if globally disabled on this client").Hidden().BoolVar(&c.snapshotCreateForceEnableActions)
 	cmd.Flag("force-disable-actions", "Disable snapshot actions even if globally enabled on this client").Hidden().BoolVar(&c.snapshotCreateForceDisableActions)
 	cmd.Flag("stdin-file", "File path to be used for stdin data snapshot.").StringVar(&c.snapshotCreateStdinFileName)
+	cmd.Flag("stdin", "Snapshot data read from stdin as a single object stored under the given source name.").PlaceHolder("NAME").StringVar(&c.snapshotCreateStdinName)
 	cmd.Flag("tags", "Tags applied on the snapshot. Must be provided in the <key>:<value> format.").StringsVar(&c.snapshotCreateTags)
 	cmd.Flag("pin", "Create a pinned snapshot that's will not expire automatically").StringsVar(&c.pins)
+	cmd.Flag("summary", "Compute summary statistics and store them in the snapshot manifest (requires walking the snapshot after upload)").BoolVar(&c.computeSummary)
 	cmd.Flag("flush-per-source", "Flush writes at the end of each source").Hidden().BoolVar(&c.flushPerSource)
 
 	c.logDirDetail = -1
@@ -99,7 +104,11 @@ func (c *commandSnapshotCreate) run(ctx context.Context, rep repo.RepositoryWrit
 		sources = append(sources, local...)
 	}
 
-	if len(sources) == 0 {
+	if c.snapshotCreateStdinName != "" {
+		if len(sources) > 0 || c.snapshotCreateStdinFileName != "" {
+			return errors.New("--stdin cannot be combined with other snapshot sources or --stdin-file")
+		}
+	} else if len(sources) == 0 {
 		return errors.New("no snapshot sources")
 	}
 
@@ -120,6 +129,18 @@ func (c *commandSnapshotCreate) run(ctx context.Context, rep repo.RepositoryWrit
 		return err
 	}
 
+	if c.snapshotCreateStdinName != "" {
+		sourceInfo := snapshot.SourceInfo{
+			Path:     c.snapshotCreateStdinName,
+			Host:     rep.ClientOptions().Hostname,
+			UserName: rep.ClientOptions().Username,
+		}
+
+		if err := c.snapshotSingleSource(ctx, rep, u, sourceInfo, tags); err != nil {
+			finalErrors = append(finalErrors, err.Error())
+		}
+	}
+
 	for _, snapshotDir := range sources {
 		if u.IsCanceled() {
 			log(ctx).Infof("Upload canceled")
@@ -239,6 +260,7 @@ func (c *commandSnapshotCreate) setupUploader(rep repo.RepositoryWriter) *snapsh
 	u.ParallelUploads = c.snapshotCreateParallelUploads
 
 	u.FailFast = c.snapshotCreateFailFast
+	u.ComputeSummary = c.computeSummary
 	u.Progress = c.svc.getProgress()
 
 	return u
@@ -269,14 +291,21 @@ func (c *commandSnapshotCreate) snapshotSingleSource(ctx context.Context, rep re
 		setManual bool
 	)
 
-	if c.snapshotCreateStdinFileName != "" {
+	switch {
+	case c.snapshotCreateStdinName != "":
+		// stdin data is stored as a single object, the snapshot root is the streaming file itself.
+		fsEntry = virtualfs.StreamingFileFromReader(c.snapshotCreateStdinName, c.svc.stdin())
+		setManual = true
+
+	case c.snapshotCreateStdinFileName != "":
 		// stdin source will be snapshotted using a virtual static root directory with a single streaming file entry
 		// Create a new static directory with the given name and add a streaming file entry with os.Stdin reader
 		fsEntry = virtualfs.NewStaticDirectory(sourceInfo.Path, []fs.Entry{
 			virtualfs.StreamingFileFromReader(c.snapshotCreateStdinFileName, c.svc.stdin()),
 		})
 		setManual = true
-	} else {
+
+	default:
 		fsEntry, err = getLocalFSEntry(ctx, sourceInfo.Path)
 		if err != nil {
 			return errors.Wrap(err, "unable to get local filesystem entry")
@@ -376,6 +405,14 @@ func (c *commandSnapshotCreate) reportSnapshotStatus(ctx context.Context, manife
 
 	log(ctx).Infof("Created%v snapshot with root %v and ID %v in %v", maybePartial, manifest.RootObjectID(), snapID, manifest.EndTime.Sub(manifest.StartTime).Truncate(time.Second))
 
+	if re := manifest.RootEntry; re != nil && re.Type != snapshot.EntryTypeDirectory {
+		log(ctx).Infof("Stored object %v with %v bytes.", re.ObjectID, re.FileSize)
+	}
+
+	if sum := manifest.Summary; sum != nil {
+		log(ctx).Infof("Snapshot has %v files and %v directories, logical size %v, stored size %v.", sum.FileCount, sum.DirCount, units.BytesStringBase10(sum.LogicalBytes), units.BytesStringBase10(sum.StoredBytes))
+	}
+
 	if ds := manifest.RootEntry.DirSummary; ds != nil {
 		if ds.IgnoredErrorCount > 0 {
 			log(ctx).Warnf("Ignored %v error(s) while snapshotting %v.", ds.IgnoredErrorCount, sourceInfo)
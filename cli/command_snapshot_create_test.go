@@ -0,0 +1,76 @@
+package cli_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestSnapshotCreateFromStdin(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	var lines []string
+
+	for i := 0; i < 10000; i++ {
+		lines = append(lines, fmt.Sprintf("INSERT INTO t VALUES (%v);", i))
+	}
+
+	content := []byte(strings.Join(lines, "\n"))
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	go func() {
+		w.Write(content) //nolint:errcheck
+		w.Close()
+	}()
+
+	runner.SetNextStdin(r)
+
+	var man snapshot.Manifest
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "snapshot", "create", "--stdin", "db", "--json"), &man)
+
+	require.Equal(t, "db", man.Source.Path)
+	require.Equal(t, snapshot.EntryTypeFile, man.RootEntry.Type)
+	require.Equal(t, int64(len(content)), man.RootEntry.FileSize)
+	require.Equal(t, lines, e.RunAndExpectSuccess(t, "show", man.RootObjectID().String()))
+
+	// the snapshot is visible under the given name and the source is marked as manual.
+	si := man.Source.String()
+	e.RunAndVerifyOutputLineCount(t, 2, "snapshot", "list", si)
+	e.RunAndExpectSuccess(t, "policy", "show", si)
+
+	// empty stdin produces a valid empty object.
+	runner.SetNextStdin(bytes.NewReader(nil))
+
+	var emptyMan snapshot.Manifest
+
+	testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, "snapshot", "create", "--stdin", "empty", "--json"), &emptyMan)
+
+	require.Equal(t, int64(0), emptyMan.RootEntry.FileSize)
+	require.Empty(t, e.RunAndExpectSuccess(t, "show", emptyMan.RootObjectID().String()))
+
+	// object ID and size are reported.
+	runner.SetNextStdin(bytes.NewReader([]byte("hello")))
+
+	_, stderr := e.RunAndExpectSuccessWithErrOut(t, "snapshot", "create", "--stdin", "db")
+	require.Contains(t, strings.Join(stderr, "\n"), "with 5 bytes.")
+
+	// --stdin cannot be combined with other sources.
+	e.RunAndExpectFailure(t, "snapshot", "create", "--stdin", "db", testutil.TempDirectory(t))
+}
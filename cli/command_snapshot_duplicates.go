@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+type commandSnapshotDuplicates struct {
+	snapshotID string
+
+	jo  jsonOutput
+	out textOutput
+}
+
+func (c *commandSnapshotDuplicates) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("duplicates", "Find files with identical contents within a snapshot.")
+	cmd.Arg("id", "Snapshot ID").Required().StringVar(&c.snapshotID)
+	cmd.Action(svc.repositoryReaderAction(c.run))
+
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+}
+
+func (c *commandSnapshotDuplicates) run(ctx context.Context, rep repo.Repository) error {
+	m, err := snapshot.LoadSnapshot(ctx, rep, manifest.ID(c.snapshotID))
+	if err != nil {
+		return errors.Wrapf(err, "error loading snapshot %v", c.snapshotID)
+	}
+
+	dups, err := snapshotfs.FindDuplicateFiles(ctx, rep, m)
+	if err != nil {
+		return errors.Wrapf(err, "error finding duplicate files in %v", c.snapshotID)
+	}
+
+	if c.jo.jsonOutput {
+		c.out.printStdout("%s\n", c.jo.jsonBytes(dups))
+		return nil
+	}
+
+	for _, g := range dups.Groups {
+		c.out.printStdout("%v copies of %v (%v wasted):\n", len(g.Paths), units.BytesStringBase10(g.Size), units.BytesStringBase10(g.WastedBytes()))
+
+		for _, p := range g.Paths {
+			c.out.printStdout("  %v\n", p)
+		}
+	}
+
+	c.out.printStdout("Found %v groups of duplicate files, %v wasted.\n", len(dups.Groups), units.BytesStringBase10(dups.TotalDuplicateBytes))
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/cli"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestSnapshotDuplicates(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	dir := testutil.TempDirectory(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "subdir"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file1.txt"), []byte("hello"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "subdir", "file1-copy.txt"), []byte("hello"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "subdir", "file2.txt"), []byte("hello world"), 0o600))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+	env.RunAndExpectSuccess(t, "snapshot", "create", dir)
+
+	var snapshots []*cli.SnapshotManifest
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "snapshot", "list", "--json"), &snapshots)
+	require.Len(t, snapshots, 1)
+
+	var dups snapshotfs.DuplicateFiles
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "snapshot", "duplicates", "--json", string(snapshots[0].ID)), &dups)
+	require.Len(t, dups.Groups, 1)
+	require.Equal(t, []string{"file1.txt", "subdir/file1-copy.txt"}, dups.Groups[0].Paths)
+	require.EqualValues(t, 5, dups.TotalDuplicateBytes)
+
+	lines := env.RunAndExpectSuccess(t, "snapshot", "duplicates", string(snapshots[0].ID))
+	require.Contains(t, lines, "Found 1 groups of duplicate files, 5 B wasted.")
+
+	env.RunAndExpectFailure(t, "snapshot", "duplicates", "no-such-snapshot")
+}
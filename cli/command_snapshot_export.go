@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot/restore"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+type commandSnapshotExport struct {
+	source string
+	format string
+
+	out textOutput
+}
+
+func (c *commandSnapshotExport) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("export", "Stream the contents of a snapshot to stdout as an archive.")
+	cmd.Arg("source", "Snapshot ID or object ID of the directory to export, optionally followed by a path").Required().StringVar(&c.source)
+	cmd.Flag("format", "Archive format").Default(restoreModeTar).EnumVar(&c.format, restoreModeTar, restoreModeTgz, restoreModeZip, restoreModeZipNoCompress)
+	cmd.Action(svc.repositoryReaderAction(c.run))
+
+	c.out.setup(svc)
+}
+
+// nopWriteCloser prevents archive outputs from closing the underlying stream when they finish.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func (c *commandSnapshotExport) archiveOutput(w io.Writer) restore.Output {
+	switch c.format {
+	case restoreModeTgz:
+		return restore.NewTarOutput(gzip.NewWriter(w))
+
+	case restoreModeZip:
+		return restore.NewZipOutput(nopWriteCloser{w}, zip.Deflate)
+
+	case restoreModeZipNoCompress:
+		return restore.NewZipOutput(nopWriteCloser{w}, zip.Store)
+
+	default:
+		return restore.NewTarOutput(nopWriteCloser{w})
+	}
+}
+
+func (c *commandSnapshotExport) run(ctx context.Context, rep repo.Repository) error {
+	rootEntry, err := snapshotfs.FilesystemEntryFromIDWithPath(ctx, rep, c.source, false)
+	if err != nil {
+		return errors.Wrap(err, "unable to get filesystem entry")
+	}
+
+	// archive outputs write entries as they are visited, so the snapshot is never buffered in memory.
+	st, err := restore.Entry(ctx, rep, c.archiveOutput(c.out.stdout()), rootEntry, restore.Options{
+		Parallel:               1,
+		RestoreDirEntryAtDepth: unlimitedDepth,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error exporting snapshot")
+	}
+
+	printRestoreStats(ctx, st)
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package cli_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestSnapshotExportTar(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	srcDir := testutil.TempDirectory(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "file1"), []byte("contents of file1"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "file2"), []byte("contents of file2"), 0o640))
+
+	mtime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(srcDir, "file1"), mtime, mtime))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+
+	var man snapshot.Manifest
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "snapshot", "create", srcDir, "--json"), &man)
+
+	type tarEntry struct {
+		mode     int64
+		typeflag byte
+		modTime  time.Time
+		data     string
+	}
+
+	readTar := func(data []byte) map[string]tarEntry {
+		result := map[string]tarEntry{}
+
+		tr := tar.NewReader(bytes.NewReader(data))
+
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return result
+			}
+
+			require.NoError(t, err)
+
+			contents, err := io.ReadAll(tr)
+			require.NoError(t, err)
+
+			result[hdr.Name] = tarEntry{hdr.Mode, hdr.Typeflag, hdr.ModTime, string(contents)}
+		}
+	}
+
+	entries := readTar(env.RunAndGetRawStdout(t, "snapshot", "export", string(man.ID)))
+
+	require.Equal(t, "contents of file1", entries["file1"].data)
+	require.Equal(t, int64(0o600), entries["file1"].mode)
+	require.True(t, mtime.Equal(entries["file1"].modTime), "unexpected mtime %v", entries["file1"].modTime)
+
+	require.Equal(t, byte(tar.TypeDir), entries["sub/"].typeflag)
+	require.Equal(t, int64(0o700), entries["sub/"].mode&0o777)
+
+	require.Equal(t, "contents of file2", entries["sub/file2"].data)
+	require.Equal(t, int64(0o640), entries["sub/file2"].mode)
+
+	// exporting a subdirectory by root object ID produces paths relative to it.
+	entries = readTar(env.RunAndGetRawStdout(t, "snapshot", "export", man.RootObjectID().String()+"/sub"))
+	require.Equal(t, "contents of file2", entries["file2"].data)
+	require.NotContains(t, entries, "file1")
+
+	env.RunAndExpectFailure(t, "snapshot", "export", string(man.ID), "--format=rar")
+}
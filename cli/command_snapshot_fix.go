@@ -29,6 +29,7 @@ type commonRewriteSnapshots struct {
 	manifestIDs        []string
 	sources            []string
 	commit             bool
+	keepOriginal       bool
 	parallel           int
 	invalidDirHandling string
 }
@@ -38,6 +39,11 @@ type commonRewriteSnapshots struct {
 	invalidEntryStub   = "stub"   // replaces unreadable file/directory with a stub file
 	invalidEntryFail   = "fail"   // fail the command
 	invalidEntryRemove = "remove" // removes unreadable file/directory
+
+	// original snapshots preserved with --keep-original are pinned and marked as incomplete,
+	// so that they are never expired and don't count towards retention of their source.
+	keptOriginalSnapshotPin              = "original"
+	keptOriginalSnapshotIncompleteReason = "replaced"
 )
 
 func (c *commonRewriteSnapshots) setup(svc appServices, cmd *kingpin.CmdClause) {
@@ -46,6 +52,7 @@ func (c *commonRewriteSnapshots) setup(svc appServices, cmd *kingpin.CmdClause)
 	cmd.Flag("manifest-id", "Manifest IDs").StringsVar(&c.manifestIDs)
 	cmd.Flag("source", "Source to target (username@hostname:/path)").StringsVar(&c.sources)
 	cmd.Flag("commit", "Update snapshot manifests").BoolVar(&c.commit)
+	cmd.Flag("keep-original", "Keep original snapshot manifests as pinned incomplete snapshots when updating them").BoolVar(&c.keepOriginal)
 	cmd.Flag("parallel", "Parallelism").IntVar(&c.parallel)
 	cmd.Flag("invalid-directory-handling", "Handling of invalid directories").Default(invalidEntryStub).EnumVar(&c.invalidDirHandling, invalidEntryFail, invalidEntryStub, invalidEntryKeep)
 }
@@ -107,8 +114,8 @@ func (c *commonRewriteSnapshots) rewriteMatchingSnapshots(ctx context.Context, r
 			}
 
 			if c.commit {
-				if err := snapshot.UpdateSnapshot(ctx, rep, man); err != nil {
-					return errors.Wrap(err, "error updating snapshot")
+				if err := c.commitRewrittenSnapshot(ctx, rep, old, man); err != nil {
+					return err
 				}
 			}
 
@@ -138,6 +145,24 @@ func (c *commonRewriteSnapshots) rewriteMatchingSnapshots(ctx context.Context, r
 	return nil
 }
 
+// commitRewrittenSnapshot replaces the original snapshot manifest with the rewritten one,
+// optionally keeping the original one pinned and marked as incomplete.
+func (c *commonRewriteSnapshots) commitRewrittenSnapshot(ctx context.Context, rep repo.RepositoryWriter, original, rewritten *snapshot.Manifest) error {
+	if !c.keepOriginal {
+		return errors.Wrap(snapshot.UpdateSnapshot(ctx, rep, rewritten), "error updating snapshot")
+	}
+
+	if _, err := snapshot.SaveSnapshot(ctx, rep, rewritten); err != nil {
+		return errors.Wrap(err, "error saving snapshot")
+	}
+
+	kept := original.Clone()
+	kept.IncompleteReason = keptOriginalSnapshotIncompleteReason
+	kept.UpdatePins([]string{keptOriginalSnapshotPin}, nil)
+
+	return errors.Wrap(snapshot.UpdateSnapshot(ctx, rep, kept), "error updating original snapshot")
+}
+
 func snapshotSizeDelta(m1, m2 *snapshot.Manifest) string {
 	if m1.RootEntry == nil || m2.RootEntry == nil {
 		return ""
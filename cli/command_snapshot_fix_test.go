@@ -363,6 +363,62 @@ func TestSnapshotFix(t *testing.T) {
 	}
 }
 
+func TestSnapshotFixKeepOriginal(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	srcDir := testutil.TempDirectory(t)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "dir1"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "file1"), []byte("contents of file1"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "dir1", "file2"), []byte("contents of file2"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "dir1", "file3"), []byte("contents of file3"), 0o600))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+
+	var man snapshot.Manifest
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "snapshot", "create", srcDir, "--json"), &man)
+
+	fileMap := mustGetFileMap(t, env, man.RootObjectID())
+	forgetContents(t, env, fileMap["dir1/file2"].ObjectID.String())
+
+	env.RunAndExpectSuccess(t, "snapshot", "fix", "invalid-files", "--invalid-file-handling=remove", "--commit", "--keep-original")
+
+	var manifests []cli.SnapshotManifest
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "snapshot", "list", "--json", "--incomplete", srcDir), &manifests)
+	require.Len(t, manifests, 2)
+
+	var fixed, original *cli.SnapshotManifest
+
+	for i := range manifests {
+		if manifests[i].IncompleteReason == "" {
+			fixed = &manifests[i]
+		} else {
+			original = &manifests[i]
+		}
+	}
+
+	require.NotNil(t, fixed)
+	require.NotNil(t, original)
+
+	// the original snapshot is kept pinned, but does not count towards retention.
+	require.Equal(t, man.RootObjectID(), original.RootObjectID())
+	require.Equal(t, []string{"original"}, original.Pins)
+	require.Equal(t, "replaced", original.IncompleteReason)
+	require.NotContains(t, original.RetentionReasons, "latest-1")
+
+	require.NotEqual(t, man.RootObjectID(), fixed.RootObjectID())
+	require.Contains(t, fixed.RetentionReasons, "latest-1")
+
+	restoreDir := testutil.TempDirectory(t)
+	env.RunAndExpectSuccess(t, "snapshot", "restore", string(fixed.ID), restoreDir)
+
+	require.FileExists(t, filepath.Join(restoreDir, "file1"))
+	require.FileExists(t, filepath.Join(restoreDir, "dir1", "file3"))
+	require.NoFileExists(t, filepath.Join(restoreDir, "dir1", "file2"))
+}
+
 // forgetContents rewrites contents into a new blob and deletes the blob
 // making index entries dangling.
 func forgetContents(t *testing.T, env *testenv.CLITest, contentIDs ...string) {
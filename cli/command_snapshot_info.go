@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+type commandSnapshotInfo struct {
+	snapshotIDs []string
+
+	jo  jsonOutput
+	out textOutput
+}
+
+func (c *commandSnapshotInfo) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("info", "Show summary statistics of snapshots.")
+	cmd.Arg("id", "Snapshot IDs").Required().StringsVar(&c.snapshotIDs)
+	cmd.Action(svc.repositoryReaderAction(c.run))
+
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+}
+
+func (c *commandSnapshotInfo) run(ctx context.Context, rep repo.Repository) error {
+	var jl jsonList
+
+	jl.begin(&c.jo)
+	defer jl.end()
+
+	for _, id := range c.snapshotIDs {
+		m, err := snapshot.LoadSnapshot(ctx, rep, manifest.ID(id))
+		if err != nil {
+			return errors.Wrapf(err, "error loading snapshot %v", id)
+		}
+
+		summary := m.Summary
+		if summary == nil {
+			// snapshots created without a summary, compute it now.
+			summary, err = snapshotfs.ComputeSummary(ctx, rep, m, snapshotfs.DefaultSummaryLargestFiles)
+			if err != nil {
+				return errors.Wrapf(err, "error computing summary of %v", id)
+			}
+		}
+
+		if c.jo.jsonOutput {
+			jl.emit(summary)
+			continue
+		}
+
+		c.out.printStdout("Snapshot:       %v\n", m.ID)
+		c.out.printStdout("Source:         %v\n", m.Source)
+		c.out.printStdout("Logical size:   %v\n", units.BytesStringBase10(summary.LogicalBytes))
+		c.out.printStdout("Stored size:    %v\n", units.BytesStringBase10(summary.StoredBytes))
+		c.out.printStdout("Files:          %v\n", summary.FileCount)
+		c.out.printStdout("Directories:    %v\n", summary.DirCount)
+
+		if len(summary.LargestFiles) > 0 {
+			c.out.printStdout("Largest files:\n")
+
+			for _, f := range summary.LargestFiles {
+				c.out.printStdout("  %10v %v\n", units.BytesStringBase10(f.Size), f.Path)
+			}
+		}
+	}
+
+	return nil
+}
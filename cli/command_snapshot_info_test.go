@@ -0,0 +1,53 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/cli"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestSnapshotInfo(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	dir := testutil.TempDirectory(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "subdir"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "file1.txt"), []byte("hello"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "subdir", "file2.txt"), []byte("hello world"), 0o600))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+	env.RunAndExpectSuccess(t, "snapshot", "create", dir, "--summary")
+	env.RunAndExpectSuccess(t, "snapshot", "create", dir)
+
+	var snapshots []*cli.SnapshotManifest
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "snapshot", "list", "--json"), &snapshots)
+	require.Len(t, snapshots, 2)
+	require.NotNil(t, snapshots[0].Summary)
+	require.Nil(t, snapshots[1].Summary)
+
+	// summary is computed on the fly for snapshots without one.
+	for _, s := range snapshots {
+		var summaries []*snapshot.Summary
+
+		testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "snapshot", "info", "--json", string(s.ID)), &summaries)
+		require.Len(t, summaries, 1)
+
+		require.EqualValues(t, 2, summaries[0].FileCount)
+		require.EqualValues(t, 2, summaries[0].DirCount)
+		require.EqualValues(t, 16, summaries[0].LogicalBytes)
+		require.Len(t, summaries[0].LargestFiles, 2)
+		require.Equal(t, "subdir/file2.txt", summaries[0].LargestFiles[0].Path)
+	}
+
+	lines := env.RunAndExpectSuccess(t, "snapshot", "info", string(snapshots[0].ID))
+	require.Contains(t, lines, "Files:          2")
+
+	env.RunAndExpectFailure(t, "snapshot", "info", "no-such-snapshot")
+}
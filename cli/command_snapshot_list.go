@@ -34,6 +34,10 @@ type commandSnapshotList struct {
 	snapshotListShowAll              bool
 	maxResultsPerPath                int
 	snapshotListTags                 []string
+	snapshotListHost                 string
+	snapshotListUser                 string
+	snapshotListAfter                string
+	snapshotListBefore               string
 	storageStats                     bool
 	reverseSort                      bool
 
@@ -57,16 +61,23 @@ func (c *commandSnapshotList) setup(svc appServices, parent commandParent) {
 	cmd.Flag("all", "Show all snapshots (not just current username/host)").Short('a').BoolVar(&c.snapshotListShowAll)
 	cmd.Flag("max-results", "Maximum number of entries per source.").Short('n').IntVar(&c.maxResultsPerPath)
 	cmd.Flag("tags", "Tag filters to apply on the list items. Must be provided in the <key>:<value> format.").StringsVar(&c.snapshotListTags)
+	cmd.Flag("host", "Only list snapshots of sources from the given host.").StringVar(&c.snapshotListHost)
+	cmd.Flag("user", "Only list snapshots of sources owned by the given user.").StringVar(&c.snapshotListUser)
+	cmd.Flag("after", "Only list snapshots taken at or after the given time (RFC3339 or YYYY-MM-DD).").StringVar(&c.snapshotListAfter)
+	cmd.Flag("before", "Only list snapshots taken before the given time (RFC3339 or YYYY-MM-DD).").StringVar(&c.snapshotListBefore)
 	c.jo.setup(svc, cmd)
 	c.out.setup(svc)
 	cmd.Action(svc.repositoryReaderAction(c.run))
 }
 
-func findSnapshotsForSource(ctx context.Context, rep repo.Repository, sourceInfo snapshot.SourceInfo, tags map[string]string) (manifestIDs []manifest.ID, err error) {
+func findSnapshotsForSource(ctx context.Context, rep repo.Repository, sourceInfo snapshot.SourceInfo, f snapshot.ListFilter) (manifestIDs []manifest.ID, err error) {
 	var result []manifest.ID
 
 	for len(sourceInfo.Path) > 0 {
-		list, err := snapshot.ListSnapshotManifests(ctx, rep, &sourceInfo, tags)
+		src := sourceInfo
+		f.Source = &src
+
+		list, err := snapshot.ListSnapshotManifestsFiltered(ctx, rep, f)
 		if err != nil {
 			return nil, errors.Wrapf(err, "error listing manifests for %v", sourceInfo)
 		}
@@ -103,29 +114,78 @@ func findRelativePathParts(m *snapshot.Manifest, path string) ([]string, error)
 	return strings.Split(filepath.ToSlash(relPath), "/"), nil
 }
 
-func findManifestIDs(ctx context.Context, rep repo.Repository, source string, tags map[string]string) ([]manifest.ID, string, error) {
-	if source == "" {
-		man, err := snapshot.ListSnapshotManifests(ctx, rep, nil, tags)
+func (c *commandSnapshotList) findManifestIDs(ctx context.Context, rep repo.Repository, f snapshot.ListFilter) ([]manifest.ID, string, error) {
+	if c.snapshotListPath == "" {
+		man, err := snapshot.ListSnapshotManifestsFiltered(ctx, rep, f)
 		return man, "", errors.Wrap(err, "error listing all snapshot manifests")
 	}
 
-	si, err := snapshot.ParseSourceInfo(source, rep.ClientOptions().Hostname, rep.ClientOptions().Username)
+	hostname := rep.ClientOptions().Hostname
+	if f.Host != "" {
+		hostname = f.Host
+	}
+
+	username := rep.ClientOptions().Username
+	if f.UserName != "" {
+		username = f.UserName
+	}
+
+	si, err := snapshot.ParseSourceInfo(c.snapshotListPath, hostname, username)
 	if err != nil {
-		return nil, "", errors.Errorf("invalid directory: '%s': %s", source, err)
+		return nil, "", errors.Errorf("invalid directory: '%s': %s", c.snapshotListPath, err)
 	}
 
-	manifestIDs, err := findSnapshotsForSource(ctx, rep, si, tags)
+	manifestIDs, err := findSnapshotsForSource(ctx, rep, si, f)
 
 	return manifestIDs, si.Path, err
 }
 
-func (c *commandSnapshotList) run(ctx context.Context, rep repo.Repository) error {
+func parseSnapshotListTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.Errorf("invalid time: %q, expected RFC3339 or YYYY-MM-DD", s)
+}
+
+func (c *commandSnapshotList) listFilter() (snapshot.ListFilter, error) {
 	tags, err := getTags(c.snapshotListTags)
+	if err != nil {
+		return snapshot.ListFilter{}, err
+	}
+
+	after, err := parseSnapshotListTime(c.snapshotListAfter)
+	if err != nil {
+		return snapshot.ListFilter{}, errors.Wrap(err, "invalid --after")
+	}
+
+	before, err := parseSnapshotListTime(c.snapshotListBefore)
+	if err != nil {
+		return snapshot.ListFilter{}, errors.Wrap(err, "invalid --before")
+	}
+
+	return snapshot.ListFilter{
+		Host:           c.snapshotListHost,
+		UserName:       c.snapshotListUser,
+		Tags:           tags,
+		ModifiedAfter:  after,
+		ModifiedBefore: before,
+	}, nil
+}
+
+func (c *commandSnapshotList) run(ctx context.Context, rep repo.Repository) error {
+	f, err := c.listFilter()
 	if err != nil {
 		return err
 	}
 
-	manifestIDs, fullPath, err := findManifestIDs(ctx, rep, c.snapshotListPath, tags)
+	manifestIDs, fullPath, err := c.findManifestIDs(ctx, rep, f)
 	if err != nil {
 		return err
 	}
@@ -191,11 +251,21 @@ func (c *commandSnapshotList) shouldOutputSnapshotSource(rep repo.Repository, sr
 
 	co := rep.ClientOptions()
 
-	if src.Host != co.Hostname {
+	host := co.Hostname
+	if c.snapshotListHost != "" {
+		host = c.snapshotListHost
+	}
+
+	user := co.Username
+	if c.snapshotListUser != "" {
+		user = c.snapshotListUser
+	}
+
+	if src.Host != host {
 		return false
 	}
 
-	return src.UserName == co.Username
+	return src.UserName == user
 }
 
 func (c *commandSnapshotList) outputManifestGroups(ctx context.Context, rep repo.Repository, manifests []*snapshot.Manifest, path string) error {
@@ -4,6 +4,7 @@
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -122,3 +123,60 @@ func TestSnapshotListWithSameFileInMultipleSnapshots(t *testing.T) {
 		filepath.Join(srcdir, "a", "b", "c", "d", "e.txt"),
 	}, sps)
 }
+
+func TestSnapshotListFilters(t *testing.T) {
+	t.Parallel()
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	defer e.RunAndExpectSuccess(t, "repo", "disconnect")
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir, "--override-username=user1", "--override-hostname=host1")
+
+	srcdir1 := testutil.TempDirectory(t)
+	srcdir2 := testutil.TempDirectory(t)
+	require.NoError(t, os.WriteFile(filepath.Join(srcdir1, "some-file"), []byte{1, 2, 3}, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcdir2, "some-file"), []byte{4, 5, 6}, 0o755))
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", srcdir1)
+	e.RunAndExpectSuccess(t, "snapshot", "create", srcdir2)
+
+	e.RunAndExpectSuccess(t, "repo", "connect", "filesystem", "--path", e.RepoDir, "--override-username=user2", "--override-hostname=host2")
+
+	midpoint := time.Now()
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", srcdir1)
+
+	listJSON := func(args ...string) []*cli.SnapshotManifest {
+		var snapshots []*cli.SnapshotManifest
+
+		testutil.MustParseJSONLines(t, e.RunAndExpectSuccess(t, append([]string{"snapshot", "list", "--json"}, args...)...), &snapshots)
+
+		return snapshots
+	}
+
+	require.Len(t, listJSON(), 3)
+	require.Len(t, listJSON("--all"), 3)
+	require.Len(t, listJSON(srcdir1), 1)
+
+	host1 := listJSON("--host=host1")
+	require.Len(t, host1, 2)
+
+	for _, s := range host1 {
+		require.Equal(t, "host1", s.Source.Host)
+	}
+
+	require.Len(t, listJSON("--user=user2"), 1)
+	require.Len(t, listJSON("--user=user1", "--host=host2"), 0)
+	require.Len(t, listJSON("--host=host1", "--user=user1", srcdir2), 1)
+
+	require.Len(t, listJSON("--after="+midpoint.Format(time.RFC3339Nano)), 1)
+	require.Len(t, listJSON("--before="+midpoint.Format(time.RFC3339Nano)), 2)
+	require.Len(t, listJSON("--host=host1", "--after="+midpoint.Format(time.RFC3339Nano)), 0)
+
+	// text output honors --host even though the connection is for host2.
+	lines := e.RunAndExpectSuccess(t, "snapshot", "list", "--host=host1", "--user=user1")
+	require.Len(t, lines, 5)
+
+	e.RunAndExpectFailure(t, "snapshot", "list", "--after=yesterday")
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/units"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+type commandSnapshotUsage struct {
+	jo  jsonOutput
+	out textOutput
+}
+
+// SnapshotUsageInfo describes storage used by a single snapshot, as returned by 'snapshot usage --json'.
+type SnapshotUsageInfo struct {
+	ID             string              `json:"id"`
+	Source         snapshot.SourceInfo `json:"source"`
+	StartTime      fs.UTCTimestamp     `json:"startTime"`
+	ExclusiveBytes int64               `json:"exclusiveBytes"`
+	SharedBytes    int64               `json:"sharedBytes"`
+	TotalBytes     int64               `json:"totalBytes"`
+}
+
+func (c *commandSnapshotUsage) setup(svc appServices, parent commandParent) {
+	cmd := parent.Command("usage", "Show repository storage used by each snapshot, distinguishing bytes exclusive to a snapshot from bytes shared with other snapshots.")
+	cmd.Action(svc.repositoryReaderAction(c.run))
+
+	c.jo.setup(svc, cmd)
+	c.out.setup(svc)
+}
+
+func (c *commandSnapshotUsage) run(ctx context.Context, rep repo.Repository) error {
+	ids, err := snapshot.ListSnapshotManifests(ctx, rep, nil, nil)
+	if err != nil {
+		return errors.Wrap(err, "error listing snapshots")
+	}
+
+	manifests, err := snapshot.LoadSnapshots(ctx, rep, ids)
+	if err != nil {
+		return errors.Wrap(err, "error loading snapshots")
+	}
+
+	usage, err := snapshotfs.CalculateSnapshotUsage(ctx, rep, manifests)
+	if err != nil {
+		return errors.Wrap(err, "error calculating snapshot usage")
+	}
+
+	// snapshots whose deletion would reclaim the most space first.
+	sort.SliceStable(usage, func(i, j int) bool {
+		return usage[i].ExclusiveBytes > usage[j].ExclusiveBytes
+	})
+
+	var result []SnapshotUsageInfo
+
+	for _, u := range usage {
+		result = append(result, SnapshotUsageInfo{
+			ID:             string(u.Manifest.ID),
+			Source:         u.Manifest.Source,
+			StartTime:      u.Manifest.StartTime,
+			ExclusiveBytes: u.ExclusiveBytes,
+			SharedBytes:    u.SharedBytes,
+			TotalBytes:     u.TotalBytes(),
+		})
+	}
+
+	if c.jo.jsonOutput {
+		c.out.printStdout("%s\n", c.jo.jsonBytes(result))
+		return nil
+	}
+
+	var totalExclusive int64
+
+	for _, r := range result {
+		c.out.printStdout("%v %v %v exclusive:%v shared:%v total:%v\n",
+			r.ID, r.Source, formatTimestamp(r.StartTime.ToTime()),
+			units.BytesStringBase10(r.ExclusiveBytes),
+			units.BytesStringBase10(r.SharedBytes),
+			units.BytesStringBase10(r.TotalBytes))
+
+		totalExclusive += r.ExclusiveBytes
+	}
+
+	c.out.printStdout("%v snapshots, %v exclusive to individual snapshots.\n", len(result), units.BytesStringBase10(totalExclusive))
+
+	return nil
+}
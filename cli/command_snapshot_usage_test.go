@@ -0,0 +1,48 @@
+package cli_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/cli"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestSnapshotUsage(t *testing.T) {
+	env := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, testenv.NewInProcRunner(t))
+
+	dir1 := testutil.TempDirectory(t)
+	dir2 := testutil.TempDirectory(t)
+
+	for _, d := range []string{dir1, dir2} {
+		require.NoError(t, os.WriteFile(filepath.Join(d, "shared.txt"), []byte("shared contents"), 0o600))
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir2, "unique.txt"), []byte("unique contents"), 0o600))
+
+	env.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", env.RepoDir)
+	env.RunAndExpectSuccess(t, "snapshot", "create", dir1)
+	env.RunAndExpectSuccess(t, "snapshot", "create", dir2)
+
+	var usage []cli.SnapshotUsageInfo
+
+	testutil.MustParseJSONLines(t, env.RunAndExpectSuccess(t, "snapshot", "usage", "--json"), &usage)
+	require.Len(t, usage, 2)
+
+	// the snapshot with the additional unique file is listed first.
+	require.Equal(t, dir2, usage[0].Source.Path)
+	require.Equal(t, dir1, usage[1].Source.Path)
+	require.Greater(t, usage[0].ExclusiveBytes, usage[1].ExclusiveBytes)
+
+	for _, u := range usage {
+		require.Positive(t, u.SharedBytes)
+		require.Equal(t, usage[0].SharedBytes, u.SharedBytes)
+		require.Equal(t, u.ExclusiveBytes+u.SharedBytes, u.TotalBytes)
+	}
+
+	env.RunAndExpectSuccess(t, "snapshot", "usage")
+}
@@ -78,6 +78,10 @@ func (c *App) optionsFromFlags(ctx context.Context) *repo.Options {
 		UpgradeOwnerID:      c.upgradeOwnerID,
 		DoNotWaitForUpgrade: c.doNotWaitForUpgrade,
 
+		SkipContentMACVerification: c.skipContentMACVerification,
+		ReadVerifyProbability:      c.readVerifyProbability,
+		ContentBloomFilter:         c.contentBloomFilter,
+
 		// when a fatal error is encountered in the repository, run all registered callbacks
 		// and exit the program.
 		OnFatalError: func(err error) {
@@ -492,6 +492,34 @@ func setupFilesystem(skipDefaultFiles bool) *mockfs.Directory {
 		},
 		ignoredFiles: []string{},
 	},
+	{
+		desc:             "directory-only pattern and nested negation",
+		policyTree:       defaultPolicy,
+		skipDefaultFiles: true,
+		setup: func(root *mockfs.Directory) {
+			root.AddFileLines(".kopiaignore", []string{
+				"build/",
+				"*.log",
+			}, 0)
+			root.AddDir("build", 0).AddFile("out.bin", dummyFileContents, 0)
+			root.AddFile("app.log", dummyFileContents, 0)
+			root.AddDir("src", 0).AddFile("build", dummyFileContents, 0)
+			root.Subdir("src").AddFile("debug.log", dummyFileContents, 0)
+			root.Subdir("src").AddFile("keep.log", dummyFileContents, 0)
+			root.Subdir("src").AddDir("build", 0).AddFile("obj.o", dummyFileContents, 0)
+			root.Subdir("src").AddFileLines(".kopiaignore", []string{
+				"!keep.log",
+			}, 0)
+		},
+		addedFiles: []string{
+			"./.kopiaignore",
+			"./src/",
+			"./src/.kopiaignore",
+			"./src/build",
+			"./src/keep.log",
+		},
+		ignoredFiles: []string{},
+	},
 }
 
 func TestIgnoreFS(t *testing.T) {
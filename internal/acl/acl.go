@@ -27,7 +27,7 @@
 // The value can have two special placeholders - OWN_USER and OWN_VALUE representing the matched user
 // and host respectively if wildcards are being used.
 // Each target rule must have a type "type" key with a value corresponding to a manifest type
-// ("snapshot", "policy", "user", "acl"). A special type "content" gives access to contents.
+// ("snapshot", "upload-lease", "policy", "user", "acl"). A special type "content" gives access to contents.
 type TargetRule map[string]string
 
 func (r TargetRule) String() string {
@@ -110,6 +110,11 @@ func oneOf(allowed ...string) valueValidatorFunc {
 		snapshot.UsernameLabel: nonEmptyString,
 		snapshot.PathLabel:     nonEmptyString,
 	},
+	snapshot.UploadLeaseManifestType: {
+		snapshot.HostnameLabel: nonEmptyString,
+		snapshot.UsernameLabel: nonEmptyString,
+		snapshot.PathLabel:     nonEmptyString,
+	},
 	user.ManifestType: {
 		user.UsernameAtHostnameLabel: nonEmptyString,
 	},
@@ -76,6 +76,16 @@
 		},
 		Access: acl.AccessLevelFull,
 	},
+	{
+		// username@hostname has full access to leases of their own uploads in progress
+		User: anyUser,
+		Target: acl.TargetRule{
+			manifest.TypeLabelKey:  snapshot.UploadLeaseManifestType,
+			snapshot.UsernameLabel: acl.OwnUser,
+			snapshot.HostnameLabel: acl.OwnHost,
+		},
+		Access: acl.AccessLevelFull,
+	},
 	{
 		// username@hostname has full access to their user account and can change password
 		User: anyUser,
@@ -256,6 +256,24 @@ func (s *objectLockingMap) TouchBlob(ctx context.Context, id blob.ID, threshold
 	return nil
 }
 
+// ExtendBlobRetention extends the retention time of the latest version of the object.
+// Retention is never shortened.
+func (s *objectLockingMap) ExtendBlobRetention(ctx context.Context, id blob.ID, until time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, err := s.getLatestByID(id)
+	if err != nil {
+		return err
+	}
+
+	if until.After(e.retentionTime) {
+		e.retentionTime = until
+	}
+
+	return nil
+}
+
 // ConnectionInfo is a no-op.
 func (s *objectLockingMap) ConnectionInfo() blob.ConnectionInfo {
 	// unsupported
@@ -4,6 +4,10 @@
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/gather"
 	"github.com/kopia/kopia/internal/testlogging"
 	"github.com/kopia/kopia/repo/blob"
 )
@@ -19,3 +23,34 @@ func TestObjectLockingStorage(t *testing.T) {
 		RetentionPeriod: 24 * time.Hour,
 	})
 }
+
+func TestObjectLockingStorage_ExtendBlobRetention(t *testing.T) {
+	ctx := testlogging.Context(t)
+	ta := faketime.NewClockTimeWithOffset(0)
+	st := NewVersionedMapStorage(ta.NowFunc())
+
+	opts := blob.PutOptions{
+		RetentionMode:   blob.Governance,
+		RetentionPeriod: 24 * time.Hour,
+	}
+
+	require.NoError(t, st.PutBlob(ctx, "live", gather.FromSlice([]byte{1}), opts))
+	require.NoError(t, st.PutBlob(ctx, "dead", gather.FromSlice([]byte{2}), opts))
+
+	until := ta.NowFunc()().Add(72 * time.Hour)
+	require.NoError(t, blob.ExtendBlobRetention(ctx, st, "live", until))
+
+	// retention is never shortened.
+	require.NoError(t, blob.ExtendBlobRetention(ctx, st, "live", ta.NowFunc()()))
+	require.ErrorIs(t, blob.ExtendBlobRetention(ctx, st, "missing", until), blob.ErrBlobNotFound)
+
+	ta.Advance(48 * time.Hour)
+
+	// dead blob retention expired and it can be mutated, live one is still locked.
+	require.NoError(t, st.(*objectLockingMap).TouchBlob(ctx, "dead", 0))
+	require.Error(t, st.(*objectLockingMap).TouchBlob(ctx, "live", 0))
+
+	ta.Advance(48 * time.Hour)
+
+	require.NoError(t, st.(*objectLockingMap).TouchBlob(ctx, "live", 0))
+}
@@ -0,0 +1,97 @@
+package blobtesting
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+var errPageFull = errors.New("page full")
+
+// PaginatedStorage simulates a backend whose list API returns results in pages of limited size,
+// each of which must be requested separately using a continuation token, like most cloud providers do.
+type PaginatedStorage struct {
+	blob.Storage
+
+	pageSize    int
+	pagesServed int32
+}
+
+// ListPage returns up to the page size of blobs with the provided prefix, starting after the provided
+// continuation token (empty for the first page), along with the token used to retrieve the next page,
+// which is empty when no more pages are available.
+func (s *PaginatedStorage) ListPage(ctx context.Context, prefix blob.ID, continuationToken string) ([]blob.Metadata, string, error) {
+	atomic.AddInt32(&s.pagesServed, 1)
+
+	var (
+		page    []blob.Metadata
+		hasMore bool
+	)
+
+	// the underlying storage lists blobs in sorted order, so the last blob ID on the page is a valid token.
+	err := s.Storage.ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+		if bm.BlobID <= blob.ID(continuationToken) {
+			return nil
+		}
+
+		if len(page) == s.pageSize {
+			hasMore = true
+			return errPageFull
+		}
+
+		page = append(page, bm)
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errPageFull) {
+		return nil, "", errors.Wrap(err, "error listing page")
+	}
+
+	if !hasMore {
+		return page, "", nil
+	}
+
+	return page, string(page[len(page)-1].BlobID), nil
+}
+
+// ListBlobs implements blob.Storage by requesting consecutive pages until the last one is reached
+// or the callback returns an error.
+func (s *PaginatedStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	var token string
+
+	for {
+		page, next, err := s.ListPage(ctx, prefix, token)
+		if err != nil {
+			return err
+		}
+
+		for _, bm := range page {
+			if err := callback(bm); err != nil {
+				return err
+			}
+		}
+
+		if next == "" {
+			return nil
+		}
+
+		token = next
+	}
+}
+
+// PagesServed returns the number of pages requested so far.
+func (s *PaginatedStorage) PagesServed() int {
+	return int(atomic.LoadInt32(&s.pagesServed))
+}
+
+// NewPaginatedStorage returns a storage which lists blobs of the provided base storage, which must list them
+// in sorted order, in pages of the provided size.
+func NewPaginatedStorage(base blob.Storage, pageSize int) *PaginatedStorage {
+	return &PaginatedStorage{
+		Storage:  base,
+		pageSize: pageSize,
+	}
+}
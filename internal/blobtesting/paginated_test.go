@@ -0,0 +1,101 @@
+package blobtesting
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestPaginatedStorage(t *testing.T) {
+	for _, pageSize := range []int{1, 2, 3, 7} {
+		pageSize := pageSize
+
+		t.Run(fmt.Sprintf("page-%v", pageSize), func(t *testing.T) {
+			ctx := testlogging.Context(t)
+
+			r := NewPaginatedStorage(NewMapStorage(DataMap{}, nil, nil), pageSize)
+
+			VerifyStorage(ctx, t, r, blob.PutOptions{})
+			VerifyListPagination(ctx, t, r, "pg", 25)
+		})
+	}
+}
+
+func TestPaginatedStorage_ListPage(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := DataMap{}
+
+	for i := 0; i < 10; i++ {
+		data[blob.ID(fmt.Sprintf("b%03d", i))] = []byte{1}
+	}
+
+	data["other"] = []byte{2}
+
+	r := NewPaginatedStorage(NewMapStorage(data, nil, nil), 4)
+
+	var (
+		got   []blob.ID
+		token string
+		pages int
+	)
+
+	for {
+		page, next, err := r.ListPage(ctx, "b", token)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page), 4)
+
+		for _, bm := range page {
+			got = append(got, bm.BlobID)
+		}
+
+		pages++
+
+		if next == "" {
+			break
+		}
+
+		token = next
+	}
+
+	require.Equal(t, 3, pages)
+	require.Len(t, got, 10)
+
+	for i, id := range got {
+		require.Equal(t, blob.ID(fmt.Sprintf("b%03d", i)), id)
+	}
+}
+
+func TestPaginatedStorage_AllPagesReturned(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := DataMap{}
+
+	for i := 0; i < 100; i++ {
+		data[blob.ID(fmt.Sprintf("b%03d", i))] = []byte{1}
+	}
+
+	r := NewPaginatedStorage(NewMapStorage(data, nil, nil), 3)
+
+	all, err := blob.ListAllBlobs(ctx, r, "b")
+	require.NoError(t, err)
+	require.Len(t, all, 100)
+	require.Equal(t, 34, r.PagesServed())
+
+	// early termination does not request any further pages.
+	errStop := errors.New("stop")
+	before := r.PagesServed()
+
+	require.ErrorIs(t, r.ListBlobs(ctx, "b", func(bm blob.Metadata) error {
+		if bm.BlobID == "b004" {
+			return errStop
+		}
+
+		return nil
+	}), errStop)
+
+	require.Equal(t, before+2, r.PagesServed())
+}
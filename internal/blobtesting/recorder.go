@@ -0,0 +1,459 @@
+package blobtesting
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// Methods of blob.Storage captured by Recorder.
+const (
+	OpGetBlob     = "GetBlob"
+	OpGetMetadata = "GetMetadata"
+	OpPutBlob     = "PutBlob"
+	OpDeleteBlob  = "DeleteBlob"
+	OpListBlobs   = "ListBlobs"
+	OpGetCapacity = "GetCapacity"
+	OpFlushCaches = "FlushCaches"
+	OpClose       = "Close"
+)
+
+// ErrNotRecorded is returned by ReplayStorage for operations that are not in the log.
+var ErrNotRecorded = errors.New("operation was not recorded")
+
+// recordedErrors maps well-known storage errors to their names in the log, so that replayed errors
+// can be recognized using errors.Is().
+//
+//nolint:gochecknoglobals
+var recordedErrors = map[string]error{
+	"not-found":              blob.ErrBlobNotFound,
+	"invalid-range":          blob.ErrInvalidRange,
+	"already-exists":         blob.ErrBlobAlreadyExists,
+	"set-time-unsupported":   blob.ErrSetTimeUnsupported,
+	"unsupported-put-option": blob.ErrUnsupportedPutBlobOption,
+	"not-a-volume":           blob.ErrNotAVolume,
+}
+
+// Operation describes a single storage operation captured by Recorder.
+type Operation struct {
+	Method string  `json:"method"`
+	BlobID blob.ID `json:"blobID,omitempty"` // blob ID or prefix of ListBlobs
+
+	// requested range of GetBlob.
+	Offset int64 `json:"offset,omitempty"`
+	Length int64 `json:"length,omitempty"`
+
+	Size     int64           `json:"size,omitempty"`     // number of bytes read or written
+	Data     []byte          `json:"data,omitempty"`     // data returned by GetBlob
+	Metadata []blob.Metadata `json:"metadata,omitempty"` // blobs returned by GetMetadata and ListBlobs or written by PutBlob
+	Capacity *blob.Capacity  `json:"capacity,omitempty"`
+
+	Error     string `json:"error,omitempty"`
+	ErrorKind string `json:"errorKind,omitempty"`
+}
+
+func (o *Operation) setError(err error) {
+	if err == nil {
+		return
+	}
+
+	o.Error = err.Error()
+
+	for kind, e := range recordedErrors {
+		if errors.Is(err, e) {
+			o.ErrorKind = kind
+		}
+	}
+}
+
+func (o *Operation) err() error {
+	if o.Error == "" {
+		return nil
+	}
+
+	return &replayedError{o.Error, recordedErrors[o.ErrorKind]}
+}
+
+// replayedError has the message of the recorded error and wraps its well-known cause, if any.
+type replayedError struct {
+	msg   string
+	cause error
+}
+
+func (e *replayedError) Error() string { return e.msg }
+
+func (e *replayedError) Unwrap() error { return e.cause }
+
+// Recorder captures the log of operations performed on the storage returned by NewRecorder.
+type Recorder struct {
+	mu sync.Mutex
+	// +checklocks:mu
+	ops []Operation
+}
+
+// Operations returns the operations recorded so far, in the order in which they completed.
+func (r *Recorder) Operations() []Operation {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Operation(nil), r.ops...)
+}
+
+// Save writes the recorded operations as JSON.
+func (r *Recorder) Save(w io.Writer) error {
+	return errors.Wrap(json.NewEncoder(w).Encode(r.Operations()), "error saving operation log")
+}
+
+// LoadOperations reads the operation log written by Recorder.Save().
+func LoadOperations(r io.Reader) ([]Operation, error) {
+	var ops []Operation
+
+	if err := json.NewDecoder(r).Decode(&ops); err != nil {
+		return nil, errors.Wrap(err, "error loading operation log")
+	}
+
+	return ops, nil
+}
+
+func (r *Recorder) add(op Operation, err error) {
+	op.setError(err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ops = append(r.ops, op)
+}
+
+// NewRecorder returns a wrapper around the provided storage that records all operations performed on it.
+func NewRecorder(inner blob.Storage) (*Recorder, blob.Storage) {
+	r := &Recorder{}
+
+	return r, &recordingStorage{inner, r}
+}
+
+type recordingStorage struct {
+	base blob.Storage
+	rec  *Recorder
+}
+
+func (s *recordingStorage) GetCapacity(ctx context.Context) (blob.Capacity, error) {
+	c, err := s.base.GetCapacity(ctx)
+
+	op := Operation{Method: OpGetCapacity}
+	if err == nil {
+		op.Capacity = &c
+	}
+
+	s.rec.add(op, err)
+
+	//nolint:wrapcheck
+	return c, err
+}
+
+func (s *recordingStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	err := s.base.GetBlob(ctx, id, offset, length, &tmp)
+
+	op := Operation{Method: OpGetBlob, BlobID: id, Offset: offset, Length: length}
+	if err == nil {
+		op.Data = tmp.ToByteSlice()
+		op.Size = int64(len(op.Data))
+
+		output.Reset()
+
+		if _, werr := tmp.Bytes().WriteTo(output); werr != nil {
+			return errors.Wrap(werr, "error copying blob data")
+		}
+	}
+
+	s.rec.add(op, err)
+
+	//nolint:wrapcheck
+	return err
+}
+
+func (s *recordingStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
+	bm, err := s.base.GetMetadata(ctx, id)
+
+	op := Operation{Method: OpGetMetadata, BlobID: id}
+	if err == nil {
+		op.Metadata = []blob.Metadata{bm}
+	}
+
+	s.rec.add(op, err)
+
+	//nolint:wrapcheck
+	return bm, err
+}
+
+func (s *recordingStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	err := s.base.PutBlob(ctx, id, data, opts)
+
+	op := Operation{Method: OpPutBlob, BlobID: id, Size: int64(data.Length())}
+	if err == nil && opts.GetModTime != nil {
+		op.Metadata = []blob.Metadata{{BlobID: id, Length: op.Size, Timestamp: *opts.GetModTime}}
+	}
+
+	s.rec.add(op, err)
+
+	//nolint:wrapcheck
+	return err
+}
+
+func (s *recordingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	err := s.base.DeleteBlob(ctx, id)
+
+	s.rec.add(Operation{Method: OpDeleteBlob, BlobID: id}, err)
+
+	//nolint:wrapcheck
+	return err
+}
+
+func (s *recordingStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	var mu sync.Mutex
+
+	op := Operation{Method: OpListBlobs, BlobID: prefix}
+
+	err := s.base.ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+		// some storage implementations invoke the callback concurrently.
+		mu.Lock()
+		op.Metadata = append(op.Metadata, bm)
+		mu.Unlock()
+
+		return callback(bm)
+	})
+
+	s.rec.add(op, err)
+
+	//nolint:wrapcheck
+	return err
+}
+
+func (s *recordingStorage) Close(ctx context.Context) error {
+	err := s.base.Close(ctx)
+
+	s.rec.add(Operation{Method: OpClose}, err)
+
+	//nolint:wrapcheck
+	return err
+}
+
+func (s *recordingStorage) FlushCaches(ctx context.Context) error {
+	err := s.base.FlushCaches(ctx)
+
+	s.rec.add(Operation{Method: OpFlushCaches}, err)
+
+	//nolint:wrapcheck
+	return err
+}
+
+func (s *recordingStorage) ConnectionInfo() blob.ConnectionInfo {
+	return s.base.ConnectionInfo()
+}
+
+func (s *recordingStorage) DisplayName() string {
+	return s.base.DisplayName()
+}
+
+// ReplayStorage serves operations from the log captured by Recorder. Each call returns the results of the
+// first not yet replayed operation with the same method and arguments, so that the order of operations
+// on different blobs does not need to match the recording. Calls without matching operation fail with
+// ErrNotRecorded.
+type ReplayStorage struct {
+	mu sync.Mutex
+	// +checklocks:mu
+	ops []Operation
+	// +checklocks:mu
+	pending map[replayKey][]int // indexes of operations not yet replayed
+}
+
+type replayKey struct {
+	method string
+	blobID blob.ID
+	offset int64
+	length int64
+}
+
+// NewReplayStorage returns storage that replays the provided operations.
+func NewReplayStorage(ops []Operation) *ReplayStorage {
+	s := &ReplayStorage{
+		ops:     ops,
+		pending: map[replayKey][]int{},
+	}
+
+	for i, op := range ops {
+		k := replayKey{op.Method, op.BlobID, op.Offset, op.Length}
+		s.pending[k] = append(s.pending[k], i)
+	}
+
+	return s
+}
+
+// Remaining returns the operations that have not been replayed, in the order in which they were recorded.
+func (s *ReplayStorage) Remaining() []Operation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var indexes []int
+
+	for _, v := range s.pending {
+		indexes = append(indexes, v...)
+	}
+
+	sort.Ints(indexes)
+
+	var result []Operation
+
+	for _, i := range indexes {
+		result = append(result, s.ops[i])
+	}
+
+	return result
+}
+
+func (s *ReplayStorage) next(method string, id blob.ID, offset, length int64) (Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := replayKey{method, id, offset, length}
+
+	indexes := s.pending[k]
+	if len(indexes) == 0 {
+		return Operation{}, errors.Wrapf(ErrNotRecorded, "%v(%q, %v, %v)", method, id, offset, length)
+	}
+
+	if len(indexes) == 1 {
+		delete(s.pending, k)
+	} else {
+		s.pending[k] = indexes[1:]
+	}
+
+	return s.ops[indexes[0]], nil
+}
+
+// GetCapacity implements blob.Volume.
+func (s *ReplayStorage) GetCapacity(ctx context.Context) (blob.Capacity, error) {
+	op, err := s.next(OpGetCapacity, "", 0, 0)
+	if err != nil {
+		return blob.Capacity{}, err
+	}
+
+	if op.Capacity == nil {
+		return blob.Capacity{}, op.err()
+	}
+
+	return *op.Capacity, op.err()
+}
+
+// GetBlob implements blob.Storage.
+func (s *ReplayStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	op, err := s.next(OpGetBlob, id, offset, length)
+	if err != nil {
+		return err
+	}
+
+	if err := op.err(); err != nil {
+		return err
+	}
+
+	output.Reset()
+
+	_, err = output.Write(op.Data)
+
+	return errors.Wrap(err, "error writing output")
+}
+
+// GetMetadata implements blob.Storage.
+func (s *ReplayStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
+	op, err := s.next(OpGetMetadata, id, 0, 0)
+	if err != nil {
+		return blob.Metadata{}, err
+	}
+
+	if len(op.Metadata) == 0 {
+		return blob.Metadata{}, op.err()
+	}
+
+	return op.Metadata[0], op.err()
+}
+
+// PutBlob implements blob.Storage.
+func (s *ReplayStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	op, err := s.next(OpPutBlob, id, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	if opts.GetModTime != nil && len(op.Metadata) > 0 {
+		*opts.GetModTime = op.Metadata[0].Timestamp
+	}
+
+	return op.err()
+}
+
+// DeleteBlob implements blob.Storage.
+func (s *ReplayStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	op, err := s.next(OpDeleteBlob, id, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	return op.err()
+}
+
+// ListBlobs implements blob.Storage.
+func (s *ReplayStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
+	op, err := s.next(OpListBlobs, prefix, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, bm := range op.Metadata {
+		if err := callback(bm); err != nil {
+			return err
+		}
+	}
+
+	return op.err()
+}
+
+// Close implements blob.Storage.
+func (s *ReplayStorage) Close(ctx context.Context) error {
+	op, err := s.next(OpClose, "", 0, 0)
+	if err != nil {
+		return err
+	}
+
+	return op.err()
+}
+
+// FlushCaches implements blob.Storage.
+func (s *ReplayStorage) FlushCaches(ctx context.Context) error {
+	op, err := s.next(OpFlushCaches, "", 0, 0)
+	if err != nil {
+		return err
+	}
+
+	return op.err()
+}
+
+// ConnectionInfo implements blob.Storage.
+func (s *ReplayStorage) ConnectionInfo() blob.ConnectionInfo {
+	return blob.ConnectionInfo{Type: "replay"}
+}
+
+// DisplayName implements blob.Storage.
+func (s *ReplayStorage) DisplayName() string {
+	return "Replay"
+}
+
+var _ blob.Storage = (*ReplayStorage)(nil)
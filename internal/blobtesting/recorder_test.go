@@ -0,0 +1,120 @@
+package blobtesting
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/format"
+)
+
+func TestRecorderReplay(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	now := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	inner := NewMapStorage(DataMap{}, nil, func() time.Time { return now })
+
+	rec, st := NewRecorder(inner)
+
+	// run the same sequence of operations against the recording and replaying storage,
+	// collecting the observed results.
+	run := func(st blob.Storage) []interface{} {
+		var results []interface{}
+
+		var modTime time.Time
+
+		results = append(results,
+			st.PutBlob(ctx, "a1", gather.FromSlice([]byte("hello")), blob.PutOptions{GetModTime: &modTime}),
+			modTime,
+			st.PutBlob(ctx, "a2", gather.FromSlice([]byte("world!")), blob.PutOptions{}))
+
+		var buf gather.WriteBuffer
+		defer buf.Close()
+
+		for _, r := range []struct{ offset, length int64 }{{0, -1}, {1, 3}, {4, 10}} {
+			err := st.GetBlob(ctx, "a1", r.offset, r.length, &buf)
+			results = append(results, err, string(buf.ToByteSlice()))
+		}
+
+		results = append(results, st.GetBlob(ctx, "missing", 0, -1, &buf))
+
+		bm, err := st.GetMetadata(ctx, "a2")
+		results = append(results, bm, err)
+
+		_, err = st.GetMetadata(ctx, "missing")
+		results = append(results, err)
+
+		all, err := blob.ListAllBlobs(ctx, st, "a")
+		results = append(results, all, err)
+
+		results = append(results, st.DeleteBlob(ctx, "a1"))
+
+		err = st.GetBlob(ctx, "a1", 0, -1, &buf)
+		results = append(results, err)
+
+		return results
+	}
+
+	recorded := run(st)
+
+	var log bytes.Buffer
+
+	require.NoError(t, rec.Save(&log))
+
+	ops, err := LoadOperations(&log)
+	require.NoError(t, err)
+	require.Equal(t, rec.Operations(), ops)
+
+	require.Equal(t, OpPutBlob, ops[0].Method)
+	require.Equal(t, blob.ID("a1"), ops[0].BlobID)
+	require.Equal(t, int64(5), ops[0].Size)
+	require.Equal(t, "not-found", ops[5].ErrorKind)
+
+	rs := NewReplayStorage(ops)
+
+	replayed := run(rs)
+	require.Empty(t, rs.Remaining())
+
+	// errors are compared by message, replayed errors also wrap well-known causes.
+	require.Len(t, replayed, len(recorded))
+
+	for i := range recorded {
+		if e, ok := recorded[i].(error); ok {
+			require.EqualError(t, replayed[i].(error), e.Error(), i)
+			continue
+		}
+
+		require.Equal(t, recorded[i], replayed[i], i)
+	}
+
+	require.ErrorIs(t, replayed[len(replayed)-1].(error), blob.ErrBlobNotFound)
+
+	// operations that were not recorded fail.
+	require.ErrorIs(t, rs.DeleteBlob(ctx, "a2"), ErrNotRecorded)
+	require.ErrorIs(t, rs.GetBlob(ctx, "a1", 0, -1, gather.NewWriteBuffer()), ErrNotRecorded)
+}
+
+func TestRecorderReplayRepositoryDescriptor(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	inner := NewMapStorage(DataMap{}, nil, nil)
+	require.NoError(t, repo.Initialize(ctx, inner, &repo.NewRepositoryOptions{}, "password"))
+
+	rec, st := NewRecorder(inner)
+
+	want, err := format.ReadRepositoryDescriptor(ctx, st)
+	require.NoError(t, err)
+
+	rs := NewReplayStorage(rec.Operations())
+
+	got, err := format.ReadRepositoryDescriptor(ctx, rs)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+	require.Empty(t, rs.Remaining())
+}
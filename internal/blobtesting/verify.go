@@ -197,6 +197,48 @@ func VerifyStorage(ctx context.Context, t *testing.T, r blob.Storage, opts blob.
 	})
 }
 
+// VerifyListPagination verifies that ListBlobs() reports all matching blobs when their number exceeds
+// the page size used by the storage, which catches implementations that stop listing after
+// the first page of results. The blobs are written with the provided prefix and removed afterwards.
+//
+//nolint:thelper
+func VerifyListPagination(ctx context.Context, t *testing.T, r blob.Storage, prefix blob.ID, numBlobs int) {
+	var want []blob.ID
+
+	for i := 0; i < numBlobs; i++ {
+		id := blob.ID(fmt.Sprintf("%v%05d", prefix, i))
+
+		require.NoError(t, r.PutBlob(ctx, id, gather.FromSlice([]byte{byte(i)}), blob.PutOptions{}))
+
+		want = append(want, id)
+	}
+
+	defer func() {
+		for _, id := range want {
+			require.NoError(t, r.DeleteBlob(ctx, id))
+		}
+	}()
+
+	AssertListResultsIDs(ctx, t, r, prefix, want...)
+
+	// early termination must stop listing across page boundaries.
+	errStop := errors.New("stop")
+
+	var cnt int
+
+	require.ErrorIs(t, r.ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+		cnt++
+
+		if cnt == numBlobs-1 {
+			return errStop
+		}
+
+		return nil
+	}), errStop)
+
+	require.Equal(t, numBlobs-1, cnt)
+}
+
 // AssertConnectionInfoRoundTrips verifies that the ConnectionInfo returned by a given storage can be used to create
 // equivalent storage.
 //
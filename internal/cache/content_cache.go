@@ -15,6 +15,7 @@ type ContentCache interface {
 	Close(ctx context.Context)
 	GetContent(ctx context.Context, contentID string, blobID blob.ID, offset, length int64, output *gather.WriteBuffer) error
 	PrefetchBlob(ctx context.Context, blobID blob.ID) error
+	Evict(ctx context.Context, contentID string, blobID blob.ID)
 	CacheStorage() Storage
 }
 
@@ -168,6 +169,16 @@ func (c *contentCacheImpl) PrefetchBlob(ctx context.Context, blobID blob.ID) err
 	return c.fetchBlobInternal(ctx, blobID, &blobData)
 }
 
+// Evict removes cached copies of the provided content and of the entire blob containing it.
+func (c *contentCacheImpl) Evict(ctx context.Context, contentID string, blobID blob.ID) {
+	mut := c.pc.GetFetchingMutex(string(blobID))
+	mut.Lock()
+	defer mut.Unlock()
+
+	c.pc.Remove(ctx, ContentIDCacheKey(contentID))
+	c.pc.Remove(ctx, BlobIDCacheKey(blobID))
+}
+
 func (c *contentCacheImpl) CacheStorage() Storage {
 	return c.pc.cacheStorage
 }
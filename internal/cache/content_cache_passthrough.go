@@ -23,6 +23,8 @@ func (c passthroughContentCache) PrefetchBlob(ctx context.Context, blobID blob.I
 	return nil
 }
 
+func (c passthroughContentCache) Evict(ctx context.Context, contentID string, blobID blob.ID) {}
+
 func (c passthroughContentCache) Sync(ctx context.Context, blobPrefix blob.ID) error {
 	return nil
 }
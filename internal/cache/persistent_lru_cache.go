@@ -187,6 +187,17 @@ func (c *PersistentCache) Put(ctx context.Context, key string, data gather.Bytes
 	}
 }
 
+// Remove removes the provided key from the cache.
+func (c *PersistentCache) Remove(ctx context.Context, key string) {
+	if c == nil {
+		return
+	}
+
+	if err := c.cacheStorage.DeleteBlob(ctx, blob.ID(key)); err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+		log(ctx).Errorf("unable to delete %v entry %v: %v", c.description, key, err)
+	}
+}
+
 // Close closes the instance of persistent cache possibly waiting for at least one sweep to complete.
 func (c *PersistentCache) Close(ctx context.Context) {
 	if c == nil {
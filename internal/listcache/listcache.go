@@ -13,12 +13,16 @@
 	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/gather"
 	"github.com/kopia/kopia/internal/hmac"
+	"github.com/kopia/kopia/internal/retry"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/logging"
 )
 
 var log = logging.Module("listcache")
 
+// DefaultRefreshAttempts is the default number of attempts made to list blobs when refreshing the cache.
+const DefaultRefreshAttempts = 5
+
 type listCacheStorage struct {
 	blob.Storage
 	cacheStorage  blob.Storage
@@ -139,6 +143,70 @@ func (s *listCacheStorage) DeleteBlob(ctx context.Context, blobID blob.ID) error
 	return err
 }
 
+// RefreshOptions provides options for Refresh.
+type RefreshOptions struct {
+	// Prefixes limits refresh to cached lists whose prefix starts with one of the provided values.
+	// When empty, all cached lists are refreshed.
+	Prefixes []blob.ID
+
+	// MaxAttempts is the maximum number of attempts to list each prefix, DefaultRefreshAttempts if zero.
+	MaxAttempts int
+}
+
+// Refresh re-lists blobs in the underlying storage and replaces cached lists matching the provided
+// prefixes, retrying transient failures with exponential backoff.
+//
+// The provided storage must be the one returned by NewWrapper, which doesn't cache anything when
+// it has no cache storage, in which case there is nothing to refresh.
+func Refresh(ctx context.Context, st blob.Storage, opt RefreshOptions) error {
+	s, ok := st.(*listCacheStorage)
+	if !ok {
+		return nil
+	}
+
+	maxAttempts := opt.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = DefaultRefreshAttempts
+	}
+
+	for _, p := range s.prefixes {
+		if !hasAnyPrefix(p, opt.Prefixes) {
+			continue
+		}
+
+		v, err := retry.WithExponentialBackoffMaxRetries(ctx, maxAttempts, "refresh list cache "+string(p), func() (interface{}, error) {
+			//nolint:wrapcheck
+			return blob.ListAllBlobs(ctx, s.Storage, p)
+		}, retry.Always)
+		if err != nil {
+			return errors.Wrapf(err, "unable to refresh cached list of blobs with prefix %q", p)
+		}
+
+		all, _ := v.([]blob.Metadata)
+
+		s.saveListToCache(ctx, p, &cachedList{
+			ExpireAfter: s.cacheTimeFunc().Add(s.cacheDuration),
+			Blobs:       all,
+		})
+	}
+
+	return nil
+}
+
+func hasAnyPrefix(id blob.ID, prefixes []blob.ID) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+
+	for _, p := range prefixes {
+		if strings.HasPrefix(string(id), string(p)) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (s *listCacheStorage) isCachedPrefix(prefix blob.ID) bool {
 	for _, p := range s.prefixes {
 		if prefix == p {
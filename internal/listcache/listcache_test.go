@@ -90,3 +90,58 @@ func TestListCache(t *testing.T) {
 		return errFake
 	}), errFake)
 }
+
+func TestListCacheRefresh(t *testing.T) {
+	realStorage := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+	faulty := blobtesting.NewFaultyStorage(realStorage)
+	cacheTime := faketime.NewTimeAdvance(time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC), 0)
+	cachest := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, cacheTime.NowFunc())
+
+	lc := NewWrapper(faulty, cachest, []blob.ID{"n", "m", "xe", "xb"}, []byte("hmac-secret"), 1*time.Hour).(*listCacheStorage)
+	lc.cacheTimeFunc = cacheTime.NowFunc()
+
+	ctx := testlogging.Context(t)
+
+	// populate cached lists.
+	for _, p := range []blob.ID{"n", "m", "xe", "xb"} {
+		blobtesting.AssertListResultsIDs(ctx, t, lc, p)
+	}
+
+	// modify underlying storage without going through cache layer
+	for _, id := range []blob.ID{"n1", "m1", "xe1", "xb1"} {
+		require.NoError(t, realStorage.PutBlob(ctx, id, gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+	}
+
+	// listing fails twice, then succeeds.
+	faulty.AddFault(blobtesting.MethodListBlobs).ErrorInstead(errFake).Repeat(1)
+
+	require.NoError(t, Refresh(ctx, lc, RefreshOptions{Prefixes: []blob.ID{"n"}}))
+	faulty.VerifyAllFaultsExercised(t)
+
+	blobtesting.AssertListResultsIDs(ctx, t, lc, "n", "n1")
+
+	// other prefixes were not refreshed.
+	blobtesting.AssertListResultsIDs(ctx, t, lc, "m")
+	blobtesting.AssertListResultsIDs(ctx, t, lc, "xe")
+	blobtesting.AssertListResultsIDs(ctx, t, lc, "xb")
+
+	// refresh of prefixes covering multiple cached lists.
+	require.NoError(t, Refresh(ctx, lc, RefreshOptions{Prefixes: []blob.ID{"m", "x"}}))
+	blobtesting.AssertListResultsIDs(ctx, t, lc, "m", "m1")
+	blobtesting.AssertListResultsIDs(ctx, t, lc, "xe", "xe1")
+	blobtesting.AssertListResultsIDs(ctx, t, lc, "xb", "xb1")
+
+	// persistent failure.
+	require.NoError(t, realStorage.PutBlob(ctx, "n2", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+	faulty.AddFault(blobtesting.MethodListBlobs).ErrorInstead(errFake).Repeat(2)
+
+	err := Refresh(ctx, lc, RefreshOptions{Prefixes: []blob.ID{"n"}, MaxAttempts: 3})
+	require.ErrorIs(t, err, errFake)
+	require.Contains(t, err.Error(), `unable to refresh cached list of blobs with prefix "n"`)
+
+	// previously cached list is still served.
+	blobtesting.AssertListResultsIDs(ctx, t, lc, "n", "n1")
+
+	// storage without list cache has nothing to refresh.
+	require.NoError(t, Refresh(ctx, NewWrapper(realStorage, nil, []blob.ID{"n"}, nil, time.Hour), RefreshOptions{}))
+}
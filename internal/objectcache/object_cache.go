@@ -0,0 +1,733 @@
+// Package objectcache implements on-disk cache of fully assembled objects, which allows large objects
+// that are read repeatedly to be served locally instead of being reassembled from their contents.
+package objectcache
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/ospath"
+	"github.com/kopia/kopia/repo/logging"
+	"github.com/kopia/kopia/repo/object"
+)
+
+var log = logging.Module("objectcache")
+
+const (
+	entrySuffix = ".obj"
+	tempSuffix  = ".tmp"
+
+	// defaultChunkSize is the size of chunks of cached data, each of which is verified independently.
+	defaultChunkSize = 1 << 20
+
+	// chunkChecksumLength is the length of HMAC-SHA256 stored for each chunk.
+	chunkChecksumLength = sha256.Size
+
+	// trailerLength is the length of the object length stored at the end of each entry.
+	trailerLength = 8
+
+	// temporary files older than this are left over from interrupted fills and are removed by the sweep.
+	staleTempFileAge = 1 * time.Hour
+
+	dirMode = 0o700
+)
+
+// Cache stores assembled objects as files in a local directory.
+//
+// Each file holds the object data, followed by HMAC-SHA256 of each chunk of the data and the length of the data.
+// Chunks are verified independently when they are first read, so that reads don't wait for the entire file
+// to be verified. Least recently used entries are removed when the total size exceeds the limit.
+type Cache struct {
+	dir          string
+	maxSizeBytes int64
+	hmacSecret   []byte
+	chunkSize    int64
+
+	sweepMutex sync.Mutex
+
+	fillMutex sync.Mutex
+	// +checklocks:fillMutex
+	filling map[string]bool
+}
+
+// Open returns a reader for the cached copy of the object with the provided key. When the entry is missing
+// or invalid, the object is opened using the provided function and returned directly. The data read from it
+// sequentially is copied to a new entry, which is added to the cache when the reader is closed after reading
+// the entire object. When a chunk of the cached copy fails verification during reads, the reader continues
+// reading the object opened using the provided function.
+// Objects larger than the cache are never cached.
+func (c *Cache) Open(ctx context.Context, key string, open func(ctx context.Context) (object.Reader, error)) (object.Reader, error) {
+	fname := c.entryPath(key)
+
+	r, err := c.openEntry(ctx, key, fname, open)
+	if err == nil {
+		return r, nil
+	}
+
+	if !os.IsNotExist(err) {
+		log(ctx).Debugf("invalid object cache entry for %v: %v", key, err)
+
+		c.removeEntry(ctx, key, fname)
+	}
+
+	src, err := open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.entrySize(src.Length()) > c.maxSizeBytes || !c.startFill(key) {
+		return src, nil
+	}
+
+	w, err := c.newEntryWriter(key, src.Length())
+	if err != nil {
+		// the cache is optional, the object will be read directly.
+		log(ctx).Errorf("unable to add %v to object cache: %v", key, err)
+		c.endFill(key)
+
+		return src, nil
+	}
+
+	fr := &fillingReader{
+		ctx:   ctx,
+		c:     c,
+		key:   key,
+		fname: fname,
+		src:   src,
+		w:     w,
+	}
+
+	if ra, ok := src.(io.ReaderAt); ok {
+		return fillingReaderAt{fr, ra}, nil
+	}
+
+	return fr, nil
+}
+
+func (c *Cache) entryPath(key string) string {
+	h := sha256.Sum256([]byte(key))
+
+	return filepath.Join(c.dir, hex.EncodeToString(h[:])+entrySuffix)
+}
+
+func (c *Cache) removeEntry(ctx context.Context, key, fname string) {
+	if err := os.Remove(fname); err != nil && !os.IsNotExist(err) {
+		log(ctx).Errorf("unable to remove object cache entry for %v: %v", key, err)
+	}
+}
+
+func (c *Cache) numChunks(length int64) int64 {
+	if length == 0 {
+		// empty objects have a single empty chunk.
+		return 1
+	}
+
+	return (length + c.chunkSize - 1) / c.chunkSize
+}
+
+// entrySize returns the size of the cache entry of an object of the provided length.
+func (c *Cache) entrySize(length int64) int64 {
+	return length + c.numChunks(length)*chunkChecksumLength + trailerLength
+}
+
+// chunkChecksum computes the checksum of a chunk, which binds it to the key, the object length and its position.
+func (c *Cache) chunkChecksum(key string, length, index int64, data []byte) []byte {
+	var buf [2 * trailerLength]byte
+
+	binary.BigEndian.PutUint64(buf[0:], uint64(length))
+	binary.BigEndian.PutUint64(buf[trailerLength:], uint64(index))
+
+	h := hmac.New(sha256.New, c.hmacSecret)
+	h.Write([]byte(key)) //nolint:errcheck
+	h.Write(buf[:])      //nolint:errcheck
+	h.Write(data)        //nolint:errcheck
+
+	return h.Sum(nil)
+}
+
+// openEntry opens the entry and marks it as recently used. The entry is only checked for consistency,
+// its chunks are verified as they are read.
+func (c *Cache) openEntry(ctx context.Context, key, fname string, open func(ctx context.Context) (object.Reader, error)) (object.Reader, error) {
+	f, err := os.Open(fname) //nolint:gosec
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	r, err := c.newEntryReader(ctx, key, fname, f, open)
+	if err != nil {
+		f.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	now := clock.Now()
+
+	// the modification time determines the order in which entries are evicted.
+	if err := os.Chtimes(fname, now, now); err != nil {
+		f.Close() //nolint:errcheck
+		return nil, errors.Wrap(err, "unable to touch cache entry")
+	}
+
+	return r, nil
+}
+
+func (c *Cache) newEntryReader(ctx context.Context, key, fname string, f *os.File, open func(ctx context.Context) (object.Reader, error)) (*entryReader, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to stat cache entry")
+	}
+
+	if fi.Size() < trailerLength {
+		return nil, errors.Errorf("cache entry too short")
+	}
+
+	var trailer [trailerLength]byte
+
+	if _, err := f.ReadAt(trailer[:], fi.Size()-trailerLength); err != nil {
+		return nil, errors.Wrap(err, "unable to read cache entry trailer")
+	}
+
+	length := int64(binary.BigEndian.Uint64(trailer[:]))
+	if length < 0 || length > fi.Size() || c.entrySize(length) != fi.Size() {
+		return nil, errors.Errorf("invalid cache entry length")
+	}
+
+	checksums := make([]byte, c.numChunks(length)*chunkChecksumLength)
+
+	if _, err := f.ReadAt(checksums, length); err != nil {
+		return nil, errors.Wrap(err, "unable to read cache entry checksums")
+	}
+
+	return &entryReader{
+		ctx:        ctx,
+		c:          c,
+		key:        key,
+		fname:      fname,
+		open:       open,
+		f:          f,
+		length:     length,
+		checksums:  checksums,
+		chunkIndex: -1,
+	}, nil
+}
+
+// startFill marks the object as being added to the cache and returns false if it's already being added.
+func (c *Cache) startFill(key string) bool {
+	c.fillMutex.Lock()
+	defer c.fillMutex.Unlock()
+
+	if c.filling[key] {
+		return false
+	}
+
+	c.filling[key] = true
+
+	return true
+}
+
+func (c *Cache) endFill(key string) {
+	c.fillMutex.Lock()
+	defer c.fillMutex.Unlock()
+
+	delete(c.filling, key)
+}
+
+// entryWriter writes a new cache entry to a temporary file, computing checksums of chunks as they are completed.
+type entryWriter struct {
+	c      *Cache
+	key    string
+	length int64
+	f      *os.File
+
+	written    int64
+	chunk      []byte // data of the current chunk, which has not been written yet
+	chunkIndex int64
+	checksums  []byte
+}
+
+func (c *Cache) newEntryWriter(key string, length int64) (*entryWriter, error) {
+	f, err := os.CreateTemp(c.dir, "*"+tempSuffix)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create temporary file")
+	}
+
+	return &entryWriter{
+		c:      c,
+		key:    key,
+		length: length,
+		f:      f,
+	}, nil
+}
+
+func (w *entryWriter) Write(p []byte) (int, error) {
+	if w.written+int64(len(p)) > w.length {
+		return 0, errors.Errorf("object longer than expected")
+	}
+
+	for n := 0; n < len(p); {
+		m := int(w.c.chunkSize) - len(w.chunk)
+		if m > len(p)-n {
+			m = len(p) - n
+		}
+
+		w.chunk = append(w.chunk, p[n:n+m]...)
+		n += m
+
+		if int64(len(w.chunk)) == w.c.chunkSize {
+			if err := w.writeChunk(); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	w.written += int64(len(p))
+
+	return len(p), nil
+}
+
+func (w *entryWriter) writeChunk() error {
+	if _, err := w.f.Write(w.chunk); err != nil {
+		return errors.Wrap(err, "unable to write object data")
+	}
+
+	w.checksums = append(w.checksums, w.c.chunkChecksum(w.key, w.length, w.chunkIndex, w.chunk)...)
+	w.chunkIndex++
+	w.chunk = w.chunk[:0]
+
+	return nil
+}
+
+// commit writes the checksums and atomically moves the entry into place.
+func (w *entryWriter) commit(fname string) error {
+	err := w.finish()
+
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(w.f.Name(), fname)
+	}
+
+	if err != nil {
+		os.Remove(w.f.Name()) //nolint:errcheck
+		return errors.Wrap(err, "error writing cache entry")
+	}
+
+	return nil
+}
+
+func (w *entryWriter) finish() error {
+	if w.written != w.length {
+		return errors.Errorf("object shorter than expected")
+	}
+
+	// empty objects have a single empty chunk.
+	if len(w.chunk) > 0 || w.length == 0 {
+		if err := w.writeChunk(); err != nil {
+			return err
+		}
+	}
+
+	var trailer [trailerLength]byte
+
+	binary.BigEndian.PutUint64(trailer[:], uint64(w.length))
+
+	if _, err := w.f.Write(append(w.checksums, trailer[:]...)); err != nil {
+		return errors.Wrap(err, "unable to write checksums")
+	}
+
+	return nil
+}
+
+func (w *entryWriter) abort() {
+	w.f.Close()           //nolint:errcheck
+	os.Remove(w.f.Name()) //nolint:errcheck
+}
+
+// sweep removes least recently used entries until the total size of the cache fits within the limit.
+func (c *Cache) sweep(ctx context.Context) {
+	c.sweepMutex.Lock()
+	defer c.sweepMutex.Unlock()
+
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		log(ctx).Errorf("unable to list object cache: %v", err)
+		return
+	}
+
+	var (
+		entries   []os.FileInfo
+		totalSize int64
+	)
+
+	for _, de := range dirEntries {
+		fi, err := de.Info()
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case strings.HasSuffix(fi.Name(), entrySuffix):
+			entries = append(entries, fi)
+			totalSize += fi.Size()
+
+		case strings.HasSuffix(fi.Name(), tempSuffix) && clock.Now().Sub(fi.ModTime()) > staleTempFileAge:
+			os.Remove(filepath.Join(c.dir, fi.Name())) //nolint:errcheck
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().Before(entries[j].ModTime())
+	})
+
+	for _, fi := range entries {
+		if totalSize <= c.maxSizeBytes {
+			break
+		}
+
+		if err := os.Remove(filepath.Join(c.dir, fi.Name())); err != nil && !os.IsNotExist(err) {
+			log(ctx).Errorf("unable to evict object cache entry %v: %v", fi.Name(), err)
+			continue
+		}
+
+		totalSize -= fi.Size()
+	}
+}
+
+// fillingReader reads the object directly and copies the data read sequentially from the start to a new
+// cache entry, which is added to the cache when the reader is closed after reading the entire object.
+// Seeking to another position abandons the entry, so objects that are only partially read are not cached.
+type fillingReader struct {
+	ctx   context.Context //nolint:containedctx
+	c     *Cache
+	key   string
+	fname string
+	src   object.Reader
+
+	mu sync.Mutex
+	// +checklocks:mu
+	pos int64
+	// +checklocks:mu
+	w *entryWriter // nil when the entry has been abandoned
+}
+
+func (r *fillingReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n, err := r.src.Read(p)
+	r.pos += int64(n)
+
+	if r.w != nil && n > 0 {
+		if _, werr := r.w.Write(p[:n]); werr != nil {
+			log(r.ctx).Errorf("unable to add %v to object cache: %v", r.key, werr)
+			r.abandonLocked()
+		}
+	}
+
+	//nolint:wrapcheck
+	return n, err
+}
+
+func (r *fillingReader) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pos, err := r.src.Seek(offset, whence)
+	if err != nil {
+		//nolint:wrapcheck
+		return pos, err
+	}
+
+	if pos != r.pos {
+		r.abandonLocked()
+	}
+
+	r.pos = pos
+
+	return pos, nil
+}
+
+// +checklocks:r.mu
+func (r *fillingReader) abandonLocked() {
+	if r.w == nil {
+		return
+	}
+
+	r.w.abort()
+	r.w = nil
+	r.c.endFill(r.key)
+}
+
+func (r *fillingReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.w != nil {
+		if r.w.written == r.w.length {
+			if err := r.w.commit(r.fname); err != nil {
+				// the cache is optional, the object will be read directly next time.
+				log(r.ctx).Errorf("unable to add %v to object cache: %v", r.key, err)
+			} else {
+				r.c.sweep(r.ctx)
+			}
+
+			r.w = nil
+			r.c.endFill(r.key)
+		} else {
+			r.abandonLocked()
+		}
+	}
+
+	//nolint:wrapcheck
+	return r.src.Close()
+}
+
+func (r *fillingReader) Length() int64 {
+	return r.src.Length()
+}
+
+// fillingReaderAt is a fillingReader of an object which supports random access reads.
+// Reads at arbitrary offsets don't change the position, so they don't affect the entry.
+type fillingReaderAt struct {
+	*fillingReader
+	ra io.ReaderAt
+}
+
+func (r fillingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	//nolint:wrapcheck
+	return r.ra.ReadAt(p, off)
+}
+
+// entryReader reads object data from a cache entry file, verifying each chunk before it's used.
+// When a chunk fails verification, the entry is removed and the reader continues reading
+// the object opened directly.
+type entryReader struct {
+	ctx   context.Context //nolint:containedctx
+	c     *Cache
+	key   string
+	fname string
+	open  func(ctx context.Context) (object.Reader, error)
+
+	f         *os.File
+	length    int64
+	checksums []byte
+
+	mu sync.Mutex
+	// +checklocks:mu
+	pos int64
+	// +checklocks:mu
+	chunkIndex int64 // index of the verified chunk in chunkData or -1
+	// +checklocks:mu
+	chunkData []byte
+	// +checklocks:mu
+	fallback object.Reader
+}
+
+func (r *entryReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n, err := r.readAtLocked(p, r.pos)
+	r.pos += int64(n)
+
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
+
+	return n, err
+}
+
+func (r *entryReader) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.readAtLocked(p, off)
+}
+
+// +checklocks:r.mu
+func (r *entryReader) readAtLocked(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.Errorf("invalid offset %v", off)
+	}
+
+	if r.fallback != nil {
+		return r.readFallbackLocked(p, off)
+	}
+
+	n := 0
+
+	for n < len(p) && off+int64(n) < r.length {
+		pos := off + int64(n)
+		index := pos / r.c.chunkSize
+
+		if err := r.loadChunkLocked(index); err != nil {
+			log(r.ctx).Debugf("invalid object cache entry for %v: %v", r.key, err)
+
+			if err := r.switchToFallbackLocked(); err != nil {
+				return n, err
+			}
+
+			m, err := r.readFallbackLocked(p[n:], pos)
+
+			return n + m, err
+		}
+
+		n += copy(p[n:], r.chunkData[pos-index*r.c.chunkSize:])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// loadChunkLocked reads the chunk with the provided index into chunkData and verifies its checksum.
+// +checklocks:r.mu
+func (r *entryReader) loadChunkLocked(index int64) error {
+	if r.chunkIndex == index {
+		return nil
+	}
+
+	r.chunkIndex = -1
+
+	n := r.c.chunkSize
+	if remaining := r.length - index*r.c.chunkSize; remaining < n {
+		n = remaining
+	}
+
+	if int64(cap(r.chunkData)) < n {
+		r.chunkData = make([]byte, n)
+	}
+
+	r.chunkData = r.chunkData[:n]
+
+	if _, err := r.f.ReadAt(r.chunkData, index*r.c.chunkSize); err != nil {
+		return errors.Wrap(err, "unable to read cache entry")
+	}
+
+	stored := r.checksums[index*chunkChecksumLength : (index+1)*chunkChecksumLength]
+
+	if !hmac.Equal(r.c.chunkChecksum(r.key, r.length, index, r.chunkData), stored) {
+		return errors.Errorf("cache entry checksum mismatch in chunk %v", index)
+	}
+
+	r.chunkIndex = index
+
+	return nil
+}
+
+// switchToFallbackLocked removes the invalid entry and opens the object directly.
+// The entry is added again by the next Open() which reads the entire object.
+// +checklocks:r.mu
+func (r *entryReader) switchToFallbackLocked() error {
+	r.c.removeEntry(r.ctx, r.key, r.fname)
+
+	src, err := r.open(r.ctx)
+	if err != nil {
+		return err
+	}
+
+	r.fallback = src
+
+	return nil
+}
+
+// +checklocks:r.mu
+func (r *entryReader) readFallbackLocked(p []byte, off int64) (int, error) {
+	if ra, ok := r.fallback.(io.ReaderAt); ok {
+		//nolint:wrapcheck
+		return ra.ReadAt(p, off)
+	}
+
+	if _, err := r.fallback.Seek(off, io.SeekStart); err != nil {
+		return 0, errors.Wrap(err, "unable to seek")
+	}
+
+	n, err := io.ReadFull(r.fallback, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+
+	//nolint:wrapcheck
+	return n, err
+}
+
+func (r *entryReader) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.length
+	default:
+		return 0, errors.Errorf("invalid whence %v", whence)
+	}
+
+	if offset < 0 {
+		return 0, errors.Errorf("invalid seek %v", offset)
+	}
+
+	r.pos = offset
+
+	return offset, nil
+}
+
+func (r *entryReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.fallback != nil {
+		r.fallback.Close() //nolint:errcheck
+	}
+
+	//nolint:wrapcheck
+	return r.f.Close()
+}
+
+func (r *entryReader) Length() int64 {
+	return r.length
+}
+
+// NewOrNil returns a cache in the provided subdirectory of the cache directory or nil if the cache directory
+// is not set or the size is zero.
+func NewOrNil(cacheDir string, maxSizeBytes int64, subdir string, hmacSecret []byte) (*Cache, error) {
+	if cacheDir == "" || maxSizeBytes <= 0 {
+		return nil, nil
+	}
+
+	if !ospath.IsAbs(cacheDir) {
+		return nil, errors.Errorf("cache dir %q was not absolute", cacheDir)
+	}
+
+	dir := filepath.Join(cacheDir, subdir)
+
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return nil, errors.Wrap(err, "unable to create object cache directory")
+	}
+
+	return &Cache{
+		dir:          dir,
+		maxSizeBytes: maxSizeBytes,
+		hmacSecret:   hmacSecret,
+		chunkSize:    defaultChunkSize,
+		filling:      map[string]bool{},
+	}, nil
+}
@@ -0,0 +1,319 @@
+package objectcache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/object"
+)
+
+type bytesObjectReader struct {
+	*bytes.Reader
+}
+
+func (r bytesObjectReader) Close() error  { return nil }
+func (r bytesObjectReader) Length() int64 { return r.Size() }
+
+// countingOpener returns a function opening the provided data, which counts its invocations.
+func countingOpener(data []byte, count *int) func(ctx context.Context) (object.Reader, error) {
+	return func(ctx context.Context) (object.Reader, error) {
+		*count++
+
+		return bytesObjectReader{bytes.NewReader(data)}, nil
+	}
+}
+
+func mustReadAll(t *testing.T, r object.Reader) []byte {
+	t.Helper()
+
+	defer r.Close()
+
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	return b
+}
+
+func newTestCache(t *testing.T, maxSizeBytes int64) *Cache {
+	t.Helper()
+
+	c, err := NewOrNil(testutil.TempDirectory(t), maxSizeBytes, "objects", []byte("secret"))
+	require.NoError(t, err)
+	require.NotNil(t, c)
+
+	return c
+}
+
+func TestCacheHit(t *testing.T) {
+	ctx := testlogging.Context(t)
+	c := newTestCache(t, 1e6)
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	var opens int
+
+	// the first open reads the object directly and copies it to the cache.
+	require.Equal(t, data, openAndRead(ctx, t, c, "key1", data, &opens))
+	require.Equal(t, 1, opens)
+
+	// second open is served from the cache.
+	r, err := c.Open(ctx, "key1", countingOpener(data, &opens))
+	require.NoError(t, err)
+	require.Equal(t, 1, opens)
+	require.Equal(t, int64(len(data)), r.Length())
+
+	buf := make([]byte, 10)
+	n, err := r.(object.ReaderAt).ReadAt(buf, 5)
+	require.NoError(t, err)
+	require.Equal(t, data[5:5+n], buf)
+
+	_, err = r.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	require.Equal(t, data, mustReadAll(t, r))
+}
+
+func TestCorruptEntryFallsThrough(t *testing.T) {
+	ctx := testlogging.Context(t)
+	c := newTestCache(t, 1e6)
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	var opens int
+
+	openAndRead(ctx, t, c, "key1", data, &opens)
+
+	// flip a byte in the middle of the cached data.
+	fname := c.entryPath("key1")
+	b, err := os.ReadFile(fname)
+	require.NoError(t, err)
+
+	b[len(b)/2] ^= 1
+	require.NoError(t, os.WriteFile(fname, b, 0o600))
+
+	// the corrupt entry is detected while reading, removed and the object is read directly.
+	require.Equal(t, data, openAndRead(ctx, t, c, "key1", data, &opens))
+	require.Equal(t, 2, opens)
+	require.NoFileExists(t, fname)
+
+	// the next read adds the entry again.
+	require.Equal(t, data, openAndRead(ctx, t, c, "key1", data, &opens))
+	require.Equal(t, data, openAndRead(ctx, t, c, "key1", data, &opens))
+	require.Equal(t, 3, opens)
+
+	// a truncated entry is rejected when opening.
+	require.NoError(t, os.WriteFile(fname, []byte{1, 2, 3}, 0o600))
+	require.Equal(t, data, openAndRead(ctx, t, c, "key1", data, &opens))
+	require.Equal(t, 4, opens)
+}
+
+func TestChunksVerifiedIndependently(t *testing.T) {
+	ctx := testlogging.Context(t)
+	c := newTestCache(t, 1e6)
+	c.chunkSize = 100
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	var opens int
+
+	openAndRead(ctx, t, c, "key1", data, &opens)
+	require.Equal(t, 1, opens)
+
+	// corrupt the 6th chunk.
+	fname := c.entryPath("key1")
+	b, err := os.ReadFile(fname)
+	require.NoError(t, err)
+
+	b[550] ^= 1
+	require.NoError(t, os.WriteFile(fname, b, 0o600))
+
+	r, err := c.Open(ctx, "key1", countingOpener(data, &opens))
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	ra := r.(object.ReaderAt)
+	buf := make([]byte, 150)
+
+	// valid chunks are served from the cache.
+	_, err = ra.ReadAt(buf, 20)
+	require.NoError(t, err)
+	require.Equal(t, data[20:170], buf)
+	require.Equal(t, 1, opens)
+
+	// reading the corrupt chunk switches to the object itself.
+	_, err = ra.ReadAt(buf, 480)
+	require.NoError(t, err)
+	require.Equal(t, data[480:630], buf)
+	require.Equal(t, 2, opens)
+	require.NoFileExists(t, fname)
+
+	_, err = r.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	require.Equal(t, data, mustReadAll(t, r))
+}
+
+func TestFillCopiesSequentialReads(t *testing.T) {
+	ctx := testlogging.Context(t)
+	c := newTestCache(t, 1e6)
+	c.chunkSize = 100
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	var opens int
+
+	r, err := c.Open(ctx, "key1", countingOpener(data, &opens))
+	require.NoError(t, err)
+
+	// the entry is added when the reader is closed.
+	require.Equal(t, data, mustReadAll(t, r))
+	require.Equal(t, 1, opens)
+	require.FileExists(t, c.entryPath("key1"))
+
+	// reads at arbitrary offsets don't affect the entry.
+	r, err = c.Open(ctx, "key2", countingOpener(data, &opens))
+	require.NoError(t, err)
+
+	buf := make([]byte, 50)
+	_, err = r.(object.ReaderAt).ReadAt(buf, 5000)
+	require.NoError(t, err)
+	require.Equal(t, data[5000:5050], buf)
+	require.Equal(t, data, mustReadAll(t, r))
+	require.Equal(t, 2, opens)
+
+	require.Equal(t, data, openAndRead(ctx, t, c, "key2", data, &opens))
+	require.Equal(t, 2, opens)
+
+	// empty objects are cached too.
+	require.Empty(t, openAndRead(ctx, t, c, "empty", nil, &opens))
+	require.Empty(t, openAndRead(ctx, t, c, "empty", nil, &opens))
+	require.Equal(t, 3, opens)
+}
+
+func TestPartialReadIsNotCached(t *testing.T) {
+	ctx := testlogging.Context(t)
+	c := newTestCache(t, 1e6)
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	var opens int
+
+	// closing before reaching the end.
+	r, err := c.Open(ctx, "key1", countingOpener(data, &opens))
+	require.NoError(t, err)
+
+	buf := make([]byte, 100)
+	_, err = io.ReadFull(r, buf)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	// seeking before reaching the end.
+	r, err = c.Open(ctx, "key1", countingOpener(data, &opens))
+	require.NoError(t, err)
+
+	_, err = r.Seek(5000, io.SeekStart)
+	require.NoError(t, err)
+	require.Equal(t, data[5000:], mustReadAll(t, r))
+
+	entries, err := os.ReadDir(c.dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	// the entry is added by the first complete read.
+	require.Equal(t, data, openAndRead(ctx, t, c, "key1", data, &opens))
+	require.Equal(t, data, openAndRead(ctx, t, c, "key1", data, &opens))
+	require.Equal(t, 3, opens)
+}
+
+func TestEntryBoundToKey(t *testing.T) {
+	ctx := testlogging.Context(t)
+	c := newTestCache(t, 1e6)
+
+	var opens int
+
+	openAndRead(ctx, t, c, "key1", []byte("data1"), &opens)
+
+	// a valid entry moved to another key does not verify.
+	require.NoError(t, os.Rename(c.entryPath("key1"), c.entryPath("key2")))
+	require.Equal(t, []byte("data2"), openAndRead(ctx, t, c, "key2", []byte("data2"), &opens))
+	require.Equal(t, 2, opens)
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	const entrySize = 1000
+
+	c := newTestCache(t, 2*(entrySize+chunkChecksumLength+trailerLength))
+
+	var opensA, opensB, opensC int
+
+	dataA := bytes.Repeat([]byte{'a'}, entrySize)
+	dataB := bytes.Repeat([]byte{'b'}, entrySize)
+	dataC := bytes.Repeat([]byte{'c'}, entrySize)
+
+	openAndRead(ctx, t, c, "a", dataA, &opensA)
+	openAndRead(ctx, t, c, "b", dataB, &opensB)
+
+	now := time.Now()
+	require.NoError(t, os.Chtimes(c.entryPath("a"), now.Add(-2*time.Hour), now.Add(-2*time.Hour)))
+	require.NoError(t, os.Chtimes(c.entryPath("b"), now.Add(-1*time.Hour), now.Add(-1*time.Hour)))
+
+	// using 'a' makes 'b' the least recently used entry.
+	openAndRead(ctx, t, c, "a", dataA, &opensA)
+	openAndRead(ctx, t, c, "c", dataC, &opensC)
+
+	require.FileExists(t, c.entryPath("a"))
+	require.NoFileExists(t, c.entryPath("b"))
+	require.FileExists(t, c.entryPath("c"))
+
+	openAndRead(ctx, t, c, "a", dataA, &opensA)
+	require.Equal(t, 1, opensA)
+}
+
+func TestObjectLargerThanCacheIsNotCached(t *testing.T) {
+	ctx := testlogging.Context(t)
+	c := newTestCache(t, 100)
+
+	data := bytes.Repeat([]byte{1}, 200)
+
+	var opens int
+
+	require.Equal(t, data, openAndRead(ctx, t, c, "key1", data, &opens))
+	require.Equal(t, data, openAndRead(ctx, t, c, "key1", data, &opens))
+	require.Equal(t, 2, opens)
+
+	entries, err := os.ReadDir(c.dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestNewOrNil(t *testing.T) {
+	c, err := NewOrNil("", 1e6, "objects", nil)
+	require.NoError(t, err)
+	require.Nil(t, c)
+
+	c, err = NewOrNil(testutil.TempDirectory(t), 0, "objects", nil)
+	require.NoError(t, err)
+	require.Nil(t, c)
+
+	_, err = NewOrNil("relative", 1e6, "objects", nil)
+	require.Error(t, err)
+}
+
+// openAndRead opens the object through the cache and returns its contents.
+func openAndRead(ctx context.Context, t *testing.T, c *Cache, key string, data []byte, count *int) []byte {
+	t.Helper()
+
+	r, err := c.Open(ctx, key, countingOpener(data, count))
+	require.NoError(t, err)
+
+	return mustReadAll(t, r)
+}
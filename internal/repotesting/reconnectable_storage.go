@@ -49,6 +49,15 @@ func NewReconnectableStorage(tb testing.TB, st blob.Storage) blob.Storage {
 //nolint:gochecknoglobals
 var reconnectableStorageByUUID sync.Map
 
+func (s reconnectableStorage) Sync(ctx context.Context) error {
+	//nolint:wrapcheck
+	return blob.Sync(ctx, s.Storage)
+}
+
+func (s reconnectableStorage) AlternateSources() []blob.Reader {
+	return blob.GetAlternateSources(s.Storage)
+}
+
 func (s reconnectableStorage) ConnectionInfo() blob.ConnectionInfo {
 	return blob.ConnectionInfo{
 		Type:   ReconnectableStorageType,
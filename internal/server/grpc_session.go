@@ -493,15 +493,23 @@ func (s *Server) handleInitialSessionHandshake(srv grpcapi.KopiaRepository_Sessi
 		return repo.WriteSessionOptions{}, errors.Wrap(err, "supports content compression")
 	}
 
+	params := &grpcapi.RepositoryParameters{
+		HashFunction:               dr.ContentReader().ContentFormat().GetHashFunction(),
+		HmacSecret:                 dr.ContentReader().ContentFormat().GetHmacSecret(),
+		Splitter:                   dr.ObjectFormat().Splitter,
+		SupportsContentCompression: scc,
+	}
+
+	if sp := dr.ObjectFormat().SplitterParameters; sp != nil {
+		params.SplitterMinSize = int32(sp.MinSize)
+		params.SplitterAvgSize = int32(sp.AvgSize)
+		params.SplitterMaxSize = int32(sp.MaxSize)
+	}
+
 	if err := s.send(srv, initializeReq.GetRequestId(), &grpcapi.SessionResponse{
 		Response: &grpcapi.SessionResponse_InitializeSession{
 			InitializeSession: &grpcapi.InitializeSessionResponse{
-				Parameters: &grpcapi.RepositoryParameters{
-					HashFunction:               dr.ContentReader().ContentFormat().GetHashFunction(),
-					HmacSecret:                 dr.ContentReader().ContentFormat().GetHmacSecret(),
-					Splitter:                   dr.ObjectFormat().Splitter,
-					SupportsContentCompression: scc,
-				},
+				Parameters: params,
 			},
 		},
 	}); err != nil {
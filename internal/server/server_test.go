@@ -337,6 +337,10 @@ func remoteRepositoryTest(ctx context.Context, t *testing.T, rep repo.Repository
 	mustGetManifestNotFound(ctx, t, rep, manifestID2)
 	mustListSnapshotCount(ctx, t, rep, 1)
 	mustPrefetchObjects(ctx, t, rep, result)
+
+	// signing manifests needs the repository key, which remote clients don't have.
+	_, err := repo.GetSignedManifest(ctx, rep, manifestID)
+	require.ErrorIs(t, err, repo.ErrManifestSigningNotSupported)
 }
 
 func mustWriteObject(ctx context.Context, t *testing.T, w repo.RepositoryWriter, data []byte) object.ID {
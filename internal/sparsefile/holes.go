@@ -0,0 +1,59 @@
+package sparsefile
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/iocopy"
+)
+
+// ErrUnsupported is returned when finding holes in files is not supported by the platform.
+var ErrUnsupported = errors.New("finding holes is not supported on this platform")
+
+// Hole describes a range of a sparse file that is not allocated on disk and reads as zeros.
+type Hole struct {
+	Offset int64
+	Length int64
+}
+
+// CopyWithHoles copies src to dst, skipping over the provided holes (sorted by offset) in dst, so that they
+// remain unallocated. Data within holes is still read from src and written to dst if it's not all zeros,
+// so that holes which no longer match the contents never cause data loss.
+// The caller is responsible for ensuring dst has the final size of the file, since a hole at the end
+// of the file is never written.
+func CopyWithHoles(dst io.WriteSeeker, src io.Reader, holes []Hole) (int64, error) {
+	buf := iocopy.GetBuffer()
+	defer iocopy.ReleaseBuffer(buf)
+
+	var written int64
+
+	for _, h := range holes {
+		if h.Offset > written {
+			n, err := io.CopyBuffer(dst, io.LimitReader(src, h.Offset-written), buf)
+			written += n
+
+			if err != nil {
+				return written, errors.Wrap(err, "copy error")
+			}
+
+			if written < h.Offset {
+				// source ended before the hole.
+				return written, nil
+			}
+		}
+
+		if end := h.Offset + h.Length; end > written {
+			n, err := copyBuffer(dst, io.LimitReader(src, end-written), buf)
+			written += n
+
+			if err != nil {
+				return written, errors.Wrap(err, "copy error")
+			}
+		}
+	}
+
+	n, err := io.CopyBuffer(dst, src, buf)
+
+	return written + n, errors.Wrap(err, "copy error")
+}
@@ -0,0 +1,74 @@
+package sparsefile
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// sectorSize is the unit of st_blocks.
+const sectorSize = 512
+
+// FindHoles returns the holes of the provided file, in order.
+// Files whose allocated size is not smaller than their length are assumed not to have any holes
+// without examining them further.
+func FindHoles(path string) ([]Hole, error) {
+	var st unix.Stat_t
+
+	if err := unix.Lstat(path, &st); err != nil {
+		return nil, errors.Wrap(err, "unable to stat file")
+	}
+
+	if st.Blocks*sectorSize >= st.Size {
+		return nil, nil
+	}
+
+	f, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open file")
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	fd := int(f.Fd())
+
+	var (
+		result []Hole
+		offset int64
+	)
+
+	for offset < st.Size {
+		holeStart, err := unix.Seek(fd, offset, unix.SEEK_HOLE)
+		if err != nil {
+			return nil, mapSeekError(err)
+		}
+
+		if holeStart >= st.Size {
+			break
+		}
+
+		holeEnd, err := unix.Seek(fd, holeStart, unix.SEEK_DATA)
+
+		switch {
+		case errors.Is(err, unix.ENXIO):
+			// no more data after the hole.
+			holeEnd = st.Size
+		case err != nil:
+			return nil, mapSeekError(err)
+		}
+
+		result = append(result, Hole{Offset: holeStart, Length: holeEnd - holeStart})
+		offset = holeEnd
+	}
+
+	return result, nil
+}
+
+func mapSeekError(err error) error {
+	if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EOPNOTSUPP) {
+		return ErrUnsupported
+	}
+
+	return errors.Wrap(err, "unable to seek")
+}
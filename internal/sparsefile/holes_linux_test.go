@@ -0,0 +1,56 @@
+package sparsefile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/stat"
+)
+
+func TestFindHoles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	blk, err := stat.GetBlockSize(dir)
+	require.NoError(t, err)
+
+	bs := int64(blk)
+
+	// [data][hole x 4][data][hole x 2]
+	fname := filepath.Join(dir, "sparse")
+
+	f, err := os.Create(fname)
+	require.NoError(t, err)
+
+	require.NoError(t, f.Truncate(8*bs))
+	_, err = f.WriteAt(bytes.Repeat([]byte{1}, int(bs)), 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt(bytes.Repeat([]byte{2}, int(bs)), 5*bs)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	holes, err := FindHoles(fname)
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip("finding holes is not supported by the filesystem")
+	}
+
+	require.NoError(t, err)
+	require.Equal(t, []Hole{
+		{Offset: bs, Length: 4 * bs},
+		{Offset: 6 * bs, Length: 2 * bs},
+	}, holes)
+
+	// non-sparse files have no holes.
+	fname2 := filepath.Join(dir, "dense")
+	require.NoError(t, os.WriteFile(fname2, bytes.Repeat([]byte{0}, int(4*bs)), 0o600))
+
+	holes, err = FindHoles(fname2)
+	require.NoError(t, err)
+	require.Empty(t, holes)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package sparsefile
+
+// FindHoles returns ErrUnsupported since finding holes is not supported on this platform.
+func FindHoles(path string) ([]Hole, error) {
+	return nil, ErrUnsupported
+}
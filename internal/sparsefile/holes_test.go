@@ -0,0 +1,80 @@
+package sparsefile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/stat"
+)
+
+func TestCopyWithHoles(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("sparse files are not supported on windows")
+	}
+
+	dir := t.TempDir()
+
+	blk, err := stat.GetBlockSize(dir)
+	require.NoError(t, err)
+
+	bs := int(blk)
+
+	// [data][zeros x 4][data][zeros x 2]
+	data := make([]byte, 8*bs)
+	copy(data, bytes.Repeat([]byte{1}, bs))
+	copy(data[5*bs:], bytes.Repeat([]byte{2}, bs))
+
+	cases := []struct {
+		name  string
+		data  []byte
+		holes []Hole
+		phys  uint64
+	}{
+		{
+			name:  "matching-holes",
+			data:  data,
+			holes: []Hole{{Offset: int64(bs), Length: int64(4 * bs)}, {Offset: int64(6 * bs), Length: int64(2 * bs)}},
+			phys:  uint64(2 * bs),
+		},
+		{
+			name: "no-holes",
+			data: data,
+			phys: uint64(8 * bs),
+		},
+		{
+			// contents no longer matching holes are still written.
+			name:  "stale-holes",
+			data:  bytes.Repeat([]byte{3}, 8*bs),
+			holes: []Hole{{Offset: int64(bs), Length: int64(4 * bs)}},
+			phys:  uint64(8 * bs),
+		},
+	}
+
+	for _, tc := range cases {
+		fname := filepath.Join(dir, tc.name)
+
+		f, err := os.Create(fname)
+		require.NoError(t, err)
+		require.NoError(t, f.Truncate(int64(len(tc.data))))
+
+		n, err := CopyWithHoles(f, bytes.NewReader(tc.data), tc.holes)
+		require.NoError(t, err)
+		require.Equal(t, int64(len(tc.data)), n)
+		require.NoError(t, f.Close())
+
+		got, err := os.ReadFile(fname)
+		require.NoError(t, err)
+		require.Equal(t, tc.data, got, tc.name)
+
+		phys, err := stat.GetFileAllocSize(fname)
+		require.NoError(t, err)
+		require.Equal(t, tc.phys, phys, tc.name)
+	}
+}
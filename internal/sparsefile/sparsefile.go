@@ -26,7 +26,7 @@ func copyBuffer(dst io.WriteSeeker, src io.Reader, buf []byte) (written int64, e
 		nr, er := src.Read(buf)
 		if nr > 0 { //nolint:nestif
 			// If non-zero data is read, write it. Otherwise, skip forwards.
-			if isAllZero(buf) {
+			if isAllZero(buf[0:nr]) {
 				dst.Seek(int64(nr), os.SEEK_CUR) //nolint:errcheck
 				written += int64(nr)
 
@@ -0,0 +1,292 @@
+// Package storagebench measures throughput and latency of blob storage operations.
+package storagebench
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/timetrack"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/logging"
+)
+
+// ReservedPrefix is the prefix of all blobs written by the benchmark, which is never used by repository data.
+const ReservedPrefix blob.ID = "zbench-"
+
+// Operation names used in the report.
+const (
+	OperationPut    = "put"
+	OperationGet    = "get"
+	OperationList   = "list"
+	OperationDelete = "delete"
+)
+
+// Options provides options for the storage benchmark.
+type Options struct {
+	BlockCount int  // number of blocks to write and read
+	BlockSize  int  // size of each block in bytes
+	ListCount  int  // number of times to list all blocks
+	Parallel   int  // number of parallel workers
+	Cleanup    bool // delete test blocks at the end of the benchmark
+}
+
+// DefaultOptions is the default set of options.
+//
+//nolint:gomnd,gochecknoglobals
+var DefaultOptions = Options{
+	BlockCount: 100,
+	BlockSize:  4 << 20,
+	ListCount:  10,
+	Parallel:   4,
+	Cleanup:    true,
+}
+
+// OperationStats describes throughput and latency of a single type of storage operation.
+type OperationStats struct {
+	Operation    string        `json:"operation"`
+	Count        int           `json:"count"`
+	Bytes        int64         `json:"bytes"`
+	Duration     time.Duration `json:"duration"`
+	BytesPerSec  float64       `json:"bytesPerSecond"`
+	OpsPerSecond float64       `json:"opsPerSecond"`
+	LatencyMin   time.Duration `json:"latencyMin"`
+	LatencyP50   time.Duration `json:"latencyP50"`
+	LatencyP90   time.Duration `json:"latencyP90"`
+	LatencyP99   time.Duration `json:"latencyP99"`
+	LatencyMax   time.Duration `json:"latencyMax"`
+}
+
+// Report contains results of the storage benchmark.
+type Report struct {
+	Prefix     blob.ID          `json:"prefix"`
+	Operations []OperationStats `json:"operations"`
+}
+
+var log = logging.Module("storagebench")
+
+// Run benchmarks put, get, list and delete operations against the provided storage. All blobs
+// are written under ReservedPrefix so that existing data is never affected.
+func Run(ctx context.Context, st blob.Storage, opt Options) (*Report, error) {
+	if opt.BlockCount <= 0 || opt.BlockSize <= 0 {
+		return nil, errors.Errorf("block count and size must be positive")
+	}
+
+	if opt.Parallel <= 0 {
+		opt.Parallel = 1
+	}
+
+	prefix := ReservedPrefix + blob.ID(uuid.NewString()) + "-"
+
+	blobIDs := make([]blob.ID, opt.BlockCount)
+	for i := range blobIDs {
+		blobIDs[i] = prefix + blob.ID(fmt.Sprintf("%08x", i))
+	}
+
+	data := make([]byte, opt.BlockSize)
+	if _, err := cryptorand.Read(data); err != nil {
+		return nil, errors.Wrap(err, "error generating random data")
+	}
+
+	report := &Report{Prefix: prefix}
+
+	log(ctx).Infof("Writing %v blocks of %v bytes...", opt.BlockCount, opt.BlockSize)
+
+	s, err := measure(ctx, OperationPut, opt.Parallel, blobIDs, func(id blob.ID) (int64, error) {
+		//nolint:wrapcheck
+		return int64(len(data)), st.PutBlob(ctx, id, gather.FromSlice(data), blob.PutOptions{})
+	})
+	if err != nil {
+		cleanup(ctx, st, prefix, opt)
+		return nil, err
+	}
+
+	report.Operations = append(report.Operations, s)
+
+	log(ctx).Infof("Reading %v blocks...", opt.BlockCount)
+
+	s, err = measure(ctx, OperationGet, opt.Parallel, blobIDs, func(id blob.ID) (int64, error) {
+		var tmp gather.WriteBuffer
+		defer tmp.Close()
+
+		if err := st.GetBlob(ctx, id, 0, -1, &tmp); err != nil {
+			return 0, errors.Wrapf(err, "error reading %v", id)
+		}
+
+		return int64(tmp.Length()), nil
+	})
+	if err != nil {
+		cleanup(ctx, st, prefix, opt)
+		return nil, err
+	}
+
+	report.Operations = append(report.Operations, s)
+
+	if opt.ListCount > 0 {
+		log(ctx).Infof("Listing blocks %v times...", opt.ListCount)
+
+		listIDs := make([]blob.ID, opt.ListCount)
+		for i := range listIDs {
+			listIDs[i] = prefix
+		}
+
+		s, err = measure(ctx, OperationList, 1, listIDs, func(id blob.ID) (int64, error) {
+			var n int
+
+			if err := st.ListBlobs(ctx, id, func(bm blob.Metadata) error {
+				n++
+				return nil
+			}); err != nil {
+				return 0, errors.Wrap(err, "error listing blobs")
+			}
+
+			if n != opt.BlockCount {
+				return 0, errors.Errorf("unexpected number of blobs listed: %v, wanted %v", n, opt.BlockCount)
+			}
+
+			return 0, nil
+		})
+		if err != nil {
+			cleanup(ctx, st, prefix, opt)
+			return nil, err
+		}
+
+		report.Operations = append(report.Operations, s)
+	}
+
+	if !opt.Cleanup {
+		log(ctx).Infof("Leaving test blocks with prefix %v in place.", prefix)
+		return report, nil
+	}
+
+	log(ctx).Infof("Deleting %v blocks...", opt.BlockCount)
+
+	s, err = measure(ctx, OperationDelete, opt.Parallel, blobIDs, func(id blob.ID) (int64, error) {
+		return 0, errors.Wrapf(st.DeleteBlob(ctx, id), "error deleting %v", id)
+	})
+	if err != nil {
+		cleanup(ctx, st, prefix, opt)
+		return nil, err
+	}
+
+	report.Operations = append(report.Operations, s)
+
+	return report, nil
+}
+
+// measure invokes the provided function for all IDs using the given number of workers and computes statistics.
+func measure(ctx context.Context, op string, parallel int, ids []blob.ID, run func(id blob.ID) (int64, error)) (OperationStats, error) {
+	var (
+		mu         sync.Mutex
+		latencies  []time.Duration
+		totalBytes int64
+	)
+
+	work := make(chan blob.ID)
+
+	eg, ctx := errgroup.WithContext(ctx)
+
+	eg.Go(func() error {
+		defer close(work)
+
+		for _, id := range ids {
+			select {
+			case work <- id:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		return nil
+	})
+
+	total := timetrack.StartTimer()
+
+	for i := 0; i < parallel; i++ {
+		eg.Go(func() error {
+			for id := range work {
+				t := timetrack.StartTimer()
+
+				n, err := run(id)
+				if err != nil {
+					return err
+				}
+
+				dur := t.Elapsed()
+
+				mu.Lock()
+				latencies = append(latencies, dur)
+				totalBytes += n
+				mu.Unlock()
+			}
+
+			return nil
+		})
+	}
+
+	if err := eg.Wait(); err != nil {
+		return OperationStats{}, errors.Wrapf(err, "%v failed", op)
+	}
+
+	return computeStats(op, latencies, totalBytes, total.Elapsed()), nil
+}
+
+func computeStats(op string, latencies []time.Duration, totalBytes int64, elapsed time.Duration) OperationStats {
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+
+	s := OperationStats{
+		Operation: op,
+		Count:     len(latencies),
+		Bytes:     totalBytes,
+		Duration:  elapsed,
+	}
+
+	if len(latencies) == 0 {
+		return s
+	}
+
+	if secs := elapsed.Seconds(); secs > 0 {
+		s.BytesPerSec = float64(totalBytes) / secs
+		s.OpsPerSecond = float64(len(latencies)) / secs
+	}
+
+	s.LatencyMin = latencies[0]
+	s.LatencyP50 = percentile(latencies, 50) //nolint:gomnd
+	s.LatencyP90 = percentile(latencies, 90) //nolint:gomnd
+	s.LatencyP99 = percentile(latencies, 99) //nolint:gomnd
+	s.LatencyMax = latencies[len(latencies)-1]
+
+	return s
+}
+
+// percentile returns the given percentile of sorted latencies using the nearest-rank method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100 //nolint:gomnd
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+func cleanup(ctx context.Context, st blob.Storage, prefix blob.ID, opt Options) {
+	if !opt.Cleanup {
+		return
+	}
+
+	if err := st.ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+		return errors.Wrapf(st.DeleteBlob(ctx, bm.BlobID), "error deleting blob %v", bm.BlobID)
+	}); err != nil {
+		log(ctx).Errorf("error cleaning up test blocks: %v", err)
+	}
+}
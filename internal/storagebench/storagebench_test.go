@@ -0,0 +1,79 @@
+package storagebench_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/storagebench"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestStorageBenchmark(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{
+		"existing": []byte{1, 2, 3},
+	}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	opt := storagebench.Options{
+		BlockCount: 20,
+		BlockSize:  1000,
+		ListCount:  3,
+		Parallel:   3,
+		Cleanup:    true,
+	}
+
+	rep, err := storagebench.Run(ctx, st, opt)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(rep.Prefix), string(storagebench.ReservedPrefix)))
+
+	var ops []string
+
+	for _, s := range rep.Operations {
+		ops = append(ops, s.Operation)
+
+		require.NotZero(t, s.Count, s.Operation)
+		require.NotZero(t, s.LatencyMax, s.Operation)
+		require.LessOrEqual(t, s.LatencyMin, s.LatencyP50)
+		require.LessOrEqual(t, s.LatencyP50, s.LatencyP90)
+		require.LessOrEqual(t, s.LatencyP90, s.LatencyP99)
+		require.LessOrEqual(t, s.LatencyP99, s.LatencyMax)
+	}
+
+	require.Equal(t, []string{
+		storagebench.OperationPut,
+		storagebench.OperationGet,
+		storagebench.OperationList,
+		storagebench.OperationDelete,
+	}, ops)
+
+	require.EqualValues(t, 20000, rep.Operations[0].Bytes)
+	require.EqualValues(t, 20000, rep.Operations[1].Bytes)
+	require.Equal(t, 3, rep.Operations[2].Count)
+
+	// all test blocks were removed, other data was not touched.
+	require.Equal(t, blobtesting.DataMap{"existing": []byte{1, 2, 3}}, data)
+
+	// without cleanup the test blocks remain in storage.
+	opt.Cleanup = false
+
+	rep, err = storagebench.Run(ctx, st, opt)
+	require.NoError(t, err)
+	require.Len(t, rep.Operations, 3)
+
+	remaining, err := blob.ListAllBlobs(ctx, st, rep.Prefix)
+	require.NoError(t, err)
+	require.Len(t, remaining, opt.BlockCount)
+}
+
+func TestStorageBenchmarkInvalidOptions(t *testing.T) {
+	ctx := testlogging.Context(t)
+	st := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+
+	_, err := storagebench.Run(ctx, st, storagebench.Options{BlockCount: 0, BlockSize: 100})
+	require.Error(t, err)
+}
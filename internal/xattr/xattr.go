@@ -0,0 +1,20 @@
+// Package xattr provides a cross-platform abstraction for reading and writing extended attributes
+// of files, which on Linux also hold POSIX access control lists.
+package xattr
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupported is returned when extended attributes are not supported by the platform or the filesystem.
+var ErrUnsupported = errors.New("extended attributes are not supported")
+
+// ACLPrefix is the name prefix of extended attributes that hold POSIX access control lists.
+const ACLPrefix = "system.posix_acl_"
+
+// IsACL returns true if the extended attribute with the provided name holds an access control list.
+func IsACL(name string) bool {
+	return strings.HasPrefix(name, ACLPrefix)
+}
@@ -0,0 +1,6 @@
+package xattr
+
+import "golang.org/x/sys/unix"
+
+// errNoAttribute is returned when the requested extended attribute does not exist.
+const errNoAttribute = unix.ENOATTR
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package xattr
+
+// List returns ErrUnsupported since extended attributes are not supported on this platform.
+func List(path string) (map[string][]byte, error) {
+	return nil, ErrUnsupported
+}
+
+// Set returns ErrUnsupported since extended attributes are not supported on this platform.
+func Set(path string, attrs map[string][]byte) error {
+	return ErrUnsupported
+}
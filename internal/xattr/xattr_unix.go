@@ -0,0 +1,120 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package xattr
+
+import (
+	"bytes"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// List returns extended attributes of the provided file without following symbolic links.
+// Returns ErrUnsupported if the filesystem does not support extended attributes.
+func List(path string) (map[string][]byte, error) {
+	names, err := listNames(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	result := map[string][]byte{}
+
+	for _, n := range names {
+		v, err := get(path, n)
+		if errors.Is(err, errNoAttribute) {
+			// removed since listing
+			continue
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(mapError(err), "unable to get extended attribute %q of %v", n, path)
+		}
+
+		result[n] = v
+	}
+
+	return result, nil
+}
+
+// Set sets the provided extended attributes on a file without following symbolic links.
+// Returns ErrUnsupported if the filesystem does not support extended attributes.
+func Set(path string, attrs map[string][]byte) error {
+	for n, v := range attrs {
+		if err := unix.Lsetxattr(path, n, v, 0); err != nil {
+			return errors.Wrapf(mapError(err), "unable to set extended attribute %q of %v", n, path)
+		}
+	}
+
+	return nil
+}
+
+func listNames(path string) ([]string, error) {
+	for {
+		sz, err := unix.Llistxattr(path, nil)
+		if err != nil {
+			return nil, errors.Wrapf(mapError(err), "unable to list extended attributes of %v", path)
+		}
+
+		if sz == 0 {
+			return nil, nil
+		}
+
+		buf := make([]byte, sz)
+
+		sz, err = unix.Llistxattr(path, buf)
+		if errors.Is(err, unix.ERANGE) {
+			// attributes were added since we got the size, retry.
+			continue
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(mapError(err), "unable to list extended attributes of %v", path)
+		}
+
+		var names []string
+
+		for _, n := range bytes.Split(buf[:sz], []byte{0}) {
+			if len(n) > 0 {
+				names = append(names, string(n))
+			}
+		}
+
+		return names, nil
+	}
+}
+
+func get(path, name string) ([]byte, error) {
+	for {
+		sz, err := unix.Lgetxattr(path, name, nil)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		buf := make([]byte, sz)
+
+		sz, err = unix.Lgetxattr(path, name, buf)
+		if errors.Is(err, unix.ERANGE) {
+			// value has grown since we got the size, retry.
+			continue
+		}
+
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		return buf[:sz], nil
+	}
+}
+
+func mapError(err error) error {
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) {
+		return ErrUnsupported
+	}
+
+	return err
+}
@@ -3,6 +3,7 @@
 
 import (
 	"context"
+	"time"
 
 	"github.com/kopia/kopia/repo/blob"
 )
@@ -60,6 +61,18 @@ func (s beforeOp) DeleteBlob(ctx context.Context, id blob.ID) error {
 	return s.Storage.DeleteBlob(ctx, id) //nolint:wrapcheck
 }
 
+func (s beforeOp) ExtendBlobRetention(ctx context.Context, id blob.ID, until time.Time) error {
+	return blob.ExtendBlobRetention(ctx, s.Storage, id, until) //nolint:wrapcheck
+}
+
+func (s beforeOp) Sync(ctx context.Context) error {
+	return blob.Sync(ctx, s.Storage) //nolint:wrapcheck
+}
+
+func (s beforeOp) AlternateSources() []blob.Reader {
+	return blob.GetAlternateSources(s.Storage)
+}
+
 // NewWrapper creates a wrapped storage interface for data operations that need
 // to run a callback before the actual operation.
 func NewWrapper(wrapped blob.Storage, onGetBlob onGetBlobCallback, onGetMetadata, onDeleteBlob callback, onPutBlob onPutBlobCallback) blob.Storage {
@@ -9,6 +9,7 @@
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -40,6 +41,12 @@ type fsImpl struct {
 	Options
 
 	osi osInterface
+
+	mu sync.Mutex
+	// +checklocks:mu
+	unsyncedFiles map[string]struct{} // files written since last Sync()
+	// +checklocks:mu
+	unsyncedDirs map[string]struct{} // directories whose entries changed since last Sync()
 }
 
 var errRetriableInvalidLength = errors.Errorf("invalid length (retriable)")
@@ -190,6 +197,8 @@ func (fs *fsImpl) PutBlobInPath(ctx context.Context, dirPath, path string, data
 			return err
 		}
 
+		fs.markUnsynced(path, filepath.Dir(path))
+
 		if fs.FileUID != nil && fs.FileGID != nil && fs.osi.Geteuid() == 0 {
 			if chownErr := fs.osi.Chown(path, *fs.FileUID, *fs.FileGID); chownErr != nil {
 				log(ctx).Errorf("can't change file permissions: %v", chownErr)
@@ -222,6 +231,13 @@ func (fs *fsImpl) createTempFileAndDir(tempFile string) (osWriteFile, error) {
 			return nil, errors.Wrap(err, "cannot create directory")
 		}
 
+		// new directories were created, their parents need to be synced too.
+		root := filepath.Clean(fs.Path)
+
+		for d := filepath.Dir(tempFile); len(d) > len(root); d = filepath.Dir(d) {
+			fs.markUnsynced("", filepath.Dir(d))
+		}
+
 		//nolint:wrapcheck
 		return fs.osi.CreateNewFile(tempFile, fs.fileMode())
 	}
@@ -234,6 +250,75 @@ func (fs *fsImpl) createTempFileAndDir(tempFile string) (osWriteFile, error) {
 	return f, nil
 }
 
+// markUnsynced records a file and/or directory that needs to be synced by the next call to Sync().
+func (fs *fsImpl) markUnsynced(file, dir string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.unsyncedFiles == nil {
+		fs.unsyncedFiles = map[string]struct{}{}
+		fs.unsyncedDirs = map[string]struct{}{}
+	}
+
+	if file != "" {
+		fs.unsyncedFiles[file] = struct{}{}
+	}
+
+	if dir != "" {
+		fs.unsyncedDirs[dir] = struct{}{}
+	}
+}
+
+// Sync flushes all files written since the last call to Sync() and their parent directories
+// to stable storage. Files that were deleted in the meantime are ignored.
+func (fs *fsImpl) Sync(ctx context.Context) error {
+	fs.mu.Lock()
+	files, dirs := fs.unsyncedFiles, fs.unsyncedDirs
+	fs.unsyncedFiles, fs.unsyncedDirs = nil, nil
+	fs.mu.Unlock()
+
+	// files must be synced before directories that reference them.
+	if err := fs.syncPaths(files); err != nil {
+		fs.restoreUnsynced(files, dirs)
+		return err
+	}
+
+	// directories can't be synced on Windows, where metadata updates are durable once the call returns.
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	if err := fs.syncPaths(dirs); err != nil {
+		fs.restoreUnsynced(nil, dirs)
+		return err
+	}
+
+	log(ctx).Debugf("synced %v files and %v directories", len(files), len(dirs))
+
+	return nil
+}
+
+func (fs *fsImpl) syncPaths(paths map[string]struct{}) error {
+	for p := range paths {
+		if err := fs.osi.Fsync(p); err != nil && !fs.osi.IsNotExist(err) {
+			return errors.Wrapf(err, "error syncing %v", p)
+		}
+	}
+
+	return nil
+}
+
+// restoreUnsynced puts back paths that failed to sync so that they can be retried.
+func (fs *fsImpl) restoreUnsynced(files, dirs map[string]struct{}) {
+	for f := range files {
+		fs.markUnsynced(f, "")
+	}
+
+	for d := range dirs {
+		fs.markUnsynced("", d)
+	}
+}
+
 func (fs *fsImpl) DeleteBlobInPath(ctx context.Context, dirPath, path string) error {
 	//nolint:wrapcheck
 	return retry.WithExponentialBackoffNoValue(ctx, "DeleteBlobInPath:"+path, func() error {
@@ -331,6 +416,10 @@ func (fs *fsStorage) FlushCaches(ctx context.Context) error {
 	return nil
 }
 
+func (fs *fsStorage) Sync(ctx context.Context) error {
+	return fs.Impl.(*fsImpl).Sync(ctx) //nolint:forcetypeassert
+}
+
 // New creates new filesystem-backed storage in a specified directory.
 func New(ctx context.Context, opts *Options, isCreate bool) (blob.Storage, error) {
 	var err error
@@ -353,7 +442,7 @@ func New(ctx context.Context, opts *Options, isCreate bool) (blob.Storage, error
 	}
 
 	return &fsStorage{
-		sharded.New(&fsImpl{*opts, osi}, opts.Path, opts.Options, isCreate),
+		sharded.New(&fsImpl{Options: *opts, osi: osi}, opts.Path, opts.Options, isCreate),
 	}, nil
 }
 
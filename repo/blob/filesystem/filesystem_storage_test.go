@@ -4,6 +4,7 @@
 	"context"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"sort"
 	"testing"
 	"time"
@@ -443,6 +444,60 @@ func TestFileStorage_TouchBlob_ErrorHandling(t *testing.T) {
 	require.NoError(t, st.(*fsStorage).TouchBlob(ctx, "someblob1234567812345678", 0))
 }
 
+func TestFileStorage_Sync(t *testing.T) {
+	t.Parallel()
+
+	ctx := testlogging.Context(t)
+
+	dataDir := testutil.TempDirectory(t)
+
+	osi := &mockOS{
+		osInterface: realOS{},
+	}
+
+	st, err := New(ctx, &Options{
+		Path: dataDir,
+		Options: sharded.Options{
+			DirectoryShards: []int{5, 2},
+		},
+	}, true)
+	require.NoError(t, err)
+
+	st.(*fsStorage).Impl.(*fsImpl).osi = osi
+
+	defer st.Close(ctx)
+
+	require.NoError(t, st.PutBlob(ctx, "someblob1234567812345678", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+	require.NoError(t, blob.Sync(ctx, st))
+
+	// sharding parameters are written along with the first blob.
+	want := []string{
+		filepath.Join(dataDir, sharded.ParametersFile),
+		filepath.Join(dataDir, "someb", "lo", "b1234567812345678.f"),
+	}
+	if runtime.GOOS != "windows" {
+		want = append(want,
+			filepath.Join(dataDir, "someb", "lo"),
+			filepath.Join(dataDir, "someb"),
+			dataDir)
+	}
+
+	require.ElementsMatch(t, want, osi.takeFsynced())
+
+	// nothing was written since last sync.
+	require.NoError(t, blob.Sync(ctx, st))
+	require.Empty(t, osi.takeFsynced())
+
+	// failed sync is retried next time.
+	require.NoError(t, st.PutBlob(ctx, "someblob1234567812345679", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+
+	osi.fsyncRemainingErrors = 1
+
+	require.Error(t, blob.Sync(ctx, st))
+	require.NoError(t, blob.Sync(ctx, st))
+	require.Contains(t, osi.takeFsynced(), filepath.Join(dataDir, "someb", "lo", "b1234567812345679.f"))
+}
+
 func TestFileStorage_Misc(t *testing.T) {
 	t.Parallel()
 
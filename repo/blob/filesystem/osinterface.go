@@ -25,6 +25,7 @@ type osInterface interface {
 	Chtimes(fname string, atime, mtime time.Time) error
 	Geteuid() int
 	Chown(fname string, uid, gid int) error
+	Fsync(fname string) error
 }
 
 type osReadFile interface {
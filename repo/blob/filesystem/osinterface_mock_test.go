@@ -3,6 +3,7 @@
 import (
 	"io/fs"
 	"os"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -43,6 +44,12 @@ type mockOS struct {
 	statRemainingErrors int32
 	// +checkatomic
 	chtimesRemainingErrors int32
+	// +checkatomic
+	fsyncRemainingErrors int32
+
+	fsyncMutex sync.Mutex
+	// +checklocks:fsyncMutex
+	fsynced []string
 
 	effectiveUID int
 
@@ -162,6 +169,33 @@ func (osi *mockOS) Mkdir(fname string, mode os.FileMode) error {
 	return osi.osInterface.Mkdir(fname, mode)
 }
 
+func (osi *mockOS) Fsync(fname string) error {
+	if atomic.AddInt32(&osi.fsyncRemainingErrors, -1) >= 0 {
+		return &os.PathError{Op: "fsync", Err: errors.Errorf("underlying problem")}
+	}
+
+	if err := osi.osInterface.Fsync(fname); err != nil {
+		return err
+	}
+
+	osi.fsyncMutex.Lock()
+	defer osi.fsyncMutex.Unlock()
+
+	osi.fsynced = append(osi.fsynced, fname)
+
+	return nil
+}
+
+func (osi *mockOS) takeFsynced() []string {
+	osi.fsyncMutex.Lock()
+	defer osi.fsyncMutex.Unlock()
+
+	result := osi.fsynced
+	osi.fsynced = nil
+
+	return result
+}
+
 func (osi *mockOS) Geteuid() int {
 	return osi.effectiveUID
 }
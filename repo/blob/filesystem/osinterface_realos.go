@@ -87,4 +87,17 @@ func (realOS) Chown(fname string, uid, gid int) error {
 	return os.Chown(fname, uid, gid)
 }
 
+func (realOS) Fsync(fname string) error {
+	f, err := os.Open(fname) //nolint:gosec
+	if err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	//nolint:wrapcheck
+	return f.Sync()
+}
+
 var _ osInterface = realOS{}
@@ -5,6 +5,7 @@
 	"context"
 	"errors"
 	"sync/atomic"
+	"time"
 
 	"go.opentelemetry.io/otel"
 
@@ -148,6 +149,47 @@ func (s *loggingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
 	return err
 }
 
+func (s *loggingStorage) ExtendBlobRetention(ctx context.Context, id blob.ID, until time.Time) error {
+	ctx, span := tracer.Start(ctx, "ExtendBlobRetention")
+	defer span.End()
+
+	s.beginConcurrency()
+	defer s.endConcurrency()
+
+	timer := timetrack.StartTimer()
+	err := blob.ExtendBlobRetention(ctx, s.base, id, until)
+	dt := timer.Elapsed()
+
+	s.logger.Debugw(s.prefix+"ExtendBlobRetention",
+		"blobID", id,
+		"until", until,
+		"error", s.translateError(err),
+		"duration", dt,
+	)
+	//nolint:wrapcheck
+	return err
+}
+
+func (s *loggingStorage) Sync(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "Sync")
+	defer span.End()
+
+	timer := timetrack.StartTimer()
+	err := blob.Sync(ctx, s.base)
+	dt := timer.Elapsed()
+
+	s.logger.Debugw(s.prefix+"Sync",
+		"error", s.translateError(err),
+		"duration", dt,
+	)
+	//nolint:wrapcheck
+	return err
+}
+
+func (s *loggingStorage) AlternateSources() []blob.Reader {
+	return blob.GetAlternateSources(s.base)
+}
+
 func (s *loggingStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
 	ctx, span := tracer.Start(ctx, "ListBlobs")
 	defer span.End()
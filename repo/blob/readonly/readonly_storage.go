@@ -3,6 +3,7 @@
 
 import (
 	"context"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -40,6 +41,19 @@ func (s readonlyStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
 	return ErrReadonly
 }
 
+func (s readonlyStorage) ExtendBlobRetention(ctx context.Context, id blob.ID, until time.Time) error {
+	return ErrReadonly
+}
+
+func (s readonlyStorage) Sync(ctx context.Context) error {
+	// nothing could have been written, so there's nothing to sync.
+	return nil
+}
+
+func (s readonlyStorage) AlternateSources() []blob.Reader {
+	return blob.GetAlternateSources(s.base)
+}
+
 func (s readonlyStorage) ListBlobs(ctx context.Context, prefix blob.ID, callback func(blob.Metadata) error) error {
 	//nolint:wrapcheck
 	return s.base.ListBlobs(ctx, prefix, callback)
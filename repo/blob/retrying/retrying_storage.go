@@ -56,6 +56,18 @@ func (s retryingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
 	return err //nolint:wrapcheck
 }
 
+func (s retryingStorage) Sync(ctx context.Context) error {
+	//nolint:wrapcheck
+	return retry.WithExponentialBackoffNoValue(ctx, "Sync", func() error {
+		//nolint:wrapcheck
+		return blob.Sync(ctx, s.Storage)
+	}, isRetriable)
+}
+
+func (s retryingStorage) AlternateSources() []blob.Reader {
+	return blob.GetAlternateSources(s.Storage)
+}
+
 // NewWrapper returns a Storage wrapper that adds retry loop around all operations of the underlying storage.
 func NewWrapper(wrapped blob.Storage) blob.Storage {
 	return &retryingStorage{Storage: wrapped}
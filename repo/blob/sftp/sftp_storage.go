@@ -11,6 +11,7 @@
 	"os/exec"
 	"path"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/pkg/sftp"
@@ -34,6 +35,8 @@
 	tempFileRandomSuffixLen = 8
 
 	packetSize = 1 << 15
+
+	fsyncExtension = "fsync@openssh.com"
 )
 
 // sftpStorage implements blob.Storage on top of sftp.
@@ -45,6 +48,10 @@ type sftpImpl struct {
 	Options
 
 	rec *connection.Reconnector
+
+	mu sync.Mutex
+	// +checklocks:mu
+	unsyncedFiles map[string]struct{} // files written since last Sync()
 }
 
 type sftpConnection struct {
@@ -225,6 +232,8 @@ func (s *sftpImpl) PutBlobInPath(ctx context.Context, dirPath, fullPath string,
 			return errors.Wrap(err, "unexpected error renaming file on SFTP")
 		}
 
+		s.markUnsynced(fullPath)
+
 		if t := opts.SetModTime; !t.IsZero() {
 			if chtimesErr := sftpClientFromConnection(conn).Chtimes(fullPath, t, t); err != nil {
 				return errors.Wrap(chtimesErr, "can't change file times")
@@ -294,6 +303,72 @@ func isNotExist(err error) bool {
 	return strings.Contains(err.Error(), "does not exist")
 }
 
+func (s *sftpImpl) markUnsynced(fullPath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.unsyncedFiles == nil {
+		s.unsyncedFiles = map[string]struct{}{}
+	}
+
+	s.unsyncedFiles[fullPath] = struct{}{}
+}
+
+// Sync flushes all files written since the last call to Sync() to stable storage on the server.
+// SFTP does not support syncing directories and servers without the fsync extension can't sync at all,
+// in which case Sync() is a no-op.
+func (s *sftpImpl) Sync(ctx context.Context) error {
+	s.mu.Lock()
+	files := s.unsyncedFiles
+	s.unsyncedFiles = nil
+	s.mu.Unlock()
+
+	if len(files) == 0 {
+		return nil
+	}
+
+	err := s.rec.UsingConnectionNoResult(ctx, "Sync", func(conn connection.Connection) error {
+		cli := sftpClientFromConnection(conn)
+
+		if _, ok := cli.HasExtension(fsyncExtension); !ok {
+			log(ctx).Debugf("SFTP server does not support %v, not syncing %v files", fsyncExtension, len(files))
+			return nil
+		}
+
+		for fname := range files {
+			if err := syncFile(cli, fname); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		for fname := range files {
+			s.markUnsynced(fname)
+		}
+	}
+
+	//nolint:wrapcheck
+	return err
+}
+
+func syncFile(cli *sftp.Client, fname string) error {
+	f, err := cli.Open(fname)
+	if isNotExist(err) {
+		// file was deleted since it was written.
+		return nil
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "error opening %v", fname)
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	return errors.Wrapf(f.Sync(), "error syncing %v", fname)
+}
+
 func (s *sftpImpl) DeleteBlobInPath(ctx context.Context, dirPath, fullPath string) error {
 	//nolint:wrapcheck
 	return s.rec.UsingConnectionNoResult(ctx, "DeleteBlobInPath", func(conn connection.Connection) error {
@@ -336,6 +411,10 @@ func (s *sftpStorage) Close(ctx context.Context) error {
 	return nil
 }
 
+func (s *sftpStorage) Sync(ctx context.Context) error {
+	return s.Impl.(*sftpImpl).Sync(ctx) //nolint:forcetypeassert
+}
+
 func writeKnownHostsDataStringToTempFile(data string) (string, error) {
 	tf, err := os.CreateTemp("", "kopia-known-hosts")
 	if err != nil {
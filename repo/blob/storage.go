@@ -36,6 +36,10 @@
 // by an implementation of Storage is specified in a PutBlob call.
 var ErrUnsupportedPutBlobOption = errors.New("unsupported put-blob option")
 
+// ErrRetentionExtensionUnsupported is returned when attempting to extend retention of blobs
+// in a storage that does not support it.
+var ErrRetentionExtensionUnsupported = errors.New("extending blob retention is not supported by the storage")
+
 // ErrNotAVolume is returned when attempting to use a Volume method against a storage
 // implementation that does not support the intended functionality.
 var ErrNotAVolume = errors.New("unsupported method, storage is not a volume")
@@ -84,6 +88,8 @@ type Reader interface {
 
 	// ListBlobs invokes the provided callback for each blob in the storage.
 	// Iteration continues until the callback returns an error or until all matching blobs have been reported.
+	// Implementations backed by paginated listing APIs must transparently retrieve all pages, returning
+	// nil only after the complete set of matching blobs has been reported.
 	ListBlobs(ctx context.Context, blobIDPrefix ID, cb func(bm Metadata) error) error
 
 	// ConnectionInfo returns JSON-serializable data structure containing information required to
@@ -163,6 +169,29 @@ type Storage interface {
 	FlushCaches(ctx context.Context) error
 }
 
+// AlternateSources is an optional interface implemented by storage that has access to additional
+// copies of its blobs (such as mirrors), which can be consulted when the primary copy of a blob
+// is found to be corrupted.
+type AlternateSources interface {
+	// AlternateSources returns readers for alternate copies of blobs, in order of preference.
+	AlternateSources() []Reader
+}
+
+// RetentionExtender is an optional interface implemented by storage that supports extending
+// the retention (object lock) of existing blobs.
+type RetentionExtender interface {
+	// ExtendBlobRetention extends the retention of the given blob until the provided time.
+	// Retention is never shortened.
+	ExtendBlobRetention(ctx context.Context, id ID, until time.Time) error
+}
+
+// Flusher is an optional interface implemented by storage that buffers writes locally (such as in the
+// operating system cache) and can make them durable on demand.
+type Flusher interface {
+	// Sync ensures that all blobs written so far are durably persisted.
+	Sync(ctx context.Context) error
+}
+
 // ID is a string that represents blob identifier.
 type ID string
 
@@ -326,6 +355,64 @@ func DeleteMultiple(ctx context.Context, st Storage, ids []ID, parallelism int)
 	return errors.Wrap(eg.Wait(), "error deleting blobs")
 }
 
+// ExtendBlobRetention extends the retention of a single blob if the storage supports it,
+// otherwise returns ErrRetentionExtensionUnsupported.
+func ExtendBlobRetention(ctx context.Context, st Storage, id ID, until time.Time) error {
+	re, ok := st.(RetentionExtender)
+	if !ok {
+		return ErrRetentionExtensionUnsupported
+	}
+
+	//nolint:wrapcheck
+	return re.ExtendBlobRetention(ctx, id, until)
+}
+
+// ExtendRetention extends the retention of multiple blobs in parallel.
+func ExtendRetention(ctx context.Context, st Storage, ids []ID, until time.Time, parallelism int) error {
+	if _, ok := st.(RetentionExtender); !ok {
+		return ErrRetentionExtensionUnsupported
+	}
+
+	eg, ctx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, parallelism)
+
+	for _, id := range ids {
+		// acquire semaphore
+		sem <- struct{}{}
+
+		id := id
+
+		eg.Go(func() error {
+			defer func() {
+				<-sem // release semaphore
+			}()
+
+			return errors.Wrapf(ExtendBlobRetention(ctx, st, id, until), "extending retention of %v", id)
+		})
+	}
+
+	return errors.Wrap(eg.Wait(), "error extending blob retention")
+}
+
+// Sync makes previously-written blobs durable if the storage implements Flusher, otherwise it's a no-op.
+func Sync(ctx context.Context, st Storage) error {
+	if f, ok := st.(Flusher); ok {
+		//nolint:wrapcheck
+		return f.Sync(ctx)
+	}
+
+	return nil
+}
+
+// GetAlternateSources returns alternate sources of blobs if the storage implements AlternateSources, otherwise nil.
+func GetAlternateSources(st Storage) []Reader {
+	if as, ok := st.(AlternateSources); ok {
+		return as.AlternateSources()
+	}
+
+	return nil
+}
+
 // PutBlobAndGetMetadata invokes PutBlob and returns the resulting Metadata.
 func PutBlobAndGetMetadata(ctx context.Context, st Storage, blobID ID, data Bytes, opts PutOptions) (Metadata, error) {
 	// ensure GetModTime is set, or reuse existing one.
@@ -342,6 +429,31 @@ func PutBlobAndGetMetadata(ctx context.Context, st Storage, blobID ID, data Byte
 	}, err //nolint:wrapcheck
 }
 
+// PutNewBlob writes the provided blob only if a blob with the same ID does not exist yet and returns
+// ErrBlobAlreadyExists otherwise. The check is atomic on storage that supports DoNotRecreate, on other storage
+// it's best-effort, since a blob written concurrently between the check and the write is overwritten.
+func PutNewBlob(ctx context.Context, st Storage, blobID ID, data Bytes, opts PutOptions) error {
+	opts.DoNotRecreate = true
+
+	err := st.PutBlob(ctx, blobID, data, opts)
+	if !errors.Is(err, ErrUnsupportedPutBlobOption) {
+		return err //nolint:wrapcheck
+	}
+
+	_, err = st.GetMetadata(ctx, blobID)
+
+	switch {
+	case err == nil:
+		return ErrBlobAlreadyExists
+	case !errors.Is(err, ErrBlobNotFound):
+		return errors.Wrapf(err, "error checking existence of %v", blobID)
+	}
+
+	opts.DoNotRecreate = false
+
+	return st.PutBlob(ctx, blobID, data, opts) //nolint:wrapcheck
+}
+
 // ReadBlobMap reads the map of all the blobs indexed by ID.
 func ReadBlobMap(ctx context.Context, br Reader) (map[ID]Metadata, error) {
 	blobMap := map[ID]Metadata{}
@@ -11,7 +11,14 @@
 
 	"github.com/kopia/kopia/internal/blobtesting"
 	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/beforeop"
+	"github.com/kopia/kopia/repo/blob/logging"
+	"github.com/kopia/kopia/repo/blob/readonly"
+	"github.com/kopia/kopia/repo/blob/retrying"
+	"github.com/kopia/kopia/repo/blob/throttling"
+	"github.com/kopia/kopia/repo/blob/timeout"
 )
 
 func TestListAllBlobs(t *testing.T) {
@@ -199,3 +206,119 @@ func TestPutBlobAndGetMetadata(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, fixedTime, bm.Timestamp)
 }
+
+// noConditionalPutStorage rejects DoNotRecreate like storage backends that don't support conditional writes.
+type noConditionalPutStorage struct {
+	blob.Storage
+}
+
+func (s noConditionalPutStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	if opts.DoNotRecreate {
+		return blob.ErrUnsupportedPutBlobOption
+	}
+
+	return s.Storage.PutBlob(ctx, id, data, opts)
+}
+
+func TestPutNewBlob(t *testing.T) {
+	ctx := context.Background()
+
+	cases := map[string]func(st blob.Storage) blob.Storage{
+		"conditional":    func(st blob.Storage) blob.Storage { return st },
+		"nonConditional": func(st blob.Storage) blob.Storage { return noConditionalPutStorage{st} },
+	}
+
+	for name, wrap := range cases {
+		t.Run(name, func(t *testing.T) {
+			data := blobtesting.DataMap{}
+			st := wrap(blobtesting.NewMapStorage(data, nil, nil))
+
+			require.NoError(t, blob.PutNewBlob(ctx, st, "foo", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+			require.Equal(t, []byte{1, 2, 3}, data["foo"])
+
+			require.ErrorIs(t, blob.PutNewBlob(ctx, st, "foo", gather.FromSlice([]byte{4, 5, 6}), blob.PutOptions{}), blob.ErrBlobAlreadyExists)
+			require.Equal(t, []byte{1, 2, 3}, data["foo"])
+
+			// plain PutBlob still overwrites.
+			require.NoError(t, st.PutBlob(ctx, "foo", gather.FromSlice([]byte{7, 8, 9}), blob.PutOptions{}))
+			require.Equal(t, []byte{7, 8, 9}, data["foo"])
+		})
+	}
+}
+
+type retentionExtendingStorage struct {
+	blob.Storage
+
+	mu        sync.Mutex
+	retention map[blob.ID]time.Time
+}
+
+func (s *retentionExtendingStorage) ExtendBlobRetention(ctx context.Context, id blob.ID, until time.Time) error {
+	if _, err := s.GetMetadata(ctx, id); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.retention[id] = until
+
+	return nil
+}
+
+func TestExtendRetention(t *testing.T) {
+	data := blobtesting.DataMap{}
+	ctx := context.Background()
+
+	base := blobtesting.NewMapStorage(data, nil, nil)
+	for _, id := range []blob.ID{"a", "b", "c", "d"} {
+		require.NoError(t, base.PutBlob(ctx, id, gather.FromSlice([]byte{1}), blob.PutOptions{}))
+	}
+
+	until := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// storage without the capability.
+	require.ErrorIs(t, blob.ExtendRetention(ctx, base, []blob.ID{"a"}, until, 2), blob.ErrRetentionExtensionUnsupported)
+
+	st := &retentionExtendingStorage{Storage: base, retention: map[blob.ID]time.Time{}}
+
+	require.NoError(t, blob.ExtendRetention(ctx, st, []blob.ID{"a", "c"}, until, 2))
+	require.Equal(t, map[blob.ID]time.Time{"a": until, "c": until}, st.retention)
+
+	require.ErrorIs(t, blob.ExtendRetention(ctx, st, []blob.ID{"b", "no-such-blob"}, until, 2), blob.ErrBlobNotFound)
+}
+
+type storageWithMirrors struct {
+	blob.Storage
+
+	mirrors []blob.Reader
+}
+
+func (s storageWithMirrors) AlternateSources() []blob.Reader {
+	return s.mirrors
+}
+
+func TestAlternateSourcesForwardedByWrappers(t *testing.T) {
+	base := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+	mirror := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+
+	require.Empty(t, blob.GetAlternateSources(base))
+
+	st := storageWithMirrors{base, []blob.Reader{mirror}}
+
+	throttler, err := throttling.NewThrottler(throttling.Limits{}, time.Second, 0)
+	require.NoError(t, err)
+
+	wrappers := map[string]blob.Storage{
+		"beforeop":   beforeop.NewUniformWrapper(st, func(ctx context.Context) error { return nil }),
+		"logging":    logging.NewWrapper(st, testlogging.NewTestLogger(t), ""),
+		"readonly":   readonly.NewWrapper(st),
+		"retrying":   retrying.NewWrapper(st),
+		"throttling": throttling.NewWrapper(st, throttler),
+		"timeout":    timeout.NewWrapper(st, timeout.Timeouts{}),
+	}
+
+	for name, w := range wrappers {
+		require.Equal(t, []blob.Reader{mirror}, blob.GetAlternateSources(w), name)
+	}
+}
@@ -46,7 +46,7 @@ func (t *tokenBucketBasedThrottler) BeforeOperation(ctx context.Context, op stri
 	case operationGetBlob, operationGetMetadata:
 		t.readOps.Take(ctx, 1)
 		t.concurrentReads.Acquire()
-	case operationPutBlob, operationDeleteBlob:
+	case operationPutBlob, operationDeleteBlob, operationExtendBlobRetention:
 		t.writeOps.Take(ctx, 1)
 		t.concurrentWrites.Acquire()
 	}
@@ -57,7 +57,7 @@ func (t *tokenBucketBasedThrottler) AfterOperation(ctx context.Context, op strin
 	case operationListBlobs:
 	case operationGetBlob, operationGetMetadata:
 		t.concurrentReads.Release()
-	case operationPutBlob, operationDeleteBlob:
+	case operationPutBlob, operationDeleteBlob, operationExtendBlobRetention:
 		t.concurrentWrites.Release()
 	}
 }
@@ -4,6 +4,7 @@
 
 import (
 	"context"
+	"time"
 
 	"github.com/kopia/kopia/repo/blob"
 )
@@ -19,6 +20,8 @@
 	operationListBlobs   = "ListBlobs"
 	operationPutBlob     = "PutBlob"
 	operationDeleteBlob  = "DeleteBlob"
+
+	operationExtendBlobRetention = "ExtendBlobRetention"
 )
 
 // Throttler implements throttling policy by blocking before certain operations are
@@ -104,6 +107,21 @@ func (s *throttlingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
 	return s.Storage.DeleteBlob(ctx, id) //nolint:wrapcheck
 }
 
+func (s *throttlingStorage) ExtendBlobRetention(ctx context.Context, id blob.ID, until time.Time) error {
+	s.throttler.BeforeOperation(ctx, operationExtendBlobRetention)
+	defer s.throttler.AfterOperation(ctx, operationExtendBlobRetention)
+
+	return blob.ExtendBlobRetention(ctx, s.Storage, id, until) //nolint:wrapcheck
+}
+
+func (s *throttlingStorage) Sync(ctx context.Context) error {
+	return blob.Sync(ctx, s.Storage) //nolint:wrapcheck
+}
+
+func (s *throttlingStorage) AlternateSources() []blob.Reader {
+	return blob.GetAlternateSources(s.Storage)
+}
+
 // NewWrapper returns a Storage wrapper that adds retry loop around all operations of the underlying storage.
 func NewWrapper(wrapped blob.Storage, throttler Throttler) blob.Storage {
 	return &throttlingStorage{wrapped, throttler}
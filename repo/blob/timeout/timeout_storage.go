@@ -0,0 +1,106 @@
+// Package timeout implements wrapper around blob.Storage that enforces default timeouts for storage operations.
+package timeout
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// Timeouts specifies maximum durations of individual storage operations, zero means no timeout.
+type Timeouts struct {
+	Get  time.Duration // GetBlob, GetMetadata
+	Put  time.Duration // PutBlob, DeleteBlob, ExtendBlobRetention
+	List time.Duration // ListBlobs, including time spent in callbacks
+}
+
+// IsEmpty returns true if no timeouts are configured.
+func (t Timeouts) IsEmpty() bool {
+	return t.Get == 0 && t.Put == 0 && t.List == 0
+}
+
+type timeoutStorage struct {
+	blob.Storage
+	timeouts Timeouts
+}
+
+// withTimeout runs the provided function with a context derived from ctx that expires after the
+// given duration. If the derived context expires, the resulting error wraps context.DeadlineExceeded.
+func withTimeout(ctx context.Context, op string, timeout time.Duration, f func(ctx context.Context) error) error {
+	if timeout == 0 {
+		return f(ctx)
+	}
+
+	ctx2, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := f(ctx2)
+	if err != nil && ctx.Err() == nil && errors.Is(ctx2.Err(), context.DeadlineExceeded) {
+		return errors.Wrapf(context.DeadlineExceeded, "%v timed out after %v: %v", op, timeout, err)
+	}
+
+	return err
+}
+
+func (s *timeoutStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	return withTimeout(ctx, "GetBlob", s.timeouts.Get, func(ctx context.Context) error {
+		return s.Storage.GetBlob(ctx, id, offset, length, output) //nolint:wrapcheck
+	})
+}
+
+func (s *timeoutStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
+	var bm blob.Metadata
+
+	err := withTimeout(ctx, "GetMetadata", s.timeouts.Get, func(ctx context.Context) error {
+		var err error
+
+		bm, err = s.Storage.GetMetadata(ctx, id)
+
+		return err //nolint:wrapcheck
+	})
+
+	return bm, err
+}
+
+func (s *timeoutStorage) ListBlobs(ctx context.Context, blobIDPrefix blob.ID, cb func(bm blob.Metadata) error) error {
+	return withTimeout(ctx, "ListBlobs", s.timeouts.List, func(ctx context.Context) error {
+		return s.Storage.ListBlobs(ctx, blobIDPrefix, cb) //nolint:wrapcheck
+	})
+}
+
+func (s *timeoutStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	return withTimeout(ctx, "PutBlob", s.timeouts.Put, func(ctx context.Context) error {
+		return s.Storage.PutBlob(ctx, id, data, opts) //nolint:wrapcheck
+	})
+}
+
+func (s *timeoutStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	return withTimeout(ctx, "DeleteBlob", s.timeouts.Put, func(ctx context.Context) error {
+		return s.Storage.DeleteBlob(ctx, id) //nolint:wrapcheck
+	})
+}
+
+func (s *timeoutStorage) ExtendBlobRetention(ctx context.Context, id blob.ID, until time.Time) error {
+	return withTimeout(ctx, "ExtendBlobRetention", s.timeouts.Put, func(ctx context.Context) error {
+		return blob.ExtendBlobRetention(ctx, s.Storage, id, until) //nolint:wrapcheck
+	})
+}
+
+func (s *timeoutStorage) Sync(ctx context.Context) error {
+	return withTimeout(ctx, "Sync", s.timeouts.Put, func(ctx context.Context) error {
+		return blob.Sync(ctx, s.Storage) //nolint:wrapcheck
+	})
+}
+
+func (s *timeoutStorage) AlternateSources() []blob.Reader {
+	return blob.GetAlternateSources(s.Storage)
+}
+
+// NewWrapper returns a Storage wrapper that enforces the provided timeouts on operations of the underlying storage.
+// Timeouts are enforced through context cancellation, so the underlying storage must honor the context.
+func NewWrapper(wrapped blob.Storage, timeouts Timeouts) blob.Storage {
+	return &timeoutStorage{wrapped, timeouts}
+}
@@ -0,0 +1,153 @@
+package timeout_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/timeout"
+)
+
+// slowStorage delays all operations by the given amount of time, honoring context cancellation.
+type slowStorage struct {
+	blob.Storage
+	delay time.Duration
+}
+
+func (s *slowStorage) wait(ctx context.Context) error {
+	select {
+	case <-time.After(s.delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *slowStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+
+	return s.Storage.GetBlob(ctx, id, offset, length, output)
+}
+
+func (s *slowStorage) GetMetadata(ctx context.Context, id blob.ID) (blob.Metadata, error) {
+	if err := s.wait(ctx); err != nil {
+		return blob.Metadata{}, err
+	}
+
+	return s.Storage.GetMetadata(ctx, id)
+}
+
+func (s *slowStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+
+	return s.Storage.PutBlob(ctx, id, data, opts)
+}
+
+func (s *slowStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+
+	return s.Storage.DeleteBlob(ctx, id)
+}
+
+func (s *slowStorage) ListBlobs(ctx context.Context, prefix blob.ID, cb func(bm blob.Metadata) error) error {
+	if err := s.wait(ctx); err != nil {
+		return err
+	}
+
+	return s.Storage.ListBlobs(ctx, prefix, cb)
+}
+
+const (
+	shortTimeout = 50 * time.Millisecond
+	slowDelay    = 10 * time.Second
+)
+
+func TestTimeoutStorage(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	cases := []struct {
+		desc     string
+		timeouts timeout.Timeouts
+		op       func(st blob.Storage) error
+	}{
+		{"GetBlob", timeout.Timeouts{Get: shortTimeout}, func(st blob.Storage) error {
+			var tmp gather.WriteBuffer
+			defer tmp.Close()
+
+			return st.GetBlob(ctx, "existing", 0, -1, &tmp)
+		}},
+		{"GetMetadata", timeout.Timeouts{Get: shortTimeout}, func(st blob.Storage) error {
+			_, err := st.GetMetadata(ctx, "existing")
+			return err
+		}},
+		{"PutBlob", timeout.Timeouts{Put: shortTimeout}, func(st blob.Storage) error {
+			return st.PutBlob(ctx, "new", gather.FromSlice([]byte{4}), blob.PutOptions{})
+		}},
+		{"DeleteBlob", timeout.Timeouts{Put: shortTimeout}, func(st blob.Storage) error {
+			return st.DeleteBlob(ctx, "existing")
+		}},
+		{"ListBlobs", timeout.Timeouts{List: shortTimeout}, func(st blob.Storage) error {
+			return st.ListBlobs(ctx, "", func(bm blob.Metadata) error { return nil })
+		}},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.desc, func(t *testing.T) {
+			t.Parallel()
+
+			base := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+
+			require.NoError(t, base.PutBlob(ctx, "existing", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+
+			// operation times out on slow storage.
+			st := timeout.NewWrapper(&slowStorage{base, slowDelay}, tc.timeouts)
+
+			t0 := time.Now()
+			err := tc.op(st)
+
+			require.ErrorIs(t, err, context.DeadlineExceeded)
+			require.Less(t, time.Since(t0), slowDelay/2)
+
+			// timeouts for other operations do not affect this one.
+			other := timeout.Timeouts{Get: shortTimeout, Put: shortTimeout, List: shortTimeout}
+			switch {
+			case tc.timeouts.Get != 0:
+				other.Get = 0
+			case tc.timeouts.Put != 0:
+				other.Put = 0
+			case tc.timeouts.List != 0:
+				other.List = 0
+			}
+
+			require.NoError(t, tc.op(timeout.NewWrapper(&slowStorage{base, 2 * shortTimeout}, other)))
+			require.NoError(t, base.PutBlob(ctx, "existing", gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+
+			// operation completes within the timeout.
+			require.NoError(t, tc.op(timeout.NewWrapper(&slowStorage{base, 0}, tc.timeouts)))
+		})
+	}
+}
+
+func TestTimeoutStorage_ParentContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(testlogging.Context(t))
+	cancel()
+
+	st := timeout.NewWrapper(&slowStorage{blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil), slowDelay}, timeout.Timeouts{Get: time.Hour})
+
+	_, err := st.GetMetadata(ctx, "foo")
+	require.ErrorIs(t, err, context.Canceled)
+}
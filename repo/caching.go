@@ -69,6 +69,7 @@ func setupCachingOptionsWithDefaults(ctx context.Context, configPath string, lc
 
 	lc.Caching.MaxCacheSizeBytes = opt.MaxCacheSizeBytes
 	lc.Caching.MaxMetadataCacheSizeBytes = opt.MaxMetadataCacheSizeBytes
+	lc.Caching.MaxObjectCacheSizeBytes = opt.MaxObjectCacheSizeBytes
 	lc.Caching.MaxListCacheDuration = opt.MaxListCacheDuration
 	lc.Caching.MinContentSweepAge = opt.MinContentSweepAge
 	lc.Caching.MinMetadataSweepAge = opt.MinMetadataSweepAge
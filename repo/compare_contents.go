@@ -0,0 +1,118 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/content"
+)
+
+// CompareOptions provides options for CompareContents.
+type CompareOptions struct {
+	// VerifyPercent is the percentage of contents present in both repositories whose data
+	// is read from both sides and compared byte-for-byte.
+	VerifyPercent float64
+}
+
+// CompareReport describes differences between the sets of contents of two repositories.
+type CompareReport struct {
+	SourceContentCount int          `json:"sourceContentCount"`
+	OtherContentCount  int          `json:"otherContentCount"`
+	OnlyInSource       []content.ID `json:"onlyInSource"`
+	OnlyInOther        []content.ID `json:"onlyInOther"`
+	VerifiedCount      int          `json:"verifiedCount"`
+	Mismatched         []content.ID `json:"mismatched"`
+}
+
+// Equivalent returns true if both repositories have the same set of contents and all verified contents matched.
+func (r *CompareReport) Equivalent() bool {
+	return len(r.OnlyInSource) == 0 && len(r.OnlyInOther) == 0 && len(r.Mismatched) == 0
+}
+
+// CompareContents compares the sets of (non-deleted) contents in two repositories and reports contents
+// present only on one side. A random sample of contents present in both is additionally verified
+// to have identical data.
+func CompareContents(ctx context.Context, source, other DirectRepository, opt CompareOptions) (*CompareReport, error) {
+	sourceIDs, err := allContentIDs(ctx, source)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing source contents")
+	}
+
+	otherIDs, err := allContentIDs(ctx, other)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing other contents")
+	}
+
+	report := &CompareReport{
+		SourceContentCount: len(sourceIDs),
+		OtherContentCount:  len(otherIDs),
+	}
+
+	for cid := range sourceIDs {
+		if _, ok := otherIDs[cid]; !ok {
+			report.OnlyInSource = append(report.OnlyInSource, cid)
+			continue
+		}
+
+		if rand.Float64()*100 >= opt.VerifyPercent { //nolint:gosec,gomnd
+			continue
+		}
+
+		same, err := sameContentData(ctx, source, other, cid)
+		if err != nil {
+			return nil, err
+		}
+
+		report.VerifiedCount++
+
+		if !same {
+			report.Mismatched = append(report.Mismatched, cid)
+		}
+	}
+
+	for cid := range otherIDs {
+		if _, ok := sourceIDs[cid]; !ok {
+			report.OnlyInOther = append(report.OnlyInOther, cid)
+		}
+	}
+
+	sortContentIDs(report.OnlyInSource)
+	sortContentIDs(report.OnlyInOther)
+	sortContentIDs(report.Mismatched)
+
+	return report, nil
+}
+
+func allContentIDs(ctx context.Context, rep DirectRepository) (map[content.ID]struct{}, error) {
+	result := map[content.ID]struct{}{}
+
+	//nolint:wrapcheck
+	return result, rep.ContentReader().IterateContents(ctx, content.IterateOptions{}, func(ci content.Info) error {
+		result[ci.GetContentID()] = struct{}{}
+		return nil
+	})
+}
+
+func sameContentData(ctx context.Context, source, other DirectRepository, cid content.ID) (bool, error) {
+	d1, err := source.ContentReader().GetContent(ctx, cid)
+	if err != nil {
+		return false, errors.Wrapf(err, "error reading source content %v", cid)
+	}
+
+	d2, err := other.ContentReader().GetContent(ctx, cid)
+	if err != nil {
+		return false, errors.Wrapf(err, "error reading other content %v", cid)
+	}
+
+	return bytes.Equal(d1, d2), nil
+}
+
+func sortContentIDs(ids []content.ID) {
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].String() < ids[j].String()
+	})
+}
@@ -0,0 +1,95 @@
+package repo_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/blobtesting"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/object"
+)
+
+func TestCompareContents(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	for i := 0; i < 5; i++ {
+		writeObject(ctx, t, env.RepositoryWriter, []byte(fmt.Sprintf("common-%v", i)), "common")
+	}
+
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	// make a partial copy of the repository storage, which does not include contents written below.
+	copySt := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+
+	require.NoError(t, env.RootStorage().ListBlobs(ctx, "", func(bm blob.Metadata) error {
+		var tmp gather.WriteBuffer
+		defer tmp.Close()
+
+		if err := env.RootStorage().GetBlob(ctx, bm.BlobID, 0, -1, &tmp); err != nil {
+			return err
+		}
+
+		return copySt.PutBlob(ctx, bm.BlobID, tmp.Bytes(), blob.PutOptions{})
+	}))
+
+	var onlyInSource []content.ID
+
+	for i := 0; i < 3; i++ {
+		onlyInSource = append(onlyInSource, objectContentIDs(t, env.RepositoryWriter, writeObject(ctx, t, env.RepositoryWriter, []byte(fmt.Sprintf("source-only-%v", i)), "source-only"))...)
+	}
+
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	rst := repotesting.NewReconnectableStorage(t, copySt)
+	configFile := filepath.Join(testutil.TempDirectory(t), "kopia.config")
+
+	require.NoError(t, repo.Connect(ctx, configFile, rst, env.Password, nil))
+
+	other, err := repo.Open(ctx, configFile, env.Password, nil)
+	require.NoError(t, err)
+
+	defer other.Close(ctx)
+
+	_, otherWriter, err := other.(repo.DirectRepository).NewDirectWriter(ctx, repo.WriteSessionOptions{Purpose: "test"})
+	require.NoError(t, err)
+
+	defer otherWriter.Close(ctx)
+
+	onlyInOther := objectContentIDs(t, otherWriter, writeObject(ctx, t, otherWriter, []byte("other-only"), "other-only"))
+
+	require.NoError(t, otherWriter.Flush(ctx))
+
+	report, err := repo.CompareContents(ctx, env.RepositoryWriter, otherWriter, repo.CompareOptions{VerifyPercent: 100})
+	require.NoError(t, err)
+
+	require.False(t, report.Equivalent())
+	require.ElementsMatch(t, onlyInSource, report.OnlyInSource)
+	require.ElementsMatch(t, onlyInOther, report.OnlyInOther)
+	require.Empty(t, report.Mismatched)
+	require.Equal(t, report.SourceContentCount-len(onlyInSource), report.VerifiedCount)
+	require.Equal(t, report.OtherContentCount-len(onlyInOther), report.VerifiedCount)
+
+	// repository is equivalent to itself.
+	report, err = repo.CompareContents(ctx, env.RepositoryWriter, env.RepositoryWriter, repo.CompareOptions{})
+	require.NoError(t, err)
+	require.True(t, report.Equivalent())
+	require.Zero(t, report.VerifiedCount)
+}
+
+func objectContentIDs(t *testing.T, rep repo.Repository, oid object.ID) []content.ID {
+	t.Helper()
+
+	cids, err := rep.VerifyObject(testlogging.Context(t), oid)
+	require.NoError(t, err)
+
+	return cids
+}
@@ -61,6 +61,15 @@ func compressionHeader(id HeaderID) []byte {
 	return b
 }
 
+// UnsupportedCompressorError is returned when decompressing data with an unknown compression header.
+type UnsupportedCompressorError struct {
+	HeaderID HeaderID
+}
+
+func (e UnsupportedCompressorError) Error() string {
+	return fmt.Sprintf("unsupported compressor %x", e.HeaderID)
+}
+
 // DecompressByHeader decodes compression header from the provided input and decompresses the remainder.
 func DecompressByHeader(output io.Writer, input io.Reader) error {
 	var b [compressionHeaderSize]byte
@@ -73,7 +82,7 @@ func DecompressByHeader(output io.Writer, input io.Reader) error {
 
 	compressor := ByHeaderID[compressorID]
 	if compressor == nil {
-		return errors.Errorf("unsupported compressor %x", compressorID)
+		return UnsupportedCompressorError{compressorID}
 	}
 
 	return errors.Wrap(compressor.Decompress(output, input, false), "error decompressing")
@@ -41,14 +41,7 @@ func getIndexBlobIV(s blob.ID) ([]byte, error) {
 // EncryptBLOB encrypts the given data using crypter-defined key and returns a name that should
 // be used to save the blob in thre repository.
 func EncryptBLOB(c crypter, payload gather.Bytes, prefix blob.ID, sessionID SessionID, output *gather.WriteBuffer) (blob.ID, error) {
-	var hashOutput [hashing.MaxHashSize]byte
-
-	hash := c.HashFunc()(hashOutput[:0], payload)
-	blobID := prefix + blob.ID(hex.EncodeToString(hash))
-
-	if sessionID != "" {
-		blobID += blob.ID("-" + sessionID)
-	}
+	blobID := encryptedBlobID(c, payload, prefix, sessionID)
 
 	iv, err := getIndexBlobIV(blobID)
 	if err != nil {
@@ -64,6 +57,20 @@ func EncryptBLOB(c crypter, payload gather.Bytes, prefix blob.ID, sessionID Sess
 	return blobID, nil
 }
 
+// encryptedBlobID returns the name under which EncryptBLOB saves the provided payload.
+func encryptedBlobID(c crypter, payload gather.Bytes, prefix blob.ID, sessionID SessionID) blob.ID {
+	var hashOutput [hashing.MaxHashSize]byte
+
+	hash := c.HashFunc()(hashOutput[:0], payload)
+	blobID := prefix + blob.ID(hex.EncodeToString(hash))
+
+	if sessionID != "" {
+		blobID += blob.ID("-" + sessionID)
+	}
+
+	return blobID
+}
+
 // DecryptBLOB decrypts the provided data using provided blobID to derive initialization vector.
 func DecryptBLOB(c crypter, payload gather.Bytes, blobID blob.ID, output *gather.WriteBuffer) error {
 	iv, err := getIndexBlobIV(blobID)
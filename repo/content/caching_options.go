@@ -19,6 +19,7 @@ type CachingOptions struct {
 	CacheDirectory            string          `json:"cacheDirectory,omitempty"`
 	MaxCacheSizeBytes         int64           `json:"maxCacheSize,omitempty"`
 	MaxMetadataCacheSizeBytes int64           `json:"maxMetadataCacheSize,omitempty"`
+	MaxObjectCacheSizeBytes   int64           `json:"maxObjectCacheSize,omitempty"`
 	MaxListCacheDuration      DurationSeconds `json:"maxListCacheDuration,omitempty"`
 	MinMetadataSweepAge       DurationSeconds `json:"minMetadataSweepAge,omitempty"`
 	MinContentSweepAge        DurationSeconds `json:"minContentSweepAge,omitempty"`
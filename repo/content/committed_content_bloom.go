@@ -0,0 +1,90 @@
+package content
+
+const (
+	// bloomFilterBitsPerEntry determines the size of the bloom filter relative to the number of
+	// contents in the index, 10 bits per entry with 7 hash functions yields ~1% false positive rate.
+	bloomFilterBitsPerEntry = 10
+	bloomFilterHashCount    = 7
+
+	// bloomFilterMinEntries is the minimum capacity of the bloom filter, which avoids frequent rebuilds
+	// of tiny filters as indexes are being added after each flush.
+	bloomFilterMinEntries = 1024
+
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// contentIDBloomFilter is an in-memory probabilistic set of content IDs.
+// It never returns false negatives, so when mayContain() returns false the content
+// is definitely not present in any of the indexes the filter was built from.
+type contentIDBloomFilter struct {
+	bits     []uint64
+	numBits  uint64
+	count    int
+	capacity int
+}
+
+func newContentIDBloomFilter(capacity int) *contentIDBloomFilter {
+	if capacity < bloomFilterMinEntries {
+		capacity = bloomFilterMinEntries
+	}
+
+	numBits := uint64(capacity) * bloomFilterBitsPerEntry
+	numWords := (numBits + 63) / 64 //nolint:gomnd
+
+	return &contentIDBloomFilter{
+		bits:     make([]uint64, numWords),
+		numBits:  numWords * 64, //nolint:gomnd
+		capacity: capacity,
+	}
+}
+
+// bloomHashPair returns two independent 64-bit hashes of the content ID used for double hashing.
+func bloomHashPair(contentID ID) (h1, h2 uint64) {
+	h := uint64(fnvOffset64)
+
+	if p := contentID.Prefix(); p != "" {
+		h ^= uint64(p[0])
+		h *= fnvPrime64
+	}
+
+	for _, b := range contentID.Hash() {
+		h ^= uint64(b)
+		h *= fnvPrime64
+	}
+
+	h1 = h
+
+	// derive second hash by mixing the first one (splitmix64 finalizer).
+	h2 = h + 0x9e3779b97f4a7c15                 //nolint:gomnd
+	h2 = (h2 ^ (h2 >> 30)) * 0xbf58476d1ce4e5b9 //nolint:gomnd
+	h2 = (h2 ^ (h2 >> 27)) * 0x94d049bb133111eb //nolint:gomnd
+	h2 ^= h2 >> 31                              //nolint:gomnd
+
+	// ensure the step is odd so that all probes are distinct.
+	return h1, h2 | 1
+}
+
+func (f *contentIDBloomFilter) add(contentID ID) {
+	h1, h2 := bloomHashPair(contentID)
+
+	for i := uint64(0); i < bloomFilterHashCount; i++ {
+		bit := (h1 + i*h2) % f.numBits
+		f.bits[bit/64] |= 1 << (bit % 64) //nolint:gomnd
+	}
+
+	f.count++
+}
+
+func (f *contentIDBloomFilter) mayContain(contentID ID) bool {
+	h1, h2 := bloomHashPair(contentID)
+
+	for i := uint64(0); i < bloomFilterHashCount; i++ {
+		bit := (h1 + i*h2) % f.numBits
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 { //nolint:gomnd
+			return false
+		}
+	}
+
+	return true
+}
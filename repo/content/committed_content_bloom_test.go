@@ -0,0 +1,151 @@
+package content
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content/index"
+)
+
+type lookupCountingIndex struct {
+	index.Index
+
+	lookups int
+}
+
+func (c *lookupCountingIndex) GetInfo(contentID ID) (Info, error) {
+	c.lookups++
+
+	//nolint:wrapcheck
+	return c.Index.GetInfo(contentID)
+}
+
+func TestContentIDBloomFilter_NoFalseNegatives(t *testing.T) {
+	t.Parallel()
+
+	bf := newContentIDBloomFilter(10000)
+
+	var ids []ID
+
+	for i := 0; i < 10000; i++ {
+		id := makeRandomHexID(t, 32)
+		ids = append(ids, id)
+		bf.add(id)
+	}
+
+	for _, id := range ids {
+		require.True(t, bf.mayContain(id), "false negative for %v", id)
+	}
+
+	falsePositives := 0
+
+	for i := 0; i < 10000; i++ {
+		if bf.mayContain(makeRandomHexID(t, 32)) {
+			falsePositives++
+		}
+	}
+
+	// expected false positive rate is ~1%, allow generous margin.
+	require.Less(t, falsePositives, 500)
+}
+
+func TestCommittedContentIndex_BloomFilterShortCircuitsAbsentContents(t *testing.T) {
+	t.Parallel()
+
+	c := newCommittedContentIndex(&CachingOptions{}, func() int { return 3 }, nil, nil, testlogging.Printf(t.Logf, ""), clock.Now, DefaultIndexCacheSweepAge)
+	c.bloomFilterEnabled = true
+
+	present := addRandomIndexBlob(t, c, "ndx1", 500)
+
+	c.mu.Lock()
+	counter := &lookupCountingIndex{Index: c.merged}
+	c.merged = index.Merged{counter}
+	c.mu.Unlock()
+
+	for _, id := range present {
+		_, err := c.getContent(id)
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, len(present), counter.lookups)
+
+	definitelyAbsent := 0
+
+	for i := 0; i < 1000; i++ {
+		id := makeRandomHexID(t, 32)
+
+		c.mu.RLock()
+		mayContain := c.bloom.mayContain(id)
+		c.mu.RUnlock()
+
+		before := counter.lookups
+
+		_, err := c.getContent(id)
+		require.ErrorIs(t, err, ErrContentNotFound)
+
+		if !mayContain {
+			definitelyAbsent++
+
+			require.Equal(t, before, counter.lookups, "unexpected index lookup for %v", id)
+		}
+	}
+
+	require.Greater(t, definitelyAbsent, 900)
+
+	// simulate flushes, the first one fits in the existing filter and the second one forces a rebuild.
+	c.mu.RLock()
+	bloomBefore := c.bloom
+	c.mu.RUnlock()
+
+	flushed := addRandomIndexBlob(t, c, "ndx2", 100)
+
+	c.mu.RLock()
+	require.Same(t, bloomBefore, c.bloom)
+	c.mu.RUnlock()
+
+	flushed = append(flushed, addRandomIndexBlob(t, c, "ndx3", 5000)...)
+
+	for _, id := range append(present, flushed...) {
+		_, err := c.getContent(id)
+		require.NoError(t, err, "content %v not found after flush", id)
+	}
+}
+
+func TestCommittedContentIndex_BloomFilterDisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	c := newCommittedContentIndex(&CachingOptions{}, func() int { return 3 }, nil, nil, testlogging.Printf(t.Logf, ""), clock.Now, DefaultIndexCacheSweepAge)
+
+	present := addRandomIndexBlob(t, c, "ndx1", 500)
+
+	c.mu.RLock()
+	require.Nil(t, c.bloom)
+	c.mu.RUnlock()
+
+	for _, id := range present {
+		_, err := c.getContent(id)
+		require.NoError(t, err)
+	}
+}
+
+func addRandomIndexBlob(t *testing.T, c *committedContentIndex, indexBlobID string, count int) []ID {
+	t.Helper()
+
+	b := index.Builder{}
+
+	var ids []ID
+
+	for i := 0; i < count; i++ {
+		id := makeRandomHexID(t, 32)
+		ids = append(ids, id)
+		b[id] = &InfoStruct{PackBlobID: "p1234", ContentID: id}
+	}
+
+	require.NoError(t, c.addIndexBlob(testlogging.Context(t), blob.ID(indexBlobID), mustBuildIndex(t, b), true))
+
+	return ids
+}
@@ -11,7 +11,6 @@
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
 
-	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/gather"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/content/index"
@@ -37,6 +36,11 @@ type committedContentIndex struct {
 	inUse map[blob.ID]index.Index
 	// +checklocks:mu
 	merged index.Merged
+	// +checklocks:mu
+	bloom *contentIDBloomFilter // nil if not built yet
+
+	// bloomFilterEnabled determines whether bloom is maintained.
+	bloomFilterEnabled bool
 
 	v1PerContentOverhead func() int
 	formatProvider       format.Provider
@@ -62,6 +66,11 @@ func (c *committedContentIndex) getContent(contentID ID) (Info, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
+	// short-circuit lookups of contents that are definitely not in any of the indexes.
+	if c.bloom != nil && !c.bloom.mayContain(contentID) {
+		return nil, ErrContentNotFound
+	}
+
 	info, err := c.merged.GetInfo(contentID)
 	if info != nil {
 		if shouldIgnore(info, c.deletionWatermark) {
@@ -120,9 +129,83 @@ func (c *committedContentIndex) addIndexBlob(ctx context.Context, indexBlobID bl
 	c.inUse[indexBlobID] = ndx
 	c.merged = append(c.merged, ndx)
 
+	c.addToBloomFilterLocked([]index.Index{ndx})
+
 	return nil
 }
 
+// addToBloomFilterLocked adds contents of the provided newly-used indexes to the content bloom filter,
+// building it from all indexes when it does not exist yet or is full. Contents of indexes that are
+// no longer in use stay in the filter, which only increases the false positive rate until the next rebuild.
+//
+// +checklocks:c.mu
+func (c *committedContentIndex) addToBloomFilterLocked(added []index.Index) {
+	if !c.bloomFilterEnabled {
+		return
+	}
+
+	if c.bloom != nil {
+		cnt := c.bloom.count
+
+		for _, ndx := range added {
+			cnt += ndx.ApproximateCount()
+		}
+
+		if cnt <= c.bloom.capacity {
+			for _, ndx := range added {
+				if err := addIndexToBloomFilter(c.bloom, ndx); err != nil {
+					c.log.Errorf("unable to update content bloom filter: %v", err)
+
+					c.bloom = nil
+
+					return
+				}
+			}
+
+			return
+		}
+	}
+
+	c.rebuildBloomFilterLocked()
+}
+
+// rebuildBloomFilterLocked rebuilds the content existence bloom filter from the current set of indexes.
+// On failure the filter is discarded and all lookups go to the index.
+//
+// +checklocks:c.mu
+func (c *committedContentIndex) rebuildBloomFilterLocked() {
+	capacity := 0
+
+	for _, ndx := range c.merged {
+		capacity += ndx.ApproximateCount()
+	}
+
+	// leave some headroom for indexes added by subsequent flushes.
+	bf := newContentIDBloomFilter(2 * capacity) //nolint:gomnd
+
+	for _, ndx := range c.merged {
+		if err := addIndexToBloomFilter(bf, ndx); err != nil {
+			c.log.Errorf("unable to build content bloom filter: %v", err)
+
+			c.bloom = nil
+
+			return
+		}
+	}
+
+	c.log.Debugw("rebuilt content bloom filter", "entries", bf.count, "capacity", bf.capacity)
+
+	c.bloom = bf
+}
+
+func addIndexToBloomFilter(bf *contentIDBloomFilter, ndx index.Index) error {
+	//nolint:wrapcheck
+	return ndx.Iterate(index.AllIDs, func(i Info) error {
+		bf.add(i.GetContentID())
+		return nil
+	})
+}
+
 func (c *committedContentIndex) listContents(r IDRange, cb func(i Info) error) error {
 	c.mu.RLock()
 	m := append(index.Merged(nil), c.merged...)
@@ -139,6 +222,25 @@ func (c *committedContentIndex) listContents(r IDRange, cb func(i Info) error) e
 	})
 }
 
+// entryCounts returns the total number of entries in all indexes in use and the number of distinct contents they describe.
+func (c *committedContentIndex) entryCounts() (totalEntries, distinctContents int, err error) {
+	c.mu.RLock()
+	m := append(index.Merged(nil), c.merged...)
+
+	for _, ndx := range c.inUse {
+		totalEntries += ndx.ApproximateCount()
+	}
+	c.mu.RUnlock()
+
+	err = m.Iterate(index.AllIDs, func(i Info) error {
+		distinctContents++
+		return nil
+	})
+
+	//nolint:wrapcheck
+	return totalEntries, distinctContents, err
+}
+
 // +checklocks:c.mu
 func (c *committedContentIndex) indexFilesChanged(indexFiles []blob.ID) bool {
 	if len(indexFiles) != len(c.inUse) {
@@ -218,6 +320,16 @@ func (c *committedContentIndex) use(ctx context.Context, indexFiles []blob.ID, i
 	oldInUse := c.inUse
 	c.inUse = newInUse
 
+	var added []index.Index
+
+	for k, ndx := range newInUse {
+		if oldInUse[k] == nil {
+			added = append(added, ndx)
+		}
+	}
+
+	c.addToBloomFilterLocked(added)
+
 	// close indices that were previously in use but are no longer.
 	for k, old := range oldInUse {
 		if newInUse[k] == nil {
@@ -358,13 +470,14 @@ func newCommittedContentIndex(caching *CachingOptions,
 	formatProvider format.Provider,
 	fetchOne func(ctx context.Context, blobID blob.ID, output *gather.WriteBuffer) error,
 	log logging.Logger,
+	timeNow func() time.Time,
 	minSweepAge time.Duration,
 ) *committedContentIndex {
 	var cache committedContentIndexCache
 
 	if caching.CacheDirectory != "" {
 		dirname := filepath.Join(caching.CacheDirectory, "indexes")
-		cache = &diskCommittedContentIndexCache{dirname, clock.Now, v1PerContentOverhead, log, minSweepAge}
+		cache = &diskCommittedContentIndexCache{dirname, timeNow, v1PerContentOverhead, log, minSweepAge}
 	} else {
 		cache = &memoryCommittedContentIndexCache{
 			contents:             map[blob.ID]index.Index{},
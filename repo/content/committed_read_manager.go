@@ -46,6 +46,7 @@
 	LegacyIndexBlobPrefix,
 	compactionLogBlobPrefix,
 	cleanupBlobPrefix,
+	compactionIntentBlobPrefix,
 
 	epoch.UncompactedIndexBlobPrefix,
 	epoch.EpochMarkerIndexBlobPrefix,
@@ -68,6 +69,7 @@ type indexBlobManager interface {
 	compact(ctx context.Context, opts CompactOptions) error
 	flushCache(ctx context.Context)
 	invalidate(ctx context.Context)
+	refreshListCache(ctx context.Context) error
 }
 
 // SharedManager is responsible for read-only access to committed data.
@@ -90,6 +92,15 @@ type SharedManager struct {
 	enc               *encryptedBlobMgr
 	timeNow           func() time.Time
 
+	maxPendingPackWrites int  // maximum number of packs concurrently written to the storage, 0 = unlimited
+	deterministic        bool // see ManagerOptions.Deterministic
+
+	skipContentMACVerification bool    // see ManagerOptions.SkipContentMACVerification
+	readVerifyProbability      float64 // see ManagerOptions.ReadVerifyProbability
+	contentBloomFilter         bool    // see ManagerOptions.ContentBloomFilter
+
+	flushCoordinator *flushCoordinator // nil unless ManagerOptions.FlushCoalescingWindow is set
+
 	// lock to protect the set of commtited indexes
 	// shared lock will be acquired when writing new content to allow it to happen in parallel
 	// exclusive lock will be acquired during compaction or refresh.
@@ -147,6 +158,14 @@ func (sm *SharedManager) attemptReadPackFileLocalIndex(ctx context.Context, pack
 		return errors.Wrapf(err, "error getting blob %v", packFile)
 	}
 
+	return sm.decryptPackFileLocalIndex(packFile, &payload, offset, output)
+}
+
+// decryptPackFileLocalIndex decrypts the local index of the pack blob, given the payload of the pack
+// blob starting at the provided offset.
+func (sm *SharedManager) decryptPackFileLocalIndex(packFile blob.ID, payload *gather.WriteBuffer, offset int64, output *gather.WriteBuffer) error {
+	output.Reset()
+
 	postamble := findPostamble(payload.Bytes().ToByteSlice())
 	if postamble == nil {
 		return errors.Errorf("unable to find valid postamble in file %v", packFile)
@@ -267,16 +286,18 @@ func (sm *SharedManager) decryptContentAndVerify(payload gather.Bytes, bi Info,
 
 	h := bi.GetCompressionHeaderID()
 	if h == 0 {
-		return errors.Wrapf(
-			sm.decryptAndVerify(payload, iv, output),
-			"invalid checksum at %v offset %v length %v/%v", bi.GetPackBlobID(), bi.GetPackOffset(), bi.GetPackedLength(), payload.Length())
+		if err := sm.decryptAndVerify(payload, iv, output); err != nil {
+			return corruptContentError{errors.Wrapf(err, "invalid checksum at %v offset %v length %v/%v", bi.GetPackBlobID(), bi.GetPackOffset(), bi.GetPackedLength(), payload.Length())}
+		}
+
+		return nil
 	}
 
 	var tmp gather.WriteBuffer
 	defer tmp.Close()
 
 	if err := sm.decryptAndVerify(payload, iv, &tmp); err != nil {
-		return errors.Wrapf(err, "invalid checksum at %v offset %v length %v/%v", bi.GetPackBlobID(), bi.GetPackOffset(), bi.GetPackedLength(), payload.Length())
+		return corruptContentError{errors.Wrapf(err, "invalid checksum at %v offset %v length %v/%v", bi.GetPackBlobID(), bi.GetPackOffset(), bi.GetPackedLength(), payload.Length())}
 	}
 
 	c := compression.ByHeaderID[h]
@@ -285,16 +306,34 @@ func (sm *SharedManager) decryptContentAndVerify(payload gather.Bytes, bi Info,
 	}
 
 	if err := c.Decompress(output, tmp.Bytes().Reader(), true); err != nil {
-		return errors.Wrap(err, "error decompressing")
+		return corruptContentError{errors.Wrap(err, "error decompressing")}
 	}
 
 	return nil
 }
 
+// macSkippingDecryptor is implemented by encryptors that attach a keyed MAC to each content
+// and can decrypt without verifying it.
+type macSkippingDecryptor interface {
+	DecryptSkippingMAC(cipherText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error
+}
+
+func (sm *SharedManager) decrypt(encrypted gather.Bytes, iv []byte, output *gather.WriteBuffer) error {
+	enc := sm.format.Encryptor()
+
+	if sm.skipContentMACVerification {
+		if d, ok := enc.(macSkippingDecryptor); ok {
+			return errors.Wrap(d.DecryptSkippingMAC(encrypted, iv, output), "decrypt without MAC verification")
+		}
+	}
+
+	return errors.Wrap(enc.Decrypt(encrypted, iv, output), "decrypt")
+}
+
 func (sm *SharedManager) decryptAndVerify(encrypted gather.Bytes, iv []byte, output *gather.WriteBuffer) error {
-	if err := sm.format.Encryptor().Decrypt(encrypted, iv, output); err != nil {
+	if err := sm.decrypt(encrypted, iv, output); err != nil {
 		sm.Stats.foundInvalidContent()
-		return errors.Wrap(err, "decrypt")
+		return err
 	}
 
 	sm.Stats.foundValidContent()
@@ -304,6 +343,13 @@ func (sm *SharedManager) decryptAndVerify(encrypted gather.Bytes, iv []byte, out
 	return nil
 }
 
+// ExtendBlobRetention extends the retention of the provided blobs until the given time, which allows
+// maintenance to keep blobs that are still in use locked while letting unused ones expire.
+// Returns blob.ErrRetentionExtensionUnsupported if the storage does not support it.
+func (sm *SharedManager) ExtendBlobRetention(ctx context.Context, blobIDs []blob.ID, until time.Time) error {
+	return errors.Wrap(blob.ExtendRetention(ctx, sm.st, blobIDs, until, parallelFetches), "unable to extend blob retention")
+}
+
 // IndexBlobs returns the list of active index blobs.
 func (sm *SharedManager) IndexBlobs(ctx context.Context, includeInactive bool) ([]IndexBlobInfo, error) {
 	if includeInactive {
@@ -476,7 +522,9 @@ func (sm *SharedManager) setupReadManagerCaches(ctx context.Context, caching *Ca
 		sm.format,
 		sm.enc.getEncryptedBlob,
 		sm.namedLogger("committed-content-index"),
+		sm.timeNow,
 		caching.MinIndexSweepAge.DurationOrDefault(DefaultIndexCacheSweepAge))
+	sm.committedContents.bloomFilterEnabled = sm.contentBloomFilter
 
 	return nil
 }
@@ -552,6 +600,13 @@ func (sm *SharedManager) release(ctx context.Context) error {
 
 	sm.indexBlobManagerV1.epochMgr.Flush()
 
+	// make sure blobs written while closing (such as logs) are durable.
+	if err := blob.Sync(ctx, sm.st); err != nil {
+		sm.st.Close(ctx) //nolint:errcheck
+
+		return errors.Wrap(err, "error syncing storage")
+	}
+
 	return errors.Wrap(sm.st.Close(ctx), "error closing storage")
 }
 
@@ -577,8 +632,20 @@ func NewSharedManager(ctx context.Context, st blob.Storage, prov format.Provider
 		opts.TimeNow = clock.Now
 	}
 
+	if opts.Deterministic {
+		df, err := newDeterministicFormat(prov)
+		if err != nil {
+			return nil, err
+		}
+
+		prov = df
+
+		// internal logs are named and timestamped using the clock.
+		opts.DisableInternalLog = true
+	}
+
 	// create internal logger that will be writing logs as encrypted repository blobs.
-	ilm := newInternalLogManager(ctx, st, prov)
+	ilm := newInternalLogManager(ctx, st, prov, opts.TimeNow)
 
 	// sharedBaseLogger writes to the both context and internal log
 	// and is used as a base for all content manager components.
@@ -590,22 +657,32 @@ func NewSharedManager(ctx context.Context, st blob.Storage, prov format.Provider
 	}
 
 	sm := &SharedManager{
-		st:                      st,
-		Stats:                   new(Stats),
-		timeNow:                 opts.TimeNow,
-		format:                  prov,
-		minPreambleLength:       defaultMinPreambleLength,
-		maxPreambleLength:       defaultMaxPreambleLength,
-		paddingUnit:             defaultPaddingUnit,
-		checkInvariantsOnUnlock: os.Getenv("KOPIA_VERIFY_INVARIANTS") != "",
-		internalLogManager:      ilm,
-		internalLogger:          internalLog,
-		contextLogger:           logging.Module(FormatLogModule)(ctx),
+		st:                         st,
+		Stats:                      new(Stats),
+		timeNow:                    opts.TimeNow,
+		maxPendingPackWrites:       opts.MaxPendingPackWrites,
+		deterministic:              opts.Deterministic,
+		skipContentMACVerification: opts.SkipContentMACVerification,
+		readVerifyProbability:      opts.ReadVerifyProbability,
+		contentBloomFilter:         opts.ContentBloomFilter,
+		flushCoordinator:           newFlushCoordinator(opts.FlushCoalescingWindow),
+		format:                     prov,
+		minPreambleLength:          defaultMinPreambleLength,
+		maxPreambleLength:          defaultMaxPreambleLength,
+		paddingUnit:                defaultPaddingUnit,
+		checkInvariantsOnUnlock:    os.Getenv("KOPIA_VERIFY_INVARIANTS") != "",
+		internalLogManager:         ilm,
+		internalLogger:             internalLog,
+		contextLogger:              logging.Module(FormatLogModule)(ctx),
 	}
 
 	// remember logger defined for the context.
 	sm.log = sm.namedLogger("shared-manager")
 
+	if sm.skipContentMACVerification {
+		sm.log.Warnf("WARNING: content MAC verification is disabled, tampered contents may go undetected")
+	}
+
 	caching = caching.CloneOrDefault()
 
 	if err := sm.setupReadManagerCaches(ctx, caching); err != nil {
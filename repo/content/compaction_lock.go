@@ -0,0 +1,190 @@
+package content
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/ctxutil"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/timetrack"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const (
+	// compactionLockBlobPrefix is the prefix of blobs that indicate that index compaction is in progress.
+	compactionLockBlobPrefix blob.ID = "zcompactionlock-"
+
+	// compactionLockTTL is the time after which the lock left behind by a client that crashed during compaction
+	// is ignored.
+	compactionLockTTL = 2 * time.Hour
+
+	// compactionLockRenewInterval is how often the lock is renewed while compaction is running,
+	// so that long compactions don't lose it.
+	compactionLockRenewInterval = compactionLockTTL / 4
+
+	// waiting clients retry after the interval plus random jitter, so that clients which backed off
+	// at the same time don't keep colliding.
+	compactionLockRetryInterval = 1 * time.Second
+	compactionLockRetryJitter   = 1 * time.Second
+)
+
+// ErrCompactionLocked is returned by CompactIndexes when another client is compacting indexes.
+var ErrCompactionLocked = errors.New("index compaction is already in progress")
+
+// compactionLock is the payload of the compaction lock blob.
+type compactionLock struct {
+	Expires time.Time `json:"expires"`
+}
+
+// acquireCompactionLock acquires the repository-wide compaction lock, waiting up to the provided duration
+// for it to be released by other clients, and returns the function that releases it.
+func (sm *SharedManager) acquireCompactionLock(ctx context.Context, wait time.Duration) (release func(), err error) {
+	timer := timetrack.StartTimer()
+
+	for {
+		release, err := sm.tryAcquireCompactionLock(ctx)
+		if !errors.Is(err, ErrCompactionLocked) {
+			return release, err
+		}
+
+		if timer.Elapsed() >= wait {
+			return nil, err
+		}
+
+		sm.log.Debugf("waiting for index compaction lock")
+
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "error waiting for index compaction lock")
+
+		case <-time.After(compactionLockRetryInterval + time.Duration(rand.Int63n(int64(compactionLockRetryJitter)))): //nolint:gosec
+		}
+	}
+}
+
+// tryAcquireCompactionLock writes a new lock blob unless a valid lock exists and verifies that no other
+// client has written its own lock in the meantime, in which case the new lock is removed.
+func (sm *SharedManager) tryAcquireCompactionLock(ctx context.Context) (release func(), err error) {
+	if err := sm.verifyNoCompactionLock(ctx, ""); err != nil {
+		return nil, err
+	}
+
+	var rnd [8]byte
+
+	if _, err := cryptorand.Read(rnd[:]); err != nil {
+		return nil, errors.Wrap(err, "error generating random lock ID")
+	}
+
+	lockID := compactionLockBlobPrefix + blob.ID(hex.EncodeToString(rnd[:]))
+
+	if err := sm.writeCompactionLock(ctx, lockID); err != nil {
+		return nil, err
+	}
+
+	// the lock must be released and renewed even if the context is canceled.
+	detachedCtx := ctxutil.Detach(ctx)
+
+	deleteLock := func() {
+		if err := sm.st.DeleteBlob(detachedCtx, lockID); err != nil {
+			sm.log.Errorf("unable to release compaction lock %v: %v", lockID, err)
+		}
+	}
+
+	if err := sm.verifyNoCompactionLock(ctx, lockID); err != nil {
+		// another client wrote the lock at the same time, both back off.
+		deleteLock()
+		return nil, err
+	}
+
+	stopRenewing := make(chan struct{})
+	renewerDone := make(chan struct{})
+
+	go func() {
+		defer close(renewerDone)
+
+		ticker := time.NewTicker(compactionLockRenewInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopRenewing:
+				return
+
+			case <-ticker.C:
+				if err := sm.writeCompactionLock(detachedCtx, lockID); err != nil {
+					sm.log.Errorf("unable to renew compaction lock %v: %v", lockID, err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(stopRenewing)
+		<-renewerDone
+
+		deleteLock()
+	}, nil
+}
+
+// writeCompactionLock writes or renews the lock blob with the provided ID.
+func (sm *SharedManager) writeCompactionLock(ctx context.Context, lockID blob.ID) error {
+	payload, err := json.Marshal(&compactionLock{Expires: sm.timeNow().Add(compactionLockTTL)})
+	if err != nil {
+		return errors.Wrap(err, "error serializing compaction lock")
+	}
+
+	if err := sm.st.PutBlob(ctx, lockID, gather.FromSlice(payload), blob.PutOptions{}); err != nil {
+		return errors.Wrap(err, "error writing compaction lock")
+	}
+
+	return nil
+}
+
+// verifyNoCompactionLock returns ErrCompactionLocked if there's a valid compaction lock other than the provided one.
+func (sm *SharedManager) verifyNoCompactionLock(ctx context.Context, ignoreID blob.ID) error {
+	locks, err := blob.ListAllBlobs(ctx, sm.st, compactionLockBlobPrefix)
+	if err != nil {
+		return errors.Wrap(err, "error listing compaction locks")
+	}
+
+	for _, bm := range locks {
+		if bm.BlobID == ignoreID {
+			continue
+		}
+
+		var (
+			data gather.WriteBuffer
+			l    compactionLock
+		)
+
+		err := sm.st.GetBlob(ctx, bm.BlobID, 0, -1, &data)
+		if err == nil {
+			err = json.Unmarshal(data.ToByteSlice(), &l)
+		}
+
+		data.Close()
+
+		switch {
+		case errors.Is(err, blob.ErrBlobNotFound):
+			// released in the meantime.
+			continue
+
+		case err != nil:
+			return errors.Wrapf(err, "error reading compaction lock %v", bm.BlobID)
+
+		case sm.timeNow().After(l.Expires):
+			sm.log.Debugf("ignoring expired compaction lock %v", bm.BlobID)
+			continue
+		}
+
+		return errors.Wrapf(ErrCompactionLocked, "locked by %v until %v", bm.BlobID, l.Expires)
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package content
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/compression"
+)
+
+// ContentExport contains raw bytes of a content as stored in its pack blob along with
+// its index metadata and results of verification, intended for forensic analysis.
+type ContentExport struct {
+	ContentID           ID                   `json:"contentID"`
+	PackBlobID          blob.ID              `json:"packFile"`
+	PackOffset          uint32               `json:"packOffset"`
+	PackedLength        uint32               `json:"length"`
+	OriginalLength      uint32               `json:"originalLength"`
+	CompressionHeaderID compression.HeaderID `json:"compression,omitempty"`
+	Deleted             bool                 `json:"deleted,omitempty"`
+
+	// ExpectedHash is the hash encoded in the content ID.
+	ExpectedHash []byte `json:"expectedHash"`
+
+	// ComputedHash is the hash of the decrypted and decompressed payload, empty if the payload could not be decrypted.
+	ComputedHash []byte `json:"computedHash,omitempty"`
+
+	// HashMatches is true when the computed hash is identical to the expected one.
+	HashMatches bool `json:"hashMatches"`
+
+	// Error describes why the payload could not be decrypted or decompressed, if applicable.
+	Error string `json:"error,omitempty"`
+
+	// RawData holds the bytes of the content read directly from the pack blob, bypassing the cache.
+	RawData []byte `json:"-"`
+}
+
+// ExportContent returns raw bytes of the content as stored in its pack blob along with its index metadata.
+// Unlike GetContent() it succeeds when the payload is corrupted, reporting the problem in the result.
+// The content must have been flushed to the storage.
+func (bm *WriteManager) ExportContent(ctx context.Context, contentID ID) (*ContentExport, error) {
+	bi, err := bm.ContentInfo(ctx, contentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload, output gather.WriteBuffer
+	defer payload.Close()
+	defer output.Close()
+
+	if err := bm.st.GetBlob(ctx, bi.GetPackBlobID(), int64(bi.GetPackOffset()), int64(bi.GetPackedLength()), &payload); err != nil {
+		return nil, errors.Wrapf(err, "error reading content %v from pack %v", contentID, bi.GetPackBlobID())
+	}
+
+	result := &ContentExport{
+		ContentID:           contentID,
+		PackBlobID:          bi.GetPackBlobID(),
+		PackOffset:          bi.GetPackOffset(),
+		PackedLength:        bi.GetPackedLength(),
+		OriginalLength:      bi.GetOriginalLength(),
+		CompressionHeaderID: bi.GetCompressionHeaderID(),
+		Deleted:             bi.GetDeleted(),
+		ExpectedHash:        contentID.Hash(),
+		RawData:             payload.ToByteSlice(),
+	}
+
+	if err := bm.decryptContentAndVerify(payload.Bytes(), bi, &output); err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	result.ComputedHash = bm.format.HashFunc()(nil, output.Bytes())
+	result.HashMatches = bytes.Equal(result.ComputedHash, result.ExpectedHash)
+
+	if !result.HashMatches {
+		result.Error = "hash mismatch"
+	}
+
+	return result, nil
+}
@@ -0,0 +1,383 @@
+package content
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content/index"
+	"github.com/kopia/kopia/repo/format"
+)
+
+// flushCoordinator coalesces pending contents of write managers flushing concurrently into shared packs,
+// which results in fewer, larger packs than each of them writing its own partially-filled packs.
+//
+// Write managers flushing within the coalescing window of the first one join the same flush group.
+// When the window elapses, contents of the whole group are laid out into packs, storing contents
+// pending in more than one participant only once. Each pack is then written by one of the participants
+// under its own session and referenced from its own index, so that the pack is protected from blob GC
+// the same way as packs written without coalescing.
+type flushCoordinator struct {
+	window time.Duration
+
+	mu sync.Mutex
+	// +checklocks:mu
+	current *coalescedFlush
+}
+
+// coalescedFlush is a group of contents being flushed together.
+type coalescedFlush struct {
+	// closed once the group no longer accepts participants and packs have been assigned.
+	laidOut chan struct{}
+
+	// participants of the group, protected by flushCoordinator.mu until the group is laid out.
+	participants []*flushParticipant
+
+	// packs of the group and the pack of each content, immutable once the group is laid out.
+	packs         []*coalescedPack
+	packByContent map[ID]*coalescedPack
+
+	// number of packs not yet finished, data of all contents is released once it drops to zero.
+	remainingPacks int32
+}
+
+// flushParticipant is a write manager taking part in a coalesced flush.
+type flushParticipant struct {
+	bm       *WriteManager
+	contents []*coalescedContent
+}
+
+// coalescedContent is a copy of a pending content of one of the participants.
+// The data is owned by the flush group and released once all its packs have been finished,
+// so participants are free to leave it at any time.
+type coalescedContent struct {
+	info Info
+	data gather.WriteBuffer
+}
+
+// coalescedPack is a pack written by its owner on behalf of the flush group.
+type coalescedPack struct {
+	prefix   blob.ID
+	owner    *flushParticipant
+	contents []*coalescedContent
+	size     int
+
+	// closed by finishPack after populating the results.
+	done  chan struct{}
+	infos index.Builder
+	err   error
+}
+
+func newFlushCoordinator(window time.Duration) *flushCoordinator {
+	if window <= 0 {
+		return nil
+	}
+
+	return &flushCoordinator{window: window}
+}
+
+// join adds the participant to the current flush group, starting a new one if none is open,
+// and returns the group once it has been laid out. When the context is canceled before that,
+// the participant leaves the group and its contents are not written.
+func (c *flushCoordinator) join(ctx context.Context, p *flushParticipant, maxPackSize int) (*coalescedFlush, error) {
+	c.mu.Lock()
+
+	g := c.current
+	if g == nil {
+		g = &coalescedFlush{laidOut: make(chan struct{})}
+		c.current = g
+
+		time.AfterFunc(c.window, func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			c.current = nil
+
+			g.layOut(maxPackSize)
+		})
+	}
+
+	g.participants = append(g.participants, p)
+
+	c.mu.Unlock()
+
+	select {
+	case <-g.laidOut:
+		return g, nil
+
+	case <-ctx.Done():
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-g.laidOut:
+		// too late to leave, release packs assigned to this participant.
+		g.abandonPacks(p, ctx.Err())
+
+	default:
+		g.participants = removeFlushParticipant(g.participants, p)
+		p.releaseContents()
+	}
+
+	return nil, errors.Wrap(ctx.Err(), "coalesced flush canceled")
+}
+
+// layOut distributes contents of all participants into packs and assigns each pack to the participant
+// that contributed its first content.
+func (g *coalescedFlush) layOut(maxPackSize int) {
+	current := map[blob.ID]*coalescedPack{}
+
+	g.packByContent = map[ID]*coalescedPack{}
+
+	for _, p := range g.participants {
+		for _, cc := range p.contents {
+			cid := cc.info.GetContentID()
+
+			// identical contents pending in multiple participants are stored once.
+			if g.packByContent[cid] != nil {
+				continue
+			}
+
+			prefix := packPrefixForContentID(cid)
+
+			cp := current[prefix]
+			if cp == nil {
+				cp = &coalescedPack{prefix: prefix, owner: p, done: make(chan struct{})}
+				current[prefix] = cp
+				g.packs = append(g.packs, cp)
+			}
+
+			cp.contents = append(cp.contents, cc)
+			cp.size += cc.data.Length()
+			g.packByContent[cid] = cp
+
+			if cp.size >= maxPackSize {
+				delete(current, prefix)
+			}
+		}
+	}
+
+	g.remainingPacks = int32(len(g.packs))
+
+	if len(g.packs) == 0 {
+		g.releaseContents()
+	}
+
+	close(g.laidOut)
+}
+
+// finishPack records the result of writing the provided pack and notifies the waiting participants.
+func (g *coalescedFlush) finishPack(cp *coalescedPack, infos index.Builder, err error) {
+	cp.infos, cp.err = infos, err
+	close(cp.done)
+
+	if atomic.AddInt32(&g.remainingPacks, -1) == 0 {
+		g.releaseContents()
+	}
+}
+
+// abandonPacks fails all packs owned by the provided participant.
+func (g *coalescedFlush) abandonPacks(p *flushParticipant, err error) {
+	for _, cp := range g.packs {
+		if cp.owner == p {
+			g.finishPack(cp, nil, err)
+		}
+	}
+}
+
+func (g *coalescedFlush) releaseContents() {
+	for _, p := range g.participants {
+		p.releaseContents()
+	}
+}
+
+func (p *flushParticipant) releaseContents() {
+	for _, cc := range p.contents {
+		cc.data.Close()
+	}
+}
+
+// wait waits until the packs storing the provided contents have been written
+// and returns information about the contents in these packs.
+func (g *coalescedFlush) wait(ctx context.Context, contents []*coalescedContent) (map[ID]Info, error) {
+	result := map[ID]Info{}
+
+	for _, cc := range contents {
+		cid := cc.info.GetContentID()
+		cp := g.packByContent[cid]
+
+		select {
+		case <-cp.done:
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "coalesced flush canceled")
+		}
+
+		if cp.err != nil {
+			return nil, errors.Wrapf(cp.err, "error writing coalesced pack of %v", cid)
+		}
+
+		result[cid] = cp.infos[cid]
+	}
+
+	return result, nil
+}
+
+func removeFlushParticipant(slice []*flushParticipant, p *flushParticipant) []*flushParticipant {
+	var result []*flushParticipant
+
+	for _, v := range slice {
+		if v != p {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+// coalesceAllPacksLocked writes all pending packs as part of a coalesced flush and adds their contents to the index.
+// The lock is released while waiting for other participants, during which the pending packs are kept
+// in writingPacks, so that their contents remain readable.
+//
+// +checklocks:bm.mu
+func (bm *WriteManager) coalesceAllPacksLocked(ctx context.Context, mp format.MutableParameters) error {
+	var pps []*pendingPackInfo
+
+	p := &flushParticipant{bm: bm}
+
+	for prefix, pp := range bm.pendingPacks {
+		delete(bm.pendingPacks, prefix)
+		pps = append(pps, pp)
+
+		for _, info := range pp.currentPackItems {
+			if info.GetPackBlobID() != pp.packBlobID {
+				// deletion markers of contents in other packs don't have any data.
+				bm.packIndexBuilder.Add(info)
+				continue
+			}
+
+			cc := &coalescedContent{info: info}
+
+			if err := pp.currentPackData.AppendSectionTo(&cc.data, int(info.GetPackOffset()), int(info.GetPackedLength())); err != nil {
+				cc.data.Close()
+				p.releaseContents()
+				bm.failedPacks = append(bm.failedPacks, pps...)
+
+				return errors.Wrapf(err, "unable to copy %v to coalesced flush", info.GetContentID())
+			}
+
+			p.contents = append(p.contents, cc)
+		}
+	}
+
+	if len(p.contents) == 0 {
+		for _, pp := range pps {
+			pp.currentPackData.Close()
+		}
+
+		return nil
+	}
+
+	bm.writingPacks = append(bm.writingPacks, pps...)
+
+	bm.unlock()
+	infos, ownPacks, err := bm.participateInCoalescedFlush(ctx, p, mp)
+	bm.lock()
+
+	defer bm.cond.Broadcast()
+
+	for _, pp := range pps {
+		bm.writingPacks = removePendingPack(bm.writingPacks, pp)
+	}
+
+	// packs written by this participant must be referenced by its own index, even if the flush failed otherwise.
+	for _, info := range ownPacks {
+		bm.packIndexBuilder.Add(info)
+	}
+
+	if err != nil {
+		// retry writing the packs independently later.
+		bm.failedPacks = append(bm.failedPacks, pps...)
+
+		return errors.Wrap(err, "error writing coalesced packs")
+	}
+
+	for _, info := range infos {
+		bm.packIndexBuilder.Add(info)
+	}
+
+	for _, pp := range pps {
+		pp.currentPackData.Close()
+	}
+
+	return nil
+}
+
+// participateInCoalescedFlush joins the flush group, writes packs assigned to the participant
+// and waits for the remaining packs storing its contents. It returns information about the contents
+// of the participant and about all contents of the packs it has written.
+func (bm *WriteManager) participateInCoalescedFlush(ctx context.Context, p *flushParticipant, mp format.MutableParameters) (infos map[ID]Info, ownPacks index.Builder, err error) {
+	g, err := bm.flushCoordinator.join(ctx, p, mp.MaxPackSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ownPacks = index.Builder{}
+
+	for _, cp := range g.packs {
+		if cp.owner != p {
+			continue
+		}
+
+		packInfos, packErr := bm.writeCoalescedPack(ctx, cp)
+
+		for _, info := range packInfos {
+			ownPacks.Add(info)
+		}
+
+		g.finishPack(cp, packInfos, packErr)
+	}
+
+	infos, err = g.wait(ctx, p.contents)
+
+	return infos, ownPacks, err
+}
+
+// writeCoalescedPack writes the contents of the provided coalesced pack into a new pack
+// of the current session and returns information about the contents in the new pack.
+func (bm *WriteManager) writeCoalescedPack(ctx context.Context, cp *coalescedPack) (index.Builder, error) {
+	bm.lock()
+
+	pp, err := bm.newPendingPackInfoLocked(ctx, cp.prefix)
+	if err != nil {
+		bm.unlock()
+		return nil, errors.Wrap(err, "unable to create pending pack")
+	}
+
+	defer pp.currentPackData.Close()
+
+	for _, cc := range cp.contents {
+		info := *index.ToInfoStruct(cc.info)
+		info.PackBlobID = pp.packBlobID
+		info.PackOffset = uint32(pp.currentPackData.Length())
+
+		pp.currentPackData.Append(cc.data.Bytes().ToByteSlice())
+		pp.currentPackItems[info.ContentID] = &info
+	}
+
+	err = bm.assignDeterministicPackBlobIDLocked(pp)
+
+	bm.unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bm.prepareAndWritePackInternal(ctx, pp, bm.onUpload)
+}
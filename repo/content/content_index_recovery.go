@@ -22,7 +22,64 @@ func (bm *WriteManager) RecoverIndexFromPackBlob(ctx context.Context, packFile b
 		return nil, err
 	}
 
-	ndx, err := index.Open(localIndexBytes.Bytes().ToByteSlice(), nil, bm.format.Encryptor().Overhead)
+	recovered, err := bm.parseRecoveredLocalIndex(packFile, &localIndexBytes)
+
+	if commit {
+		bm.commitRecoveredIndexEntries(recovered)
+	}
+
+	return recovered, err
+}
+
+// RecoverVerifiedIndexFromPackBlob is like RecoverIndexFromPackBlob, but reads the entire pack blob and only
+// recovers entries whose contents can be decrypted and hash to their content IDs.
+// Returns the recovered entries and the number of entries that failed verification.
+func (bm *WriteManager) RecoverVerifiedIndexFromPackBlob(ctx context.Context, packFile blob.ID, commit bool) ([]Info, int, error) {
+	var packData, localIndexBytes, contentData gather.WriteBuffer
+	defer packData.Close()
+	defer localIndexBytes.Close()
+	defer contentData.Close()
+
+	if err := bm.st.GetBlob(ctx, packFile, 0, -1, &packData); err != nil {
+		return nil, 0, errors.Wrapf(err, "error getting blob %v", packFile)
+	}
+
+	if err := bm.decryptPackFileLocalIndex(packFile, &packData, 0, &localIndexBytes); err != nil {
+		return nil, 0, err
+	}
+
+	recovered, err := bm.parseRecoveredLocalIndex(packFile, &localIndexBytes)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		valid   []Info
+		invalid int
+	)
+
+	for _, i := range recovered {
+		if verr := bm.verifyPackedContent(&packData, i, &contentData); verr != nil {
+			bm.log.Errorf("invalid content %v in %v: %v", i.GetContentID(), packFile, verr)
+
+			invalid++
+
+			continue
+		}
+
+		valid = append(valid, i)
+	}
+
+	if commit {
+		bm.commitRecoveredIndexEntries(valid)
+	}
+
+	return valid, invalid, nil
+}
+
+// parseRecoveredLocalIndex returns the entries of the decrypted local index of a pack blob.
+func (sm *SharedManager) parseRecoveredLocalIndex(packFile blob.ID, localIndexBytes *gather.WriteBuffer) ([]Info, error) {
+	ndx, err := index.Open(localIndexBytes.Bytes().ToByteSlice(), nil, sm.format.Encryptor().Overhead)
 	if err != nil {
 		return nil, errors.Errorf("unable to open index in file %v", packFile)
 	}
@@ -40,16 +97,40 @@ func (bm *WriteManager) RecoverIndexFromPackBlob(ctx context.Context, packFile b
 		return nil
 	})
 
-	if commit {
-		bm.lock()
-		defer bm.unlock()
+	return recovered, errors.Wrap(err, "error iterating index entries")
+}
 
-		for _, is := range recovered {
-			bm.packIndexBuilder.Add(is)
-		}
+// verifyPackedContent decrypts the content described by the provided entry from the full payload of its pack blob
+// and ensures that its hash matches the content ID.
+func (sm *SharedManager) verifyPackedContent(packData *gather.WriteBuffer, bi Info, output *gather.WriteBuffer) error {
+	var payload gather.WriteBuffer
+	defer payload.Close()
+
+	if int64(bi.GetPackOffset())+int64(bi.GetPackedLength()) > int64(packData.Length()) {
+		return errors.Errorf("content out of bounds of its pack blob")
 	}
 
-	return recovered, errors.Wrap(err, "error iterating index entries")
+	if err := packData.AppendSectionTo(&payload, int(bi.GetPackOffset()), int(bi.GetPackedLength())); err != nil {
+		return errors.Wrap(err, "error reading content")
+	}
+
+	output.Reset()
+
+	if err := sm.decryptContentAndVerify(payload.Bytes(), bi, output); err != nil {
+		return err
+	}
+
+	return sm.verifyContentHash(bi, output)
+}
+
+// commitRecoveredIndexEntries adds the provided entries to the index, which gets written on the next Flush().
+func (bm *WriteManager) commitRecoveredIndexEntries(infos []Info) {
+	bm.lock()
+	defer bm.unlock()
+
+	for _, is := range infos {
+		bm.packIndexBuilder.Add(is)
+	}
 }
 
 type packContentPostamble struct {
@@ -176,7 +257,12 @@ func (sm *SharedManager) buildLocalIndex(pending index.Builder, output *gather.W
 		return errors.Wrap(mperr, "mutable parameters")
 	}
 
-	if err := pending.Build(output, mp.IndexVersion); err != nil {
+	build := pending.Build
+	if sm.deterministic {
+		build = pending.BuildStable
+	}
+
+	if err := build(output, mp.IndexVersion); err != nil {
 		return errors.Wrap(err, "unable to build local index")
 	}
 
@@ -109,3 +109,61 @@ func (s *contentManagerSuite) TestContentIndexRecovery(t *testing.T) {
 	verifyContent(ctx, t, bm, content2, seededRandomData(11, 100))
 	verifyContent(ctx, t, bm, content3, seededRandomData(12, 100))
 }
+
+func (s *contentManagerSuite) TestVerifiedContentIndexRecovery(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+	st := blobtesting.NewMapStorage(data, keyTime, nil)
+
+	bm := s.newTestContentManagerWithCustomTime(t, st, nil)
+
+	content1 := writeContentAndVerify(ctx, t, bm, seededRandomData(10, 100))
+	content2 := writeContentAndVerify(ctx, t, bm, seededRandomData(11, 100))
+	content3 := writeContentAndVerify(ctx, t, bm, seededRandomData(12, 100))
+
+	require.NoError(t, bm.Flush(ctx))
+
+	// corrupt the payload of content2 in its pack blob.
+	bi, err := bm.ContentInfo(ctx, content2)
+	require.NoError(t, err)
+
+	data[bi.GetPackBlobID()][bi.GetPackOffset()+1] ^= 0xff
+
+	// delete all index blobs
+	for _, prefix := range []blob.ID{LegacyIndexBlobPrefix, "x"} {
+		require.NoError(t, st.ListBlobs(ctx, prefix, func(bi blob.Metadata) error {
+			return st.DeleteBlob(ctx, bi.BlobID)
+		}))
+	}
+
+	bm.Close(ctx)
+
+	bm = s.newTestContentManagerWithCustomTime(t, st, nil)
+	defer bm.Close(ctx)
+
+	totalRecovered, totalInvalid := 0, 0
+
+	for _, prefix := range PackBlobIDPrefixes {
+		require.NoError(t, st.ListBlobs(ctx, prefix, func(bi blob.Metadata) error {
+			infos, invalid, err := bm.RecoverVerifiedIndexFromPackBlob(ctx, bi.BlobID, true)
+			if err != nil {
+				return err
+			}
+
+			totalRecovered += len(infos)
+			totalInvalid += invalid
+
+			return nil
+		}))
+	}
+
+	require.Equal(t, 2, totalRecovered)
+	require.Equal(t, 1, totalInvalid)
+
+	require.NoError(t, bm.Flush(ctx))
+
+	verifyContent(ctx, t, bm, content1, seededRandomData(10, 100))
+	verifyContentNotFound(ctx, t, bm, content2)
+	verifyContent(ctx, t, bm, content3, seededRandomData(12, 100))
+}
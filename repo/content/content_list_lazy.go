@@ -0,0 +1,78 @@
+package content
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/content/index"
+)
+
+// lazyListLookahead is the maximum number of contents fetched ahead of the caller by ListContentsLazy.
+const lazyListLookahead = 4
+
+type lazyListResult struct {
+	data []byte
+	err  error
+}
+
+// ListContentsLazy returns an iterator over IDs and payloads of all contents with the provided prefix
+// (or all contents if the prefix is empty), in ID order.
+// Unlike fetching all contents upfront, payloads are fetched on demand with at most a few contents fetched
+// ahead of the caller, so memory usage does not depend on the number of contents.
+//
+// Each call to the iterator returns the next content ID and its payload or an error fetching it,
+// after the last content the iterator returns ok == false.
+func (bm *WriteManager) ListContentsLazy(ctx context.Context, prefix IDPrefix) (next func() (id ID, data []byte, ok bool, err error), _ error) {
+	if err := prefix.ValidateSingle(); err != nil {
+		return nil, errors.Wrap(err, "invalid prefix")
+	}
+
+	var ids []ID
+
+	if err := bm.IterateContents(ctx, IterateOptions{Range: index.PrefixRange(prefix)}, func(ci Info) error {
+		ids = append(ids, ci.GetContentID())
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "error listing contents")
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].String() < ids[j].String()
+	})
+
+	var (
+		pending []chan lazyListResult
+		started int
+	)
+
+	fetch := func(id ID) chan lazyListResult {
+		ch := make(chan lazyListResult, 1)
+
+		go func() {
+			data, err := bm.GetContent(ctx, id)
+			ch <- lazyListResult{data, err}
+		}()
+
+		return ch
+	}
+
+	return func() (ID, []byte, bool, error) {
+		consumed := started - len(pending)
+		if consumed >= len(ids) {
+			return ID{}, nil, false, nil
+		}
+
+		// keep the current content and up to lazyListLookahead following ones in flight.
+		for started < len(ids) && started <= consumed+lazyListLookahead {
+			pending = append(pending, fetch(ids[started]))
+			started++
+		}
+
+		res := <-pending[0]
+		pending = pending[1:]
+
+		return ids[consumed], res.data, true, errors.Wrapf(res.err, "error fetching content %v", ids[consumed])
+	}, nil
+}
@@ -0,0 +1,55 @@
+package content
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// ContentLocation describes where a content is stored. The zero value, with Found set to false,
+// indicates that the content does not exist.
+type ContentLocation struct {
+	Found        bool    `json:"found"`
+	PackBlobID   blob.ID `json:"packBlobID,omitempty"`
+	PackOffset   uint32  `json:"packOffset,omitempty"`
+	PackedLength uint32  `json:"packedLength,omitempty"`
+	Deleted      bool    `json:"deleted,omitempty"`
+
+	// Pending is set for contents that have been added in this session, but not yet written
+	// to their pack blob.
+	Pending bool `json:"pending,omitempty"`
+}
+
+// LocateContents returns the locations of the provided contents.
+func (bm *WriteManager) LocateContents(ctx context.Context, contentIDs []ID) (map[ID]ContentLocation, error) {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+
+	result := map[ID]ContentLocation{}
+
+	for _, cid := range contentIDs {
+		pp, bi, err := bm.getContentInfoReadLocked(ctx, cid)
+
+		switch {
+		case errors.Is(err, ErrContentNotFound):
+			result[cid] = ContentLocation{}
+
+		case err != nil:
+			return nil, errors.Wrapf(err, "error locating content %v", cid)
+
+		default:
+			result[cid] = ContentLocation{
+				Found:        true,
+				PackBlobID:   bi.GetPackBlobID(),
+				PackOffset:   bi.GetPackOffset(),
+				PackedLength: bi.GetPackedLength(),
+				Deleted:      bi.GetDeleted(),
+				Pending:      pp != nil,
+			}
+		}
+	}
+
+	return result, nil
+}
@@ -61,6 +61,41 @@
 // ErrContentNotFound is returned when content is not found.
 var ErrContentNotFound = errors.New("content not found")
 
+// ErrCorruptContent is returned when the stored payload of a content can't be decrypted, verified or decompressed.
+var ErrCorruptContent = errors.New("content is corrupted")
+
+// corruptContentError wraps the error encountered when decoding a corrupted content, so that
+// both ErrCorruptContent and the underlying error can be matched using errors.Is().
+type corruptContentError struct {
+	err error
+}
+
+func (e corruptContentError) Error() string { return e.err.Error() }
+
+func (e corruptContentError) Unwrap() error { return e.err }
+
+func (e corruptContentError) Is(target error) bool {
+	return target == ErrCorruptContent //nolint:errorlint,goerr113
+}
+
+// ErrCorruptIndex is returned when an index blob fails its integrity check, which indicates the index
+// has been corrupted or tampered with, independently of the contents it describes.
+var ErrCorruptIndex = errors.New("index failed integrity check")
+
+// corruptIndexError wraps the error encountered when verifying a corrupted index blob, so that
+// both ErrCorruptIndex and the underlying error can be matched using errors.Is().
+type corruptIndexError struct {
+	err error
+}
+
+func (e corruptIndexError) Error() string { return e.err.Error() }
+
+func (e corruptIndexError) Unwrap() error { return e.err }
+
+func (e corruptIndexError) Is(target error) bool {
+	return target == ErrCorruptIndex //nolint:errorlint,goerr113
+}
+
 // IndexBlobInfo is an information about a single index blob managed by Manager.
 type IndexBlobInfo struct {
 	blob.Metadata
@@ -102,6 +137,10 @@ type WriteManager struct {
 
 	onUpload func(int64)
 
+	presenceOracle            BlockPresenceOracle
+	verifyPresenceOracle      bool
+	presenceOracleRefreshOnce sync.Once // indexes are refreshed once per session to verify oracle claims
+
 	*SharedManager
 
 	log logging.Logger
@@ -285,8 +324,8 @@ func (bm *WriteManager) addToPackUnlocked(ctx context.Context, contentID ID, dat
 
 	atomic.AddInt64(&bm.revision, 1)
 
-	// do not start new uploads while flushing
-	for bm.flushing {
+	// do not start new uploads while flushing or while too many packs are being written to the storage.
+	for bm.flushing || bm.tooManyPendingPackWritesLocked() {
 		bm.log.Debugf("wait-before-flush")
 		bm.cond.Wait()
 	}
@@ -338,6 +377,11 @@ func (bm *WriteManager) addToPackUnlocked(ctx context.Context, contentID ID, dat
 		// remove from pendingPacks so other goroutine tries to mess with this pending pack.
 		delete(bm.pendingPacks, pp.prefix)
 		bm.writingPacks = append(bm.writingPacks, pp)
+
+		if err := bm.assignDeterministicPackBlobIDLocked(pp); err != nil {
+			bm.unlock()
+			return err
+		}
 	}
 
 	bm.unlock()
@@ -353,6 +397,14 @@ func (bm *WriteManager) addToPackUnlocked(ctx context.Context, contentID ID, dat
 	return nil
 }
 
+// tooManyPendingPackWritesLocked returns true if writers should block until some of the packs
+// currently being written drain to the storage.
+//
+// +checklocks:bm.mu
+func (bm *WriteManager) tooManyPendingPackWritesLocked() bool {
+	return bm.maxPendingPackWrites > 0 && len(bm.writingPacks) >= bm.maxPendingPackWrites
+}
+
 // DisableIndexFlush increments the counter preventing automatic index flushes.
 func (bm *WriteManager) DisableIndexFlush(ctx context.Context) {
 	bm.lock()
@@ -453,7 +505,7 @@ func (bm *WriteManager) flushPackIndexesLocked(ctx context.Context, mp format.Mu
 
 	if len(bm.packIndexBuilder) > 0 {
 		_, span2 := tracer.Start(ctx, "BuildShards")
-		dataShards, closeShards, err := bm.packIndexBuilder.BuildShards(mp.IndexVersion, true, defaultIndexShardSize)
+		dataShards, closeShards, err := bm.packIndexBuilder.BuildShards(mp.IndexVersion, true, indexShardSize(mp))
 
 		span2.End()
 
@@ -523,6 +575,10 @@ func (bm *WriteManager) writePackAndAddToIndexUnlocked(ctx context.Context, pp *
 
 // +checklocks:bm.mu
 func (bm *WriteManager) writePackAndAddToIndexLocked(ctx context.Context, pp *pendingPackInfo) error {
+	if err := bm.assignDeterministicPackBlobIDLocked(pp); err != nil {
+		return err
+	}
+
 	packFileIndex, writeErr := bm.prepareAndWritePackInternal(ctx, pp, bm.onUpload)
 
 	return bm.processWritePackResultLocked(pp, packFileIndex, writeErr)
@@ -640,7 +696,11 @@ func (bm *WriteManager) Flush(ctx context.Context) error {
 	}
 
 	// finish all new pending packs
-	if err := bm.finishAllPacksLocked(ctx); err != nil {
+	if bm.flushCoordinator != nil {
+		if err := bm.coalesceAllPacksLocked(ctx, mp); err != nil {
+			return errors.Wrap(err, "error writing pending content")
+		}
+	} else if err := bm.finishAllPacksLocked(ctx); err != nil {
 		return errors.Wrap(err, "error writing pending content")
 	}
 
@@ -738,6 +798,18 @@ func (bm *WriteManager) getOrCreatePendingPackInfoLocked(ctx context.Context, pr
 		return pp, nil
 	}
 
+	pp, err := bm.newPendingPackInfoLocked(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	bm.pendingPacks[prefix] = pp
+
+	return pp, nil
+}
+
+// +checklocks:bm.mu
+func (bm *WriteManager) newPendingPackInfoLocked(ctx context.Context, prefix blob.ID) (*pendingPackInfo, error) {
 	bm.internalLogManager.enable()
 
 	b := gather.NewWriteBuffer()
@@ -759,19 +831,21 @@ func (bm *WriteManager) getOrCreatePendingPackInfoLocked(ctx context.Context, pr
 
 	b.Append(suffix)
 
-	//nolint:gosec
-	if err := writeRandomBytesToBuffer(b, rand.Intn(bm.maxPreambleLength-bm.minPreambleLength+1)+bm.minPreambleLength); err != nil {
+	preambleLength := bm.minPreambleLength
+	if !bm.deterministic {
+		preambleLength += rand.Intn(bm.maxPreambleLength - bm.minPreambleLength + 1) //nolint:gosec
+	}
+
+	if err := bm.appendPadding(b, preambleLength); err != nil {
 		return nil, errors.Wrap(err, "unable to prepare content preamble")
 	}
 
-	bm.pendingPacks[prefix] = &pendingPackInfo{
+	return &pendingPackInfo{
 		prefix:           prefix,
 		packBlobID:       blob.ID(fmt.Sprintf("%v%x-%v", prefix, blobID, sessionID)),
 		currentPackItems: map[ID]Info{},
 		currentPackData:  b,
-	}
-
-	return bm.pendingPacks[prefix], nil
+	}, nil
 }
 
 // SupportsContentCompression returns true if content manager supports content-compression.
@@ -831,6 +905,11 @@ func (bm *WriteManager) WriteContent(ctx context.Context, data gather.Bytes, pre
 
 		logbuf.AppendString(" previously-deleted:")
 		logbuf.AppendInt64(previousWriteTime)
+	} else if bm.presentPerOracle(ctx, contentID) {
+		logbuf.AppendString(" present-per-oracle")
+		bm.log.Debugf(logbuf.String())
+
+		return contentID, nil
 	}
 
 	bm.log.Debugf(logbuf.String())
@@ -879,6 +958,13 @@ func (bm *WriteManager) getOverlayContentInfoReadLocked(contentID ID) (*pendingP
 		}
 	}
 
+	// check contents of packs that failed to write, which remain in memory until they are retried.
+	for _, pp := range bm.failedPacks {
+		if ci, ok := pp.currentPackItems[contentID]; ok {
+			return pp, ci, true
+		}
+	}
+
 	// added contents, written to packs but not yet added to indexes
 	if ci, ok := bm.packIndexBuilder[contentID]; ok {
 		return nil, ci, true
@@ -903,6 +989,12 @@ func (bm *WriteManager) getContentInfoReadLocked(ctx context.Context, contentID
 	return nil, info, err
 }
 
+// ContentInfoIsLocal returns true, since content information is looked up in the index loaded
+// by the content manager, which does not require fetching any blobs.
+func (bm *WriteManager) ContentInfoIsLocal() bool {
+	return true
+}
+
 // ContentInfo returns information about a single content.
 func (bm *WriteManager) ContentInfo(ctx context.Context, contentID ID) (Info, error) {
 	bm.mu.RLock()
@@ -950,6 +1042,36 @@ type ManagerOptions struct {
 	DisableInternalLog bool
 	RetentionMode      string
 	RetentionPeriod    time.Duration
+
+	// MaxPendingPackWrites limits the number of packs that can be concurrently written to the storage,
+	// when the limit is reached, writers block until pending packs drain. Zero means unlimited.
+	MaxPendingPackWrites int
+
+	// Deterministic removes all sources of randomness from the write path, so that writing identical
+	// data to identical repositories at identical times (see TimeNow) produces byte-identical storage.
+	// Pack names are derived from pack contents, so concurrent writers don't collide.
+	Deterministic bool
+
+	// FlushCoalescingWindow, if positive, causes pending contents of write managers flushing within
+	// the provided window of each other to be written together into shared packs, which reduces the
+	// number of small packs produced by many concurrent writers flushing independently.
+	// Each flush is delayed by up to the window.
+	FlushCoalescingWindow time.Duration
+
+	// SkipContentMACVerification skips verification of the keyed MAC attached to each content in
+	// repositories using content MAC, which speeds up bulk reads from trusted storage.
+	// Tampered contents may go undetected unless the encryption is authenticated.
+	SkipContentMACVerification bool
+
+	// ReadVerifyProbability is the fraction of content reads [0.0 .. 1.0] which additionally re-compute
+	// the hash of the content and compare it with the content ID, logging any mismatch. This catches
+	// corruption which is not detected by decryption, at the cost of hashing sampled reads. Zero disables it.
+	ReadVerifyProbability float64
+
+	// ContentBloomFilter enables an in-memory bloom filter of committed content IDs, which answers most
+	// lookups of absent contents (such as when deduplicating new data) without searching the indexes.
+	// The filter is built when the indexes are first loaded and extended as new indexes are added.
+	ContentBloomFilter bool
 }
 
 // CloneOrDefault returns a clone of provided ManagerOptions or default empty struct if nil.
@@ -983,6 +1105,11 @@ type SessionOptions struct {
 	SessionUser string
 	SessionHost string
 	OnUpload    func(int64)
+
+	// PresenceOracle, if set, is consulted before writing contents not found in the index,
+	// see BlockPresenceOracle. When VerifyPresenceOracle is set, its claims are confirmed against the repository.
+	PresenceOracle       BlockPresenceOracle
+	VerifyPresenceOracle bool
 }
 
 // NewWriteManager returns a session write manager.
@@ -1002,6 +1129,8 @@ func NewWriteManager(ctx context.Context, sm *SharedManager, options SessionOpti
 		sessionUser:           options.SessionUser,
 		sessionHost:           options.SessionHost,
 		onUpload:              options.OnUpload,
+		presenceOracle:        options.PresenceOracle,
+		verifyPresenceOracle:  options.VerifyPresenceOracle,
 
 		log: sm.namedLogger(writeManagerID),
 	}
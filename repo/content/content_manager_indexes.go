@@ -2,6 +2,8 @@
 
 import (
 	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
 	"time"
 
 	"github.com/pkg/errors"
@@ -14,6 +16,17 @@
 
 const verySmallContentFraction = 20 // blobs less than 1/verySmallContentFraction of maxPackSize are considered 'very small'
 
+const (
+	defaultMaxClockSkew = 5 * time.Minute
+
+	// clockSkewMarkerBlobPrefix is the prefix of short-lived blobs written to obtain storage timestamp reference.
+	clockSkewMarkerBlobPrefix blob.ID = "zclockskew-"
+)
+
+// ErrClockSkew is returned by CompactIndexes when local clock and storage clock disagree by more than
+// the allowed threshold and FailOnClockSkew is set.
+var ErrClockSkew = errors.New("local clock and storage clock differ too much")
+
 // CompactOptions provides options for compaction.
 type CompactOptions struct {
 	MaxSmallBlobs                    int
@@ -21,6 +34,29 @@ type CompactOptions struct {
 	DropDeletedBefore                time.Time
 	DropContents                     []ID
 	DisableEventualConsistencySafety bool
+
+	// LowMemory merges index entries using bounded memory by spilling sorted runs to temporary files.
+	// The resulting indexes are identical to the ones produced by the default in-memory merge.
+	// Only supported by repositories using legacy index blobs, epoch-based repositories return an error.
+	LowMemory bool
+
+	// MaxClockSkew is the maximum allowed difference between local clock and storage clock when
+	// DropDeletedBefore is set, defaults to 5 minutes. Larger skew causes a warning or,
+	// with FailOnClockSkew, refusal to compact.
+	MaxClockSkew    time.Duration
+	FailOnClockSkew bool
+
+	// LockWaitTime is the maximum time to wait for another client to finish compacting indexes,
+	// zero causes compaction to fail immediately with ErrCompactionLocked.
+	LockWaitTime time.Duration
+}
+
+func (co *CompactOptions) maxClockSkew() time.Duration {
+	if co.MaxClockSkew > 0 {
+		return co.MaxClockSkew
+	}
+
+	return defaultMaxClockSkew
 }
 
 func (co *CompactOptions) maxEventualConsistencySettleTime() time.Duration {
@@ -43,6 +79,12 @@ func (sm *SharedManager) Refresh(ctx context.Context) error {
 		return err
 	}
 
+	// cached lists of index blobs are re-listed first, which retries transient listing failures
+	// instead of failing to load indexes.
+	if err := ibm.refreshListCache(ctx); err != nil {
+		return errors.Wrap(err, "error refreshing cached lists of index blobs")
+	}
+
 	ibm.invalidate(ctx)
 
 	timer := timetrack.StartTimer()
@@ -55,6 +97,15 @@ func (sm *SharedManager) Refresh(ctx context.Context) error {
 
 // CompactIndexes performs compaction of index blobs ensuring that # of small index blobs is below opt.maxSmallBlobs.
 func (sm *SharedManager) CompactIndexes(ctx context.Context, opt CompactOptions) error {
+	// compaction by multiple clients at the same time can drop each other's index blobs,
+	// the lock is acquired first to avoid blocking Refresh() while waiting for it.
+	release, err := sm.acquireCompactionLock(ctx, opt.LockWaitTime)
+	if err != nil {
+		return errors.Wrap(err, "unable to acquire compaction lock")
+	}
+
+	defer release()
+
 	// we must hold the lock here to avoid the race with Refresh() which can reload the
 	// current set of indexes while we process them.
 	sm.indexesLock.Lock()
@@ -67,6 +118,13 @@ func (sm *SharedManager) CompactIndexes(ctx context.Context, opt CompactOptions)
 		return err
 	}
 
+	// time-based cutoff is computed using local clock but compared with timestamps assigned by the storage.
+	if !opt.DropDeletedBefore.IsZero() {
+		if err := sm.checkClockSkew(ctx, opt); err != nil {
+			return err
+		}
+	}
+
 	if err := ibm.compact(ctx, opt); err != nil {
 		return errors.Wrap(err, "error performing compaction")
 	}
@@ -79,6 +137,78 @@ func (sm *SharedManager) CompactIndexes(ctx context.Context, opt CompactOptions)
 	return nil
 }
 
+// checkClockSkew compares local clock with the storage clock and warns or fails if they differ by more
+// than the allowed threshold.
+func (sm *SharedManager) checkClockSkew(ctx context.Context, opt CompactOptions) error {
+	skew, ok, err := sm.measureStorageClockSkew(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to determine storage clock")
+	}
+
+	if !ok {
+		sm.log.Debugf("storage does not provide timestamps, unable to verify clock skew")
+		return nil
+	}
+
+	sm.log.Debugf("storage clock skew: %v", skew)
+
+	if skew < 0 {
+		skew = -skew
+	}
+
+	if skew <= opt.maxClockSkew() {
+		return nil
+	}
+
+	if opt.FailOnClockSkew {
+		return errors.Wrapf(ErrClockSkew, "storage clock differs from local clock by %v, which exceeds %v", skew, opt.maxClockSkew())
+	}
+
+	sm.log.Warnf("storage clock differs from local clock by %v, which exceeds %v, compaction cutoffs may be inaccurate", skew, opt.maxClockSkew())
+
+	return nil
+}
+
+// measureStorageClockSkew writes a short-lived blob and returns the difference between the timestamp assigned to it
+// by the storage and the local clock. Returns false if the storage does not report timestamps.
+func (sm *SharedManager) measureStorageClockSkew(ctx context.Context) (skew time.Duration, ok bool, err error) {
+	var rnd [8]byte
+
+	if _, err := cryptorand.Read(rnd[:]); err != nil {
+		return 0, false, errors.Wrap(err, "error generating random marker")
+	}
+
+	markerID := clockSkewMarkerBlobPrefix + blob.ID(hex.EncodeToString(rnd[:]))
+
+	before := sm.timeNow()
+
+	if err := sm.st.PutBlob(ctx, markerID, gather.FromSlice(rnd[:]), blob.PutOptions{}); err != nil {
+		return 0, false, errors.Wrap(err, "error writing clock skew marker")
+	}
+
+	defer func() {
+		if derr := sm.st.DeleteBlob(ctx, markerID); derr != nil {
+			sm.log.Debugf("unable to delete clock skew marker %v: %v", markerID, derr)
+		}
+	}()
+
+	after := sm.timeNow()
+
+	bm, err := sm.st.GetMetadata(ctx, markerID)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "error reading clock skew marker")
+	}
+
+	if bm.Timestamp.IsZero() {
+		return 0, false, nil
+	}
+
+	// compare against the midpoint of the local time window in which the blob was written.
+	local := before.Add(after.Sub(before) / 2) //nolint:gomnd
+
+	return bm.Timestamp.Sub(local), true, nil
+}
+
 // ParseIndexBlob loads entries in a given index blob and returns them.
 func ParseIndexBlob(ctx context.Context, blobID blob.ID, encrypted gather.Bytes, crypter crypter) ([]Info, error) {
 	var data gather.WriteBuffer
@@ -116,3 +246,69 @@ func addBlobsToIndex(ndx map[blob.ID]*IndexBlobInfo, blobs []blob.Metadata) {
 		}
 	}
 }
+
+// CompactionReason describes why index compaction is needed.
+type CompactionReason string
+
+// Supported compaction reasons.
+const (
+	CompactionNotNeeded               CompactionReason = ""
+	CompactionReasonTooManyIndexBlobs CompactionReason = "too-many-index-blobs"
+	CompactionReasonFragmentedIndexes CompactionReason = "fragmented-indexes"
+)
+
+// CompactionThresholds determines when NeedsCompaction() reports that index compaction is needed.
+type CompactionThresholds struct {
+	// MaxIndexBlobs is the maximum number of active index blobs.
+	MaxIndexBlobs int
+
+	// MaxFragmentation is the maximum ratio between the number of entries in all active index blobs and
+	// the number of distinct contents they describe. Entries superseded by newer entries for the same
+	// content (such as deletions or rewrites) slow down lookups and are removed by compaction.
+	MaxFragmentation float64
+}
+
+// DefaultCompactionThresholds are the thresholds that trigger full index compaction during maintenance.
+//
+//nolint:gochecknoglobals
+var DefaultCompactionThresholds = CompactionThresholds{
+	MaxIndexBlobs:    64,  //nolint:gomnd
+	MaxFragmentation: 1.5, //nolint:gomnd
+}
+
+// NeedsCompaction determines whether the index blobs should be compacted based on their count and
+// the fragmentation of currently loaded indexes.
+func (sm *SharedManager) NeedsCompaction(ctx context.Context, th CompactionThresholds) (bool, CompactionReason, error) {
+	ibm, err := sm.indexBlobManager()
+	if err != nil {
+		return false, CompactionNotNeeded, err
+	}
+
+	blobs, _, err := ibm.listActiveIndexBlobs(ctx)
+	if err != nil {
+		return false, CompactionNotNeeded, errors.Wrap(err, "error listing index blobs")
+	}
+
+	if len(blobs) <= 1 {
+		return false, CompactionNotNeeded, nil
+	}
+
+	if th.MaxIndexBlobs > 0 && len(blobs) > th.MaxIndexBlobs {
+		return true, CompactionReasonTooManyIndexBlobs, nil
+	}
+
+	if th.MaxFragmentation <= 0 {
+		return false, CompactionNotNeeded, nil
+	}
+
+	totalEntries, distinctContents, err := sm.committedContents.entryCounts()
+	if err != nil {
+		return false, CompactionNotNeeded, errors.Wrap(err, "error counting index entries")
+	}
+
+	if distinctContents > 0 && float64(totalEntries)/float64(distinctContents) > th.MaxFragmentation {
+		return true, CompactionReasonFragmentedIndexes, nil
+	}
+
+	return false, CompactionNotNeeded, nil
+}
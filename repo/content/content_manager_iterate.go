@@ -3,6 +3,7 @@
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -227,6 +228,30 @@ func(ci Info) error {
 	return nil
 }
 
+// ListPacks returns information about all pack blobs that hold non-deleted contents, sorted by pack ID,
+// including the list of contents stored in each pack. Only index data is consulted, contents are not read or decrypted.
+func (bm *WriteManager) ListPacks(ctx context.Context) ([]PackInfo, error) {
+	var result []PackInfo
+
+	if err := bm.IteratePacks(ctx, IteratePackOptions{IncludeContentInfos: true}, func(pi PackInfo) error {
+		sort.Slice(pi.ContentInfos, func(i, j int) bool {
+			return pi.ContentInfos[i].GetContentID().String() < pi.ContentInfos[j].GetContentID().String()
+		})
+
+		result = append(result, pi)
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].PackID < result[j].PackID
+	})
+
+	return result, nil
+}
+
 // IterateUnreferencedBlobs returns the list of unreferenced storage blobs.
 func (bm *WriteManager) IterateUnreferencedBlobs(ctx context.Context, blobPrefixes []blob.ID, parallellism int, callback func(blob.Metadata) error) error {
 	usedPacks, err := bigmap.NewSet(ctx)
@@ -1,11 +1,13 @@
 package content
 
 import (
+	"bytes"
 	"context"
 	"crypto/aes"
 	cryptorand "crypto/rand"
 	"fmt"
 	"io"
+	"math/rand"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -103,7 +105,81 @@ func (sm *SharedManager) getContentDataReadLocked(ctx context.Context, pp *pendi
 		return errors.Wrap(err, "error getting cached content")
 	}
 
-	return sm.decryptContentAndVerify(payload.Bytes(), bi, output)
+	err := sm.decryptContentAndVerify(payload.Bytes(), bi, output)
+	if err == nil {
+		err = sm.maybeVerifyContentHash(bi, output)
+	}
+
+	if err == nil || (pp != nil && pp.packBlobID == bi.GetPackBlobID()) {
+		return err
+	}
+
+	return sm.getContentDataFromAlternateSources(ctx, bi, output, err)
+}
+
+// maybeVerifyContentHash verifies the hash of a sample of contents read, as configured by
+// ManagerOptions.ReadVerifyProbability.
+func (sm *SharedManager) maybeVerifyContentHash(bi Info, data *gather.WriteBuffer) error {
+	if sm.readVerifyProbability <= 0 || rand.Float64() >= sm.readVerifyProbability { //nolint:gosec
+		return nil
+	}
+
+	return sm.verifyContentHash(bi, data)
+}
+
+// verifyContentHash re-computes the hash of the decrypted content and returns an error if it does not match the content ID.
+func (sm *SharedManager) verifyContentHash(bi Info, data *gather.WriteBuffer) error {
+	var hashOutput [hashing.MaxHashSize]byte
+
+	if h := sm.hashData(hashOutput[:0], data.Bytes()); !bytes.Equal(h, bi.GetContentID().Hash()) {
+		sm.log.Errorf("content hash mismatch for %v in %v at offset %v", bi.GetContentID(), bi.GetPackBlobID(), bi.GetPackOffset())
+
+		return corruptContentError{errors.Errorf("content hash mismatch for %v", bi.GetContentID())}
+	}
+
+	return nil
+}
+
+// getContentDataFromAlternateSources attempts to recover content whose primary copy failed verification
+// by fetching it directly from the underlying storage (bypassing the cache) and then from any alternate
+// sources provided by the storage. Returns the original error if none of the sources has a valid copy.
+func (sm *SharedManager) getContentDataFromAlternateSources(ctx context.Context, bi Info, output *gather.WriteBuffer, originalErr error) error {
+	sources := append([]blob.Reader{sm.st}, blob.GetAlternateSources(sm.st)...)
+
+	var payload gather.WriteBuffer
+	defer payload.Close()
+
+	for _, src := range sources {
+		payload.Reset()
+		output.Reset()
+
+		if err := src.GetBlob(ctx, bi.GetPackBlobID(), int64(bi.GetPackOffset()), int64(bi.GetPackedLength()), &payload); err != nil {
+			sm.log.Debugf("unable to fetch %v from %v: %v", bi.GetContentID(), src.DisplayName(), err)
+			continue
+		}
+
+		// alternate copies are always hash-verified, since the primary copy may have failed that check.
+		if err := sm.decryptContentAndVerify(payload.Bytes(), bi, output); err != nil {
+			sm.log.Debugf("alternate copy of %v from %v is also invalid: %v", bi.GetContentID(), src.DisplayName(), err)
+			continue
+		}
+
+		if err := sm.verifyContentHash(bi, output); err != nil {
+			sm.log.Debugf("alternate copy of %v from %v is also invalid: %v", bi.GetContentID(), src.DisplayName(), err)
+			continue
+		}
+
+		sm.log.Infof("recovered content %v from %v after primary copy failed verification: %v", bi.GetContentID(), src.DisplayName(), originalErr)
+
+		// the cached copy is corrupted, make sure subsequent reads don't return it.
+		sm.getCacheForContentID(bi.GetContentID()).Evict(ctx, contentCacheKeyForInfo(bi), bi.GetPackBlobID())
+
+		return nil
+	}
+
+	output.Reset()
+
+	return originalErr
 }
 
 func (sm *SharedManager) preparePackDataContent(pp *pendingPackInfo) (index.Builder, error) {
@@ -152,7 +228,7 @@ func (sm *SharedManager) preparePackDataContent(pp *pendingPackInfo) (index.Buil
 
 	if sm.paddingUnit > 0 {
 		if missing := sm.paddingUnit - (pp.currentPackData.Length() % sm.paddingUnit); missing > 0 {
-			if err := writeRandomBytesToBuffer(pp.currentPackData, missing); err != nil {
+			if err := sm.appendPadding(pp.currentPackData, missing); err != nil {
 				return nil, errors.Wrap(err, "unable to prepare content postamble")
 			}
 		}
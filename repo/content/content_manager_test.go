@@ -6,6 +6,7 @@
 	"crypto/hmac"
 	cryptorand "crypto/rand"
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"reflect"
@@ -30,10 +31,11 @@
 	"github.com/kopia/kopia/internal/testlogging"
 	"github.com/kopia/kopia/internal/testutil"
 	"github.com/kopia/kopia/repo/blob"
-	"github.com/kopia/kopia/repo/blob/logging"
+	bloblogging "github.com/kopia/kopia/repo/blob/logging"
 	"github.com/kopia/kopia/repo/compression"
 	"github.com/kopia/kopia/repo/content/index"
 	"github.com/kopia/kopia/repo/format"
+	"github.com/kopia/kopia/repo/logging"
 )
 
 const (
@@ -408,6 +410,31 @@ func (s *contentManagerSuite) TestContentManagerFailedToWritePack(t *testing.T)
 	faulty.VerifyAllFaultsExercised(t)
 }
 
+func (s *contentManagerSuite) TestContentManagerReadFromFailedPack(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+	faulty := blobtesting.NewFaultyStorage(st)
+
+	bm := s.newTestContentManagerWithCustomTime(t, faulty, nil)
+	defer bm.Close(ctx)
+
+	cid := writeContentAndVerify(ctx, t, bm, seededRandomData(1, 100))
+
+	someErr := errors.New("some error")
+
+	faulty.AddFault(blobtesting.MethodPutBlob).ErrorInstead(someErr)
+	require.ErrorIs(t, bm.Flush(ctx), someErr)
+
+	// the content is served from memory until the failed pack is retried.
+	verifyContent(ctx, t, bm, cid, seededRandomData(1, 100))
+
+	require.NoError(t, bm.Flush(ctx))
+	verifyContent(ctx, t, bm, cid, seededRandomData(1, 100))
+
+	faulty.VerifyAllFaultsExercised(t)
+}
+
 func (s *contentManagerSuite) TestIndexCompactionDropsContent(t *testing.T) {
 	if s.mutableParameters.EpochParameters.Enabled {
 		t.Skip("dropping index entries not implemented")
@@ -415,42 +442,1093 @@ func (s *contentManagerSuite) TestIndexCompactionDropsContent(t *testing.T) {
 
 	ctx := testlogging.Context(t)
 	data := blobtesting.DataMap{}
-	keyTime := map[blob.ID]time.Time{}
-	timeFunc := faketime.AutoAdvance(fakeTime.Add(1), 1*time.Second)
+	keyTime := map[blob.ID]time.Time{}
+	timeFunc := faketime.AutoAdvance(fakeTime.Add(1), 1*time.Second)
+
+	// create record in index #1
+	st := blobtesting.NewMapStorage(data, keyTime, timeFunc)
+
+	bm := s.newTestContentManagerWithCustomTime(t, st, timeFunc)
+	content1 := writeContentAndVerify(ctx, t, bm, seededRandomData(10, 100))
+	require.NoError(t, bm.Flush(ctx))
+	require.NoError(t, bm.Close(ctx))
+
+	timeFunc()
+
+	// create record in index #2
+	bm = s.newTestContentManagerWithCustomTime(t, st, timeFunc)
+	deleteContent(ctx, t, bm, content1)
+	require.NoError(t, bm.Flush(ctx))
+	require.NoError(t, bm.Close(ctx))
+
+	timeFunc()
+
+	deleteThreshold := timeFunc()
+
+	t.Logf("----- compaction")
+
+	bm = s.newTestContentManagerWithCustomTime(t, st, timeFunc)
+	// this drops deleted entries, including from index #1
+	require.NoError(t, bm.CompactIndexes(ctx, CompactOptions{
+		DropDeletedBefore: deleteThreshold,
+		AllIndexes:        true,
+	}))
+	require.NoError(t, bm.Flush(ctx))
+	require.NoError(t, bm.Close(ctx))
+
+	bm = s.newTestContentManagerWithCustomTime(t, st, timeFunc)
+	verifyContentNotFound(ctx, t, bm, content1)
+}
+
+func (s *contentManagerSuite) TestIndexCompactionCutoffWithFakeClock(t *testing.T) {
+	if s.mutableParameters.EpochParameters.Enabled {
+		t.Skip("dropping index entries not implemented")
+	}
+
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+	ta := faketime.NewTimeAdvance(fakeTime, 0)
+	timeFunc := ta.NowFunc()
+	st := blobtesting.NewMapStorage(data, keyTime, timeFunc)
+
+	bm := s.newTestContentManagerWithCustomTime(t, st, timeFunc)
+	content1 := writeContentAndVerify(ctx, t, bm, seededRandomData(10, 100))
+	content2 := writeContentAndVerify(ctx, t, bm, seededRandomData(11, 100))
+	require.NoError(t, bm.Flush(ctx))
+
+	// content1 is deleted at T+1h, content2 at T+3h.
+	ta.Advance(1 * time.Hour)
+	deleteContent(ctx, t, bm, content1)
+	require.NoError(t, bm.Flush(ctx))
+
+	ta.Advance(2 * time.Hour)
+	deleteContent(ctx, t, bm, content2)
+	require.NoError(t, bm.Flush(ctx))
+	require.NoError(t, bm.Close(ctx))
+
+	compactAndReopen := func(age time.Duration) *WriteManager {
+		bm := s.newTestContentManagerWithCustomTime(t, st, timeFunc)
+		require.NoError(t, bm.CompactIndexes(ctx, CompactOptions{
+			DropDeletedBefore: timeFunc().Add(-age),
+			AllIndexes:        true,
+		}))
+		require.NoError(t, bm.Close(ctx))
+
+		return s.newTestContentManagerWithCustomTime(t, st, timeFunc)
+	}
+
+	// at T+4h the 2-hour cutoff (T+2h) falls between the two deletions.
+	ta.Advance(1 * time.Hour)
+
+	bm = compactAndReopen(2 * time.Hour)
+	verifyContentNotFound(ctx, t, bm, content1)
+	verifyDeletedContentRead(ctx, t, bm, content2, seededRandomData(11, 100))
+	require.NoError(t, bm.Close(ctx))
+
+	// advancing the clock moves the cutoff past the second deletion.
+	ta.Advance(2 * time.Hour)
+
+	bm = compactAndReopen(2 * time.Hour)
+	verifyContentNotFound(ctx, t, bm, content2)
+	require.NoError(t, bm.Close(ctx))
+}
+
+// crashingStorage simulates a crash by failing writes and deletions of blobs with given prefixes.
+type crashingStorage struct {
+	blob.Storage
+
+	failPutPrefix    blob.ID
+	failDeletePrefix blob.ID
+}
+
+func (s *crashingStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	if s.failPutPrefix != "" && strings.HasPrefix(string(id), string(s.failPutPrefix)) {
+		return errors.Errorf("simulated crash writing %v", id)
+	}
+
+	return s.Storage.PutBlob(ctx, id, data, opts)
+}
+
+func (s *crashingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	if s.failDeletePrefix != "" && strings.HasPrefix(string(id), string(s.failDeletePrefix)) {
+		return errors.Errorf("simulated crash deleting %v", id)
+	}
+
+	return s.Storage.DeleteBlob(ctx, id)
+}
+
+func (s *contentManagerSuite) TestCompactIndexesRecoversInterruptedCompaction(t *testing.T) {
+	if s.mutableParameters.EpochParameters.Enabled {
+		t.Skip("compaction logs are not used in epoch-based repositories")
+	}
+
+	cases := []struct {
+		name             string
+		failPutPrefix    blob.ID
+		failDeletePrefix blob.ID
+
+		// number of active index blobs after the interrupted compaction.
+		wantActiveIndexes int
+	}{
+		// crash after writing compaction intent but before writing compacted index.
+		{name: "BeforeCompactedIndex", failPutPrefix: LegacyIndexBlobPrefix, wantActiveIndexes: 3},
+
+		// crash after writing compacted index but before switching to it, compacted index duplicates inputs.
+		{name: "BeforeCompactionLog", failPutPrefix: compactionLogBlobPrefix, wantActiveIndexes: 4},
+
+		// crash after switching to compacted index but before removing compaction intent.
+		{name: "AfterCompactionLog", failDeletePrefix: compactionIntentBlobPrefix, wantActiveIndexes: 1},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := testlogging.Context(t)
+			data := blobtesting.DataMap{}
+			keyTime := map[blob.ID]time.Time{}
+			ta := faketime.NewTimeAdvance(fakeTime, 0)
+			timeFunc := ta.NowFunc()
+			st := &crashingStorage{Storage: blobtesting.NewMapStorage(data, keyTime, timeFunc)}
+
+			bm := s.newTestContentManagerWithCustomTime(t, st, timeFunc)
+
+			var contentIDs []ID
+
+			for i := 0; i < 3; i++ {
+				contentIDs = append(contentIDs, writeContentAndVerify(ctx, t, bm, seededRandomData(i, 100)))
+				require.NoError(t, bm.Flush(ctx))
+			}
+
+			st.failPutPrefix = tc.failPutPrefix
+			st.failDeletePrefix = tc.failDeletePrefix
+
+			require.Error(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1}))
+			require.NoError(t, bm.Close(ctx))
+
+			st.failPutPrefix = ""
+			st.failDeletePrefix = ""
+
+			require.Len(t, keysWithPrefix(data, compactionIntentBlobPrefix), 1)
+
+			verifyAfterReopen := func(wantActiveIndexes int) {
+				t.Helper()
+
+				bm := s.newTestContentManagerWithCustomTime(t, st, timeFunc)
+				defer bm.Close(ctx)
+
+				ibl, err := bm.IndexBlobs(ctx, false)
+				require.NoError(t, err)
+				require.Len(t, ibl, wantActiveIndexes)
+
+				for i, cid := range contentIDs {
+					verifyContent(ctx, t, bm, cid, seededRandomData(i, 100))
+				}
+			}
+
+			// opening the repository does not touch interrupted compactions.
+			verifyAfterReopen(tc.wantActiveIndexes)
+			require.Len(t, keysWithPrefix(data, compactionIntentBlobPrefix), 1)
+
+			// interrupted compaction is not recovered until the eventual consistency settle time elapses,
+			// since it may still be in progress.
+			bm = s.newTestContentManagerWithCustomTime(t, st, timeFunc)
+			require.NoError(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 100}))
+			require.NoError(t, bm.Close(ctx))
+			require.Len(t, keysWithPrefix(data, compactionIntentBlobPrefix), 1)
+
+			ta.Advance(2 * defaultEventualConsistencySettleTime)
+
+			// next compaction removes the intent and merges any leftover compacted indexes.
+			bm = s.newTestContentManagerWithCustomTime(t, st, timeFunc)
+			require.NoError(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1}))
+			require.NoError(t, bm.Close(ctx))
+			require.Empty(t, keysWithPrefix(data, compactionIntentBlobPrefix))
+
+			verifyAfterReopen(1)
+		})
+	}
+}
+
+func (s *contentManagerSuite) TestCompactIndexesRecoveryKeepsActiveIndex(t *testing.T) {
+	if s.mutableParameters.EpochParameters.Enabled {
+		t.Skip("compaction logs are not used in epoch-based repositories")
+	}
+
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+	ta := faketime.NewTimeAdvance(fakeTime, 0)
+	timeFunc := ta.NowFunc()
+	st := blobtesting.NewMapStorage(data, keyTime, timeFunc)
+
+	bm := s.newTestContentManagerWithCustomTime(t, st, timeFunc)
+
+	var contentIDs []ID
+
+	for i := 0; i < 3; i++ {
+		contentIDs = append(contentIDs, writeContentAndVerify(ctx, t, bm, seededRandomData(i, 100)))
+		require.NoError(t, bm.Flush(ctx))
+	}
+
+	require.NoError(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1}))
+
+	ibl, err := bm.IndexBlobs(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, ibl, 1)
+
+	live := ibl[0].BlobID
+
+	// simulate cleanup of the compaction, which removes its inputs and compaction log.
+	for id := range data {
+		if strings.HasPrefix(string(id), string(compactionLogBlobPrefix)) || (strings.HasPrefix(string(id), string(LegacyIndexBlobPrefix)) && id != live) {
+			delete(data, id)
+		}
+	}
+
+	// interrupted compaction whose compacted index has the same name as the active index.
+	intentBytes, err := json.Marshal(&compactionIntentEntry{OutputBlobIDs: []blob.ID{live}})
+	require.NoError(t, err)
+
+	_, err = bm.indexBlobManagerV0.enc.encryptAndWriteBlob(ctx, gather.FromSlice(intentBytes), compactionIntentBlobPrefix, "")
+	require.NoError(t, err)
+	require.NoError(t, bm.Close(ctx))
+
+	ta.Advance(2 * defaultEventualConsistencySettleTime)
+
+	bm = s.newTestContentManagerWithCustomTime(t, st, timeFunc)
+	defer bm.Close(ctx)
+
+	require.NoError(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 100}))
+	require.Empty(t, keysWithPrefix(data, compactionIntentBlobPrefix))
+	require.Contains(t, data, live)
+
+	for i, cid := range contentIDs {
+		verifyContent(ctx, t, bm, cid, seededRandomData(i, 100))
+	}
+}
+
+func (s *contentManagerSuite) TestNeedsCompaction(t *testing.T) {
+	if s.mutableParameters.EpochParameters.Enabled {
+		t.Skip("index compaction does not merge entries in epoch-based repositories")
+	}
+
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	bm := s.newTestContentManager(t, st)
+	defer bm.Close(ctx)
+
+	countThresholds := CompactionThresholds{MaxIndexBlobs: 5}
+	fragmentationThresholds := CompactionThresholds{MaxFragmentation: 1.5}
+
+	var contentIDs []ID
+
+	// each flush writes a new small index blob.
+	for i := 0; i < 6; i++ {
+		contentIDs = append(contentIDs, writeContentAndVerify(ctx, t, bm, seededRandomData(i, 100)))
+		require.NoError(t, bm.Flush(ctx))
+
+		needed, reason, err := bm.NeedsCompaction(ctx, countThresholds)
+		require.NoError(t, err)
+		require.Equal(t, i+1 > 5, needed, "index blobs: %v", i+1)
+
+		if needed {
+			require.Equal(t, CompactionReasonTooManyIndexBlobs, reason)
+		}
+
+		// each content has a single index entry, so the indexes are not fragmented.
+		needed, _, err = bm.NeedsCompaction(ctx, fragmentationThresholds)
+		require.NoError(t, err)
+		require.False(t, needed)
+	}
+
+	// deletion markers supersede existing index entries.
+	for _, cid := range contentIDs[0:4] {
+		require.NoError(t, bm.DeleteContent(ctx, cid))
+	}
+
+	require.NoError(t, bm.Flush(ctx))
+
+	needed, reason, err := bm.NeedsCompaction(ctx, fragmentationThresholds)
+	require.NoError(t, err)
+	require.True(t, needed)
+	require.Equal(t, CompactionReasonFragmentedIndexes, reason)
+
+	require.NoError(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1}))
+
+	needed, reason, err = bm.NeedsCompaction(ctx, countThresholds)
+	require.NoError(t, err)
+	require.False(t, needed)
+	require.Equal(t, CompactionNotNeeded, reason)
+
+	needed, _, err = bm.NeedsCompaction(ctx, fragmentationThresholds)
+	require.NoError(t, err)
+	require.False(t, needed)
+}
+
+func (s *contentManagerSuite) TestMaxIndexBlockSize(t *testing.T) {
+	const (
+		maxIndexBlockSize = 2000
+		numContents       = 300
+	)
+
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	bm := s.newTestContentManagerWithTweaks(t, st, &contentManagerTestTweaks{
+		maxIndexBlockSize: maxIndexBlockSize,
+	})
+
+	var contentIDs []ID
+
+	for i := 0; i < numContents; i++ {
+		contentIDs = append(contentIDs, writeContentAndVerify(ctx, t, bm, seededRandomData(i, 100)))
+	}
+
+	require.NoError(t, bm.Flush(ctx))
+
+	verifyIndexBlobSizes := func() {
+		t.Helper()
+
+		blobs, err := bm.IndexBlobs(ctx, false)
+		require.NoError(t, err)
+
+		// index blobs are split into roughly target-sized chunks.
+		require.Greater(t, len(blobs), 3)
+
+		var total int64
+
+		for _, b := range blobs {
+			require.Less(t, b.Length, int64(2*maxIndexBlockSize), b.BlobID)
+
+			total += b.Length
+		}
+
+		require.Greater(t, total/int64(len(blobs)), int64(maxIndexBlockSize/2))
+	}
+
+	verifyIndexBlobSizes()
+
+	if !s.mutableParameters.EpochParameters.Enabled {
+		// compaction splits merged output into multiple index blobs as well.
+		require.NoError(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1}))
+		verifyIndexBlobSizes()
+	}
+
+	bm2 := s.newTestContentManagerWithTweaks(t, st, nil)
+
+	for i, cid := range contentIDs {
+		verifyContent(ctx, t, bm2, cid, seededRandomData(i, 100))
+	}
+}
+
+func (s *contentManagerSuite) TestCompactIndexesLowMemory(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+	timeFunc := faketime.AutoAdvance(fakeTime.Add(1), 1*time.Second)
+	st := blobtesting.NewMapStorage(data, keyTime, timeFunc)
+
+	bm := s.newTestContentManagerWithCustomTime(t, st, timeFunc)
+
+	if s.mutableParameters.EpochParameters.Enabled {
+		require.ErrorContains(t, bm.CompactIndexes(ctx, CompactOptions{AllIndexes: true, LowMemory: true}), "not supported")
+		return
+	}
+
+	var contentIDs []ID
+
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 30; j++ {
+			contentIDs = append(contentIDs, writeContentAndVerify(ctx, t, bm, seededRandomData(i*100+j, 50)))
+		}
+
+		require.NoError(t, bm.Flush(ctx))
+	}
+
+	for _, cid := range contentIDs[0:50] {
+		deleteContent(ctx, t, bm, cid)
+	}
+
+	require.NoError(t, bm.Flush(ctx))
+	require.NoError(t, bm.Close(ctx))
+
+	opt := CompactOptions{
+		AllIndexes:        true,
+		DropDeletedBefore: timeFunc(),
+		DropContents:      contentIDs[100:110],
+	}
+
+	compact := func(lowMemory bool) []*InfoStruct {
+		data2 := blobtesting.DataMap{}
+		for k, v := range data {
+			data2[k] = append([]byte(nil), v...)
+		}
+
+		keyTime2 := map[blob.ID]time.Time{}
+		for k, v := range keyTime {
+			keyTime2[k] = v
+		}
+
+		bm2 := s.newTestContentManagerWithCustomTime(t, blobtesting.NewMapStorage(data2, keyTime2, timeFunc), timeFunc)
+		defer bm2.Close(ctx)
+
+		// tiny memory budget to force spilling.
+		bm2.indexBlobManagerV0.lowMemoryMaxEntries = 7
+
+		opt2 := opt
+		opt2.LowMemory = lowMemory
+		require.NoError(t, bm2.CompactIndexes(ctx, opt2))
+
+		var result []*InfoStruct
+
+		for blobID, v := range data2 {
+			if _, ok := data[blobID]; ok || !strings.HasPrefix(string(blobID), LegacyIndexBlobPrefix) {
+				continue
+			}
+
+			infos, err := ParseIndexBlob(ctx, blobID, gather.FromSlice(v), bm2.enc.crypter)
+			require.NoError(t, err)
+
+			for _, i := range infos {
+				result = append(result, index.ToInfoStruct(i))
+			}
+		}
+
+		return result
+	}
+
+	want := compact(false)
+	require.Len(t, want, len(contentIDs)-60)
+	require.Equal(t, want, compact(true))
+}
+
+func (s *contentManagerSuite) TestCompactIndexesClockSkew(t *testing.T) {
+	var (
+		logMu  sync.Mutex
+		logBuf bytes.Buffer
+	)
+
+	ctx := logging.WithLogger(testlogging.Context(t), testlogging.PrintfFactory(func(msg string, args ...interface{}) {
+		logMu.Lock()
+		defer logMu.Unlock()
+
+		fmt.Fprintf(&logBuf, msg+"\n", args...)
+	}))
+
+	logOutput := func() string {
+		logMu.Lock()
+		defer logMu.Unlock()
+
+		return logBuf.String()
+	}
+
+	localTime := faketime.NewClockTimeWithOffset(0)
+	storageSkew := 10 * time.Minute
+
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, func() time.Time {
+		return localTime.NowFunc()().Add(storageSkew)
+	})
+
+	fo := mustCreateFormatProvider(t, &format.ContentFormat{
+		Hash:              "HMAC-SHA256",
+		Encryption:        "AES256-GCM-HMAC-SHA256",
+		HMACSecret:        hmacSecret,
+		MutableParameters: s.mutableParameters,
+	})
+
+	bm, err := NewManagerForTesting(ctx, st, fo, nil, &ManagerOptions{TimeNow: localTime.NowFunc()})
+	require.NoError(t, err)
+
+	defer bm.Close(ctx)
+
+	writeContentAndVerify(ctx, t, bm, seededRandomData(1, 100))
+	require.NoError(t, bm.Flush(ctx))
+
+	dropBefore := localTime.NowFunc()().Add(-time.Hour)
+
+	// without a time cutoff, clock skew is not checked.
+	require.NoError(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1, FailOnClockSkew: true}))
+
+	// skew above the default threshold causes refusal.
+	err = bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1, DropDeletedBefore: dropBefore, FailOnClockSkew: true})
+	require.ErrorIs(t, err, ErrClockSkew)
+
+	// by default only a warning is emitted.
+	require.NotContains(t, logOutput(), "storage clock differs from local clock")
+	require.NoError(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1, DropDeletedBefore: dropBefore}))
+	require.Contains(t, logOutput(), "storage clock differs from local clock")
+
+	// threshold can be raised.
+	require.NoError(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1, DropDeletedBefore: dropBefore, FailOnClockSkew: true, MaxClockSkew: 11 * time.Minute}))
+
+	// storage behind local clock is detected as well.
+	storageSkew = -6 * time.Minute
+
+	err = bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1, DropDeletedBefore: dropBefore, FailOnClockSkew: true})
+	require.ErrorIs(t, err, ErrClockSkew)
+
+	// small skew is fine.
+	storageSkew = 4 * time.Minute
+
+	require.NoError(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1, DropDeletedBefore: dropBefore, FailOnClockSkew: true}))
+
+	// clock skew markers are cleaned up.
+	for blobID := range data {
+		require.False(t, strings.HasPrefix(string(blobID), string(clockSkewMarkerBlobPrefix)), blobID)
+	}
+}
+
+func (s *contentManagerSuite) TestCompactIndexesLock(t *testing.T) {
+	ctx := testlogging.Context(t)
+	localTime := faketime.NewClockTimeWithOffset(0)
+	storageSkew := time.Duration(0)
+
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, func() time.Time {
+		return localTime.NowFunc()().Add(storageSkew)
+	})
+
+	fo := mustCreateFormatProvider(t, &format.ContentFormat{
+		Hash:              "HMAC-SHA256",
+		Encryption:        "AES256-GCM-HMAC-SHA256",
+		HMACSecret:        hmacSecret,
+		MutableParameters: s.mutableParameters,
+	})
+
+	bm, err := NewManagerForTesting(ctx, st, fo, nil, &ManagerOptions{TimeNow: localTime.NowFunc()})
+	require.NoError(t, err)
+
+	defer bm.Close(ctx)
+
+	other, err := NewManagerForTesting(ctx, st, fo, nil, &ManagerOptions{TimeNow: localTime.NowFunc()})
+	require.NoError(t, err)
+
+	defer other.Close(ctx)
+
+	writeContentAndVerify(ctx, t, bm, seededRandomData(1, 100))
+	require.NoError(t, bm.Flush(ctx))
+
+	verifyNoLocks := func() {
+		t.Helper()
+
+		for blobID := range data {
+			require.False(t, strings.HasPrefix(string(blobID), string(compactionLockBlobPrefix)), blobID)
+		}
+	}
+
+	// lock held by another client causes compaction to fail fast.
+	release, err := other.acquireCompactionLock(ctx, 0)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1}), ErrCompactionLocked)
+	_, err = other.acquireCompactionLock(ctx, 0)
+	require.ErrorIs(t, err, ErrCompactionLocked)
+
+	release()
+	verifyNoLocks()
+
+	require.NoError(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1}))
+	verifyNoLocks()
+
+	// compaction waits for the lock to be released.
+	release, err = other.acquireCompactionLock(ctx, 0)
+	require.NoError(t, err)
+
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		release()
+	}()
+
+	require.NoError(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1, LockWaitTime: time.Minute}))
+	verifyNoLocks()
+
+	// lock left behind by a crashed client expires.
+	_, err = other.acquireCompactionLock(ctx, 0)
+	require.NoError(t, err)
+	require.ErrorIs(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1}), ErrCompactionLocked)
+
+	localTime.Advance(compactionLockTTL + time.Minute)
+	require.NoError(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1}))
+
+	for blobID := range data {
+		if strings.HasPrefix(string(blobID), string(compactionLockBlobPrefix)) {
+			delete(data, blobID)
+		}
+	}
+
+	// renewed lock does not expire.
+	release, err = other.acquireCompactionLock(ctx, 0)
+	require.NoError(t, err)
+
+	for blobID := range data {
+		if strings.HasPrefix(string(blobID), string(compactionLockBlobPrefix)) {
+			localTime.Advance(compactionLockTTL - time.Minute)
+			require.NoError(t, other.writeCompactionLock(ctx, blobID))
+			localTime.Advance(compactionLockTTL - time.Minute)
+		}
+	}
+
+	require.ErrorIs(t, bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1}), ErrCompactionLocked)
+
+	release()
+	verifyNoLocks()
+
+	// lock is released even if the context it was acquired with is canceled.
+	lockCtx, cancel := context.WithCancel(ctx)
+
+	release, err = other.acquireCompactionLock(lockCtx, 0)
+	require.NoError(t, err)
+
+	cancel()
+	release()
+	verifyNoLocks()
+
+	// lock is released when compaction fails.
+	storageSkew = time.Hour
+
+	err = bm.CompactIndexes(ctx, CompactOptions{MaxSmallBlobs: 1, DropDeletedBefore: localTime.NowFunc()(), FailOnClockSkew: true})
+	require.ErrorIs(t, err, ErrClockSkew)
+	verifyNoLocks()
+}
+
+func (s *contentManagerSuite) TestContentManagerWithContentMAC(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	fo := mustCreateFormatProvider(t, &format.ContentFormat{
+		Hash:              "HMAC-SHA256",
+		Encryption:        "AES256-GCM-HMAC-SHA256",
+		HMACSecret:        hmacSecret,
+		MasterKey:         make([]byte, 32),
+		ContentMAC:        true,
+		MutableParameters: s.mutableParameters,
+	})
+
+	bm, err := NewManagerForTesting(ctx, st, fo, nil, nil)
+	require.NoError(t, err)
+
+	defer bm.Close(ctx)
+
+	contentID := writeContentAndVerify(ctx, t, bm, seededRandomData(1, 100))
+	require.NoError(t, bm.Flush(ctx))
+
+	bm2, err := NewManagerForTesting(ctx, st, fo, nil, nil)
+	require.NoError(t, err)
+
+	defer bm2.Close(ctx)
+
+	verifyContent(ctx, t, bm2, contentID, seededRandomData(1, 100))
+}
+
+func (s *contentManagerSuite) TestSkipContentMACVerification(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	fo := mustCreateFormatProvider(t, &format.ContentFormat{
+		Hash:              "HMAC-SHA256",
+		Encryption:        "AES256-GCM-HMAC-SHA256",
+		HMACSecret:        hmacSecret,
+		MasterKey:         make([]byte, 32),
+		ContentMAC:        true,
+		MutableParameters: s.mutableParameters,
+	})
+
+	bm, err := NewManagerForTesting(ctx, st, fo, nil, nil)
+	require.NoError(t, err)
+
+	defer bm.Close(ctx)
+
+	payload := seededRandomData(1, 100)
+	contentID := writeContentAndVerify(ctx, t, bm, payload)
+	require.NoError(t, bm.Flush(ctx))
+
+	// skipping verification does not affect content IDs.
+	bmSkip, err := NewManagerForTesting(ctx, st, fo, nil, &ManagerOptions{SkipContentMACVerification: true})
+	require.NoError(t, err)
+
+	defer bmSkip.Close(ctx)
+
+	require.Equal(t, contentID, writeContentAndVerify(ctx, t, bmSkip, payload))
+
+	// corrupt the last byte of the stored content, which is part of its MAC.
+	bi, err := bm.ContentInfo(ctx, contentID)
+	require.NoError(t, err)
+
+	data[bi.GetPackBlobID()][bi.GetPackOffset()+bi.GetPackedLength()-1] ^= 1
+
+	// verification is on by default and catches tampering.
+	bm2, err := NewManagerForTesting(ctx, st, fo, nil, nil)
+	require.NoError(t, err)
+
+	defer bm2.Close(ctx)
+
+	_, err = bm2.GetContent(ctx, contentID)
+	require.ErrorIs(t, err, ErrCorruptContent)
+
+	// when verification is skipped, the MAC is ignored.
+	bm3, err := NewManagerForTesting(ctx, st, fo, nil, &ManagerOptions{SkipContentMACVerification: true})
+	require.NoError(t, err)
+
+	defer bm3.Close(ctx)
+
+	verifyContent(ctx, t, bm3, contentID, payload)
+}
+
+func (s *contentManagerSuite) TestReadVerifyProbability(t *testing.T) {
+	var logBuf bytes.Buffer
+
+	ctx := logging.WithLogger(testlogging.Context(t), logging.ToWriter(&logBuf))
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	fo := mustCreateFormatProvider(t, &format.ContentFormat{
+		Hash:              "HMAC-SHA256",
+		Encryption:        "AES256-GCM-HMAC-SHA256",
+		HMACSecret:        hmacSecret,
+		MasterKey:         make([]byte, 32),
+		MutableParameters: s.mutableParameters,
+	})
+
+	bm, err := NewManagerForTesting(ctx, st, fo, nil, nil)
+	require.NoError(t, err)
+
+	defer bm.Close(ctx)
+
+	contentID := writeContentAndVerify(ctx, t, bm, seededRandomData(1, 100))
+	require.NoError(t, bm.Flush(ctx))
+
+	// replace the stored content with different data of the same length encrypted for the same content ID,
+	// which decrypts successfully and can only be detected by verifying the hash.
+	bi, err := bm.ContentInfo(ctx, contentID)
+	require.NoError(t, err)
+
+	var forged gather.WriteBuffer
+	defer forged.Close()
+
+	require.NoError(t, bm.format.Encryptor().Encrypt(gather.FromSlice(seededRandomData(2, 100)), getPackedContentIV(nil, contentID), &forged))
+	require.Equal(t, int(bi.GetPackedLength()), forged.Length())
+
+	copy(data[bi.GetPackBlobID()][bi.GetPackOffset():], forged.ToByteSlice())
+
+	// probability 0 skips verification and returns forged data.
+	bm0, err := NewManagerForTesting(ctx, st, fo, nil, &ManagerOptions{ReadVerifyProbability: 0})
+	require.NoError(t, err)
+
+	defer bm0.Close(ctx)
+
+	verifyContent(ctx, t, bm0, contentID, seededRandomData(2, 100))
+	require.NotContains(t, logBuf.String(), "content hash mismatch")
+
+	// probability 1 verifies every read.
+	bm1, err := NewManagerForTesting(ctx, st, fo, nil, &ManagerOptions{ReadVerifyProbability: 1})
+	require.NoError(t, err)
+
+	defer bm1.Close(ctx)
+
+	_, err = bm1.GetContent(ctx, contentID)
+	require.ErrorIs(t, err, ErrCorruptContent)
+	require.Contains(t, logBuf.String(), "content hash mismatch for "+contentID.String())
+}
+
+func (s *contentManagerSuite) TestContentManagerWithEnvelopeEncryption(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	fo := mustCreateFormatProvider(t, &format.ContentFormat{
+		Hash:               "HMAC-SHA256",
+		HMACSecret:         hmacSecret,
+		MasterKey:          make([]byte, 32),
+		EnvelopeEncryption: true,
+		MutableParameters:  s.mutableParameters,
+	})
+
+	bm, err := NewManagerForTesting(ctx, st, fo, nil, nil)
+	require.NoError(t, err)
+
+	defer bm.Close(ctx)
+
+	contentID := writeContentAndVerify(ctx, t, bm, seededRandomData(1, 100))
+	require.NoError(t, bm.Flush(ctx))
+
+	bm2, err := NewManagerForTesting(ctx, st, fo, nil, nil)
+	require.NoError(t, err)
+
+	defer bm2.Close(ctx)
+
+	verifyContent(ctx, t, bm2, contentID, seededRandomData(1, 100))
+}
+
+func (s *contentManagerSuite) TestCorruptIndexBlobFailsOpen(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
 
-	// create record in index #1
-	st := blobtesting.NewMapStorage(data, keyTime, timeFunc)
+	fo := mustCreateFormatProvider(t, &format.ContentFormat{
+		Hash:              "HMAC-SHA256",
+		Encryption:        "AES256-GCM-HMAC-SHA256",
+		HMACSecret:        hmacSecret,
+		MutableParameters: s.mutableParameters,
+	})
 
-	bm := s.newTestContentManagerWithCustomTime(t, st, timeFunc)
-	content1 := writeContentAndVerify(ctx, t, bm, seededRandomData(10, 100))
+	bm, err := NewManagerForTesting(ctx, st, fo, nil, nil)
+	require.NoError(t, err)
+
+	writeContentAndVerify(ctx, t, bm, seededRandomData(1, 100))
 	require.NoError(t, bm.Flush(ctx))
+
+	ibl, err := bm.IndexBlobs(ctx, false)
+	require.NoError(t, err)
+	require.Len(t, ibl, 1)
 	require.NoError(t, bm.Close(ctx))
 
-	timeFunc()
+	// flip a single bit in the middle of the index blob.
+	corrupted := ibl[0].BlobID
+	data[corrupted][len(data[corrupted])/2] ^= 1
+
+	_, err = NewManagerForTesting(ctx, st, fo, nil, nil)
+	require.ErrorIs(t, err, ErrCorruptIndex)
+	require.NotErrorIs(t, err, ErrCorruptContent)
+	require.Contains(t, err.Error(), fmt.Sprintf("index blob %v failed integrity check", corrupted))
+}
+
+func (s *contentManagerSuite) TestContentManagerWithHashSalt(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	newManager := func(salt []byte) *WriteManager {
+		fo := mustCreateFormatProvider(t, &format.ContentFormat{
+			Hash:              "HMAC-SHA256",
+			Encryption:        "AES256-GCM-HMAC-SHA256",
+			HMACSecret:        hmacSecret,
+			MasterKey:         make([]byte, 32),
+			HashSalt:          salt,
+			MutableParameters: s.mutableParameters,
+		})
+
+		bm, err := NewManagerForTesting(ctx, blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil), fo, nil, nil)
+		require.NoError(t, err)
+
+		t.Cleanup(func() { bm.Close(ctx) })
+
+		return bm
+	}
+
+	payload := seededRandomData(1, 100)
+
+	write := func(bm *WriteManager) ID {
+		contentID, err := bm.WriteContent(ctx, gather.FromSlice(payload), "", NoCompression)
+		require.NoError(t, err)
+
+		verifyContent(ctx, t, bm, contentID, payload)
+
+		return contentID
+	}
+
+	unsalted := newManager(nil)
+	salted1 := newManager([]byte("salt-1"))
+	salted1Again := newManager([]byte("salt-1"))
+	salted2 := newManager([]byte("salt-2"))
+
+	id0 := write(unsalted)
+	id1 := write(salted1)
+	id2 := write(salted2)
+
+	require.Equal(t, hashValue(t, payload), id0)
+	require.NotEqual(t, id0, id1)
+	require.NotEqual(t, id1, id2)
+
+	// identical content is deduplicated within a repository and across repositories sharing the salt.
+	require.Equal(t, id1, write(salted1))
+	require.Equal(t, id1, write(salted1Again))
+}
+
+func (s *contentManagerSuite) TestVerifyContentsSampling(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	bm := s.newTestContentManagerWithCustomTime(t, st, nil)
+	defer bm.Close(ctx)
+
+	const numContents = 2000
+
+	for i := 0; i < numContents; i++ {
+		writeContentAndVerify(ctx, t, bm, seededRandomData(i, 50))
+	}
 
-	// create record in index #2
-	bm = s.newTestContentManagerWithCustomTime(t, st, timeFunc)
-	deleteContent(ctx, t, bm, content1)
 	require.NoError(t, bm.Flush(ctx))
-	require.NoError(t, bm.Close(ctx))
 
-	timeFunc()
+	sample := func(seed int64) (*VerifyResult, map[ID]bool) {
+		var mu sync.Mutex
 
-	deleteThreshold := timeFunc()
+		verified := map[ID]bool{}
 
-	t.Logf("----- compaction")
+		res, err := VerifyContents(ctx, bm, VerifyOptions{
+			SamplePercent: 10,
+			Seed:          seed,
+			Parallel:      4,
+			OnContentVerified: func(ci Info, err error) {
+				require.NoError(t, err)
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				verified[ci.GetContentID()] = true
+			},
+		})
+		require.NoError(t, err)
+
+		return res, verified
+	}
+
+	res, verified := sample(1)
+
+	require.Equal(t, numContents, res.TotalContents)
+	require.Len(t, verified, res.VerifiedContents)
+	require.InDelta(t, numContents/10, res.VerifiedContents, numContents/20)
+
+	require.Zero(t, res.ErrorCount)
+	require.Zero(t, res.EstimatedErrorRate)
+	require.Greater(t, res.ErrorRateUpperBound, 0.0)
+	require.Less(t, res.ErrorRateUpperBound, 0.05)
+
+	// index blobs are verified regardless of sampling.
+	require.NotZero(t, res.VerifiedIndexBlobs)
+	require.Zero(t, res.IndexBlobErrorCount)
+
+	// same seed yields the same selection, different seed a different one.
+	_, verified2 := sample(1)
+	require.Equal(t, verified, verified2)
+
+	_, verified3 := sample(2)
+	require.NotEqual(t, verified, verified3)
+
+	// full verification.
+	res, err := VerifyContents(ctx, bm, VerifyOptions{})
+	require.NoError(t, err)
+	require.Equal(t, numContents, res.VerifiedContents)
+	require.Zero(t, res.ErrorRateUpperBound)
+
+	// corrupted index blob is detected even with a tiny sample.
+	for blobID := range data {
+		if blobID[0] == 'x' || blobID[0] == 'n' {
+			data[blobID][len(data[blobID])-1] ^= 1
+			break
+		}
+	}
+
+	res, err = VerifyContents(ctx, bm, VerifyOptions{SamplePercent: 0.01})
+	require.NoError(t, err)
+	require.Equal(t, 1, res.IndexBlobErrorCount)
+}
+
+func (s *contentManagerSuite) TestVerifyPacks(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	bm := s.newTestContentManagerWithCustomTime(t, st, nil)
+	defer bm.Close(ctx)
+
+	var contentIDs []ID
+
+	// same data as TestPackingSimple
+	for _, d := range []string{"hello, how do you do?", "hi, how are you?", "thank you!"} {
+		contentIDs = append(contentIDs, writeContentAndVerify(ctx, t, bm, []byte(d)))
+	}
 
-	bm = s.newTestContentManagerWithCustomTime(t, st, timeFunc)
-	// this drops deleted entries, including from index #1
-	require.NoError(t, bm.CompactIndexes(ctx, CompactOptions{
-		DropDeletedBefore: deleteThreshold,
-		AllIndexes:        true,
-	}))
 	require.NoError(t, bm.Flush(ctx))
-	require.NoError(t, bm.Close(ctx))
 
-	bm = s.newTestContentManagerWithCustomTime(t, st, timeFunc)
-	verifyContentNotFound(ctx, t, bm, content1)
+	// content superseded by a copy in another pack is only verified in its current pack.
+	require.NoError(t, bm.RewriteContent(ctx, contentIDs[2]))
+	require.NoError(t, bm.Flush(ctx))
+
+	newReader := func() (*WriteManager, *packReadCountingStorage) {
+		cst := &packReadCountingStorage{Storage: st}
+
+		bm2 := s.newTestContentManagerWithCustomTime(t, cst, nil)
+		t.Cleanup(func() { bm2.Close(ctx) })
+
+		return bm2, cst
+	}
+
+	bm2, cst := newReader()
+
+	contentResult, err := VerifyContents(ctx, bm2, VerifyOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 3, contentResult.VerifiedContents)
+	require.Equal(t, int32(3), atomic.LoadInt32(&cst.packReads))
+
+	bm2, cst = newReader()
+
+	packResult, err := VerifyPacks(ctx, bm2, VerifyPacksOptions{Parallel: 2})
+	require.NoError(t, err)
+	require.Equal(t, VerifyPacksResult{TotalPacks: 2, VerifiedPacks: 2, VerifiedContents: 3}, *packResult)
+	require.Equal(t, int32(2), atomic.LoadInt32(&cst.packReads))
+
+	// sampling is done at the level of pack blobs, packs that are not sampled are not fetched.
+	for seed := int64(0); seed < 10; seed++ {
+		bm2, cst = newReader()
+
+		sampled, err := VerifyPacks(ctx, bm2, VerifyPacksOptions{SamplePercent: 50, Seed: seed})
+		require.NoError(t, err)
+		require.Equal(t, 2, sampled.TotalPacks)
+		require.Equal(t, int32(sampled.VerifiedPacks), atomic.LoadInt32(&cst.packReads))
+	}
+
+	// corrupt contents fail verification.
+	ci := getContentInfo(t, bm, contentIDs[1])
+	data[ci.GetPackBlobID()][ci.GetPackOffset()+1] ^= 1
+
+	bm2, _ = newReader()
+
+	packResult, err = VerifyPacks(ctx, bm2, VerifyPacksOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 3, packResult.VerifiedContents)
+	require.Equal(t, 1, packResult.ErrorCount)
+	require.Zero(t, packResult.PackErrorCount)
+}
+
+func (s *contentManagerSuite) TestRefreshRelistsCachedIndexBlobs(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+	faulty := blobtesting.NewFaultyStorage(st)
+
+	bm := s.newTestContentManagerWithTweaks(t, faulty, &contentManagerTestTweaks{
+		CachingOptions: CachingOptions{
+			CacheDirectory:       t.TempDir(),
+			MaxListCacheDuration: 3600,
+		},
+	})
+	defer bm.Close(ctx)
+
+	// another client writes a content, which is not in the cached lists of index blobs.
+	bm2 := s.newTestContentManager(t, st)
+	contentID := writeContentAndVerify(ctx, t, bm2, seededRandomData(1, 100))
+	require.NoError(t, bm2.Flush(ctx))
+	require.NoError(t, bm2.Close(ctx))
+
+	// listing fails twice, then succeeds.
+	someErr := errors.New("some error")
+	faulty.AddFault(blobtesting.MethodListBlobs).ErrorInstead(someErr).Repeat(1)
+
+	require.NoError(t, bm.Refresh(ctx))
+	faulty.VerifyAllFaultsExercised(t)
+
+	verifyContent(ctx, t, bm, contentID, seededRandomData(1, 100))
+
+	// persistent failure.
+	faulty.AddFault(blobtesting.MethodListBlobs).ErrorInstead(someErr).Repeat(100)
+	require.ErrorIs(t, bm.Refresh(ctx), someErr)
 }
 
 func (s *contentManagerSuite) TestContentManagerConcurrency(t *testing.T) {
@@ -1172,53 +2250,252 @@ func (s *contentManagerSuite) TestFlushResumesWriters(t *testing.T) {
 func (s *contentManagerSuite) TestFlushWaitsForAllPendingWriters(t *testing.T) {
 	t.Parallel()
 
-	ctx := testlogging.Context(t)
+	ctx := testlogging.Context(t)
+
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+	st := blobtesting.NewMapStorage(data, keyTime, nil)
+
+	fs := blobtesting.NewFaultyStorage(st)
+
+	// first write is fast (session ID blobs)
+	fs.AddFault(blobtesting.MethodPutBlob)
+	// second write is slow
+	fs.AddFault(blobtesting.MethodPutBlob).SleepFor(2 * time.Second)
+
+	bm := s.newTestContentManagerWithTweaks(t, fs, nil)
+	defer bm.Close(ctx)
+
+	// write one content in another goroutine
+	// 'fs' is configured so that blob write takes several seconds to complete.
+	go writeContentAndVerify(ctx, t, bm, seededRandomData(1, maxPackSize))
+
+	// wait enough time for the goroutine to start writing.
+	time.Sleep(100 * time.Millisecond)
+
+	// write second short content
+	writeContentAndVerify(ctx, t, bm, seededRandomData(1, maxPackSize/4))
+
+	// flush will wait for both writes to complete.
+	t.Logf(">>> start of flushing")
+	bm.Flush(ctx)
+	t.Logf("<<< end of flushing")
+
+	indexBlobPrefix := blob.ID(LegacyIndexBlobPrefix)
+	if s.mutableParameters.EpochParameters.Enabled {
+		indexBlobPrefix = "x"
+	}
+
+	verifyBlobCount(t, data, map[blob.ID]int{
+		PackBlobIDPrefixRegular: 2,
+		indexBlobPrefix:         1,
+	})
+
+	bm.Flush(ctx)
+
+	verifyBlobCount(t, data, map[blob.ID]int{
+		PackBlobIDPrefixRegular: 2,
+		indexBlobPrefix:         1,
+	})
+}
+
+// slowPackStorage is a storage that is slow at writing pack blobs and records the maximum number of
+// concurrent pack writes.
+type slowPackStorage struct {
+	blob.Storage
+
+	delay time.Duration
+
+	// +checkatomic
+	inFlight int32
+	// +checkatomic
+	maxInFlight int32
+}
+
+func (s *slowPackStorage) PutBlob(ctx context.Context, id blob.ID, data blob.Bytes, opts blob.PutOptions) error {
+	if !strings.HasPrefix(string(id), string(PackBlobIDPrefixRegular)) {
+		return s.Storage.PutBlob(ctx, id, data, opts)
+	}
+
+	n := atomic.AddInt32(&s.inFlight, 1)
+	defer atomic.AddInt32(&s.inFlight, -1)
+
+	for {
+		m := atomic.LoadInt32(&s.maxInFlight)
+		if n <= m || atomic.CompareAndSwapInt32(&s.maxInFlight, m, n) {
+			break
+		}
+	}
+
+	time.Sleep(s.delay)
+
+	return s.Storage.PutBlob(ctx, id, data, opts)
+}
+
+type fakePresenceOracle map[ID]bool
+
+func (o fakePresenceOracle) IsPresent(ctx context.Context, contentID ID) bool {
+	return o[contentID]
+}
+
+func (s *contentManagerSuite) TestBlockPresenceOracle(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	bm := s.newTestContentManager(t, st)
+	defer bm.Close(ctx)
+
+	claimedPresent := seededRandomData(1, 100)
+	notClaimed := seededRandomData(2, 100)
+
+	oracle := fakePresenceOracle{hashValue(t, claimedPresent): true}
+
+	wm := NewWriteManager(ctx, bm.SharedManager, SessionOptions{PresenceOracle: oracle}, "oracle")
+	defer wm.Close(ctx)
+
+	// the oracle is trusted, so the content is not written.
+	cid, err := wm.WriteContent(ctx, gather.FromSlice(claimedPresent), "", NoCompression)
+	require.NoError(t, err)
+	require.Equal(t, hashValue(t, claimedPresent), cid)
+
+	writeContentAndVerify(ctx, t, wm, notClaimed)
+	require.NoError(t, wm.Flush(ctx))
+
+	verifyContentNotFound(ctx, t, wm, cid)
+	verifyContent(ctx, t, wm, hashValue(t, notClaimed), notClaimed)
+}
+
+func (s *contentManagerSuite) TestBlockPresenceOracleVerify(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+
+	bm := s.newTestContentManager(t, blobtesting.NewMapStorage(data, nil, nil))
+	defer bm.Close(ctx)
+
+	// force index load before the other manager writes, so that its contents are not visible without refresh.
+	verifyContentNotFound(ctx, t, bm, hashValue(t, []byte{1}))
+
+	bm2 := s.newTestContentManager(t, blobtesting.NewMapStorage(data, nil, nil))
+	defer bm2.Close(ctx)
+
+	writtenElsewhere := seededRandomData(1, 100)
+	falselyClaimed := seededRandomData(2, 100)
+
+	writtenElsewhereID := writeContentAndVerify(ctx, t, bm2, writtenElsewhere)
+	require.NoError(t, bm2.Flush(ctx))
+
+	info2, err := bm2.ContentInfo(ctx, writtenElsewhereID)
+	require.NoError(t, err)
+
+	oracle := fakePresenceOracle{
+		writtenElsewhereID:           true,
+		hashValue(t, falselyClaimed): true,
+	}
+
+	wm := NewWriteManager(ctx, bm.SharedManager, SessionOptions{PresenceOracle: oracle, VerifyPresenceOracle: true}, "oracle")
+	defer wm.Close(ctx)
+
+	// confirmed claim, the content is not written again.
+	_, err = wm.WriteContent(ctx, gather.FromSlice(writtenElsewhere), "", NoCompression)
+	require.NoError(t, err)
+
+	// claim that can't be confirmed, the content is written.
+	writeContentAndVerify(ctx, t, wm, falselyClaimed)
+
+	// indexes are only refreshed once per session, so contents written elsewhere afterwards are not
+	// confirmed and get written again.
+	writtenLater := seededRandomData(3, 100)
+	writtenLaterID := writeContentAndVerify(ctx, t, bm2, writtenLater)
+	require.NoError(t, bm2.Flush(ctx))
+
+	oracle[writtenLaterID] = true
+
+	writeContentAndVerify(ctx, t, wm, writtenLater)
+	require.NoError(t, wm.Flush(ctx))
+
+	info, err := wm.ContentInfo(ctx, writtenElsewhereID)
+	require.NoError(t, err)
+	require.Equal(t, info2.GetPackBlobID(), info.GetPackBlobID())
+
+	laterInfo2, err := bm2.ContentInfo(ctx, writtenLaterID)
+	require.NoError(t, err)
+
+	laterInfo, err := wm.ContentInfo(ctx, writtenLaterID)
+	require.NoError(t, err)
+	require.NotEqual(t, laterInfo2.GetPackBlobID(), laterInfo.GetPackBlobID())
+
+	verifyContent(ctx, t, wm, hashValue(t, falselyClaimed), falselyClaimed)
+}
+
+func (s *contentManagerSuite) TestMaxPendingPackWrites(t *testing.T) {
+	t.Parallel()
+
+	const (
+		maxPending = 2
+		numWorkers = 8
+		numWrites  = 30
+	)
 
+	ctx := testlogging.Context(t)
 	data := blobtesting.DataMap{}
-	keyTime := map[blob.ID]time.Time{}
-	st := blobtesting.NewMapStorage(data, keyTime, nil)
+	st := &slowPackStorage{
+		Storage: blobtesting.NewMapStorage(data, nil, nil),
+		delay:   20 * time.Millisecond,
+	}
 
-	fs := blobtesting.NewFaultyStorage(st)
+	bm := s.newTestContentManagerWithTweaks(t, st, &contentManagerTestTweaks{
+		ManagerOptions: ManagerOptions{MaxPendingPackWrites: maxPending},
+	})
+	defer bm.Close(ctx)
 
-	// first write is fast (session ID blobs)
-	fs.AddFault(blobtesting.MethodPutBlob)
-	// second write is slow
-	fs.AddFault(blobtesting.MethodPutBlob).SleepFor(2 * time.Second)
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		written = map[ID][]byte{}
+	)
 
-	bm := s.newTestContentManagerWithTweaks(t, fs, nil)
-	defer bm.Close(ctx)
+	for workerID := 0; workerID < numWorkers; workerID++ {
+		workerID := workerID
 
-	// write one content in another goroutine
-	// 'fs' is configured so that blob write takes several seconds to complete.
-	go writeContentAndVerify(ctx, t, bm, seededRandomData(1, maxPackSize))
+		wg.Add(1)
 
-	// wait enough time for the goroutine to start writing.
-	time.Sleep(100 * time.Millisecond)
+		go func() {
+			defer wg.Done()
 
-	// write second short content
-	writeContentAndVerify(ctx, t, bm, seededRandomData(1, maxPackSize/4))
+			for i := 0; i < numWrites; i++ {
+				// each pack fits only a few contents, so writers quickly produce full packs.
+				b := seededRandomData(workerID*numWrites+i, 700)
 
-	// flush will wait for both writes to complete.
-	t.Logf(">>> start of flushing")
-	bm.Flush(ctx)
-	t.Logf("<<< end of flushing")
+				id, err := bm.WriteContent(ctx, gather.FromSlice(b), "", NoCompression)
+				if err != nil {
+					t.Errorf("write error: %v", err)
+					return
+				}
 
-	indexBlobPrefix := blob.ID(LegacyIndexBlobPrefix)
-	if s.mutableParameters.EpochParameters.Enabled {
-		indexBlobPrefix = "x"
+				mu.Lock()
+				written[id] = b
+				mu.Unlock()
+			}
+		}()
 	}
 
-	verifyBlobCount(t, data, map[blob.ID]int{
-		PackBlobIDPrefixRegular: 2,
-		indexBlobPrefix:         1,
-	})
+	wg.Wait()
 
-	bm.Flush(ctx)
+	require.NoError(t, bm.Flush(ctx))
 
-	verifyBlobCount(t, data, map[blob.ID]int{
-		PackBlobIDPrefixRegular: 2,
-		indexBlobPrefix:         1,
-	})
+	require.LessOrEqual(t, atomic.LoadInt32(&st.maxInFlight), int32(maxPending))
+
+	for id, b := range written {
+		verifyContent(ctx, t, bm, id, b)
+	}
+
+	bm2 := s.newTestContentManager(t, blobtesting.NewMapStorage(data, nil, nil))
+	defer bm2.Close(ctx)
+
+	for id, b := range written {
+		verifyContent(ctx, t, bm2, id, b)
+	}
 }
 
 func (s *contentManagerSuite) verifyAllDataPresent(ctx context.Context, t *testing.T, st blob.Storage, contentIDs map[ID]bool) {
@@ -1453,6 +2730,54 @@ func (s *contentManagerSuite) TestRewriteDeleted(t *testing.T) {
 	}
 }
 
+type retentionRecordingStorage struct {
+	blob.Storage
+
+	mu        sync.Mutex
+	retention map[blob.ID]time.Time
+}
+
+func (s *retentionRecordingStorage) ExtendBlobRetention(ctx context.Context, id blob.ID, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.retention[id] = until
+
+	return nil
+}
+
+func (s *contentManagerSuite) TestExtendBlobRetention(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := &retentionRecordingStorage{
+		Storage:   blobtesting.NewMapStorage(data, nil, nil),
+		retention: map[blob.ID]time.Time{},
+	}
+
+	bm := s.newTestContentManager(t, st)
+	defer bm.Close(ctx)
+
+	writeContentAndVerify(ctx, t, bm, seededRandomData(1, 100))
+	require.NoError(t, bm.Flush(ctx))
+	writeContentAndVerify(ctx, t, bm, seededRandomData(2, 100))
+	require.NoError(t, bm.Flush(ctx))
+
+	packs, err := blob.ListAllBlobs(ctx, st, PackBlobIDPrefixRegular)
+	require.NoError(t, err)
+	require.Len(t, packs, 2)
+
+	until := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, bm.ExtendBlobRetention(ctx, []blob.ID{packs[0].BlobID}, until))
+	require.Equal(t, map[blob.ID]time.Time{packs[0].BlobID: until}, st.retention)
+
+	// storage without retention support.
+	bm2 := s.newTestContentManager(t, blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil))
+	defer bm2.Close(ctx)
+
+	require.ErrorIs(t, bm2.ExtendBlobRetention(ctx, []blob.ID{packs[0].BlobID}, until), blob.ErrRetentionExtensionUnsupported)
+}
+
 func (s *contentManagerSuite) TestDeleteAndRecreate(t *testing.T) {
 	ctx := testlogging.Context(t)
 	// simulate race between delete/recreate and delete
@@ -1711,106 +3036,397 @@ func (s *contentManagerSuite) TestFindUnreferencedBlobs(t *testing.T) {
 	verifyUnreferencedBlobsCount(ctx, t, bm, 2)
 }
 
-func (s *contentManagerSuite) TestFindUnreferencedBlobs2(t *testing.T) {
-	ctx := testlogging.Context(t)
-	data := blobtesting.DataMap{}
-	st := blobtesting.NewMapStorage(data, nil, nil)
-	bm := s.newTestContentManager(t, st)
+func (s *contentManagerSuite) TestFindUnreferencedBlobs2(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+	bm := s.newTestContentManager(t, st)
+
+	verifyUnreferencedBlobsCount(ctx, t, bm, 0)
+	contentID := writeContentAndVerify(ctx, t, bm, seededRandomData(10, 100))
+	writeContentAndVerify(ctx, t, bm, seededRandomData(11, 100))
+	dumpContents(ctx, t, bm, "after writing")
+
+	if err := bm.Flush(ctx); err != nil {
+		t.Errorf("flush error: %v", err)
+	}
+
+	dumpContents(ctx, t, bm, "after flush")
+	verifyUnreferencedBlobsCount(ctx, t, bm, 0)
+
+	if err := bm.DeleteContent(ctx, contentID); err != nil {
+		t.Errorf("error deleting content: %v", contentID)
+	}
+
+	dumpContents(ctx, t, bm, "after delete")
+
+	if err := bm.Flush(ctx); err != nil {
+		t.Errorf("flush error: %v", err)
+	}
+
+	dumpContents(ctx, t, bm, "after flush")
+	// content present in first pack, original pack is still referenced
+	verifyUnreferencedBlobsCount(ctx, t, bm, 0)
+}
+
+func dumpContents(ctx context.Context, t *testing.T, bm *WriteManager, caption string) {
+	t.Helper()
+
+	count := 0
+
+	t.Logf("dumping %v contents", caption)
+
+	if err := bm.IterateContents(ctx, IterateOptions{IncludeDeleted: true},
+		func(ci Info) error {
+			t.Logf(" ci[%v]=%#v", count, ci)
+			count++
+			return nil
+		}); err != nil {
+		t.Errorf("error listing contents: %v", err)
+		return
+	}
+
+	t.Logf("finished dumping %v %v contents", count, caption)
+}
+
+func verifyUnreferencedBlobsCount(ctx context.Context, t *testing.T, bm *WriteManager, want int) {
+	t.Helper()
+
+	var unrefCount int32
+
+	err := bm.IterateUnreferencedBlobs(ctx, nil, 1, func(_ blob.Metadata) error {
+		atomic.AddInt32(&unrefCount, 1)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("error in IterateUnreferencedBlobs: %v", err)
+	}
+
+	t.Logf("got %v expecting %v", unrefCount, want)
+
+	if got := int(unrefCount); got != want {
+		t.Fatalf("invalid number of unreferenced contents: %v, wanted %v", got, want)
+	}
+}
+
+func (s *contentManagerSuite) TestContentWriteAliasing(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	keyTime := map[blob.ID]time.Time{}
+	st := blobtesting.NewMapStorage(data, keyTime, faketime.Frozen(fakeTime))
+
+	bm := s.newTestContentManagerWithCustomTime(t, st, faketime.Frozen(fakeTime))
+	defer bm.Close(ctx)
+
+	contentData := []byte{100, 0, 0}
+	id1 := writeContentAndVerify(ctx, t, bm, contentData)
+	contentData[0] = 101
+	id2 := writeContentAndVerify(ctx, t, bm, contentData)
+	bm.Flush(ctx)
+
+	contentData[0] = 102
+
+	id3 := writeContentAndVerify(ctx, t, bm, contentData)
+
+	contentData[0] = 103
+
+	id4 := writeContentAndVerify(ctx, t, bm, contentData)
+
+	verifyContent(ctx, t, bm, id1, []byte{100, 0, 0})
+	verifyContent(ctx, t, bm, id2, []byte{101, 0, 0})
+	verifyContent(ctx, t, bm, id3, []byte{102, 0, 0})
+	verifyContent(ctx, t, bm, id4, []byte{103, 0, 0})
+}
+
+func (s *contentManagerSuite) TestReadFallsBackToAlternateSourceOnCorruption(t *testing.T) {
+	var (
+		logMu  sync.Mutex
+		logBuf bytes.Buffer
+	)
+
+	ctx := logging.WithLogger(testlogging.Context(t), testlogging.PrintfFactory(func(msg string, args ...interface{}) {
+		logMu.Lock()
+		defer logMu.Unlock()
+
+		fmt.Fprintf(&logBuf, msg+"\n", args...)
+	}))
+
+	primaryData := blobtesting.DataMap{}
+	primary := blobtesting.NewMapStorage(primaryData, nil, nil)
+
+	bm := s.newTestContentManager(t, primary)
+	contentData := seededRandomData(1, 100)
+	contentID := writeContentAndVerify(ctx, t, bm, contentData)
+	require.NoError(t, bm.Flush(ctx))
+
+	bi, err := bm.ContentInfo(ctx, contentID)
+	require.NoError(t, err)
+
+	// mirror holds a healthy copy of all blobs.
+	mirrorData := blobtesting.DataMap{}
+	for k, v := range primaryData {
+		mirrorData[k] = append([]byte(nil), v...)
+	}
+
+	mirror := blobtesting.NewMapStorage(mirrorData, nil, nil)
+
+	// corrupt the content in the primary copy of the pack.
+	primaryData[bi.GetPackBlobID()][bi.GetPackOffset()+5] ^= 1
+
+	st := &storageWithMirrors{Storage: primary, mirrors: []blob.Reader{mirror}}
+
+	fo := mustCreateFormatProvider(t, &format.ContentFormat{
+		Hash:              "HMAC-SHA256",
+		Encryption:        "AES256-GCM-HMAC-SHA256",
+		HMACSecret:        hmacSecret,
+		MutableParameters: s.mutableParameters,
+	})
+
+	bm2, err := NewManagerForTesting(ctx, st, fo, nil, &ManagerOptions{
+		TimeNow: faketime.AutoAdvance(fakeTime, 1*time.Second),
+	})
+	require.NoError(t, err)
+
+	defer bm2.Close(ctx)
+
+	got, err := bm2.GetContent(ctx, contentID)
+	require.NoError(t, err)
+	require.Equal(t, contentData, got)
+
+	logMu.Lock()
+	logOutput := logBuf.String()
+	logMu.Unlock()
+
+	require.Contains(t, logOutput, "recovered content "+contentID.String())
+
+	// without mirrors the read fails.
+	bm3, err := NewManagerForTesting(ctx, primary, fo, nil, &ManagerOptions{
+		TimeNow: faketime.AutoAdvance(fakeTime, 1*time.Second),
+	})
+	require.NoError(t, err)
+
+	defer bm3.Close(ctx)
+
+	_, err = bm3.GetContent(ctx, contentID)
+	require.Error(t, err)
+}
+
+func (s *contentManagerSuite) TestRecoveryFromAlternateSourceEvictsCachedContent(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	primaryData := blobtesting.DataMap{}
+	primary := blobtesting.NewMapStorage(primaryData, nil, nil)
+
+	bm := s.newTestContentManager(t, primary)
+	contentData := seededRandomData(1, 100)
+	contentID := writeContentAndVerify(ctx, t, bm, contentData)
+	require.NoError(t, bm.Flush(ctx))
+
+	bi, err := bm.ContentInfo(ctx, contentID)
+	require.NoError(t, err)
+
+	mirrorData := blobtesting.DataMap{}
+	for k, v := range primaryData {
+		mirrorData[k] = append([]byte(nil), v...)
+	}
+
+	primaryData[bi.GetPackBlobID()][bi.GetPackOffset()+5] ^= 1
+
+	bm2 := s.newTestContentManagerWithTweaks(t, &storageWithMirrors{
+		Storage: primary,
+		mirrors: []blob.Reader{blobtesting.NewMapStorage(mirrorData, nil, nil)},
+	}, &contentManagerTestTweaks{
+		CachingOptions: CachingOptions{
+			CacheDirectory:    t.TempDir(),
+			MaxCacheSizeBytes: 100e6,
+		},
+	})
+
+	defer bm2.Close(ctx)
+
+	// the corrupted primary copy gets cached by the read, but is evicted once the content is recovered.
+	got, err := bm2.GetContent(ctx, contentID)
+	require.NoError(t, err)
+	require.Equal(t, contentData, got)
+	require.Empty(t, allCacheKeys(t, bm2.contentCache.CacheStorage()))
+}
+
+func (s *contentManagerSuite) TestVerifyRepairsCorruptedContentFromMirror(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	primaryData := blobtesting.DataMap{}
+	primary := blobtesting.NewMapStorage(primaryData, nil, nil)
+
+	bm := s.newTestContentManager(t, primary)
+	contentData := seededRandomData(1, 100)
+	contentID := writeContentAndVerify(ctx, t, bm, contentData)
+	otherContentID := writeContentAndVerify(ctx, t, bm, seededRandomData(2, 100))
+	require.NoError(t, bm.Flush(ctx))
+
+	bi, err := bm.ContentInfo(ctx, contentID)
+	require.NoError(t, err)
+
+	mirrorData := blobtesting.DataMap{}
+	for k, v := range primaryData {
+		mirrorData[k] = append([]byte(nil), v...)
+	}
+
+	mirror := blobtesting.NewMapStorage(mirrorData, nil, nil)
+
+	// corrupt the content in the primary copy of the pack.
+	primaryData[bi.GetPackBlobID()][bi.GetPackOffset()+5] ^= 1
+
+	fo := mustCreateFormatProvider(t, &format.ContentFormat{
+		Hash:              "HMAC-SHA256",
+		Encryption:        "AES256-GCM-HMAC-SHA256",
+		HMACSecret:        hmacSecret,
+		MutableParameters: s.mutableParameters,
+	})
+
+	newManager := func(st blob.Storage) *WriteManager {
+		m, err := NewManagerForTesting(ctx, st, fo, nil, &ManagerOptions{
+			TimeNow: faketime.AutoAdvance(fakeTime, 1*time.Second),
+		})
+		require.NoError(t, err)
 
-	verifyUnreferencedBlobsCount(ctx, t, bm, 0)
-	contentID := writeContentAndVerify(ctx, t, bm, seededRandomData(10, 100))
-	writeContentAndVerify(ctx, t, bm, seededRandomData(11, 100))
-	dumpContents(ctx, t, bm, "after writing")
+		t.Cleanup(func() { m.Close(ctx) })
 
-	if err := bm.Flush(ctx); err != nil {
-		t.Errorf("flush error: %v", err)
+		return m
 	}
 
-	dumpContents(ctx, t, bm, "after flush")
-	verifyUnreferencedBlobsCount(ctx, t, bm, 0)
+	// without repair the corruption is not fixed.
+	_, err = VerifyContents(ctx, newManager(&storageWithMirrors{Storage: primary, mirrors: []blob.Reader{mirror}}), VerifyOptions{})
+	require.NoError(t, err)
 
-	if err := bm.DeleteContent(ctx, contentID); err != nil {
-		t.Errorf("error deleting content: %v", contentID)
-	}
+	_, err = newManager(primary).GetContent(ctx, contentID)
+	require.Error(t, err)
 
-	dumpContents(ctx, t, bm, "after delete")
+	// mirror copy which is valid for the corrupted content but not for another content in the same pack is not used.
+	otherInfo, err := bm.ContentInfo(ctx, otherContentID)
+	require.NoError(t, err)
+	require.Equal(t, bi.GetPackBlobID(), otherInfo.GetPackBlobID())
 
-	if err := bm.Flush(ctx); err != nil {
-		t.Errorf("flush error: %v", err)
-	}
+	mirrorData[bi.GetPackBlobID()][otherInfo.GetPackOffset()+5] ^= 1
 
-	dumpContents(ctx, t, bm, "after flush")
-	// content present in first pack, original pack is still referenced
-	verifyUnreferencedBlobsCount(ctx, t, bm, 0)
-}
+	res, err := VerifyContents(ctx, newManager(&storageWithMirrors{Storage: primary, mirrors: []blob.Reader{mirror}}), VerifyOptions{Repair: true})
+	require.NoError(t, err)
+	require.Equal(t, 0, res.RepairedContents)
+	require.Equal(t, 1, res.ErrorCount)
 
-func dumpContents(ctx context.Context, t *testing.T, bm *WriteManager, caption string) {
-	t.Helper()
+	mirrorData[bi.GetPackBlobID()][otherInfo.GetPackOffset()+5] ^= 1
 
-	count := 0
+	// alternate sources are found through storage wrappers.
+	wrapped := bloblogging.NewWrapper(&storageWithMirrors{Storage: primary, mirrors: []blob.Reader{mirror}}, testlogging.NewTestLogger(t), "")
 
-	t.Logf("dumping %v contents", caption)
+	res, err = VerifyContents(ctx, newManager(wrapped), VerifyOptions{Repair: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, res.RepairedContents)
+	require.Equal(t, 0, res.ErrorCount)
 
-	if err := bm.IterateContents(ctx, IterateOptions{IncludeDeleted: true},
-		func(ci Info) error {
-			t.Logf(" ci[%v]=%#v", count, ci)
-			count++
-			return nil
-		}); err != nil {
-		t.Errorf("error listing contents: %v", err)
-		return
-	}
+	// primary copy is now valid.
+	bm2 := newManager(primary)
+	verifyContent(ctx, t, bm2, contentID, contentData)
+	verifyContent(ctx, t, bm2, otherContentID, seededRandomData(2, 100))
 
-	t.Logf("finished dumping %v %v contents", count, caption)
+	// corruption that is also present in the mirror can't be repaired and is reported.
+	primaryData[bi.GetPackBlobID()][bi.GetPackOffset()+5] ^= 1
+	mirrorData[bi.GetPackBlobID()][bi.GetPackOffset()+5] ^= 1
+
+	res, err = VerifyContents(ctx, newManager(&storageWithMirrors{Storage: primary, mirrors: []blob.Reader{mirror}}), VerifyOptions{Repair: true})
+	require.NoError(t, err)
+	require.Equal(t, 0, res.RepairedContents)
+	require.Equal(t, 1, res.ErrorCount)
 }
 
-func verifyUnreferencedBlobsCount(ctx context.Context, t *testing.T, bm *WriteManager, want int) {
-	t.Helper()
+func (s *contentManagerSuite) TestExportCorruptedContent(t *testing.T) {
+	ctx := testlogging.Context(t)
 
-	var unrefCount int32
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
 
-	err := bm.IterateUnreferencedBlobs(ctx, nil, 1, func(_ blob.Metadata) error {
-		atomic.AddInt32(&unrefCount, 1)
-		return nil
-	})
-	if err != nil {
-		t.Errorf("error in IterateUnreferencedBlobs: %v", err)
-	}
+	bm := s.newTestContentManager(t, st)
+	contentData := seededRandomData(1, 100)
+	contentID := writeContentAndVerify(ctx, t, bm, contentData)
+	require.NoError(t, bm.Flush(ctx))
 
-	t.Logf("got %v expecting %v", unrefCount, want)
+	bi, err := bm.ContentInfo(ctx, contentID)
+	require.NoError(t, err)
 
-	if got := int(unrefCount); got != want {
-		t.Fatalf("invalid number of unreferenced contents: %v, wanted %v", got, want)
-	}
+	packed := data[bi.GetPackBlobID()][bi.GetPackOffset() : bi.GetPackOffset()+bi.GetPackedLength()]
+
+	exp, err := bm.ExportContent(ctx, contentID)
+	require.NoError(t, err)
+	require.True(t, exp.HashMatches)
+	require.Empty(t, exp.Error)
+	require.Equal(t, packed, exp.RawData)
+	require.Equal(t, contentID.Hash(), exp.ComputedHash)
+	require.Equal(t, bi.GetPackBlobID(), exp.PackBlobID)
+	require.Equal(t, bi.GetPackOffset(), exp.PackOffset)
+
+	// replace the payload with a validly-encrypted payload of different data.
+	var reencrypted gather.WriteBuffer
+	defer reencrypted.Close()
+
+	require.NoError(t, bm.format.Encryptor().Encrypt(gather.FromSlice(seededRandomData(2, 100)), getPackedContentIV(nil, contentID), &reencrypted))
+	require.Equal(t, len(packed), reencrypted.Length())
+	copy(packed, reencrypted.ToByteSlice())
+
+	exp, err = bm.ExportContent(ctx, contentID)
+	require.NoError(t, err)
+	require.False(t, exp.HashMatches)
+	require.Equal(t, "hash mismatch", exp.Error)
+	require.Equal(t, contentID.Hash(), exp.ExpectedHash)
+	require.NotEqual(t, exp.ExpectedHash, exp.ComputedHash)
+	require.Equal(t, packed, exp.RawData)
+
+	// corrupted payload that can't be decrypted is still exported.
+	packed[5] ^= 1
+
+	exp, err = bm.ExportContent(ctx, contentID)
+	require.NoError(t, err)
+	require.False(t, exp.HashMatches)
+	require.Contains(t, exp.Error, "invalid checksum")
+	require.Empty(t, exp.ComputedHash)
+	require.Equal(t, packed, exp.RawData)
+
+	_, err = bm.ExportContent(ctx, mustParseID(t, strings.Repeat("ab", 32)))
+	require.ErrorIs(t, err, ErrContentNotFound)
 }
 
-func (s *contentManagerSuite) TestContentWriteAliasing(t *testing.T) {
+func (s *contentManagerSuite) TestCorruptContentError(t *testing.T) {
 	ctx := testlogging.Context(t)
+
 	data := blobtesting.DataMap{}
-	keyTime := map[blob.ID]time.Time{}
-	st := blobtesting.NewMapStorage(data, keyTime, faketime.Frozen(fakeTime))
+	st := blobtesting.NewMapStorage(data, nil, nil)
 
-	bm := s.newTestContentManagerWithCustomTime(t, st, faketime.Frozen(fakeTime))
-	defer bm.Close(ctx)
+	bm := s.newTestContentManager(t, st)
+	contentID := writeContentAndVerify(ctx, t, bm, seededRandomData(1, 100))
+	require.NoError(t, bm.Flush(ctx))
 
-	contentData := []byte{100, 0, 0}
-	id1 := writeContentAndVerify(ctx, t, bm, contentData)
-	contentData[0] = 101
-	id2 := writeContentAndVerify(ctx, t, bm, contentData)
-	bm.Flush(ctx)
+	bi, err := bm.ContentInfo(ctx, contentID)
+	require.NoError(t, err)
 
-	contentData[0] = 102
+	data[bi.GetPackBlobID()][bi.GetPackOffset()+5] ^= 1
 
-	id3 := writeContentAndVerify(ctx, t, bm, contentData)
+	bm2 := s.newTestContentManager(t, st)
 
-	contentData[0] = 103
+	_, err = bm2.GetContent(ctx, contentID)
+	require.ErrorIs(t, err, ErrCorruptContent)
+	require.NotErrorIs(t, err, ErrContentNotFound)
 
-	id4 := writeContentAndVerify(ctx, t, bm, contentData)
+	_, err = bm2.GetContent(ctx, mustParseID(t, strings.Repeat("ab", 32)))
+	require.ErrorIs(t, err, ErrContentNotFound)
+	require.NotErrorIs(t, err, ErrCorruptContent)
+}
 
-	verifyContent(ctx, t, bm, id1, []byte{100, 0, 0})
-	verifyContent(ctx, t, bm, id2, []byte{101, 0, 0})
-	verifyContent(ctx, t, bm, id3, []byte{102, 0, 0})
-	verifyContent(ctx, t, bm, id4, []byte{103, 0, 0})
+type storageWithMirrors struct {
+	blob.Storage
+
+	mirrors []blob.Reader
+}
+
+func (s *storageWithMirrors) AlternateSources() []blob.Reader {
+	return s.mirrors
 }
 
 func (s *contentManagerSuite) TestAutoCompressionOfMetadata(t *testing.T) {
@@ -1947,7 +3563,7 @@ func (s *contentManagerSuite) TestReadsOwnWritesWithEventualConsistencyPersisten
 	cacheKeyTime := map[blob.ID]time.Time{}
 	cacheSt := blobtesting.NewMapStorage(cacheData, cacheKeyTime, timeNow)
 	ecst := blobtesting.NewEventuallyConsistentStorage(
-		logging.NewWrapper(st, testlogging.NewTestLogger(t), "[STORAGE] "),
+		bloblogging.NewWrapper(st, testlogging.NewTestLogger(t), "[STORAGE] "),
 		3*time.Second,
 		timeNow)
 
@@ -1961,7 +3577,7 @@ func (s *contentManagerSuite) TestReadsOwnWritesWithStrongConsistencyAndNoCachin
 	st := blobtesting.NewMapStorage(data, nil, timeNow)
 
 	// if we used nullOwnWritesCache and eventual consistency, the test would fail
-	// st = blobtesting.NewEventuallyConsistentStorage(logging.NewWrapper(st, t.Logf, "[STORAGE] "), 0.1)
+	// st = blobtesting.NewEventuallyConsistentStorage(bloblogging.NewWrapper(st, t.Logf, "[STORAGE] "), 0.1)
 
 	// disable own writes cache, will still be ok if store is strongly consistent
 	s.verifyReadsOwnWrites(t, st, timeNow)
@@ -2152,6 +3768,313 @@ func (s *contentManagerSuite) TestContentCachingByFormat(t *testing.T) {
 	require.Equal(t, v1, v2)
 }
 
+func (s *contentManagerSuite) TestWarmup(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	bm := s.newTestContentManagerWithTweaks(t, st, nil)
+
+	var metadataIDs, dataIDs []ID
+
+	for i := 0; i < 10; i++ {
+		mid, err := bm.WriteContent(ctx, gather.FromSlice(seededRandomData(i, 100)), "m", NoCompression)
+		require.NoError(t, err)
+
+		metadataIDs = append(metadataIDs, mid)
+
+		did, err := bm.WriteContent(ctx, gather.FromSlice(seededRandomData(100+i, 100)), "", NoCompression)
+		require.NoError(t, err)
+
+		dataIDs = append(dataIDs, did)
+	}
+
+	require.NoError(t, bm.Flush(ctx))
+
+	newManagerWithCache := func() *WriteManager {
+		return s.newTestContentManagerWithTweaks(t, st, &contentManagerTestTweaks{
+			CachingOptions: CachingOptions{
+				CacheDirectory:            testutil.TempDirectory(t),
+				MaxCacheSizeBytes:         100e6,
+				MaxMetadataCacheSizeBytes: 100e6,
+			},
+		})
+	}
+
+	// warm-up is safe to run concurrently with reads.
+	bm1 := newManagerWithCache()
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for i, mid := range metadataIDs {
+			verifyContent(ctx, t, bm1, mid, seededRandomData(i, 100))
+		}
+	}()
+
+	require.NoError(t, bm1.Warmup(ctx, "m"))
+	wg.Wait()
+
+	bm2 := newManagerWithCache()
+
+	require.Error(t, bm2.Warmup(ctx, "mm"))
+	require.NoError(t, bm2.Warmup(ctx, "m"))
+
+	// remove all pack blobs holding metadata contents from the storage, warmed up
+	// contents must be served from the cache without fetching.
+	for _, mid := range metadataIDs {
+		delete(data, getContentInfo(t, bm2, mid).GetPackBlobID())
+	}
+
+	for i, mid := range metadataIDs {
+		verifyContent(ctx, t, bm2, mid, seededRandomData(i, 100))
+	}
+
+	// data contents were not warmed up.
+	for _, did := range dataIDs {
+		delete(data, getContentInfo(t, bm2, did).GetPackBlobID())
+	}
+
+	_, err := bm2.GetContent(ctx, dataIDs[0])
+	require.Error(t, err)
+}
+
+// packReadCountingStorage counts reads of pack blobs.
+type packReadCountingStorage struct {
+	blob.Storage
+
+	// +checkatomic
+	packReads int32
+}
+
+func (s *packReadCountingStorage) GetBlob(ctx context.Context, id blob.ID, offset, length int64, output blob.OutputBuffer) error {
+	if strings.HasPrefix(string(id), string(PackBlobIDPrefixRegular)) || strings.HasPrefix(string(id), string(PackBlobIDPrefixSpecial)) {
+		atomic.AddInt32(&s.packReads, 1)
+	}
+
+	return s.Storage.GetBlob(ctx, id, offset, length, output)
+}
+
+func (s *contentManagerSuite) TestListContentsLazy(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	bm := s.newTestContentManagerWithTweaks(t, st, nil)
+
+	const numContents = 30
+
+	want := map[ID][]byte{}
+
+	for i := 0; i < numContents; i++ {
+		d := seededRandomData(i, 100)
+
+		cid, err := bm.WriteContent(ctx, gather.FromSlice(d), "k", NoCompression)
+		require.NoError(t, err)
+
+		want[cid] = d
+	}
+
+	// contents with a different prefix are not returned.
+	_, err := bm.WriteContent(ctx, gather.FromSlice([]byte("other")), "", NoCompression)
+	require.NoError(t, err)
+
+	require.NoError(t, bm.Flush(ctx))
+
+	cst := &packReadCountingStorage{Storage: st}
+	bm2 := s.newTestContentManagerWithTweaks(t, cst, nil)
+
+	_, err = bm2.ListContentsLazy(ctx, "xx")
+	require.Error(t, err)
+
+	next, err := bm2.ListContentsLazy(ctx, "k")
+	require.NoError(t, err)
+
+	// nothing is fetched until the iterator is called.
+	require.Equal(t, int32(0), atomic.LoadInt32(&cst.packReads))
+
+	var (
+		got     = map[ID][]byte{}
+		lastID  string
+		fetched int
+	)
+
+	for {
+		cid, d, ok, err := next()
+		if !ok {
+			break
+		}
+
+		require.NoError(t, err)
+		require.Greater(t, cid.String(), lastID)
+
+		lastID = cid.String()
+		got[cid] = d
+		fetched++
+
+		// at most lazyListLookahead contents are fetched ahead of the caller.
+		require.LessOrEqual(t, int(atomic.LoadInt32(&cst.packReads)), fetched+lazyListLookahead)
+	}
+
+	require.Equal(t, want, got)
+	require.Equal(t, int32(numContents), atomic.LoadInt32(&cst.packReads))
+
+	// the iterator keeps returning false after the last content.
+	_, _, ok, err := next()
+	require.False(t, ok)
+	require.NoError(t, err)
+}
+
+func (s *contentManagerSuite) TestFlushCoalescing(t *testing.T) {
+	const numWriters = 5
+
+	independentPacks, _ := s.writeConcurrentlyAndCountPacks(t, numWriters, 0)
+	require.Equal(t, numWriters, independentPacks)
+
+	coalescedPacks, data := s.writeConcurrentlyAndCountPacks(t, numWriters, 3*time.Second)
+	require.Less(t, coalescedPacks, independentPacks)
+
+	// the content written by all writers is stored once in the coalesced packs.
+	bm := s.newTestContentManagerWithTweaks(t, blobtesting.NewMapStorage(data, nil, nil), nil)
+	shared, err := bm.ContentInfo(testlogging.Context(t), hashValue(t, []byte("shared")))
+	require.NoError(t, err)
+
+	var sharedCount int
+
+	require.NoError(t, bm.IterateContents(testlogging.Context(t), IterateOptions{}, func(ci Info) error {
+		if ci.GetContentID() == shared.GetContentID() {
+			sharedCount++
+		}
+
+		return nil
+	}))
+
+	require.Equal(t, 1, sharedCount)
+}
+
+// writeConcurrentlyAndCountPacks writes overlapping contents using multiple concurrent write managers,
+// which then flush at the same time, and returns the number of resulting pack blobs.
+func (s *contentManagerSuite) writeConcurrentlyAndCountPacks(t *testing.T, numWriters int, coalescingWindow time.Duration) (int, blobtesting.DataMap) {
+	t.Helper()
+
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	bm := s.newTestContentManagerWithTweaks(t, st, &contentManagerTestTweaks{
+		ManagerOptions: ManagerOptions{FlushCoalescingWindow: coalescingWindow},
+	})
+
+	want := map[ID][]byte{}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for i := 0; i < numWriters; i++ {
+		w := NewWriteManager(ctx, bm.SharedManager, SessionOptions{}, fmt.Sprintf("writer-%v", i))
+
+		for _, d := range [][]byte{[]byte("shared"), seededRandomData(i, 100), seededRandomData(i+100, 100)} {
+			cid, err := w.WriteContent(ctx, gather.FromSlice(d), "", NoCompression)
+			require.NoError(t, err)
+
+			want[cid] = d
+		}
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			err := w.Flush(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			require.NoError(t, err)
+			require.NoError(t, w.Close(ctx))
+		}()
+	}
+
+	wg.Wait()
+
+	bm2 := s.newTestContentManagerWithTweaks(t, st, nil)
+
+	for cid, d := range want {
+		verifyContent(ctx, t, bm2, cid, d)
+	}
+
+	blobs, err := blob.ListAllBlobs(ctx, st, PackBlobIDPrefixRegular)
+	require.NoError(t, err)
+
+	ibl, err := bm2.IndexBlobs(ctx, false)
+	require.NoError(t, err)
+
+	// each pack must be written under the session of a writer whose index references it.
+	for _, b := range blobs {
+		packSession := string(b.BlobID[strings.LastIndex(string(b.BlobID), "-")+1:])
+
+		var found bool
+
+		for _, ib := range ibl {
+			if strings.Contains(string(ib.BlobID), "-"+packSession) {
+				found = true
+			}
+		}
+
+		require.True(t, found, "no index written by session of %v", b.BlobID)
+	}
+
+	return len(blobs), data
+}
+
+func (s *contentManagerSuite) TestFlushCoalescingCanceled(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	st := blobtesting.NewMapStorage(data, nil, nil)
+
+	bm := s.newTestContentManagerWithTweaks(t, st, &contentManagerTestTweaks{
+		ManagerOptions: ManagerOptions{FlushCoalescingWindow: time.Hour},
+	})
+
+	d := seededRandomData(1, 100)
+
+	cid, err := bm.WriteContent(ctx, gather.FromSlice(d), "", NoCompression)
+	require.NoError(t, err)
+
+	cctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	flushErr := make(chan error, 1)
+
+	go func() {
+		flushErr <- bm.Flush(cctx)
+	}()
+
+	// the content remains readable while the flush is waiting for other participants.
+	verifyContent(ctx, t, bm, cid, d)
+
+	select {
+	case err := <-flushErr:
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(10 * time.Second):
+		t.Fatalf("flush did not honor context cancellation")
+	}
+
+	verifyContent(ctx, t, bm, cid, d)
+
+	// the next flush retries writing the content independently.
+	bm.flushCoordinator = nil
+
+	require.NoError(t, bm.Flush(ctx))
+	verifyContent(ctx, t, s.newTestContentManagerWithTweaks(t, st, nil), cid, d)
+}
+
 func contentIDCacheKey(id ID) string {
 	return cache.ContentIDCacheKey(id.String()) + ".0.1.0"
 }
@@ -2327,9 +4250,10 @@ type contentManagerTestTweaks struct {
 	CachingOptions
 	ManagerOptions
 
-	indexVersion  int
-	maxPackSize   int
-	formatVersion format.Version
+	indexVersion      int
+	maxPackSize       int
+	maxIndexBlockSize int
+	formatVersion     format.Version
 }
 
 func (s *contentManagerSuite) newTestContentManagerWithTweaks(t *testing.T, st blob.Storage, tweaks *contentManagerTestTweaks) *WriteManager {
@@ -2354,6 +4278,10 @@ func (s *contentManagerSuite) newTestContentManagerWithTweaks(t *testing.T, st b
 		mp.MaxPackSize = mps
 	}
 
+	if mibs := tweaks.maxIndexBlockSize; mibs != 0 {
+		mp.MaxIndexBlockSize = mibs
+	}
+
 	if tweaks.formatVersion != 0 {
 		mp.Version = tweaks.formatVersion
 	}
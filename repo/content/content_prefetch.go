@@ -6,8 +6,11 @@
 	"strings"
 	"sync"
 
+	"github.com/pkg/errors"
+
 	"github.com/kopia/kopia/internal/gather"
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content/index"
 )
 
 type prefetchOptions struct {
@@ -137,3 +140,29 @@ type work struct {
 
 	return prefetched
 }
+
+// Warmup proactively fetches the pack blobs holding all contents with the provided prefix into
+// the cache, so that subsequent reads of those contents don't hit the storage. Contents with
+// non-empty prefixes (such as manifests or directories) are loaded into the metadata cache.
+// The cache size limits still apply, so not all contents are guaranteed to remain cached.
+// It is safe to call Warmup concurrently with reads.
+func (bm *WriteManager) Warmup(ctx context.Context, prefix IDPrefix) error {
+	if err := prefix.ValidateSingle(); err != nil {
+		return errors.Wrap(err, "invalid prefix")
+	}
+
+	var ids []ID
+
+	if err := bm.IterateContents(ctx, IterateOptions{Range: index.PrefixRange(prefix)}, func(ci Info) error {
+		ids = append(ids, ci.GetContentID())
+		return nil
+	}); err != nil {
+		return errors.Wrap(err, "error listing contents")
+	}
+
+	bm.log.Debugw("warming up cache", "prefix", prefix, "contents", len(ids))
+
+	bm.PrefetchContents(ctx, ids, "blobs")
+
+	return errors.Wrap(ctx.Err(), "warmup canceled")
+}
@@ -15,6 +15,7 @@ type Reader interface {
 	ContentInfo(ctx context.Context, id ID) (Info, error)
 	IterateContents(ctx context.Context, opts IterateOptions, callback IterateCallback) error
 	IteratePacks(ctx context.Context, opts IteratePackOptions, callback IteratePacksCallback) error
+	ListPacks(ctx context.Context) ([]PackInfo, error)
 	ListActiveSessions(ctx context.Context) (map[SessionID]*SessionInfo, error)
 	EpochManager() (*epoch.Manager, bool, error)
 }
@@ -0,0 +1,361 @@
+package content
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content/index"
+)
+
+// verifyConfidenceZ is the z-score corresponding to 95% confidence used to estimate error rate bounds.
+const verifyConfidenceZ = 1.96
+
+// VerifyOptions provides options for VerifyContents.
+type VerifyOptions struct {
+	Range          IDRange
+	IncludeDeleted bool
+	Parallel       int
+
+	// SamplePercent is the percentage of contents (0..100) to download and verify, values <= 0 or >= 100
+	// cause all contents to be verified. Each content is sampled independently with the same probability,
+	// so the sample is representative of all contents. Index blobs are always verified in full.
+	SamplePercent float64
+
+	// Seed determines the selection of sampled contents, the same seed always selects the same contents.
+	Seed int64
+
+	// BlobMap, when provided, is used to check that each content (sampled or not) is within bounds
+	// of an existing pack blob.
+	BlobMap map[blob.ID]blob.Metadata
+
+	// OnContentVerified is invoked after each content has been verified with the verification error, if any.
+	OnContentVerified func(ci Info, err error)
+
+	// OnIndexBlobVerified is invoked after each index blob has been verified with the verification error, if any.
+	OnIndexBlobVerified func(blobID blob.ID, err error)
+
+	// Repair causes contents whose primary copy is corrupted to be repaired by re-writing their pack blob
+	// using a valid copy obtained from alternate sources (such as mirrors) provided by the storage.
+	// Corruptions that can't be recovered are only reported.
+	Repair bool
+}
+
+// VerifyResult describes the result of VerifyContents.
+type VerifyResult struct {
+	TotalContents    int `json:"totalContents"`
+	VerifiedContents int `json:"verifiedContents"`
+	ErrorCount       int `json:"errorCount"`
+
+	// InvalidPackErrorCount is the number of contents referencing missing pack blobs or out of their bounds.
+	InvalidPackErrorCount int `json:"invalidPackErrorCount"`
+
+	// VerifiedIndexBlobs is the number of verified index blobs, IndexBlobErrorCount of which were invalid.
+	VerifiedIndexBlobs  int `json:"verifiedIndexBlobs"`
+	IndexBlobErrorCount int `json:"indexBlobErrorCount"`
+
+	// RepairedContents is the number of corrupted contents that were repaired, they are not counted as errors.
+	RepairedContents int `json:"repairedContents,omitempty"`
+
+	// EstimatedErrorRate is the fraction of verified contents that were found to be invalid.
+	EstimatedErrorRate float64 `json:"estimatedErrorRate"`
+
+	// ErrorRateUpperBound is the upper bound of the fraction of invalid contents
+	// in the entire repository at 95% confidence level.
+	ErrorRateUpperBound float64 `json:"errorRateUpperBound"`
+}
+
+// sampleScore returns deterministic pseudo-random number in the [0,1) range for the provided key
+// (content ID or blob ID) and seed.
+func sampleScore(seed int64, key string) float64 {
+	var buf [8]byte
+
+	binary.LittleEndian.PutUint64(buf[:], uint64(seed))
+
+	h := sha256.New()
+	h.Write(buf[:])      //nolint:errcheck
+	h.Write([]byte(key)) //nolint:errcheck
+
+	return float64(binary.LittleEndian.Uint64(h.Sum(nil))>>11) / (1 << 53) //nolint:gomnd
+}
+
+// contentRepairer is implemented by content managers that can repair primary copies of contents.
+type contentRepairer interface {
+	verifyAndRepairContent(ctx context.Context, ci Info) (repaired bool, err error)
+}
+
+// indexBlobVerifier is implemented by content managers that can verify their index blobs.
+type indexBlobVerifier interface {
+	verifyIndexBlobs(ctx context.Context, onVerified func(blobID blob.ID, err error)) error
+}
+
+// VerifyContents downloads and verifies contents in the repository, optionally only verifying a deterministic
+// sample of them, and returns the statistical estimate of the error rate among all contents. All active index
+// blobs are verified as well.
+func VerifyContents(ctx context.Context, r Reader, opt VerifyOptions) (*VerifyResult, error) {
+	var (
+		mu     sync.Mutex
+		result VerifyResult
+	)
+
+	sampleAll := opt.SamplePercent <= 0 || opt.SamplePercent >= 100 //nolint:gomnd
+
+	repairer, _ := r.(contentRepairer)
+	if !opt.Repair {
+		repairer = nil
+	}
+
+	verify := func(ci Info) {
+		var (
+			repaired bool
+			err      error
+		)
+
+		if repairer != nil {
+			repaired, err = repairer.verifyAndRepairContent(ctx, ci)
+		} else {
+			_, err = r.GetContent(ctx, ci.GetContentID())
+		}
+
+		if err != nil {
+			err = errors.Wrapf(err, "content %v is invalid", ci.GetContentID())
+		}
+
+		mu.Lock()
+		result.VerifiedContents++
+		if err != nil {
+			result.ErrorCount++
+		}
+
+		if repaired {
+			result.RepairedContents++
+		}
+		mu.Unlock()
+
+		if opt.OnContentVerified != nil {
+			opt.OnContentVerified(ci, err)
+		}
+	}
+
+	if err := r.IterateContents(ctx, IterateOptions{
+		Range:          opt.Range,
+		IncludeDeleted: opt.IncludeDeleted,
+		Parallel:       opt.Parallel,
+	}, func(ci Info) error {
+		if opt.BlobMap != nil {
+			if err := verifyContentPackBounds(ci, opt.BlobMap); err != nil {
+				mu.Lock()
+				result.InvalidPackErrorCount++
+				mu.Unlock()
+
+				if opt.OnContentVerified != nil {
+					opt.OnContentVerified(ci, err)
+				}
+			}
+		}
+
+		mu.Lock()
+		result.TotalContents++
+		mu.Unlock()
+
+		if sampleAll || 100*sampleScore(opt.Seed, ci.GetContentID().String()) < opt.SamplePercent { //nolint:gomnd
+			verify(ci)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "error iterating contents")
+	}
+
+	if iv, ok := r.(indexBlobVerifier); ok {
+		if err := iv.verifyIndexBlobs(ctx, func(blobID blob.ID, err error) {
+			result.VerifiedIndexBlobs++
+			if err != nil {
+				result.IndexBlobErrorCount++
+			}
+
+			if opt.OnIndexBlobVerified != nil {
+				opt.OnIndexBlobVerified(blobID, err)
+			}
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	result.EstimatedErrorRate, result.ErrorRateUpperBound = estimateErrorRate(result.ErrorCount, result.VerifiedContents, result.TotalContents)
+
+	return &result, nil
+}
+
+// verifyIndexBlobs fetches each active index blob bypassing the cache and verifies that it can be decrypted and parsed.
+func (sm *SharedManager) verifyIndexBlobs(ctx context.Context, onVerified func(blobID blob.ID, err error)) error {
+	indexBlobs, err := sm.IndexBlobs(ctx, false)
+	if err != nil {
+		return errors.Wrap(err, "error listing index blobs")
+	}
+
+	var payload gather.WriteBuffer
+	defer payload.Close()
+
+	for _, ib := range indexBlobs {
+		payload.Reset()
+
+		err := sm.st.GetBlob(ctx, ib.BlobID, 0, -1, &payload)
+		if err == nil {
+			_, err = ParseIndexBlob(ctx, ib.BlobID, payload.Bytes(), sm.enc.crypter)
+		}
+
+		onVerified(ib.BlobID, errors.Wrapf(err, "index blob %v is invalid", ib.BlobID))
+	}
+
+	return nil
+}
+
+// verifyAndRepairContent verifies the primary copy of the provided content bypassing the cache and if it's
+// corrupted, replaces its pack blob with the first alternate copy in which all contents of the pack are valid.
+func (sm *SharedManager) verifyAndRepairContent(ctx context.Context, ci Info) (repaired bool, err error) {
+	var payload, output gather.WriteBuffer
+	defer payload.Close()
+	defer output.Close()
+
+	primaryErr := sm.st.GetBlob(ctx, ci.GetPackBlobID(), int64(ci.GetPackOffset()), int64(ci.GetPackedLength()), &payload)
+	if primaryErr == nil {
+		primaryErr = sm.decryptContentAndVerify(payload.Bytes(), ci, &output)
+	}
+
+	if primaryErr == nil {
+		primaryErr = sm.verifyContentHash(ci, &output)
+	}
+
+	if primaryErr == nil {
+		return false, nil
+	}
+
+	packContents, err := sm.contentsInPack(ci.GetPackBlobID())
+	if err != nil {
+		return false, err
+	}
+
+	for _, src := range blob.GetAlternateSources(sm.st) {
+		payload.Reset()
+
+		if err := src.GetBlob(ctx, ci.GetPackBlobID(), 0, -1, &payload); err != nil {
+			sm.log.Debugf("unable to fetch %v from %v: %v", ci.GetPackBlobID(), src.DisplayName(), err)
+			continue
+		}
+
+		// the alternate copy replaces the entire pack, so it must be valid for all contents in it, not just this one.
+		if err := sm.verifyAlternatePackCopy(&payload, packContents); err != nil {
+			sm.log.Debugf("alternate copy of %v from %v is also invalid: %v", ci.GetPackBlobID(), src.DisplayName(), err)
+			continue
+		}
+
+		if err := sm.st.PutBlob(ctx, ci.GetPackBlobID(), payload.Bytes(), blob.PutOptions{}); err != nil {
+			return false, errors.Wrapf(err, "error repairing pack blob %v", ci.GetPackBlobID())
+		}
+
+		// cached copies of contents in the pack may be corrupted too, make sure subsequent reads don't return them.
+		for _, bi := range packContents {
+			sm.getCacheForContentID(bi.GetContentID()).Evict(ctx, contentCacheKeyForInfo(bi), bi.GetPackBlobID())
+		}
+
+		sm.log.Infof("repaired pack blob %v containing content %v using copy from %v, primary copy failed verification: %v", ci.GetPackBlobID(), ci.GetContentID(), src.DisplayName(), primaryErr)
+
+		return true, nil
+	}
+
+	return false, primaryErr
+}
+
+// contentsInPack returns all committed contents stored in the provided pack blob.
+func (sm *SharedManager) contentsInPack(packBlobID blob.ID) ([]Info, error) {
+	var result []Info
+
+	if err := sm.committedContents.listContents(index.AllIDs, func(i Info) error {
+		if i.GetPackBlobID() == packBlobID {
+			result = append(result, i)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "error listing contents of %v", packBlobID)
+	}
+
+	return result, nil
+}
+
+// verifyAlternatePackCopy verifies that all provided contents can be decrypted from the provided copy of
+// their pack blob and that their hashes match their content IDs.
+func (sm *SharedManager) verifyAlternatePackCopy(packData *gather.WriteBuffer, contents []Info) error {
+	var payload, output gather.WriteBuffer
+	defer payload.Close()
+	defer output.Close()
+
+	for _, bi := range contents {
+		payload.Reset()
+		output.Reset()
+
+		if int64(bi.GetPackOffset())+int64(bi.GetPackedLength()) > int64(packData.Length()) {
+			return errors.Errorf("content %v is out of bounds of the pack", bi.GetContentID())
+		}
+
+		if err := packData.AppendSectionTo(&payload, int(bi.GetPackOffset()), int(bi.GetPackedLength())); err != nil {
+			return errors.Wrapf(err, "error reading content %v", bi.GetContentID())
+		}
+
+		if err := sm.decryptContentAndVerify(payload.Bytes(), bi, &output); err != nil {
+			return errors.Wrapf(err, "content %v is invalid", bi.GetContentID())
+		}
+
+		if err := sm.verifyContentHash(bi, &output); err != nil {
+			return errors.Wrapf(err, "content %v is invalid", bi.GetContentID())
+		}
+	}
+
+	return nil
+}
+
+func verifyContentPackBounds(ci Info, blobMap map[blob.ID]blob.Metadata) error {
+	bi, ok := blobMap[ci.GetPackBlobID()]
+	if !ok {
+		return errors.Errorf("content %v depends on missing blob %v", ci.GetContentID(), ci.GetPackBlobID())
+	}
+
+	if int64(ci.GetPackOffset()+ci.GetPackedLength()) > bi.Length {
+		return errors.Errorf("content %v out of bounds of its pack blob %v", ci.GetContentID(), ci.GetPackBlobID())
+	}
+
+	return nil
+}
+
+// estimateErrorRate returns the observed error rate among n verified out of total items and
+// the Wilson score upper bound of the error rate across all items.
+func estimateErrorRate(errorCount, n, total int) (rate, upperBound float64) {
+	if n == 0 {
+		if total == 0 {
+			return 0, 0
+		}
+
+		return 0, 1
+	}
+
+	rate = float64(errorCount) / float64(n)
+
+	if n >= total {
+		return rate, rate
+	}
+
+	z2 := verifyConfidenceZ * verifyConfidenceZ
+	nf := float64(n)
+
+	center := (rate + z2/(2*nf)) / (1 + z2/nf)                                           //nolint:gomnd
+	margin := verifyConfidenceZ * math.Sqrt(rate*(1-rate)/nf+z2/(4*nf*nf)) / (1 + z2/nf) //nolint:gomnd
+
+	return rate, math.Min(1, center+margin)
+}
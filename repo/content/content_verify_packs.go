@@ -0,0 +1,186 @@
+package content
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// VerifyPacksOptions provides options for VerifyPacks.
+type VerifyPacksOptions struct {
+	IncludeDeleted bool
+	Parallel       int
+
+	// SamplePercent is the percentage of pack blobs (0..100) to download and verify, values <= 0 or >= 100
+	// cause all pack blobs to be verified. Each pack blob is sampled independently with the same probability.
+	SamplePercent float64
+
+	// Seed determines the selection of sampled pack blobs, the same seed always selects the same pack blobs.
+	Seed int64
+
+	// OnContentVerified is invoked after each content has been verified with the verification error, if any.
+	OnContentVerified func(ci Info, err error)
+
+	// OnPackVerified is invoked after each pack blob has been verified with the error that prevented
+	// verification of its contents, if any.
+	OnPackVerified func(packBlobID blob.ID, err error)
+}
+
+// VerifyPacksResult describes the result of VerifyPacks.
+type VerifyPacksResult struct {
+	TotalPacks     int `json:"totalPacks"`
+	VerifiedPacks  int `json:"verifiedPacks"`
+	PackErrorCount int `json:"packErrorCount"`
+
+	VerifiedContents int `json:"verifiedContents"`
+	ErrorCount       int `json:"errorCount"`
+}
+
+// packsVerifier is implemented by content managers that can verify entire pack blobs.
+type packsVerifier interface {
+	verifyPacks(ctx context.Context, opt VerifyPacksOptions) (*VerifyPacksResult, error)
+}
+
+// VerifyPacks downloads pack blobs one at a time in their entirety and verifies all their contents that are
+// referenced by the index, which takes a single storage request per pack blob instead of one per content.
+// Contents of each pack blob are found using the index stored in the pack blob itself, so index entries
+// pointing at contents missing from their pack blob are not detected, VerifyContents can be used for that.
+func VerifyPacks(ctx context.Context, r Reader, opt VerifyPacksOptions) (*VerifyPacksResult, error) {
+	pv, ok := r.(packsVerifier)
+	if !ok {
+		return nil, errors.New("content reader does not support verifying packs")
+	}
+
+	return pv.verifyPacks(ctx, opt)
+}
+
+func (sm *SharedManager) verifyPacks(ctx context.Context, opt VerifyPacksOptions) (*VerifyPacksResult, error) {
+	var (
+		mu     sync.Mutex
+		result VerifyPacksResult
+	)
+
+	sampleAll := opt.SamplePercent <= 0 || opt.SamplePercent >= 100 //nolint:gomnd
+
+	parallel := opt.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	onContentVerified := func(ci Info, err error) {
+		mu.Lock()
+		result.VerifiedContents++
+		if err != nil {
+			result.ErrorCount++
+		}
+		mu.Unlock()
+
+		if opt.OnContentVerified != nil {
+			opt.OnContentVerified(ci, err)
+		}
+	}
+
+	work := make(chan blob.ID)
+
+	eg, ctx := errgroup.WithContext(ctx)
+
+	for i := 0; i < parallel; i++ {
+		eg.Go(func() error {
+			for packBlobID := range work {
+				err := sm.verifyPackBlob(ctx, packBlobID, opt.IncludeDeleted, onContentVerified)
+
+				mu.Lock()
+				result.VerifiedPacks++
+				if err != nil {
+					result.PackErrorCount++
+				}
+				mu.Unlock()
+
+				if opt.OnPackVerified != nil {
+					opt.OnPackVerified(packBlobID, err)
+				}
+			}
+
+			return nil
+		})
+	}
+
+	eg.Go(func() error {
+		defer close(work)
+
+		for _, prefix := range PackBlobIDPrefixes {
+			if err := sm.st.ListBlobs(ctx, prefix, func(bm blob.Metadata) error {
+				mu.Lock()
+				result.TotalPacks++
+				mu.Unlock()
+
+				if !sampleAll && 100*sampleScore(opt.Seed, string(bm.BlobID)) >= opt.SamplePercent { //nolint:gomnd
+					return nil
+				}
+
+				select {
+				case work <- bm.BlobID:
+					return nil
+
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}); err != nil {
+				return errors.Wrapf(err, "error listing %v blobs", prefix)
+			}
+		}
+
+		return nil
+	})
+
+	if err := eg.Wait(); err != nil {
+		return nil, errors.Wrap(err, "error verifying packs")
+	}
+
+	return &result, nil
+}
+
+// verifyPackBlob downloads the provided pack blob and verifies each content in it that is referenced by the index,
+// invoking the provided callback for each of them. Returns an error if the pack blob can't be fetched or its own
+// index can't be read.
+func (sm *SharedManager) verifyPackBlob(ctx context.Context, packBlobID blob.ID, includeDeleted bool, onContentVerified func(ci Info, err error)) error {
+	var packData, localIndexBytes, contentData gather.WriteBuffer
+	defer packData.Close()
+	defer localIndexBytes.Close()
+	defer contentData.Close()
+
+	if err := sm.st.GetBlob(ctx, packBlobID, 0, -1, &packData); err != nil {
+		return errors.Wrapf(err, "error getting pack blob %v", packBlobID)
+	}
+
+	if err := sm.decryptPackFileLocalIndex(packBlobID, &packData, 0, &localIndexBytes); err != nil {
+		return errors.Wrapf(err, "unable to read index of pack blob %v", packBlobID)
+	}
+
+	packContents, err := sm.parseRecoveredLocalIndex(packBlobID, &localIndexBytes)
+	if err != nil {
+		return err
+	}
+
+	for _, pi := range packContents {
+		// verify contents as described by the index, skipping those that have since been superseded by
+		// a copy in another pack blob.
+		ci, err := sm.committedContents.getContent(pi.GetContentID())
+		if err != nil || ci.GetPackBlobID() != packBlobID {
+			continue
+		}
+
+		if ci.GetDeleted() && !includeDeleted {
+			continue
+		}
+
+		onContentVerified(ci, errors.Wrapf(sm.verifyPackedContent(&packData, ci, &contentData), "content %v is invalid", ci.GetContentID()))
+	}
+
+	return nil
+}
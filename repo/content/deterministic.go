@@ -0,0 +1,115 @@
+package content
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content/index"
+	"github.com/kopia/kopia/repo/encryption"
+	"github.com/kopia/kopia/repo/format"
+)
+
+// deterministicFormat wraps format.Provider so that all encryption performed by the
+// content manager produces the same output for the same input.
+type deterministicFormat struct {
+	format.Provider
+
+	enc encryption.Encryptor
+}
+
+func (f *deterministicFormat) Encryptor() encryption.Encryptor {
+	return f.enc
+}
+
+func newDeterministicFormat(prov format.Provider) (*deterministicFormat, error) {
+	enc, err := encryption.Deterministic(prov.Encryptor())
+	if err != nil {
+		return nil, errors.Wrap(err, "deterministic mode is not supported by the repository format")
+	}
+
+	return &deterministicFormat{prov, enc}, nil
+}
+
+// deterministicSessionID returns session ID derived from the set of active index blobs,
+// which is the same for identical repositories and changes each time an index is committed.
+func (sm *SharedManager) deterministicSessionID(ctx context.Context) (SessionID, error) {
+	ibl, err := sm.IndexBlobs(ctx, false)
+	if err != nil {
+		return "", errors.Wrap(err, "error listing index blobs")
+	}
+
+	var ids []string
+
+	for _, ib := range ibl {
+		ids = append(ids, string(ib.BlobID))
+	}
+
+	sort.Strings(ids)
+
+	h := sha256.New()
+
+	for _, id := range ids {
+		fmt.Fprintf(h, "%v\n", id)
+	}
+
+	return SessionID(fmt.Sprintf("%v%016x%x", BlobIDPrefixSession, h.Sum(nil)[0:sessionIDLength], 0)), nil
+}
+
+// assignDeterministicPackBlobIDLocked replaces the random portion of the name of the pending pack
+// that's about to be written with the hash of its data, so that packs written in deterministic mode
+// have names that are reproducible but don't collide between concurrent writers.
+//
+// +checklocks:bm.mu
+func (bm *WriteManager) assignDeterministicPackBlobIDLocked(pp *pendingPackInfo) error {
+	if !bm.deterministic || pp.finalized {
+		return nil
+	}
+
+	// pack names are of the form <prefix><random>-<sessionID>
+	sessionSuffix := ""
+	if p := strings.Index(string(pp.packBlobID), "-"); p >= 0 {
+		sessionSuffix = string(pp.packBlobID[p:])
+	}
+
+	h := sha256.New()
+	if _, err := pp.currentPackData.Bytes().WriteTo(h); err != nil {
+		return errors.Wrap(err, "unable to hash pack data")
+	}
+
+	newPackBlobID := blob.ID(fmt.Sprintf("%v%x%v", pp.prefix, h.Sum(nil)[0:packBlobIDLength], sessionSuffix))
+
+	for k, info := range pp.currentPackItems {
+		if info.GetPackBlobID() != pp.packBlobID {
+			continue
+		}
+
+		renamed := *index.ToInfoStruct(info)
+		renamed.PackBlobID = newPackBlobID
+		pp.currentPackItems[k] = &renamed
+	}
+
+	pp.packBlobID = newPackBlobID
+
+	return nil
+}
+
+// appendPadding appends the given number of padding bytes to the buffer, which are random
+// unless the manager is deterministic.
+func (sm *SharedManager) appendPadding(b *gather.WriteBuffer, count int) error {
+	if sm.deterministic {
+		var zeros [defaultPaddingUnit]byte
+
+		b.Append(zeros[0:count])
+
+		return nil
+	}
+
+	return writeRandomBytesToBuffer(b, count)
+}
@@ -29,7 +29,13 @@ func (m *encryptedBlobMgr) getEncryptedBlob(ctx context.Context, blobID blob.ID,
 		return errors.Wrap(err, "getContent")
 	}
 
-	return DecryptBLOB(m.crypter, payload.Bytes(), blobID, output)
+	// index blobs are encrypted using authenticated encryption keyed by the repository secret,
+	// so failure to decrypt means the blob has been corrupted or tampered with.
+	if err := DecryptBLOB(m.crypter, payload.Bytes(), blobID, output); err != nil {
+		return corruptIndexError{errors.Wrapf(err, "index blob %v failed integrity check, it may be corrupted", blobID)}
+	}
+
+	return nil
 }
 
 func (m *encryptedBlobMgr) encryptAndWriteBlob(ctx context.Context, data gather.Bytes, prefix blob.ID, sessionID SessionID) (blob.Metadata, error) {
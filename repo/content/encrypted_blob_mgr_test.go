@@ -63,7 +63,7 @@ func TestEncryptedBlobManager(t *testing.T) {
 	// data corruption
 	data[bm.BlobID][0] ^= 1
 
-	require.Error(t, ebm.getEncryptedBlob(ctx, bm.BlobID, &tmp))
+	require.ErrorIs(t, ebm.getEncryptedBlob(ctx, bm.BlobID, &tmp), ErrCorruptIndex)
 
 	require.ErrorIs(t, ebm.getEncryptedBlob(ctx, "no-such-blob", &tmp), blob.ErrBlobNotFound)
 
@@ -13,7 +13,11 @@
 	"github.com/kopia/kopia/internal/gather"
 )
 
-const randomSuffixSize = 32 // number of random bytes to append at the end to make the index blob unique
+const (
+	randomSuffixSize = 32 // number of random bytes to append at the end to make the index blob unique
+
+	approxKeyLength = 33 // typical length of content ID in the index (prefix + 256-bit hash)
+)
 
 // Builder prepares and writes content index.
 type Builder map[ID]Info
@@ -135,12 +139,34 @@ func (b Builder) Build(output io.Writer, version int) error {
 
 // BuildStable writes the pack index to the provided output.
 func (b Builder) BuildStable(output io.Writer, version int) error {
+	return writeIndex(output, version, sortedSlice(b.sortedContents()))
+}
+
+// sortedInfos invokes the provided callback for all entries in the order of content IDs.
+// Index writers invoke it twice, first to compute the layout of the index and then to write the entries,
+// so the entries don't need to be held in memory.
+type sortedInfos func(cb func(i Info) error) error
+
+func sortedSlice(infos []Info) sortedInfos {
+	return func(cb func(i Info) error) error {
+		for _, i := range infos {
+			if err := cb(i); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// writeIndex writes the pack index with the provided unique sorted entries to the output.
+func writeIndex(output io.Writer, version int, entries sortedInfos) error {
 	switch version {
 	case Version1:
-		return b.buildV1(output)
+		return writeIndexV1(output, entries)
 
 	case Version2:
-		return b.buildV2(output)
+		return writeIndexV2(output, entries)
 
 	default:
 		return errors.Errorf("unsupported index version: %v", version)
@@ -163,12 +189,7 @@ func (b Builder) shard(maxShardSize int) []Builder {
 	}
 
 	for k, v := range b {
-		h := fnv.New32a()
-		io.WriteString(h, k.String()) //nolint:errcheck
-
-		shard := h.Sum32() % uint32(numShards)
-
-		result[shard][k] = v
+		result[shardIndex(k, numShards)][k] = v
 	}
 
 	var nonEmpty []Builder
@@ -182,6 +203,29 @@ func (b Builder) shard(maxShardSize int) []Builder {
 	return nonEmpty
 }
 
+// shardIndex returns the index of the shard the given content ID belongs to.
+func shardIndex(contentID ID, numShards int) int {
+	h := fnv.New32a()
+	io.WriteString(h, contentID.String()) //nolint:errcheck
+
+	return int(h.Sum32() % uint32(numShards))
+}
+
+// ShardSizeForBlockSize returns the number of entries per shard that results in index blobs
+// of approximately the provided size in bytes.
+func ShardSizeForBlockSize(indexVersion, blockSize int) int {
+	entrySize := approxKeyLength + v1EntryLength
+	if indexVersion == Version2 {
+		entrySize = approxKeyLength + v2EntryMaxLength
+	}
+
+	if n := blockSize / entrySize; n > 0 {
+		return n
+	}
+
+	return 1
+}
+
 // BuildShards builds the set of index shards ensuring no more than the provided number of contents are in each index.
 // Returns shard bytes and function to clean up after the shards have been written.
 func (b Builder) BuildShards(indexVersion int, stable bool, shardSize int) ([]gather.Bytes, func(), error) {
@@ -193,7 +237,6 @@ func (b Builder) BuildShards(indexVersion int, stable bool, shardSize int) ([]ga
 		shardedBuilders = b.shard(shardSize)
 		dataShardsBuf   []*gather.WriteBuffer
 		dataShards      []gather.Bytes
-		randomSuffix    [32]byte
 	)
 
 	closeShards := func() {
@@ -207,28 +250,41 @@ func (b Builder) BuildShards(indexVersion int, stable bool, shardSize int) ([]ga
 
 		dataShardsBuf = append(dataShardsBuf, buf)
 
-		if err := s.BuildStable(buf, indexVersion); err != nil {
+		if err := s.buildShard(buf, indexVersion, stable); err != nil {
 			closeShards()
 
-			return nil, nil, errors.Wrap(err, "error building index shard")
+			return nil, nil, err
 		}
 
-		if !stable {
-			if _, err := rand.Read(randomSuffix[:]); err != nil {
-				closeShards()
+		dataShards = append(dataShards, buf.Bytes())
+	}
 
-				return nil, nil, errors.Wrap(err, "error getting random bytes for suffix")
-			}
+	return dataShards, closeShards, nil
+}
 
-			if _, err := buf.Write(randomSuffix[:]); err != nil {
-				closeShards()
+func (b Builder) buildShard(output io.Writer, indexVersion int, stable bool) error {
+	return writeShard(output, indexVersion, stable, sortedSlice(b.sortedContents()))
+}
 
-				return nil, nil, errors.Wrap(err, "error writing extra random suffix to ensure indexes are always globally unique")
-			}
-		}
+// writeShard writes a single index shard, followed by a random suffix unless stable output was requested.
+func writeShard(output io.Writer, indexVersion int, stable bool, entries sortedInfos) error {
+	if err := writeIndex(output, indexVersion, entries); err != nil {
+		return errors.Wrap(err, "error building index shard")
+	}
 
-		dataShards = append(dataShards, buf.Bytes())
+	if stable {
+		return nil
 	}
 
-	return dataShards, closeShards, nil
+	var randomSuffix [randomSuffixSize]byte
+
+	if _, err := rand.Read(randomSuffix[:]); err != nil {
+		return errors.Wrap(err, "error getting random bytes for suffix")
+	}
+
+	if _, err := output.Write(randomSuffix[:]); err != nil {
+		return errors.Wrap(err, "error writing extra random suffix to ensure indexes are always globally unique")
+	}
+
+	return nil
 }
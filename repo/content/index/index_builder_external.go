@@ -0,0 +1,442 @@
+package index
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+)
+
+// ExternalBuilder accumulates index entries like Builder, but holds at most a fixed number of entries
+// in memory. When the limit is reached, entries are sorted and spilled to a temporary file, and all
+// spilled runs are merged when the index is built.
+type ExternalBuilder struct {
+	tempDir            string
+	maxEntriesInMemory int
+
+	current Builder
+	runs    []string
+
+	runReads int // number of times a temporary run was opened for reading, for testing
+}
+
+// NewExternalBuilder returns new ExternalBuilder that spills to temporary files in the provided
+// directory (or the default temporary directory if empty) whenever more than maxEntriesInMemory
+// entries are buffered.
+func NewExternalBuilder(tempDir string, maxEntriesInMemory int) *ExternalBuilder {
+	if maxEntriesInMemory <= 0 {
+		maxEntriesInMemory = 1
+	}
+
+	return &ExternalBuilder{
+		tempDir:            tempDir,
+		maxEntriesInMemory: maxEntriesInMemory,
+		current:            Builder{},
+	}
+}
+
+// Add adds a new entry to the builder, conflicting entries are resolved in the same way as Builder.Add().
+func (b *ExternalBuilder) Add(i Info) error {
+	b.current.Add(i)
+
+	if len(b.current) >= b.maxEntriesInMemory {
+		return b.spill()
+	}
+
+	return nil
+}
+
+// SpilledRuns returns the number of sorted runs that have been written to temporary files.
+func (b *ExternalBuilder) SpilledRuns() int {
+	return len(b.runs)
+}
+
+func (b *ExternalBuilder) spill() error {
+	w, err := b.newRunWriter()
+	if err != nil {
+		return err
+	}
+
+	b.runs = append(b.runs, w.name())
+
+	for _, i := range b.current.sortedContents() {
+		if err := w.write(i); err != nil {
+			w.close() //nolint:errcheck
+
+			return err
+		}
+	}
+
+	if err := w.close(); err != nil {
+		return err
+	}
+
+	b.current = Builder{}
+
+	return nil
+}
+
+// Close removes any temporary files.
+func (b *ExternalBuilder) Close() error {
+	var lastErr error
+
+	for _, r := range b.runs {
+		if err := os.Remove(r); err != nil {
+			lastErr = errors.Wrap(err, "unable to remove index run")
+		}
+	}
+
+	b.runs = nil
+	b.current = Builder{}
+
+	return lastErr
+}
+
+// Iterate invokes the provided callback for all unique entries in the order of content IDs.
+func (b *ExternalBuilder) Iterate(cb func(i Info) error) error {
+	var h mergeHeap
+
+	defer func() {
+		for _, c := range h {
+			c.close()
+		}
+	}()
+
+	inMemory := b.current.sortedContents()
+
+	push := func(c *runCursor) error {
+		ok, err := c.next()
+		if err != nil {
+			c.close()
+			return err
+		}
+
+		if ok {
+			heap.Push(&h, c)
+		} else {
+			c.close()
+		}
+
+		return nil
+	}
+
+	if err := push(&runCursor{pending: inMemory}); err != nil {
+		return err
+	}
+
+	for _, r := range b.runs {
+		f, err := os.Open(r) //nolint:gosec
+		if err != nil {
+			return errors.Wrap(err, "unable to open index run")
+		}
+
+		b.runReads++
+
+		if err := push(&runCursor{f: f, dec: json.NewDecoder(bufio.NewReader(f))}); err != nil {
+			return err
+		}
+	}
+
+	for len(h) > 0 {
+		c, _ := heap.Pop(&h).(*runCursor)
+		best := c.current
+
+		if err := push(c); err != nil {
+			return err
+		}
+
+		// resolve duplicates from other runs.
+		for len(h) > 0 && h[0].current.GetContentID() == best.GetContentID() {
+			c, _ := heap.Pop(&h).(*runCursor)
+			if contentInfoGreaterThan(c.current, best) {
+				best = c.current
+			}
+
+			if err := push(c); err != nil {
+				return err
+			}
+		}
+
+		if err := cb(best); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BuildShards builds the set of index shards for entries accepted by the provided filter.
+// The output is identical to Builder.BuildShards() invoked on the same set of entries.
+//
+// Spilled runs are read once and merged into a single temporary run, which is then partitioned
+// into per-shard runs, so the total amount of I/O does not depend on the number of shards.
+// Each shard is written directly from its sorted run, which is read twice, so apart from the
+// built shards themselves only the unique pack blob IDs and formats of a shard are held in memory.
+func (b *ExternalBuilder) BuildShards(indexVersion int, stable bool, shardSize int, include func(i Info) bool) ([]gather.Bytes, func(), error) {
+	if shardSize == 0 {
+		return nil, nil, errors.Errorf("invalid shard size")
+	}
+
+	merged, err := b.newRunWriter()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer os.Remove(merged.name()) //nolint:errcheck
+
+	if err := b.Iterate(func(i Info) error {
+		if !include(i) {
+			return nil
+		}
+
+		return merged.write(i)
+	}); err != nil {
+		merged.close() //nolint:errcheck
+
+		return nil, nil, errors.Wrap(err, "error merging index entries")
+	}
+
+	if err := merged.close(); err != nil {
+		return nil, nil, err
+	}
+
+	var shardRuns []*runWriter
+
+	switch numShards := (merged.count + shardSize - 1) / shardSize; {
+	case numShards == 1:
+		shardRuns = []*runWriter{merged}
+
+	case numShards > 1:
+		shardRuns, err = b.partitionRun(merged.name(), numShards)
+
+		defer func() {
+			for _, r := range shardRuns {
+				os.Remove(r.name()) //nolint:errcheck
+			}
+		}()
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var (
+		dataShardsBuf []*gather.WriteBuffer
+		dataShards    []gather.Bytes
+	)
+
+	closeShards := func() {
+		for _, ds := range dataShardsBuf {
+			ds.Close()
+		}
+	}
+
+	for _, r := range shardRuns {
+		if r.count == 0 {
+			continue
+		}
+
+		buf := gather.NewWriteBuffer()
+
+		dataShardsBuf = append(dataShardsBuf, buf)
+
+		run := r.name()
+
+		if err := writeShard(buf, indexVersion, stable, func(cb func(i Info) error) error {
+			return b.readRun(run, cb)
+		}); err != nil {
+			closeShards()
+
+			return nil, nil, err
+		}
+
+		dataShards = append(dataShards, buf.Bytes())
+	}
+
+	return dataShards, closeShards, nil
+}
+
+// partitionRun splits the provided run into the given number of runs in the order of shards,
+// using the same assignment of contents to shards as Builder.BuildShards().
+func (b *ExternalBuilder) partitionRun(run string, numShards int) ([]*runWriter, error) {
+	writers := make([]*runWriter, numShards)
+
+	var result []*runWriter
+
+	closeAll := func() error {
+		var lastErr error
+
+		for _, w := range writers {
+			if w != nil {
+				if err := w.close(); err != nil {
+					lastErr = err
+				}
+			}
+		}
+
+		return lastErr
+	}
+
+	for i := range writers {
+		w, err := b.newRunWriter()
+		if err != nil {
+			closeAll() //nolint:errcheck
+
+			return result, err
+		}
+
+		writers[i] = w
+		result = append(result, w)
+	}
+
+	if err := b.readRun(run, func(i Info) error {
+		return writers[shardIndex(i.GetContentID(), numShards)].write(i)
+	}); err != nil {
+		closeAll() //nolint:errcheck
+
+		return result, err
+	}
+
+	return result, closeAll()
+}
+
+// readRun invokes the callback for all entries of the provided run.
+func (b *ExternalBuilder) readRun(run string, cb func(i Info) error) error {
+	f, err := os.Open(run) //nolint:gosec
+	if err != nil {
+		return errors.Wrap(err, "unable to open index run")
+	}
+
+	defer f.Close() //nolint:errcheck
+
+	b.runReads++
+
+	c := &runCursor{f: f, dec: json.NewDecoder(bufio.NewReader(f))}
+
+	for {
+		ok, err := c.next()
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return nil
+		}
+
+		if err := cb(c.current); err != nil {
+			return err
+		}
+	}
+}
+
+// runWriter writes entries to a new temporary run.
+type runWriter struct {
+	f     *os.File
+	bw    *bufio.Writer
+	enc   *json.Encoder
+	count int
+}
+
+func (b *ExternalBuilder) newRunWriter() (*runWriter, error) {
+	f, err := os.CreateTemp(b.tempDir, "kopia-index-run-*")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create temporary file")
+	}
+
+	bw := bufio.NewWriter(f)
+
+	return &runWriter{f: f, bw: bw, enc: json.NewEncoder(bw)}, nil
+}
+
+func (w *runWriter) name() string {
+	return w.f.Name()
+}
+
+func (w *runWriter) write(i Info) error {
+	w.count++
+
+	return errors.Wrap(w.enc.Encode(ToInfoStruct(i)), "error writing index entry")
+}
+
+func (w *runWriter) close() error {
+	if err := w.bw.Flush(); err != nil {
+		w.f.Close() //nolint:errcheck
+
+		return errors.Wrap(err, "error flushing index run")
+	}
+
+	return errors.Wrap(w.f.Close(), "error closing index run")
+}
+
+// runCursor reads sorted entries from either a spilled run or from memory.
+type runCursor struct {
+	f       *os.File
+	dec     *json.Decoder
+	pending []Info
+
+	current Info
+}
+
+func (c *runCursor) next() (bool, error) {
+	if c.dec == nil {
+		if len(c.pending) == 0 {
+			return false, nil
+		}
+
+		c.current = c.pending[0]
+		c.pending = c.pending[1:]
+
+		return true, nil
+	}
+
+	var is InfoStruct
+
+	if err := c.dec.Decode(&is); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+
+		return false, errors.Wrap(err, "error reading index run")
+	}
+
+	c.current = &is
+
+	return true, nil
+}
+
+func (c *runCursor) close() {
+	if c.f != nil {
+		c.f.Close() //nolint:errcheck
+		c.f = nil
+	}
+}
+
+// mergeHeap is a min-heap of cursors ordered by the content ID of their current entry.
+type mergeHeap []*runCursor
+
+func (h mergeHeap) Len() int { return len(h) }
+
+func (h mergeHeap) Less(i, j int) bool {
+	return h[i].current.GetContentID().less(h[j].current.GetContentID())
+}
+
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *mergeHeap) Push(x interface{}) {
+	c, _ := x.(*runCursor)
+	*h = append(*h, c)
+}
+
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	c := old[n-1]
+	*h = old[:n-1]
+
+	return c
+}
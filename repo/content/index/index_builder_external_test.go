@@ -0,0 +1,137 @@
+package index
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+func TestExternalBuilder_MatchesInMemoryBuilder(t *testing.T) {
+	for _, version := range []int{Version1, Version2} {
+		version := version
+
+		t.Run(fmt.Sprintf("v%v", version), func(t *testing.T) {
+			testExternalBuilderMatchesInMemoryBuilder(t, version)
+		})
+	}
+}
+
+func testExternalBuilderMatchesInMemoryBuilder(t *testing.T, version int) {
+	t.Helper()
+
+	const (
+		numContents = 3000
+		numVersions = 3
+	)
+
+	var entries []*InfoStruct
+
+	// generate multiple conflicting entries for each content.
+	for id := 0; id < numContents; id++ {
+		for v := 0; v < numVersions; v++ {
+			entries = append(entries, &InfoStruct{
+				ContentID:        deterministicContentID(t, "", id),
+				PackBlobID:       deterministicPackBlobID(id*numVersions + v),
+				TimestampSeconds: int64(1000 + rand.Intn(3)),
+				OriginalLength:   deterministicOriginalLength(id, version),
+				PackedLength:     deterministicPackedLength(id),
+				PackOffset:       deterministicPackedOffset(id),
+				Deleted:          rand.Intn(2) == 0,
+				FormatVersion:    deterministicFormatVersion(id),
+			})
+		}
+	}
+
+	rand.Shuffle(len(entries), func(i, j int) {
+		entries[i], entries[j] = entries[j], entries[i]
+	})
+
+	tempDir := testutil.TempDirectory(t)
+
+	inMemory := Builder{}
+	external := NewExternalBuilder(tempDir, 100)
+
+	for _, e := range entries {
+		inMemory.Add(e)
+		require.NoError(t, external.Add(e))
+	}
+
+	require.Greater(t, external.SpilledRuns(), 10)
+
+	// drop some of the contents the same way in both paths.
+	include := func(i Info) bool {
+		return !(i.GetDeleted() && i.GetPackBlobID() < blob.ID("8"))
+	}
+
+	for _, v := range inMemory {
+		if !include(v) {
+			delete(inMemory, v.GetContentID())
+		}
+	}
+
+	for _, shardSize := range []int{100000, 700} {
+		want, wantCleanup, err := inMemory.BuildShards(version, true, shardSize)
+		require.NoError(t, err)
+
+		runReadsBefore := external.runReads
+
+		got, gotCleanup, err := external.BuildShards(version, true, shardSize, include)
+		require.NoError(t, err)
+
+		require.Equal(t, len(want), len(got), "shard size %v", shardSize)
+
+		// each spilled run is read once, followed by the merged run. Shards are written directly from their runs,
+		// which are read twice - once to compute the layout of the index and once to write the entries.
+		if extraReads := external.runReads - runReadsBefore - external.SpilledRuns(); len(got) > 1 {
+			require.Equal(t, 1+2*len(got), extraReads)
+		} else {
+			require.Equal(t, 2, extraReads)
+		}
+
+		for i := range want {
+			require.Equal(t, want[i].ToByteSlice(), got[i].ToByteSlice(), "shard %v of size %v", i, shardSize)
+		}
+
+		wantCleanup()
+		gotCleanup()
+	}
+
+	require.NoError(t, external.Close())
+
+	remaining, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	require.Empty(t, remaining)
+}
+
+func TestExternalBuilder_IterateSorted(t *testing.T) {
+	external := NewExternalBuilder(testutil.TempDirectory(t), 7)
+	defer external.Close()
+
+	for id := 100; id > 0; id-- {
+		require.NoError(t, external.Add(&InfoStruct{ContentID: deterministicContentID(t, "", id)}))
+	}
+
+	var prev *ID
+
+	count := 0
+
+	require.NoError(t, external.Iterate(func(i Info) error {
+		cid := i.GetContentID()
+		if prev != nil {
+			require.True(t, prev.less(cid), "%v is not less than %v", prev, cid)
+		}
+
+		prev = &cid
+		count++
+
+		return nil
+	}))
+
+	require.Equal(t, 100, count)
+}
@@ -283,18 +283,24 @@ type indexBuilderV1 struct {
 
 // buildV1 writes the pack index to the provided output.
 func (b Builder) buildV1(output io.Writer) error {
-	allContents := b.sortedContents()
+	return writeIndexV1(output, sortedSlice(b.sortedContents()))
+}
+
+// writeIndexV1 writes the pack index with the provided sorted entries to the output.
+func writeIndexV1(output io.Writer, entries sortedInfos) error {
 	b1 := &indexBuilderV1{
 		packBlobIDOffsets: map[blob.ID]uint32{},
 		keyLength:         -1,
 		entryLength:       v1EntryLength,
-		entryCount:        len(allContents),
 	}
 
 	w := bufio.NewWriter(output)
 
 	// prepare extra data to be appended at the end of an index.
-	extraData := b1.prepareExtraData(allContents)
+	extraData, err := b1.prepareExtraData(entries)
+	if err != nil {
+		return err
+	}
 
 	// write header
 	header := make([]byte, v1HeaderSize)
@@ -310,10 +316,10 @@ func (b Builder) buildV1(output io.Writer) error {
 	// write all sorted contents.
 	entry := make([]byte, b1.entryLength)
 
-	for _, it := range allContents {
-		if err := b1.writeEntry(w, it, entry); err != nil {
-			return errors.Wrap(err, "unable to write entry")
-		}
+	if err := entries(func(it Info) error {
+		return errors.Wrap(b1.writeEntry(w, it, entry), "unable to write entry")
+	}); err != nil {
+		return err
 	}
 
 	if _, err := w.Write(extraData); err != nil {
@@ -323,27 +329,33 @@ func (b Builder) buildV1(output io.Writer) error {
 	return errors.Wrap(w.Flush(), "error flushing index")
 }
 
-func (b *indexBuilderV1) prepareExtraData(allContents []Info) []byte {
+func (b *indexBuilderV1) prepareExtraData(entries sortedInfos) ([]byte, error) {
 	var extraData []byte
 
 	var hashBuf [maxContentIDSize]byte
 
-	for i, it := range allContents {
-		if i == 0 {
+	if err := entries(func(it Info) error {
+		if b.entryCount == 0 {
 			b.keyLength = len(contentIDToBytes(hashBuf[:0], it.GetContentID()))
 		}
 
+		b.entryCount++
+
 		if it.GetPackBlobID() != "" {
 			if _, ok := b.packBlobIDOffsets[it.GetPackBlobID()]; !ok {
 				b.packBlobIDOffsets[it.GetPackBlobID()] = uint32(len(extraData))
 				extraData = append(extraData, []byte(it.GetPackBlobID())...)
 			}
 		}
+
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 
 	b.extraDataOffset = uint32(v1HeaderSize + b.entryCount*(b.keyLength+b.entryLength))
 
-	return extraData
+	return extraData, nil
 }
 
 func (b *indexBuilderV1) writeEntry(w io.Writer, it Info, entry []byte) error {
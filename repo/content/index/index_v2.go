@@ -438,39 +438,58 @@ func indexV2FormatInfoFromInfo(v Info) indexV2FormatInfo {
 	}
 }
 
-// buildUniqueFormatToIndexMap builds a map of unique indexV2FormatInfo to their numeric identifiers.
-func buildUniqueFormatToIndexMap(sortedInfos []Info) map[indexV2FormatInfo]byte {
-	result := map[indexV2FormatInfo]byte{}
-
-	for _, v := range sortedInfos {
-		key := indexV2FormatInfoFromInfo(v)
-		if _, ok := result[key]; !ok {
-			result[key] = byte(len(result))
-		}
+// addFormat assigns the next numeric identifier to the format of the entry when it's first seen.
+func (b *indexBuilderV2) addFormat(v Info) {
+	key := indexV2FormatInfoFromInfo(v)
+	if _, ok := b.uniqueFormatInfo2Index[key]; !ok {
+		b.uniqueFormatInfo2Index[key] = byte(len(b.uniqueFormatInfo2Index))
 	}
-
-	return result
 }
 
-// buildPackIDToIndexMap builds a map of unqiue blob IDs to their numeric identifiers.
-func buildPackIDToIndexMap(sortedInfos []Info) map[blob.ID]int {
-	result := map[blob.ID]int{}
+// addPackID assigns the next numeric identifier to the pack blob ID of the entry when it's first seen.
+func (b *indexBuilderV2) addPackID(v Info) {
+	blobID := v.GetPackBlobID()
+	if _, ok := b.packID2Index[blobID]; !ok {
+		b.packID2Index[blobID] = len(b.packID2Index)
+	}
+}
 
-	for _, v := range sortedInfos {
-		blobID := v.GetPackBlobID()
-		if _, ok := result[blobID]; !ok {
-			result[blobID] = len(result)
-		}
+func max(a, b int) int {
+	if a > b {
+		return a
 	}
 
-	return result
+	return b
 }
 
-// maxContentLengths computes max content lengths in the builder.
-func maxContentLengths(sortedInfos []Info) (maxPackedLength, maxOriginalLength, maxPackOffset uint32) {
-	for _, v := range sortedInfos {
-		if l := v.GetPackedLength(); l > maxPackedLength {
-			maxPackedLength = l
+func newIndexBuilderV2(entries sortedInfos) (*indexBuilderV2, error) {
+	b := &indexBuilderV2{
+		packBlobIDOffsets:      map[blob.ID]uint32{},
+		keyLength:              -1,
+		entrySize:              v2EntryOffsetFormatID,
+		uniqueFormatInfo2Index: map[indexV2FormatInfo]byte{},
+		packID2Index:           map[blob.ID]int{},
+	}
+
+	var (
+		hashBuf                                        [maxContentIDSize]byte
+		maxPackedLen, maxOriginalLength, maxPackOffset uint32
+	)
+
+	// compute maps of unique formats and pack IDs to their indexes and maximum content lengths
+	// in a single pass.
+	if err := entries(func(v Info) error {
+		if b.entryCount == 0 {
+			b.keyLength = len(contentIDToBytes(hashBuf[:0], v.GetContentID()))
+		}
+
+		b.entryCount++
+
+		b.addFormat(v)
+		b.addPackID(v)
+
+		if l := v.GetPackedLength(); l > maxPackedLen {
+			maxPackedLen = l
 		}
 
 		if l := v.GetOriginalLength(); l > maxOriginalLength {
@@ -480,45 +499,29 @@ func maxContentLengths(sortedInfos []Info) (maxPackedLength, maxOriginalLength,
 		if l := v.GetPackOffset(); l > maxPackOffset {
 			maxPackOffset = l
 		}
-	}
 
-	return
-}
-
-func max(a, b int) int {
-	if a > b {
-		return a
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 
-	return b
-}
-
-func newIndexBuilderV2(sortedInfos []Info) (*indexBuilderV2, error) {
-	entrySize := v2EntryOffsetFormatID
-
-	// compute a map of unique formats to their indexes.
-	uniqueFormat2Index := buildUniqueFormatToIndexMap(sortedInfos)
-	if len(uniqueFormat2Index) > v2MaxFormatCount {
-		return nil, errors.Errorf("unsupported - too many unique formats %v (max %v)", len(uniqueFormat2Index), v2MaxFormatCount)
+	if len(b.uniqueFormatInfo2Index) > v2MaxFormatCount {
+		return nil, errors.Errorf("unsupported - too many unique formats %v (max %v)", len(b.uniqueFormatInfo2Index), v2MaxFormatCount)
 	}
 
 	// if have more than one format present, we need to store per-entry format identifier, otherwise assume 0.
-	if len(uniqueFormat2Index) > 1 {
-		entrySize = max(entrySize, v2EntryOffsetFormatIDEnd)
+	if len(b.uniqueFormatInfo2Index) > 1 {
+		b.entrySize = max(b.entrySize, v2EntryOffsetFormatIDEnd)
 	}
 
-	packID2Index := buildPackIDToIndexMap(sortedInfos)
-	if len(packID2Index) > v2MaxUniquePackIDCount {
-		return nil, errors.Errorf("unsupported - too many unique pack IDs %v (max %v)", len(packID2Index), v2MaxUniquePackIDCount)
+	if len(b.packID2Index) > v2MaxUniquePackIDCount {
+		return nil, errors.Errorf("unsupported - too many unique pack IDs %v (max %v)", len(b.packID2Index), v2MaxUniquePackIDCount)
 	}
 
-	if len(packID2Index) > v2MaxShortPackIDCount {
-		entrySize = max(entrySize, v2EntryOffsetExtendedPackBlobIDEnd)
+	if len(b.packID2Index) > v2MaxShortPackIDCount {
+		b.entrySize = max(b.entrySize, v2EntryOffsetExtendedPackBlobIDEnd)
 	}
 
-	// compute maximum content length to determine how many bits we need to use to store it.
-	maxPackedLen, maxOriginalLength, maxPackOffset := maxContentLengths(sortedInfos)
-
 	// contents >= 28 bits (256 MiB) can't be stored at all.
 	if maxPackedLen >= v2MaxContentLength || maxOriginalLength >= v2MaxContentLength {
 		return nil, errors.Errorf("maximum content length is too high: (packed %v, original %v, max %v)", maxPackedLen, maxOriginalLength, v2MaxContentLength)
@@ -526,47 +529,41 @@ func newIndexBuilderV2(sortedInfos []Info) (*indexBuilderV2, error) {
 
 	// contents >= 24 bits (16 MiB) requires extra 0.5 byte per length.
 	if maxPackedLen >= v2MaxShortContentLength || maxOriginalLength >= v2MaxShortContentLength {
-		entrySize = max(entrySize, v2EntryOffsetHighLengthBitsEnd)
+		b.entrySize = max(b.entrySize, v2EntryOffsetHighLengthBitsEnd)
 	}
 
 	if maxPackOffset >= v2MaxPackOffset {
 		return nil, errors.Errorf("pack offset %v is too high", maxPackOffset)
 	}
 
-	keyLength := -1
-
-	if len(sortedInfos) > 0 {
-		var hashBuf [maxContentIDSize]byte
-
-		keyLength = len(contentIDToBytes(hashBuf[:0], sortedInfos[0].GetContentID()))
-	}
-
-	return &indexBuilderV2{
-		packBlobIDOffsets:      map[blob.ID]uint32{},
-		keyLength:              keyLength,
-		entrySize:              entrySize,
-		entryCount:             len(sortedInfos),
-		uniqueFormatInfo2Index: uniqueFormat2Index,
-		packID2Index:           packID2Index,
-	}, nil
+	return b, nil
 }
 
 // buildV2 writes the pack index to the provided output.
 func (b Builder) buildV2(output io.Writer) error {
-	sortedInfos := b.sortedContents()
+	return writeIndexV2(output, sortedSlice(b.sortedContents()))
+}
 
-	b2, err := newIndexBuilderV2(sortedInfos)
+// writeIndexV2 writes the pack index with the provided sorted entries to the output.
+func writeIndexV2(output io.Writer, entries sortedInfos) error {
+	b2, err := newIndexBuilderV2(entries)
 	if err != nil {
 		return err
 	}
 
 	w := bufio.NewWriter(output)
 
+	// write pack ID entries in the index order of values from packID2Index (0, 1, 2, ...).
+	reversePackIDIndex := make([]blob.ID, len(b2.packID2Index))
+	for k, v := range b2.packID2Index {
+		reversePackIDIndex[v] = k
+	}
+
 	// prepare extra data to be appended at the end of an index.
-	extraData := b2.prepareExtraData(sortedInfos)
+	extraData := b2.prepareExtraData(reversePackIDIndex)
 
 	if b2.keyLength <= 1 {
-		return errors.Errorf("invalid key length: %v for %v", b2.keyLength, len(b))
+		return errors.Errorf("invalid key length: %v for %v", b2.keyLength, b2.entryCount)
 	}
 
 	// write header
@@ -584,16 +581,10 @@ func (b Builder) buildV2(output io.Writer) error {
 	}
 
 	// write sorted index entries
-	for _, it := range sortedInfos {
-		if err := b2.writeIndexEntry(w, it); err != nil {
-			return errors.Wrap(err, "unable to write entry")
-		}
-	}
-
-	// write pack ID entries in the index order of values from packID2Index (0, 1, 2, ...).
-	reversePackIDIndex := make([]blob.ID, len(b2.packID2Index))
-	for k, v := range b2.packID2Index {
-		reversePackIDIndex[v] = k
+	if err := entries(func(it Info) error {
+		return errors.Wrap(b2.writeIndexEntry(w, it), "unable to write entry")
+	}); err != nil {
+		return err
 	}
 
 	// emit pack ID information in this order.
@@ -623,15 +614,15 @@ func (b Builder) buildV2(output io.Writer) error {
 	return errors.Wrap(w.Flush(), "error flushing index")
 }
 
-func (b *indexBuilderV2) prepareExtraData(sortedInfos []Info) []byte {
+// prepareExtraData returns the pack blob IDs in the order of their first appearance in the index,
+// which is the order of their numeric identifiers.
+func (b *indexBuilderV2) prepareExtraData(packIDs []blob.ID) []byte {
 	var extraData []byte
 
-	for _, it := range sortedInfos {
-		if it.GetPackBlobID() != "" {
-			if _, ok := b.packBlobIDOffsets[it.GetPackBlobID()]; !ok {
-				b.packBlobIDOffsets[it.GetPackBlobID()] = uint32(len(extraData))
-				extraData = append(extraData, []byte(it.GetPackBlobID())...)
-			}
+	for _, packID := range packIDs {
+		if packID != "" {
+			b.packBlobIDOffsets[packID] = uint32(len(extraData))
+			extraData = append(extraData, []byte(packID)...)
 		}
 	}
 
@@ -9,6 +9,7 @@
 	"golang.org/x/sync/errgroup"
 
 	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/listcache"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/content/index"
 	"github.com/kopia/kopia/repo/format"
@@ -23,11 +24,22 @@
 
 	defaultIndexShardSize = 16e6 // slightly less than 2^24, which lets index use 24-bit/3-byte indexes
 
+	defaultLowMemoryCompactionMaxEntries = 1e6 // max number of index entries held in memory by low-memory compaction
+
 	defaultEventualConsistencySettleTime = 1 * time.Hour
 	compactionLogBlobPrefix              = "m"
 	cleanupBlobPrefix                    = "l"
+
+	// compaction intents, which record outputs of compactions until their compaction log has been written.
+	compactionIntentBlobPrefix = "t"
 )
 
+// compactionIntentEntry represents contents of compaction intent stored in `t` blob.
+type compactionIntentEntry struct {
+	// list of blobs that will be results of compaction.
+	OutputBlobIDs []blob.ID `json:"outputBlobIDs"`
+}
+
 // compactionLogEntry represents contents of compaction log entry stored in `m` blob.
 type compactionLogEntry struct {
 	// list of input blob names that were compacted together.
@@ -65,6 +77,8 @@ type indexBlobManagerV0 struct {
 	log     logging.Logger
 
 	formattingOptions IndexFormattingOptions
+
+	lowMemoryMaxEntries int // overrides defaultLowMemoryCompactionMaxEntries if non-zero
 }
 
 func (m *indexBlobManagerV0) listActiveIndexBlobs(ctx context.Context) ([]IndexBlobInfo, time.Time, error) {
@@ -125,6 +139,14 @@ func (m *indexBlobManagerV0) listActiveIndexBlobs(ctx context.Context) ([]IndexB
 func (m *indexBlobManagerV0) invalidate(ctx context.Context) {
 }
 
+// refreshListCache re-lists index blobs whose lists are cached, retrying transient failures.
+func (m *indexBlobManagerV0) refreshListCache(ctx context.Context) error {
+	//nolint:wrapcheck
+	return listcache.Refresh(ctx, m.st, listcache.RefreshOptions{
+		Prefixes: []blob.ID{LegacyIndexBlobPrefix, compactionLogBlobPrefix, cleanupBlobPrefix, compactionIntentBlobPrefix},
+	})
+}
+
 func (m *indexBlobManagerV0) flushCache(ctx context.Context) {
 	if err := m.st.FlushCaches(ctx); err != nil {
 		m.log.Debugf("error flushing caches: %v", err)
@@ -132,6 +154,10 @@ func (m *indexBlobManagerV0) flushCache(ctx context.Context) {
 }
 
 func (m *indexBlobManagerV0) compact(ctx context.Context, opt CompactOptions) error {
+	if err := m.recoverInterruptedCompactions(ctx, opt.maxEventualConsistencySettleTime()); err != nil {
+		return errors.Wrap(err, "error recovering interrupted compactions")
+	}
+
 	indexBlobs, _, err := m.listActiveIndexBlobs(ctx)
 	if err != nil {
 		return errors.Wrap(err, "error listing active index blobs")
@@ -472,9 +498,13 @@ func (m *indexBlobManagerV0) compactIndexBlobs(ctx context.Context, indexBlobs [
 		return errors.Wrap(mperr, "mutable parameters")
 	}
 
+	if opt.LowMemory {
+		return m.compactIndexBlobsLowMemory(ctx, indexBlobs, opt, mp)
+	}
+
 	bld := make(index.Builder)
 
-	var inputs, outputs []blob.Metadata
+	var inputs []blob.Metadata
 
 	for i, indexBlob := range indexBlobs {
 		m.log.Debugf("compacting-entries[%v/%v] %v", i, len(indexBlobs), indexBlob)
@@ -490,25 +520,143 @@ func (m *indexBlobManagerV0) compactIndexBlobs(ctx context.Context, indexBlobs [
 	// we must do it after all input blobs have been merged, otherwise we may resurrect contents.
 	m.dropContentsFromBuilder(bld, opt)
 
-	dataShards, cleanupShards, err := bld.BuildShards(mp.IndexVersion, false, defaultIndexShardSize)
+	dataShards, cleanupShards, err := bld.BuildShards(mp.IndexVersion, false, indexShardSize(mp))
 	if err != nil {
 		return errors.Wrap(err, "unable to build an index")
 	}
 
 	defer cleanupShards()
 
-	compactedIndexBlobs, err := m.writeIndexBlobs(ctx, dataShards, "")
+	return m.writeAndRegisterCompaction(ctx, inputs, dataShards, opt)
+}
+
+// writeAndRegisterCompaction writes compacted index blobs and registers the compaction.
+//
+// The names of compacted index blobs are recorded in a compaction intent before they are written, the intent
+// is removed once the compaction log has been written. Until then the compacted index blobs merely duplicate
+// entries of the inputs, which makes the compaction log the atomic switch between inputs and outputs.
+// Intents left behind by interrupted compactions are removed by recoverInterruptedCompactions().
+//
+// Epoch-based repositories don't need this, because compacted epoch index blobs are named with the number
+// of blobs in their set, so partially-written sets are ignored, and uncompacted blobs are only removed once
+// a complete set has been written long enough ago.
+func (m *indexBlobManagerV0) writeAndRegisterCompaction(ctx context.Context, inputs []blob.Metadata, dataShards []gather.Bytes, opt CompactOptions) error {
+	var intent compactionIntentEntry
+
+	for _, data := range dataShards {
+		intent.OutputBlobIDs = append(intent.OutputBlobIDs, encryptedBlobID(m.enc.crypter, data, LegacyIndexBlobPrefix, ""))
+	}
+
+	intentBytes, err := json.Marshal(&intent)
 	if err != nil {
-		return errors.Wrap(err, "unable to write compacted indexes")
+		return errors.Wrap(err, "unable to marshal compaction intent")
+	}
+
+	intentBlob, err := m.enc.encryptAndWriteBlob(ctx, gather.FromSlice(intentBytes), compactionIntentBlobPrefix, "")
+	if err != nil {
+		return errors.Wrap(err, "unable to write compaction intent")
 	}
 
-	outputs = append(outputs, compactedIndexBlobs...)
+	outputs, err := m.writeIndexBlobs(ctx, dataShards, "")
+	if err != nil {
+		return errors.Wrap(err, "unable to write compacted indexes")
+	}
 
 	if err := m.registerCompaction(ctx, inputs, outputs, opt.maxEventualConsistencySettleTime()); err != nil {
 		return errors.Wrap(err, "unable to register compaction")
 	}
 
-	return nil
+	return errors.Wrap(m.deleteBlobsFromStorageAndCache(ctx, []blob.ID{intentBlob.BlobID}), "unable to delete compaction intent")
+}
+
+// recoverInterruptedCompactions removes compaction intents left behind by interrupted compactions which are older
+// than the eventual consistency settle time.
+//
+// Compacted index blobs of such compactions are never deleted: unregistered ones merely duplicate entries of
+// their inputs and are merged by the next compaction, while their content-derived names may also match index
+// blobs which are still active, for example when a compaction is re-run over an unchanged set of indexes.
+func (m *indexBlobManagerV0) recoverInterruptedCompactions(ctx context.Context, maxEventualConsistencySettleTime time.Duration) error {
+	allIntentBlobs, err := blob.ListAllBlobs(ctx, m.st, compactionIntentBlobPrefix)
+	if err != nil {
+		return errors.Wrap(err, "error listing compaction intents")
+	}
+
+	// more recent intents may belong to compactions in progress.
+	var intentBlobIDs []blob.ID
+
+	for _, ib := range blobsOlderThan(allIntentBlobs, m.timeNow().Add(-maxEventualConsistencySettleTime)) {
+		m.log.Debugf("removing intent of interrupted compaction %v", ib.BlobID)
+
+		intentBlobIDs = append(intentBlobIDs, ib.BlobID)
+	}
+
+	return errors.Wrap(m.deleteBlobsFromStorageAndCache(ctx, intentBlobIDs), "unable to delete compaction intents")
+}
+
+// indexShardSize returns the maximum number of entries in each index blob, which is derived
+// from the target index blob size when one is configured.
+func indexShardSize(mp format.MutableParameters) int {
+	if mp.MaxIndexBlockSize <= 0 {
+		return defaultIndexShardSize
+	}
+
+	if n := index.ShardSizeForBlockSize(mp.IndexVersion, mp.MaxIndexBlockSize); n < defaultIndexShardSize {
+		return n
+	}
+
+	return defaultIndexShardSize
+}
+
+// compactIndexBlobsLowMemory is equivalent to compactIndexBlobs() but merges index entries
+// using index.ExternalBuilder, which keeps a bounded number of entries in memory.
+func (m *indexBlobManagerV0) compactIndexBlobsLowMemory(ctx context.Context, indexBlobs []IndexBlobInfo, opt CompactOptions, mp format.MutableParameters) error {
+	maxEntries := m.lowMemoryMaxEntries
+	if maxEntries == 0 {
+		maxEntries = defaultLowMemoryCompactionMaxEntries
+	}
+
+	bld := index.NewExternalBuilder("", maxEntries)
+	defer bld.Close() //nolint:errcheck
+
+	var inputs []blob.Metadata
+
+	for i, indexBlob := range indexBlobs {
+		m.log.Debugf("compacting-entries[%v/%v] %v", i, len(indexBlobs), indexBlob)
+
+		if err := iterateIndexBlob(ctx, m.enc, indexBlob.BlobID, bld.Add); err != nil {
+			return errors.Wrap(err, "error adding index to builder")
+		}
+
+		inputs = append(inputs, indexBlob.Metadata)
+	}
+
+	m.log.Debugf("merging %v spilled index runs", bld.SpilledRuns())
+
+	// drop contents during the final merge, after all input blobs have been merged.
+	dropContents := map[ID]bool{}
+	for _, dc := range opt.DropContents {
+		dropContents[dc] = true
+	}
+
+	dataShards, cleanupShards, err := bld.BuildShards(mp.IndexVersion, false, indexShardSize(mp), func(i Info) bool {
+		return !shouldDropFromIndex(i, opt, dropContents)
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to build an index")
+	}
+
+	defer cleanupShards()
+
+	return m.writeAndRegisterCompaction(ctx, inputs, dataShards, opt)
+}
+
+// shouldDropFromIndex determines whether compaction should drop the given entry, matching the behavior of dropContentsFromBuilder().
+func shouldDropFromIndex(i Info, opt CompactOptions, dropContents map[ID]bool) bool {
+	if dropContents[i.GetContentID()] {
+		return true
+	}
+
+	return !opt.DropDeletedBefore.IsZero() && i.GetDeleted() && i.Timestamp().Before(opt.DropDeletedBefore)
 }
 
 func (m *indexBlobManagerV0) dropContentsFromBuilder(bld index.Builder, opt CompactOptions) {
@@ -546,6 +694,13 @@ func WriteLegacyIndexPoisonBlob(ctx context.Context, st blob.Storage) error {
 }
 
 func addIndexBlobsToBuilder(ctx context.Context, enc *encryptedBlobMgr, bld index.Builder, indexBlobID blob.ID) error {
+	return iterateIndexBlob(ctx, enc, indexBlobID, func(i Info) error {
+		bld.Add(i)
+		return nil
+	})
+}
+
+func iterateIndexBlob(ctx context.Context, enc *encryptedBlobMgr, indexBlobID blob.ID, cb func(i Info) error) error {
 	var data gather.WriteBuffer
 	defer data.Close()
 
@@ -559,12 +714,8 @@ func addIndexBlobsToBuilder(ctx context.Context, enc *encryptedBlobMgr, bld inde
 		return errors.Wrapf(err, "unable to open index blob %q", indexBlobID)
 	}
 
-	_ = ndx.Iterate(index.AllIDs, func(i Info) error {
-		bld.Add(i)
-		return nil
-	})
-
-	return nil
+	//nolint:wrapcheck
+	return ndx.Iterate(index.AllIDs, cb)
 }
 
 func blobsOlderThan(m []blob.Metadata, cutoffTime time.Time) []blob.Metadata {
@@ -10,6 +10,7 @@
 
 	"github.com/kopia/kopia/internal/epoch"
 	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/listcache"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/content/index"
 	"github.com/kopia/kopia/repo/logging"
@@ -45,6 +46,14 @@ func (m *indexBlobManagerV1) invalidate(ctx context.Context) {
 	m.epochMgr.Invalidate()
 }
 
+// refreshListCache re-lists index blobs whose lists are cached, retrying transient failures.
+func (m *indexBlobManagerV1) refreshListCache(ctx context.Context) error {
+	//nolint:wrapcheck
+	return listcache.Refresh(ctx, m.st, listcache.RefreshOptions{
+		Prefixes: []blob.ID{epoch.EpochManagerIndexUberPrefix},
+	})
+}
+
 func (m *indexBlobManagerV1) flushCache(ctx context.Context) {
 	if err := m.st.FlushCaches(ctx); err != nil {
 		m.log.Debugf("error flushing caches: %v", err)
@@ -52,6 +61,11 @@ func (m *indexBlobManagerV1) flushCache(ctx context.Context) {
 }
 
 func (m *indexBlobManagerV1) compact(ctx context.Context, opt CompactOptions) error {
+	if opt.LowMemory {
+		// epochs are compacted by the epoch manager, which always merges indexes in memory.
+		return errors.Errorf("low-memory compaction is not supported by epoch-based index manager")
+	}
+
 	if opt.DropDeletedBefore.IsZero() {
 		return nil
 	}
@@ -73,7 +87,7 @@ func (m *indexBlobManagerV1) compactEpoch(ctx context.Context, blobIDs []blob.ID
 		return errors.Wrap(mperr, "mutable parameters")
 	}
 
-	dataShards, cleanupShards, err := tmpbld.BuildShards(mp.IndexVersion, true, defaultIndexShardSize)
+	dataShards, cleanupShards, err := tmpbld.BuildShards(mp.IndexVersion, true, indexShardSize(mp))
 	if err != nil {
 		return errors.Wrap(err, "unable to build index dataShards")
 	}
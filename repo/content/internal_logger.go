@@ -13,7 +13,6 @@
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
-	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/gather"
 	"github.com/kopia/kopia/internal/zaplogutil"
 	"github.com/kopia/kopia/repo/blob"
@@ -80,7 +79,7 @@ func (m *internalLogManager) NewLogger() *zap.SugaredLogger {
 
 	w := &internalLogger{
 		m:      m,
-		prefix: blob.ID(fmt.Sprintf("%v%v_%x", TextLogBlobPrefix, clock.Now().Local().Format("20060102150405"), rnd)),
+		prefix: blob.ID(fmt.Sprintf("%v%v_%x", TextLogBlobPrefix, m.timeFunc().Local().Format("20060102150405"), rnd)),
 	}
 
 	return zap.New(zapcore.NewCore(
@@ -208,12 +207,12 @@ func (l *internalLogger) Sync() error {
 }
 
 // newInternalLogManager creates a new blobLogManager that will emit logs as repository blobs with a given prefix.
-func newInternalLogManager(ctx context.Context, st blob.Storage, bc crypter) *internalLogManager {
+func newInternalLogManager(ctx context.Context, st blob.Storage, bc crypter, timeNow func() time.Time) *internalLogManager {
 	return &internalLogManager{
 		ctx:            ctx,
 		st:             st,
 		bc:             bc,
 		flushThreshold: blobLoggerFlushThreshold,
-		timeFunc:       clock.Now,
+		timeFunc:       timeNow,
 	}
 }
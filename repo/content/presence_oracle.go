@@ -0,0 +1,49 @@
+package content
+
+import (
+	"context"
+)
+
+// BlockPresenceOracle provides external knowledge about contents that are already stored in the repository,
+// for example a chunk index maintained by another system during a large migration.
+//
+// The oracle is consulted by WriteContent() only for contents that are not found in the repository index,
+// before they are written. Contents reported as present are not written, so the oracle must only report
+// contents that have been written to the repository by this or another client.
+type BlockPresenceOracle interface {
+	IsPresent(ctx context.Context, contentID ID) bool
+}
+
+// presentPerOracle returns true if the provided content, not found in the index, can be assumed
+// to be present in the repository based on the oracle.
+//
+// In verify mode the claim is confirmed by looking up the content in the indexes, which are reloaded from
+// the storage once per session before the first claim is verified, so that contents written by other
+// clients before the session started are found. Claims about contents not found are ignored and
+// the contents are written, which protects against oracles that are out of sync with the repository.
+func (bm *WriteManager) presentPerOracle(ctx context.Context, contentID ID) bool {
+	if bm.presenceOracle == nil || !bm.presenceOracle.IsPresent(ctx, contentID) {
+		return false
+	}
+
+	if !bm.verifyPresenceOracle {
+		return true
+	}
+
+	bm.presenceOracleRefreshOnce.Do(func() {
+		if err := bm.Refresh(ctx); err != nil {
+			bm.log.Errorf("unable to refresh indexes to verify presence oracle: %v", err)
+		}
+	})
+
+	bm.mu.RLock()
+	_, bi, err := bm.getContentInfoReadLocked(ctx, contentID)
+	bm.mu.RUnlock()
+
+	if err != nil || bi.GetDeleted() {
+		bm.log.Infof("content %v reported as present by the oracle was not found in the repository, writing", contentID)
+		return false
+	}
+
+	return true
+}
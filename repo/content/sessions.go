@@ -61,7 +61,17 @@ func (bm *WriteManager) getOrStartSessionLocked(ctx context.Context) (SessionID,
 		return bm.currentSessionInfo.ID, nil
 	}
 
-	id, err := generateSessionID(bm.timeNow())
+	var (
+		id  SessionID
+		err error
+	)
+
+	if bm.deterministic {
+		id, err = bm.deterministicSessionID(ctx)
+	} else {
+		id, err = generateSessionID(bm.timeNow())
+	}
+
 	if err != nil {
 		return "", errors.Wrap(err, "unable to generate session ID")
 	}
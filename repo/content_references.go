@@ -0,0 +1,128 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/manifest"
+)
+
+// ContentReferencesManifestType is the type of the manifests holding the reverse index
+// from content IDs to human-readable paths of objects referencing them.
+const ContentReferencesManifestType = "content-references"
+
+// contentReferencesShardLabel is the label of content reference manifests identifying the shard of the index.
+const contentReferencesShardLabel = "shard"
+
+// ErrContentReferencesNotBuilt is returned by WhoReferences when the reverse index has not been built yet.
+var ErrContentReferencesNotBuilt = errors.New("content reference index has not been built")
+
+// ContentReferences is the payload of a single shard of the content reference index.
+type ContentReferences struct {
+	// References maps content ID to sorted list of paths referencing it.
+	References map[string][]string `json:"references"`
+}
+
+// contentReferencesShard returns the shard of the content reference index holding the provided content ID.
+// The index is sharded by the first byte of the content hash, so that lookups only need to load
+// a small portion of the index.
+func contentReferencesShard(cid content.ID) string {
+	return fmt.Sprintf("%02x", cid.Hash()[0])
+}
+
+func contentReferencesLabels(shard string) map[string]string {
+	return map[string]string{
+		manifest.TypeLabelKey:       ContentReferencesManifestType,
+		contentReferencesShardLabel: shard,
+	}
+}
+
+// WriteContentReferences stores the provided reverse index of content references, replacing
+// any previously-stored index.
+func WriteContentReferences(ctx context.Context, w RepositoryWriter, refs map[content.ID][]string) error {
+	old, err := w.FindManifests(ctx, map[string]string{manifest.TypeLabelKey: ContentReferencesManifestType})
+	if err != nil {
+		return errors.Wrap(err, "error looking for content reference index")
+	}
+
+	shards := map[string]*ContentReferences{}
+
+	for cid, paths := range refs {
+		shard := contentReferencesShard(cid)
+
+		payload := shards[shard]
+		if payload == nil {
+			payload = &ContentReferences{References: map[string][]string{}}
+			shards[shard] = payload
+		}
+
+		sorted := append([]string(nil), paths...)
+		sort.Strings(sorted)
+
+		payload.References[cid.String()] = sorted
+	}
+
+	// an empty index still gets a manifest, so that it can be distinguished from one that was never built.
+	if len(shards) == 0 {
+		shards[""] = &ContentReferences{References: map[string][]string{}}
+	}
+
+	for shard, payload := range shards {
+		if _, err := w.PutManifest(ctx, contentReferencesLabels(shard), payload); err != nil {
+			return errors.Wrapf(err, "error writing content reference index shard %q", shard)
+		}
+	}
+
+	for _, m := range old {
+		if err := w.DeleteManifest(ctx, m.ID); err != nil {
+			return errors.Wrapf(err, "error deleting old content reference index %v", m.ID)
+		}
+	}
+
+	return nil
+}
+
+// WhoReferences returns the paths of objects referencing the provided content ID according
+// to the most recently built content reference index.
+func WhoReferences(ctx context.Context, rep Repository, contentID string) ([]string, error) {
+	cid, err := content.ParseID(contentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid content ID")
+	}
+
+	entries, err := rep.FindManifests(ctx, map[string]string{manifest.TypeLabelKey: ContentReferencesManifestType})
+	if err != nil {
+		return nil, errors.Wrap(err, "error looking for content reference index")
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrContentReferencesNotBuilt
+	}
+
+	var shardEntries []*manifest.EntryMetadata
+
+	shard := contentReferencesShard(cid)
+
+	for _, e := range entries {
+		if e.Labels[contentReferencesShardLabel] == shard {
+			shardEntries = append(shardEntries, e)
+		}
+	}
+
+	if len(shardEntries) == 0 {
+		// no content in this shard is referenced.
+		return nil, nil
+	}
+
+	var refs ContentReferences
+
+	if _, err := rep.GetManifest(ctx, manifest.PickLatestID(shardEntries), &refs); err != nil {
+		return nil, errors.Wrap(err, "error loading content reference index")
+	}
+
+	return refs.References[cid.String()], nil
+}
@@ -3,6 +3,7 @@
 import (
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 
 	"github.com/pkg/errors"
 
@@ -11,6 +12,37 @@
 
 // aeadSealWithRandomNonce returns AEAD-sealed content prepended with random nonce.
 func aeadSealWithRandomNonce(a cipher.AEAD, plaintext gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	return aeadSeal(a, plaintext, contentID, output, func(nonce, _ []byte) error {
+		n, err := rand.Read(nonce)
+		if err != nil {
+			return errors.Wrap(err, "unable to initialize nonce")
+		}
+
+		if n != len(nonce) {
+			return errors.Errorf("did not read exactly %v bytes, got %v", len(nonce), n)
+		}
+
+		return nil
+	})
+}
+
+// aeadSealWithSyntheticNonce returns AEAD-sealed content prepended with nonce derived from
+// the content ID and plaintext, so that encrypting the same input always yields the same output.
+// This is safe because the per-content key is derived from the content ID, which in turn is
+// derived from the plaintext, so a key is never used to seal different plaintexts.
+func aeadSealWithSyntheticNonce(a cipher.AEAD, plaintext gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	return aeadSeal(a, plaintext, contentID, output, func(nonce, input []byte) error {
+		h := sha256.New()
+		h.Write(contentID) //nolint:errcheck
+		h.Write(input)     //nolint:errcheck
+
+		copy(nonce, h.Sum(nil))
+
+		return nil
+	})
+}
+
+func aeadSeal(a cipher.AEAD, plaintext gather.Bytes, contentID []byte, output *gather.WriteBuffer, fillNonce func(nonce, input []byte) error) error {
 	resultLen := plaintext.Length() + a.NonceSize() + a.Overhead()
 
 	// allocate a single, contiguous slice that will be use as temporary input buffer
@@ -28,13 +60,8 @@ func aeadSealWithRandomNonce(a cipher.AEAD, plaintext gather.Bytes, contentID []
 
 	input := plaintext.AppendToSlice(rest[:0])
 
-	n, err := rand.Read(nonce)
-	if err != nil {
-		return errors.Wrap(err, "unable to initialize nonce")
-	}
-
-	if n != a.NonceSize() {
-		return errors.Errorf("did not read exactly %v bytes, got %v", a.NonceSize(), n)
+	if err := fillNonce(nonce, input); err != nil {
+		return err
 	}
 
 	a.Seal(input[:0], nonce, input, contentID)
@@ -71,5 +98,10 @@ func aeadOpenPrefixedWithNonce(a cipher.AEAD, ciphertext gather.Bytes, contentID
 
 	output.Append(result)
 
+	// the scratch buffer is returned to a shared pool, don't leave plaintext behind.
+	for i := range result {
+		result[i] = 0
+	}
+
 	return nil
 }
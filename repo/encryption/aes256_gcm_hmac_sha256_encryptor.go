@@ -62,6 +62,15 @@ func (e aes256GCMHmacSha256) Encrypt(input gather.Bytes, contentID []byte, outpu
 	return aeadSealWithRandomNonce(a, input, contentID, output)
 }
 
+func (e aes256GCMHmacSha256) EncryptDeterministic(input gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	a, err := e.aeadForContent(contentID)
+	if err != nil {
+		return err
+	}
+
+	return aeadSealWithSyntheticNonce(a, input, contentID, output)
+}
+
 func (e aes256GCMHmacSha256) Overhead() int {
 	return aes256GCMHmacSha256Overhead
 }
@@ -58,6 +58,15 @@ func (e chacha20poly1305hmacSha256Encryptor) Encrypt(input gather.Bytes, content
 	return aeadSealWithRandomNonce(a, input, contentID, output)
 }
 
+func (e chacha20poly1305hmacSha256Encryptor) EncryptDeterministic(input gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	a, err := e.aeadForContent(contentID)
+	if err != nil {
+		return err
+	}
+
+	return aeadSealWithSyntheticNonce(a, input, contentID, output)
+}
+
 func (e chacha20poly1305hmacSha256Encryptor) Overhead() int {
 	return chacha20poly1305hmacSha256EncryptorOverhead
 }
@@ -0,0 +1,37 @@
+package encryption
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+)
+
+// ErrDeterministicEncryptionUnsupported is returned when deterministic encryption is requested
+// from an encryptor that can't provide it.
+var ErrDeterministicEncryptionUnsupported = errors.New("deterministic encryption is not supported")
+
+// DeterministicEncryptor is implemented by encryptors that can produce identical ciphertext
+// each time the same plaintext is encrypted with the same content ID.
+type DeterministicEncryptor interface {
+	EncryptDeterministic(plainText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error
+}
+
+// Deterministic returns an Encryptor whose Encrypt() always produces the same output for the same inputs,
+// or ErrDeterministicEncryptionUnsupported if the provided encryptor does not support it.
+func Deterministic(e Encryptor) (Encryptor, error) {
+	d, ok := e.(DeterministicEncryptor)
+	if !ok {
+		return nil, ErrDeterministicEncryptionUnsupported
+	}
+
+	return deterministicEncryptor{e, d}, nil
+}
+
+type deterministicEncryptor struct {
+	Encryptor
+	d DeterministicEncryptor
+}
+
+func (e deterministicEncryptor) Encrypt(plainText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	return e.d.EncryptDeterministic(plainText, contentID, output)
+}
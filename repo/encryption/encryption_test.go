@@ -95,6 +95,41 @@ func TestRoundTrip(t *testing.T) {
 	}
 }
 
+func TestDeterministic(t *testing.T) {
+	data := make([]byte, 100)
+	rand.Read(data)
+
+	masterKey := make([]byte, 32)
+	rand.Read(masterKey)
+
+	contentID := make([]byte, 16)
+	rand.Read(contentID)
+
+	for _, encryptionAlgo := range encryption.SupportedAlgorithms(true) {
+		encryptionAlgo := encryptionAlgo
+		t.Run(encryptionAlgo, func(t *testing.T) {
+			e0, err := encryption.CreateEncryptor(parameters{encryptionAlgo, masterKey})
+			require.NoError(t, err)
+
+			e, err := encryption.Deterministic(e0)
+			require.NoError(t, err)
+
+			var cipherText1, cipherText2, plainText gather.WriteBuffer
+			defer cipherText1.Close()
+			defer cipherText2.Close()
+			defer plainText.Close()
+
+			require.NoError(t, e.Encrypt(gather.FromSlice(data), contentID, &cipherText1))
+			require.NoError(t, e.Encrypt(gather.FromSlice(data), contentID, &cipherText2))
+			require.Equal(t, cipherText1.ToByteSlice(), cipherText2.ToByteSlice())
+
+			// deterministic ciphertext can be decrypted using regular encryptor.
+			require.NoError(t, e0.Decrypt(cipherText1.Bytes(), contentID, &plainText))
+			require.Equal(t, data, plainText.ToByteSlice())
+		})
+	}
+}
+
 func TestCiphertextSamples(t *testing.T) {
 	cases := []struct {
 		masterKey []byte
@@ -196,3 +231,29 @@ func BenchmarkEncryption(b *testing.B) {
 		out.Close()
 	}
 }
+
+func BenchmarkDecryption(b *testing.B) {
+	masterKey := make([]byte, 32)
+	rand.Read(masterKey)
+
+	enc, err := encryption.CreateEncryptor(parameters{encryption.DefaultAlgorithm, masterKey})
+	require.NoError(b, err)
+
+	iv := []byte{0, 1, 2, 3, 4, 5, 6, 7, 0, 1, 2, 3, 4, 5, 6, 7, 0, 1, 2, 3, 4, 5, 6, 7, 0, 1, 2, 3, 4, 5, 6, 7}
+
+	// typical size of a manifest content.
+	var cipherText gather.WriteBuffer
+	defer cipherText.Close()
+
+	require.NoError(b, enc.Encrypt(gather.FromSlice(bytes.Repeat([]byte{1, 2, 3, 4, 5, 6, 7, 8}, 512)), iv, &cipherText))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var out gather.WriteBuffer
+
+		enc.Decrypt(cipherText.Bytes(), iv, &out)
+		out.Close()
+	}
+}
@@ -3,6 +3,7 @@
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"time"
 
 	"github.com/pkg/errors"
@@ -41,7 +42,7 @@ func (r *BlobStorageConfiguration) Validate() error {
 	return nil
 }
 
-func serializeBlobCfgBytes(f *KopiaRepositoryJSON, r BlobStorageConfiguration, formatEncryptionKey []byte) ([]byte, error) {
+func serializeBlobCfgBytes(f *KopiaRepositoryJSON, r BlobStorageConfiguration, formatEncryptionKey []byte, nonceSource io.Reader) ([]byte, error) {
 	data, err := json.Marshal(r)
 	if err != nil {
 		return nil, errors.Wrap(err, "can't marshal blobCfgBlob to JSON")
@@ -52,7 +53,7 @@ func serializeBlobCfgBytes(f *KopiaRepositoryJSON, r BlobStorageConfiguration, f
 		return data, nil
 
 	case aes256GcmEncryption:
-		return encryptRepositoryBlobBytesAes256Gcm(data, formatEncryptionKey, f.UniqueID)
+		return encryptRepositoryBlobBytesAes256Gcm(data, formatEncryptionKey, f.UniqueID, nonceSource)
 
 	default:
 		return nil, errors.Errorf("unknown encryption algorithm: '%v'", f.EncryptionAlgorithm)
@@ -78,7 +79,7 @@ func deserializeBlobCfgBytes(j *KopiaRepositoryJSON, encryptedBlobCfgBytes, form
 	case aes256GcmEncryption:
 		plainText, err = decryptRepositoryBlobBytesAes256Gcm(encryptedBlobCfgBytes, formatEncryptionKey, j.UniqueID)
 		if err != nil {
-			return BlobStorageConfiguration{}, errors.Errorf("unable to decrypt repository blobcfg blob")
+			return BlobStorageConfiguration{}, errors.Wrap(err, "unable to decrypt repository blobcfg blob")
 		}
 
 	default:
@@ -94,7 +95,11 @@ func deserializeBlobCfgBytes(j *KopiaRepositoryJSON, encryptedBlobCfgBytes, form
 
 // WriteBlobCfgBlob writes `kopia.blobcfg` encrypted using the provided key.
 func (f *KopiaRepositoryJSON) WriteBlobCfgBlob(ctx context.Context, st blob.Storage, blobcfg BlobStorageConfiguration, formatEncryptionKey []byte) error {
-	blobCfgBytes, err := serializeBlobCfgBytes(f, blobcfg, formatEncryptionKey)
+	return f.writeBlobCfgBlob(ctx, st, blobcfg, formatEncryptionKey, defaultNonceSource)
+}
+
+func (f *KopiaRepositoryJSON) writeBlobCfgBlob(ctx context.Context, st blob.Storage, blobcfg BlobStorageConfiguration, formatEncryptionKey []byte, nonceSource io.Reader) error {
+	blobCfgBytes, err := serializeBlobCfgBytes(f, blobcfg, formatEncryptionKey, nonceSource)
 	if err != nil {
 		return errors.Wrap(err, "unable to encrypt blobcfg bytes")
 	}
@@ -108,3 +113,21 @@ func (f *KopiaRepositoryJSON) WriteBlobCfgBlob(ctx context.Context, st blob.Stor
 
 	return nil
 }
+
+// readBlobCfgBlob reads and decrypts the BLOB storage configuration, which is empty when the blob does not exist.
+func readBlobCfgBlob(ctx context.Context, st blob.Storage, j *KopiaRepositoryJSON, formatEncryptionKey []byte) (BlobStorageConfiguration, error) {
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	if err := st.GetBlob(ctx, KopiaBlobCfgBlobID, 0, -1, &tmp); err != nil {
+		if errors.Is(err, blob.ErrBlobNotFound) {
+			return BlobStorageConfiguration{}, nil
+		}
+
+		return BlobStorageConfiguration{}, errors.Wrap(err, "load blob config")
+	}
+
+	blobCfg, err := deserializeBlobCfgBytes(j, tmp.ToByteSlice(), formatEncryptionKey)
+
+	return blobCfg, errors.Wrap(err, "deserialize blob config")
+}
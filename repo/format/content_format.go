@@ -8,14 +8,23 @@
 	"github.com/kopia/kopia/repo/content/index"
 )
 
+const saltedHashSecretLength = 32
+
+//nolint:gochecknoglobals
+var hashSaltPurpose = []byte("content-hash-salt")
+
 // ContentFormat describes the rules for formatting contents in repository.
 type ContentFormat struct {
-	Hash               string `json:"hash,omitempty"`                        // identifier of the hash algorithm used
-	Encryption         string `json:"encryption,omitempty"`                  // identifier of the encryption algorithm used
-	ECC                string `json:"ecc,omitempty"`                         // identifier of the ecc algorithm used
-	ECCOverheadPercent int    `json:"eccOverheadPercent,omitempty"`          // space overhead for ecc
-	HMACSecret         []byte `json:"secret,omitempty" kopia:"sensitive"`    // HMAC secret used to generate encryption keys
-	MasterKey          []byte `json:"masterKey,omitempty" kopia:"sensitive"` // master encryption key (SIV-mode encryption only)
+	Hash               string   `json:"hash,omitempty"`                                 // identifier of the hash algorithm used
+	Encryption         string   `json:"encryption,omitempty"`                           // identifier of the encryption algorithm used
+	ECC                string   `json:"ecc,omitempty"`                                  // identifier of the ecc algorithm used
+	ECCOverheadPercent int      `json:"eccOverheadPercent,omitempty"`                   // space overhead for ecc
+	HMACSecret         []byte   `json:"secret,omitempty" kopia:"sensitive"`             // HMAC secret used to generate encryption keys
+	MasterKey          []byte   `json:"masterKey,omitempty" kopia:"sensitive"`          // master encryption key (SIV-mode encryption only)
+	ContentMAC         bool     `json:"contentMAC,omitempty"`                           // append keyed MAC to each stored content
+	HashSalt           []byte   `json:"hashSalt,omitempty" kopia:"sensitive"`           // repository-specific salt mixed into content hash
+	EnvelopeEncryption bool     `json:"envelopeEncryption,omitempty"`                   // encrypt each item with random data key wrapped by master key
+	EnvelopeMasterKeys [][]byte `json:"envelopeMasterKeys,omitempty" kopia:"sensitive"` // rotated master keys wrapping data keys, the last one is current
 	MutableParameters
 
 	EnablePasswordChange bool `json:"enablePasswordChange"` // disables replication of kopia.repository blob in packs
@@ -60,6 +69,8 @@ type MutableParameters struct {
 	MaxPackSize     int              `json:"maxPackSize,omitempty"`     // maximum size of a pack object
 	IndexVersion    int              `json:"indexVersion,omitempty"`    // force particular index format version (1,2,..)
 	EpochParameters epoch.Parameters `json:"epochParameters,omitempty"` // epoch manager parameters
+
+	MaxIndexBlockSize int `json:"maxIndexBlockSize,omitempty"` // target size of each index blob written, 0 = unlimited
 }
 
 // Validate validates the parameters.
@@ -76,6 +87,10 @@ func (v *MutableParameters) Validate() error {
 		return errors.Errorf("invalid index version, supported versions are 1 & 2")
 	}
 
+	if v.MaxIndexBlockSize < 0 {
+		return errors.Errorf("max index block size must not be negative")
+	}
+
 	if err := v.EpochParameters.Validate(); err != nil {
 		return errors.Wrap(err, "invalid epoch parameters")
 	}
@@ -109,6 +124,13 @@ func (f *ContentFormat) GetHashFunction() string {
 }
 
 // GetHmacSecret implements hashing.Parameters.
+//
+// When the repository has a hash salt, the returned secret is derived from both the HMAC secret
+// and the salt, so that identical contents hash to different IDs in repositories with different salts.
 func (f *ContentFormat) GetHmacSecret() []byte {
-	return f.HMACSecret
+	if len(f.HashSalt) == 0 {
+		return f.HMACSecret
+	}
+
+	return DeriveKeyFromMasterKey(f.HMACSecret, f.HashSalt, hashSaltPurpose, saltedHashSecretLength)
 }
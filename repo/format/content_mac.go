@@ -0,0 +1,115 @@
+package format
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/encryption"
+)
+
+const (
+	contentMACKeyLength = 32
+	contentMACLength    = sha256.Size
+)
+
+//nolint:gochecknoglobals
+var purposeContentMAC = []byte("content-mac")
+
+// ErrContentMACMismatch is returned when the keyed MAC stored with a content does not match its data.
+var ErrContentMACMismatch = errors.New("content MAC mismatch")
+
+// contentMACEncryptor wraps another encryptor and appends a keyed HMAC-SHA256 of the content ID
+// and the encrypted payload, which is verified on read independently of the content hash.
+type contentMACEncryptor struct {
+	impl encryption.Encryptor
+	key  []byte
+}
+
+func newContentMACEncryptor(impl encryption.Encryptor, masterKey []byte) *contentMACEncryptor {
+	return &contentMACEncryptor{
+		impl: impl,
+		key:  DeriveKeyFromMasterKey(masterKey, nil, purposeContentMAC, contentMACKeyLength),
+	}
+}
+
+func (e *contentMACEncryptor) computeMAC(payload gather.Bytes, contentID []byte) []byte {
+	h := hmac.New(sha256.New, e.key)
+	h.Write(contentID) //nolint:errcheck
+
+	if _, err := payload.WriteTo(h); err != nil {
+		panic("unexpected error writing to hash: " + err.Error())
+	}
+
+	return h.Sum(nil)
+}
+
+func (e *contentMACEncryptor) Encrypt(plainText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	return e.encryptWith(e.impl, plainText, contentID, output)
+}
+
+func (e *contentMACEncryptor) EncryptDeterministic(plainText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	impl, err := encryption.Deterministic(e.impl)
+	if err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+
+	return e.encryptWith(impl, plainText, contentID, output)
+}
+
+func (e *contentMACEncryptor) encryptWith(impl encryption.Encryptor, plainText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	if err := impl.Encrypt(plainText, contentID, &tmp); err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+
+	if _, err := tmp.Bytes().WriteTo(output); err != nil {
+		return errors.Wrap(err, "error writing ciphertext")
+	}
+
+	output.Append(e.computeMAC(tmp.Bytes(), contentID))
+
+	return nil
+}
+
+func (e *contentMACEncryptor) Decrypt(cipherText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	l := cipherText.Length()
+	if l < contentMACLength {
+		return errors.Wrap(ErrContentMACMismatch, "content too short")
+	}
+
+	b := cipherText.ToByteSlice()
+	payload, storedMAC := b[0:l-contentMACLength], b[l-contentMACLength:]
+
+	if !hmac.Equal(storedMAC, e.computeMAC(gather.FromSlice(payload), contentID)) {
+		return ErrContentMACMismatch
+	}
+
+	//nolint:wrapcheck
+	return e.impl.Decrypt(gather.FromSlice(payload), contentID, output)
+}
+
+// DecryptSkippingMAC decrypts the provided ciphertext without verifying its MAC, which saves CPU
+// when reading from trusted storage but allows tampered or substituted contents to go undetected
+// unless the underlying encryption is authenticated.
+func (e *contentMACEncryptor) DecryptSkippingMAC(cipherText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	l := cipherText.Length()
+	if l < contentMACLength {
+		return errors.Wrap(ErrContentMACMismatch, "content too short")
+	}
+
+	b := cipherText.ToByteSlice()
+
+	//nolint:wrapcheck
+	return e.impl.Decrypt(gather.FromSlice(b[0:l-contentMACLength]), contentID, output)
+}
+
+func (e *contentMACEncryptor) Overhead() int {
+	return e.impl.Overhead() + contentMACLength
+}
@@ -0,0 +1,136 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/encryption"
+)
+
+// passthroughEncryptor stores plaintext as-is, simulating a format without authenticated encryption.
+type passthroughEncryptor struct{}
+
+func (passthroughEncryptor) Encrypt(plainText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	_, err := plainText.WriteTo(output)
+
+	return err //nolint:wrapcheck
+}
+
+func (passthroughEncryptor) Decrypt(cipherText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	_, err := cipherText.WriteTo(output)
+
+	return err //nolint:wrapcheck
+}
+
+func (passthroughEncryptor) Overhead() int { return 0 }
+
+var _ encryption.Encryptor = passthroughEncryptor{}
+
+func TestContentMACDetectsSubstitution(t *testing.T) {
+	e := newContentMACEncryptor(passthroughEncryptor{}, []byte("master-key"))
+
+	// both payloads are stored under the same ID, as if their truncated hashes collided.
+	contentID := []byte{1, 2, 3, 4}
+
+	var stored gather.WriteBuffer
+	defer stored.Close()
+
+	require.NoError(t, e.Encrypt(gather.FromSlice([]byte("original data")), contentID, &stored))
+	require.Equal(t, len("original data")+e.Overhead(), stored.Length())
+
+	var out gather.WriteBuffer
+	defer out.Close()
+
+	require.NoError(t, e.Decrypt(stored.Bytes(), contentID, &out))
+	require.Equal(t, []byte("original data"), out.ToByteSlice())
+
+	// attacker replaces stored bytes, keeping the original MAC.
+	tampered := stored.ToByteSlice()
+	copy(tampered, "replaced")
+
+	out.Reset()
+	require.True(t, errors.Is(e.Decrypt(gather.FromSlice(tampered), contentID, &out), ErrContentMACMismatch))
+
+	// attacker writes a well-formed block, but without knowledge of the key.
+	attacker := newContentMACEncryptor(passthroughEncryptor{}, []byte("other-key"))
+
+	var forged gather.WriteBuffer
+	defer forged.Close()
+
+	require.NoError(t, attacker.Encrypt(gather.FromSlice([]byte("replaced data")), contentID, &forged))
+
+	out.Reset()
+	require.True(t, errors.Is(e.Decrypt(forged.Bytes(), contentID, &out), ErrContentMACMismatch))
+
+	// MAC is bound to the content ID.
+	out.Reset()
+	require.True(t, errors.Is(e.Decrypt(stored.Bytes(), []byte{5, 6, 7, 8}, &out), ErrContentMACMismatch))
+
+	out.Reset()
+	require.True(t, errors.Is(e.Decrypt(gather.FromSlice([]byte{1, 2}), contentID, &out), ErrContentMACMismatch))
+}
+
+func TestContentMACDecryptSkippingMAC(t *testing.T) {
+	e := newContentMACEncryptor(passthroughEncryptor{}, []byte("master-key"))
+	contentID := []byte{1, 2, 3, 4}
+
+	var stored gather.WriteBuffer
+	defer stored.Close()
+
+	require.NoError(t, e.Encrypt(gather.FromSlice([]byte("hello world")), contentID, &stored))
+
+	// corrupt the MAC only.
+	tampered := stored.ToByteSlice()
+	tampered[len(tampered)-1] ^= 1
+
+	var out gather.WriteBuffer
+	defer out.Close()
+
+	// verification catches tampering.
+	require.True(t, errors.Is(e.Decrypt(gather.FromSlice(tampered), contentID, &out), ErrContentMACMismatch))
+
+	out.Reset()
+	require.NoError(t, e.DecryptSkippingMAC(gather.FromSlice(tampered), contentID, &out))
+	require.Equal(t, []byte("hello world"), out.ToByteSlice())
+}
+
+func BenchmarkContentMACDecrypt(b *testing.B) {
+	impl, err := encryption.CreateEncryptor(&ContentFormat{Encryption: encryption.DefaultAlgorithm, MasterKey: make([]byte, 32)})
+	require.NoError(b, err)
+
+	e := newContentMACEncryptor(impl, make([]byte, 32))
+	contentID := make([]byte, 32)
+
+	var stored gather.WriteBuffer
+	defer stored.Close()
+
+	// 4 MiB
+	require.NoError(b, e.Encrypt(gather.FromSlice(make([]byte, 4<<20)), contentID, &stored))
+
+	for _, tc := range []struct {
+		name    string
+		decrypt func(gather.Bytes, []byte, *gather.WriteBuffer) error
+	}{
+		{"Verify", e.Decrypt},
+		{"SkipVerify", e.DecryptSkippingMAC},
+	} {
+		tc := tc
+
+		b.Run(tc.name, func(b *testing.B) {
+			b.SetBytes(int64(stored.Length()))
+
+			for i := 0; i < b.N; i++ {
+				var out gather.WriteBuffer
+
+				if err := tc.decrypt(stored.Bytes(), contentID, &out); err != nil {
+					b.Fatal(err)
+				}
+
+				out.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package format
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/feature"
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+// KopiaDescriptorBlobID is the identifier of a BLOB that describes repository capabilities and layout
+// to third-party tools. It is stored unencrypted and never contains sensitive information.
+const KopiaDescriptorBlobID = "kopia.descriptor"
+
+// Names of optional repository features reported in RepositoryDescriptor.Features.
+const (
+	DescriptorFeatureHMAC               = "hmac"
+	DescriptorFeatureContentMAC         = "content-mac"
+	DescriptorFeatureHashSalt           = "hash-salt"
+	DescriptorFeatureEnvelopeEncryption = "envelope-encryption"
+	DescriptorFeaturePasswordChange     = "password-change"
+)
+
+// RepositoryDescriptor represents JSON contents of 'kopia.descriptor' blob, which allows tools to
+// discover the format of a repository without knowing its password.
+//
+// The descriptor is written when the repository is initialized and rewritten whenever the repository
+// config changes. It is informational only, the encrypted repository config in 'kopia.repository'
+// remains authoritative.
+type RepositoryDescriptor struct {
+	Tool         string `json:"tool"`
+	BuildVersion string `json:"buildVersion"`
+
+	FormatVersion Version `json:"formatVersion"`
+	IndexVersion  int     `json:"indexVersion"`
+
+	// block (content) format.
+	Hash               string `json:"hash"`
+	Encryption         string `json:"encryption"`
+	ECC                string `json:"ecc,omitempty"`
+	ECCOverheadPercent int    `json:"eccOverheadPercent,omitempty"`
+	MaxPackSize        int    `json:"maxPackSize"`
+
+	// object format.
+	Splitter string `json:"splitter"`
+
+	// algorithms protecting the repository config stored in 'kopia.repository'.
+	MetadataEncryption     string `json:"metadataEncryption"`
+	KeyDerivationAlgorithm string `json:"keyAlgo"`
+
+	Features         []string           `json:"features,omitempty"`
+	RequiredFeatures []feature.Required `json:"requiredFeatures,omitempty"`
+}
+
+// NewRepositoryDescriptor returns the descriptor of a repository with the provided format blob and config.
+func NewRepositoryDescriptor(f *KopiaRepositoryJSON, rc *RepositoryConfig) *RepositoryDescriptor {
+	d := &RepositoryDescriptor{
+		Tool:                   f.Tool,
+		BuildVersion:           f.BuildVersion,
+		FormatVersion:          rc.Version,
+		IndexVersion:           rc.IndexVersion,
+		Hash:                   rc.Hash,
+		Encryption:             rc.Encryption,
+		ECC:                    rc.ECC,
+		ECCOverheadPercent:     rc.ECCOverheadPercent,
+		MaxPackSize:            rc.MaxPackSize,
+		Splitter:               rc.Splitter,
+		MetadataEncryption:     f.EncryptionAlgorithm,
+		KeyDerivationAlgorithm: f.KeyDerivationAlgorithm,
+		RequiredFeatures:       rc.RequiredFeatures,
+	}
+
+	for _, ft := range []struct {
+		name    string
+		enabled bool
+	}{
+		{DescriptorFeatureHMAC, len(rc.HMACSecret) > 0},
+		{DescriptorFeatureContentMAC, rc.ContentMAC},
+		{DescriptorFeatureHashSalt, len(rc.HashSalt) > 0},
+		{DescriptorFeatureEnvelopeEncryption, rc.EnvelopeEncryption},
+		{DescriptorFeaturePasswordChange, rc.EnablePasswordChange},
+	} {
+		if ft.enabled {
+			d.Features = append(d.Features, ft.name)
+		}
+	}
+
+	return d
+}
+
+// HasFeature returns true if the descriptor reports the provided optional feature.
+func (d *RepositoryDescriptor) HasFeature(name string) bool {
+	for _, f := range d.Features {
+		if f == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WriteRepositoryDescriptor writes `kopia.descriptor` blob to a given storage.
+func WriteRepositoryDescriptor(ctx context.Context, st blob.Storage, d *RepositoryDescriptor, blobCfg BlobStorageConfiguration) error {
+	b, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal repository descriptor")
+	}
+
+	if err := st.PutBlob(ctx, KopiaDescriptorBlobID, gather.FromSlice(b), blob.PutOptions{
+		RetentionMode:   blobCfg.RetentionMode,
+		RetentionPeriod: blobCfg.RetentionPeriod,
+	}); err != nil {
+		return errors.Wrapf(err, "PutBlob() failed for %q", KopiaDescriptorBlobID)
+	}
+
+	return nil
+}
+
+// ReadRepositoryDescriptor reads `kopia.descriptor` blob from a given storage, which does not require
+// the repository password. Returns blob.ErrBlobNotFound for repositories created before descriptors were introduced.
+func ReadRepositoryDescriptor(ctx context.Context, st blob.Reader) (*RepositoryDescriptor, error) {
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	if err := st.GetBlob(ctx, KopiaDescriptorBlobID, 0, -1, &tmp); err != nil {
+		return nil, errors.Wrapf(err, "error reading %q", KopiaDescriptorBlobID)
+	}
+
+	d := &RepositoryDescriptor{}
+	if err := json.NewDecoder(tmp.Bytes().Reader()).Decode(d); err != nil {
+		return nil, errors.Wrap(err, "invalid repository descriptor")
+	}
+
+	return d, nil
+}
@@ -11,10 +11,24 @@ type encryptorWrapper struct {
 }
 
 func (p *encryptorWrapper) Encrypt(plainText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	return p.encryptWith(p.impl, plainText, contentID, output)
+}
+
+func (p *encryptorWrapper) EncryptDeterministic(plainText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	impl, err := encryption.Deterministic(p.impl)
+	if err != nil {
+		//nolint:wrapcheck
+		return err
+	}
+
+	return p.encryptWith(impl, plainText, contentID, output)
+}
+
+func (p *encryptorWrapper) encryptWith(impl encryption.Encryptor, plainText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
 	var tmp gather.WriteBuffer
 	defer tmp.Close()
 
-	if err := p.impl.Encrypt(plainText, contentID, &tmp); err != nil {
+	if err := impl.Encrypt(plainText, contentID, &tmp); err != nil {
 		//nolint:wrapcheck
 		return err
 	}
@@ -0,0 +1,262 @@
+package format
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+)
+
+const (
+	envelopeVersion       = 1
+	envelopeKeyLength     = 32
+	envelopeKeyIDLength   = 8
+	envelopeNonceLength   = 12
+	envelopeTagLength     = 16
+	envelopeWrappedLength = envelopeNonceLength + envelopeKeyLength + envelopeTagLength
+	envelopeHeaderLength  = 1 + envelopeKeyIDLength + envelopeWrappedLength
+	envelopeOverhead      = envelopeHeaderLength + envelopeNonceLength + envelopeTagLength
+)
+
+//nolint:gochecknoglobals
+var purposeEnvelopeKEK = []byte("envelope-kek")
+
+// ErrEnvelopeKeyNotFound is returned when an item was encrypted with a data key wrapped by an unknown master key.
+var ErrEnvelopeKeyNotFound = errors.New("envelope key-encryption key not found")
+
+// ErrEnvelopeEncryptionNotEnabled is returned when rewrapping keys of a repository without envelope encryption.
+var ErrEnvelopeEncryptionNotEnabled = errors.New("envelope encryption is not enabled")
+
+// EnvelopeEncryptor implements envelope encryption, where each item is encrypted using a random
+// data key, which is stored alongside the item, wrapped by a key-encryption key derived from the master key.
+//
+// Rotating the master key using RewrapKeys() keeps the previous key-encryption keys available for
+// decryption, so items can be migrated by rewrapping their data keys using Rewrap() without
+// re-encrypting their payload.
+type EnvelopeEncryptor struct {
+	mu sync.RWMutex
+	// +checklocks:mu
+	currentKeyID string
+	// +checklocks:mu
+	keys map[string]cipher.AEAD // key-encryption keys by ID
+}
+
+// NewEnvelopeEncryptor returns new envelope encryptor wrapping data keys using the provided master key.
+func NewEnvelopeEncryptor(masterKey []byte) (*EnvelopeEncryptor, error) {
+	e := &EnvelopeEncryptor{
+		keys: map[string]cipher.AEAD{},
+	}
+
+	if err := e.RewrapKeys(masterKey); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func newEnvelopeAEAD(key []byte) (cipher.AEAD, error) {
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create AES cipher")
+	}
+
+	//nolint:wrapcheck
+	return cipher.NewGCM(c)
+}
+
+// envelopeKeyID returns the identifier of a key-encryption key stored in the header of each item.
+func envelopeKeyID(kek []byte) string {
+	h := hmac.New(sha256.New, kek)
+	h.Write([]byte("key-id")) //nolint:errcheck
+
+	return string(h.Sum(nil)[0:envelopeKeyIDLength])
+}
+
+// RewrapKeys makes the key-encryption key derived from the provided master key current for all
+// subsequently encrypted or rewrapped items. Previously-used keys remain available for decryption.
+func (e *EnvelopeEncryptor) RewrapKeys(newMasterKey []byte) error {
+	if len(newMasterKey) == 0 {
+		return errors.New("master key is required")
+	}
+
+	kek := DeriveKeyFromMasterKey(newMasterKey, nil, purposeEnvelopeKEK, envelopeKeyLength)
+
+	aead, err := newEnvelopeAEAD(kek)
+	if err != nil {
+		return errors.Wrap(err, "unable to initialize key-encryption key")
+	}
+
+	keyID := envelopeKeyID(kek)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.keys[keyID] = aead
+	e.currentKeyID = keyID
+
+	return nil
+}
+
+func (e *EnvelopeEncryptor) currentKey() (string, cipher.AEAD) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.currentKeyID, e.keys[e.currentKeyID]
+}
+
+func (e *EnvelopeEncryptor) keyByID(keyID string) (cipher.AEAD, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	k := e.keys[keyID]
+	if k == nil {
+		return nil, ErrEnvelopeKeyNotFound
+	}
+
+	return k, nil
+}
+
+// wrapKey appends the header with the data key wrapped using the current key-encryption key to the output.
+func (e *EnvelopeEncryptor) wrapKey(output, dataKey, contentID []byte) ([]byte, error) {
+	keyID, kek := e.currentKey()
+
+	output = append(output, envelopeVersion)
+	output = append(output, keyID...)
+
+	nonce, err := randomNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	output = append(output, nonce...)
+
+	return kek.Seal(output, nonce, dataKey, contentID), nil
+}
+
+// unwrapKey returns the data key stored in the provided item header.
+func (e *EnvelopeEncryptor) unwrapKey(header, contentID []byte) ([]byte, error) {
+	if header[0] != envelopeVersion {
+		return nil, errors.Errorf("unsupported envelope version %v", header[0])
+	}
+
+	kek, err := e.keyByID(string(header[1 : 1+envelopeKeyIDLength]))
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped := header[1+envelopeKeyIDLength:]
+
+	dataKey, err := kek.Open(nil, wrapped[0:envelopeNonceLength], wrapped[envelopeNonceLength:], contentID)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to unwrap data key")
+	}
+
+	return dataKey, nil
+}
+
+func randomNonce() ([]byte, error) {
+	nonce := make([]byte, envelopeNonceLength)
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "unable to generate nonce")
+	}
+
+	return nonce, nil
+}
+
+// Encrypt implements encryption.Encryptor.
+func (e *EnvelopeEncryptor) Encrypt(plainText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	dataKey := make([]byte, envelopeKeyLength)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return errors.Wrap(err, "unable to generate data key")
+	}
+
+	aead, err := newEnvelopeAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	result := make([]byte, 0, plainText.Length()+envelopeOverhead)
+
+	result, err = e.wrapKey(result, dataKey, contentID)
+	if err != nil {
+		return err
+	}
+
+	nonce, err := randomNonce()
+	if err != nil {
+		return err
+	}
+
+	result = append(result, nonce...)
+	result = aead.Seal(result, nonce, plainText.ToByteSlice(), contentID)
+
+	output.Append(result)
+
+	return nil
+}
+
+// Decrypt implements encryption.Encryptor.
+func (e *EnvelopeEncryptor) Decrypt(cipherText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	b := cipherText.ToByteSlice()
+	if len(b) < envelopeOverhead {
+		return errors.New("envelope too short")
+	}
+
+	dataKey, err := e.unwrapKey(b[0:envelopeHeaderLength], contentID)
+	if err != nil {
+		return err
+	}
+
+	aead, err := newEnvelopeAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	payload := b[envelopeHeaderLength:]
+
+	plainText, err := aead.Open(nil, payload[0:envelopeNonceLength], payload[envelopeNonceLength:], contentID)
+	if err != nil {
+		return errors.Wrap(err, "unable to decrypt payload")
+	}
+
+	output.Append(plainText)
+
+	return nil
+}
+
+// Rewrap writes the provided encrypted item to the output with its data key rewrapped using
+// the current key-encryption key. The encrypted payload is copied unchanged.
+func (e *EnvelopeEncryptor) Rewrap(cipherText gather.Bytes, contentID []byte, output *gather.WriteBuffer) error {
+	b := cipherText.ToByteSlice()
+	if len(b) < envelopeOverhead {
+		return errors.New("envelope too short")
+	}
+
+	dataKey, err := e.unwrapKey(b[0:envelopeHeaderLength], contentID)
+	if err != nil {
+		return err
+	}
+
+	result, err := e.wrapKey(make([]byte, 0, len(b)), dataKey, contentID)
+	if err != nil {
+		return err
+	}
+
+	output.Append(result)
+	output.Append(b[envelopeHeaderLength:])
+
+	return nil
+}
+
+// Overhead implements encryption.Encryptor.
+func (e *EnvelopeEncryptor) Overhead() int {
+	return envelopeOverhead
+}
@@ -0,0 +1,149 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/gather"
+)
+
+func envelopeEncrypt(t *testing.T, e *EnvelopeEncryptor, plainText string, contentID []byte) []byte {
+	t.Helper()
+
+	var out gather.WriteBuffer
+	defer out.Close()
+
+	require.NoError(t, e.Encrypt(gather.FromSlice([]byte(plainText)), contentID, &out))
+	require.Equal(t, len(plainText)+e.Overhead(), out.Length())
+
+	return out.ToByteSlice()
+}
+
+func envelopeDecrypt(e *EnvelopeEncryptor, cipherText, contentID []byte) (string, error) {
+	var out gather.WriteBuffer
+	defer out.Close()
+
+	err := e.Decrypt(gather.FromSlice(cipherText), contentID, &out)
+
+	return string(out.ToByteSlice()), err
+}
+
+func TestEnvelopeEncryptorRewrapKeys(t *testing.T) {
+	oldMaster := []byte("old-master-key")
+	newMaster := []byte("new-master-key")
+	contentID := []byte{1, 2, 3, 4}
+
+	e, err := NewEnvelopeEncryptor(oldMaster)
+	require.NoError(t, err)
+
+	before := envelopeEncrypt(t, e, "written before rotation", contentID)
+	before2 := envelopeEncrypt(t, e, "written before rotation", contentID)
+
+	// each item gets its own random data key.
+	require.NotEqual(t, before, before2)
+
+	require.NoError(t, e.RewrapKeys(newMaster))
+
+	after := envelopeEncrypt(t, e, "written after rotation", contentID)
+
+	// both old and new items decrypt with multiple keys available.
+	got, err := envelopeDecrypt(e, before, contentID)
+	require.NoError(t, err)
+	require.Equal(t, "written before rotation", got)
+
+	got, err = envelopeDecrypt(e, after, contentID)
+	require.NoError(t, err)
+	require.Equal(t, "written after rotation", got)
+
+	// encryptor knowing only the new master key can't decrypt items which have not been rewrapped.
+	e2, err := NewEnvelopeEncryptor(newMaster)
+	require.NoError(t, err)
+
+	_, err = envelopeDecrypt(e2, before, contentID)
+	require.ErrorIs(t, err, ErrEnvelopeKeyNotFound)
+
+	got, err = envelopeDecrypt(e2, after, contentID)
+	require.NoError(t, err)
+	require.Equal(t, "written after rotation", got)
+
+	// rewrap the item written before rotation, which leaves the encrypted payload unchanged.
+	var rewrapped gather.WriteBuffer
+	defer rewrapped.Close()
+
+	require.NoError(t, e.Rewrap(gather.FromSlice(before), contentID, &rewrapped))
+	require.Equal(t, before[envelopeHeaderLength:], rewrapped.ToByteSlice()[envelopeHeaderLength:])
+
+	got, err = envelopeDecrypt(e2, rewrapped.ToByteSlice(), contentID)
+	require.NoError(t, err)
+	require.Equal(t, "written before rotation", got)
+
+	// old master key alone can no longer decrypt the rewrapped item.
+	e3, err := NewEnvelopeEncryptor(oldMaster)
+	require.NoError(t, err)
+
+	_, err = envelopeDecrypt(e3, rewrapped.ToByteSlice(), contentID)
+	require.ErrorIs(t, err, ErrEnvelopeKeyNotFound)
+}
+
+func TestEnvelopeEncryptorDetectsTampering(t *testing.T) {
+	contentID := []byte{1, 2, 3, 4}
+
+	e, err := NewEnvelopeEncryptor([]byte("master-key"))
+	require.NoError(t, err)
+
+	ct := envelopeEncrypt(t, e, "some data", contentID)
+
+	// wrong content ID.
+	_, err = envelopeDecrypt(e, ct, []byte{5, 6, 7, 8})
+	require.Error(t, err)
+
+	// corrupted wrapped key and payload.
+	for _, pos := range []int{envelopeHeaderLength - 1, len(ct) - 1} {
+		tampered := append([]byte(nil), ct...)
+		tampered[pos] ^= 1
+
+		_, err = envelopeDecrypt(e, tampered, contentID)
+		require.Error(t, err)
+	}
+
+	_, err = envelopeDecrypt(e, ct[0:envelopeOverhead-1], contentID)
+	require.Error(t, err)
+}
+
+func TestFormatProviderEnvelopeEncryption(t *testing.T) {
+	f := &ContentFormat{
+		Hash:               "HMAC-SHA256",
+		Encryption:         "AES256-GCM-HMAC-SHA256",
+		HMACSecret:         []byte("secret"),
+		MasterKey:          make([]byte, 32),
+		EnvelopeEncryption: true,
+		MutableParameters: MutableParameters{
+			Version: FormatVersion2,
+		},
+	}
+
+	p, err := NewFormattingOptionsProvider(f, nil)
+	require.NoError(t, err)
+
+	e, ok := p.Encryptor().(*EnvelopeEncryptor)
+	require.True(t, ok)
+
+	contentID := []byte{1, 2, 3, 4}
+	ct := envelopeEncrypt(t, e, "some data", contentID)
+
+	//nolint:forcetypeassert
+	require.NoError(t, p.(*formattingOptionsProvider).RewrapKeys([]byte("new-master-key")))
+
+	got, err := envelopeDecrypt(e, ct, contentID)
+	require.NoError(t, err)
+	require.Equal(t, "some data", got)
+
+	f.EnvelopeEncryption = false
+
+	p, err = NewFormattingOptionsProvider(f, nil)
+	require.NoError(t, err)
+
+	//nolint:forcetypeassert
+	require.ErrorIs(t, p.(*formattingOptionsProvider).RewrapKeys([]byte("new-master-key")), ErrEnvelopeEncryptionNotEnabled)
+}
@@ -6,8 +6,8 @@
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
-	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/json"
 	"io"
 
@@ -32,13 +32,34 @@
 // KopiaRepositoryBlobID is the identifier of a BLOB that describes repository format.
 const KopiaRepositoryBlobID = "kopia.repository"
 
+// KopiaRepositorySecondaryBlobID is the identifier of a BLOB that holds redundant copy of the format BLOB.
+const KopiaRepositorySecondaryBlobID = "kopia.repository.secondary"
+
+// ErrReservedName is returned when a name reserved for repository format blobs is used for another purpose.
+var ErrReservedName = errors.New("reserved name")
+
+// IsReservedBlobID returns true if the provided blob ID is reserved for repository format blobs.
+func IsReservedBlobID(id blob.ID) bool {
+	switch id {
+	case KopiaRepositoryBlobID, KopiaRepositorySecondaryBlobID, KopiaBlobCfgBlobID, KopiaDescriptorBlobID:
+		return true
+	default:
+		return false
+	}
+}
+
 // ErrInvalidPassword is returned when repository password is invalid.
 var ErrInvalidPassword = errors.Errorf("invalid repository password") // +checklocksignore
 
+// ErrFormatBlobIntegrity is returned when the integrity checksum of the format blob does not match its contents.
+var ErrFormatBlobIntegrity = errors.Errorf("format blob integrity check failed") // +checklocksignore
+
 //nolint:gochecknoglobals
 var (
-	purposeAESKey   = []byte("AES")
-	purposeAuthData = []byte("CHECKSUM")
+	purposeAESKey          = []byte("AES")
+	purposeAuthData        = []byte("CHECKSUM")
+	purposeFormatIntegrity = []byte("format-integrity")
+	purposeFormatKeyCheck  = []byte("format-key-check")
 
 	// formatBlobChecksumSecret is a HMAC secret used for checksumming the format content.
 	// It's not really a secret, but will provide positive identification of blocks that
@@ -60,6 +81,13 @@ type KopiaRepositoryJSON struct {
 	EncryptionAlgorithm string `json:"encryption"`
 	// encrypted, serialized JSON encryptedRepositoryConfig{}
 	EncryptedFormatBytes []byte `json:"encryptedBlockFormat,omitempty"`
+
+	// KeyCheck identifies the format encryption key, which allows telling a wrong password from a corrupted
+	// format blob when Checksum doesn't match.
+	KeyCheck []byte `json:"keyCheck,omitempty"`
+
+	// keyed integrity checksum of the fields above, absent in blobs written by older versions.
+	Checksum []byte `json:"checksum,omitempty"`
 }
 
 // ParseKopiaRepositoryJSON parses the provided byte slice into KopiaRepositoryJSON.
@@ -73,6 +101,73 @@ func ParseKopiaRepositoryJSON(b []byte) (*KopiaRepositoryJSON, error) {
 	return f, nil
 }
 
+// formatKeyCheck returns the value stored in KeyCheck for the provided format encryption key.
+func formatKeyCheck(formatEncryptionKey, uniqueID []byte) []byte {
+	return hmac.New(sha256.New, DeriveKeyFromMasterKey(formatEncryptionKey, uniqueID, purposeFormatKeyCheck, sha256.Size)).Sum(nil)
+}
+
+// computeChecksum computes the checksum of the format blob fields that are essential to open the repository.
+// The checksum is keyed by the format encryption key, so it can't be forged without knowing the password.
+func (f *KopiaRepositoryJSON) computeChecksum(formatEncryptionKey []byte) []byte {
+	h := hmac.New(sha256.New, DeriveKeyFromMasterKey(formatEncryptionKey, f.UniqueID, purposeFormatIntegrity, sha256.Size))
+
+	for _, v := range [][]byte{
+		f.UniqueID,
+		[]byte(f.KeyDerivationAlgorithm),
+		[]byte(f.EncryptionAlgorithm),
+		f.EncryptedFormatBytes,
+		f.KeyCheck,
+	} {
+		var l [8]byte
+
+		binary.LittleEndian.PutUint64(l[:], uint64(len(v)))
+		h.Write(l[:])
+		h.Write(v)
+	}
+
+	return h.Sum(nil)
+}
+
+func (f *KopiaRepositoryJSON) setChecksum(formatEncryptionKey []byte) {
+	f.KeyCheck = formatKeyCheck(formatEncryptionKey, f.UniqueID)
+	f.Checksum = f.computeChecksum(formatEncryptionKey)
+}
+
+// verifyChecksum verifies the checksum using the provided format encryption key, it returns ErrInvalidPassword
+// if the key is not the one used to compute the checksum.
+func (f *KopiaRepositoryJSON) verifyChecksum(formatEncryptionKey []byte) error {
+	if len(f.Checksum) == 0 {
+		return nil
+	}
+
+	if hmac.Equal(f.Checksum, f.computeChecksum(formatEncryptionKey)) {
+		return nil
+	}
+
+	if !hmac.Equal(f.KeyCheck, formatKeyCheck(formatEncryptionKey, f.UniqueID)) {
+		return ErrInvalidPassword
+	}
+
+	return errors.Wrapf(ErrFormatBlobIntegrity, "the format blob is corrupted, it can be restored from %v using 'kopia repository repair'", KopiaRepositorySecondaryBlobID)
+}
+
+// VerifyKopiaRepositoryBlob verifies that the provided format blob is intact and can be opened using the provided password.
+func VerifyKopiaRepositoryBlob(b []byte, password string) error {
+	f, err := ParseKopiaRepositoryJSON(b)
+	if err != nil {
+		return err
+	}
+
+	key, err := f.DeriveFormatEncryptionKeyFromPassword(password)
+	if err != nil {
+		return errors.Wrap(err, "unable to derive format encryption key")
+	}
+
+	_, err = f.decryptRepositoryConfig(key)
+
+	return err
+}
+
 // RecoverFormatBlob attempts to recover format blob replica from the specified file.
 // The format blob can be either the prefix or a suffix of the given file.
 // optionally the length can be provided (if known) to speed up recovery.
@@ -165,8 +260,13 @@ func verifyFormatBlobChecksum(b []byte) ([]byte, bool) {
 	return data, true
 }
 
-// WriteKopiaRepositoryBlob writes `kopia.repository` blob to a given storage.
+// WriteKopiaRepositoryBlob writes `kopia.repository` blob to a given storage, along with its secondary copy.
+// The secondary copy is written first, so that it's never older than the primary.
 func (f *KopiaRepositoryJSON) WriteKopiaRepositoryBlob(ctx context.Context, st blob.Storage, blobCfg BlobStorageConfiguration) error {
+	if err := f.WriteKopiaRepositoryBlobWithID(ctx, st, blobCfg, KopiaRepositorySecondaryBlobID); err != nil {
+		return err
+	}
+
 	return f.WriteKopiaRepositoryBlobWithID(ctx, st, blobCfg, KopiaRepositoryBlobID)
 }
 
@@ -190,6 +290,41 @@ func (f *KopiaRepositoryJSON) WriteKopiaRepositoryBlobWithID(ctx context.Context
 	return nil
 }
 
+// RestoreKopiaRepositoryBlobFromSecondary replaces `kopia.repository` blob with its secondary copy after verifying
+// its integrity using the provided password. The blob is written with the retention settings of the repository.
+func RestoreKopiaRepositoryBlobFromSecondary(ctx context.Context, st blob.Storage, password string) error {
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	if err := st.GetBlob(ctx, KopiaRepositorySecondaryBlobID, 0, -1, &tmp); err != nil {
+		return errors.Wrap(err, "unable to read secondary copy of format blob")
+	}
+
+	f, err := ParseKopiaRepositoryJSON(tmp.ToByteSlice())
+	if err != nil {
+		return errors.Wrap(err, "invalid secondary copy of format blob")
+	}
+
+	key, err := f.DeriveFormatEncryptionKeyFromPassword(password)
+	if err != nil {
+		return errors.Wrap(err, "unable to derive format encryption key")
+	}
+
+	if _, err = f.decryptRepositoryConfig(key); err != nil {
+		return errors.Wrap(err, "invalid secondary copy of format blob")
+	}
+
+	blobCfg, err := readBlobCfgBlob(ctx, st, f, key)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(st.PutBlob(ctx, KopiaRepositoryBlobID, tmp.Bytes(), blob.PutOptions{
+		RetentionMode:   blobCfg.RetentionMode,
+		RetentionPeriod: blobCfg.RetentionPeriod,
+	}), "unable to write format blob")
+}
+
 func initCrypto(masterKey, repositoryID []byte) (cipher.AEAD, []byte, error) {
 	aesKey := DeriveKeyFromMasterKey(masterKey, repositoryID, purposeAESKey, 32)     //nolint:gomnd
 	authData := DeriveKeyFromMasterKey(masterKey, repositoryID, purposeAuthData, 32) //nolint:gomnd
@@ -207,7 +342,7 @@ func initCrypto(masterKey, repositoryID []byte) (cipher.AEAD, []byte, error) {
 	return aead, authData, nil
 }
 
-func encryptRepositoryBlobBytesAes256Gcm(data, masterKey, repositoryID []byte) ([]byte, error) {
+func encryptRepositoryBlobBytesAes256Gcm(data, masterKey, repositoryID []byte, nonceSource io.Reader) ([]byte, error) {
 	aead, authData, err := initCrypto(masterKey, repositoryID)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to initialize crypto")
@@ -219,7 +354,7 @@ func encryptRepositoryBlobBytesAes256Gcm(data, masterKey, repositoryID []byte) (
 
 	// Store nonce at the beginning of ciphertext.
 	nonce := cipherText[0:nonceLength]
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+	if _, err := io.ReadFull(nonceSource, nonce); err != nil {
 		return nil, errors.Wrap(err, "error reading random bytes for nonce")
 	}
 
@@ -243,9 +378,10 @@ func decryptRepositoryBlobBytesAes256Gcm(data, masterKey, repositoryID []byte) (
 	nonce := data[0:aead.NonceSize()]
 	payload := data[aead.NonceSize():]
 
+	// the authentication tag only verifies with the key derived from the right password.
 	plainText, err := aead.Open(payload[:0], nonce, payload, authData)
 	if err != nil {
-		return nil, errors.Errorf("unable to decrypt repository blob, invalid credentials?")
+		return nil, errors.Wrap(ErrInvalidPassword, "unable to decrypt repository blob")
 	}
 
 	return plainText, nil
@@ -1,11 +1,14 @@
 package format
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"encoding/hex"
 	"reflect"
 	"testing"
 
 	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
 
 	"github.com/kopia/kopia/internal/blobtesting"
 	"github.com/kopia/kopia/internal/gather"
@@ -13,6 +16,30 @@
 	"github.com/kopia/kopia/repo/blob"
 )
 
+func TestUnsupportedFormat(t *testing.T) {
+	for _, f := range []*ContentFormat{
+		{MutableParameters: MutableParameters{Version: 0}},
+		{MutableParameters: MutableParameters{Version: MaxFormatVersion + 1}},
+		{MutableParameters: MutableParameters{Version: FormatVersion2, IndexVersion: -1}},
+		{MutableParameters: MutableParameters{Version: FormatVersion2, IndexVersion: 100}},
+	} {
+		_, err := NewFormattingOptionsProvider(f, nil)
+		require.ErrorIs(t, err, ErrFormatUnsupported, "%+v", f.MutableParameters)
+	}
+
+	require.ErrorIs(t, errors.Wrap(NewerVersionRequiredError{"some-format"}, "wrapped"), ErrFormatUnsupported)
+}
+
+func TestReservedBlobID(t *testing.T) {
+	for _, id := range []blob.ID{KopiaRepositoryBlobID, KopiaRepositorySecondaryBlobID, KopiaBlobCfgBlobID} {
+		require.True(t, IsReservedBlobID(id), id)
+	}
+
+	for _, id := range []blob.ID{"", "kopia.repository2", "p1234", "xn0_abcdef"} {
+		require.False(t, IsReservedBlobID(id), id)
+	}
+}
+
 func TestFormatBlobRecovery(t *testing.T) {
 	data := blobtesting.DataMap{}
 	st := blobtesting.NewMapStorage(data, nil, nil)
@@ -77,6 +104,25 @@ func TestFormatBlobRecovery(t *testing.T) {
 	}
 }
 
+func TestEncryptRepositoryBlobBytesWithFixedNonce(t *testing.T) {
+	masterKey := bytes.Repeat([]byte{1}, 32)
+	uniqueID := bytes.Repeat([]byte{2}, 32)
+	plainText := []byte("hello, world")
+
+	// with a fixed nonce source the ciphertext is stable.
+	encrypted, err := encryptRepositoryBlobBytesAes256Gcm(plainText, masterKey, uniqueID, bytes.NewReader(make([]byte, 12)))
+	require.NoError(t, err)
+	require.Equal(t, "000000000000000000000000aa830facf15b12f6db80ad2005fceaf565b12037b02ee17f1033720e", hex.EncodeToString(encrypted))
+
+	decrypted, err := decryptRepositoryBlobBytesAes256Gcm(encrypted, masterKey, uniqueID)
+	require.NoError(t, err)
+	require.Equal(t, plainText, decrypted)
+
+	// a different key fails authentication, which is reported as an invalid password.
+	_, err = decryptRepositoryBlobBytesAes256Gcm(encrypted, bytes.Repeat([]byte{3}, 32), uniqueID)
+	require.ErrorIs(t, err, ErrInvalidPassword)
+}
+
 func assertNoError(t *testing.T, err error) {
 	t.Helper()
 
@@ -8,6 +8,30 @@
 	"github.com/kopia/kopia/repo/blob"
 )
 
+// VerifyPassword returns ErrInvalidPassword if the provided password can't be used to decrypt the
+// repository format, which is the case unless it's the current repository password.
+func (m *Manager) VerifyPassword(password string) error {
+	if err := m.maybeRefreshNotLocked(); err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	j := m.j
+	m.mu.RUnlock()
+
+	key, err := j.DeriveFormatEncryptionKeyFromPassword(password)
+	if err != nil {
+		return errors.Wrap(err, "unable to derive master key")
+	}
+
+	_, err = j.decryptRepositoryConfig(key)
+	if errors.Is(err, ErrInvalidPassword) {
+		return ErrInvalidPassword
+	}
+
+	return errors.Wrap(err, "unable to decrypt repository config")
+}
+
 // ChangePassword changes the repository password and rewrites
 // `kopia.repository` & `kopia.blobcfg`.
 func (m *Manager) ChangePassword(ctx context.Context, newPassword string) error {
@@ -26,11 +50,11 @@ func (m *Manager) ChangePassword(ctx context.Context, newPassword string) error
 	m.formatEncryptionKey = newFormatEncryptionKey
 	m.password = newPassword
 
-	if err := m.j.EncryptRepositoryConfig(m.repoConfig, newFormatEncryptionKey); err != nil {
+	if err := m.j.encryptRepositoryConfig(m.repoConfig, newFormatEncryptionKey, m.nonceSource); err != nil {
 		return errors.Wrap(err, "unable to encrypt format bytes")
 	}
 
-	if err := m.j.WriteBlobCfgBlob(ctx, m.blobs, m.blobCfgBlob, newFormatEncryptionKey); err != nil {
+	if err := m.j.writeBlobCfgBlob(ctx, m.blobs, m.blobCfgBlob, newFormatEncryptionKey, m.nonceSource); err != nil {
 		return errors.Wrap(err, "unable to write blobcfg blob")
 	}
 
@@ -40,5 +64,5 @@ func (m *Manager) ChangePassword(ctx context.Context, newPassword string) error
 
 	m.cache.Remove(ctx, []blob.ID{KopiaRepositoryBlobID, KopiaBlobCfgBlobID})
 
-	return nil
+	return m.writeRepositoryDescriptorLocked(ctx, m.blobCfgBlob)
 }
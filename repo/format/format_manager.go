@@ -37,6 +37,9 @@ type Manager struct {
 
 	timeNow func() time.Time // +checklocksignore
 
+	// source of nonces used when encrypting format blobs, always defaultNonceSource except in tests.
+	nonceSource io.Reader // +checklocksignore
+
 	// all the stuff protected by a mutex is valid until `validUntil`
 	mu sync.RWMutex
 	// +checklocks:mu
@@ -111,6 +114,13 @@ func (m *Manager) readAndCacheRepositoryBlobBytes(ctx context.Context, blobID bl
 	return data, mtime, errors.Wrapf(err, "error adding %s blob", blobID)
 }
 
+// SetNonceSourceForTesting replaces the source of randomness used to generate nonces when encrypting
+// format blobs, which makes the ciphertext reproducible. The provided source is not checked for
+// nonce reuse, so it must only be used in tests.
+func (m *Manager) SetNonceSourceForTesting(r io.Reader) {
+	m.nonceSource = r
+}
+
 // ValidCacheDuration returns the duration for which each blob in the cache is valid.
 func (m *Manager) ValidCacheDuration() time.Duration {
 	return m.validDuration
@@ -158,9 +168,13 @@ func (m *Manager) refresh(ctx context.Context) error {
 		}
 
 		repoConfig, err = j.decryptRepositoryConfig(formatEncryptionKey)
-		if err != nil {
+		if errors.Is(err, ErrInvalidPassword) {
 			return ErrInvalidPassword
 		}
+
+		if err != nil {
+			return errors.Wrap(err, "unable to decrypt repository config")
+		}
 	}
 
 	var blobCfg BlobStorageConfiguration
@@ -193,6 +207,11 @@ func (m *Manager) refresh(ctx context.Context) error {
 	if m.immutable == nil {
 		// on first refresh, set `immutable``
 		m.immutable = prov
+	} else if repoConfig.EnvelopeEncryption {
+		// pick up envelope master keys rotated by other clients.
+		if err := addEnvelopeMasterKeys(m.immutable, repoConfig.EnvelopeMasterKeys); err != nil {
+			return errors.Wrap(err, "unable to add envelope master keys")
+		}
 	}
 
 	m.refreshCounter++
@@ -235,6 +254,51 @@ func (m *Manager) Encryptor() encryption.Encryptor {
 	return m.immutable.Encryptor()
 }
 
+// RewrapKeys makes the provided master key current for wrapping data keys of envelope-encrypted items,
+// while keeping previous master keys available for decryption of existing items. The new key is
+// persisted in the repository config, so that other clients pick it up on their next refresh.
+func (m *Manager) RewrapKeys(ctx context.Context, newMasterKey []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.repoConfig.EnvelopeEncryption {
+		return ErrEnvelopeEncryptionNotEnabled
+	}
+
+	if len(newMasterKey) == 0 {
+		return errors.New("master key is required")
+	}
+
+	oldKeys := m.repoConfig.EnvelopeMasterKeys
+	m.repoConfig.EnvelopeMasterKeys = append(append([][]byte(nil), oldKeys...), newMasterKey)
+
+	if err := m.updateRepoConfigLocked(ctx); err != nil {
+		m.repoConfig.EnvelopeMasterKeys = oldKeys
+
+		return err
+	}
+
+	return addEnvelopeMasterKeys(m.immutable, [][]byte{newMasterKey})
+}
+
+// addEnvelopeMasterKeys makes the provided master keys available to the envelope encryptor of the provider, in order.
+func addEnvelopeMasterKeys(p Provider, keys [][]byte) error {
+	r, ok := p.(interface {
+		RewrapKeys(newMasterKey []byte) error
+	})
+	if !ok {
+		return ErrEnvelopeEncryptionNotEnabled
+	}
+
+	for _, k := range keys {
+		if err := r.RewrapKeys(k); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // GetMasterKey gets the master key.
 func (m *Manager) GetMasterKey() []byte {
 	return m.immutable.GetMasterKey()
@@ -304,7 +368,7 @@ func (m *Manager) LoadedTime() time.Time {
 // updateRepoConfigLocked updates repository config and rewrites kopia.repository blob.
 // +checklocks:m.mu
 func (m *Manager) updateRepoConfigLocked(ctx context.Context) error {
-	if err := m.j.EncryptRepositoryConfig(m.repoConfig, m.formatEncryptionKey); err != nil {
+	if err := m.j.encryptRepositoryConfig(m.repoConfig, m.formatEncryptionKey, m.nonceSource); err != nil {
 		return errors.Errorf("unable to encrypt format bytes")
 	}
 
@@ -314,6 +378,16 @@ func (m *Manager) updateRepoConfigLocked(ctx context.Context) error {
 
 	m.cache.Remove(ctx, []blob.ID{KopiaRepositoryBlobID})
 
+	return m.writeRepositoryDescriptorLocked(ctx, m.blobCfgBlob)
+}
+
+// writeRepositoryDescriptorLocked rewrites kopia.descriptor blob to reflect the current repository config.
+// +checklocks:m.mu
+func (m *Manager) writeRepositoryDescriptorLocked(ctx context.Context, blobcfg BlobStorageConfiguration) error {
+	if err := WriteRepositoryDescriptor(ctx, m.blobs, NewRepositoryDescriptor(m.j, m.repoConfig), blobcfg); err != nil {
+		return errors.Wrap(err, "unable to write repository descriptor")
+	}
+
 	return nil
 }
 
@@ -408,6 +482,7 @@ func NewManagerWithCache(
 		password:                  password,
 		cache:                     cache,
 		timeNow:                   timeNow,
+		nonceSource:               defaultNonceSource,
 		ignoreCacheOnFirstRefresh: ignoreCacheOnFirstRefresh,
 	}
 
@@ -476,6 +551,11 @@ func Initialize(ctx context.Context, st blob.Storage, formatBlob *KopiaRepositor
 		return errors.Wrap(err, "unable to write blobcfg blob")
 	}
 
+	// the descriptor is written before the format blob, whose presence marks the repository as initialized.
+	if err := WriteRepositoryDescriptor(ctx, st, NewRepositoryDescriptor(formatBlob, repoConfig), blobcfg); err != nil {
+		return errors.Wrap(err, "unable to write repository descriptor")
+	}
+
 	if err := formatBlob.WriteKopiaRepositoryBlob(ctx, st, blobcfg); err != nil {
 		return errors.Wrap(err, "unable to write format blob")
 	}
@@ -196,8 +196,14 @@ func TestChangePassword(t *testing.T) {
 	mgr2, err := format.NewManagerWithCache(ctx, fst, cacheDuration, "some-password", nowFunc, cache)
 	require.NoError(t, err)
 
+	require.NoError(t, mgr2.VerifyPassword("some-password"))
+	require.ErrorIs(t, mgr2.VerifyPassword("wrong-password"), format.ErrInvalidPassword)
+
 	require.NoError(t, mgr2.ChangePassword(ctx, "new-password"))
 
+	require.NoError(t, mgr2.VerifyPassword("new-password"))
+	require.ErrorIs(t, mgr2.VerifyPassword("some-password"), format.ErrInvalidPassword)
+
 	// immediately after changing the password, both managers can still read the repo
 	mustGetMutableParameters(t, mgr)
 	mustGetMutableParameters(t, mgr2)
@@ -211,6 +217,35 @@ func TestChangePassword(t *testing.T) {
 	require.ErrorIs(t, err, format.ErrInvalidPassword)
 }
 
+func TestFormatManagerDeterministicNonceSource(t *testing.T) {
+	ctx := testlogging.Context(t)
+	nowFunc := faketime.Frozen(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	uniqueID := bytes.Repeat([]byte{1}, format.UniqueIDLengthBytes)
+
+	var repositoryBlobs, blobCfgBlobs [][]byte
+
+	for i := 0; i < 2; i++ {
+		st := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+		require.NoError(t, format.Initialize(ctx, st, &format.KopiaRepositoryJSON{UniqueID: uniqueID}, rc, format.BlobStorageConfiguration{}, "some-password"))
+
+		mgr, err := format.NewManagerWithCache(ctx, st, cacheDuration, "some-password", nowFunc, format.NewMemoryBlobCache(nowFunc))
+		require.NoError(t, err)
+
+		mgr.SetNonceSourceForTesting(bytes.NewReader(make([]byte, 1000)))
+		require.NoError(t, mgr.SetParameters(ctx, mustGetMutableParameters(t, mgr), format.BlobStorageConfiguration{}, nil))
+
+		repositoryBlobs = append(repositoryBlobs, mustGetBytes(t, st, format.KopiaRepositoryBlobID))
+		blobCfgBlobs = append(blobCfgBlobs, mustGetBytes(t, st, format.KopiaBlobCfgBlobID))
+
+		// the rewritten blobs can be decrypted.
+		_, err = format.NewManagerWithCache(ctx, st, cacheDuration, "some-password", nowFunc, format.NewMemoryBlobCache(nowFunc))
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, repositoryBlobs[0], repositoryBlobs[1])
+	require.Equal(t, blobCfgBlobs[0], blobCfgBlobs[1])
+}
+
 func TestFormatManagerValidDuration(t *testing.T) {
 	cases := map[time.Duration]time.Duration{
 		-1:               15 * time.Minute,
@@ -307,3 +342,80 @@ func mustGetBytes(t *testing.T, st blob.Storage, blobID blob.ID) []byte {
 
 	return tmp.ToByteSlice()
 }
+
+func TestRewrapKeysPersisted(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	startTime := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	ta := faketime.NewTimeAdvance(startTime, 0)
+	nowFunc := ta.NowFunc()
+
+	cf2 := cf
+	cf2.MasterKey = []byte("old-master-key")
+	cf2.EnvelopeEncryption = true
+
+	st := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+	require.NoError(t, format.Initialize(ctx, st, &format.KopiaRepositoryJSON{}, &format.RepositoryConfig{ContentFormat: cf2}, format.BlobStorageConfiguration{}, "some-password"))
+
+	mgr, err := format.NewManagerWithCache(ctx, st, cacheDuration, "some-password", nowFunc, format.NewMemoryBlobCache(nowFunc))
+	require.NoError(t, err)
+
+	// another client which opened the repository before rotation.
+	other, err := format.NewManagerWithCache(ctx, st, cacheDuration, "some-password", nowFunc, format.NewMemoryBlobCache(nowFunc))
+	require.NoError(t, err)
+
+	contentID := []byte{1, 2, 3, 4}
+	before := mustEncrypt(t, mgr.Encryptor(), "written before rotation", contentID)
+
+	require.NoError(t, mgr.RewrapKeys(ctx, []byte("new-master-key")))
+
+	after := mustEncrypt(t, mgr.Encryptor(), "written after rotation", contentID)
+
+	// fresh client sees the rotated key and still decrypts items written before rotation.
+	mgr2, err := format.NewManagerWithCache(ctx, st, cacheDuration, "some-password", nowFunc, format.NewMemoryBlobCache(nowFunc))
+	require.NoError(t, err)
+
+	require.Equal(t, "written before rotation", mustDecrypt(t, mgr2.Encryptor(), before, contentID))
+	require.Equal(t, "written after rotation", mustDecrypt(t, mgr2.Encryptor(), after, contentID))
+
+	// items written by the fresh client use the new master key.
+	e, err := format.NewEnvelopeEncryptor([]byte("new-master-key"))
+	require.NoError(t, err)
+	require.Equal(t, "written by fresh client", mustDecrypt(t, e, mustEncrypt(t, mgr2.Encryptor(), "written by fresh client", contentID), contentID))
+
+	// the other client picks up the rotated key after refresh.
+	ta.Advance(2 * cacheDuration)
+	mustGetMutableParameters(t, other)
+
+	require.Equal(t, "written after rotation", mustDecrypt(t, other.Encryptor(), after, contentID))
+
+	// rewrapping is rejected for repositories without envelope encryption.
+	st2 := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+	require.NoError(t, format.Initialize(ctx, st2, &format.KopiaRepositoryJSON{}, &format.RepositoryConfig{ContentFormat: cf}, format.BlobStorageConfiguration{}, "some-password"))
+
+	mgr3, err := format.NewManagerWithCache(ctx, st2, cacheDuration, "some-password", nowFunc, format.NewMemoryBlobCache(nowFunc))
+	require.NoError(t, err)
+	require.ErrorIs(t, mgr3.RewrapKeys(ctx, []byte("new-master-key")), format.ErrEnvelopeEncryptionNotEnabled)
+}
+
+func mustEncrypt(t *testing.T, e encryption.Encryptor, plainText string, contentID []byte) []byte {
+	t.Helper()
+
+	var out gather.WriteBuffer
+	defer out.Close()
+
+	require.NoError(t, e.Encrypt(gather.FromSlice([]byte(plainText)), contentID, &out))
+
+	return out.ToByteSlice()
+}
+
+func mustDecrypt(t *testing.T, e encryption.Encryptor, cipherText, contentID []byte) string {
+	t.Helper()
+
+	var out gather.WriteBuffer
+	defer out.Close()
+
+	require.NoError(t, e.Decrypt(gather.FromSlice(cipherText), contentID, &out))
+
+	return string(out.ToByteSlice())
+}
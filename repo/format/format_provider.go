@@ -1,6 +1,8 @@
 package format
 
 import (
+	"fmt"
+
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/internal/gather"
@@ -44,6 +46,25 @@
 	MaxFormatVersion = FormatVersion3
 )
 
+// ErrFormatUnsupported is returned when the repository format can't be handled by this version of kopia.
+var ErrFormatUnsupported = errors.New("unsupported repository format")
+
+// NewerVersionRequiredError is returned when the repository declares a format which is not known
+// to this version of kopia, typically because it was written by a newer version.
+// It matches ErrFormatUnsupported when using errors.Is().
+type NewerVersionRequiredError struct {
+	Format string
+}
+
+func (e NewerVersionRequiredError) Error() string {
+	return fmt.Sprintf("repository requires a newer version supporting format %q", e.Format)
+}
+
+// Is implements errors.Is() support for ErrFormatUnsupported.
+func (e NewerVersionRequiredError) Is(target error) bool {
+	return target == ErrFormatUnsupported //nolint:errorlint,goerr113
+}
+
 // Provider provides current formatting options. The options returned
 // should not be cached for more than a few seconds as they are subject to change.
 type Provider interface {
@@ -68,6 +89,7 @@ type formattingOptionsProvider struct {
 
 	h           hashing.HashFunc
 	e           encryption.Encryptor
+	envelope    *EnvelopeEncryptor
 	formatBytes []byte
 }
 
@@ -78,20 +100,28 @@ func NewFormattingOptionsProvider(f0 *ContentFormat, formatBytes []byte) (Provid
 	f := &clone
 	formatVersion := f.Version
 
+	if formatVersion > MaxSupportedReadVersion {
+		return nil, NewerVersionRequiredError{fmt.Sprintf("version %v", formatVersion)}
+	}
+
 	if formatVersion < MinSupportedReadVersion || formatVersion > CurrentWriteVersion {
-		return nil, errors.Errorf("can't handle repositories created using version %v (min supported %v, max supported %v)", formatVersion, MinSupportedReadVersion, MaxSupportedReadVersion)
+		return nil, errors.Wrapf(ErrFormatUnsupported, "can't handle repositories created using version %v (min supported %v, max supported %v)", formatVersion, MinSupportedReadVersion, MaxSupportedReadVersion)
 	}
 
 	if formatVersion < MinSupportedWriteVersion || formatVersion > CurrentWriteVersion {
-		return nil, errors.Errorf("can't handle repositories created using version %v (min supported %v, max supported %v)", formatVersion, MinSupportedWriteVersion, MaxSupportedWriteVersion)
+		return nil, errors.Wrapf(ErrFormatUnsupported, "can't handle repositories created using version %v (min supported %v, max supported %v)", formatVersion, MinSupportedWriteVersion, MaxSupportedWriteVersion)
 	}
 
 	if f.IndexVersion == 0 {
 		f.IndexVersion = legacyIndexVersion
 	}
 
-	if f.IndexVersion < index.Version1 || f.IndexVersion > index.Version2 {
-		return nil, errors.Errorf("index version %v is not supported", f.IndexVersion)
+	if f.IndexVersion > index.Version2 {
+		return nil, NewerVersionRequiredError{fmt.Sprintf("index version %v", f.IndexVersion)}
+	}
+
+	if f.IndexVersion < index.Version1 {
+		return nil, errors.Wrapf(ErrFormatUnsupported, "index version %v is not supported", f.IndexVersion)
 	}
 
 	// apply default
@@ -100,16 +130,35 @@ func NewFormattingOptionsProvider(f0 *ContentFormat, formatBytes []byte) (Provid
 		f.MaxPackSize = 20 << 20 //nolint:gomnd
 	}
 
+	if err := checkKnownAlgorithms(f); err != nil {
+		return nil, err
+	}
+
 	h, err := hashing.CreateHashFunc(f)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to create hash")
 	}
 
-	e, err := encryption.CreateEncryptor(f)
+	var (
+		e        encryption.Encryptor
+		envelope *EnvelopeEncryptor
+	)
+
+	if f.EnvelopeEncryption {
+		envelope, err = newEnvelopeEncryptorWithRotatedKeys(f.MasterKey, f.EnvelopeMasterKeys)
+		e = envelope
+	} else {
+		e, err = encryption.CreateEncryptor(f)
+	}
+
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to create encryptor")
 	}
 
+	if f.ContentMAC {
+		e = newContentMACEncryptor(e, f.MasterKey)
+	}
+
 	if f.GetECCAlgorithm() != "" && f.GetECCOverheadPercent() > 0 {
 		eccEncryptor, err := ecc.CreateEncryptor(f) //nolint:govet
 		if err != nil {
@@ -137,10 +186,35 @@ func NewFormattingOptionsProvider(f0 *ContentFormat, formatBytes []byte) (Provid
 
 		h:           h,
 		e:           e,
+		envelope:    envelope,
 		formatBytes: formatBytes,
 	}, nil
 }
 
+func newEnvelopeEncryptorWithRotatedKeys(masterKey []byte, rotatedKeys [][]byte) (*EnvelopeEncryptor, error) {
+	e, err := NewEnvelopeEncryptor(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range rotatedKeys {
+		if err := e.RewrapKeys(k); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// RewrapKeys makes the provided master key current for wrapping data keys of envelope-encrypted items.
+func (f *formattingOptionsProvider) RewrapKeys(newMasterKey []byte) error {
+	if f.envelope == nil {
+		return ErrEnvelopeEncryptionNotEnabled
+	}
+
+	return f.envelope.RewrapKeys(newMasterKey)
+}
+
 func (f *formattingOptionsProvider) Encryptor() encryption.Encryptor {
 	return f.e
 }
@@ -158,3 +232,31 @@ func (f *formattingOptionsProvider) RepositoryFormatBytes() ([]byte, error) {
 }
 
 var _ Provider = (*formattingOptionsProvider)(nil)
+
+// checkKnownAlgorithms verifies that all algorithms declared by the content format are known to this
+// version of kopia.
+func checkKnownAlgorithms(f *ContentFormat) error {
+	if !containsString(hashing.SupportedAlgorithms(), f.Hash) {
+		return NewerVersionRequiredError{f.Hash}
+	}
+
+	if !f.EnvelopeEncryption && !containsString(encryption.SupportedAlgorithms(true), f.Encryption) {
+		return NewerVersionRequiredError{f.Encryption}
+	}
+
+	if f.ECC != "" && f.ECCOverheadPercent > 0 && !containsString(ecc.SupportedAlgorithms(), f.ECC) {
+		return NewerVersionRequiredError{f.ECC}
+	}
+
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -30,11 +30,11 @@ func (m *Manager) SetParameters(
 	m.repoConfig.ContentFormat.MutableParameters = mp
 	m.repoConfig.RequiredFeatures = requiredFeatures
 
-	if err := m.j.EncryptRepositoryConfig(m.repoConfig, m.formatEncryptionKey); err != nil {
+	if err := m.j.encryptRepositoryConfig(m.repoConfig, m.formatEncryptionKey, m.nonceSource); err != nil {
 		return errors.Errorf("unable to encrypt format bytes")
 	}
 
-	if err := m.j.WriteBlobCfgBlob(ctx, m.blobs, blobcfg, m.formatEncryptionKey); err != nil {
+	if err := m.j.writeBlobCfgBlob(ctx, m.blobs, blobcfg, m.formatEncryptionKey, m.nonceSource); err != nil {
 		return errors.Wrap(err, "unable to write blobcfg blob")
 	}
 
@@ -44,5 +44,5 @@ func (m *Manager) SetParameters(
 
 	m.cache.Remove(ctx, []blob.ID{KopiaRepositoryBlobID, KopiaBlobCfgBlobID})
 
-	return nil
+	return m.writeRepositoryDescriptorLocked(ctx, blobcfg)
 }
@@ -0,0 +1,64 @@
+package format
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNonceReuse is returned when a source of nonces produces a nonce that has already been used
+// or one that is obviously not random, which indicates a broken source of randomness.
+var ErrNonceReuse = errors.New("nonce reuse detected")
+
+// defaultNonceSource is the source of nonces used for encrypting format and blobcfg blobs.
+//
+// Format blobs are encrypted with AES-GCM using random 96-bit nonces, for which the probability
+// of a repeat is negligible given the number of times those blobs are ever written. Because reusing
+// a nonce with the same key is catastrophic for GCM while a failing source of randomness would
+// otherwise go unnoticed, all nonces are additionally checked to be unique within the process.
+//
+//nolint:gochecknoglobals
+var defaultNonceSource io.Reader = newNonceGuard(rand.Reader)
+
+// nonceGuard wraps a source of nonces and fails reads that return an all-zero nonce
+// or a nonce previously returned by the guard.
+type nonceGuard struct {
+	src io.Reader
+
+	mu sync.Mutex
+	// +checklocks:mu
+	seen map[string]struct{}
+}
+
+// Read fills the provided slice with a single nonce.
+func (g *nonceGuard) Read(p []byte) (int, error) {
+	n, err := io.ReadFull(g.src, p)
+	if err != nil {
+		return n, errors.Wrap(err, "error reading nonce")
+	}
+
+	if bytes.Equal(p, make([]byte, len(p))) {
+		return 0, errors.Wrap(ErrNonceReuse, "all-zero nonce")
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.seen[string(p)]; ok {
+		return 0, errors.Wrapf(ErrNonceReuse, "nonce %x", p)
+	}
+
+	g.seen[string(p)] = struct{}{}
+
+	return n, nil
+}
+
+func newNonceGuard(src io.Reader) *nonceGuard {
+	return &nonceGuard{
+		src:  src,
+		seen: map[string]struct{}{},
+	}
+}
@@ -0,0 +1,73 @@
+package format
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// counterNonceSource is a deterministic source of unique nonces.
+type counterNonceSource struct {
+	counter uint64
+}
+
+func (s *counterNonceSource) Read(p []byte) (int, error) {
+	s.counter++
+
+	for i := range p {
+		p[i] = 0
+	}
+
+	binary.BigEndian.PutUint64(p[len(p)-8:], s.counter)
+
+	return len(p), nil
+}
+
+func TestNonceGuardUniqueNonces(t *testing.T) {
+	masterKey := bytes.Repeat([]byte{1}, 32)
+	uniqueID := bytes.Repeat([]byte{2}, 32)
+
+	g := newNonceGuard(&counterNonceSource{})
+
+	const numWrites = 100000
+
+	seen := map[string]bool{}
+
+	for i := 0; i < numWrites; i++ {
+		encrypted, err := encryptRepositoryBlobBytesAes256Gcm([]byte("hello"), masterKey, uniqueID, g)
+		require.NoError(t, err)
+
+		nonce := string(encrypted[0:12])
+		require.False(t, seen[nonce], "nonce reused after %v writes", i)
+
+		seen[nonce] = true
+	}
+
+	require.Len(t, seen, numWrites)
+}
+
+func TestNonceGuardDetectsReuse(t *testing.T) {
+	masterKey := bytes.Repeat([]byte{1}, 32)
+	uniqueID := bytes.Repeat([]byte{2}, 32)
+
+	// source that repeats the same sequence of nonces.
+	repeating := bytes.NewReader(bytes.Repeat([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, 2))
+
+	g := newNonceGuard(repeating)
+
+	_, err := encryptRepositoryBlobBytesAes256Gcm([]byte("hello"), masterKey, uniqueID, g)
+	require.NoError(t, err)
+
+	_, err = encryptRepositoryBlobBytesAes256Gcm([]byte("hello"), masterKey, uniqueID, g)
+	require.ErrorIs(t, err, ErrNonceReuse)
+
+	// source of randomness returning zeros.
+	_, err = encryptRepositoryBlobBytesAes256Gcm([]byte("hello"), masterKey, uniqueID, newNonceGuard(bytes.NewReader(make([]byte, 12))))
+	require.ErrorIs(t, err, ErrNonceReuse)
+
+	// failing source of randomness.
+	_, err = encryptRepositoryBlobBytesAes256Gcm([]byte("hello"), masterKey, uniqueID, newNonceGuard(bytes.NewReader(nil)))
+	require.Error(t, err)
+}
@@ -1,6 +1,27 @@
 package format
 
+import "github.com/kopia/kopia/repo/splitter"
+
 // ObjectFormat describes the format of objects in a repository.
 type ObjectFormat struct {
-	Splitter string `json:"splitter,omitempty"` // splitter used to break objects into pieces of content
+	Splitter      string `json:"splitter,omitempty"`      // splitter used to break objects into pieces of content
+	MaxObjectSize int64  `json:"maxObjectSize,omitempty"` // default maximum size of objects, zero means unlimited
+
+	// MaxIndirectFanout is the maximum number of entries in a single index object of an indirect object,
+	// objects with more entries get nested index objects. Zero means unlimited.
+	MaxIndirectFanout int `json:"maxIndirectFanout,omitempty"`
+
+	// InlineObjects allows writers to store tiny objects directly in their object IDs (see object.InlineObjectID),
+	// which older clients can't parse. The data of such objects is only protected by encryption where the
+	// object IDs themselves are stored encrypted (e.g. directory and snapshot manifests) and is revealed
+	// anywhere object IDs are displayed or logged.
+	InlineObjects bool `json:"inlineObjects,omitempty"`
+
+	// InlineContentThreshold causes objects shorter than the given number of bytes to be stored directly
+	// in their object IDs instead of contents. Zero disables inlining except for writers that request it.
+	// Like InlineObjects, a non-zero threshold prevents older clients from opening the repository.
+	InlineContentThreshold int `json:"inlineContentThreshold,omitempty"`
+
+	// SplitterParameters, if set, override chunk sizes of the content-defined splitter.
+	SplitterParameters *splitter.Parameters `json:"splitterParameters,omitempty"`
 }
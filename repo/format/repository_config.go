@@ -2,6 +2,7 @@
 
 import (
 	"encoding/json"
+	"io"
 
 	"github.com/pkg/errors"
 
@@ -18,6 +19,16 @@ type RepositoryConfig struct {
 	RequiredFeatures []feature.Required `json:"requiredFeatures,omitempty"`
 }
 
+// Features required to open repositories which use optional format extensions that
+// older clients would silently misinterpret.
+const (
+	FeatureContentMAC         feature.Feature = "content-mac"
+	FeatureInlineObjects      feature.Feature = "inline-objects"
+	FeatureHashSalt           feature.Feature = "hash-salt"
+	FeatureEnvelopeEncryption feature.Feature = "envelope-encryption"
+	FeatureSplitterParameters feature.Feature = "splitter-parameters"
+)
+
 // EncryptedRepositoryConfig contains the configuration of repository that's persisted in encrypted format.
 type EncryptedRepositoryConfig struct {
 	Format RepositoryConfig `json:"format"`
@@ -25,11 +36,15 @@ type EncryptedRepositoryConfig struct {
 
 // decryptRepositoryConfig decrypts RepositoryConfig stored in EncryptedFormatBytes.
 func (f *KopiaRepositoryJSON) decryptRepositoryConfig(masterKey []byte) (*RepositoryConfig, error) {
+	if err := f.verifyChecksum(masterKey); err != nil {
+		return nil, err
+	}
+
 	switch f.EncryptionAlgorithm {
 	case aes256GcmEncryption:
 		plainText, err := decryptRepositoryBlobBytesAes256Gcm(f.EncryptedFormatBytes, masterKey, f.UniqueID)
 		if err != nil {
-			return nil, errors.Errorf("unable to decrypt repository format")
+			return nil, errors.Wrap(err, "unable to decrypt repository format")
 		}
 
 		var erc EncryptedRepositoryConfig
@@ -46,6 +61,10 @@ func (f *KopiaRepositoryJSON) decryptRepositoryConfig(masterKey []byte) (*Reposi
 
 // EncryptRepositoryConfig encrypts the provided repository config and stores it in EncryptedFormatBytes.
 func (f *KopiaRepositoryJSON) EncryptRepositoryConfig(format *RepositoryConfig, masterKey []byte) error {
+	return f.encryptRepositoryConfig(format, masterKey, defaultNonceSource)
+}
+
+func (f *KopiaRepositoryJSON) encryptRepositoryConfig(format *RepositoryConfig, masterKey []byte, nonceSource io.Reader) error {
 	switch f.EncryptionAlgorithm {
 	case aes256GcmEncryption:
 		data, err := json.Marshal(&EncryptedRepositoryConfig{Format: *format})
@@ -53,12 +72,13 @@ func (f *KopiaRepositoryJSON) EncryptRepositoryConfig(format *RepositoryConfig,
 			return errors.Wrap(err, "can't marshal format to JSON")
 		}
 
-		data, err = encryptRepositoryBlobBytesAes256Gcm(data, masterKey, f.UniqueID)
+		data, err = encryptRepositoryBlobBytesAes256Gcm(data, masterKey, f.UniqueID, nonceSource)
 		if err != nil {
 			return errors.Wrap(err, "failed to encrypt format JSON")
 		}
 
 		f.EncryptedFormatBytes = data
+		f.setChecksum(masterKey)
 
 		return nil
 
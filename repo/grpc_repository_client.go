@@ -31,6 +31,7 @@
 	"github.com/kopia/kopia/repo/hashing"
 	"github.com/kopia/kopia/repo/manifest"
 	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/repo/splitter"
 )
 
 // MaxGRPCMessageSize is the maximum size of a message sent or received over GRPC API when talking to
@@ -923,6 +924,14 @@ func newGRPCAPIRepositoryForConnection(ctx context.Context, conn *grpc.ClientCon
 			Splitter: p.Splitter,
 		}
 
+		if p.GetSplitterAvgSize() > 0 {
+			rr.objectFormat.SplitterParameters = &splitter.Parameters{
+				MinSize: int(p.GetSplitterMinSize()),
+				AvgSize: int(p.GetSplitterAvgSize()),
+				MaxSize: int(p.GetSplitterMaxSize()),
+			}
+		}
+
 		rr.serverSupportsContentCompression = p.SupportsContentCompression
 
 		rr.omgr, err = object.NewObjectManager(ctx, rr, rr.objectFormat)
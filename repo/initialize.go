@@ -9,12 +9,14 @@
 
 	"github.com/pkg/errors"
 
+	"github.com/kopia/kopia/internal/feature"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/ecc"
 	"github.com/kopia/kopia/repo/encryption"
 	"github.com/kopia/kopia/repo/format"
 	"github.com/kopia/kopia/repo/hashing"
+	"github.com/kopia/kopia/repo/object"
 	"github.com/kopia/kopia/repo/splitter"
 )
 
@@ -28,8 +30,9 @@
 )
 
 const (
-	hmacSecretLength = 32
-	masterKeyLength  = 32
+	hmacSecretLength  = 32
+	masterKeyLength   = 32
+	minIndirectFanout = 2
 )
 
 // NewRepositoryOptions specifies options that apply to newly created repositories.
@@ -102,19 +105,50 @@ func repositoryObjectFormatFromOptions(opt *NewRepositoryOptions) (*format.Repos
 			ECCOverheadPercent: applyDefaultIntRange(opt.BlockFormat.ECCOverheadPercent, 0, 100), //nolint:gomnd
 			HMACSecret:         applyDefaultRandomBytes(opt.BlockFormat.HMACSecret, hmacSecretLength),
 			MasterKey:          applyDefaultRandomBytes(opt.BlockFormat.MasterKey, masterKeyLength),
+			ContentMAC:         opt.BlockFormat.ContentMAC,
+			HashSalt:           opt.BlockFormat.HashSalt,
+			EnvelopeEncryption: opt.BlockFormat.EnvelopeEncryption,
 			MutableParameters: format.MutableParameters{
 				Version:         fv,
 				MaxPackSize:     applyDefaultInt(opt.BlockFormat.MaxPackSize, 20<<20), //nolint:gomnd
 				IndexVersion:    applyDefaultInt(opt.BlockFormat.IndexVersion, content.DefaultIndexVersion),
 				EpochParameters: opt.BlockFormat.EpochParameters,
+
+				MaxIndexBlockSize: opt.BlockFormat.MaxIndexBlockSize,
 			},
 			EnablePasswordChange: opt.BlockFormat.EnablePasswordChange,
 		},
 		ObjectFormat: format.ObjectFormat{
-			Splitter: applyDefaultString(opt.ObjectFormat.Splitter, splitter.DefaultAlgorithm),
+			Splitter:               applyDefaultString(opt.ObjectFormat.Splitter, splitter.DefaultAlgorithm),
+			MaxObjectSize:          opt.ObjectFormat.MaxObjectSize,
+			MaxIndirectFanout:      opt.ObjectFormat.MaxIndirectFanout,
+			InlineObjects:          opt.ObjectFormat.InlineObjects,
+			InlineContentThreshold: opt.ObjectFormat.InlineContentThreshold,
 		},
 	}
 
+	if p := opt.ObjectFormat.SplitterParameters; p != nil {
+		withDefaults := p.WithDefaults()
+		f.ObjectFormat.SplitterParameters = &withDefaults
+	}
+
+	sf, err := splitter.GetFactoryWithParameters(f.ObjectFormat.Splitter, f.ObjectFormat.SplitterParameters)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid splitter parameters")
+	}
+
+	if sf == nil {
+		return nil, errors.Errorf("unsupported splitter %q", f.ObjectFormat.Splitter)
+	}
+
+	if fo := f.ObjectFormat.MaxIndirectFanout; fo != 0 && fo < minIndirectFanout {
+		return nil, errors.Errorf("invalid maximum indirect fan-out %v, must be at least %v", fo, minIndirectFanout)
+	}
+
+	if th := f.ObjectFormat.InlineContentThreshold; th < 0 || th > object.MaxInlineObjectLength+1 {
+		return nil, errors.Errorf("invalid inline content threshold %v, must be between 0 and %v", th, object.MaxInlineObjectLength+1)
+	}
+
 	if opt.DisableHMAC {
 		f.HMACSecret = nil
 	}
@@ -128,9 +162,41 @@ func repositoryObjectFormatFromOptions(opt *NewRepositoryOptions) (*format.Repos
 		return nil, errors.Wrap(err, "error resolving format version")
 	}
 
+	if f.ContentMAC {
+		requireFeature(f, format.FeatureContentMAC, "The repository stores a keyed MAC with each content.")
+	}
+
+	// objects below the inline threshold get inline object IDs, which older clients can't parse.
+	if f.InlineObjects || f.ObjectFormat.InlineContentThreshold > 0 {
+		requireFeature(f, format.FeatureInlineObjects, "The repository stores tiny objects directly in their object IDs.")
+	}
+
+	if len(f.HashSalt) > 0 {
+		requireFeature(f, format.FeatureHashSalt, "The repository mixes a salt into content hashes.")
+	}
+
+	if f.EnvelopeEncryption {
+		requireFeature(f, format.FeatureEnvelopeEncryption, "The repository encrypts each content with its own wrapped data key.")
+	}
+
+	// older clients would split objects using default chunk sizes and lose deduplication.
+	if f.ObjectFormat.SplitterParameters != nil {
+		requireFeature(f, format.FeatureSplitterParameters, "The repository splits objects using custom chunk sizes.")
+	}
+
 	return f, nil
 }
 
+// requireFeature prevents clients which don't understand the provided feature from opening the repository.
+func requireFeature(f *format.RepositoryConfig, feat feature.Feature, message string) {
+	f.RequiredFeatures = append(f.RequiredFeatures, feature.Required{
+		Feature: feat,
+		IfNotUnderstood: feature.IfNotUnderstood{
+			Message: message,
+		},
+	})
+}
+
 func applyDefaultInt(v, def int) int {
 	if v == 0 {
 		return def
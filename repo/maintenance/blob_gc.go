@@ -2,6 +2,7 @@
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -11,6 +12,7 @@
 	"github.com/kopia/kopia/internal/units"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/blob/throttling"
 	"github.com/kopia/kopia/repo/content"
 )
 
@@ -20,56 +22,149 @@ type DeleteUnreferencedBlobsOptions struct {
 	Prefix       blob.ID
 	DryRun       bool
 	NotAfterTime time.Time
+
+	DeleteParallel   int     // number of concurrent deletes, defaults to Parallel
+	DeletesPerSecond float64 // maximum rate of deletes, zero means unlimited
+	BatchSize        int     // number of deletes after which progress is persisted
 }
 
-// DeleteUnreferencedBlobs deletes o was created after maintenance startederenced by index entries.
+const (
+	defaultBlobGCParallel  = 16
+	defaultBlobGCBatchSize = 1000
+)
+
+// DeleteUnreferencedBlobs deletes blobs that are not referenced by index entries.
 //
-//nolint:gocyclo,funlen
+// Unreferenced blobs are deleted in batches while the repository is being scanned and each batch
+// is persisted in the repository before it's deleted, so that garbage collection that has been
+// interrupted resumes deleting the remaining blobs without scanning the repository again.
 func DeleteUnreferencedBlobs(ctx context.Context, rep repo.DirectRepositoryWriter, opt DeleteUnreferencedBlobsOptions, safety SafetyParameters) (int, error) {
+	return deleteUnreferencedBlobs(ctx, rep, rep.BlobStorage(), opt, safety)
+}
+
+func deleteUnreferencedBlobs(ctx context.Context, rep repo.DirectRepositoryWriter, st blob.Storage, opt DeleteUnreferencedBlobsOptions, safety SafetyParameters) (int, error) {
 	if opt.Parallel == 0 {
-		opt.Parallel = 16
+		opt.Parallel = defaultBlobGCParallel
 	}
 
-	const deleteQueueSize = 100
+	if opt.DeleteParallel == 0 {
+		opt.DeleteParallel = opt.Parallel
+	}
 
-	var unreferenced, deleted stats.CountSum
+	var prefixes []blob.ID
+	if p := opt.Prefix; p != "" {
+		prefixes = append(prefixes, p)
+	} else {
+		prefixes = append(prefixes, content.PackBlobIDPrefixRegular, content.PackBlobIDPrefixSpecial, content.BlobIDPrefixSession)
+	}
 
-	var eg errgroup.Group
+	if opt.BatchSize == 0 {
+		opt.BatchSize = defaultBlobGCBatchSize
+	}
+
+	if opt.DeletesPerSecond > 0 {
+		throttler, err := throttling.NewThrottler(throttling.Limits{WritesPerSecond: opt.DeletesPerSecond}, time.Second, 0)
+		if err != nil {
+			return 0, errors.Wrap(err, "invalid delete rate")
+		}
+
+		st = throttling.NewWrapper(st, throttler)
+	}
 
-	unused := make(chan blob.Metadata, deleteQueueSize)
+	gc, err := newBlobGCFilter(ctx, rep, opt, safety)
+	if err != nil {
+		return 0, err
+	}
 
 	if !opt.DryRun {
-		// start goroutines to delete blobs as they come.
-		for i := 0; i < opt.Parallel; i++ {
-			eg.Go(func() error {
-				for bm := range unused {
-					if err := rep.BlobStorage().DeleteBlob(ctx, bm.BlobID); err != nil {
-						return errors.Wrapf(err, "unable to delete blob %q", bm.BlobID)
-					}
-					cnt, del := deleted.Add(bm.Length)
-					if cnt%100 == 0 {
-						log(ctx).Infof("  deleted %v unreferenced blobs (%v)", cnt, units.BytesStringBase10(del))
-					}
-				}
+		batches, err := getBlobGCBatches(ctx, rep, prefixes)
+		if err != nil {
+			return 0, errors.Wrap(err, "unable to get blob GC progress")
+		}
 
-				return nil
-			})
+		if len(batches) > 0 {
+			return resumeBlobGCBatches(ctx, rep, st, prefixes, batches, gc, opt)
 		}
 	}
 
-	// iterate unreferenced blobs and count them + optionally send to the channel to be deleted
+	var (
+		mu         sync.Mutex
+		pending    []blob.Metadata
+		batchCount int
+		found      stats.CountSum
+		deleted    stats.CountSum
+	)
+
+	// must be called with mu held.
+	deletePending := func() error {
+		b := &blobGCBatch{
+			blobID:  blobGCBatchID(prefixes, batchCount),
+			Pending: pending,
+		}
+
+		batchCount++
+		pending = nil
+
+		return deleteBlobGCBatchContents(ctx, rep, st, b, opt.DeleteParallel, &deleted)
+	}
+
+	// iterate unreferenced blobs and delete them in batches as they are found, so that
+	// memory usage does not depend on the number of unreferenced blobs.
 	log(ctx).Infof("Looking for unreferenced blobs...")
 
-	var prefixes []blob.ID
-	if p := opt.Prefix; p != "" {
-		prefixes = append(prefixes, p)
-	} else {
-		prefixes = append(prefixes, content.PackBlobIDPrefixRegular, content.PackBlobIDPrefixSpecial, content.BlobIDPrefixSession)
+	if err := rep.ContentManager().IterateUnreferencedBlobs(ctx, prefixes, opt.Parallel, func(bm blob.Metadata) error {
+		if !gc.shouldDelete(ctx, bm) {
+			return nil
+		}
+
+		found.Add(bm.Length)
+
+		if opt.DryRun {
+			return nil
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		pending = append(pending, bm)
+
+		if len(pending) < opt.BatchSize {
+			return nil
+		}
+
+		return deletePending()
+	}); err != nil {
+		return 0, errors.Wrap(err, "error looking for unreferenced blobs")
+	}
+
+	cnt, totalSize := found.Approximate()
+
+	log(ctx).Debugf("Found %v unreferenced blobs (%v)", cnt, units.BytesStringBase10(totalSize))
+
+	if opt.DryRun {
+		return int(cnt), nil
 	}
 
+	if len(pending) > 0 {
+		if err := deletePending(); err != nil {
+			return 0, err
+		}
+	}
+
+	return logBlobsDeleted(ctx, &deleted), nil
+}
+
+// blobGCFilter determines which unreferenced blobs can be safely deleted.
+type blobGCFilter struct {
+	cutoffTime     time.Time
+	activeSessions map[content.SessionID]*content.SessionInfo
+	safety         SafetyParameters
+}
+
+func newBlobGCFilter(ctx context.Context, rep repo.DirectRepositoryWriter, opt DeleteUnreferencedBlobsOptions, safety SafetyParameters) (*blobGCFilter, error) {
 	activeSessions, err := rep.ContentManager().ListActiveSessions(ctx)
 	if err != nil {
-		return 0, errors.Wrap(err, "unable to load active sessions")
+		return nil, errors.Wrap(err, "unable to load active sessions")
 	}
 
 	cutoffTime := opt.NotAfterTime
@@ -82,57 +177,172 @@ func DeleteUnreferencedBlobs(ctx context.Context, rep repo.DirectRepositoryWrite
 	// protection here.
 	const cutoffTimeSlack = 1 * time.Second
 
-	cutoffTime = cutoffTime.Add(cutoffTimeSlack)
+	return &blobGCFilter{
+		cutoffTime:     cutoffTime.Add(cutoffTimeSlack),
+		activeSessions: activeSessions,
+		safety:         safety,
+	}, nil
+}
 
-	// iterate all pack blobs + session blobs and keep ones that are too young or
-	// belong to alive sessions.
-	if err := rep.ContentManager().IterateUnreferencedBlobs(ctx, prefixes, opt.Parallel, func(bm blob.Metadata) error {
-		if bm.Timestamp.After(cutoffTime) {
-			log(ctx).Debugf("  preserving %v because it was created after maintenance started", bm.BlobID)
-			return nil
-		}
+// shouldDelete returns true if the provided unreferenced blob is old enough and not part of an active session.
+func (f *blobGCFilter) shouldDelete(ctx context.Context, bm blob.Metadata) bool {
+	if bm.Timestamp.After(f.cutoffTime) {
+		log(ctx).Debugf("  preserving %v because it was created after maintenance started", bm.BlobID)
+		return false
+	}
 
-		if age := cutoffTime.Sub(bm.Timestamp); age < safety.BlobDeleteMinAge {
-			log(ctx).Debugf("  preserving %v because it's too new (age: %v<%v)", bm.BlobID, age, safety.BlobDeleteMinAge)
-			return nil
+	if age := f.cutoffTime.Sub(bm.Timestamp); age < f.safety.BlobDeleteMinAge {
+		log(ctx).Debugf("  preserving %v because it's too new (age: %v<%v)", bm.BlobID, age, f.safety.BlobDeleteMinAge)
+		return false
+	}
+
+	sid := content.SessionIDFromBlobID(bm.BlobID)
+	if s, ok := f.activeSessions[sid]; ok {
+		if age := f.cutoffTime.Sub(s.CheckpointTime); age < f.safety.SessionExpirationAge {
+			log(ctx).Debugf("  preserving %v because it's part of an active session (%v)", bm.BlobID, sid)
+			return false
 		}
+	}
 
-		sid := content.SessionIDFromBlobID(bm.BlobID)
-		if s, ok := activeSessions[sid]; ok {
-			if age := cutoffTime.Sub(s.CheckpointTime); age < safety.SessionExpirationAge {
-				log(ctx).Debugf("  preserving %v because it's part of an active session (%v)", bm.BlobID, sid)
-				return nil
-			}
+	return true
+}
+
+// resumeBlobGCBatches deletes blobs from batches persisted by interrupted garbage collection.
+// Since the repository may have changed in the meantime, blobs that became referenced by the
+// current indexes or would not be deleted by a new scan are dropped from the batches first.
+func resumeBlobGCBatches(ctx context.Context, rep repo.DirectRepositoryWriter, st blob.Storage, prefixes []blob.ID, batches []*blobGCBatch, gc *blobGCFilter, opt DeleteUnreferencedBlobsOptions) (int, error) {
+	pending := map[blob.ID]bool{}
+
+	for _, b := range batches {
+		for _, bm := range b.Pending {
+			pending[bm.BlobID] = true
 		}
+	}
+
+	log(ctx).Infof("Resuming interrupted garbage collection, %v unreferenced blobs remaining.", len(pending))
 
-		unreferenced.Add(bm.Length)
+	referenced := map[blob.ID]bool{}
 
-		if !opt.DryRun {
-			unused <- bm
+	if err := rep.ContentManager().IteratePacks(ctx, content.IteratePackOptions{
+		Prefixes:                           prefixes,
+		IncludePacksWithOnlyDeletedContent: true,
+	}, func(pi content.PackInfo) error {
+		if pi.ContentCount > 0 && pending[pi.PackID] {
+			referenced[pi.PackID] = true
 		}
 
 		return nil
 	}); err != nil {
-		return 0, errors.Wrap(err, "error looking for unreferenced blobs")
+		return 0, errors.Wrap(err, "error iterating packs")
 	}
 
-	close(unused)
+	var deleted stats.CountSum
+
+	for _, b := range batches {
+		var stillUnreferenced []blob.Metadata
+
+		for _, bm := range b.Pending {
+			if referenced[bm.BlobID] {
+				log(ctx).Debugf("  preserving %v because it's now referenced by the index", bm.BlobID)
+				continue
+			}
+
+			if gc.shouldDelete(ctx, bm) {
+				stillUnreferenced = append(stillUnreferenced, bm)
+			}
+		}
 
-	unreferencedCount, unreferencedSize := unreferenced.Approximate()
-	log(ctx).Debugf("Found %v blobs to delete (%v)", unreferencedCount, units.BytesStringBase10(unreferencedSize))
+		b.Pending = stillUnreferenced
 
-	// wait for all delete workers to finish.
-	if err := eg.Wait(); err != nil {
-		return 0, errors.Wrap(err, "worker error")
+		if err := deleteBlobGCBatchContents(ctx, rep, st, b, opt.DeleteParallel, &deleted); err != nil {
+			return 0, err
+		}
 	}
 
-	if opt.DryRun {
-		return int(unreferencedCount), nil
+	return logBlobsDeleted(ctx, &deleted), nil
+}
+
+// deleteBlobGCBatchContents persists the provided batch, deletes blobs in it and then removes the persisted batch.
+// If an error occurs, the persisted batch is updated to contain only blobs that have not been deleted.
+func deleteBlobGCBatchContents(ctx context.Context, rep repo.DirectRepositoryWriter, st blob.Storage, b *blobGCBatch, parallel int, deleted *stats.CountSum) error {
+	if len(b.Pending) == 0 {
+		return deleteBlobGCBatch(ctx, rep, b)
+	}
+
+	if err := putBlobGCBatch(ctx, rep, b); err != nil {
+		return err
+	}
+
+	remaining, batchErr := deleteBlobBatch(ctx, st, b.Pending, parallel, deleted)
+	if batchErr != nil {
+		b.Pending = remaining
+
+		if err := putBlobGCBatch(ctx, rep, b); err != nil {
+			log(ctx).Errorf("unable to update blob GC progress: %v", err)
+		}
+
+		return batchErr
 	}
 
+	return deleteBlobGCBatch(ctx, rep, b)
+}
+
+func logBlobsDeleted(ctx context.Context, deleted *stats.CountSum) int {
 	del, cnt := deleted.Approximate()
 
 	log(ctx).Infof("Deleted total %v unreferenced blobs (%v)", del, units.BytesStringBase10(cnt))
 
-	return int(del), nil
+	return int(del)
+}
+
+// deleteBlobBatch deletes the provided blobs using the specified number of goroutines
+// and returns the ones that have not been deleted.
+func deleteBlobBatch(ctx context.Context, st blob.Storage, batch []blob.Metadata, parallel int, deleted *stats.CountSum) ([]blob.Metadata, error) {
+	var eg errgroup.Group
+
+	done := make([]bool, len(batch))
+	work := make(chan int, len(batch))
+
+	for i := range batch {
+		work <- i
+	}
+
+	close(work)
+
+	for i := 0; i < parallel; i++ {
+		eg.Go(func() error {
+			for ndx := range work {
+				if ctx.Err() != nil {
+					return errors.Wrap(ctx.Err(), "blob deletion canceled")
+				}
+
+				bm := batch[ndx]
+
+				if err := st.DeleteBlob(ctx, bm.BlobID); err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+					return errors.Wrapf(err, "unable to delete blob %q", bm.BlobID)
+				}
+
+				done[ndx] = true
+
+				cnt, del := deleted.Add(bm.Length)
+				if cnt%100 == 0 {
+					log(ctx).Infof("  deleted %v unreferenced blobs (%v)", cnt, units.BytesStringBase10(del))
+				}
+			}
+
+			return nil
+		})
+	}
+
+	err := eg.Wait()
+
+	var remaining []blob.Metadata
+
+	for i, bm := range batch {
+		if !done[i] {
+			remaining = append(remaining, bm)
+		}
+	}
+
+	return remaining, errors.Wrap(err, "worker error")
 }
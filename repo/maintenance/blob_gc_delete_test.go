@@ -0,0 +1,222 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/repo/blob"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/format"
+)
+
+var errDeleteFailed = errors.New("delete failed")
+
+// deleteRecordingStorage records deletes and the maximum number of concurrent deletes
+// and optionally fails deletes after given number of successful ones.
+type deleteRecordingStorage struct {
+	blob.Storage
+
+	failAfter int
+
+	mu          sync.Mutex
+	started     int
+	deleteTimes []time.Time
+	deleted     []blob.ID
+	inFlight    int
+	maxInFlight int
+}
+
+func (s *deleteRecordingStorage) DeleteBlob(ctx context.Context, id blob.ID) error {
+	s.mu.Lock()
+	if s.failAfter > 0 && s.started >= s.failAfter {
+		s.mu.Unlock()
+		return errDeleteFailed
+	}
+
+	s.started++
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+
+	err := s.Storage.DeleteBlob(ctx, id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inFlight--
+	s.deleted = append(s.deleted, id)
+	s.deleteTimes = append(s.deleteTimes, time.Now()) //nolint:forbidigo
+
+	return err //nolint:wrapcheck
+}
+
+func writeOrphanedBlobs(ctx context.Context, t *testing.T, env *repotesting.Environment, prefix string, n int) []blob.ID {
+	t.Helper()
+
+	var result []blob.ID
+
+	for i := 0; i < n; i++ {
+		id := blob.ID(fmt.Sprintf("p%v%031x", prefix, i))
+		require.NoError(t, env.RepositoryWriter.BlobStorage().PutBlob(ctx, id, gather.FromSlice([]byte{1, 2, 3}), blob.PutOptions{}))
+
+		result = append(result, id)
+	}
+
+	return result
+}
+
+func TestDeleteUnreferencedBlobsRateLimit(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, format.FormatVersion2)
+
+	const (
+		numBlobs         = 40
+		deletesPerSecond = 40
+		parallel         = 4
+	)
+
+	writeOrphanedBlobs(ctx, t, env, "0", numBlobs)
+
+	st := &deleteRecordingStorage{Storage: env.RepositoryWriter.BlobStorage()}
+
+	t0 := time.Now() //nolint:forbidigo
+
+	n, err := deleteUnreferencedBlobs(ctx, env.RepositoryWriter, st, DeleteUnreferencedBlobsOptions{
+		DeleteParallel:   parallel,
+		DeletesPerSecond: deletesPerSecond,
+		BatchSize:        10,
+	}, SafetyNone)
+	require.NoError(t, err)
+	require.Equal(t, numBlobs, n)
+	require.Len(t, st.deleted, numBlobs)
+	require.LessOrEqual(t, st.maxInFlight, parallel)
+
+	// the token bucket starts empty, so the i-th delete can't happen sooner than i/rate after start.
+	sort.Slice(st.deleteTimes, func(i, j int) bool {
+		return st.deleteTimes[i].Before(st.deleteTimes[j])
+	})
+
+	const slack = 50 * time.Millisecond
+
+	for i, dt := range st.deleteTimes {
+		minElapsed := time.Duration(float64(i) * float64(time.Second) / deletesPerSecond)
+		require.GreaterOrEqual(t, dt.Sub(t0)+slack, minElapsed, "delete #%v happened too soon", i)
+	}
+}
+
+func TestDeleteUnreferencedBlobsResume(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, format.FormatVersion2)
+
+	const (
+		numBlobs  = 30
+		batchSize = 10
+		failAfter = 15
+	)
+
+	orphaned := writeOrphanedBlobs(ctx, t, env, "0", numBlobs)
+	opt := DeleteUnreferencedBlobsOptions{
+		DeleteParallel: 4,
+		BatchSize:      batchSize,
+	}
+
+	// first GC fails in the middle of the second batch, blobs are deleted as they are found,
+	// so the rest of the repository has not been scanned.
+	st1 := &deleteRecordingStorage{Storage: env.RepositoryWriter.BlobStorage(), failAfter: failAfter}
+
+	_, err := deleteUnreferencedBlobs(ctx, env.RepositoryWriter, st1, opt, SafetyNone)
+	require.ErrorIs(t, err, errDeleteFailed)
+	require.Len(t, st1.deleted, failAfter)
+
+	batches, err := getBlobGCBatches(ctx, env.RepositoryWriter, []blob.ID{"p", "q", "s"})
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0].Pending, 2*batchSize-failAfter)
+
+	// blobs orphaned after the scan are not seen by the resumed GC, which does not scan again.
+	orphanedLater := writeOrphanedBlobs(ctx, t, env, "1", 3)
+
+	st2 := &deleteRecordingStorage{Storage: env.RepositoryWriter.BlobStorage()}
+
+	n, err := deleteUnreferencedBlobs(ctx, env.RepositoryWriter, st2, opt, SafetyNone)
+	require.NoError(t, err)
+	require.Equal(t, 2*batchSize-failAfter, n)
+
+	batches, err = getBlobGCBatches(ctx, env.RepositoryWriter, []blob.ID{"p", "q", "s"})
+	require.NoError(t, err)
+	require.Empty(t, batches)
+
+	// next GC scans the repository again.
+	st3 := &deleteRecordingStorage{Storage: env.RepositoryWriter.BlobStorage()}
+
+	n, err = deleteUnreferencedBlobs(ctx, env.RepositoryWriter, st3, opt, SafetyNone)
+	require.NoError(t, err)
+	require.Equal(t, numBlobs-2*batchSize+len(orphanedLater), n)
+
+	// no blob was deleted twice.
+	require.ElementsMatch(t, append(append([]blob.ID{}, orphaned...), orphanedLater...),
+		append(append(append([]blob.ID{}, st1.deleted...), st2.deleted...), st3.deleted...))
+}
+
+func TestDeleteUnreferencedBlobsResumeRevalidates(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, format.FormatVersion2)
+
+	orphaned := writeOrphanedBlobs(ctx, t, env, "0", 2)
+
+	// pack blob that is referenced by the index by the time GC is resumed.
+	cid, err := env.RepositoryWriter.ContentManager().WriteContent(ctx, gather.FromSlice([]byte("referenced")), "", content.NoCompression)
+	require.NoError(t, err)
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	ci, err := env.RepositoryWriter.ContentManager().ContentInfo(ctx, cid)
+	require.NoError(t, err)
+
+	prefixes := []blob.ID{"p", "q", "s"}
+
+	var pending []blob.Metadata
+
+	for _, id := range append(append([]blob.ID{}, orphaned...), ci.GetPackBlobID()) {
+		bm, err := env.RepositoryWriter.BlobStorage().GetMetadata(ctx, id)
+		require.NoError(t, err)
+
+		pending = append(pending, bm)
+	}
+
+	// the second orphaned blob is too new to be deleted.
+	now := env.RepositoryWriter.Time()
+	pending[0].Timestamp = now.Add(-2 * time.Hour)
+	pending[1].Timestamp = now.Add(-10 * time.Minute)
+
+	require.NoError(t, putBlobGCBatch(ctx, env.RepositoryWriter, &blobGCBatch{
+		blobID:  blobGCBatchID(prefixes, 0),
+		Pending: pending,
+	}))
+
+	safety := SafetyNone
+	safety.BlobDeleteMinAge = time.Hour
+
+	st := &deleteRecordingStorage{Storage: env.RepositoryWriter.BlobStorage()}
+
+	n, err := deleteUnreferencedBlobs(ctx, env.RepositoryWriter, st, DeleteUnreferencedBlobsOptions{
+		NotAfterTime: now,
+	}, safety)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, []blob.ID{orphaned[0]}, st.deleted)
+
+	_, err = env.RepositoryWriter.BlobStorage().GetMetadata(ctx, ci.GetPackBlobID())
+	require.NoError(t, err)
+
+	batches, err := getBlobGCBatches(ctx, env.RepositoryWriter, prefixes)
+	require.NoError(t, err)
+	require.Empty(t, batches)
+}
@@ -0,0 +1,117 @@
+package maintenance
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/blob"
+)
+
+const blobGCProgressBlobIDPrefix = "kopia.blobgc."
+
+//nolint:gochecknoglobals
+var blobGCProgressAEADExtraData = []byte("blobgc")
+
+// blobGCBatch is a persisted batch of unreferenced blobs that remain to be deleted, which allows
+// interrupted garbage collection to be resumed without scanning the repository again.
+type blobGCBatch struct {
+	blobID blob.ID
+
+	Pending []blob.Metadata `json:"pending"`
+}
+
+// blobGCProgressPrefix returns the prefix of blobs holding progress of garbage collection of blobs with provided prefixes.
+func blobGCProgressPrefix(prefixes []blob.ID) blob.ID {
+	var sb strings.Builder
+
+	for _, p := range prefixes {
+		sb.WriteString(string(p))
+		sb.WriteString("/")
+	}
+
+	return blob.ID(blobGCProgressBlobIDPrefix + hex.EncodeToString([]byte(sb.String())) + ".")
+}
+
+// getBlobGCBatches returns the persisted batches of blobs that remain to be deleted, in order.
+func getBlobGCBatches(ctx context.Context, rep repo.DirectRepository, prefixes []blob.ID) ([]*blobGCBatch, error) {
+	bms, err := blob.ListAllBlobs(ctx, rep.BlobReader(), blobGCProgressPrefix(prefixes))
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing blob GC progress")
+	}
+
+	sort.Slice(bms, func(i, j int) bool {
+		return bms[i].BlobID < bms[j].BlobID
+	})
+
+	var result []*blobGCBatch
+
+	for _, bm := range bms {
+		b, err := getBlobGCBatch(ctx, rep, bm.BlobID)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, b)
+	}
+
+	return result, nil
+}
+
+func getBlobGCBatch(ctx context.Context, rep repo.DirectRepository, blobID blob.ID) (*blobGCBatch, error) {
+	var tmp gather.WriteBuffer
+	defer tmp.Close()
+
+	if err := rep.BlobReader().GetBlob(ctx, blobID, 0, -1, &tmp); err != nil {
+		return nil, errors.Wrapf(err, "error reading blob GC progress %v", blobID)
+	}
+
+	j, err := decryptMaintenanceBlob(rep, tmp.ToByteSlice(), blobGCProgressAEADExtraData)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to decrypt blob GC progress %v", blobID)
+	}
+
+	b := &blobGCBatch{blobID: blobID}
+	if err := json.Unmarshal(j, b); err != nil {
+		return nil, errors.Wrapf(err, "malformed blob GC progress %v", blobID)
+	}
+
+	return b, nil
+}
+
+// blobGCBatchID returns the ID of the blob holding the batch with the provided sequence number.
+func blobGCBatchID(prefixes []blob.ID, seq int) blob.ID {
+	return blob.ID(fmt.Sprintf("%v%08d", blobGCProgressPrefix(prefixes), seq))
+}
+
+func putBlobGCBatch(ctx context.Context, rep repo.DirectRepositoryWriter, b *blobGCBatch) error {
+	v, err := json.Marshal(b)
+	if err != nil {
+		return errors.Wrap(err, "unable to serialize JSON")
+	}
+
+	ciphertext, err := encryptMaintenanceBlob(rep, v, blobGCProgressAEADExtraData)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(
+		rep.BlobStorage().PutBlob(ctx, b.blobID, gather.FromSlice(ciphertext), blob.PutOptions{}),
+		"unable to write blob GC progress")
+}
+
+func deleteBlobGCBatch(ctx context.Context, rep repo.DirectRepositoryWriter, b *blobGCBatch) error {
+	err := rep.BlobStorage().DeleteBlob(ctx, b.blobID)
+	if err != nil && !errors.Is(err, blob.ErrBlobNotFound) {
+		return errors.Wrap(err, "unable to delete blob GC progress")
+	}
+
+	return nil
+}
@@ -3,19 +3,34 @@
 import (
 	"context"
 
+	"github.com/pkg/errors"
+
 	"github.com/kopia/kopia/repo/content"
 )
 
+const maxSmallBlobsForIndexCompaction = 8
+
 // runTaskIndexCompactionQuick rewrites index blobs to reduce their count but does not drop any contents.
 func runTaskIndexCompactionQuick(ctx context.Context, runParams RunParameters, s *Schedule, safety SafetyParameters) error {
 	return ReportRun(ctx, runParams.rep, TaskIndexCompaction, s, func() error {
 		log(ctx).Infof("Compacting indexes...")
 
-		const maxSmallBlobsForIndexCompaction = 8
+		maxSmallBlobs := maxSmallBlobsForIndexCompaction
+
+		needed, reason, err := runParams.rep.ContentManager().NeedsCompaction(ctx, content.DefaultCompactionThresholds)
+		if err != nil {
+			return errors.Wrap(err, "unable to determine whether index compaction is needed")
+		}
+
+		if needed {
+			log(ctx).Infof("Compacting all indexes: %v", reason)
+
+			maxSmallBlobs = 1
+		}
 
 		//nolint:wrapcheck
 		return runParams.rep.ContentManager().CompactIndexes(ctx, content.CompactOptions{
-			MaxSmallBlobs:                    maxSmallBlobsForIndexCompaction,
+			MaxSmallBlobs:                    maxSmallBlobs,
 			DisableEventualConsistencySafety: safety.DisableEventualConsistencySafety,
 		})
 	})
@@ -23,6 +23,8 @@ type Params struct {
 	FullCycle  CycleParams `json:"full"`
 
 	LogRetention LogRetentionOptions `json:"logRetention"`
+
+	BlobDeletion BlobDeletionParams `json:"blobDeletion"`
 }
 
 func (p *Params) isOwnedByByThisUser(rep repo.Repository) bool {
@@ -50,6 +52,12 @@ type CycleParams struct {
 	Interval time.Duration `json:"interval"`
 }
 
+// BlobDeletionParams specifies how unreferenced blobs are deleted during maintenance.
+type BlobDeletionParams struct {
+	Parallel            int     `json:"parallel,omitempty"`
+	MaxDeletesPerSecond float64 `json:"maxDeletesPerSecond,omitempty"`
+}
+
 // HasParams determines whether repository-wide maintenance parameters have been set.
 func HasParams(ctx context.Context, rep repo.Repository) (bool, error) {
 	md, err := manifestIDs(ctx, rep)
@@ -9,7 +9,6 @@
 	"github.com/gofrs/flock"
 	"github.com/pkg/errors"
 
-	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/content/index"
@@ -290,7 +289,7 @@ func runQuickMaintenance(ctx context.Context, runParams RunParameters, safety Sa
 			return errors.Wrap(err, "error deleting unreferenced metadata blobs")
 		}
 	} else {
-		notDeletingOrphanedBlobs(ctx, s, safety)
+		notDeletingOrphanedBlobs(ctx, runParams.rep.Time(), s, safety)
 	}
 
 	// consolidate many smaller indexes into fewer larger ones.
@@ -309,8 +308,8 @@ func notRewritingContents(ctx context.Context) {
 	log(ctx).Infof("Previous content rewrite has not been finalized yet, waiting until the next blob deletion.")
 }
 
-func notDeletingOrphanedBlobs(ctx context.Context, s *Schedule, safety SafetyParameters) {
-	left := nextBlobDeleteTime(s, safety).Sub(clock.Now()).Truncate(time.Second)
+func notDeletingOrphanedBlobs(ctx context.Context, now time.Time, s *Schedule, safety SafetyParameters) {
+	left := nextBlobDeleteTime(s, safety).Sub(now).Truncate(time.Second)
 
 	log(ctx).Infof("Skipping blob deletion because not enough time has passed yet (%v left).", left)
 }
@@ -384,7 +383,9 @@ func runTaskRewriteContentsFull(ctx context.Context, runParams RunParameters, s
 func runTaskDeleteOrphanedBlobsFull(ctx context.Context, runParams RunParameters, s *Schedule, safety SafetyParameters) error {
 	return ReportRun(ctx, runParams.rep, TaskDeleteOrphanedBlobsFull, s, func() error {
 		_, err := DeleteUnreferencedBlobs(ctx, runParams.rep, DeleteUnreferencedBlobsOptions{
-			NotAfterTime: runParams.MaintenanceStartTime,
+			NotAfterTime:     runParams.MaintenanceStartTime,
+			DeleteParallel:   runParams.Params.BlobDeletion.Parallel,
+			DeletesPerSecond: runParams.Params.BlobDeletion.MaxDeletesPerSecond,
 		}, safety)
 		return err
 	})
@@ -393,8 +394,10 @@ func runTaskDeleteOrphanedBlobsFull(ctx context.Context, runParams RunParameters
 func runTaskDeleteOrphanedBlobsQuick(ctx context.Context, runParams RunParameters, s *Schedule, safety SafetyParameters) error {
 	return ReportRun(ctx, runParams.rep, TaskDeleteOrphanedBlobsQuick, s, func() error {
 		_, err := DeleteUnreferencedBlobs(ctx, runParams.rep, DeleteUnreferencedBlobsOptions{
-			NotAfterTime: runParams.MaintenanceStartTime,
-			Prefix:       content.PackBlobIDPrefixSpecial,
+			NotAfterTime:     runParams.MaintenanceStartTime,
+			Prefix:           content.PackBlobIDPrefixSpecial,
+			DeleteParallel:   runParams.Params.BlobDeletion.Parallel,
+			DeletesPerSecond: runParams.Params.BlobDeletion.MaxDeletesPerSecond,
 		}, safety)
 		return err
 	})
@@ -428,7 +431,7 @@ func runFullMaintenance(ctx context.Context, runParams RunParameters, safety Saf
 			return errors.Wrap(err, "error deleting unreferenced blobs")
 		}
 	} else {
-		notDeletingOrphanedBlobs(ctx, s, safety)
+		notDeletingOrphanedBlobs(ctx, runParams.rep.Time(), s, safety)
 	}
 
 	if err := runTaskCleanupLogs(ctx, runParams, s); err != nil {
@@ -71,6 +71,39 @@ func getAES256GCM(rep repo.DirectRepository) (cipher.AEAD, error) {
 	return cipher.NewGCM(c)
 }
 
+// encryptMaintenanceBlob encrypts the provided data with AES-256-GCM and random nonce.
+func encryptMaintenanceBlob(rep repo.DirectRepository, data, extraData []byte) ([]byte, error) {
+	c, err := getAES256GCM(rep)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get cipher")
+	}
+
+	// generate random nonce
+	nonce := make([]byte, c.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "unable to initialize nonce")
+	}
+
+	result := append([]byte(nil), nonce...)
+
+	return c.Seal(result, nonce, data, extraData), nil
+}
+
+// decryptMaintenanceBlob decrypts the data encrypted using encryptMaintenanceBlob().
+func decryptMaintenanceBlob(rep repo.DirectRepository, v, extraData []byte) ([]byte, error) {
+	c, err := getAES256GCM(rep)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get cipher")
+	}
+
+	if len(v) < c.NonceSize() {
+		return nil, errors.Errorf("invalid blob")
+	}
+
+	//nolint:wrapcheck
+	return c.Open(nil, v[0:c.NonceSize()], v[c.NonceSize():], extraData)
+}
+
 // TimeToAttemptNextMaintenance returns the time when we should attempt next maintenance.
 func TimeToAttemptNextMaintenance(ctx context.Context, rep repo.DirectRepository, max time.Time) (time.Time, error) {
 	mp, err := GetParams(ctx, rep)
@@ -122,18 +155,7 @@ func GetSchedule(ctx context.Context, rep repo.DirectRepository) (*Schedule, err
 	}
 
 	// decrypt
-	c, err := getAES256GCM(rep)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to get cipher")
-	}
-
-	v := tmp.ToByteSlice()
-
-	if len(v) < c.NonceSize() {
-		return nil, errors.Errorf("invalid schedule blob")
-	}
-
-	j, err := c.Open(nil, v[0:c.NonceSize()], v[c.NonceSize():], maintenanceScheduleAEADExtraData)
+	j, err := decryptMaintenanceBlob(rep, tmp.ToByteSlice(), maintenanceScheduleAEADExtraData)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to decrypt schedule blob")
 	}
@@ -155,21 +177,11 @@ func SetSchedule(ctx context.Context, rep repo.DirectRepositoryWriter, s *Schedu
 		return errors.Wrap(err, "unable to serialize JSON")
 	}
 
-	// encrypt with AES-256-GCM and random nonce
-	c, err := getAES256GCM(rep)
+	ciphertext, err := encryptMaintenanceBlob(rep, v, maintenanceScheduleAEADExtraData)
 	if err != nil {
-		return errors.Wrap(err, "unable to get cipher")
-	}
-
-	// generate random nonce
-	nonce := make([]byte, c.NonceSize())
-	if _, err := rand.Read(nonce); err != nil {
-		return errors.Wrap(err, "unable to initialize nonce")
+		return err
 	}
 
-	result := append([]byte(nil), nonce...)
-	ciphertext := c.Seal(result, nonce, v, maintenanceScheduleAEADExtraData)
-
 	//nolint:wrapcheck
 	return rep.BlobStorage().PutBlob(ctx, maintenanceScheduleBlobID, gather.FromSlice(ciphertext), blob.PutOptions{})
 }
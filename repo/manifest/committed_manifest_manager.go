@@ -33,6 +33,8 @@ type committedManifestManager struct {
 	committedEntries map[ID]*manifestEntry
 	// +checklocks:cmmu
 	committedContentIDs map[content.ID]bool
+	// +checklocks:cmmu
+	entryContentIDs map[ID]content.ID // content storing each committed entry
 }
 
 func (m *committedManifestManager) getCommittedEntryOrNil(ctx context.Context, id ID) (*manifestEntry, error) {
@@ -46,6 +48,24 @@ func (m *committedManifestManager) getCommittedEntryOrNil(ctx context.Context, i
 	return m.committedEntries[id], nil
 }
 
+// getCommittedContentID returns the ID of the content storing the committed entry with the provided ID.
+func (m *committedManifestManager) getCommittedContentID(ctx context.Context, id ID) (content.ID, bool, error) {
+	m.lock()
+	defer m.unlock()
+
+	if err := m.ensureInitializedLocked(ctx); err != nil {
+		return content.EmptyID, false, err
+	}
+
+	if e := m.committedEntries[id]; e == nil || e.Deleted {
+		return content.EmptyID, false, nil
+	}
+
+	cid, ok := m.entryContentIDs[id]
+
+	return cid, ok, nil
+}
+
 // +checklocks:m.cmmu
 func (m *committedManifestManager) dump(ctx context.Context, prefix string) {
 	if m.debugID == "" {
@@ -119,6 +139,7 @@ func (m *committedManifestManager) writeEntriesLocked(ctx context.Context, entri
 
 	for _, e := range entries {
 		m.committedEntries[e.ID] = e
+		m.entryContentIDs[e.ID] = contentID
 		delete(entries, e.ID)
 	}
 
@@ -186,14 +207,17 @@ func (m *committedManifestManager) loadCommittedContentsLocked(ctx context.Conte
 func (m *committedManifestManager) loadManifestContentsLocked(manifests map[content.ID]manifest) {
 	m.committedEntries = map[ID]*manifestEntry{}
 	m.committedContentIDs = map[content.ID]bool{}
+	m.entryContentIDs = map[ID]content.ID{}
 
 	for contentID := range manifests {
 		m.committedContentIDs[contentID] = true
 	}
 
-	for _, man := range manifests {
+	for contentID, man := range manifests {
 		for _, e := range man.Entries {
-			m.mergeEntryLocked(e)
+			if m.mergeEntryLocked(e) {
+				m.entryContentIDs[e.ID] = contentID
+			}
 		}
 	}
 
@@ -201,6 +225,7 @@ func (m *committedManifestManager) loadManifestContentsLocked(manifests map[cont
 	for k, e := range m.committedEntries {
 		if e.Deleted {
 			delete(m.committedEntries, k)
+			delete(m.entryContentIDs, k)
 		}
 	}
 }
@@ -275,19 +300,24 @@ func (m *committedManifestManager) compactLocked(ctx context.Context) error {
 	return nil
 }
 
+// mergeEntryLocked merges the provided entry into committed entries and returns true if it has replaced
+// the previous entry with the same ID.
 // +checklocks:m.cmmu
-func (m *committedManifestManager) mergeEntryLocked(e *manifestEntry) {
+func (m *committedManifestManager) mergeEntryLocked(e *manifestEntry) bool {
 	m.verifyLocked()
 
 	prev := m.committedEntries[e.ID]
 	if prev == nil {
 		m.committedEntries[e.ID] = e
-		return
+		return true
 	}
 
 	if e.ModTime.After(prev.ModTime) {
 		m.committedEntries[e.ID] = e
+		return true
 	}
+
+	return false
 }
 
 // +checklocks:m.cmmu
@@ -364,5 +394,6 @@ func newCommittedManager(b contentManager) *committedManifestManager {
 		debugID:             debugID,
 		committedEntries:    map[ID]*manifestEntry{},
 		committedContentIDs: map[content.ID]bool{},
+		entryContentIDs:     map[ID]content.ID{},
 	}
 }
@@ -2,8 +2,10 @@
 package manifest
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"sort"
@@ -14,6 +16,7 @@
 
 	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/compression"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/logging"
@@ -44,6 +47,7 @@ type contentManager interface {
 	WriteContent(ctx context.Context, data gather.Bytes, prefix content.IDPrefix, comp compression.HeaderID) (content.ID, error)
 	DeleteContent(ctx context.Context, contentID content.ID) error
 	IterateContents(ctx context.Context, options content.IterateOptions, callback content.IterateCallback) error
+	ContentInfo(ctx context.Context, contentID content.ID) (content.Info, error)
 	DisableIndexFlush(ctx context.Context)
 	EnableIndexFlush(ctx context.Context)
 	Flush(ctx context.Context) error
@@ -62,7 +66,8 @@ type Manager struct {
 
 	committed *committedManifestManager
 
-	timeNow func() time.Time // Time provider
+	timeNow    func() time.Time // Time provider
+	signingKey []byte           // key used to sign manifests for external transport
 }
 
 // Put serializes the provided payload to JSON and persists it. Returns unique identifier that represents the manifest.
@@ -122,6 +127,123 @@ func (m *Manager) Get(ctx context.Context, id ID, data interface{}) (*EntryMetad
 	return cloneEntryMetadata(e), nil
 }
 
+// GetArrayStream retrieves the manifest item, which must be a JSON array, and invokes the callback
+// for each of its elements in order, so that callers can process huge arrays one element at a time
+// instead of deserializing all of them at once. Note that the serialized item itself is always held
+// in memory, as manifest contents are loaded in their entirety.
+// Iteration stops at the first error returned by the callback.
+func (m *Manager) GetArrayStream(ctx context.Context, id ID, cb func(element json.RawMessage) error) (*EntryMetadata, error) {
+	e, err := m.getPendingOrCommitted(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(e.Content))
+
+	if err := expectDelim(dec, '['); err != nil {
+		return nil, errors.Wrapf(err, "invalid array %q", id)
+	}
+
+	for dec.More() {
+		var element json.RawMessage
+
+		if err := dec.Decode(&element); err != nil {
+			return nil, errors.Wrapf(err, "unable to unmarshal element of %q", id)
+		}
+
+		if err := cb(element); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := expectDelim(dec, ']'); err != nil {
+		return nil, errors.Wrapf(err, "invalid array %q", id)
+	}
+
+	return cloneEntryMetadata(e), nil
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return errors.Wrap(err, "error reading token")
+	}
+
+	if t != want {
+		return errors.Errorf("unexpected token %v, want %v", t, want)
+	}
+
+	return nil
+}
+
+// MultiGetStream retrieves the raw JSON payloads of the provided manifest items using parallel workers
+// and invokes the callback for each item as soon as it becomes available, which allows callers to
+// process and discard large items without holding all of them in memory.
+// The callback is invoked exactly once per item (in no particular order) and never concurrently.
+// Items that can't be retrieved are reported to the callback with a non-nil error.
+func (m *Manager) MultiGetStream(ctx context.Context, ids []ID, cb func(id ID, payload []byte, err error)) {
+	var (
+		cbMutex sync.Mutex
+		wg      sync.WaitGroup
+	)
+
+	work := make(chan ID)
+
+	for i := 0; i < manifestLoadParallelism; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for id := range work {
+				var payload []byte
+
+				e, err := m.getPendingOrCommitted(ctx, id)
+				if err == nil {
+					payload = append([]byte(nil), e.Content...)
+				}
+
+				cbMutex.Lock()
+				cb(id, payload, err)
+				cbMutex.Unlock()
+			}
+		}()
+	}
+
+	for _, id := range ids {
+		work <- id
+	}
+
+	close(work)
+	wg.Wait()
+}
+
+// MultiGet retrieves the raw JSON payloads of the provided manifest items.
+// Returns the first error encountered, if any.
+func (m *Manager) MultiGet(ctx context.Context, ids []ID) (map[ID][]byte, error) {
+	var firstErr error
+
+	result := map[ID][]byte{}
+
+	m.MultiGetStream(ctx, ids, func(id ID, payload []byte, err error) {
+		if err != nil {
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "error getting %v", id)
+			}
+
+			return
+		}
+
+		result[id] = payload
+	})
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	return result, nil
+}
+
 func (m *Manager) getPendingOrCommitted(ctx context.Context, id ID) (*manifestEntry, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -187,6 +309,55 @@ func (m *Manager) Find(ctx context.Context, labels map[string]string) ([]*EntryM
 	return matches, nil
 }
 
+// FindPage is like Find but returns at most 'limit' entries ordered by ID, starting after the provided cursor.
+// The returned cursor is opaque and must be passed to the next call to retrieve the following page,
+// an empty cursor is returned after the last page and must also be used to request the first one.
+func (m *Manager) FindPage(ctx context.Context, labels map[string]string, cursor string, limit int) (entries []*EntryMetadata, nextCursor string, err error) {
+	if limit <= 0 {
+		return nil, "", errors.Errorf("invalid page limit: %v", limit)
+	}
+
+	after, err := decodePageCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	matches, err := m.Find(ctx, labels)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].ID < matches[j].ID
+	})
+
+	start := sort.Search(len(matches), func(i int) bool {
+		return matches[i].ID > after
+	})
+
+	matches = matches[start:]
+	if len(matches) <= limit {
+		return matches, "", nil
+	}
+
+	matches = matches[:limit]
+
+	return matches, encodePageCursor(matches[limit-1].ID), nil
+}
+
+func encodePageCursor(after ID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(after))
+}
+
+func decodePageCursor(cursor string) (ID, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid page cursor")
+	}
+
+	return ID(b), nil
+}
+
 func cloneEntryMetadata(e *manifestEntry) *EntryMetadata {
 	return &EntryMetadata{
 		ID:      e.ID,
@@ -246,6 +417,36 @@ func (m *Manager) Delete(ctx context.Context, id ID) error {
 	return nil
 }
 
+// ResolveStorageKey returns the ID of the pack blob storing the manifest with the provided ID.
+// Manifests are aggregated into shared contents, so manifests committed together resolve to the same blob.
+// Pending manifests must be flushed first and the returned blob is only present in the storage after
+// the underlying content manager has also been flushed.
+func (m *Manager) ResolveStorageKey(ctx context.Context, id ID) (blob.ID, error) {
+	m.mu.Lock()
+	pending := m.pendingEntries[id]
+	m.mu.Unlock()
+
+	if pending != nil {
+		return "", errors.Errorf("manifest %v has not been flushed", id)
+	}
+
+	cid, ok, err := m.committed.getCommittedContentID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return "", errors.Wrapf(ErrNotFound, "manifest %v", id)
+	}
+
+	ci, err := m.b.ContentInfo(ctx, cid)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to get info for content %v storing manifest %v", cid, id)
+	}
+
+	return ci.GetPackBlobID(), nil
+}
+
 // Compact performs compaction of manifest contents.
 func (m *Manager) Compact(ctx context.Context) error {
 	return m.committed.compact(ctx)
@@ -262,7 +463,8 @@ func copyLabels(m map[string]string) map[string]string {
 
 // ManagerOptions are optional parameters for Manager creation.
 type ManagerOptions struct {
-	TimeNow func() time.Time // Time provider
+	TimeNow    func() time.Time // Time provider
+	SigningKey []byte           // Key used by GetSigned() and VerifySigned()
 }
 
 // NewManager returns new manifest manager for the provided content manager.
@@ -276,6 +478,7 @@ func NewManager(ctx context.Context, b contentManager, options ManagerOptions) (
 		b:              b,
 		pendingEntries: map[ID]*manifestEntry{},
 		timeNow:        timeNow,
+		signingKey:     options.SigningKey,
 		committed:      newCommittedManager(b),
 	}
 
@@ -15,6 +15,7 @@
 	"github.com/kopia/kopia/internal/blobtesting"
 	"github.com/kopia/kopia/internal/testlogging"
 	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/content/index"
 	"github.com/kopia/kopia/repo/encryption"
@@ -22,6 +23,8 @@
 	"github.com/kopia/kopia/repo/hashing"
 )
 
+var errSomeError = errors.Errorf("some error")
+
 func TestMain(m *testing.M) { testutil.MyTestMain(m) }
 
 func TestManifest(t *testing.T) {
@@ -373,3 +376,335 @@ func TestManifestAutoCompaction(t *testing.T) {
 		require.NoError(t, mgr.b.Flush(ctx))
 	}
 }
+
+func TestManifestResolveStorageKey(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+
+	mgr := newManagerForTesting(ctx, t, data)
+
+	listedBlobs := func() map[blob.ID]bool {
+		result := map[blob.ID]bool{}
+
+		require.NoError(t, blobtesting.NewMapStorage(data, nil, nil).ListBlobs(ctx, "", func(bm blob.Metadata) error {
+			result[bm.BlobID] = true
+			return nil
+		}))
+
+		return result
+	}
+
+	flush := func(mgr *Manager) {
+		require.NoError(t, mgr.Flush(ctx))
+		require.NoError(t, mgr.b.Flush(ctx))
+	}
+
+	id1 := addAndVerify(ctx, t, mgr, map[string]string{"type": "item"}, map[string]int{"foo": 1})
+
+	// pending manifests are not stored anywhere yet.
+	_, err := mgr.ResolveStorageKey(ctx, id1)
+	require.Error(t, err)
+
+	flush(mgr)
+
+	key1, err := mgr.ResolveStorageKey(ctx, id1)
+	require.NoError(t, err)
+	require.True(t, listedBlobs()[key1], "%v not listed", key1)
+
+	id2 := addAndVerify(ctx, t, mgr, map[string]string{"type": "item"}, map[string]int{"foo": 2})
+	flush(mgr)
+
+	key2, err := mgr.ResolveStorageKey(ctx, id2)
+	require.NoError(t, err)
+	require.True(t, listedBlobs()[key2], "%v not listed", key2)
+
+	// manifests loaded from the storage resolve to the same keys.
+	mgr2, err := NewManager(ctx, mgr.b, ManagerOptions{})
+	require.NoError(t, err)
+
+	for id, key := range map[ID]blob.ID{id1: key1, id2: key2} {
+		got, err := mgr2.ResolveStorageKey(ctx, id)
+		require.NoError(t, err)
+		require.Equal(t, key, got)
+	}
+
+	// after compaction both manifests are stored in the same blob.
+	require.NoError(t, mgr2.Compact(ctx))
+	flush(mgr2)
+
+	compacted1, err := mgr2.ResolveStorageKey(ctx, id1)
+	require.NoError(t, err)
+
+	compacted2, err := mgr2.ResolveStorageKey(ctx, id2)
+	require.NoError(t, err)
+	require.Equal(t, compacted1, compacted2)
+	require.True(t, listedBlobs()[compacted1], "%v not listed", compacted1)
+
+	require.NoError(t, mgr2.Delete(ctx, id1))
+	flush(mgr2)
+
+	_, err = mgr2.ResolveStorageKey(ctx, id1)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	_, err = mgr2.ResolveStorageKey(ctx, "no-such-manifest")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestManifestMultiGetStream(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	mgr := newManagerForTesting(ctx, t, data)
+
+	var ids []ID
+
+	for i := 0; i < 50; i++ {
+		ids = append(ids, addAndVerify(ctx, t, mgr, map[string]string{"type": "item"}, map[string]int{"foo": i}))
+
+		if i == 25 {
+			// half of the items are committed, the other half pending.
+			require.NoError(t, mgr.Flush(ctx))
+		}
+	}
+
+	missingID := ID("no-such-manifest")
+
+	callCount := map[ID]int{}
+	payloads := map[ID][]byte{}
+	errs := map[ID]error{}
+
+	mgr.MultiGetStream(ctx, append(append([]ID(nil), ids...), missingID), func(id ID, payload []byte, err error) {
+		callCount[id]++
+		payloads[id] = payload
+		errs[id] = err
+	})
+
+	require.Len(t, callCount, len(ids)+1)
+
+	for i, id := range ids {
+		require.Equal(t, 1, callCount[id])
+		require.NoError(t, errs[id])
+
+		var v map[string]int
+
+		require.NoError(t, json.Unmarshal(payloads[id], &v))
+		require.Equal(t, i, v["foo"])
+	}
+
+	require.Equal(t, 1, callCount[missingID])
+	require.ErrorIs(t, errs[missingID], ErrNotFound)
+
+	all, err := mgr.MultiGet(ctx, ids)
+	require.NoError(t, err)
+	require.Len(t, all, len(ids))
+
+	_, err = mgr.MultiGet(ctx, []ID{ids[0], missingID})
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestManifestGetArrayStream(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	mgr := newManagerForTesting(ctx, t, data)
+
+	type element struct {
+		Name  string            `json:"name"`
+		Index int               `json:"index"`
+		Attrs map[string]string `json:"attrs"`
+	}
+
+	var large []element
+
+	for i := 0; i < 10000; i++ {
+		large = append(large, element{
+			Name:  strings.Repeat("x", i%100),
+			Index: i,
+			Attrs: map[string]string{"key": strings.Repeat("v", i%10)},
+		})
+	}
+
+	id, err := mgr.Put(ctx, map[string]string{"type": "large"}, large)
+	require.NoError(t, err)
+
+	verify := func() {
+		var buffered []element
+
+		_, err := mgr.Get(ctx, id, &buffered)
+		require.NoError(t, err)
+		require.Equal(t, large, buffered)
+
+		var elements []element
+
+		md, err := mgr.GetArrayStream(ctx, id, func(raw json.RawMessage) error {
+			var e element
+
+			if err := json.Unmarshal(raw, &e); err != nil {
+				return err
+			}
+
+			elements = append(elements, e)
+
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, id, md.ID)
+		require.Equal(t, buffered, elements)
+	}
+
+	// pending and committed.
+	verify()
+	require.NoError(t, mgr.Flush(ctx))
+	verify()
+
+	// callback errors stop the iteration.
+	var calls int
+
+	_, err = mgr.GetArrayStream(ctx, id, func(raw json.RawMessage) error {
+		calls++
+		return errSomeError
+	})
+	require.ErrorIs(t, err, errSomeError)
+	require.Equal(t, 1, calls)
+
+	// non-array items are rejected.
+	objID := addAndVerify(ctx, t, mgr, map[string]string{"type": "item"}, map[string]int{"foo": 1})
+
+	_, err = mgr.GetArrayStream(ctx, objID, func(raw json.RawMessage) error { return nil })
+	require.Error(t, err)
+
+	_, err = mgr.GetArrayStream(ctx, "no-such-manifest", func(raw json.RawMessage) error { return nil })
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestManifestSigned(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	mgr := newManagerForTesting(ctx, t, data)
+
+	id := addAndVerify(ctx, t, mgr, map[string]string{"type": "policy"}, map[string]int{"foo": 1, "bar": 2})
+
+	_, err := mgr.GetSigned(ctx, id)
+	require.Error(t, err, "signing key is required")
+
+	mgr.signingKey = []byte("some-signing-key")
+
+	signed, err := mgr.GetSigned(ctx, id)
+	require.NoError(t, err)
+
+	md, content, err := mgr.VerifySigned(signed)
+	require.NoError(t, err)
+	require.Equal(t, id, md.ID)
+	require.Equal(t, map[string]string{"type": "policy"}, md.Labels)
+
+	var v map[string]int
+
+	require.NoError(t, json.Unmarshal(content, &v))
+	require.Equal(t, map[string]int{"foo": 1, "bar": 2}, v)
+
+	// tampering with any part of the envelope invalidates the signature.
+	var sm signedManifest
+
+	require.NoError(t, json.Unmarshal(signed, &sm))
+
+	for name, tamper := range map[string]func(sm *signedManifest){
+		"payload":   func(sm *signedManifest) { sm.Payload[len(sm.Payload)/2] ^= 1 },
+		"signature": func(sm *signedManifest) { sm.Signature[0] ^= 1 },
+		"id":        func(sm *signedManifest) { sm.ID = "other-id" },
+		"label":     func(sm *signedManifest) { sm.Labels["type"] = "snapshot" },
+		"new label": func(sm *signedManifest) { sm.Labels["extra"] = "x" },
+		"version":   func(sm *signedManifest) { sm.Version++ },
+	} {
+		tampered := sm
+		tampered.Payload = append([]byte(nil), sm.Payload...)
+		tampered.Signature = append([]byte(nil), sm.Signature...)
+		tampered.Labels = copyLabels(sm.Labels)
+
+		tamper(&tampered)
+
+		b, err := json.Marshal(tampered)
+		require.NoError(t, err)
+
+		_, _, err = mgr.VerifySigned(b)
+		require.ErrorIs(t, err, ErrInvalidSignature, name)
+	}
+
+	_, _, err = mgr.VerifySigned([]byte("not-json"))
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	// different key.
+	mgr.signingKey = []byte("other-signing-key")
+
+	_, _, err = mgr.VerifySigned(signed)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	_, err = mgr.GetSigned(ctx, "no-such-manifest")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestManifestFindPage(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data := blobtesting.DataMap{}
+	mgr := newManagerForTesting(ctx, t, data)
+
+	const (
+		numItems = 1000
+		pageSize = 37
+	)
+
+	expected := map[ID]bool{}
+
+	for i := 0; i < numItems; i++ {
+		id, err := mgr.Put(ctx, map[string]string{"type": "item"}, i)
+		require.NoError(t, err)
+
+		expected[id] = true
+
+		// flush half-way through to have a mix of committed and pending entries.
+		if i == numItems/2 {
+			require.NoError(t, mgr.Flush(ctx))
+		}
+	}
+
+	_, err := mgr.Put(ctx, map[string]string{"type": "other"}, 1)
+	require.NoError(t, err)
+
+	seen := map[ID]bool{}
+
+	var (
+		cursor  string
+		lastID  ID
+		numPage int
+	)
+
+	for {
+		page, next, err := mgr.FindPage(ctx, map[string]string{"type": "item"}, cursor, pageSize)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(page), pageSize)
+
+		for _, e := range page {
+			require.False(t, seen[e.ID], "duplicate %v", e.ID)
+			require.Greater(t, e.ID, lastID)
+
+			seen[e.ID] = true
+			lastID = e.ID
+		}
+
+		numPage++
+
+		if next == "" {
+			break
+		}
+
+		require.Len(t, page, pageSize)
+
+		cursor = next
+	}
+
+	require.Equal(t, expected, seen)
+	require.Equal(t, (numItems+pageSize-1)/pageSize, numPage)
+
+	_, _, err = mgr.FindPage(ctx, nil, "", 0)
+	require.Error(t, err)
+
+	_, _, err = mgr.FindPage(ctx, nil, "!invalid!", 10)
+	require.Error(t, err)
+}
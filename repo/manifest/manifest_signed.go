@@ -0,0 +1,147 @@
+package manifest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidSignature is returned when a signed manifest item can't be verified.
+var ErrInvalidSignature = errors.Errorf("invalid manifest signature")
+
+const signedManifestVersion = 1
+
+// signedManifest is a self-contained representation of a manifest item suitable for
+// transport outside of the repository.
+type signedManifest struct {
+	Version   int               `json:"version"`
+	ID        ID                `json:"id"`
+	Labels    map[string]string `json:"labels"`
+	Payload   []byte            `json:"payload"`   // gzip-compressed contents of the manifest item
+	Signature []byte            `json:"signature"` // HMAC-SHA256 of all the fields above
+}
+
+// GetSigned returns the contents of the provided manifest item compressed and wrapped with a detached signature,
+// which can be shared out-of-band and later validated using VerifySigned().
+// The signature is independent of at-rest encryption of the repository.
+func (m *Manager) GetSigned(ctx context.Context, id ID) ([]byte, error) {
+	if len(m.signingKey) == 0 {
+		return nil, errors.Errorf("manifest signing key not configured")
+	}
+
+	e, err := m.getPendingOrCommitted(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+
+	if _, err := gz.Write(e.Content); err != nil {
+		return nil, errors.Wrap(err, "unable to compress manifest")
+	}
+
+	if err := gz.Close(); err != nil {
+		return nil, errors.Wrap(err, "unable to compress manifest")
+	}
+
+	sm := signedManifest{
+		Version: signedManifestVersion,
+		ID:      e.ID,
+		Labels:  copyLabels(e.Labels),
+		Payload: buf.Bytes(),
+	}
+
+	sm.Signature = m.sign(&sm)
+
+	b, err := json.Marshal(sm)
+
+	return b, errors.Wrap(err, "unable to marshal signed manifest")
+}
+
+// VerifySigned validates the signature of data returned by GetSigned() and returns the ID and labels
+// of the manifest item along with its contents.
+func (m *Manager) VerifySigned(data []byte) (*EntryMetadata, []byte, error) {
+	if len(m.signingKey) == 0 {
+		return nil, nil, errors.Errorf("manifest signing key not configured")
+	}
+
+	var sm signedManifest
+
+	if err := json.Unmarshal(data, &sm); err != nil {
+		return nil, nil, errors.Wrap(ErrInvalidSignature, "malformed signed manifest")
+	}
+
+	if sm.Version != signedManifestVersion {
+		return nil, nil, errors.Wrapf(ErrInvalidSignature, "unsupported signed manifest version %v", sm.Version)
+	}
+
+	if !hmac.Equal(sm.Signature, m.sign(&sm)) {
+		return nil, nil, ErrInvalidSignature
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(sm.Payload))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to decompress manifest")
+	}
+
+	defer gz.Close() //nolint:errcheck
+
+	content, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "unable to decompress manifest")
+	}
+
+	return &EntryMetadata{
+		ID:     sm.ID,
+		Labels: sm.Labels,
+		Length: len(content),
+	}, content, nil
+}
+
+// sign computes the signature of all fields of the provided signed manifest except for the signature itself,
+// each field is length-prefixed and labels are sorted, so that the encoding is unambiguous.
+func (m *Manager) sign(sm *signedManifest) []byte {
+	h := hmac.New(sha256.New, m.signingKey)
+
+	write := func(b []byte) {
+		var l [8]byte
+
+		binary.LittleEndian.PutUint64(l[:], uint64(len(b)))
+		h.Write(l[:]) //nolint:errcheck
+		h.Write(b)    //nolint:errcheck
+	}
+
+	write([]byte{byte(sm.Version)})
+	write([]byte(sm.ID))
+
+	keys := make([]string, 0, len(sm.Labels))
+	for k := range sm.Labels {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	var n [8]byte
+
+	binary.LittleEndian.PutUint64(n[:], uint64(len(keys)))
+	write(n[:])
+
+	for _, k := range keys {
+		write([]byte(k))
+		write([]byte(sm.Labels[k]))
+	}
+
+	write(sm.Payload)
+
+	return h.Sum(nil)
+}
@@ -1,5 +1,14 @@
 package object
 
+import "github.com/pkg/errors"
+
+// indirectStreamID identifies the stream of JSON-encoded index of an indirect object.
+const indirectStreamID = "kopia:indirect"
+
+// ErrMalformedIndirectObject is returned when the index of an indirect object is malformed,
+// for example truncated or with entries that are not contiguous, as opposed to errors reading the data it references.
+var ErrMalformedIndirectObject = errors.New("malformed indirect object index")
+
 // IndirectObjectEntry represents an entry in indirect object stream.
 type IndirectObjectEntry struct {
 	Start  int64 `json:"s,omitempty"`
@@ -11,6 +20,34 @@ func (i *IndirectObjectEntry) endOffset() int64 {
 	return i.Start + i.Length
 }
 
+// validateIndirectObject verifies that the index stream is recognized and that its entries
+// describe contiguous non-empty ranges starting at offset zero.
+func validateIndirectObject(ind *indirectObject) error {
+	if ind.StreamID != indirectStreamID {
+		return errors.Wrapf(ErrMalformedIndirectObject, "unrecognized stream %q", ind.StreamID)
+	}
+
+	var offset int64
+
+	for i, e := range ind.Entries {
+		if e.Start != offset {
+			return errors.Wrapf(ErrMalformedIndirectObject, "entry %v starts at %v, expected %v", i, e.Start, offset)
+		}
+
+		if e.Length < 0 {
+			return errors.Wrapf(ErrMalformedIndirectObject, "entry %v has negative length %v", i, e.Length)
+		}
+
+		if e.Object == EmptyID {
+			return errors.Wrapf(ErrMalformedIndirectObject, "entry %v has no object", i)
+		}
+
+		offset = e.endOffset()
+	}
+
+	return nil
+}
+
 /*
 
 {"stream":"kopia:indirect","entries":[
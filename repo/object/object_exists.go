@@ -0,0 +1,96 @@
+package object
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/kopia/kopia/repo/content"
+)
+
+// existsManyParallelism is the maximum number of concurrent content lookups performed by ExistsMany.
+const existsManyParallelism = 16
+
+type contentInfoReader interface {
+	ContentInfo(ctx context.Context, contentID content.ID) (content.Info, error)
+}
+
+// ExistsMany returns the presence of each of the provided objects in the repository.
+//
+// An object is present if the content holding its data, or its index for indirect objects, is present.
+// Objects backed by the same content, such as different levels of indirection, share a single lookup
+// and lookups of distinct contents are performed in parallel. Inline objects are always present.
+func ExistsMany(ctx context.Context, cr contentInfoReader, oids []ID) (map[ID]bool, error) {
+	result := make(map[ID]bool, len(oids))
+	byContent := map[content.ID][]ID{}
+
+	for _, oid := range oids {
+		if _, ok := oid.InlineData(); ok {
+			result[oid] = true
+			continue
+		}
+
+		cid, ok := topLevelContentID(oid)
+		if !ok {
+			return nil, errors.Errorf("unrecognized object type: %v", oid)
+		}
+
+		byContent[cid] = append(byContent[cid], oid)
+	}
+
+	var mu sync.Mutex
+
+	eg, ctx := errgroup.WithContext(ctx)
+	sem := make(chan struct{}, existsManyParallelism)
+
+	for cid, cidOIDs := range byContent {
+		// acquire semaphore
+		sem <- struct{}{}
+
+		cid, cidOIDs := cid, cidOIDs
+
+		eg.Go(func() error {
+			defer func() {
+				<-sem // release semaphore
+			}()
+
+			_, err := cr.ContentInfo(ctx, cid)
+			if err != nil && !errors.Is(err, content.ErrContentNotFound) {
+				return errors.Wrapf(err, "error getting content info for %v", cid)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			for _, oid := range cidOIDs {
+				result[oid] = err == nil
+			}
+
+			return nil
+		})
+	}
+
+	if err := eg.Wait(); err != nil {
+		return nil, errors.Wrap(err, "error checking object existence")
+	}
+
+	return result, nil
+}
+
+// topLevelContentID returns the ID of the content holding the data or the outermost index of the provided object.
+func topLevelContentID(oid ID) (content.ID, bool) {
+	for {
+		indexObjectID, ok := oid.IndexObjectID()
+		if !ok {
+			break
+		}
+
+		oid = indexObjectID
+	}
+
+	cid, _, ok := oid.ContentID()
+
+	return cid, ok
+}
@@ -9,6 +9,7 @@
 	"github.com/pkg/errors"
 
 	"github.com/kopia/kopia/internal/gather"
+	"github.com/kopia/kopia/internal/iocopy"
 	"github.com/kopia/kopia/repo/compression"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/format"
@@ -18,7 +19,16 @@
 // ErrObjectNotFound is returned when an object cannot be found.
 var ErrObjectNotFound = errors.New("object not found")
 
+// ErrObjectTooLarge is returned when the object being written exceeds the maximum object size.
+var ErrObjectTooLarge = errors.New("object too large")
+
+// ErrUnexpectedObjectID is returned by Writer.Result() when the object ID differs from WriterOptions.ExpectID.
+var ErrUnexpectedObjectID = errors.New("unexpected object ID")
+
 // Reader allows reading, seeking, getting the length of and closing of a repository object.
+//
+// Reader is not safe for concurrent use by multiple goroutines, but any number of readers for the same
+// or different objects may be opened and used concurrently from separate goroutines.
 type Reader interface {
 	io.Reader
 	io.Seeker
@@ -26,6 +36,13 @@ type Reader interface {
 	Length() int64
 }
 
+// ReaderAt is an optional interface implemented by readers which can read arbitrary ranges of the object
+// without affecting the current read position.
+type ReaderAt interface {
+	Reader
+	io.ReaderAt
+}
+
 type contentReader interface {
 	ContentInfo(ctx context.Context, contentID content.ID) (content.Info, error)
 	GetContent(ctx context.Context, contentID content.ID) ([]byte, error)
@@ -42,6 +59,9 @@ type contentManager interface {
 type Manager struct {
 	Format format.ObjectFormat
 
+	// IDFormatter, if set, assigns display labels to IDs of written objects.
+	IDFormatter *IDFormatter
+
 	contentMgr  contentManager
 	newSplitter splitter.Factory
 	writerPool  sync.Pool
@@ -51,14 +71,31 @@ type Manager struct {
 func (om *Manager) NewWriter(ctx context.Context, opt WriterOptions) Writer {
 	w, _ := om.writerPool.Get().(*objectWriter)
 	w.ctx = ctx
+	w.cancel = nil
+
+	if !opt.Deadline.IsZero() {
+		w.ctx, w.cancel = context.WithDeadline(ctx, opt.Deadline)
+	}
+
 	w.om = om
 	w.splitter = om.newSplitter()
 	w.description = opt.Description
+	w.expectID = opt.ExpectID
 	w.prefix = opt.Prefix
 	w.compressor = compression.ByName[opt.Compressor]
 	w.totalLength = 0
 	w.currentPosition = 0
 
+	w.maxSize = opt.MaxSize
+	if w.maxSize == 0 {
+		w.maxSize = om.Format.MaxObjectSize
+	}
+
+	w.inlineThreshold = om.Format.InlineContentThreshold
+	if opt.AllowInline && om.Format.InlineObjects {
+		w.inlineThreshold = MaxInlineObjectLength + 1
+	}
+
 	// point the slice at the embedded array, so that we avoid allocations most of the time
 	w.indirectIndex = w.indirectIndexBuf[:0]
 
@@ -134,6 +171,31 @@ func (om *Manager) Concatenate(ctx context.Context, objectIDs []ID) (ID, error)
 	return IndirectObjectID(concatID), nil
 }
 
+// Transcode copies the contents of the provided object to a new object written using the provided options
+// and returns its ID. This allows changing compression or content prefix of an individual object without
+// rewriting the entire repository.
+func (om *Manager) Transcode(ctx context.Context, src ID, opt WriterOptions) (ID, error) {
+	r, err := Open(ctx, om.contentMgr, src)
+	if err != nil {
+		return EmptyID, errors.Wrapf(err, "error opening %v", src)
+	}
+	defer r.Close() //nolint:errcheck
+
+	w := om.NewWriter(ctx, opt)
+	defer w.Close() //nolint:errcheck
+
+	if err := iocopy.JustCopy(w, r); err != nil {
+		return EmptyID, errors.Wrapf(err, "error copying %v", src)
+	}
+
+	oid, err := w.Result()
+	if err != nil {
+		return EmptyID, errors.Wrapf(err, "error writing transcoded %v", src)
+	}
+
+	return oid, nil
+}
+
 func appendIndexEntriesForObject(ctx context.Context, cr contentReader, indexEntries []IndirectObjectEntry, startingLength int64, objectID ID) (result []IndirectObjectEntry, totalLength int64, _ error) {
 	if indexObjectID, ok := objectID.IndexObjectID(); ok {
 		ndx, err := LoadIndexObject(ctx, cr, indexObjectID)
@@ -214,9 +276,13 @@ func NewObjectManager(ctx context.Context, bm contentManager, f format.ObjectFor
 		splitterID = "FIXED"
 	}
 
-	os := splitter.GetFactory(splitterID)
+	os, err := splitter.GetFactoryWithParameters(splitterID, f.SplitterParameters)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid splitter parameters")
+	}
+
 	if os == nil {
-		return nil, errors.Errorf("unsupported splitter %q", f.Splitter)
+		return nil, format.NewerVersionRequiredError{Format: splitterID}
 	}
 
 	om.newSplitter = splitter.Pooled(os)
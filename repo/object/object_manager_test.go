@@ -11,8 +11,11 @@
 	"math/rand"
 	"runtime"
 	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
@@ -23,7 +26,6 @@
 	"github.com/kopia/kopia/internal/impossible"
 	"github.com/kopia/kopia/internal/testlogging"
 	"github.com/kopia/kopia/internal/testutil"
-	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/compression"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/format"
@@ -42,6 +44,15 @@ type fakeContentManager struct {
 
 	supportsContentCompression bool
 	writeContentError          error
+	writeContentDelay          time.Duration // simulates slow storage, honors context cancellation
+	getContentDelay            time.Duration // simulates high-latency reads
+	getContentCount            int32         // number of GetContent calls, accessed atomically
+	contentInfoCount           int32         // number of ContentInfo calls, accessed atomically
+	remoteContentInfo          bool          // simulates content information fetched from a server
+}
+
+func (f *fakeContentManager) ContentInfoIsLocal() bool {
+	return !f.remoteContentInfo
 }
 
 func (f *fakeContentManager) PrefetchContents(ctx context.Context, contentIDs []content.ID, hint string) []content.ID {
@@ -49,6 +60,12 @@ func (f *fakeContentManager) PrefetchContents(ctx context.Context, contentIDs []
 }
 
 func (f *fakeContentManager) GetContent(ctx context.Context, contentID content.ID) ([]byte, error) {
+	atomic.AddInt32(&f.getContentCount, 1)
+
+	if f.getContentDelay > 0 {
+		time.Sleep(f.getContentDelay)
+	}
+
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
@@ -64,6 +81,14 @@ func (f *fakeContentManager) WriteContent(ctx context.Context, data gather.Bytes
 		return content.EmptyID, f.writeContentError
 	}
 
+	if f.writeContentDelay > 0 {
+		select {
+		case <-time.After(f.writeContentDelay):
+		case <-ctx.Done():
+			return content.EmptyID, ctx.Err()
+		}
+	}
+
 	h := sha256.New()
 	data.WriteTo(h)
 	contentID, err := content.IDFromHash(prefix, h.Sum(nil))
@@ -85,21 +110,29 @@ func (f *fakeContentManager) SupportsContentCompression() (bool, error) {
 }
 
 func (f *fakeContentManager) ContentInfo(ctx context.Context, contentID content.ID) (content.Info, error) {
+	atomic.AddInt32(&f.contentInfoCount, 1)
+
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
 	if d, ok := f.data[contentID]; ok {
-		return &content.InfoStruct{ContentID: contentID, PackedLength: uint32(len(d))}, nil
+		// contents are stored uncompressed, but report compression requested by the writer.
+		return &content.InfoStruct{
+			ContentID:           contentID,
+			PackedLength:        uint32(len(d)),
+			OriginalLength:      uint32(len(d)),
+			CompressionHeaderID: f.compresionIDs[contentID],
+		}, nil
 	}
 
-	return nil, blob.ErrBlobNotFound
+	return nil, content.ErrContentNotFound
 }
 
 func (f *fakeContentManager) Flush(ctx context.Context) error {
 	return nil
 }
 
-func setupTest(t *testing.T, compressionHeaderID map[content.ID]compression.HeaderID) (map[content.ID][]byte, *fakeContentManager, *Manager) {
+func setupTest(t testing.TB, compressionHeaderID map[content.ID]compression.HeaderID) (map[content.ID][]byte, *fakeContentManager, *Manager) {
 	t.Helper()
 
 	data := map[content.ID][]byte{}
@@ -111,7 +144,8 @@ func setupTest(t *testing.T, compressionHeaderID map[content.ID]compression.Head
 	}
 
 	r, err := NewObjectManager(testlogging.Context(t), fcm, format.ObjectFormat{
-		Splitter: "FIXED-1M",
+		Splitter:      "FIXED-1M",
+		InlineObjects: true,
 	})
 	if err != nil {
 		t.Fatalf("can't create object manager: %v", err)
@@ -165,6 +199,115 @@ func TestWriters(t *testing.T) {
 	}
 }
 
+func TestContentIDFormatter(t *testing.T) {
+	ctx := testlogging.Context(t)
+	_, _, om := setupTest(t, nil)
+
+	f := NewIDFormatter(func(description string) string {
+		return strings.ToLower(strings.ReplaceAll(description, " ", "-"))
+	})
+
+	om.IDFormatter = f
+
+	w := om.NewWriter(ctx, WriterOptions{Description: "Formatter Test"})
+	w.Write([]byte("content id formatter test data"))
+	oid, err := w.Result()
+	require.NoError(t, err)
+
+	display := f.Format(oid)
+	require.Equal(t, oid.String()+"~formatter-test", display)
+
+	// decorated IDs parse back to the canonical ID.
+	parsed, err := ParseID(display)
+	require.NoError(t, err)
+	require.Equal(t, oid, parsed)
+
+	// decorations are display-only.
+	require.NotContains(t, oid.String(), "~")
+
+	b, err := json.Marshal(oid)
+	require.NoError(t, err)
+	require.NotContains(t, string(b), "~")
+
+	// objects written without a label and objects written to other repositories are not decorated.
+	w2 := om.NewWriter(ctx, WriterOptions{})
+	w2.Write([]byte("content id formatter test data without label"))
+	oid2, err := w2.Result()
+	require.NoError(t, err)
+	require.Equal(t, oid2.String(), f.Format(oid2))
+	require.Equal(t, oid.String(), NewIDFormatter(func(string) string { return "other" }).Format(oid))
+}
+
+func TestContentIDFormatterLimits(t *testing.T) {
+	ctx := testlogging.Context(t)
+	_, _, om := setupTest(t, nil)
+
+	writeObject := func(data string) ID {
+		w := om.NewWriter(ctx, WriterOptions{Description: data})
+		w.Write([]byte(data))
+
+		oid, err := w.Result()
+		require.NoError(t, err)
+
+		return oid
+	}
+
+	// nil label function leaves objects undecorated.
+	om.IDFormatter = NewIDFormatter(nil)
+
+	oid := writeObject("a")
+	require.Equal(t, oid.String(), om.IDFormatter.Format(oid))
+
+	// only labels of the most recently written objects are remembered.
+	om.IDFormatter = newIDFormatter(func(description string) string { return description }, 2)
+
+	oidA := writeObject("a")
+	oidB := writeObject("b")
+	oidC := writeObject("c")
+
+	require.Equal(t, oidA.String(), om.IDFormatter.Format(oidA))
+	require.Equal(t, oidB.String()+"~b", om.IDFormatter.Format(oidB))
+	require.Equal(t, oidC.String()+"~c", om.IDFormatter.Format(oidC))
+}
+
+func TestExistsMany(t *testing.T) {
+	ctx := testlogging.Context(t)
+	_, fcm, om := setupTest(t, nil)
+
+	var oids []ID
+
+	want := map[ID]bool{}
+
+	for i := 0; i < 10; i++ {
+		w := om.NewWriter(ctx, WriterOptions{})
+		fmt.Fprintf(w, "present object %v", i)
+
+		oid, err := w.Result()
+		require.NoError(t, err)
+
+		absent := mustParseID(t, fmt.Sprintf("%064x", i))
+
+		// different forms of the same object share a lookup.
+		for _, o := range []ID{oid, Compressed(oid), IndirectObjectID(oid), oid, absent, IndirectObjectID(absent)} {
+			oids = append(oids, o)
+			want[o] = o == oid || o == Compressed(oid) || o == IndirectObjectID(oid)
+		}
+	}
+
+	inline, err := InlineObjectID([]byte("inline"))
+	require.NoError(t, err)
+
+	oids = append(oids, inline)
+	want[inline] = true
+
+	got, err := ExistsMany(ctx, fcm, oids)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	// each distinct content is looked up once, while a naive loop would look up all 60 non-inline IDs.
+	require.EqualValues(t, 20, atomic.LoadInt32(&fcm.contentInfoCount))
+}
+
 func objectIDsEqual(o1, o2 ID) bool {
 	return o1 == o2
 }
@@ -206,6 +349,176 @@ func TestCompression_ContentCompressionDisabled(t *testing.T) {
 	require.True(t, isCompressed) // oid will indicate compression
 }
 
+func TestCompression_LengthWithoutDecompressing(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	_, fcm, om := setupTest(t, map[content.ID]compression.HeaderID{})
+
+	data := bytes.Repeat([]byte{1, 2, 3, 4}, 1000)
+
+	w := om.NewWriter(ctx, WriterOptions{
+		Compressor: "gzip",
+	})
+	w.Write(data)
+	oid, err := w.Result()
+	require.NoError(t, err)
+
+	r, err := Open(ctx, fcm, oid)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	require.Equal(t, int64(len(data)), r.Length())
+
+	// seeking relative to the end uses the length from the index as well.
+	pos, err := r.Seek(-10, io.SeekEnd)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)-10), pos)
+
+	// the content is not fetched until it's read.
+	require.Equal(t, int32(0), atomic.LoadInt32(&fcm.getContentCount))
+
+	tail, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data[len(data)-10:], tail)
+	require.Equal(t, int32(1), atomic.LoadInt32(&fcm.getContentCount))
+
+	buf := make([]byte, 8)
+	_, err = r.(ReaderAt).ReadAt(buf, 4)
+	require.NoError(t, err)
+	require.Equal(t, data[4:12], buf)
+}
+
+func TestCompression_RemoteContentInfoNotLookedUpOnOpen(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	_, fcm, om := setupTest(t, map[content.ID]compression.HeaderID{})
+	fcm.remoteContentInfo = true
+
+	data := bytes.Repeat([]byte{1, 2, 3, 4}, 1000)
+
+	w := om.NewWriter(ctx, WriterOptions{
+		Compressor: "gzip",
+	})
+	w.Write(data)
+	oid, err := w.Result()
+	require.NoError(t, err)
+
+	r, err := Open(ctx, fcm, oid)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	// the content is fetched once, which also determines the length.
+	require.Equal(t, int64(len(data)), r.Length())
+	require.Equal(t, int32(0), atomic.LoadInt32(&fcm.contentInfoCount))
+	require.Equal(t, int32(1), atomic.LoadInt32(&fcm.getContentCount))
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+	require.Equal(t, int32(1), atomic.LoadInt32(&fcm.getContentCount))
+}
+
+func TestCompression_LazyReaderConcurrentReadAtAndMissingContent(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	data, fcm, om := setupTest(t, map[content.ID]compression.HeaderID{})
+
+	payload := bytes.Repeat([]byte{1, 2, 3, 4}, 1000)
+
+	w := om.NewWriter(ctx, WriterOptions{
+		Compressor: "gzip",
+	})
+	w.Write(payload)
+	oid, err := w.Result()
+	require.NoError(t, err)
+
+	r, err := Open(ctx, fcm, oid)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	var eg errgroup.Group
+
+	for i := 0; i < 10; i++ {
+		off := int64(i * 4)
+
+		eg.Go(func() error {
+			buf := make([]byte, 4)
+			if _, err := r.(ReaderAt).ReadAt(buf, off); err != nil {
+				return err
+			}
+
+			if !bytes.Equal(buf, payload[off:off+4]) {
+				return errors.Errorf("invalid data at %v", off)
+			}
+
+			return nil
+		})
+	}
+
+	require.NoError(t, eg.Wait())
+	require.Equal(t, int32(1), atomic.LoadInt32(&fcm.getContentCount))
+
+	// objects whose content does not exist fail to open.
+	cid, _, ok := oid.ContentID()
+	require.True(t, ok)
+
+	fcm.mu.Lock()
+	delete(data, cid)
+	fcm.mu.Unlock()
+
+	_, err = Open(ctx, fcm, oid)
+	require.ErrorIs(t, err, ErrObjectNotFound)
+}
+
+func TestTranscode(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	// content compression is disabled, so compression is reflected in object IDs.
+	_, _, om := setupTest(t, nil)
+
+	data := bytes.Repeat([]byte{1, 2, 3, 4}, 700000)
+
+	w := om.NewWriter(ctx, WriterOptions{})
+	_, err := w.Write(data)
+	require.NoError(t, err)
+
+	src, err := w.Result()
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	dst, err := om.Transcode(ctx, src, WriterOptions{Compressor: "gzip"})
+	require.NoError(t, err)
+	require.NotEqual(t, src, dst)
+
+	for _, oid := range []ID{src, dst} {
+		r, err := Open(ctx, om.contentMgr, oid)
+		require.NoError(t, err)
+
+		got, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		require.True(t, bytes.Equal(data, got), oid)
+	}
+
+	for oid, wantCompressed := range map[ID]bool{src: false, dst: true} {
+		indexObjectID, ok := oid.IndexObjectID()
+		require.True(t, ok)
+
+		entries, err := LoadIndexObject(ctx, om.contentMgr, indexObjectID)
+		require.NoError(t, err)
+		require.Len(t, entries, 3)
+
+		for _, e := range entries {
+			_, isCompressed, ok := e.Object.ContentID()
+			require.True(t, ok)
+			require.Equal(t, wantCompressed, isCompressed, e.Object)
+		}
+	}
+}
+
 func TestWriterCompleteChunkInTwoWrites(t *testing.T) {
 	ctx := testlogging.Context(t)
 	_, _, om := setupTest(t, nil)
@@ -450,87 +763,431 @@ func TestIndirection(t *testing.T) {
 	}
 }
 
-func indirectionLevel(oid ID) int {
-	indexObjectID, ok := oid.IndexObjectID()
-	if !ok {
-		return 0
-	}
+func TestMultiLevelIndirection(t *testing.T) {
+	ctx := testlogging.Context(t)
+	_, _, om := setupTest(t, nil)
 
-	return 1 + indirectionLevel(indexObjectID)
+	// use small chunks so that the index object itself gets split, forcing two levels of indirection.
+	om.newSplitter = splitter.Fixed(1000)
+
+	data := make([]byte, 100000+123)
+	cryptorand.Read(data)
+
+	w := om.NewWriter(ctx, WriterOptions{})
+	_, err := w.Write(data)
+	require.NoError(t, err)
+
+	oid, err := w.Result()
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	require.Equal(t, 2, indirectionLevel(oid), "unexpected indirection level of %v", oid)
+
+	verifyIndirectBlock(ctx, t, om, oid)
+
+	_, err = VerifyObject(ctx, om.contentMgr, oid)
+	require.NoError(t, err)
+
+	r, err := Open(ctx, om.contentMgr, oid)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	require.Equal(t, int64(len(data)), r.Length())
+
+	all, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, data, all)
+
+	for i := 0; i < 1000; i++ {
+		offset := rand.Intn(len(data))
+		length := rand.Intn(3000) + 1
+
+		if offset+length > len(data) {
+			length = len(data) - offset
+		}
+
+		pos, err := r.Seek(int64(offset), io.SeekStart)
+		require.NoError(t, err)
+		require.Equal(t, int64(offset), pos)
+
+		buf := make([]byte, length)
+		_, err = io.ReadFull(r, buf)
+		require.NoError(t, err)
+		require.Equal(t, data[offset:offset+length], buf, "invalid data at offset %v", offset)
+	}
 }
 
-func TestHMAC(t *testing.T) {
+func TestIndirectionDepthGuard(t *testing.T) {
 	ctx := testlogging.Context(t)
-	c := bytes.Repeat([]byte{0xcd}, 50)
+	_, fcm, om := setupTest(t, nil)
 
-	_, _, om := setupTest(t, nil)
+	indexContentID, err := fcm.WriteContent(ctx, gather.FromSlice([]byte("placeholder")), "x", content.NoCompression)
+	require.NoError(t, err)
 
-	w := om.NewWriter(ctx, WriterOptions{})
-	w.Write(c)
-	result, err := w.Result()
+	cyclicID := IndirectObjectID(DirectObjectID(indexContentID))
 
-	if result.String() != "cad29ff89951a3c085c86cb7ed22b82b51f7bdfda24f932c7f9601f51d5975ba" {
-		t.Errorf("unexpected result: %v err: %v", result.String(), err)
-	}
+	// replace the index with one whose only entry points back at the object itself.
+	var buf bytes.Buffer
+
+	require.NoError(t, writeIndirectObject(&buf, []IndirectObjectEntry{{Start: 0, Length: 10, Object: cyclicID}}))
+
+	fcm.mu.Lock()
+	fcm.data[indexContentID] = buf.Bytes()
+	fcm.mu.Unlock()
+
+	r, err := Open(ctx, om.contentMgr, cyclicID)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	_, err = io.ReadAll(r)
+	require.ErrorContains(t, err, "exceeds maximum indirection depth")
 }
 
-//nolint:gocyclo
-func TestConcatenate(t *testing.T) {
+func TestMalformedIndirectObject(t *testing.T) {
 	ctx := testlogging.Context(t)
-	_, _, om := setupTest(t, nil)
+	_, fcm, om := setupTest(t, nil)
 
-	phrase := []byte("hello world\n")
-	phraseLength := len(phrase)
-	shortRepeatCount := 17
-	longRepeatCount := 999999
+	var entries []IndirectObjectEntry
 
-	emptyObject := mustWriteObject(t, om, nil, "")
+	var offset int64
 
-	// short uncompressed object - <content>
-	shortUncompressedOID := mustWriteObject(t, om, bytes.Repeat(phrase, shortRepeatCount), "")
+	for _, d := range []string{"first chunk", "second chunk", "third chunk"} {
+		cid, err := fcm.WriteContent(ctx, gather.FromSlice([]byte(d)), "", content.NoCompression)
+		require.NoError(t, err)
 
-	// long uncompressed object - Ix<content>
-	longUncompressedOID := mustWriteObject(t, om, bytes.Repeat(phrase, longRepeatCount), "")
+		entries = append(entries, IndirectObjectEntry{Start: offset, Length: int64(len(d)), Object: DirectObjectID(cid)})
+		offset += int64(len(d))
+	}
 
-	// short compressed object - Z<content>
-	shortCompressedOID := mustWriteObject(t, om, bytes.Repeat(phrase, shortRepeatCount), "pgzip")
+	indexContentID, err := fcm.WriteContent(ctx, gather.FromSlice([]byte("placeholder")), "x", content.NoCompression)
+	require.NoError(t, err)
 
-	// long compressed object - Ix<content>
-	longCompressedOID := mustWriteObject(t, om, bytes.Repeat(phrase, longRepeatCount), "pgzip")
+	oid := IndirectObjectID(DirectObjectID(indexContentID))
 
-	if _, compressed, ok := shortUncompressedOID.ContentID(); !ok || compressed {
-		t.Errorf("invalid test assumption - shortUncompressedOID %v", shortUncompressedOID)
+	setIndex := func(data []byte) {
+		fcm.mu.Lock()
+		fcm.data[indexContentID] = data
+		fcm.mu.Unlock()
 	}
 
-	if _, isIndex := longUncompressedOID.IndexObjectID(); !isIndex {
-		t.Errorf("invalid test assumption - longUncompressedOID %v", longUncompressedOID)
+	encodeIndex := func(entries []IndirectObjectEntry) []byte {
+		var buf bytes.Buffer
+
+		require.NoError(t, writeIndirectObject(&buf, entries))
+
+		return buf.Bytes()
 	}
 
-	if _, compressed, ok := shortCompressedOID.ContentID(); !ok || !compressed {
-		t.Errorf("invalid test assumption - shortCompressedOID %v", shortCompressedOID)
+	// valid index
+	setIndex(encodeIndex(entries))
+
+	r, err := Open(ctx, om.contentMgr, oid)
+	require.NoError(t, err)
+
+	all, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "first chunksecond chunkthird chunk", string(all))
+	require.NoError(t, r.Close())
+
+	valid := encodeIndex(entries)
+
+	cases := map[string][]byte{
+		"truncated":      valid[0 : len(valid)/2],
+		"reordered":      encodeIndex([]IndirectObjectEntry{entries[1], entries[0], entries[2]}),
+		"missing-entry":  encodeIndex([]IndirectObjectEntry{entries[0], entries[2]}),
+		"overlapping":    encodeIndex([]IndirectObjectEntry{entries[0], {Start: 5, Length: entries[1].Length, Object: entries[1].Object}}),
+		"negative":       encodeIndex([]IndirectObjectEntry{{Start: 0, Length: -1, Object: entries[0].Object}}),
+		"no-object":      encodeIndex([]IndirectObjectEntry{{Start: 0, Length: entries[0].Length}}),
+		"unknown-stream": []byte(`{"stream":"kopia:something","entries":[]}`),
 	}
 
-	if _, isIndex := longCompressedOID.IndexObjectID(); !isIndex {
-		t.Errorf("invalid test assumption - longCompressedOID %v", longCompressedOID)
+	for name, data := range cases {
+		setIndex(data)
+
+		r, err := Open(ctx, om.contentMgr, oid)
+		require.ErrorIs(t, err, ErrMalformedIndirectObject, name)
+		require.Nil(t, r, name)
 	}
 
-	shortLength := phraseLength * shortRepeatCount
-	longLength := phraseLength * longRepeatCount
+	// a missing data block is not reported as index corruption.
+	setIndex(valid)
 
-	cases := []struct {
-		inputs     []ID
-		wantLength int
-	}{
-		{[]ID{emptyObject}, 0},
-		{[]ID{shortUncompressedOID}, shortLength},
-		{[]ID{longUncompressedOID}, longLength},
-		{[]ID{shortCompressedOID}, shortLength},
-		{[]ID{longCompressedOID}, longLength},
+	dataContentID, _, _ := entries[1].Object.ContentID()
 
-		{[]ID{shortUncompressedOID, shortUncompressedOID}, 2 * shortLength},
-		{[]ID{shortUncompressedOID, shortCompressedOID}, 2 * shortLength},
-		{[]ID{emptyObject, longCompressedOID, shortCompressedOID, emptyObject, longCompressedOID, shortUncompressedOID, shortUncompressedOID, emptyObject, emptyObject}, 2*longLength + 3*shortLength},
-	}
+	fcm.mu.Lock()
+	delete(fcm.data, dataContentID)
+	fcm.mu.Unlock()
+
+	r, err = Open(ctx, om.contentMgr, oid)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	_, err = io.ReadAll(r)
+	require.ErrorIs(t, err, ErrObjectNotFound)
+	require.NotErrorIs(t, err, ErrMalformedIndirectObject)
+}
+
+func TestReadAt(t *testing.T) {
+	ctx := testlogging.Context(t)
+	_, _, om := setupTest(t, nil)
+
+	om.newSplitter = splitter.Fixed(1000)
+
+	data := make([]byte, 100000+123)
+	cryptorand.Read(data)
+
+	oid := mustWriteObject(t, om, data, "")
+
+	r, err := Open(ctx, om.contentMgr, oid)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	cases := []struct {
+		offset int64
+		length int
+	}{
+		{0, len(data)},
+		{0, 1},
+		{999, 2},
+		{1500, 30000},
+		{12345, 54321},
+		{int64(len(data)) - 100, 100},
+	}
+
+	for _, tc := range cases {
+		// sequential read for comparison
+		_, err := r.Seek(tc.offset, io.SeekStart)
+		require.NoError(t, err)
+
+		sequential := make([]byte, tc.length)
+		_, err = io.ReadFull(r, sequential)
+		require.NoError(t, err)
+		require.Equal(t, data[tc.offset:tc.offset+int64(tc.length)], sequential)
+
+		pos, err := r.Seek(0, io.SeekCurrent)
+		require.NoError(t, err)
+
+		got := make([]byte, tc.length)
+		n, err := r.(ReaderAt).ReadAt(got, tc.offset)
+		require.NoError(t, err)
+		require.Equal(t, tc.length, n)
+		require.Equal(t, sequential, got)
+
+		// ReadAt does not move the read position.
+		pos2, err := r.Seek(0, io.SeekCurrent)
+		require.NoError(t, err)
+		require.Equal(t, pos, pos2)
+
+		for _, parallelism := range []int{1, 3, 100} {
+			got := make([]byte, tc.length)
+			n, err := ReadRange(ctx, om.contentMgr, oid, tc.offset, got, ReadRangeOptions{Parallelism: parallelism})
+			require.NoError(t, err)
+			require.Equal(t, tc.length, n)
+			require.Equal(t, sequential, got)
+		}
+	}
+
+	// reads past the end return io.EOF with partial data.
+	got := make([]byte, 200)
+	n, err := r.(ReaderAt).ReadAt(got, int64(len(data))-100)
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, 100, n)
+	require.Equal(t, data[len(data)-100:], got[:n])
+
+	n, err = r.(ReaderAt).ReadAt(got, int64(len(data)))
+	require.ErrorIs(t, err, io.EOF)
+	require.Zero(t, n)
+
+	// short objects support ReadAt too.
+	shortOID := mustWriteObject(t, om, data[0:100], "")
+
+	n, err = ReadRange(ctx, om.contentMgr, shortOID, 10, got[0:50], ReadRangeOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 50, n)
+	require.Equal(t, data[10:60], got[0:50])
+}
+
+func TestReadAtMissingChunk(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data, _, om := setupTest(t, nil)
+
+	om.newSplitter = splitter.Fixed(1000)
+
+	b := make([]byte, 10000)
+	cryptorand.Read(b)
+
+	oid := mustWriteObject(t, om, b, "")
+
+	indexObjectID, ok := oid.IndexObjectID()
+	require.True(t, ok)
+
+	entries, err := LoadIndexObject(ctx, om.contentMgr, indexObjectID)
+	require.NoError(t, err)
+
+	// remove one of the chunks in the middle.
+	missing := entries[5].Object
+	cid, _, ok := missing.ContentID()
+	require.True(t, ok)
+
+	om.contentMgr.(*fakeContentManager).mu.Lock()
+	missingData := data[cid]
+	delete(data, cid)
+	om.contentMgr.(*fakeContentManager).mu.Unlock()
+
+	full := make([]byte, len(b))
+
+	n, err := ReadRange(ctx, om.contentMgr, oid, 0, full, ReadRangeOptions{Parallelism: 4})
+	require.ErrorIs(t, err, ErrObjectNotFound)
+	require.Contains(t, err.Error(), missing.String())
+
+	// chunks preceding the missing one have been read and are reported.
+	require.Equal(t, int(entries[5].Start), n)
+	require.Equal(t, b[0:n], full[0:n])
+
+	// once the chunk is available again, the read can be resumed.
+	om.contentMgr.(*fakeContentManager).mu.Lock()
+	data[cid] = missingData
+	om.contentMgr.(*fakeContentManager).mu.Unlock()
+
+	n2, err := ReadRange(ctx, om.contentMgr, oid, int64(n), full[n:], ReadRangeOptions{Parallelism: 4})
+	require.NoError(t, err)
+	require.Equal(t, len(b)-n, n2)
+	require.Equal(t, b, full)
+
+	om.contentMgr.(*fakeContentManager).mu.Lock()
+	delete(data, cid)
+	om.contentMgr.(*fakeContentManager).mu.Unlock()
+
+	// ranges not covering the missing chunk can still be read.
+	got := make([]byte, 2000)
+	_, err = ReadRange(ctx, om.contentMgr, oid, 0, got, ReadRangeOptions{Parallelism: 4})
+	require.NoError(t, err)
+	require.Equal(t, b[0:2000], got)
+}
+
+func BenchmarkReadRange(b *testing.B) {
+	ctx := testlogging.Context(b)
+	_, fcm, om := setupTest(b, nil)
+
+	om.newSplitter = splitter.Fixed(16 << 10)
+
+	data := make([]byte, 1<<20)
+	cryptorand.Read(data)
+
+	w := om.NewWriter(ctx, WriterOptions{})
+	defer w.Close()
+
+	_, err := w.Write(data)
+	require.NoError(b, err)
+
+	oid, err := w.Result()
+	require.NoError(b, err)
+
+	// simulate high-latency link
+	fcm.getContentDelay = time.Millisecond
+
+	for _, parallelism := range []int{1, 4, 16} {
+		parallelism := parallelism
+
+		b.Run(fmt.Sprintf("parallelism-%v", parallelism), func(b *testing.B) {
+			buf := make([]byte, len(data))
+
+			b.SetBytes(int64(len(data)))
+
+			for i := 0; i < b.N; i++ {
+				if _, err := ReadRange(ctx, om.contentMgr, oid, 0, buf, ReadRangeOptions{Parallelism: parallelism}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func indirectionLevel(oid ID) int {
+	indexObjectID, ok := oid.IndexObjectID()
+	if !ok {
+		return 0
+	}
+
+	return 1 + indirectionLevel(indexObjectID)
+}
+
+func TestHMAC(t *testing.T) {
+	ctx := testlogging.Context(t)
+	c := bytes.Repeat([]byte{0xcd}, 50)
+
+	_, _, om := setupTest(t, nil)
+
+	w := om.NewWriter(ctx, WriterOptions{})
+	w.Write(c)
+	result, err := w.Result()
+
+	if result.String() != "cad29ff89951a3c085c86cb7ed22b82b51f7bdfda24f932c7f9601f51d5975ba" {
+		t.Errorf("unexpected result: %v err: %v", result.String(), err)
+	}
+}
+
+//nolint:gocyclo
+func TestConcatenate(t *testing.T) {
+	ctx := testlogging.Context(t)
+	_, _, om := setupTest(t, nil)
+
+	phrase := []byte("hello world\n")
+	phraseLength := len(phrase)
+	shortRepeatCount := 17
+	longRepeatCount := 999999
+
+	emptyObject := mustWriteObject(t, om, nil, "")
+
+	// short uncompressed object - <content>
+	shortUncompressedOID := mustWriteObject(t, om, bytes.Repeat(phrase, shortRepeatCount), "")
+
+	// long uncompressed object - Ix<content>
+	longUncompressedOID := mustWriteObject(t, om, bytes.Repeat(phrase, longRepeatCount), "")
+
+	// short compressed object - Z<content>
+	shortCompressedOID := mustWriteObject(t, om, bytes.Repeat(phrase, shortRepeatCount), "pgzip")
+
+	// long compressed object - Ix<content>
+	longCompressedOID := mustWriteObject(t, om, bytes.Repeat(phrase, longRepeatCount), "pgzip")
+
+	if _, compressed, ok := shortUncompressedOID.ContentID(); !ok || compressed {
+		t.Errorf("invalid test assumption - shortUncompressedOID %v", shortUncompressedOID)
+	}
+
+	if _, isIndex := longUncompressedOID.IndexObjectID(); !isIndex {
+		t.Errorf("invalid test assumption - longUncompressedOID %v", longUncompressedOID)
+	}
+
+	if _, compressed, ok := shortCompressedOID.ContentID(); !ok || !compressed {
+		t.Errorf("invalid test assumption - shortCompressedOID %v", shortCompressedOID)
+	}
+
+	if _, isIndex := longCompressedOID.IndexObjectID(); !isIndex {
+		t.Errorf("invalid test assumption - longCompressedOID %v", longCompressedOID)
+	}
+
+	shortLength := phraseLength * shortRepeatCount
+	longLength := phraseLength * longRepeatCount
+
+	cases := []struct {
+		inputs     []ID
+		wantLength int
+	}{
+		{[]ID{emptyObject}, 0},
+		{[]ID{shortUncompressedOID}, shortLength},
+		{[]ID{longUncompressedOID}, longLength},
+		{[]ID{shortCompressedOID}, shortLength},
+		{[]ID{longCompressedOID}, longLength},
+
+		{[]ID{shortUncompressedOID, shortUncompressedOID}, 2 * shortLength},
+		{[]ID{shortUncompressedOID, shortCompressedOID}, 2 * shortLength},
+		{[]ID{emptyObject, longCompressedOID, shortCompressedOID, emptyObject, longCompressedOID, shortUncompressedOID, shortUncompressedOID, emptyObject, emptyObject}, 2*longLength + 3*shortLength},
+	}
 
 	for _, tc := range cases {
 		concatenatedOID, err := om.Concatenate(ctx, tc.inputs)
@@ -591,6 +1248,89 @@ func TestConcatenate(t *testing.T) {
 	}
 }
 
+func TestOpenConcat(t *testing.T) {
+	ctx := testlogging.Context(t)
+	_, _, om := setupTest(t, nil)
+
+	part1 := bytes.Repeat([]byte("first part\n"), 100)
+	part2 := make([]byte, 3000000)
+	part3 := []byte("tiny")
+
+	for i := range part2 {
+		part2[i] = byte(i % 251)
+	}
+
+	inlineOID, err := InlineObjectID(part3)
+	require.NoError(t, err)
+
+	// direct, indirect (multi-chunk) and inline objects.
+	oids := []ID{
+		mustWriteObject(t, om, part1, ""),
+		mustWriteObject(t, om, part2, ""),
+		inlineOID,
+	}
+
+	if _, isIndex := oids[1].IndexObjectID(); !isIndex {
+		t.Fatalf("invalid test assumption - %v is not indirect", oids[1])
+	}
+
+	want := append(append(append([]byte{}, part1...), part2...), part3...)
+
+	r, err := OpenConcat(ctx, om.contentMgr, oids)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	require.Equal(t, int64(len(want)), r.Length())
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+
+	// seek and read across object boundaries.
+	boundary1 := int64(len(part1))
+	boundary2 := boundary1 + int64(len(part2))
+
+	for _, off := range []int64{0, boundary1 - 5, boundary1, boundary2 - 3, boundary2 - 1, boundary2, int64(len(want)) - 1} {
+		pos, err := r.Seek(off, io.SeekStart)
+		require.NoError(t, err)
+		require.Equal(t, off, pos)
+
+		buf := make([]byte, 10)
+		n, err := io.ReadFull(r, buf)
+
+		wantN := len(want) - int(off)
+		if wantN > len(buf) {
+			wantN = len(buf)
+		}
+
+		if wantN < len(buf) {
+			require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		} else {
+			require.NoError(t, err)
+		}
+
+		require.Equal(t, want[off:off+int64(wantN)], buf[:n], "offset %v", off)
+
+		ra := make([]byte, wantN)
+		_, err = r.(ReaderAt).ReadAt(ra, off)
+		require.NoError(t, err)
+		require.Equal(t, want[off:off+int64(wantN)], ra, "ReadAt offset %v", off)
+	}
+
+	pos, err := r.Seek(-2, io.SeekEnd)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(want))-2, pos)
+
+	// empty list produces an empty stream.
+	r2, err := OpenConcat(ctx, om.contentMgr, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), r2.Length())
+
+	_, err = OpenConcat(ctx, om.contentMgr, []ID{mustParseID(t, "deadbeef")})
+	require.ErrorIs(t, err, ErrObjectNotFound)
+}
+
 func mustWriteObject(t *testing.T, om *Manager, data []byte, compressor compression.Name) ID {
 	t.Helper()
 
@@ -669,6 +1409,214 @@ func TestReaderStoredBlockNotFound(t *testing.T) {
 	}
 }
 
+func TestZeroLengthObject(t *testing.T) {
+	ctx := testlogging.Context(t)
+	_, _, om := setupTest(t, nil)
+
+	w := om.NewWriter(ctx, WriterOptions{})
+	emptyOID, err := w.Result()
+	require.NoError(t, err)
+
+	// index object with no entries, which describes an empty indirect object.
+	w = om.NewWriter(ctx, WriterOptions{})
+	_, err = w.Write([]byte(`{"stream":"kopia:indirect","entries":[]}`))
+	require.NoError(t, err)
+
+	indexOID, err := w.Result()
+	require.NoError(t, err)
+
+	for _, oid := range []ID{emptyOID, IndirectObjectID(indexOID)} {
+		r, err := Open(ctx, om.contentMgr, oid)
+		require.NoError(t, err, oid)
+
+		require.Equal(t, int64(0), r.Length(), oid)
+
+		n, err := r.Read(make([]byte, 10))
+		require.Equal(t, 0, n, oid)
+		require.ErrorIs(t, err, io.EOF, oid)
+
+		pos, err := r.Seek(0, io.SeekEnd)
+		require.NoError(t, err, oid)
+		require.Equal(t, int64(0), pos, oid)
+
+		// read an empty range starting at offset 0.
+		pos, err = r.Seek(0, io.SeekStart)
+		require.NoError(t, err, oid)
+		require.Equal(t, int64(0), pos, oid)
+
+		n, err = io.ReadFull(r, nil)
+		require.NoError(t, err, oid)
+		require.Equal(t, 0, n, oid)
+
+		all, err := io.ReadAll(r)
+		require.NoError(t, err, oid)
+		require.Empty(t, all, oid)
+
+		require.NoError(t, r.Close())
+	}
+}
+
+func TestInlineObject(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data, cm, om := setupTest(t, nil)
+
+	w := om.NewWriter(ctx, WriterOptions{AllowInline: true})
+	_, err := w.Write([]byte{1, 2, 3, 4, 5})
+	require.NoError(t, err)
+
+	oid, err := w.Result()
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// no content was written.
+	require.Empty(t, data)
+
+	got, ok := oid.InlineData()
+	require.True(t, ok)
+	require.Equal(t, []byte{1, 2, 3, 4, 5}, got)
+
+	parsed, err := ParseID(oid.String())
+	require.NoError(t, err)
+	require.Equal(t, oid, parsed)
+
+	r, err := Open(ctx, cm, parsed)
+	require.NoError(t, err)
+
+	require.Equal(t, int64(5), r.Length())
+
+	all, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2, 3, 4, 5}, all)
+	require.NoError(t, r.Close())
+
+	contentIDs, err := VerifyObject(ctx, cm, oid)
+	require.NoError(t, err)
+	require.Empty(t, contentIDs)
+
+	// inline objects can be concatenated with regular ones.
+	w = om.NewWriter(ctx, WriterOptions{})
+	_, err = w.Write([]byte{6, 7, 8})
+	require.NoError(t, err)
+
+	regularOID, err := w.Result()
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	concatOID, err := om.Concatenate(ctx, []ID{oid, regularOID})
+	require.NoError(t, err)
+
+	r, err = Open(ctx, cm, concatOID)
+	require.NoError(t, err)
+
+	all, err = io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2, 3, 4, 5, 6, 7, 8}, all)
+
+	// objects that are too long, prefixed or without AllowInline are stored in contents.
+	for _, opt := range []WriterOptions{
+		{},
+		{AllowInline: true, Prefix: "k"},
+	} {
+		w = om.NewWriter(ctx, opt)
+		_, err = w.Write([]byte{1, 2, 3, 4, 5})
+		require.NoError(t, err)
+
+		oid, err = w.Result()
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		_, ok = oid.InlineData()
+		require.False(t, ok, opt)
+	}
+
+	// AllowInline is ignored unless the repository format enables inline objects.
+	om2, err := NewObjectManager(ctx, cm, format.ObjectFormat{Splitter: "FIXED-1M"})
+	require.NoError(t, err)
+
+	w = om2.NewWriter(ctx, WriterOptions{AllowInline: true})
+	_, err = w.Write([]byte{1, 2, 3, 4, 5})
+	require.NoError(t, err)
+
+	oid, err = w.Result()
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	_, ok = oid.InlineData()
+	require.False(t, ok)
+
+	w = om.NewWriter(ctx, WriterOptions{AllowInline: true})
+	_, err = w.Write(make([]byte, MaxInlineObjectLength+1))
+	require.NoError(t, err)
+
+	oid, err = w.Result()
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	_, ok = oid.InlineData()
+	require.False(t, ok)
+}
+
+func TestInlineContentThreshold(t *testing.T) {
+	ctx := testlogging.Context(t)
+	_, cm, om := setupTest(t, nil)
+
+	write := func(length int) ID {
+		t.Helper()
+
+		w := om.NewWriter(ctx, WriterOptions{})
+		defer w.Close()
+
+		_, err := w.Write(bytes.Repeat([]byte{7}, length))
+		require.NoError(t, err)
+
+		oid, err := w.Result()
+		require.NoError(t, err)
+
+		return oid
+	}
+
+	verify := func(oid ID, length int) {
+		t.Helper()
+
+		r, err := Open(ctx, cm, oid)
+		require.NoError(t, err)
+
+		defer r.Close()
+
+		got, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, bytes.Repeat([]byte{7}, length), got)
+	}
+
+	stored := write(5)
+	_, ok := stored.InlineData()
+	require.False(t, ok)
+
+	om.Format.InlineContentThreshold = 10
+
+	inlined := write(5)
+	_, ok = inlined.InlineData()
+	require.True(t, ok)
+
+	below := write(9)
+	_, ok = below.InlineData()
+	require.True(t, ok)
+
+	atThreshold := write(10)
+	_, ok = atThreshold.InlineData()
+	require.False(t, ok)
+
+	// objects are readable regardless of the current threshold.
+	for _, threshold := range []int{10, 0} {
+		om.Format.InlineContentThreshold = threshold
+
+		verify(stored, 5)
+		verify(inlined, 5)
+		verify(below, 9)
+		verify(atThreshold, 10)
+	}
+}
+
 func TestEndToEndReadAndSeek(t *testing.T) {
 	for _, asyncWrites := range []int{0, 4, 8} {
 		asyncWrites := asyncWrites
@@ -877,6 +1825,61 @@ func TestSeek(t *testing.T) {
 	}
 }
 
+func TestWriterDeadline(t *testing.T) {
+	ctx := testlogging.Context(t)
+	_, fcm, om := setupTest(t, nil)
+
+	// write an object that shares its first chunk with the one that will time out.
+	sharedData := make([]byte, 1<<20)
+	cryptorand.Read(sharedData)
+
+	w := om.NewWriter(ctx, WriterOptions{})
+	_, err := w.Write(sharedData)
+	require.NoError(t, err)
+
+	sharedOID, err := w.Result()
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	fcm.writeContentDelay = time.Minute
+
+	w = om.NewWriter(ctx, WriterOptions{
+		Description: "slow",
+		Deadline:    clock.Now().Add(100 * time.Millisecond),
+	})
+
+	t0 := clock.Now()
+
+	_, err = w.Write(append(append([]byte(nil), sharedData...), 1, 2, 3))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, clock.Now().Sub(t0), 30*time.Second)
+
+	// subsequent writes and Result() fail as well.
+	_, err = w.Write([]byte{4, 5, 6})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = w.Result()
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NoError(t, w.Close())
+
+	fcm.writeContentDelay = 0
+
+	// previously written object is still intact.
+	verifyFull(ctx, t, om, sharedOID, sharedData)
+
+	// writers without deadlines are unaffected.
+	w = om.NewWriter(ctx, WriterOptions{})
+	defer w.Close()
+
+	_, err = w.Write([]byte{7, 8, 9})
+	require.NoError(t, err)
+
+	oid, err := w.Result()
+	require.NoError(t, err)
+
+	verifyFull(ctx, t, om, oid, []byte{7, 8, 9})
+}
+
 func TestWriterFlushFailure_OnWrite(t *testing.T) {
 	_, fcm, om := setupTest(t, nil)
 
@@ -965,3 +1968,366 @@ func TestWriterFailure_OnCompression(t *testing.T) {
 	_, err := w.Write(bytes.Repeat([]byte{1, 2, 3, 4}, 1e6))
 	require.Error(t, err, errSomeError)
 }
+
+// newlineSplitter splits objects after each newline character.
+type newlineSplitter struct{}
+
+func (newlineSplitter) NextSplitPoint(b []byte) int {
+	if n := bytes.IndexByte(b, '\n'); n >= 0 {
+		return n + 1
+	}
+
+	return -1
+}
+
+func (newlineSplitter) MaxSegmentSize() int { return 1 << 20 }
+func (newlineSplitter) Reset()              {}
+func (newlineSplitter) Close()              {}
+
+func TestCustomSplitter(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	splitter.Register("TEST-NEWLINE", func() splitter.Splitter { return newlineSplitter{} })
+	require.Contains(t, splitter.SupportedAlgorithms(), "TEST-NEWLINE")
+
+	data := map[content.ID][]byte{}
+
+	om, err := NewObjectManager(ctx, &fakeContentManager{data: data}, format.ObjectFormat{
+		Splitter: "TEST-NEWLINE",
+	})
+	require.NoError(t, err)
+
+	payload := []byte("first line\nsecond line\nthird line\nno newline")
+
+	w := om.NewWriter(ctx, WriterOptions{})
+	_, err = w.Write(payload)
+	require.NoError(t, err)
+
+	oid, err := w.Result()
+	require.NoError(t, err)
+
+	// 4 chunks + index object
+	require.Len(t, data, 5)
+
+	r, err := Open(ctx, om.contentMgr, oid)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, payload, got)
+
+	_, err = NewObjectManager(ctx, &fakeContentManager{data: data}, format.ObjectFormat{
+		Splitter: "TEST-NO-SUCH-SPLITTER",
+	})
+	require.Error(t, err)
+}
+
+func TestReaderUnknownCompression(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data, _, om := setupTest(t, nil)
+
+	cid, err := content.ParseID("a76999788386641a3ec798554f1fe7e6")
+	require.NoError(t, err)
+
+	// compression header of an algorithm unknown to this version.
+	data[cid] = []byte{0xfe, 0xed, 0xfa, 0xce, 1, 2, 3}
+
+	_, err = Open(ctx, om.contentMgr, Compressed(DirectObjectID(cid)))
+
+	var nve format.NewerVersionRequiredError
+
+	require.ErrorAs(t, err, &nve)
+	require.Equal(t, "compression feedface", nve.Format)
+}
+
+func TestReaderBufferPoolDoesNotLeakData(t *testing.T) {
+	ctx := testlogging.Context(t)
+	_, _, om := setupTest(t, nil)
+
+	writeObject := func(length int, fill byte) (ID, []byte) {
+		data := bytes.Repeat([]byte{fill}, length)
+
+		w := om.NewWriter(ctx, WriterOptions{})
+		_, err := w.Write(data)
+		require.NoError(t, err)
+
+		oid, err := w.Result()
+		require.NoError(t, err)
+
+		return oid, data
+	}
+
+	// objects with different fill patterns and partial last chunks, so that
+	// any stale buffer contents would be visible.
+	oid1, data1 := writeObject(2<<20+12345, 0xaa)
+	oid2, data2 := writeObject(1<<20+100, 0x55)
+	oid3, data3 := writeObject(3<<20-1, 0x11)
+
+	for i := 0; i < 3; i++ {
+		for _, tc := range []struct {
+			oid  ID
+			data []byte
+		}{
+			{oid1, data1},
+			{oid2, data2},
+			{oid3, data3},
+			{oid2, data2},
+		} {
+			r, err := Open(ctx, om.contentMgr, tc.oid)
+			require.NoError(t, err)
+
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.NoError(t, r.Close())
+			require.Equal(t, tc.data, got)
+
+			buf := make([]byte, len(tc.data)-10)
+			n, err := ReadRange(ctx, om.contentMgr, tc.oid, 10, buf, ReadRangeOptions{})
+			require.NoError(t, err)
+			require.Equal(t, len(buf), n)
+			require.Equal(t, tc.data[10:], buf)
+		}
+	}
+}
+
+func BenchmarkObjectReader(b *testing.B) {
+	ctx := testlogging.Context(b)
+	_, _, om := setupTest(b, nil)
+
+	data := make([]byte, 8<<20)
+	cryptorand.Read(data)
+
+	w := om.NewWriter(ctx, WriterOptions{})
+	w.Write(data)
+
+	oid, err := w.Result()
+	require.NoError(b, err)
+
+	for _, enabled := range []bool{true, false} {
+		enabled := enabled
+
+		b.Run(fmt.Sprintf("pool=%v", enabled), func(b *testing.B) {
+			defer func(old bool) { chunkBufferPoolEnabled = old }(chunkBufferPoolEnabled)
+
+			chunkBufferPoolEnabled = enabled
+
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				r, err := Open(ctx, om.contentMgr, oid)
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				if _, err := io.Copy(io.Discard, r); err != nil {
+					b.Fatal(err)
+				}
+
+				r.Close()
+			}
+		})
+	}
+}
+
+func TestWriterExpectID(t *testing.T) {
+	ctx := testlogging.Context(t)
+	_, _, om := setupTest(t, nil)
+
+	write := func(data []byte, opt WriterOptions) (ID, error) {
+		w := om.NewWriter(ctx, opt)
+		defer w.Close()
+
+		_, err := w.Write(data)
+		require.NoError(t, err)
+
+		return w.Result()
+	}
+
+	small := []byte("expected object ID test")
+	large := make([]byte, 3<<20)
+	cryptorand.Read(large)
+
+	for _, tc := range []struct {
+		desc string
+		data []byte
+		opt  WriterOptions
+	}{
+		{"regular", small, WriterOptions{}},
+		{"inline", small, WriterOptions{AllowInline: true}},
+		{"indirect", large, WriterOptions{}},
+	} {
+		want, err := write(tc.data, tc.opt)
+		require.NoError(t, err, tc.desc)
+
+		opt := tc.opt
+		opt.ExpectID = &want
+
+		got, err := write(tc.data, opt)
+		require.NoError(t, err, tc.desc)
+		require.Equal(t, want, got, tc.desc)
+
+		wrong := mustParseID(t, "1d804f1f69df08f3f59070bf962de69433e3d61ac18522a805a84d8c92741340")
+		opt.ExpectID = &wrong
+
+		// the computed ID is returned along with the error.
+		got, err = write(tc.data, opt)
+		require.ErrorIs(t, err, ErrUnexpectedObjectID, tc.desc)
+		require.Equal(t, want, got, tc.desc)
+	}
+}
+
+func TestWriterMaxSize(t *testing.T) {
+	ctx := testlogging.Context(t)
+	data, _, om := setupTest(t, nil)
+
+	chunk := make([]byte, 1<<20)
+	cryptorand.Read(chunk)
+
+	w := om.NewWriter(ctx, WriterOptions{MaxSize: 2<<20 + 100})
+	defer w.Close()
+
+	// first chunk gets flushed, the second one is buffered.
+	_, err := w.Write(chunk)
+	require.NoError(t, err)
+
+	_, err = w.Write(chunk[0:1000])
+	require.NoError(t, err)
+
+	// another writer sharing the flushed content.
+	w2 := om.NewWriter(ctx, WriterOptions{})
+	defer w2.Close()
+
+	_, err = w2.Write(chunk)
+	require.NoError(t, err)
+
+	oid2, err := w2.Result()
+	require.NoError(t, err)
+
+	_, err = w.Write(chunk)
+	require.ErrorIs(t, err, ErrObjectTooLarge)
+
+	// subsequent writes fail even if they are small.
+	_, err = w.Write([]byte{1})
+	require.ErrorIs(t, err, ErrObjectTooLarge)
+
+	_, err = w.Result()
+	require.ErrorIs(t, err, ErrObjectTooLarge)
+
+	_, err = w.Checkpoint()
+	require.ErrorIs(t, err, ErrObjectTooLarge)
+
+	// no index object was written.
+	for cid := range data {
+		require.NotEqual(t, indirectContentPrefix, cid.Prefix(), "unexpected index content %v", cid)
+	}
+
+	// shared content remains valid.
+	r, err := Open(ctx, om.contentMgr, oid2)
+	require.NoError(t, err)
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, chunk, got)
+
+	// writes within the limit succeed and the limit can come from the repository format.
+	om.Format.MaxObjectSize = 100
+
+	w3 := om.NewWriter(ctx, WriterOptions{})
+	defer w3.Close()
+
+	_, err = w3.Write(chunk[0:100])
+	require.NoError(t, err)
+
+	_, err = w3.Result()
+	require.NoError(t, err)
+
+	w4 := om.NewWriter(ctx, WriterOptions{})
+	defer w4.Close()
+
+	_, err = w4.Write(chunk[0:101])
+	require.ErrorIs(t, err, ErrObjectTooLarge)
+}
+
+func TestWriterMaxIndirectFanout(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	const numChunks = 30
+
+	chunkSize := splitter.GetFactory("FIXED-128K")().MaxSegmentSize()
+
+	objectData := make([]byte, numChunks*chunkSize-12345)
+	cryptorand.Read(objectData)
+
+	writeWithFanout := func(fanout int) (*Manager, ID) {
+		om, err := NewObjectManager(ctx, &fakeContentManager{data: map[content.ID][]byte{}}, format.ObjectFormat{
+			Splitter:          "FIXED-128K",
+			MaxIndirectFanout: fanout,
+		})
+		require.NoError(t, err)
+
+		w := om.NewWriter(ctx, WriterOptions{})
+		defer w.Close()
+
+		_, err = w.Write(objectData)
+		require.NoError(t, err)
+
+		oid, err := w.Result()
+		require.NoError(t, err)
+
+		return om, oid
+	}
+
+	om, flatOID := writeWithFanout(0)
+
+	flatIndexID, ok := flatOID.IndexObjectID()
+	require.True(t, ok)
+
+	flatEntries, err := LoadIndexObject(ctx, om.contentMgr, flatIndexID)
+	require.NoError(t, err)
+	require.Len(t, flatEntries, numChunks)
+
+	om, oid := writeWithFanout(2)
+
+	// the top-level index only has nested index objects.
+	indexID, ok := oid.IndexObjectID()
+	require.True(t, ok)
+
+	entries, err := LoadIndexObject(ctx, om.contentMgr, indexID)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	for _, e := range entries {
+		_, ok := e.Object.IndexObjectID()
+		require.True(t, ok, "expected nested index in %v", e.Object)
+	}
+
+	r, err := Open(ctx, om.contentMgr, oid)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	require.Equal(t, int64(len(objectData)), r.Length())
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, objectData, got)
+
+	// random reads spanning chunks.
+	for i := 0; i < 20; i++ {
+		off := rand.Intn(len(objectData) - 2*chunkSize)
+		buf := make([]byte, 2*chunkSize)
+
+		n, err := r.(ReaderAt).ReadAt(buf, int64(off))
+		require.NoError(t, err)
+		require.Equal(t, objectData[off:off+n], buf[0:n])
+	}
+
+	// all chunks and nested index objects are reported as backing contents.
+	cids, err := VerifyObject(ctx, om.contentMgr, oid)
+	require.NoError(t, err)
+	require.Greater(t, len(cids), numChunks)
+}
@@ -4,17 +4,97 @@
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"sync"
 
 	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/kopia/kopia/repo/compression"
 	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/format"
 )
 
 // Open creates new ObjectReader for reading given object from a repository.
+// It is safe to call Open concurrently from multiple goroutines as long as the provided
+// contentReader is safe for concurrent use, which is the case for content managers.
 func Open(ctx context.Context, r contentReader, objectID ID) (Reader, error) {
-	return openAndAssertLength(ctx, r, objectID, -1)
+	return openAndAssertLength(ctx, r, objectID, -1, 0)
+}
+
+// OpenConcat creates a Reader presenting the concatenation of the provided objects as a single object.
+// Unlike Manager.Concatenate() nothing is written to the repository, which makes it suitable for read-only access,
+// for example using DirectRepositoryWriter.ContentManager().
+func OpenConcat(ctx context.Context, cr contentReader, objectIDs []ID) (Reader, error) {
+	var (
+		seekTable   []IndirectObjectEntry
+		totalLength int64
+		err         error
+	)
+
+	for _, objectID := range objectIDs {
+		seekTable, totalLength, err = appendIndexEntriesForObject(ctx, cr, seekTable, totalLength, objectID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error appending %v", objectID)
+		}
+	}
+
+	return &objectReader{
+		ctx:         ctx,
+		cr:          cr,
+		seekTable:   seekTable,
+		totalLength: totalLength,
+	}, nil
+}
+
+// DefaultReadRangeParallelism is the default number of chunks fetched concurrently by ReadAt() and ReadRange().
+const DefaultReadRangeParallelism = 8
+
+// ReadRangeOptions provides options for ReadRange.
+type ReadRangeOptions struct {
+	Parallelism int // maximum number of chunks fetched concurrently, DefaultReadRangeParallelism if zero
+}
+
+// ReadRange reads len(p) bytes of the given object starting at the provided offset. Chunks covering
+// the range are fetched concurrently and assembled in order, which helps on high-latency storage.
+// Like io.ReaderAt it returns io.EOF when fewer than len(p) bytes are available.
+//
+// On error, the returned count is the number of leading bytes of p that were read successfully,
+// so the read can be resumed by calling ReadRange again at offset+n with p[n:].
+func ReadRange(ctx context.Context, cr contentReader, objectID ID, offset int64, p []byte, opt ReadRangeOptions) (int, error) {
+	rd, err := Open(ctx, cr, objectID)
+	if err != nil {
+		return 0, err
+	}
+
+	defer rd.Close() //nolint:errcheck
+
+	if opt.Parallelism == 0 {
+		opt.Parallelism = DefaultReadRangeParallelism
+	}
+
+	switch r := rd.(type) {
+	case *objectReader:
+		return r.readRange(p, offset, opt.Parallelism)
+
+	case io.ReaderAt:
+		//nolint:wrapcheck
+		return r.ReadAt(p, offset)
+
+	default:
+		if _, err := rd.Seek(offset, io.SeekStart); err != nil {
+			return 0, errors.Wrap(err, "seek error")
+		}
+
+		n, err := io.ReadFull(rd, p)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+
+		//nolint:wrapcheck
+		return n, err
+	}
 }
 
 // VerifyObject ensures that all objects backing ObjectID are present in the repository
@@ -42,13 +122,15 @@ type objectReader struct {
 	cr contentReader
 
 	seekTable []IndirectObjectEntry
+	depth     int // number of indirect objects opened to reach this one
 
 	currentPosition int64 // Overall position in the objectReader
 	totalLength     int64 // Overall length
 
-	currentChunkIndex    int    // Index of current chunk in the seek table
-	currentChunkData     []byte // Current chunk data
-	currentChunkPosition int    // Read position in the current chunk
+	currentChunkIndex    int     // Index of current chunk in the seek table
+	currentChunkData     []byte  // Current chunk data
+	currentChunkBuffer   *[]byte // Pooled buffer holding current chunk data
+	currentChunkPosition int     // Read position in the current chunk
 }
 
 func (r *objectReader) Read(buffer []byte) (int, error) {
@@ -103,27 +185,171 @@ func (r *objectReader) Read(buffer []byte) (int, error) {
 }
 
 func (r *objectReader) openCurrentChunk() error {
-	st := r.seekTable[r.currentChunkIndex]
-
-	rd, err := openAndAssertLength(r.ctx, r.cr, st.Object, st.Length)
+	bp, err := r.readChunk(r.ctx, r.seekTable[r.currentChunkIndex])
 	if err != nil {
 		return err
 	}
 
+	r.currentChunkBuffer = bp
+	r.currentChunkData = *bp
+	// the chunk may be reopened after being released by Close(), so resume at the current position.
+	r.currentChunkPosition = int(r.currentPosition - r.seekTable[r.currentChunkIndex].Start)
+
+	return nil
+}
+
+// readChunk returns the full contents of the chunk described by the provided seek table entry
+// in a pooled buffer, which must be released using releaseChunkBuffer() when no longer needed.
+func (r *objectReader) readChunk(ctx context.Context, st IndirectObjectEntry) (*[]byte, error) {
+	rd, err := openAndAssertLength(ctx, r.cr, st.Object, st.Length, r.depth+1)
+	if err != nil {
+		return nil, err
+	}
+
 	defer rd.Close() //nolint:errcheck
 
-	b := make([]byte, st.Length)
-	if _, err := io.ReadFull(rd, b); err != nil {
-		return errors.Wrap(err, "error reading chunk")
+	// the buffer has exactly the length of the chunk and is fully overwritten by ReadFull(),
+	// so no data from previous uses of the buffer is exposed.
+	bp := getChunkBuffer(int(st.Length))
+	if _, err := io.ReadFull(rd, *bp); err != nil {
+		releaseChunkBuffer(bp)
+
+		return nil, errors.Wrap(err, "error reading chunk")
 	}
 
-	r.currentChunkData = b
-	r.currentChunkPosition = 0
+	return bp, nil
+}
 
-	return nil
+// ReadAt implements io.ReaderAt. Chunks covering the requested range are fetched concurrently
+// using DefaultReadRangeParallelism. The current read position is not affected.
+func (r *objectReader) ReadAt(p []byte, off int64) (int, error) {
+	return r.readRange(p, off, DefaultReadRangeParallelism)
+}
+
+func (r *objectReader) readRange(p []byte, off int64, parallelism int) (int, error) {
+	if off < 0 {
+		return 0, errors.Errorf("invalid negative offset %v", off)
+	}
+
+	if off >= r.totalLength {
+		return 0, io.EOF
+	}
+
+	end := off + int64(len(p))
+	if end > r.totalLength {
+		end = r.totalLength
+	}
+
+	if end == off {
+		return 0, nil
+	}
+
+	first, err := r.findChunkIndexForOffset(off)
+	if err != nil {
+		return 0, err
+	}
+
+	last, err := r.findChunkIndexForOffset(end - 1)
+	if err != nil {
+		return 0, err
+	}
+
+	if parallelism <= 0 {
+		parallelism = 1
+	}
+
+	sem := make(chan struct{}, parallelism)
+
+	// done[i] is set once the chunk first+i has been copied into p.
+	done := make([]bool, last-first+1)
+
+	eg, ctx := errgroup.WithContext(r.ctx)
+
+	for i := first; i <= last; i++ {
+		i := i
+		st := r.seekTable[i]
+
+		// acquire semaphore before starting the goroutine to bound the number of chunks held in memory.
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		eg.Go(func() error {
+			defer func() { <-sem }()
+
+			bp, err := r.readChunk(ctx, st)
+			if err != nil {
+				return errors.Wrapf(err, "error reading chunk %v", st.Object)
+			}
+
+			defer releaseChunkBuffer(bp)
+
+			b := *bp
+
+			// copy the part of the chunk that overlaps [off, end)
+			copyStart, copyEnd := st.Start, st.endOffset()
+			if copyStart < off {
+				copyStart = off
+			}
+
+			if copyEnd > end {
+				copyEnd = end
+			}
+
+			copy(p[copyStart-off:copyEnd-off], b[copyStart-st.Start:copyEnd-st.Start])
+
+			done[i-first] = true
+
+			return nil
+		})
+	}
+
+	err = eg.Wait()
+	if err == nil && r.ctx.Err() != nil {
+		err = errors.Wrap(r.ctx.Err(), "error reading range")
+	}
+
+	if err != nil {
+		return r.completedPrefixLength(done, first, off, end), err
+	}
+
+	n := int(end - off)
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// completedPrefixLength returns the number of bytes of the range [off, end) covered by the leading chunks
+// starting at the first chunk which have been successfully read.
+func (r *objectReader) completedPrefixLength(done []bool, first int, off, end int64) int {
+	completedEnd := off
+
+	for i, ok := range done {
+		if !ok {
+			break
+		}
+
+		completedEnd = r.seekTable[first+i].endOffset()
+	}
+
+	if completedEnd > end {
+		completedEnd = end
+	}
+
+	return int(completedEnd - off)
 }
 
 func (r *objectReader) closeCurrentChunk() {
+	releaseChunkBuffer(r.currentChunkBuffer)
+
+	r.currentChunkBuffer = nil
 	r.currentChunkData = nil
 }
 
@@ -160,8 +386,8 @@ func (r *objectReader) Seek(offset int64, whence int) (int64, error) {
 	}
 
 	if offset >= r.totalLength {
+		r.closeCurrentChunk()
 		r.currentChunkIndex = len(r.seekTable)
-		r.currentChunkData = nil
 		r.currentPosition = offset
 
 		return offset, nil
@@ -192,6 +418,8 @@ func (r *objectReader) Seek(offset int64, whence int) (int64, error) {
 }
 
 func (r *objectReader) Close() error {
+	r.closeCurrentChunk()
+
 	return nil
 }
 
@@ -199,27 +427,118 @@ func (r *objectReader) Length() int64 {
 	return r.totalLength
 }
 
-func openAndAssertLength(ctx context.Context, cr contentReader, objectID ID, assertLength int64) (Reader, error) {
+func openAndAssertLength(ctx context.Context, cr contentReader, objectID ID, assertLength int64, depth int) (Reader, error) {
+	if depth > MaxIndirectionLevel {
+		return nil, errors.Errorf("object %v exceeds maximum indirection depth", objectID)
+	}
+
+	if data, ok := objectID.InlineData(); ok {
+		if assertLength != -1 && int64(len(data)) != assertLength {
+			return nil, errors.Errorf("unexpected inline object length %v, expected %v", len(data), assertLength)
+		}
+
+		return newObjectReaderWithData(data), nil
+	}
+
 	if indexObjectID, ok := objectID.IndexObjectID(); ok {
 		// recursively calls openAndAssertLength
-		seekTable, err := LoadIndexObject(ctx, cr, indexObjectID)
+		seekTable, err := loadIndexObject(ctx, cr, indexObjectID, depth+1)
+		if err != nil {
+			return nil, err
+		}
+
+		seekTable, err = expandNestedIndexEntries(ctx, cr, seekTable, depth+1, 0)
 		if err != nil {
 			return nil, err
 		}
 
-		totalLength := seekTable[len(seekTable)-1].endOffset()
+		// an index object without entries represents a zero-length object.
+		var totalLength int64
+		if len(seekTable) > 0 {
+			totalLength = seekTable[len(seekTable)-1].endOffset()
+		}
 
 		return &objectReader{
 			ctx:         ctx,
 			cr:          cr,
 			seekTable:   seekTable,
+			depth:       depth,
 			totalLength: totalLength,
 		}, nil
 	}
 
+	// top-level objects stored in a single compressed content get their length from the content index,
+	// so that the content is not fetched and decompressed until it's actually read.
+	if depth == 0 {
+		r, err := maybeNewLazyCompressedReader(ctx, cr, objectID)
+		if err != nil {
+			return nil, err
+		}
+
+		if r != nil {
+			return r, nil
+		}
+	}
+
 	return newRawReader(ctx, cr, objectID, assertLength)
 }
 
+// expandNestedIndexEntries replaces seek table entries referencing nested index objects, which are written
+// for objects with more entries than the maximum indirect fan-out, with the entries of those index objects,
+// so that each entry of the resulting seek table refers to a single chunk.
+func expandNestedIndexEntries(ctx context.Context, cr contentReader, entries []IndirectObjectEntry, depth, level int) ([]IndirectObjectEntry, error) {
+	var result []IndirectObjectEntry
+
+	for i, e := range entries {
+		nestedIndexID, ok := e.Object.IndexObjectID()
+
+		// entries nested too deeply are left in place and opened as separate objects when read,
+		// which is subject to the maximum indirection depth.
+		if !ok || level >= maxNestedIndexLevels {
+			if result != nil {
+				result = append(result, e)
+			}
+
+			continue
+		}
+
+		// allocate the result lazily, so that seek tables without nested index objects are returned as-is.
+		if result == nil {
+			result = append([]IndirectObjectEntry{}, entries[0:i]...)
+		}
+
+		nested, err := loadIndexObject(ctx, cr, nestedIndexID, depth)
+		if err != nil {
+			return nil, err
+		}
+
+		nested, err = expandNestedIndexEntries(ctx, cr, nested, depth, level+1)
+		if err != nil {
+			return nil, err
+		}
+
+		var nestedLength int64
+		if len(nested) > 0 {
+			nestedLength = nested[len(nested)-1].endOffset()
+		}
+
+		if nestedLength != e.Length {
+			return nil, errors.Wrapf(ErrMalformedIndirectObject, "nested index %v has length %v, expected %v", e.Object, nestedLength, e.Length)
+		}
+
+		for _, ne := range nested {
+			ne.Start += e.Start
+			result = append(result, ne)
+		}
+	}
+
+	if result == nil {
+		return entries, nil
+	}
+
+	return result, nil
+}
+
 func iterateIndirectObjectContents(ctx context.Context, cr contentReader, indexObjectID ID, tracker *contentIDTracker, callbackFunc func(contentID content.ID) error) error {
 	if err := iterateBackingContents(ctx, cr, indexObjectID, tracker, callbackFunc); err != nil {
 		return errors.Wrap(err, "unable to read index")
@@ -255,6 +574,11 @@ func iterateBackingContents(ctx context.Context, r contentReader, oid ID, tracke
 		return nil
 	}
 
+	if _, ok := oid.InlineData(); ok {
+		// inline objects are not backed by any contents.
+		return nil
+	}
+
 	return errors.Errorf("unrecognized object type: %v", oid)
 }
 
@@ -265,16 +589,31 @@ type indirectObject struct {
 
 // LoadIndexObject returns entries comprising index object.
 func LoadIndexObject(ctx context.Context, cr contentReader, indexObjectID ID) ([]IndirectObjectEntry, error) {
-	r, err := openAndAssertLength(ctx, cr, indexObjectID, -1)
+	return loadIndexObject(ctx, cr, indexObjectID, 0)
+}
+
+func loadIndexObject(ctx context.Context, cr contentReader, indexObjectID ID, depth int) ([]IndirectObjectEntry, error) {
+	r, err := openAndAssertLength(ctx, cr, indexObjectID, -1, depth)
 	if err != nil {
 		return nil, err
 	}
 	defer r.Close() //nolint:errcheck
 
+	// read the index fully before parsing, so that errors reading the contents backing the index
+	// are not reported as a malformed index.
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read indirect object index")
+	}
+
 	var ind indirectObject
 
-	if err := json.NewDecoder(r).Decode(&ind); err != nil {
-		return nil, errors.Wrap(err, "invalid indirect object")
+	if err := json.Unmarshal(data, &ind); err != nil {
+		return nil, errors.Wrapf(ErrMalformedIndirectObject, "invalid JSON in index %v: %v", indexObjectID, err)
+	}
+
+	if err := validateIndirectObject(&ind); err != nil {
+		return nil, errors.Wrapf(err, "index %v", indexObjectID)
 	}
 
 	return ind.Entries, nil
@@ -299,6 +638,11 @@ func newRawReader(ctx context.Context, cr contentReader, objectID ID, assertLeng
 		var b bytes.Buffer
 
 		if err = compression.DecompressByHeader(&b, bytes.NewReader(payload)); err != nil {
+			var uce compression.UnsupportedCompressorError
+			if errors.As(err, &uce) {
+				return nil, format.NewerVersionRequiredError{Format: fmt.Sprintf("compression %x", uce.HeaderID)}
+			}
+
 			return nil, errors.Wrap(err, "decompression error")
 		}
 
@@ -313,7 +657,7 @@ func newRawReader(ctx context.Context, cr contentReader, objectID ID, assertLeng
 }
 
 type readerWithData struct {
-	io.ReadSeeker
+	*bytes.Reader
 	length int64
 }
 
@@ -327,7 +671,160 @@ func (rwd *readerWithData) Length() int64 {
 
 func newObjectReaderWithData(data []byte) Reader {
 	return &readerWithData{
-		ReadSeeker: bytes.NewReader(data),
-		length:     int64(len(data)),
+		Reader: bytes.NewReader(data),
+		length: int64(len(data)),
 	}
 }
+
+// lazyCompressedReader reads an object stored in a single compressed content, whose uncompressed
+// length is known from the content index, deferring fetching the content until the first read.
+// As with chunks of indirect objects, a content that is present in the index but can't be read
+// is reported by the first read.
+type lazyCompressedReader struct {
+	ctx context.Context //nolint:containedctx
+
+	cr       contentReader
+	objectID ID
+	length   int64
+
+	mu sync.Mutex
+	// +checklocks:mu
+	position int64 // position before the content is fetched
+	// +checklocks:mu
+	delegate Reader // nil until the content is fetched
+	// +checklocks:mu
+	fetchErr error
+}
+
+// localContentInfoReader is implemented by content readers which look up content information
+// in a local index, without a round trip to a server.
+type localContentInfoReader interface {
+	ContentInfoIsLocal() bool
+}
+
+// maybeNewLazyCompressedReader returns a lazy reader for the provided object if it's stored in a single
+// content compressed by the content manager, nil otherwise. Objects whose content does not exist
+// fail to open, same as when they are read eagerly.
+func maybeNewLazyCompressedReader(ctx context.Context, cr contentReader, objectID ID) (Reader, error) {
+	contentID, compressed, ok := objectID.ContentID()
+	if !ok || compressed {
+		// contents compressed at the object level only record their compressed length.
+		return nil, nil
+	}
+
+	// when content information comes from a server, looking it up costs as much as fetching the content,
+	// which is decompressed by the server and also determines the length.
+	if l, ok := cr.(localContentInfoReader); !ok || !l.ContentInfoIsLocal() {
+		return nil, nil
+	}
+
+	ci, err := cr.ContentInfo(ctx, contentID)
+	if errors.Is(err, content.ErrContentNotFound) {
+		return nil, errors.Wrapf(ErrObjectNotFound, "content %v not found", contentID)
+	}
+
+	if err != nil || ci.GetCompressionHeaderID() == content.NoCompression {
+		// let the eager reader handle everything else.
+		return nil, nil
+	}
+
+	return &lazyCompressedReader{
+		ctx:      ctx,
+		cr:       cr,
+		objectID: objectID,
+		length:   int64(ci.GetOriginalLength()),
+	}, nil
+}
+
+// fetch returns the reader of the fetched content, fetching it on first use.
+//
+// +checklocks:r.mu
+func (r *lazyCompressedReader) fetch() (Reader, error) {
+	if r.delegate == nil && r.fetchErr == nil {
+		d, err := newRawReader(r.ctx, r.cr, r.objectID, r.length)
+		if err != nil {
+			r.fetchErr = err
+			return nil, err
+		}
+
+		if _, err := d.Seek(r.position, io.SeekStart); err != nil {
+			r.fetchErr = err
+			return nil, errors.Wrap(err, "seek error")
+		}
+
+		r.delegate = d
+	}
+
+	return r.delegate, r.fetchErr
+}
+
+func (r *lazyCompressedReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, err := r.fetch()
+	if err != nil {
+		return 0, err
+	}
+
+	return d.Read(p) //nolint:wrapcheck
+}
+
+func (r *lazyCompressedReader) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	d, err := r.fetch()
+	r.mu.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	ra, ok := d.(io.ReaderAt)
+	if !ok {
+		return 0, errors.Errorf("reader for %v does not support ReadAt", r.objectID)
+	}
+
+	return ra.ReadAt(p, off) //nolint:wrapcheck
+}
+
+func (r *lazyCompressedReader) Seek(offset int64, whence int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.delegate != nil {
+		return r.delegate.Seek(offset, whence) //nolint:wrapcheck
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.position
+	case io.SeekEnd:
+		offset += r.length
+	default:
+		return 0, errors.Errorf("invalid whence %v", whence)
+	}
+
+	if offset < 0 {
+		return 0, errors.Errorf("invalid seek %v", offset)
+	}
+
+	r.position = offset
+
+	return offset, nil
+}
+
+func (r *lazyCompressedReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.delegate != nil {
+		return r.delegate.Close() //nolint:wrapcheck
+	}
+
+	return nil
+}
+
+func (r *lazyCompressedReader) Length() int64 {
+	return r.length
+}
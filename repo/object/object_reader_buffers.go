@@ -0,0 +1,52 @@
+package object
+
+import (
+	"os"
+	"sync"
+)
+
+// maxPooledChunkBufferSize is the maximum size of chunk buffers retained for reuse,
+// which covers chunks produced by all built-in splitters.
+const maxPooledChunkBufferSize = 8 << 20
+
+// chunkBufferPoolEnabled determines whether chunk buffers are reused across object readers.
+// Disabling the pool can be helpful when debugging memory corruption issues.
+//
+//nolint:gochecknoglobals
+var chunkBufferPoolEnabled = os.Getenv("KOPIA_DISABLE_OBJECT_READER_BUFFER_POOL") == ""
+
+//nolint:gochecknoglobals
+var chunkBufferPool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
+// getChunkBuffer returns a buffer of exactly n bytes. The contents of the buffer are undefined
+// and must be fully overwritten by the caller before use.
+func getChunkBuffer(n int) *[]byte {
+	if !chunkBufferPoolEnabled || n > maxPooledChunkBufferSize {
+		b := make([]byte, n)
+		return &b
+	}
+
+	//nolint:forcetypeassert
+	bp := chunkBufferPool.Get().(*[]byte)
+	if *bp == nil || cap(*bp) < n {
+		*bp = make([]byte, n)
+	}
+
+	*bp = (*bp)[:n]
+
+	return bp
+}
+
+// releaseChunkBuffer returns the buffer obtained from getChunkBuffer to the pool.
+// The caller must not retain any references to the buffer afterwards.
+func releaseChunkBuffer(bp *[]byte) {
+	if bp == nil || !chunkBufferPoolEnabled || cap(*bp) > maxPooledChunkBufferSize {
+		return
+	}
+
+	chunkBufferPool.Put(bp)
+}
@@ -5,6 +5,7 @@
 	"encoding/json"
 	"io"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -64,7 +65,8 @@ func (t *contentIDTracker) contentIDs() []content.ID {
 
 type objectWriter struct {
 	// objectWriter implements io.Writer but needs context to talk to repository
-	ctx context.Context //nolint:containedctx
+	ctx    context.Context    //nolint:containedctx
+	cancel context.CancelFunc // cancels ctx when the writer has a deadline, nil otherwise
 
 	om *Manager
 
@@ -73,6 +75,7 @@ type objectWriter struct {
 	prefix      content.IDPrefix
 	buffer      gather.WriteBuffer
 	totalLength int64
+	maxSize     int64 // maximum object size, zero means unlimited
 
 	currentPosition int64
 
@@ -81,6 +84,10 @@ type objectWriter struct {
 	indirectIndexBuf       [4]IndirectObjectEntry // small buffer so that we avoid allocations most of the time
 
 	description string
+	expectID    *ID
+
+	// objects shorter than inlineThreshold are stored in their IDs.
+	inlineThreshold int
 
 	splitter splitter.Splitter
 
@@ -104,6 +111,11 @@ func (w *objectWriter) Close() error {
 
 	w.buffer.Close()
 
+	if w.cancel != nil {
+		w.cancel()
+		w.cancel = nil
+	}
+
 	w.om.closedWriter(w)
 
 	return nil
@@ -113,9 +125,17 @@ func (w *objectWriter) Write(data []byte) (n int, err error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	if err := w.checkDeadline(); err != nil {
+		return 0, err
+	}
+
 	dataLen := len(data)
 	w.totalLength += int64(dataLen)
 
+	if err := w.checkMaxSize(); err != nil {
+		return 0, err
+	}
+
 	for len(data) > 0 {
 		n := w.splitter.NextSplitPoint(data)
 		if n < 0 {
@@ -137,7 +157,37 @@ func (w *objectWriter) Write(data []byte) (n int, err error) {
 	return dataLen, nil
 }
 
+// checkDeadline fails the writer if its context has been canceled or its deadline has passed,
+// discarding any buffered data. Contents that have already been written are left in place since they
+// may be shared with other objects.
+func (w *objectWriter) checkDeadline() error {
+	if err := w.ctx.Err(); err != nil {
+		w.buffer.Reset()
+
+		return w.saveError(errors.Wrapf(err, "write of %v aborted", w.description))
+	}
+
+	return nil
+}
+
+// checkMaxSize fails the writer if the object has grown beyond the maximum size, discarding any buffered data.
+// Once exceeded, the limit remains exceeded, so all subsequent writes also fail.
+// Contents that have already been written are left in place since they may be shared with other objects.
+func (w *objectWriter) checkMaxSize() error {
+	if w.maxSize > 0 && w.totalLength > w.maxSize {
+		w.buffer.Reset()
+
+		return w.saveError(errors.Wrapf(ErrObjectTooLarge, "%v exceeds maximum object size of %v bytes", w.description, w.maxSize))
+	}
+
+	return nil
+}
+
 func (w *objectWriter) flushBuffer() error {
+	if err := w.checkDeadline(); err != nil {
+		return err
+	}
+
 	length := w.buffer.Length()
 
 	// hold a lock as we may grow the index
@@ -257,6 +307,25 @@ func (w *objectWriter) Result() (ID, error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	if err := w.checkMaxSize(); err != nil {
+		return EmptyID, err
+	}
+
+	if w.canInline() {
+		if err := w.checkDeadline(); err != nil {
+			return EmptyID, err
+		}
+
+		oid, err := InlineObjectID(w.buffer.ToByteSlice())
+		if err != nil {
+			return EmptyID, err
+		}
+
+		w.om.IDFormatter.record(oid, w.description)
+
+		return oid, w.checkExpectedID(oid)
+	}
+
 	// no need to hold a lock on w.indirectIndexGrowMutex, since growing index only happens synchronously
 	// and never in parallel with calling Result()
 	if w.buffer.Length() > 0 || len(w.indirectIndex) == 0 {
@@ -265,7 +334,29 @@ func (w *objectWriter) Result() (ID, error) {
 		}
 	}
 
-	return w.checkpointLocked()
+	oid, err := w.checkpointLocked()
+	if err != nil {
+		return EmptyID, err
+	}
+
+	w.om.IDFormatter.record(oid, w.description)
+
+	return oid, w.checkExpectedID(oid)
+}
+
+func (w *objectWriter) checkExpectedID(oid ID) error {
+	if w.expectID == nil || *w.expectID == oid {
+		return nil
+	}
+
+	return errors.Wrapf(ErrUnexpectedObjectID, "%v has ID %v, expected %v", w.description, oid, *w.expectID)
+}
+
+// canInline determines whether the entire object is still buffered and can be stored in its ID.
+func (w *objectWriter) canInline() bool {
+	return w.prefix == "" &&
+		len(w.indirectIndex) == 0 &&
+		w.buffer.Length() < w.inlineThreshold
 }
 
 // Checkpoint returns object ID which represents portion of the object that has already been written.
@@ -289,10 +380,65 @@ func (w *objectWriter) checkpointLocked() (ID, error) {
 		return EmptyID, nil
 	}
 
-	if len(w.indirectIndex) == 1 {
-		return w.indirectIndex[0].Object, nil
+	entries := w.indirectIndex
+
+	// group entries into nested index objects until the top-level index fits within the maximum fan-out.
+	if fanout := w.om.Format.MaxIndirectFanout; fanout > 0 {
+		for len(entries) > fanout {
+			var err error
+
+			if entries, err = w.groupIndexEntries(entries, fanout); err != nil {
+				return EmptyID, err
+			}
+		}
+	}
+
+	if len(entries) == 1 {
+		return entries[0].Object, nil
 	}
 
+	return w.writeIndexObject(entries)
+}
+
+// groupIndexEntries writes each consecutive group of up to 'fanout' entries as a nested index object
+// and returns entries referencing the nested index objects.
+func (w *objectWriter) groupIndexEntries(entries []IndirectObjectEntry, fanout int) ([]IndirectObjectEntry, error) {
+	var result []IndirectObjectEntry
+
+	for len(entries) > 0 {
+		n := fanout
+		if n > len(entries) {
+			n = len(entries)
+		}
+
+		group := entries[0:n]
+		entries = entries[n:]
+
+		start := group[0].Start
+
+		// offsets in nested index objects are relative to the start of the group.
+		relative := make([]IndirectObjectEntry, len(group))
+		for i, e := range group {
+			relative[i] = IndirectObjectEntry{Start: e.Start - start, Length: e.Length, Object: e.Object}
+		}
+
+		oid, err := w.writeIndexObject(relative)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, IndirectObjectEntry{
+			Start:  start,
+			Length: group[n-1].endOffset() - start,
+			Object: oid,
+		})
+	}
+
+	return result, nil
+}
+
+// writeIndexObject writes an index object with the provided entries and returns the ID of the indirect object.
+func (w *objectWriter) writeIndexObject(entries []IndirectObjectEntry) (ID, error) {
 	iw := &objectWriter{
 		ctx:         w.ctx,
 		om:          w.om,
@@ -309,7 +455,7 @@ func (w *objectWriter) checkpointLocked() (ID, error) {
 
 	defer iw.Close() //nolint:errcheck
 
-	if err := writeIndirectObject(iw, w.indirectIndex); err != nil {
+	if err := writeIndirectObject(iw, entries); err != nil {
 		return EmptyID, err
 	}
 
@@ -318,12 +464,16 @@ func (w *objectWriter) checkpointLocked() (ID, error) {
 		return EmptyID, err
 	}
 
+	if oid.indirection >= MaxIndirectionLevel {
+		return EmptyID, errors.Errorf("object %v exceeds maximum indirection level", w.description)
+	}
+
 	return IndirectObjectID(oid), nil
 }
 
 func writeIndirectObject(w io.Writer, entries []IndirectObjectEntry) error {
 	ind := indirectObject{
-		StreamID: "kopia:indirect",
+		StreamID: indirectStreamID,
 		Entries:  entries,
 	}
 
@@ -340,4 +490,22 @@ type WriterOptions struct {
 	Prefix      content.IDPrefix // empty string or a single-character ('g'..'z')
 	Compressor  compression.Name
 	AsyncWrites int // allow up to N content writes to be asynchronous
+
+	// Deadline, if set, causes writes that have not completed by the given time to fail
+	// with an error wrapping context.DeadlineExceeded.
+	Deadline time.Time
+
+	// AllowInline permits storing objects of up to MaxInlineObjectLength bytes directly in their
+	// object IDs instead of writing a content, regardless of ObjectFormat.InlineContentThreshold.
+	// It is ignored unless the repository was created with ObjectFormat.InlineObjects.
+	// Objects with a prefix are never inlined.
+	AllowInline bool
+
+	// MaxSize, if positive, limits the size of the object. Writes beyond the limit fail with an error
+	// wrapping ErrObjectTooLarge. Zero uses the repository default from ObjectFormat.MaxObjectSize.
+	MaxSize int64
+
+	// ExpectID, if set, causes Result() to fail with an error wrapping ErrUnexpectedObjectID when the
+	// object ID differs, which detects changes of the repository format. The computed ID is still returned.
+	ExpectID *ID
 }
@@ -1,6 +1,7 @@
 package object
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"strings"
 
@@ -10,15 +11,73 @@
 	"github.com/kopia/kopia/repo/content/index"
 )
 
+// MaxIndirectionLevel is the maximum supported number of indirection levels of an object.
+// Each level multiplies the maximum object size by the number of entries that fit in an index object,
+// so this is far more than any real object needs and guards against unbounded recursion when reading.
+const MaxIndirectionLevel = 8
+
+// maxNestedIndexLevels is the maximum supported number of levels of nested index objects
+// within a single indirect object.
+const maxNestedIndexLevels = 32
+
 // ID is an identifier of a repository object. Repository objects can be stored.
 //
 //  1. In a single content block, this is the most common case for small objects.
 //  2. In a series of content blocks with an indirect block pointing at them (multiple indirections are allowed).
-//     This is used for larger files. Object IDs using indirect blocks start with "I"
+//     This is used for larger files. Object IDs using indirect blocks start with IndirectPrefix ("I")
+//  3. Directly in the ID itself for tiny objects (up to MaxInlineObjectLength bytes), which need no
+//     content block at all. Such object IDs start with "L" followed by base64url-encoded data.
+//
+// The string representation uses hex by default, see IDEncoding for alternatives.
 type ID struct {
 	cid         content.ID
 	indirection byte
 	compression bool
+	inline      bool
+	inlineData  string
+}
+
+// MaxInlineObjectLength is the maximum length of an object that can be stored inline in its ID.
+const MaxInlineObjectLength = 32
+
+// IDEncoding specifies how the content hash of an object ID is encoded in its string representation.
+type IDEncoding int
+
+// Supported object ID encodings.
+const (
+	// IDEncodingHex encodes the content ID as a (possibly prefixed) hexadecimal string, this is the default.
+	IDEncodingHex IDEncoding = iota
+
+	// IDEncodingBase64URL encodes the content prefix and hash using unpadded base64url, which is
+	// about a third shorter than hex and safe for use in URLs and file names.
+	// Such IDs are marked with 'B' so that they can be told apart from hex IDs.
+	IDEncodingBase64URL
+)
+
+// Prefix characters of object IDs. They are upper-case so that they never collide with
+// content ID prefixes ('g'..'z') or hexadecimal digits of content hashes.
+const (
+	// IndirectPrefix marks an object stored using an indirect (index) object, repeated once per indirection level.
+	IndirectPrefix = 'I'
+
+	// CompressedPrefix marks a compressed object, it is mutually exclusive with IndirectPrefix.
+	CompressedPrefix = 'Z'
+
+	// DirectPrefix marks an object stored directly in a single content. It is optional and only
+	// accepted when parsing for compatibility with legacy object IDs, it is never emitted.
+	DirectPrefix = 'D'
+
+	// Base64URLPrefix precedes the content ID encoded using IDEncodingBase64URL.
+	Base64URLPrefix = 'B'
+
+	// InlinePrefix precedes base64url-encoded data of inline objects.
+	InlinePrefix = 'L'
+)
+
+// isObjectIDPrefixChar returns true if the provided character is in the range reserved
+// for object ID prefixes, regardless of whether the prefix is known.
+func isObjectIDPrefixChar(ch byte) bool {
+	return ch >= 'A' && ch <= 'Z'
 }
 
 // MarshalJSON implements JSON serialization of IDs.
@@ -59,6 +118,10 @@ type HasObjectID interface {
 
 // String returns string representation of ObjectID that is suitable for displaying in the UI.
 func (i ID) String() string {
+	if i.inline {
+		return string(InlinePrefix) + base64.RawURLEncoding.EncodeToString([]byte(i.inlineData))
+	}
+
 	var (
 		indirectPrefix    string
 		compressionPrefix string
@@ -68,26 +131,63 @@ func (i ID) String() string {
 	case 0:
 		// no prefix
 	case 1:
-		indirectPrefix = "I"
+		indirectPrefix = string(IndirectPrefix)
 	default:
-		indirectPrefix = strings.Repeat("I", int(i.indirection))
+		indirectPrefix = strings.Repeat(string(IndirectPrefix), int(i.indirection))
 	}
 
 	if i.compression {
-		compressionPrefix = "Z"
+		compressionPrefix = string(CompressedPrefix)
 	}
 
 	return indirectPrefix + compressionPrefix + i.cid.String()
 }
 
+// Encode returns string representation of ObjectID using the provided encoding.
+// The result can be parsed back using ParseID() regardless of the encoding.
+func (i ID) Encode(enc IDEncoding) string {
+	if enc != IDEncodingBase64URL || i.cid == content.EmptyID || i.inline {
+		return i.String()
+	}
+
+	var out []byte
+
+	for j := 0; j < int(i.indirection); j++ {
+		out = append(out, IndirectPrefix)
+	}
+
+	if i.compression {
+		out = append(out, CompressedPrefix)
+	}
+
+	// the first encoded byte holds the content prefix or zero if there's none.
+	var raw []byte
+
+	if p := i.cid.Prefix(); p != "" {
+		raw = append(raw, p[0])
+	} else {
+		raw = append(raw, 0)
+	}
+
+	raw = append(raw, i.cid.Hash()...)
+
+	out = append(out, Base64URLPrefix)
+
+	return string(out) + base64.RawURLEncoding.EncodeToString(raw)
+}
+
 // Append appends string representation of ObjectID that is suitable for displaying in the UI.
 func (i ID) Append(out []byte) []byte {
+	if i.inline {
+		return append(out, i.String()...)
+	}
+
 	for j := 0; j < int(i.indirection); j++ {
-		out = append(out, 'I')
+		out = append(out, IndirectPrefix)
 	}
 
 	if i.compression {
-		out = append(out, 'Z')
+		out = append(out, CompressedPrefix)
 	}
 
 	return i.cid.Append(out)
@@ -107,13 +207,22 @@ func (i ID) IndexObjectID() (ID, bool) {
 
 // ContentID returns the ID of the underlying content.
 func (i ID) ContentID() (id content.ID, compressed, ok bool) {
-	if i.indirection > 0 {
+	if i.indirection > 0 || i.inline {
 		return content.EmptyID, false, false
 	}
 
 	return i.cid, i.compression, true
 }
 
+// InlineData returns the data of an inline object.
+func (i ID) InlineData() ([]byte, bool) {
+	if !i.inline {
+		return nil, false
+	}
+
+	return []byte(i.inlineData), true
+}
+
 // IDsFromStrings converts strings to IDs.
 func IDsFromStrings(str []string) ([]ID, error) {
 	var result []ID
@@ -146,7 +255,19 @@ func DirectObjectID(contentID content.ID) ID {
 	return ID{cid: contentID}
 }
 
-// Compressed returns object ID with 'Z' prefix indicating it's compressed.
+// InlineObjectID returns object ID holding the provided data directly, which must not
+// be longer than MaxInlineObjectLength.
+//
+// The data is not encrypted, so it's visible to anyone who can see the object ID.
+func InlineObjectID(data []byte) (ID, error) {
+	if len(data) > MaxInlineObjectLength {
+		return EmptyID, errors.Errorf("inline object too long: %v, max %v", len(data), MaxInlineObjectLength)
+	}
+
+	return ID{inline: true, inlineData: string(data)}, nil
+}
+
+// Compressed returns object ID with CompressedPrefix indicating it's compressed.
 func Compressed(objectID ID) ID {
 	objectID.compression = true
 	return objectID
@@ -159,22 +280,45 @@ func IndirectObjectID(indexObjectID ID) ID {
 }
 
 // ParseID converts the specified string into object ID.
+//
+// The string consists of optional prefix characters (see IndirectPrefix, CompressedPrefix, DirectPrefix,
+// Base64URLPrefix and InlinePrefix) followed by the content ID. Unknown upper-case prefixes are rejected.
+// Display decorations following IDDecorationSeparator are ignored.
 func ParseID(s string) (ID, error) {
 	var id ID
 
-	for len(s) > 0 && s[0] == 'I' {
+	s0 := s
+
+	if p := strings.IndexByte(s, IDDecorationSeparator); p >= 0 {
+		s = s[:p]
+	}
+
+	if len(s) > 0 && s[0] == InlinePrefix {
+		data, err := base64.RawURLEncoding.DecodeString(s[1:])
+		if err != nil {
+			return id, errors.Wrapf(err, "malformed inline object ID: %q", s)
+		}
+
+		return InlineObjectID(data)
+	}
+
+	for len(s) > 0 && s[0] == IndirectPrefix {
 		id.indirection++
 
 		s = s[1:]
 	}
 
-	if len(s) > 0 && s[0] == 'Z' {
+	if id.indirection > MaxIndirectionLevel {
+		return id, errors.Errorf("malformed object ID - too many indirection levels")
+	}
+
+	if len(s) > 0 && s[0] == CompressedPrefix {
 		id.compression = true
 
 		s = s[1:]
 	}
 
-	if len(s) > 0 && s[0] == 'D' {
+	if len(s) > 0 && s[0] == DirectPrefix {
 		// no-op, legacy case
 		s = s[1:]
 	}
@@ -183,6 +327,21 @@ func ParseID(s string) (ID, error) {
 		return id, errors.Errorf("malformed object ID - compression and indirection are mutually exclusive")
 	}
 
+	if len(s) > 0 && s[0] == Base64URLPrefix {
+		cid, err := parseBase64URLContentID(s[1:])
+		if err != nil {
+			return id, errors.Wrapf(err, "malformed content ID: %q", s)
+		}
+
+		id.cid = cid
+
+		return id, nil
+	}
+
+	if len(s) > 0 && isObjectIDPrefixChar(s[0]) {
+		return id, errors.Errorf("malformed object ID - unknown prefix %q in %q", s[0], s0)
+	}
+
 	cid, err := index.ParseID(s)
 	if err != nil {
 		return id, errors.Wrapf(err, "malformed content ID: %q", s)
@@ -192,3 +351,22 @@ func ParseID(s string) (ID, error) {
 
 	return id, nil
 }
+
+func parseBase64URLContentID(s string) (content.ID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return content.EmptyID, errors.Wrap(err, "invalid base64url encoding")
+	}
+
+	if len(raw) < 2 { //nolint:gomnd
+		return content.EmptyID, errors.Errorf("content ID too short")
+	}
+
+	var prefix content.IDPrefix
+	if raw[0] != 0 {
+		prefix = content.IDPrefix(raw[0:1])
+	}
+
+	//nolint:wrapcheck
+	return index.IDFromHash(prefix, raw[1:])
+}
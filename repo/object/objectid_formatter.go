@@ -0,0 +1,71 @@
+package object
+
+import (
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// IDDecorationSeparator separates the string representation of an object ID from its display-only decoration.
+const IDDecorationSeparator = '~'
+
+// maxIDFormatterLabels is the number of labels of most recently written objects remembered by IDFormatter.
+const maxIDFormatterLabels = 10000
+
+// ContentIDFormatter returns a short human-readable label for objects written using the provided
+// WriterOptions.Description or an empty string to leave them undecorated.
+type ContentIDFormatter func(description string) string
+
+// IDFormatter formats object IDs for display, decorating IDs of objects written by the repository it has been
+// provided to with labels returned by ContentIDFormatter.
+//
+// Labels are intended for debugging and tests and are never used for storage or addressing, ID.String()
+// is not affected by them and ParseID() ignores them. Only labels of the most recently written objects
+// are remembered, IDs of older objects are formatted without them.
+type IDFormatter struct {
+	label  ContentIDFormatter
+	labels *lru.Cache // ID -> label
+}
+
+// NewIDFormatter returns a new IDFormatter which labels objects using the provided function.
+// A nil function leaves all objects undecorated.
+func NewIDFormatter(label ContentIDFormatter) *IDFormatter {
+	return newIDFormatter(label, maxIDFormatterLabels)
+}
+
+func newIDFormatter(label ContentIDFormatter, maxLabels int) *IDFormatter {
+	labels, _ := lru.New(maxLabels)
+
+	return &IDFormatter{
+		label:  label,
+		labels: labels,
+	}
+}
+
+// record remembers the display label of an object written using the provided description.
+func (f *IDFormatter) record(oid ID, description string) {
+	if f == nil || f.label == nil {
+		return
+	}
+
+	label := f.label(description)
+	if label == "" {
+		return
+	}
+
+	f.labels.Add(oid, label)
+}
+
+// Format returns string representation of the provided object ID decorated with its display label, if any.
+// The result can be parsed back using ParseID().
+func (f *IDFormatter) Format(oid ID) string {
+	s := oid.String()
+
+	if f == nil {
+		return s
+	}
+
+	if label, ok := f.labels.Get(oid); ok {
+		return s + string(IDDecorationSeparator) + label.(string) //nolint:forcetypeassert
+	}
+
+	return s
+}
@@ -1,6 +1,8 @@
 package object
 
 import (
+	"bytes"
+	"encoding/base64"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -40,6 +42,8 @@ func TestParseObjectID(t *testing.T) {
 		{"I-1,X", false},
 		{"Xsomething", false},
 		{"IZabcd", false},
+		{"IIIIIIIIDf0f0", true},
+		{"IIIIIIIIIDf0f0", false},
 	}
 
 	for _, tc := range cases {
@@ -52,6 +56,35 @@ func TestParseObjectID(t *testing.T) {
 	}
 }
 
+func TestParseObjectIDPrefixes(t *testing.T) {
+	valid := map[string]string{
+		"f0f0":                            "f0f0",
+		string(DirectPrefix) + "f0f0":     "f0f0",
+		string(IndirectPrefix) + "f0f0":   "If0f0",
+		string(CompressedPrefix) + "f0f0": "Zf0f0",
+		string(Base64URLPrefix) + "APDw":  "f0f0",
+		string(InlinePrefix) + "aGVsbG8":  "LaGVsbG8",
+	}
+
+	for text, want := range valid {
+		id, err := ParseID(text)
+		require.NoError(t, err, text)
+		require.Equal(t, want, id.String(), text)
+	}
+
+	for _, text := range []string{"Af0f0", "Xf0f0", "IXf0f0", "ZXf0f0", "DXf0f0", "Dno-such-block"} {
+		_, err := ParseID(text)
+		require.Error(t, err, text)
+	}
+
+	// unknown prefixes are reported as such.
+	_, err := ParseID("Xf0f0")
+	require.ErrorContains(t, err, "unknown prefix 'X'")
+
+	_, err = ParseID("IYf0f0")
+	require.ErrorContains(t, err, "unknown prefix 'Y'")
+}
+
 func TestFromStrings(t *testing.T) {
 	ids, err := IDsFromStrings([]string{"f0f0", "f1f1"})
 	require.NoError(t, err)
@@ -82,6 +115,69 @@ func TestString(t *testing.T) {
 	}
 }
 
+func TestEncodeRoundTrip(t *testing.T) {
+	cases := []string{
+		"",
+		"abcd",
+		"kabcd",
+		"Zabcd",
+		"Zkabcd",
+		"Iabcd",
+		"IIxabcd",
+		"999732b7c5da0d2f0283a57d48ed5e8a9ef2ae8c23e96e5c90349ceb8e2b4d89",
+		"Ik999732b7c5da0d2f0283a57d48ed5e8a9ef2ae8c23e96e5c90349ceb8e2b4d89",
+	}
+
+	for _, tc := range cases {
+		id := mustParseID(t, tc)
+
+		require.Equal(t, tc, id.Encode(IDEncodingHex))
+
+		b64 := id.Encode(IDEncodingBase64URL)
+		if tc != "" {
+			require.NotEqual(t, tc, b64)
+		}
+
+		require.NotContains(t, b64, "/")
+		require.NotContains(t, b64, "+")
+		require.NotContains(t, b64, "=")
+
+		id2 := mustParseID(t, b64)
+		require.Equal(t, id, id2, "round trip through %q", b64)
+		require.Equal(t, tc, id2.String())
+		require.Equal(t, b64, id2.Encode(IDEncodingBase64URL))
+	}
+
+	// base64url encoding is shorter.
+	long := mustParseID(t, "999732b7c5da0d2f0283a57d48ed5e8a9ef2ae8c23e96e5c90349ceb8e2b4d89")
+	require.Less(t, len(long.Encode(IDEncodingBase64URL)), len(long.String()))
+}
+
+func TestParseBase64URLObjectID(t *testing.T) {
+	cases := []struct {
+		text    string
+		isValid bool
+	}{
+		{"BAKvN", true},    // abcd
+		{"IBAKvN", true},   // Iabcd
+		{"ZBa6vN", true},   // Zkabcd
+		{"B", false},       // empty
+		{"BAA", false},     // no hash
+		{"BYavN", false},   // invalid prefix 'a'
+		{"BA*vN", false},   // invalid character
+		{"IZBAKvN", false}, // compression and indirection
+	}
+
+	for _, tc := range cases {
+		_, err := ParseID(tc.text)
+		if err != nil && tc.isValid {
+			t.Errorf("error parsing %q: %v", tc.text, err)
+		} else if err == nil && !tc.isValid {
+			t.Errorf("unexpected success parsing %v", tc.text)
+		}
+	}
+}
+
 func mustParseID(t *testing.T, s string) ID {
 	t.Helper()
 
@@ -90,3 +186,34 @@ func mustParseID(t *testing.T, s string) ID {
 
 	return id
 }
+
+func TestInlineObjectID(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("hello"), bytes.Repeat([]byte{0xff}, MaxInlineObjectLength)} {
+		oid, err := InlineObjectID(data)
+		require.NoError(t, err)
+
+		require.Equal(t, oid, mustParseID(t, oid.String()))
+		require.Equal(t, oid, mustParseID(t, oid.Encode(IDEncodingBase64URL)))
+		require.Equal(t, oid.String(), string(oid.Append(nil)))
+		require.NotEqual(t, EmptyID, oid)
+
+		got, ok := oid.InlineData()
+		require.True(t, ok)
+		require.Equal(t, len(data), len(got))
+
+		_, _, ok = oid.ContentID()
+		require.False(t, ok)
+	}
+
+	_, err := InlineObjectID(make([]byte, MaxInlineObjectLength+1))
+	require.Error(t, err)
+
+	_, err = ParseID("L" + base64.RawURLEncoding.EncodeToString(make([]byte, MaxInlineObjectLength+1)))
+	require.Error(t, err)
+
+	_, err = ParseID("L*")
+	require.Error(t, err)
+
+	_, ok := mustParseID(t, "Df0f0").InlineData()
+	require.False(t, ok)
+}
@@ -15,12 +15,14 @@
 	"github.com/kopia/kopia/internal/cache"
 	"github.com/kopia/kopia/internal/epoch"
 	"github.com/kopia/kopia/internal/feature"
+	"github.com/kopia/kopia/internal/objectcache"
 	"github.com/kopia/kopia/internal/retry"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/blob/beforeop"
 	loggingwrapper "github.com/kopia/kopia/repo/blob/logging"
 	"github.com/kopia/kopia/repo/blob/readonly"
 	"github.com/kopia/kopia/repo/blob/throttling"
+	"github.com/kopia/kopia/repo/blob/timeout"
 	"github.com/kopia/kopia/repo/content"
 	"github.com/kopia/kopia/repo/format"
 	"github.com/kopia/kopia/repo/logging"
@@ -43,6 +45,11 @@
 var supportedFeatures = []feature.Feature{
 	"index-v1",
 	"index-v2",
+	format.FeatureContentMAC,
+	format.FeatureInlineObjects,
+	format.FeatureHashSalt,
+	format.FeatureEnvelopeEncryption,
+	format.FeatureSplitterParameters,
 }
 
 // throttlingWindow is the duration window during which the throttling token bucket fully replenishes.
@@ -52,6 +59,12 @@
 // start with 10% of tokens in the bucket.
 const throttleBucketInitialFill = 0.1
 
+// manifestSigningKeyLength is the length of the key used to sign manifests for external transport.
+const manifestSigningKeyLength = 32
+
+//nolint:gochecknoglobals
+var manifestSigningKeyPurpose = []byte("manifest-signing")
+
 // localCacheIntegrityHMACSecretLength length of HMAC secret protecting local cache items.
 const localCacheIntegrityHMACSecretLength = 16
 
@@ -70,6 +83,44 @@ type Options struct {
 
 	OnFatalError func(err error) // function to invoke when repository encounters a fatal error, usually invokes os.Exit
 
+	// Default timeouts of individual storage operations, zero means no timeout.
+	StorageGetTimeout  time.Duration // GetBlob, GetMetadata
+	StoragePutTimeout  time.Duration // PutBlob, DeleteBlob
+	StorageListTimeout time.Duration // ListBlobs
+
+	// Maximum number of packs concurrently being written to the storage before writes block, zero means unlimited.
+	MaxPendingPackWrites int
+
+	// Deterministic makes writes reproducible, so that identical data written to identical repositories
+	// at identical times (see TimeNowFunc) produces byte-identical storage. Intended for reproducibility
+	// audits, not regular use.
+	Deterministic bool
+
+	// FlushCoalescingWindow, if positive, coalesces pending contents of write sessions flushing within
+	// the window of each other into shared packs, at the cost of delaying each flush by up to the window.
+	FlushCoalescingWindow time.Duration
+
+	// SkipContentMACVerification disables verification of per-content MACs on read, trading
+	// tamper detection for throughput. Intended for bulk restores from trusted storage only.
+	SkipContentMACVerification bool
+
+	// ReadVerifyProbability is the fraction of content reads which re-verify the content hash,
+	// logging any mismatch. Zero disables it.
+	ReadVerifyProbability float64
+
+	// ContentBloomFilter keeps a bloom filter of committed content IDs in memory, which speeds up
+	// lookups of absent contents at the cost of memory and building it when indexes are first loaded.
+	ContentBloomFilter bool
+
+	// IDFormatter, if set, remembers human-readable labels of IDs of objects written to the repository,
+	// which it includes when formatting them for display. Labels are never stored.
+	IDFormatter *object.IDFormatter
+
+	// MetadataOnly opens the repository for tools that only work with manifests, such as snapshot
+	// manifests and policies. Caches of data contents and objects are not set up and object operations
+	// fail with ErrMetadataOnly. Indexes are still loaded, since manifests are stored in contents.
+	MetadataOnly bool
+
 	// test-only flags
 	TestOnlyIgnoreMissingRequiredFeatures bool // ignore missing features
 }
@@ -77,6 +128,12 @@ type Options struct {
 // ErrInvalidPassword is returned when repository password is invalid.
 var ErrInvalidPassword = format.ErrInvalidPassword
 
+// ErrReadOnly is returned when attempting to write to a repository connected in read-only mode.
+var ErrReadOnly = readonly.ErrReadonly
+
+// ErrMetadataOnly is returned by object operations on a repository opened with Options.MetadataOnly.
+var ErrMetadataOnly = errors.New("not available in metadata-only mode")
+
 // ErrAlreadyInitialized is returned when repository is already initialized in the provided storage.
 var ErrAlreadyInitialized = format.ErrAlreadyInitialized
 
@@ -205,10 +262,33 @@ func openDirect(ctx context.Context, configFile string, lc *LocalConfig, passwor
 //
 //nolint:funlen,gocyclo
 func openWithConfig(ctx context.Context, st blob.Storage, cliOpts ClientOptions, password string, options *Options, cacheOpts *content.CachingOptions, configFile string) (DirectRepository, error) {
+	if t := storageTimeouts(options); !t.IsEmpty() {
+		st = timeout.NewWrapper(st, t)
+	}
+
 	cacheOpts = cacheOpts.CloneOrDefault()
+
+	if options.MetadataOnly {
+		// metadata cache size defaults to the content cache size, preserve it when disabling the content cache.
+		if cacheOpts.MaxMetadataCacheSizeBytes == 0 {
+			cacheOpts.MaxMetadataCacheSizeBytes = cacheOpts.MaxCacheSizeBytes
+		}
+
+		cacheOpts.MaxCacheSizeBytes = 0
+		cacheOpts.MaxObjectCacheSizeBytes = 0
+	}
+
 	cmOpts := &content.ManagerOptions{
-		TimeNow:            defaultTime(options.TimeNowFunc),
-		DisableInternalLog: options.DisableInternalLog,
+		TimeNow:              defaultTime(options.TimeNowFunc),
+		DisableInternalLog:   options.DisableInternalLog,
+		MaxPendingPackWrites: options.MaxPendingPackWrites,
+		Deterministic:        options.Deterministic,
+
+		FlushCoalescingWindow: options.FlushCoalescingWindow,
+
+		SkipContentMACVerification: options.SkipContentMACVerification,
+		ReadVerifyProbability:      options.ReadVerifyProbability,
+		ContentBloomFilter:         options.ContentBloomFilter,
 	}
 
 	fmgr, ferr := format.NewManager(ctx, st, cacheOpts.CacheDirectory, cliOpts.FormatBlobCacheDuration, password, cmOpts.TimeNow)
@@ -295,7 +375,17 @@ func openWithConfig(ctx context.Context, st blob.Storage, cliOpts ClientOptions,
 		return nil, errors.Wrap(ferr, "unable to open object manager")
 	}
 
-	manifests, ferr := manifest.NewManager(ctx, cm, manifest.ManagerOptions{TimeNow: cmOpts.TimeNow})
+	om.IDFormatter = options.IDFormatter
+
+	oc, ferr := objectcache.NewOrNil(cacheOpts.CacheDirectory, cacheOpts.MaxObjectCacheSizeBytes, "objects", cacheOpts.HMACSecret)
+	if ferr != nil {
+		return nil, errors.Wrap(ferr, "unable to open object cache")
+	}
+
+	manifests, ferr := manifest.NewManager(ctx, cm, manifest.ManagerOptions{
+		TimeNow:    cmOpts.TimeNow,
+		SigningKey: deriveKey(fmgr, manifestSigningKeyPurpose, manifestSigningKeyLength),
+	})
 	if ferr != nil {
 		return nil, errors.Wrap(ferr, "unable to open manifests")
 	}
@@ -314,6 +404,8 @@ func openWithConfig(ctx context.Context, st blob.Storage, cliOpts ClientOptions,
 			configFile:     configFile,
 			nextWriterID:   new(int32),
 			throttler:      throttler,
+			objectCache:    oc,
+			metadataOnly:   options.MetadataOnly,
 		},
 		closed: make(chan struct{}),
 	}
@@ -365,6 +457,14 @@ func wrapLockingStorage(st blob.Storage, r format.BlobStorageConfiguration) blob
 	})
 }
 
+func storageTimeouts(options *Options) timeout.Timeouts {
+	return timeout.Timeouts{
+		Get:  options.StorageGetTimeout,
+		Put:  options.StoragePutTimeout,
+		List: options.StorageListTimeout,
+	}
+}
+
 func addThrottler(st blob.Storage, limits throttling.Limits) (blob.Storage, throttling.SettableThrottler, error) {
 	throttler, err := throttling.NewThrottler(limits, throttlingWindow, throttleBucketInitialFill)
 	if err != nil {
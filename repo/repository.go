@@ -10,6 +10,7 @@
 	"go.opentelemetry.io/otel"
 
 	"github.com/kopia/kopia/internal/clock"
+	"github.com/kopia/kopia/internal/objectcache"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/blob/throttling"
 	"github.com/kopia/kopia/repo/content"
@@ -90,6 +91,8 @@ type directRepositoryParameters struct {
 	fmgr           *format.Manager
 	nextWriterID   *int32
 	throttler      throttling.SettableThrottler
+	objectCache    *objectcache.Cache
+	metadataOnly   bool
 }
 
 // directRepository is an implementation of repository that directly manipulates underlying storage.
@@ -107,14 +110,18 @@ type directRepository struct {
 
 // DeriveKey derives encryption key of the provided length from the master key.
 func (r *directRepository) DeriveKey(purpose []byte, keyLength int) []byte {
-	if r.cmgr.ContentFormat().SupportsPasswordChange() {
-		return format.DeriveKeyFromMasterKey(r.cmgr.ContentFormat().GetMasterKey(), r.UniqueID(), purpose, keyLength)
+	return deriveKey(r.fmgr, purpose, keyLength)
+}
+
+func deriveKey(fmgr *format.Manager, purpose []byte, keyLength int) []byte {
+	if fmgr.SupportsPasswordChange() {
+		return format.DeriveKeyFromMasterKey(fmgr.GetMasterKey(), fmgr.UniqueID(), purpose, keyLength)
 	}
 
 	// version of kopia <v0.9 had a bug where certain keys were derived directly from
 	// the password and not from the random master key. This made it impossible to change
 	// password.
-	return format.DeriveKeyFromMasterKey(r.fmgr.FormatEncryptionKey(), r.UniqueID(), purpose, keyLength)
+	return format.DeriveKeyFromMasterKey(fmgr.FormatEncryptionKey(), fmgr.UniqueID(), purpose, keyLength)
 }
 
 // ClientOptions returns client options.
@@ -144,11 +151,29 @@ func (r *directRepository) ConfigFilename() string {
 
 // NewObjectWriter creates an object writer.
 func (r *directRepository) NewObjectWriter(ctx context.Context, opt object.WriterOptions) object.Writer {
+	if r.metadataOnly {
+		return metadataOnlyObjectWriter{}
+	}
+
 	return r.omgr.NewWriter(ctx, opt)
 }
 
+// metadataOnlyObjectWriter is returned by NewObjectWriter in metadata-only mode and fails all writes.
+type metadataOnlyObjectWriter struct{}
+
+func (metadataOnlyObjectWriter) Write(p []byte) (int, error) { return 0, ErrMetadataOnly }
+func (metadataOnlyObjectWriter) Close() error                { return nil }
+func (metadataOnlyObjectWriter) Checkpoint() (object.ID, error) {
+	return object.EmptyID, ErrMetadataOnly
+}
+func (metadataOnlyObjectWriter) Result() (object.ID, error) { return object.EmptyID, ErrMetadataOnly }
+
 // ConcatenateObjects creates a concatenated objects from the provided object IDs.
 func (r *directRepository) ConcatenateObjects(ctx context.Context, objectIDs []object.ID) (object.ID, error) {
+	if r.metadataOnly {
+		return object.EmptyID, ErrMetadataOnly
+	}
+
 	//nolint:wrapcheck
 	return r.omgr.Concatenate(ctx, objectIDs)
 }
@@ -159,13 +184,30 @@ func (r *directRepository) DisableIndexRefresh() {
 }
 
 // OpenObject opens the reader for a given object, returns object.ErrNotFound.
+// It is safe to call from multiple goroutines, but each returned reader must only be used by one goroutine at a time.
 func (r *directRepository) OpenObject(ctx context.Context, id object.ID) (object.Reader, error) {
+	if r.metadataOnly {
+		return nil, ErrMetadataOnly
+	}
+
+	// only objects assembled from multiple contents benefit from the object cache.
+	if _, isIndirect := id.IndexObjectID(); isIndirect && r.objectCache != nil {
+		//nolint:wrapcheck
+		return r.objectCache.Open(ctx, string(id.Append(nil)), func(ctx context.Context) (object.Reader, error) {
+			return object.Open(ctx, r.cmgr, id)
+		})
+	}
+
 	//nolint:wrapcheck
 	return object.Open(ctx, r.cmgr, id)
 }
 
 // VerifyObject verifies that the given object is stored properly in a repository and returns backing content IDs.
 func (r *directRepository) VerifyObject(ctx context.Context, id object.ID) ([]content.ID, error) {
+	if r.metadataOnly {
+		return nil, ErrMetadataOnly
+	}
+
 	//nolint:wrapcheck
 	return object.VerifyObject(ctx, r.cmgr, id)
 }
@@ -201,6 +243,10 @@ func (r *directRepository) PrefetchContents(ctx context.Context, contentIDs []co
 
 // PrefetchObjects brings the requested objects into the cache.
 func (r *directRepository) PrefetchObjects(ctx context.Context, objectIDs []object.ID, hint string) ([]content.ID, error) {
+	if r.metadataOnly {
+		return nil, ErrMetadataOnly
+	}
+
 	//nolint:wrapcheck
 	return object.PrefetchBackingContents(ctx, r.cmgr, objectIDs, hint)
 }
@@ -240,10 +286,14 @@ func (r *directRepository) NewDirectWriter(ctx context.Context, opt WriteSession
 		SessionUser: r.cliOpts.Username,
 		SessionHost: r.cliOpts.Hostname,
 		OnUpload:    opt.OnUpload,
+
+		PresenceOracle:       opt.PresenceOracle,
+		VerifyPresenceOracle: opt.VerifyPresenceOracle,
 	}, writeManagerID)
 
 	mmgr, err := manifest.NewManager(ctx, cmgr, manifest.ManagerOptions{
-		TimeNow: r.timeNow,
+		TimeNow:    r.timeNow,
+		SigningKey: r.DeriveKey(manifestSigningKeyPurpose, manifestSigningKeyLength),
 	})
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "error creating manifest manager")
@@ -254,6 +304,8 @@ func (r *directRepository) NewDirectWriter(ctx context.Context, opt WriteSession
 		return nil, nil, errors.Wrap(err, "error creating object manager")
 	}
 
+	omgr.IDFormatter = r.omgr.IDFormatter
+
 	w := &directRepository{
 		directRepositoryParameters: r.directRepositoryParameters,
 		blobs:                      r.blobs,
@@ -287,13 +339,17 @@ func (r *directRepository) Close(ctx context.Context) error {
 	return nil
 }
 
-// Flush waits for all in-flight writes to complete.
+// Flush waits for all in-flight writes to complete and makes them durable if the storage supports it.
 func (r *directRepository) Flush(ctx context.Context) error {
 	if err := r.mmgr.Flush(ctx); err != nil {
 		return errors.Wrap(err, "error flushing manifests")
 	}
 
-	return errors.Wrap(r.cmgr.Flush(ctx), "error flushing contents")
+	if err := r.cmgr.Flush(ctx); err != nil {
+		return errors.Wrap(err, "error flushing contents")
+	}
+
+	return errors.Wrap(blob.Sync(ctx, r.blobs), "error syncing storage")
 }
 
 // ObjectFormat returns the object format.
@@ -347,6 +403,11 @@ type WriteSessionOptions struct {
 	Purpose        string
 	FlushOnFailure bool        // whether to flush regardless of write session result.
 	OnUpload       func(int64) // function to invoke after completing each upload in the session.
+
+	// PresenceOracle provides external knowledge about contents already in the repository, whose writes
+	// are skipped. Claims are trusted unless VerifyPresenceOracle is set. Only supported by direct repositories.
+	PresenceOracle       content.BlockPresenceOracle
+	VerifyPresenceOracle bool
 }
 
 // WriteSession executes the provided callback in a repository writer created for the purpose and flushes writes.
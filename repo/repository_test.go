@@ -3,27 +3,41 @@
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"runtime/debug"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
 
+	"github.com/kopia/kopia/internal/blobtesting"
 	"github.com/kopia/kopia/internal/cache"
+	"github.com/kopia/kopia/internal/clock"
 	"github.com/kopia/kopia/internal/epoch"
+	"github.com/kopia/kopia/internal/faketime"
+	"github.com/kopia/kopia/internal/feature"
 	"github.com/kopia/kopia/internal/gather"
 	"github.com/kopia/kopia/internal/repotesting"
 	"github.com/kopia/kopia/internal/testlogging"
+	"github.com/kopia/kopia/internal/testutil"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/blob"
 	"github.com/kopia/kopia/repo/blob/beforeop"
 	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/encryption"
 	"github.com/kopia/kopia/repo/format"
+	"github.com/kopia/kopia/repo/hashing"
 	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/repo/splitter"
 )
 
 func (s *formatSpecificTestSuite) TestWriters(t *testing.T) {
@@ -119,7 +133,7 @@ func (s *formatSpecificTestSuite) TestPackingSimple(t *testing.T) {
 		t.Errorf("oid3a(%q) != oid3b(%q)", got, want)
 	}
 
-	env.VerifyBlobCount(t, 4)
+	env.VerifyBlobCount(t, 6)
 
 	env.MustReopen(t)
 
@@ -148,6 +162,122 @@ func (s *formatSpecificTestSuite) TestPackingSimple(t *testing.T) {
 	verify(ctx, t, env.RepositoryWriter, oid3a, []byte(content3), "packed-object-3")
 }
 
+func (s *formatSpecificTestSuite) TestLocateContents(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, s.formatVersion)
+
+	// same data as TestPackingSimple
+	var cids []content.ID
+
+	for _, c := range []string{"hello, how do you do?", "hi, how are you?", "thank you!"} {
+		oid := writeObject(ctx, t, env.RepositoryWriter, []byte(c), "packed-object")
+
+		cid, _, ok := oid.ContentID()
+		require.True(t, ok)
+
+		cids = append(cids, cid)
+	}
+
+	missing, err := content.IDFromHash("", bytes.Repeat([]byte{0xab}, 32))
+	require.NoError(t, err)
+
+	cm := env.RepositoryWriter.ContentManager()
+
+	locs, err := cm.LocateContents(ctx, cids)
+	require.NoError(t, err)
+
+	for _, cid := range cids {
+		require.True(t, locs[cid].Found, cid)
+		require.True(t, locs[cid].Pending, cid)
+	}
+
+	require.NoError(t, cm.Flush(ctx))
+	env.MustReopen(t)
+
+	cm = env.RepositoryWriter.ContentManager()
+
+	locs, err = cm.LocateContents(ctx, append([]content.ID{missing}, cids...))
+	require.NoError(t, err)
+	require.Len(t, locs, len(cids)+1)
+
+	require.Equal(t, content.ContentLocation{}, locs[missing])
+	require.False(t, locs[missing].Found)
+
+	packID := locs[cids[0]].PackBlobID
+	offsets := map[uint32]bool{}
+
+	for _, cid := range cids {
+		loc := locs[cid]
+
+		require.True(t, loc.Found, cid)
+		require.False(t, loc.Pending, cid)
+		require.False(t, loc.Deleted, cid)
+
+		// all contents were flushed together into a single pack at different offsets.
+		require.Equal(t, packID, loc.PackBlobID, cid)
+		require.Equal(t, content.PackBlobIDPrefixRegular, loc.PackBlobID[0:1], cid)
+		require.NotZero(t, loc.PackedLength, cid)
+		require.False(t, offsets[loc.PackOffset], "duplicate offset %v", loc.PackOffset)
+
+		offsets[loc.PackOffset] = true
+
+		// the reported range is within the pack.
+		var tmp gather.WriteBuffer
+
+		require.NoError(t, env.RootStorage().GetBlob(ctx, loc.PackBlobID, int64(loc.PackOffset), int64(loc.PackedLength), &tmp))
+		require.Equal(t, int(loc.PackedLength), tmp.Length())
+
+		tmp.Close()
+	}
+}
+
+func (s *formatSpecificTestSuite) TestListPacks(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, s.formatVersion)
+
+	var want []content.ID
+
+	for _, c := range []string{"hello, how do you do?", "hi, how are you?", "thank you!"} {
+		oid1 := writeObject(ctx, t, env.RepositoryWriter, []byte(c), "packed-object-a")
+		oid2 := writeObject(ctx, t, env.RepositoryWriter, []byte(c), "packed-object-b")
+		require.Equal(t, oid1, oid2)
+
+		cid, _, ok := oid1.ContentID()
+		require.True(t, ok)
+
+		want = append(want, cid)
+	}
+
+	require.NoError(t, env.RepositoryWriter.ContentManager().Flush(ctx))
+	env.MustReopen(t)
+
+	packs, err := env.RepositoryWriter.ContentReader().ListPacks(ctx)
+	require.NoError(t, err)
+	require.Len(t, packs, 1)
+
+	packCount := map[content.ID]int{}
+
+	for _, pi := range packs {
+		require.True(t, strings.HasPrefix(string(pi.PackID), string(content.PackBlobIDPrefixRegular)), pi.PackID)
+		require.Equal(t, len(pi.ContentInfos), pi.ContentCount)
+
+		var totalSize int64
+
+		for _, ci := range pi.ContentInfos {
+			require.Equal(t, pi.PackID, ci.GetPackBlobID())
+
+			packCount[ci.GetContentID()]++
+			totalSize += int64(ci.GetPackedLength())
+		}
+
+		require.Equal(t, totalSize, pi.TotalSize)
+	}
+
+	require.Len(t, packCount, len(want))
+
+	for _, cid := range want {
+		require.Equal(t, 1, packCount[cid], "content %v", cid)
+	}
+}
+
 func (s *formatSpecificTestSuite) TestHMAC(t *testing.T) {
 	ctx, env := repotesting.NewEnvironment(t, s.formatVersion)
 
@@ -176,6 +306,57 @@ func (s *formatSpecificTestSuite) TestReaderStoredBlockNotFound(t *testing.T) {
 	}
 }
 
+func (s *formatSpecificTestSuite) TestConcurrentObjectReads(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, s.formatVersion)
+
+	const (
+		numObjects    = 30
+		numGoroutines = 16
+	)
+
+	objects := map[object.ID][]byte{}
+
+	for i := 0; i < numObjects; i++ {
+		data := make([]byte, rand.Intn(100000))
+		rand.Read(data)
+
+		objects[writeObject(ctx, t, env.RepositoryWriter, data, fmt.Sprintf("object-%v", i))] = data
+	}
+
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	// open a fresh repository so that all caches and indexes are populated concurrently.
+	rep := env.MustConnectOpenAnother(t)
+
+	eg, ctx := errgroup.WithContext(ctx)
+
+	for i := 0; i < numGoroutines; i++ {
+		eg.Go(func() error {
+			for oid, want := range objects {
+				r, err := rep.OpenObject(ctx, oid)
+				if err != nil {
+					return errors.Wrapf(err, "error opening %v", oid)
+				}
+
+				got, err := io.ReadAll(r)
+				r.Close()
+
+				if err != nil {
+					return errors.Wrapf(err, "error reading %v", oid)
+				}
+
+				if !bytes.Equal(got, want) {
+					return errors.Errorf("invalid data for %v", oid)
+				}
+			}
+
+			return nil
+		})
+	}
+
+	require.NoError(t, eg.Wait())
+}
+
 func writeObject(ctx context.Context, t *testing.T, rep repo.RepositoryWriter, data []byte, testCaseID string) object.ID {
 	t.Helper()
 
@@ -541,6 +722,178 @@ func TestInitializeWithNoRetention(t *testing.T) {
 	require.NoError(t, env.RepositoryWriter.BlobStorage().GetBlob(ctx, format.KopiaBlobCfgBlobID, 0, -1, &b))
 }
 
+// syncCountingStorage implements blob.Flusher and counts calls to Sync().
+type syncCountingStorage struct {
+	blob.Storage
+
+	// +checkatomic
+	syncCount int32
+}
+
+func (s *syncCountingStorage) Sync(ctx context.Context) error {
+	atomic.AddInt32(&s.syncCount, 1)
+	return nil
+}
+
+func TestStorageSyncOnFlushAndClose(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	st := &syncCountingStorage{Storage: blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)}
+	rst := repotesting.NewReconnectableStorage(t, st)
+	configFile := filepath.Join(testutil.TempDirectory(t), "kopia.config")
+
+	require.NoError(t, repo.Initialize(ctx, rst, &repo.NewRepositoryOptions{}, repotesting.DefaultPasswordForTesting))
+	require.NoError(t, repo.Connect(ctx, configFile, rst, repotesting.DefaultPasswordForTesting, nil))
+
+	r, err := repo.Open(ctx, configFile, repotesting.DefaultPasswordForTesting, nil)
+	require.NoError(t, err)
+
+	_, w, err := r.NewWriter(ctx, repo.WriteSessionOptions{Purpose: "test"})
+	require.NoError(t, err)
+
+	writeObject(ctx, t, w, []byte{1, 2, 3}, "o1")
+
+	before := atomic.LoadInt32(&st.syncCount)
+	require.NoError(t, w.Flush(ctx))
+	require.Greater(t, atomic.LoadInt32(&st.syncCount), before, "Sync() not called on flush")
+
+	before = atomic.LoadInt32(&st.syncCount)
+	require.NoError(t, w.Close(ctx))
+	require.NoError(t, r.Close(ctx))
+	require.Greater(t, atomic.LoadInt32(&st.syncCount), before, "Sync() not called on close")
+}
+
+func TestConnectWithWrongPassword(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	st := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+	rst := repotesting.NewReconnectableStorage(t, st)
+	configFile := filepath.Join(testutil.TempDirectory(t), "kopia.config")
+
+	require.NoError(t, repo.Initialize(ctx, rst, &repo.NewRepositoryOptions{}, repotesting.DefaultPasswordForTesting))
+
+	require.ErrorIs(t, repo.Connect(ctx, configFile, rst, "wrong-password", nil), repo.ErrInvalidPassword)
+	require.NoFileExists(t, configFile)
+
+	require.NoError(t, repo.Connect(ctx, configFile, rst, repotesting.DefaultPasswordForTesting, nil))
+
+	_, err := repo.Open(ctx, configFile, "wrong-password", nil)
+	require.ErrorIs(t, err, repo.ErrInvalidPassword)
+}
+
+func TestObjectCache(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	st := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+	rst := repotesting.NewReconnectableStorage(t, st)
+	configFile := filepath.Join(testutil.TempDirectory(t), "kopia.config")
+	cacheDir := testutil.TempDirectory(t)
+
+	require.NoError(t, repo.Initialize(ctx, rst, &repo.NewRepositoryOptions{
+		ObjectFormat: format.ObjectFormat{Splitter: "FIXED-1M"},
+	}, repotesting.DefaultPasswordForTesting))
+	require.NoError(t, repo.Connect(ctx, configFile, rst, repotesting.DefaultPasswordForTesting, &repo.ConnectOptions{
+		CachingOptions: content.CachingOptions{
+			CacheDirectory:          cacheDir,
+			MaxCacheSizeBytes:       1e8,
+			MaxObjectCacheSizeBytes: 1e8,
+		},
+	}))
+
+	data := make([]byte, 3<<20)
+	rand.Read(data)
+
+	r, err := repo.Open(ctx, configFile, repotesting.DefaultPasswordForTesting, nil)
+	require.NoError(t, err)
+
+	_, w, err := r.NewWriter(ctx, repo.WriteSessionOptions{Purpose: "test"})
+	require.NoError(t, err)
+
+	oid := writeObject(ctx, t, w, data, "o1")
+	require.NoError(t, w.Flush(ctx))
+
+	_, isIndirect := oid.IndexObjectID()
+	require.True(t, isIndirect)
+
+	verify(ctx, t, w, oid, data, "first read")
+
+	// only objects read sequentially to the end are added to the object cache.
+	reader, err := w.OpenObject(ctx, oid)
+	require.NoError(t, err)
+
+	all, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, data, all)
+	require.NoError(t, reader.Close())
+
+	require.NoError(t, w.Close(ctx))
+	require.NoError(t, r.Close(ctx))
+
+	// with pack blobs and cached contents gone, the object can only be served from the object cache.
+	require.NoError(t, st.ListBlobs(ctx, content.PackBlobIDPrefixRegular, func(bm blob.Metadata) error {
+		return st.DeleteBlob(ctx, bm.BlobID)
+	}))
+	require.NoError(t, os.RemoveAll(filepath.Join(cacheDir, "contents")))
+
+	r, err = repo.Open(ctx, configFile, repotesting.DefaultPasswordForTesting, nil)
+	require.NoError(t, err)
+
+	defer r.Close(ctx)
+
+	verify(ctx, t, r, oid, data, "cached read")
+}
+
+func TestMetadataOnlyMode(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, format.FormatVersion3)
+
+	oid := writeObject(ctx, t, env.RepositoryWriter, []byte{1, 2, 3}, "o1")
+
+	mid, err := env.RepositoryWriter.PutManifest(ctx, map[string]string{"type": "test"}, map[string]string{"key": "value"})
+	require.NoError(t, err)
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	r, err := repo.Open(ctx, env.ConfigFile(), env.Password, &repo.Options{MetadataOnly: true})
+	require.NoError(t, err)
+
+	defer r.Close(ctx)
+
+	// manifests can be read and written.
+	var payload map[string]string
+
+	_, err = r.GetManifest(ctx, mid, &payload)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"key": "value"}, payload)
+
+	_, w, err := r.NewWriter(ctx, repo.WriteSessionOptions{Purpose: "test"})
+	require.NoError(t, err)
+
+	defer w.Close(ctx)
+
+	_, err = w.PutManifest(ctx, map[string]string{"type": "test"}, map[string]string{"key": "value2"})
+	require.NoError(t, err)
+	require.NoError(t, w.Flush(ctx))
+
+	entries, err := r.FindManifests(ctx, map[string]string{"type": "test"})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	// object operations are not available.
+	_, err = r.OpenObject(ctx, oid)
+	require.ErrorIs(t, err, repo.ErrMetadataOnly)
+
+	_, err = r.VerifyObject(ctx, oid)
+	require.ErrorIs(t, err, repo.ErrMetadataOnly)
+
+	ow := w.NewObjectWriter(ctx, object.WriterOptions{})
+	defer ow.Close()
+
+	_, err = ow.Write([]byte{1})
+	require.ErrorIs(t, err, repo.ErrMetadataOnly)
+
+	_, err = ow.Result()
+	require.ErrorIs(t, err, repo.ErrMetadataOnly)
+}
+
 func TestObjectWritesWithRetention(t *testing.T) {
 	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant, repotesting.Options{
 		NewRepositoryOptions: func(n *repo.NewRepositoryOptions) {
@@ -567,7 +920,7 @@ func TestObjectWritesWithRetention(t *testing.T) {
 	}
 
 	prefixesWithRetention = append(prefixesWithRetention, content.LegacyIndexBlobPrefix, epoch.EpochManagerIndexUberPrefix,
-		format.KopiaRepositoryBlobID, format.KopiaBlobCfgBlobID)
+		format.KopiaRepositoryBlobID, format.KopiaBlobCfgBlobID, format.KopiaDescriptorBlobID)
 
 	// make sure that we cannot set mtime on the kopia objects created due to the
 	// retention time constraint
@@ -748,3 +1101,554 @@ func mustParseObjectID(t *testing.T, s string) object.ID {
 
 	return id
 }
+
+func TestFormatBlobIntegrity(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	st := repotesting.NewReconnectableStorage(t, blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil))
+	configFile := filepath.Join(testutil.TempDirectory(t), "kopia.config")
+
+	require.NoError(t, repo.Initialize(ctx, st, &repo.NewRepositoryOptions{}, repotesting.DefaultPasswordForTesting))
+
+	var primary, secondary gather.WriteBuffer
+	defer primary.Close()
+	defer secondary.Close()
+
+	require.NoError(t, st.GetBlob(ctx, format.KopiaRepositoryBlobID, 0, -1, &primary))
+	require.NoError(t, st.GetBlob(ctx, format.KopiaRepositorySecondaryBlobID, 0, -1, &secondary))
+	require.Equal(t, primary.ToByteSlice(), secondary.ToByteSlice())
+
+	// corrupt the encrypted format bytes while keeping the blob a valid JSON.
+	f, err := format.ParseKopiaRepositoryJSON(primary.ToByteSlice())
+	require.NoError(t, err)
+
+	f.EncryptedFormatBytes[len(f.EncryptedFormatBytes)/2] ^= 1
+
+	corrupted, err := json.Marshal(f)
+	require.NoError(t, err)
+	require.NoError(t, st.PutBlob(ctx, format.KopiaRepositoryBlobID, gather.FromSlice(corrupted), blob.PutOptions{}))
+
+	err = repo.Connect(ctx, configFile, st, repotesting.DefaultPasswordForTesting, nil)
+	require.ErrorIs(t, err, format.ErrFormatBlobIntegrity)
+	require.Contains(t, err.Error(), format.KopiaRepositorySecondaryBlobID)
+
+	// wrong password is reported as such rather than as corruption.
+	require.ErrorIs(t, format.VerifyKopiaRepositoryBlob(corrupted, "wrong-password"), format.ErrInvalidPassword)
+	require.ErrorIs(t, format.RestoreKopiaRepositoryBlobFromSecondary(ctx, st, "wrong-password"), format.ErrInvalidPassword)
+
+	require.NoError(t, format.RestoreKopiaRepositoryBlobFromSecondary(ctx, st, repotesting.DefaultPasswordForTesting))
+	require.NoError(t, repo.Connect(ctx, configFile, st, repotesting.DefaultPasswordForTesting, nil))
+
+	// format writes keep the secondary copy up-to-date.
+	fm, err := format.NewManager(ctx, st, testutil.TempDirectory(t), 0, repotesting.DefaultPasswordForTesting, clock.Now)
+	require.NoError(t, err)
+	require.NoError(t, fm.ChangePassword(ctx, "new-password"))
+
+	require.NoError(t, st.GetBlob(ctx, format.KopiaRepositoryBlobID, 0, -1, &primary))
+	require.NoError(t, st.GetBlob(ctx, format.KopiaRepositorySecondaryBlobID, 0, -1, &secondary))
+	require.Equal(t, primary.ToByteSlice(), secondary.ToByteSlice())
+	require.NotEqual(t, corrupted, primary.ToByteSlice())
+}
+
+func TestRestoreFormatBlobFromSecondaryKeepsRetention(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	var restoredOptions *blob.PutOptions
+
+	st := beforeop.NewWrapper(blobtesting.NewVersionedMapStorage(nil), nil, nil, nil, func(ctx context.Context, id blob.ID, opts *blob.PutOptions) error {
+		if id == format.KopiaRepositoryBlobID {
+			o := *opts
+			restoredOptions = &o
+		}
+
+		return nil
+	})
+
+	require.NoError(t, repo.Initialize(ctx, st, &repo.NewRepositoryOptions{
+		RetentionMode:   blob.Governance,
+		RetentionPeriod: 24 * time.Hour,
+	}, repotesting.DefaultPasswordForTesting))
+
+	restoredOptions = nil
+
+	require.NoError(t, format.RestoreKopiaRepositoryBlobFromSecondary(ctx, st, repotesting.DefaultPasswordForTesting))
+	require.NotNil(t, restoredOptions)
+	require.Equal(t, blob.Governance, restoredOptions.RetentionMode)
+	require.Equal(t, 24*time.Hour, restoredOptions.RetentionPeriod)
+}
+
+func TestConnectToRepositoryWithNewerFormat(t *testing.T) {
+	cases := []struct {
+		desc       string
+		modify     func(rc *format.RepositoryConfig)
+		wantFormat string
+	}{
+		{"hash", func(rc *format.RepositoryConfig) { rc.Hash = "FUTURE-HASH-512" }, "FUTURE-HASH-512"},
+		{"encryption", func(rc *format.RepositoryConfig) { rc.Encryption = "FUTURE-ENCRYPTION" }, "FUTURE-ENCRYPTION"},
+		{"splitter", func(rc *format.RepositoryConfig) { rc.Splitter = "FUTURE-SPLITTER" }, "FUTURE-SPLITTER"},
+		{"version", func(rc *format.RepositoryConfig) { rc.Version = format.MaxFormatVersion + 1 }, fmt.Sprintf("version %v", format.MaxFormatVersion+1)},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := testlogging.Context(t)
+			st := repotesting.NewReconnectableStorage(t, blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil))
+
+			rc := &format.RepositoryConfig{
+				ContentFormat: format.ContentFormat{
+					MutableParameters: format.MutableParameters{
+						Version:     format.FormatVersion2,
+						MaxPackSize: 20 << 20,
+					},
+					Hash:       hashing.DefaultAlgorithm,
+					Encryption: encryption.DefaultAlgorithm,
+					HMACSecret: []byte{1, 2, 3, 4, 5},
+					MasterKey:  bytes.Repeat([]byte{1}, 32),
+				},
+				ObjectFormat: format.ObjectFormat{
+					Splitter: splitter.DefaultAlgorithm,
+				},
+			}
+
+			tc.modify(rc)
+
+			require.NoError(t, format.Initialize(ctx, st, &format.KopiaRepositoryJSON{}, rc, format.BlobStorageConfiguration{}, repotesting.DefaultPasswordForTesting))
+
+			configFile := filepath.Join(testutil.TempDirectory(t), "kopia.config")
+
+			err := repo.Connect(ctx, configFile, st, repotesting.DefaultPasswordForTesting, nil)
+
+			var nve format.NewerVersionRequiredError
+
+			require.ErrorAs(t, err, &nve)
+			require.ErrorIs(t, err, format.ErrFormatUnsupported)
+			require.Equal(t, tc.wantFormat, nve.Format)
+			require.Contains(t, err.Error(), fmt.Sprintf("repository requires a newer version supporting format %q", tc.wantFormat))
+		})
+	}
+}
+
+func TestReadOnlyRepositoryWrite(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, format.FormatVersion2)
+
+	require.NoError(t, repo.SetClientOptions(ctx, env.ConfigFile(), repo.ClientOptions{ReadOnly: true}))
+
+	r, err := repo.Open(ctx, env.ConfigFile(), env.Password, nil)
+	require.NoError(t, err)
+
+	defer r.Close(ctx)
+
+	_, w, err := r.NewWriter(ctx, repo.WriteSessionOptions{Purpose: "test"})
+	require.NoError(t, err)
+
+	defer w.Close(ctx)
+
+	ow := w.NewObjectWriter(ctx, object.WriterOptions{})
+	defer ow.Close()
+
+	_, err = ow.Write([]byte{1, 2, 3})
+	require.NoError(t, err)
+
+	_, err = ow.Result()
+	require.ErrorIs(t, err, repo.ErrReadOnly)
+}
+
+func TestDeterministicWrites(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	initial := blobtesting.DataMap{}
+
+	require.NoError(t, repo.Initialize(ctx, blobtesting.NewMapStorage(initial, nil, nil), &repo.NewRepositoryOptions{}, repotesting.DefaultPasswordForTesting))
+
+	writeDeterministic := func() blobtesting.DataMap {
+		data := blobtesting.DataMap{}
+		for k, v := range initial {
+			data[k] = append([]byte(nil), v...)
+		}
+
+		st := repotesting.NewReconnectableStorage(t, blobtesting.NewMapStorage(data, nil, nil))
+		configFile := filepath.Join(testutil.TempDirectory(t), "kopia.config")
+
+		require.NoError(t, repo.Connect(ctx, configFile, st, repotesting.DefaultPasswordForTesting, nil))
+
+		// content timestamps are preserved, so the clock must be reproducible too; a frozen
+		// clock is used because background goroutines may read it a varying number of times.
+		rep, err := repo.Open(ctx, configFile, repotesting.DefaultPasswordForTesting, &repo.Options{
+			Deterministic: true,
+			TimeNowFunc:   faketime.Frozen(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)),
+		})
+		require.NoError(t, err)
+
+		defer rep.Close(ctx)
+
+		written := map[object.ID][]byte{}
+
+		// write in two sessions, so that the second one is based on indexes committed by the first.
+		for session := 0; session < 2; session++ {
+			require.NoError(t, repo.WriteSession(ctx, rep, repo.WriteSessionOptions{}, func(ctx context.Context, w repo.RepositoryWriter) error {
+				for i := 0; i < 20; i++ {
+					b := bytes.Repeat([]byte{byte(session), byte(i)}, 1000*(i+1))
+
+					oid := writeObject(ctx, t, w, b, fmt.Sprintf("%v-%v", session, i))
+					written[oid] = b
+				}
+
+				return nil
+			}))
+		}
+
+		for oid, want := range written {
+			verify(ctx, t, rep, oid, want, oid.String())
+		}
+
+		return data
+	}
+
+	data1 := writeDeterministic()
+	data2 := writeDeterministic()
+
+	require.Greater(t, len(data1), len(initial))
+	require.Equal(t, data1, data2)
+}
+
+func TestDeterministicWritesConcurrent(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	data := blobtesting.DataMap{}
+	st := repotesting.NewReconnectableStorage(t, blobtesting.NewMapStorage(data, nil, nil))
+
+	require.NoError(t, repo.Initialize(ctx, st, &repo.NewRepositoryOptions{}, repotesting.DefaultPasswordForTesting))
+
+	// both writers start from the same set of indexes, so they share the session ID.
+	var (
+		configFiles []string
+		writers     []repo.RepositoryWriter
+	)
+
+	written := map[object.ID][]byte{}
+
+	for i := 0; i < 2; i++ {
+		configFile := filepath.Join(testutil.TempDirectory(t), "kopia.config")
+
+		require.NoError(t, repo.Connect(ctx, configFile, st, repotesting.DefaultPasswordForTesting, nil))
+
+		rep, err := repo.Open(ctx, configFile, repotesting.DefaultPasswordForTesting, &repo.Options{Deterministic: true})
+		require.NoError(t, err)
+
+		defer rep.Close(ctx)
+
+		_, w, err := rep.NewWriter(ctx, repo.WriteSessionOptions{})
+		require.NoError(t, err)
+
+		defer w.Close(ctx)
+
+		b := bytes.Repeat([]byte{byte(i)}, 10000)
+		written[writeObject(ctx, t, w, b, fmt.Sprintf("writer-%v", i))] = b
+
+		configFiles = append(configFiles, configFile)
+		writers = append(writers, w)
+	}
+
+	for _, w := range writers {
+		require.NoError(t, w.Flush(ctx))
+	}
+
+	rep, err := repo.Open(ctx, configFiles[0], repotesting.DefaultPasswordForTesting, nil)
+	require.NoError(t, err)
+
+	defer rep.Close(ctx)
+
+	for oid, want := range written {
+		verify(ctx, t, rep, oid, want, oid.String())
+	}
+}
+
+func TestMaxIndexBlockSize(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	require.ErrorContains(t, repo.Initialize(ctx, blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil), &repo.NewRepositoryOptions{
+		BlockFormat: format.ContentFormat{MutableParameters: format.MutableParameters{MaxIndexBlockSize: -1}},
+	}, repotesting.DefaultPasswordForTesting), "max index block size must not be negative")
+
+	_, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant, repotesting.Options{
+		NewRepositoryOptions: func(n *repo.NewRepositoryOptions) {
+			n.BlockFormat.MaxIndexBlockSize = 1 << 20
+		},
+	})
+
+	env.MustReopen(t)
+
+	mp, err := env.RepositoryWriter.FormatManager().GetMutableParameters()
+	require.NoError(t, err)
+	require.Equal(t, 1<<20, mp.MaxIndexBlockSize)
+}
+
+func TestMaxIndirectFanout(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	require.ErrorContains(t, repo.Initialize(ctx, blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil), &repo.NewRepositoryOptions{
+		ObjectFormat: format.ObjectFormat{MaxIndirectFanout: 1},
+	}, repotesting.DefaultPasswordForTesting), "invalid maximum indirect fan-out")
+
+	_, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant, repotesting.Options{
+		NewRepositoryOptions: func(n *repo.NewRepositoryOptions) {
+			n.ObjectFormat.MaxIndirectFanout = 4
+		},
+	})
+
+	env.MustReopen(t)
+
+	require.Equal(t, 4, env.RepositoryWriter.ObjectFormat().MaxIndirectFanout)
+}
+
+func TestInlineContentThreshold(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	require.ErrorContains(t, repo.Initialize(ctx, blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil), &repo.NewRepositoryOptions{
+		ObjectFormat: format.ObjectFormat{InlineContentThreshold: object.MaxInlineObjectLength + 2},
+	}, repotesting.DefaultPasswordForTesting), "invalid inline content threshold")
+
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant, repotesting.Options{
+		NewRepositoryOptions: func(n *repo.NewRepositoryOptions) {
+			n.ObjectFormat.InlineContentThreshold = 16
+		},
+	})
+
+	env.MustReopen(t)
+
+	require.Equal(t, 16, env.RepositoryWriter.ObjectFormat().InlineContentThreshold)
+
+	small := writeObject(ctx, t, env.RepositoryWriter, bytes.Repeat([]byte{1}, 15), "small")
+	large := writeObject(ctx, t, env.RepositoryWriter, bytes.Repeat([]byte{2}, 16), "large")
+
+	_, ok := small.InlineData()
+	require.True(t, ok, "small object was not inlined: %v", small)
+
+	cid, _, ok := large.ContentID()
+	require.True(t, ok, "large object was not stored in a content: %v", large)
+
+	_, err := env.RepositoryWriter.ContentInfo(ctx, cid)
+	require.NoError(t, err)
+
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+	env.MustReopen(t)
+
+	verify(ctx, t, env.RepositoryWriter, small, bytes.Repeat([]byte{1}, 15), "small")
+	verify(ctx, t, env.RepositoryWriter, large, bytes.Repeat([]byte{2}, 16), "large")
+}
+
+func TestSplitterParameters(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	require.ErrorContains(t, repo.Initialize(ctx, blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil), &repo.NewRepositoryOptions{
+		ObjectFormat: format.ObjectFormat{
+			Splitter:           "DYNAMIC-4M-BUZHASH",
+			SplitterParameters: &splitter.Parameters{MinSize: 16384, AvgSize: 8192, MaxSize: 32768},
+		},
+	}, repotesting.DefaultPasswordForTesting), "min <= avg <= max")
+
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant, repotesting.Options{
+		NewRepositoryOptions: func(n *repo.NewRepositoryOptions) {
+			n.ObjectFormat.Splitter = "DYNAMIC-4M-BUZHASH"
+			n.ObjectFormat.SplitterParameters = &splitter.Parameters{MinSize: 4096, AvgSize: 8192}
+		},
+	})
+
+	// parameters are persisted with defaults filled in and used after reconnecting.
+	env.MustReopen(t)
+
+	require.Equal(t, &splitter.Parameters{MinSize: 4096, AvgSize: 8192, MaxSize: 16384}, env.RepositoryWriter.ObjectFormat().SplitterParameters)
+
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+
+	oid := writeObject(ctx, t, env.RepositoryWriter, data, "large")
+
+	cids, err := env.RepositoryWriter.VerifyObject(ctx, oid)
+	require.NoError(t, err)
+
+	var chunks, smallChunks int
+
+	for _, cid := range cids {
+		if cid.HasPrefix() {
+			// index of the indirect object.
+			continue
+		}
+
+		ci, err := env.RepositoryWriter.ContentInfo(ctx, cid)
+		require.NoError(t, err)
+
+		require.LessOrEqual(t, ci.GetOriginalLength(), uint32(16384))
+
+		if ci.GetOriginalLength() < 4096-1 {
+			smallChunks++
+		}
+
+		chunks++
+	}
+
+	// the built-in splitter would produce a single chunk, only the last chunk may be small.
+	require.Greater(t, chunks, len(data)/16384)
+	require.LessOrEqual(t, smallChunks, 1)
+}
+
+func TestRepositoryDescriptor(t *testing.T) {
+	ctx := testlogging.Context(t)
+
+	st := blobtesting.NewMapStorage(blobtesting.DataMap{}, nil, nil)
+
+	require.NoError(t, repo.Initialize(ctx, st, &repo.NewRepositoryOptions{
+		BlockFormat: format.ContentFormat{
+			Hash:               "BLAKE2B-256-128",
+			Encryption:         "CHACHA20-POLY1305-HMAC-SHA256",
+			ECC:                "REED-SOLOMON-CRC32",
+			ECCOverheadPercent: 2,
+			ContentMAC:         true,
+			MutableParameters: format.MutableParameters{
+				Version: format.FormatVersion2,
+			},
+		},
+		ObjectFormat: format.ObjectFormat{Splitter: "FIXED-1M"},
+	}, repotesting.DefaultPasswordForTesting))
+
+	// the descriptor is readable directly from storage, without the password.
+	d, err := format.ReadRepositoryDescriptor(ctx, st)
+	require.NoError(t, err)
+
+	require.Equal(t, "https://github.com/kopia/kopia", d.Tool)
+	require.Equal(t, format.FormatVersion2, d.FormatVersion)
+	require.Equal(t, "BLAKE2B-256-128", d.Hash)
+	require.Equal(t, "CHACHA20-POLY1305-HMAC-SHA256", d.Encryption)
+	require.Equal(t, "REED-SOLOMON-CRC32", d.ECC)
+	require.Equal(t, 2, d.ECCOverheadPercent)
+	require.Equal(t, "FIXED-1M", d.Splitter)
+	require.Equal(t, format.DefaultFormatEncryption, d.MetadataEncryption)
+	require.True(t, d.HasFeature(format.DescriptorFeatureContentMAC))
+	require.True(t, d.HasFeature(format.DescriptorFeatureHMAC))
+	require.True(t, d.HasFeature(format.DescriptorFeaturePasswordChange))
+	require.False(t, d.HasFeature(format.DescriptorFeatureEnvelopeEncryption))
+
+	// no key material is ever stored in the descriptor.
+	var raw gather.WriteBuffer
+	defer raw.Close()
+
+	require.NoError(t, st.GetBlob(ctx, format.KopiaDescriptorBlobID, 0, -1, &raw))
+	require.NotContains(t, string(raw.ToByteSlice()), "secret")
+	require.NotContains(t, string(raw.ToByteSlice()), "masterKey")
+	require.True(t, format.IsReservedBlobID(format.KopiaDescriptorBlobID))
+
+	// the descriptor is kept up-to-date when repository parameters change.
+	fm, err := format.NewManager(ctx, st, "", -1, repotesting.DefaultPasswordForTesting, clock.Now)
+	require.NoError(t, err)
+
+	mp, err := fm.GetMutableParameters()
+	require.NoError(t, err)
+
+	mp.MaxPackSize = 30 << 20
+
+	require.NoError(t, fm.SetParameters(ctx, mp, format.BlobStorageConfiguration{}, nil))
+
+	d, err = format.ReadRepositoryDescriptor(ctx, st)
+	require.NoError(t, err)
+	require.Equal(t, 30<<20, d.MaxPackSize)
+}
+
+func TestRequiredFeatures(t *testing.T) {
+	cases := []struct {
+		desc string
+		opt  func(n *repo.NewRepositoryOptions)
+		want []feature.Feature
+	}{
+		{"default", func(n *repo.NewRepositoryOptions) {}, nil},
+		{"content MAC", func(n *repo.NewRepositoryOptions) { n.BlockFormat.ContentMAC = true }, []feature.Feature{format.FeatureContentMAC}},
+		{"inline objects", func(n *repo.NewRepositoryOptions) { n.ObjectFormat.InlineObjects = true }, []feature.Feature{format.FeatureInlineObjects}},
+		{"inline content threshold", func(n *repo.NewRepositoryOptions) { n.ObjectFormat.InlineContentThreshold = 10 }, []feature.Feature{format.FeatureInlineObjects}},
+		{"hash salt", func(n *repo.NewRepositoryOptions) { n.BlockFormat.HashSalt = []byte("salt") }, []feature.Feature{format.FeatureHashSalt}},
+		{"envelope encryption", func(n *repo.NewRepositoryOptions) { n.BlockFormat.EnvelopeEncryption = true }, []feature.Feature{format.FeatureEnvelopeEncryption}},
+		{"splitter parameters", func(n *repo.NewRepositoryOptions) {
+			n.ObjectFormat.Splitter = "DYNAMIC-4M-BUZHASH"
+			n.ObjectFormat.SplitterParameters = &splitter.Parameters{MinSize: 4096, AvgSize: 8192}
+		}, []feature.Feature{format.FeatureSplitterParameters}},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.desc, func(t *testing.T) {
+			_, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant, repotesting.Options{
+				NewRepositoryOptions: tc.opt,
+			})
+
+			// required features are understood by this client.
+			env.MustReopen(t)
+
+			rf, err := env.RepositoryWriter.FormatManager().RequiredFeatures()
+			require.NoError(t, err)
+
+			var got []feature.Feature
+
+			for _, r := range rf {
+				got = append(got, r.Feature)
+			}
+
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestReadObjectBeforeFlush(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant, repotesting.Options{
+		NewRepositoryOptions: func(n *repo.NewRepositoryOptions) {
+			n.ObjectFormat.Splitter = "FIXED-1M"
+		},
+	})
+
+	data := make([]byte, 3500000)
+	rand.Read(data)
+
+	oid := writeObject(ctx, t, env.RepositoryWriter, data, "unflushed-object")
+
+	// nothing has been written to storage yet, so the object is served from pending packs in memory.
+	var packs []blob.ID
+
+	require.NoError(t, env.RootStorage().ListBlobs(ctx, content.PackBlobIDPrefixRegular, func(bm blob.Metadata) error {
+		packs = append(packs, bm.BlobID)
+		return nil
+	}))
+	require.Empty(t, packs)
+
+	r, err := env.RepositoryWriter.OpenObject(ctx, oid)
+	require.NoError(t, err)
+
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, data, got)
+
+	verify(ctx, t, env.RepositoryWriter, oid, data, "unflushed-object")
+
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+	verify(ctx, t, env.RepositoryWriter, oid, data, "flushed-object")
+}
+
+func TestSignedManifests(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	id, err := env.RepositoryWriter.PutManifest(ctx, map[string]string{"type": "policy"}, map[string]int{"foo": 1})
+	require.NoError(t, err)
+	require.NoError(t, env.RepositoryWriter.Flush(ctx))
+
+	signed, err := repo.GetSignedManifest(ctx, env.RepositoryWriter, id)
+	require.NoError(t, err)
+
+	// signature can be verified by another connection to the same repository.
+	env.MustReopen(t)
+
+	md, content, err := repo.VerifySignedManifest(env.Repository, signed)
+	require.NoError(t, err)
+	require.Equal(t, id, md.ID)
+	require.Equal(t, map[string]string{"type": "policy"}, md.Labels)
+	require.JSONEq(t, `{"foo":1}`, string(content))
+}
@@ -0,0 +1,37 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo/manifest"
+)
+
+// ErrManifestSigningNotSupported is returned when signing or verifying manifests using a repository
+// connected through an API server, which does not have access to the signing key.
+var ErrManifestSigningNotSupported = errors.New("manifest signing requires direct repository connection")
+
+// GetSignedManifest returns the signed representation of the provided manifest item suitable for
+// transport outside of the repository, see manifest.Manager.GetSigned().
+func GetSignedManifest(ctx context.Context, rep Repository, id manifest.ID) ([]byte, error) {
+	dr, ok := rep.(*directRepository)
+	if !ok {
+		return nil, ErrManifestSigningNotSupported
+	}
+
+	//nolint:wrapcheck
+	return dr.mmgr.GetSigned(ctx, id)
+}
+
+// VerifySignedManifest verifies the signed manifest item returned by GetSignedManifest()
+// and returns its metadata and contents, see manifest.Manager.VerifySigned().
+func VerifySignedManifest(rep Repository, data []byte) (*manifest.EntryMetadata, []byte, error) {
+	dr, ok := rep.(*directRepository)
+	if !ok {
+		return nil, nil, ErrManifestSigningNotSupported
+	}
+
+	//nolint:wrapcheck
+	return dr.mmgr.VerifySigned(data)
+}
@@ -80,6 +80,12 @@ func SupportedAlgorithms() []string {
 	"DYNAMIC": newBuzHash32SplitterFactory(splitterSize4MB),
 }
 
+// Register registers a splitter factory with a given name, so that it can be selected
+// when creating new repositories.
+func Register(name string, factory Factory) {
+	splitterFactories[name] = factory
+}
+
 // GetFactory gets splitter factory with a specified name or nil if not found.
 func GetFactory(name string) Factory {
 	return splitterFactories[name]
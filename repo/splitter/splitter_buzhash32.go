@@ -82,11 +82,13 @@ func (rs *buzhash32Splitter) MaxSegmentSize() int {
 }
 
 func newBuzHash32SplitterFactory(avgSize int) Factory {
+	return newBuzHash32SplitterFactoryWithSizes(avgSize/2, avgSize, avgSize*2) //nolint:gomnd
+}
+
+func newBuzHash32SplitterFactoryWithSizes(minSize, avgSize, maxSize int) Factory {
 	// avgSize must be a power of two, so 0b000001000...0000
 	// it just so happens that mask is avgSize-1 :)
 	mask := uint32(avgSize - 1)
-	maxSize := avgSize * 2 //nolint:gomnd
-	minSize := avgSize / 2 //nolint:gomnd
 
 	return func() Splitter {
 		s := buzhash32.New()
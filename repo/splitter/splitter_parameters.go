@@ -0,0 +1,70 @@
+package splitter
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Parameters override chunk sizes of content-defined (DYNAMIC) splitters.
+type Parameters struct {
+	MinSize int `json:"minSize"`
+	AvgSize int `json:"avgSize"`
+	MaxSize int `json:"maxSize"`
+}
+
+// WithDefaults returns parameters where minimum and maximum sizes that are not set are derived
+// from the average size the same way as for built-in splitters.
+func (p Parameters) WithDefaults() Parameters {
+	if p.MinSize == 0 {
+		p.MinSize = p.AvgSize / 2 //nolint:gomnd
+	}
+
+	if p.MaxSize == 0 {
+		p.MaxSize = p.AvgSize * 2 //nolint:gomnd
+	}
+
+	return p
+}
+
+// Validate returns an error if the parameters are invalid.
+func (p Parameters) Validate() error {
+	if p.AvgSize <= 0 || p.AvgSize&(p.AvgSize-1) != 0 {
+		return errors.Errorf("average chunk size must be a power of two, got %v", p.AvgSize)
+	}
+
+	if p.MinSize <= 0 {
+		return errors.Errorf("minimum chunk size must be positive, got %v", p.MinSize)
+	}
+
+	if p.MinSize > p.AvgSize || p.AvgSize > p.MaxSize {
+		return errors.Errorf("chunk sizes must satisfy min <= avg <= max, got min=%v avg=%v max=%v", p.MinSize, p.AvgSize, p.MaxSize)
+	}
+
+	return nil
+}
+
+// GetFactoryWithParameters gets factory of the splitter with a specified name and chunk sizes overridden
+// by the provided parameters, if not nil. Returns nil if the splitter is not found or an error if the
+// parameters are invalid or the splitter does not support them.
+func GetFactoryWithParameters(name string, p *Parameters) (Factory, error) {
+	f := GetFactory(name)
+	if f == nil || p == nil {
+		return f, nil
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case name == "DYNAMIC" || strings.HasSuffix(name, "-BUZHASH"):
+		return newBuzHash32SplitterFactoryWithSizes(p.MinSize, p.AvgSize, p.MaxSize), nil
+
+	case strings.HasSuffix(name, "-RABINKARP"):
+		return newRabinKarp64SplitterFactoryWithSizes(p.MinSize, p.AvgSize, p.MaxSize), nil
+
+	default:
+		return nil, errors.Errorf("splitter %v does not support chunk size parameters", name)
+	}
+}
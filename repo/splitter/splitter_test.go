@@ -6,6 +6,8 @@
 	"math/rand"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	"github.com/kopia/kopia/internal/testutil"
 )
 
@@ -119,6 +121,69 @@ func TestSplitterStability(t *testing.T) {
 	}
 }
 
+func TestGetFactoryWithParameters(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	rnd := make([]byte, 1000000)
+
+	if n, err := r.Read(rnd); n != len(rnd) || err != nil {
+		t.Fatalf("can't initialize random data: %v", err)
+	}
+
+	// no parameters.
+	f, err := GetFactoryWithParameters("FIXED-1M", nil)
+	require.NoError(t, err)
+	require.NotNil(t, f)
+
+	f, err = GetFactoryWithParameters("no-such-splitter", &Parameters{MinSize: 1, AvgSize: 2, MaxSize: 3})
+	require.NoError(t, err)
+	require.Nil(t, f)
+
+	for _, p := range []Parameters{
+		{MinSize: 1024, AvgSize: 4096, MaxSize: 2048},
+		{MinSize: 8192, AvgSize: 4096, MaxSize: 16384},
+		{MinSize: 1024, AvgSize: 3000, MaxSize: 8192},
+		{MinSize: 0, AvgSize: 4096, MaxSize: 8192},
+		{},
+	} {
+		_, err = GetFactoryWithParameters("DYNAMIC-1M-BUZHASH", &p)
+		require.Error(t, err, p)
+	}
+
+	_, err = GetFactoryWithParameters("FIXED-1M", &Parameters{MinSize: 1024, AvgSize: 4096, MaxSize: 8192})
+	require.ErrorContains(t, err, "does not support")
+
+	require.Equal(t, Parameters{MinSize: 2048, AvgSize: 4096, MaxSize: 8192}, Parameters{AvgSize: 4096}.WithDefaults())
+	require.Equal(t, Parameters{MinSize: 3000, AvgSize: 4096, MaxSize: 8192}, Parameters{MinSize: 3000, AvgSize: 4096}.WithDefaults())
+
+	for _, name := range []string{"DYNAMIC-4M-BUZHASH", "DYNAMIC-4M-RABINKARP"} {
+		// parameters matching the built-in ones produce identical splits.
+		f, err = GetFactoryWithParameters(name, &Parameters{MinSize: 2048, AvgSize: 4096, MaxSize: 8192})
+		require.NoError(t, err)
+
+		builtin := map[string]Factory{
+			"DYNAMIC-4M-BUZHASH":   newBuzHash32SplitterFactory(4096),
+			"DYNAMIC-4M-RABINKARP": newRabinKarp64SplitterFactory(4096),
+		}[name]
+
+		gotMin, gotMax, gotCount := getSplitPoints(rnd, f())
+		wantMin, wantMax, wantCount := getSplitPoints(rnd, builtin())
+
+		require.Equal(t, []int{wantMin, wantMax, wantCount}, []int{gotMin, gotMax, gotCount}, name)
+
+		// custom sizes are respected.
+		f, err = GetFactoryWithParameters(name, &Parameters{MinSize: 3000, AvgSize: 4096, MaxSize: 5000})
+		require.NoError(t, err)
+
+		s := f()
+		require.Equal(t, 5000, s.MaxSegmentSize())
+
+		minSplit, maxSplit, count := getSplitPoints(rnd, s)
+		require.GreaterOrEqual(t, minSplit, 3000-1, name)
+		require.LessOrEqual(t, maxSplit, 5000, name)
+		require.Greater(t, count, len(rnd)/5000, name)
+	}
+}
+
 func getSplitPoints(data []byte, s Splitter) (minSplit, maxSplit, count int) {
 	maxSplit = 0
 	minSplit = int(math.MaxInt32)
@@ -0,0 +1,59 @@
+package snapshot
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/repo"
+)
+
+// ListCheckpoints returns incomplete snapshot manifests left behind by interrupted uploads
+// for a given source or all sources if nil. Such checkpoints are used to resume uploads.
+func ListCheckpoints(ctx context.Context, rep repo.Repository, src *SourceInfo) ([]*Manifest, error) {
+	ids, err := ListSnapshotManifests(ctx, rep, src, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing snapshot manifests")
+	}
+
+	manifests, err := LoadSnapshots(ctx, rep, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "error loading snapshot manifests")
+	}
+
+	var result []*Manifest
+
+	for _, m := range manifests {
+		if m.IncompleteReason != "" {
+			result = append(result, m)
+		}
+	}
+
+	return SortByTime(result, false), nil
+}
+
+// PruneCheckpoints deletes checkpoints for a given source or all sources if nil, which were started
+// before the provided time and returns the deleted manifests. Pinned checkpoints are never deleted.
+func PruneCheckpoints(ctx context.Context, rep repo.RepositoryWriter, src *SourceInfo, startedBefore time.Time) ([]*Manifest, error) {
+	checkpoints, err := ListCheckpoints(ctx, rep, src)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []*Manifest
+
+	for _, m := range checkpoints {
+		if len(m.Pins) > 0 || !m.StartTime.ToTime().Before(startedBefore) {
+			continue
+		}
+
+		if err := rep.DeleteManifest(ctx, m.ID); err != nil {
+			return deleted, errors.Wrapf(err, "error deleting checkpoint %v", m.ID)
+		}
+
+		deleted = append(deleted, m)
+	}
+
+	return deleted, nil
+}
@@ -3,6 +3,7 @@
 
 import (
 	"context"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -185,15 +186,43 @@ func LoadSnapshots(ctx context.Context, rep repo.Repository, manifestIDs []manif
 
 // ListSnapshotManifests returns the list of snapshot manifests for a given source or all sources if nil.
 func ListSnapshotManifests(ctx context.Context, rep repo.Repository, src *SourceInfo, tags map[string]string) ([]manifest.ID, error) {
+	return ListSnapshotManifestsFiltered(ctx, rep, ListFilter{Source: src, Tags: tags})
+}
+
+// ListFilter specifies criteria used to narrow down the list of snapshot manifests.
+// Zero values of individual fields match all snapshots.
+type ListFilter struct {
+	Source   *SourceInfo
+	Host     string
+	UserName string
+	Tags     map[string]string
+
+	// ModifiedAfter and ModifiedBefore restrict the results to manifests written in the given time range.
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+}
+
+// ListSnapshotManifestsFiltered returns the list of snapshot manifests matching the provided filter.
+// Host, user, path and tag criteria are evaluated by the manifest manager using labels,
+// so only matching manifests need to be loaded by the caller.
+func ListSnapshotManifestsFiltered(ctx context.Context, rep repo.Repository, f ListFilter) ([]manifest.ID, error) {
 	labels := map[string]string{
 		typeKey: ManifestType,
 	}
 
-	if src != nil {
-		labels = sourceInfoToLabels(*src)
+	if f.Source != nil {
+		labels = sourceInfoToLabels(*f.Source)
 	}
 
-	for key, value := range tags {
+	if f.Host != "" {
+		labels[HostnameLabel] = f.Host
+	}
+
+	if f.UserName != "" {
+		labels[UsernameLabel] = f.UserName
+	}
+
+	for key, value := range f.Tags {
 		labels[key] = value
 	}
 
@@ -202,7 +231,21 @@ func ListSnapshotManifests(ctx context.Context, rep repo.Repository, src *Source
 		return nil, errors.Wrap(err, "unable to find snapshot manifests")
 	}
 
-	return entryIDs(entries), nil
+	var result []manifest.ID
+
+	for _, e := range entries {
+		if !f.ModifiedAfter.IsZero() && e.ModTime.Before(f.ModifiedAfter) {
+			continue
+		}
+
+		if !f.ModifiedBefore.IsZero() && !e.ModTime.Before(f.ModifiedBefore) {
+			continue
+		}
+
+		result = append(result, e.ID)
+	}
+
+	return result, nil
 }
 
 // FindSnapshotsByRootObjectID returns the list of matching snapshots for a given rootID.
@@ -36,6 +36,9 @@ type Manifest struct {
 
 	// list of manually-defined pins which prevent the snapshot from being deleted.
 	Pins []string `json:"pins,omitempty"`
+
+	// aggregate statistics computed when the snapshot was created.
+	Summary *Summary `json:"summary,omitempty"`
 }
 
 // UpdatePins updates pins in the provided manifest.
@@ -129,6 +132,18 @@ type DirEntry struct {
 	GroupID     uint32               `json:"gid,omitempty"`
 	ObjectID    object.ID            `json:"obj,omitempty"`
 	DirSummary  *fs.DirectorySummary `json:"summ,omitempty"`
+
+	// ExtendedAttributes holds extended attributes of the entry (including POSIX ACLs), if enabled by upload policy.
+	ExtendedAttributes map[string][]byte `json:"xattrs,omitempty"`
+
+	// Holes holds the ranges of a sparse file that are not allocated on disk, in order.
+	Holes []FileHole `json:"holes,omitempty"`
+}
+
+// FileHole describes a range of a sparse file that reads as zeros and is not allocated on disk.
+type FileHole struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
 }
 
 // Clone returns a clone of the entry.
@@ -141,6 +156,18 @@ func (e *DirEntry) Clone() *DirEntry {
 		e2.DirSummary = &s2
 	}
 
+	if e.ExtendedAttributes != nil {
+		e2.ExtendedAttributes = make(map[string][]byte, len(e.ExtendedAttributes))
+
+		for k, v := range e.ExtendedAttributes {
+			e2.ExtendedAttributes[k] = append([]byte(nil), v...)
+		}
+	}
+
+	if e.Holes != nil {
+		e2.Holes = append([]FileHole(nil), e.Holes...)
+	}
+
 	return &e2
 }
 
@@ -181,6 +208,10 @@ func (m *Manifest) Clone() *Manifest {
 		m2.RootEntry = m2.RootEntry.Clone()
 	}
 
+	if m2.Summary != nil {
+		m2.Summary = m2.Summary.Clone()
+	}
+
 	return &m2
 }
 
@@ -219,6 +250,41 @@ type StorageUsageDetails struct {
 	ContentCount int32 `json:"contents"`
 }
 
+// Summary provides aggregate statistics about the contents of a snapshot.
+type Summary struct {
+	// total size of all files, ignoring deduplication.
+	LogicalBytes int64 `json:"logicalBytes"`
+
+	// total size of unique contents of the snapshot as stored in the repository.
+	StoredBytes int64 `json:"storedBytes"`
+
+	FileCount int64 `json:"fileCount"`
+	DirCount  int64 `json:"dirCount"`
+
+	// largest files in the snapshot, in order of decreasing size.
+	LargestFiles []*SummaryFile `json:"largestFiles,omitempty"`
+}
+
+// SummaryFile describes a single file listed in the snapshot summary.
+type SummaryFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// Clone returns a clone of the summary.
+func (s *Summary) Clone() *Summary {
+	s2 := *s
+
+	s2.LargestFiles = nil
+
+	for _, f := range s.LargestFiles {
+		f2 := *f
+		s2.LargestFiles = append(s2.LargestFiles, &f2)
+	}
+
+	return &s2
+}
+
 // GroupBySource returns a slice of slices, such that each result item contains manifests from a single source.
 func GroupBySource(manifests []*Manifest) [][]*Manifest {
 	resultMap := map[SourceInfo][]*Manifest{}
@@ -0,0 +1,95 @@
+package policy
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// FieldDiff describes a single policy field whose value differs between two policies.
+type FieldDiff struct {
+	Path string `json:"path"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// unsetValue is used to represent fields that are not defined in a policy.
+const unsetValue = "-"
+
+// Diff returns the list of fields that differ between two policies in the order in which they are
+// declared. Each field is identified by its JSON path (such as 'upload.maxParallelFileReads') and
+// values are formatted as JSON, with unset fields represented as '-'.
+func Diff(oldPolicy, newPolicy *Policy) []FieldDiff {
+	var result []FieldDiff
+
+	diffValues("", reflect.ValueOf(*oldPolicy), reflect.ValueOf(*newPolicy), &result)
+
+	return result
+}
+
+func diffValues(path string, o, n reflect.Value, result *[]FieldDiff) {
+	if o.Kind() == reflect.Struct {
+		diffStructFields(path, o, n, result)
+		return
+	}
+
+	// descend into structs that are defined in both policies, otherwise compare them as a whole.
+	if o.Kind() == reflect.Ptr && o.Type().Elem().Kind() == reflect.Struct && !o.IsNil() && !n.IsNil() {
+		diffStructFields(path, o.Elem(), n.Elem(), result)
+		return
+	}
+
+	ov, nv := formatDiffValue(o), formatDiffValue(n)
+	if ov != nv {
+		*result = append(*result, FieldDiff{path, ov, nv})
+	}
+}
+
+func diffStructFields(path string, o, n reflect.Value, result *[]FieldDiff) {
+	t := o.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		if path != "" {
+			name = path + "." + name
+		}
+
+		diffValues(name, o.Field(i), n.Field(i), result)
+	}
+}
+
+func formatDiffValue(v reflect.Value) string {
+	//nolint:exhaustive
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return unsetValue
+		}
+
+	case reflect.Slice, reflect.Map, reflect.String:
+		if v.Len() == 0 {
+			return unsetValue
+		}
+	}
+
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return "<invalid: " + err.Error() + ">"
+	}
+
+	return string(b)
+}
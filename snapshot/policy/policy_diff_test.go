@@ -0,0 +1,53 @@
+package policy_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+func TestPolicyDiff(t *testing.T) {
+	fileReads := policy.OptionalInt(10)
+	otherFileReads := policy.OptionalInt(20)
+	storeACLs := policy.OptionalBool(true)
+	keepLatest := policy.OptionalInt(3)
+
+	p1 := &policy.Policy{
+		Labels: map[string]string{"path": "/a"},
+		UploadPolicy: policy.UploadPolicy{
+			MaxParallelFileReads: &fileReads,
+		},
+		RetentionPolicy: policy.RetentionPolicy{
+			KeepLatest: &keepLatest,
+		},
+		FilesPolicy: policy.FilesPolicy{
+			IgnoreRules: []string{"*.tmp"},
+		},
+	}
+
+	p2 := &policy.Policy{
+		Labels: map[string]string{"path": "/b"},
+		UploadPolicy: policy.UploadPolicy{
+			MaxParallelFileReads: &otherFileReads,
+			StoreACLs:            &storeACLs,
+		},
+		RetentionPolicy: policy.RetentionPolicy{
+			KeepLatest: &keepLatest,
+		},
+		FilesPolicy: policy.FilesPolicy{
+			IgnoreRules: []string{"*.tmp", "*.bak"},
+		},
+		NoParent: true,
+	}
+
+	require.Equal(t, []policy.FieldDiff{
+		{Path: "files.ignore", Old: `["*.tmp"]`, New: `["*.tmp","*.bak"]`},
+		{Path: "upload.maxParallelFileReads", Old: "10", New: "20"},
+		{Path: "upload.storeACLs", Old: "-", New: "true"},
+		{Path: "noParent", Old: "false", New: "true"},
+	}, policy.Diff(p1, p2))
+
+	require.Empty(t, policy.Diff(p1, p1))
+}
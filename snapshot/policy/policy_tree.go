@@ -53,10 +53,13 @@
 
 	defaultUploadPolicy = UploadPolicy{
 		MaxParallelSnapshots: newOptionalInt(1),
-		MaxParallelFileReads: nil, // defaults to runtime.NumCPUs()
+		MaxParallelFileReads: nil, // defaults to runtime.NumCPUs(), also when set to 0
 
 		// upload large files in chunks of 2 GiB
 		ParallelUploadAboveSize: newOptionalInt64(2 << 30), //nolint:gomnd
+
+		StoreExtendedAttributes: newOptionalBool(false),
+		StoreACLs:               newOptionalBool(false),
 	}
 
 	// DefaultPolicy is a default policy returned by policy tree in absence of other policies.
@@ -79,6 +82,7 @@
 // defined. A nil tree is a valid tree with default policy.
 type Tree struct {
 	effective *Policy
+	resolved  *Policy // effective policy merged with policies of all parent nodes
 	inherited bool
 	children  map[string]*Tree
 }
@@ -101,6 +105,25 @@ func (t *Tree) EffectivePolicy() *Policy {
 	return t.effective
 }
 
+// ResolvedPolicy returns the policy defined for this tree node merged with policies defined for all its
+// parents, so that fields not set by the more specific policy are inherited from the less specific ones.
+func (t *Tree) ResolvedPolicy() *Policy {
+	if t == nil {
+		return DefaultPolicy
+	}
+
+	if t.resolved == nil {
+		return t.effective
+	}
+
+	return t.resolved
+}
+
+// ResolveForPath returns the resolved policy for the entry at the provided relative path.
+func (t *Tree) ResolveForPath(path string) *Policy {
+	return t.Child(path).ResolvedPolicy()
+}
+
 // IsInherited returns true if the policy inherited to the given tree hode has been inherited from its parent.
 func (t *Tree) IsInherited() bool {
 	if t == nil {
@@ -133,7 +156,7 @@ func (t *Tree) Child(name string) *Tree {
 			return t
 		}
 
-		return &Tree{effective: t.effective, inherited: true}
+		return &Tree{effective: t.effective, resolved: t.resolved, inherited: true}
 
 	default:
 		ch := t
@@ -148,16 +171,29 @@ func (t *Tree) Child(name string) *Tree {
 // BuildTree builds a policy tree from the given map of paths to policies.
 // Each path must be relative and start with "." and be separated by slashes.
 func BuildTree(defined map[string]*Policy, defaultPolicy *Policy) *Tree {
-	return buildTreeNode(defined, ".", defaultPolicy)
+	return buildTreeNode(defined, ".", defaultPolicy, nil)
 }
 
-func buildTreeNode(defined map[string]*Policy, path string, defaultPolicy *Policy) *Tree {
+func buildTreeNode(defined map[string]*Policy, path string, defaultPolicy, parentResolved *Policy) *Tree {
 	n := &Tree{
 		effective: defined[path],
 	}
-	if n.effective == nil {
+
+	switch {
+	case n.effective == nil:
 		n.effective = defaultPolicy
 		n.inherited = true
+		n.resolved = parentResolved
+
+	case parentResolved == nil:
+		n.resolved = n.effective
+
+	default:
+		n.resolved, _ = MergePolicies([]*Policy{n.effective, parentResolved}, n.effective.Target())
+	}
+
+	if n.resolved == nil {
+		n.resolved = n.effective
 	}
 
 	children := childrenWithPrefix(defined, path+"/")
@@ -165,7 +201,7 @@ func buildTreeNode(defined map[string]*Policy, path string, defaultPolicy *Polic
 		n.children = map[string]*Tree{}
 
 		for childName, descendants := range children {
-			n.children[childName] = buildTreeNode(descendants, path+"/"+childName, n.effective)
+			n.children[childName] = buildTreeNode(descendants, path+"/"+childName, n.effective, n.resolved)
 		}
 	}
 
@@ -4,6 +4,10 @@
 	"fmt"
 	"reflect"
 	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/repo/compression"
 )
 
 var (
@@ -122,3 +126,54 @@ func dumpTree(n *Tree, prefix string) {
 		dumpTree(cnode, prefix+"."+cname)
 	}
 }
+
+func TestTreeResolveForPath(t *testing.T) {
+	root := &Policy{
+		FilesPolicy: FilesPolicy{
+			IgnoreRules: []string{"*.tmp"},
+			MaxFileSize: 1000,
+		},
+		CompressionPolicy: CompressionPolicy{
+			CompressorName: "zstd",
+		},
+		ErrorHandlingPolicy: ErrorHandlingPolicy{
+			IgnoreFileErrors: newOptionalBool(true),
+		},
+	}
+
+	src := &Policy{
+		FilesPolicy: FilesPolicy{
+			IgnoreRules: []string{"node_modules"},
+		},
+		CompressionPolicy: CompressionPolicy{
+			CompressorName: "s2-default",
+		},
+	}
+
+	n := BuildTree(map[string]*Policy{
+		".":     root,
+		"./src": src,
+	}, defPolicy)
+
+	// defined policies are unchanged.
+	verifyTreePolicy(t, n, "src", src, false)
+
+	require.Equal(t, root, n.ResolveForPath("."))
+	require.Equal(t, root, n.ResolveForPath("docs/readme.txt"))
+
+	for _, p := range []string{"src", "src/main.go", "src/pkg/util.go"} {
+		got := n.ResolveForPath(p)
+
+		require.Equal(t, []string{"node_modules"}, got.FilesPolicy.IgnoreRules, p)
+		require.Equal(t, int64(1000), got.FilesPolicy.MaxFileSize, p)
+		require.Equal(t, compression.Name("s2-default"), got.CompressionPolicy.CompressorName, p)
+		require.True(t, got.ErrorHandlingPolicy.IgnoreFileErrors.OrDefault(false), p)
+
+		// resolution is the same when walking the tree one level at a time.
+		require.Equal(t, got, n.Child("src").ResolveForPath(p[len("src"):]), p)
+	}
+
+	var nilTree *Tree
+
+	require.Equal(t, DefaultPolicy, nilTree.ResolveForPath("foo"))
+}
@@ -11,6 +11,8 @@ type UploadPolicy struct {
 	MaxParallelSnapshots    *OptionalInt   `json:"maxParallelSnapshots,omitempty"`
 	MaxParallelFileReads    *OptionalInt   `json:"maxParallelFileReads,omitempty"`
 	ParallelUploadAboveSize *OptionalInt64 `json:"parallelUploadAboveSize,omitempty"`
+	StoreExtendedAttributes *OptionalBool  `json:"storeExtendedAttributes,omitempty"`
+	StoreACLs               *OptionalBool  `json:"storeACLs,omitempty"`
 }
 
 // UploadPolicyDefinition specifies which policy definition provided the value of a particular field.
@@ -18,6 +20,8 @@ type UploadPolicyDefinition struct {
 	MaxParallelSnapshots    snapshot.SourceInfo `json:"maxParallelSnapshots,omitempty"`
 	MaxParallelFileReads    snapshot.SourceInfo `json:"maxParallelFileReads,omitempty"`
 	ParallelUploadAboveSize snapshot.SourceInfo `json:"parallelUploadAboveSize,omitempty"`
+	StoreExtendedAttributes snapshot.SourceInfo `json:"storeExtendedAttributes,omitempty"`
+	StoreACLs               snapshot.SourceInfo `json:"storeACLs,omitempty"`
 }
 
 // Merge applies default values from the provided policy.
@@ -25,13 +29,34 @@ func (p *UploadPolicy) Merge(src UploadPolicy, def *UploadPolicyDefinition, si s
 	mergeOptionalInt(&p.MaxParallelSnapshots, src.MaxParallelSnapshots, &def.MaxParallelSnapshots, si)
 	mergeOptionalInt(&p.MaxParallelFileReads, src.MaxParallelFileReads, &def.MaxParallelFileReads, si)
 	mergeOptionalInt64(&p.ParallelUploadAboveSize, src.ParallelUploadAboveSize, &def.ParallelUploadAboveSize, si)
+	mergeOptionalBool(&p.StoreExtendedAttributes, src.StoreExtendedAttributes, &def.StoreExtendedAttributes, si)
+	mergeOptionalBool(&p.StoreACLs, src.StoreACLs, &def.StoreACLs, si)
 }
 
-// ValidateUploadPolicy returns an error if manual field is set along with Upload fields.
+// Validate returns an error if any of the values of upload policy is out of bounds.
+func (p UploadPolicy) Validate() error {
+	if p.MaxParallelSnapshots != nil && *p.MaxParallelSnapshots < 1 {
+		return errors.Errorf("max parallel snapshots must be at least 1, got %v", *p.MaxParallelSnapshots)
+	}
+
+	// zero parallel file reads means the default.
+	if p.MaxParallelFileReads != nil && *p.MaxParallelFileReads < 0 {
+		return errors.Errorf("max parallel file reads must not be negative, got %v", *p.MaxParallelFileReads)
+	}
+
+	if p.ParallelUploadAboveSize != nil && *p.ParallelUploadAboveSize < 0 {
+		return errors.Errorf("parallel upload above size must not be negative, got %v", *p.ParallelUploadAboveSize)
+	}
+
+	return nil
+}
+
+// ValidateUploadPolicy returns an error if manual field is set along with Upload fields
+// or if the upload policy is otherwise invalid.
 func ValidateUploadPolicy(si snapshot.SourceInfo, p UploadPolicy) error {
 	if si.Path != "" && p.MaxParallelSnapshots != nil {
 		return errors.Errorf("max parallel snapshots cannot be specified for paths, only global, username@hostname or @hostname")
 	}
 
-	return nil
+	return p.Validate()
 }
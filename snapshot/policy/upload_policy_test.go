@@ -0,0 +1,76 @@
+package policy_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/policy"
+)
+
+func TestUploadPolicyValidate(t *testing.T) {
+	optInt := func(v int) *policy.OptionalInt {
+		o := policy.OptionalInt(v)
+		return &o
+	}
+
+	optInt64 := func(v int64) *policy.OptionalInt64 {
+		o := policy.OptionalInt64(v)
+		return &o
+	}
+
+	cases := []struct {
+		desc    string
+		si      snapshot.SourceInfo
+		pol     policy.UploadPolicy
+		wantErr string
+	}{
+		{desc: "empty"},
+		{
+			desc: "valid",
+			si:   policy.GlobalPolicySourceInfo,
+			pol: policy.UploadPolicy{
+				MaxParallelSnapshots:    optInt(2),
+				MaxParallelFileReads:    optInt(8),
+				ParallelUploadAboveSize: optInt64(1 << 20),
+			},
+		},
+		{
+			desc:    "zero parallel snapshots",
+			pol:     policy.UploadPolicy{MaxParallelSnapshots: optInt(0)},
+			wantErr: "max parallel snapshots must be at least 1, got 0",
+		},
+		{
+			desc:    "negative parallel file reads",
+			pol:     policy.UploadPolicy{MaxParallelFileReads: optInt(-3)},
+			wantErr: "max parallel file reads must not be negative, got -3",
+		},
+		{
+			desc: "default parallel file reads",
+			pol:  policy.UploadPolicy{MaxParallelFileReads: optInt(0)},
+		},
+		{
+			desc:    "negative parallel upload size",
+			pol:     policy.UploadPolicy{ParallelUploadAboveSize: optInt64(-1)},
+			wantErr: "parallel upload above size must not be negative, got -1",
+		},
+		{
+			desc:    "parallel snapshots for path",
+			si:      snapshot.SourceInfo{Host: "host", UserName: "user", Path: "/some/path"},
+			pol:     policy.UploadPolicy{MaxParallelSnapshots: optInt(2)},
+			wantErr: "max parallel snapshots cannot be specified for paths",
+		},
+	}
+
+	for _, tc := range cases {
+		err := policy.ValidateUploadPolicy(tc.si, tc.pol)
+
+		if tc.wantErr == "" {
+			require.NoError(t, err, tc.desc)
+			require.NoError(t, tc.pol.Validate(), tc.desc)
+		} else {
+			require.ErrorContains(t, err, tc.wantErr, tc.desc)
+		}
+	}
+}
@@ -17,6 +17,7 @@
 	"github.com/kopia/kopia/internal/iocopy"
 	"github.com/kopia/kopia/internal/sparsefile"
 	"github.com/kopia/kopia/internal/stat"
+	"github.com/kopia/kopia/internal/xattr"
 	"github.com/kopia/kopia/snapshot"
 )
 
@@ -88,6 +89,9 @@ type FilesystemOutput struct {
 	// SkipTimes when set to true causes restore to skip restoring modification times.
 	SkipTimes bool `json:"skipTimes"`
 
+	// SkipExtendedAttributes when set to true causes restore to skip restoring extended attributes and ACLs.
+	SkipExtendedAttributes bool `json:"skipExtendedAttributes"`
+
 	// WriteSparseFiles when set to true, write contents as sparse files, minimizing allocated disk space.
 	WriteSparseFiles bool `json:"writeSparseFiles"`
 
@@ -271,6 +275,13 @@ func (o *FilesystemOutput) setAttributes(targetPath string, e fs.Entry, modclear
 		}
 	}
 
+	// Set extended attributes after changing the owner, which may clear some of them.
+	if attrs := o.extendedAttributesToRestore(e); len(attrs) > 0 {
+		if err = o.maybeIgnorePermissionError(setExtendedAttributes(targetPath, attrs)); err != nil {
+			return errors.Wrap(err, "could not set extended attributes on "+targetPath)
+		}
+	}
+
 	// Set file permissions from e
 	if o.shouldUpdatePermissions(le, e, modclear) {
 		if err = o.maybeIgnorePermissionError(osChmod(targetPath, (e.Mode()&modBits)&^modclear)); err != nil {
@@ -293,7 +304,7 @@ func isSymlink(e fs.Entry) bool {
 }
 
 func (o *FilesystemOutput) maybeIgnorePermissionError(err error) error {
-	if o.IgnorePermissionErrors && os.IsPermission(err) {
+	if o.IgnorePermissionErrors && errors.Is(err, os.ErrPermission) {
 		return nil
 	}
 
@@ -328,6 +339,29 @@ func (o *FilesystemOutput) shouldUpdateTimes(local, remote fs.Entry) bool {
 	return !local.ModTime().Equal(remote.ModTime())
 }
 
+func (o *FilesystemOutput) extendedAttributesToRestore(remote fs.Entry) map[string][]byte {
+	if o.SkipExtendedAttributes {
+		return nil
+	}
+
+	h, ok := remote.(snapshot.HasDirEntry)
+	if !ok {
+		return nil
+	}
+
+	return h.DirEntry().ExtendedAttributes
+}
+
+// setExtendedAttributes sets extended attributes on the target path, ignoring the lack of support
+// for them by the platform or the target filesystem.
+func setExtendedAttributes(targetPath string, attrs map[string][]byte) error {
+	if err := xattr.Set(targetPath, attrs); err != nil && !errors.Is(err, xattr.ErrUnsupported) {
+		return errors.Wrap(err, "error setting extended attributes")
+	}
+
+	return nil
+}
+
 func isWindows() bool {
 	return runtime.GOOS == "windows"
 }
@@ -408,7 +442,26 @@ func (o *FilesystemOutput) copyFileContent(ctx context.Context, targetPath strin
 		return atomicfile.Write(targetPath, r)
 	}
 
-	return write(targetPath, r, f.Size(), o.copier)
+	return write(targetPath, r, f.Size(), o.copierFor(f))
+}
+
+// copierFor returns the stream copier for the provided file, which recreates holes recorded in
+// the snapshot for sparse files.
+func (o *FilesystemOutput) copierFor(f fs.File) streamCopier {
+	h, ok := f.(snapshot.HasDirEntry)
+	if !ok || len(h.DirEntry().Holes) == 0 {
+		return o.copier
+	}
+
+	var holes []sparsefile.Hole
+
+	for _, fh := range h.DirEntry().Holes {
+		holes = append(holes, sparsefile.Hole{Offset: fh.Offset, Length: fh.Length})
+	}
+
+	return func(w io.WriteSeeker, r io.Reader) (int64, error) {
+		return sparsefile.CopyWithHoles(w, r, holes) //nolint:wrapcheck
+	}
 }
 
 func isEmptyDirectory(name string) (bool, error) {
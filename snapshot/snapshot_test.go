@@ -7,9 +7,11 @@
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/kopia/kopia/fs"
 	"github.com/kopia/kopia/internal/repotesting"
 	"github.com/kopia/kopia/internal/testlogging"
 	"github.com/kopia/kopia/repo"
@@ -272,3 +274,45 @@ func TestUpdatePins(t *testing.T) {
 	require.False(t, m.UpdatePins([]string{"e", "a"}, []string{"c"}))
 	require.Equal(t, []string{"a", "b", "d", "e"}, m.Pins)
 }
+
+func TestPruneCheckpoints(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	src := snapshot.SourceInfo{Host: "host-1", UserName: "user-1", Path: "/some/path"}
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	save := func(age time.Duration, incompleteReason string, pins ...string) manifest.ID {
+		return mustSaveSnapshot(t, env.RepositoryWriter, &snapshot.Manifest{
+			Source:           src,
+			StartTime:        fs.UTCTimestampFromTime(now.Add(-age)),
+			IncompleteReason: incompleteReason,
+			Pins:             pins,
+		})
+	}
+
+	complete := save(72*time.Hour, "")
+	fresh := save(time.Hour, "checkpoint")
+	stale1 := save(48*time.Hour, "checkpoint")
+	stale2 := save(30*time.Hour, "canceled")
+	pinned := save(96*time.Hour, "checkpoint", "keep")
+
+	checkpoints, err := snapshot.ListCheckpoints(ctx, env.RepositoryWriter, nil)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []manifest.ID{pinned, stale1, stale2, fresh}, manifestIDs(checkpoints))
+
+	deleted, err := snapshot.PruneCheckpoints(ctx, env.RepositoryWriter, &src, now.Add(-24*time.Hour))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []manifest.ID{stale1, stale2}, manifestIDs(deleted))
+
+	verifySnapshotManifestIDs(t, env.RepositoryWriter, &src, []manifest.ID{complete, fresh, pinned})
+}
+
+func manifestIDs(manifests []*snapshot.Manifest) []manifest.ID {
+	var result []manifest.ID
+
+	for _, m := range manifests {
+		result = append(result, m.ID)
+	}
+
+	return result
+}
@@ -0,0 +1,84 @@
+package snapshotfs
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+)
+
+// RebuildContentReferences walks all snapshots in the repository and stores the reverse index
+// mapping content IDs to paths of files and directories referencing them, which can be
+// queried using repo.WhoReferences.
+func RebuildContentReferences(ctx context.Context, rep repo.RepositoryWriter) error {
+	ids, err := snapshot.ListSnapshotManifests(ctx, rep, nil, nil)
+	if err != nil {
+		return errors.Wrap(err, "unable to list snapshot manifest IDs")
+	}
+
+	manifests, err := snapshot.LoadSnapshots(ctx, rep, ids)
+	if err != nil {
+		return errors.Wrap(err, "unable to load manifests")
+	}
+
+	var mu sync.Mutex
+
+	refs := map[content.ID][]string{}
+
+	// objects found at multiple paths are only verified once.
+	contentIDsByObject := map[object.ID][]content.ID{}
+
+	w, err := NewTreeWalker(ctx, TreeWalkerOptions{
+		// record every path at which an object is found, not only the first one.
+		VisitDuplicates: true,
+		EntryCallback: func(ctx context.Context, entry fs.Entry, oid object.ID, entryPath string) error {
+			mu.Lock()
+			contentIDs, ok := contentIDsByObject[oid]
+			mu.Unlock()
+
+			if !ok {
+				var verr error
+
+				contentIDs, verr = rep.VerifyObject(ctx, oid)
+				if verr != nil {
+					return errors.Wrapf(verr, "error verifying %v", oid)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			contentIDsByObject[oid] = contentIDs
+
+			for _, cid := range contentIDs {
+				refs[cid] = append(refs[cid], entryPath)
+			}
+
+			return nil
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to create tree walker")
+	}
+
+	defer w.Close(ctx)
+
+	for _, m := range manifests {
+		root, err := SnapshotRoot(rep, m)
+		if err != nil {
+			return errors.Wrap(err, "unable to get snapshot root")
+		}
+
+		if err := w.Process(ctx, root, m.Source.String()); err != nil {
+			return errors.Wrapf(err, "error processing snapshot of %v", m.Source)
+		}
+	}
+
+	return errors.Wrap(repo.WriteContentReferences(ctx, rep, refs), "error writing content references")
+}
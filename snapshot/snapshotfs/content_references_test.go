@@ -0,0 +1,88 @@
+package snapshotfs_test
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+func TestRebuildContentReferences(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	sourceRoot := mockfs.NewDirectory()
+	dir1 := sourceRoot.AddDir("dir1", 0o755)
+	dir1.AddFile("file11", []byte{1, 2, 3}, 0o644)
+	sourceRoot.AddFile("file2", []byte{4, 5, 6, 7}, 0o644)
+
+	// same contents at two paths, which are both reported.
+	dir1.AddFile("dup1", []byte{8, 9, 10}, 0o644)
+	sourceRoot.AddFile("dup2", []byte{8, 9, 10}, 0o644)
+
+	src := snapshot.SourceInfo{Host: "host", UserName: "user", Path: "/src"}
+
+	u := snapshotfs.NewUploader(env.RepositoryWriter)
+	man, err := u.Upload(ctx, sourceRoot, nil, src)
+	require.NoError(t, err)
+
+	_, err = snapshot.SaveSnapshot(ctx, env.RepositoryWriter, man)
+	require.NoError(t, err)
+
+	uploadedRoot, err := snapshotfs.SnapshotRoot(env.RepositoryWriter, man)
+	require.NoError(t, err)
+
+	f, err := snapshotfs.GetNestedEntry(ctx, uploadedRoot, []string{"dir1", "file11"})
+	require.NoError(t, err)
+
+	fileContentIDs, err := env.RepositoryWriter.VerifyObject(ctx, f.(object.HasObjectID).ObjectID())
+	require.NoError(t, err)
+	require.Len(t, fileContentIDs, 1)
+
+	_, err = repo.WhoReferences(ctx, env.RepositoryWriter, fileContentIDs[0].String())
+	require.True(t, errors.Is(err, repo.ErrContentReferencesNotBuilt))
+
+	require.NoError(t, snapshotfs.RebuildContentReferences(ctx, env.RepositoryWriter))
+
+	paths, err := repo.WhoReferences(ctx, env.RepositoryWriter, fileContentIDs[0].String())
+	require.NoError(t, err)
+	require.Equal(t, []string{"user@host:/src/dir1/file11"}, paths)
+
+	rootContentIDs, err := env.RepositoryWriter.VerifyObject(ctx, man.RootObjectID())
+	require.NoError(t, err)
+
+	paths, err = repo.WhoReferences(ctx, env.RepositoryWriter, rootContentIDs[0].String())
+	require.NoError(t, err)
+	require.Equal(t, []string{"user@host:/src"}, paths)
+
+	dup, err := snapshotfs.GetNestedEntry(ctx, uploadedRoot, []string{"dup2"})
+	require.NoError(t, err)
+
+	dupContentIDs, err := env.RepositoryWriter.VerifyObject(ctx, dup.(object.HasObjectID).ObjectID())
+	require.NoError(t, err)
+
+	paths, err = repo.WhoReferences(ctx, env.RepositoryWriter, dupContentIDs[0].String())
+	require.NoError(t, err)
+	require.Equal(t, []string{"user@host:/src/dir1/dup1", "user@host:/src/dup2"}, paths)
+
+	// the index is sharded across multiple manifests.
+	entries, err := env.RepositoryWriter.FindManifests(ctx, map[string]string{"type": repo.ContentReferencesManifestType})
+	require.NoError(t, err)
+	require.Greater(t, len(entries), 1)
+
+	// rebuilding replaces the previous index.
+	require.NoError(t, snapshotfs.RebuildContentReferences(ctx, env.RepositoryWriter))
+
+	entries2, err := env.RepositoryWriter.FindManifests(ctx, map[string]string{"type": repo.ContentReferencesManifestType})
+	require.NoError(t, err)
+	require.Len(t, entries2, len(entries))
+
+	_, err = repo.WhoReferences(ctx, env.RepositoryWriter, "not-a-valid-content-id")
+	require.Error(t, err)
+}
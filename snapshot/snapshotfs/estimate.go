@@ -146,7 +146,7 @@ type processEntryError struct {
 				return funcErr.error
 			}
 
-			isIgnored := policyTree.EffectivePolicy().ErrorHandlingPolicy.IgnoreDirectoryErrors.OrDefault(false)
+			isIgnored := policyTree.ResolvedPolicy().ErrorHandlingPolicy.IgnoreDirectoryErrors.OrDefault(false)
 
 			if isIgnored {
 				atomic.AddInt32(&stats.IgnoredErrorCount, 1)
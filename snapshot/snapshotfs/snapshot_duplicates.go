@@ -0,0 +1,99 @@
+package snapshotfs
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+)
+
+// DuplicateFileGroup describes files in a snapshot that have identical contents.
+type DuplicateFileGroup struct {
+	ObjectID object.ID `json:"objectID"`
+	Size     int64     `json:"size"`
+	Paths    []string  `json:"paths"`
+}
+
+// WastedBytes returns the number of bytes taken by extra copies of the file at the source.
+func (g *DuplicateFileGroup) WastedBytes() int64 {
+	return g.Size * int64(len(g.Paths)-1)
+}
+
+// DuplicateFiles describes duplicate files found in a snapshot.
+type DuplicateFiles struct {
+	Groups              []*DuplicateFileGroup `json:"groups"`
+	TotalDuplicateBytes int64                 `json:"totalDuplicateBytes"`
+}
+
+// FindDuplicateFiles walks the provided snapshot and groups non-empty files sharing the same object ID,
+// which have identical contents. Groups are sorted by decreasing number of wasted bytes.
+func FindDuplicateFiles(ctx context.Context, rep repo.Repository, man *snapshot.Manifest) (*DuplicateFiles, error) {
+	root, err := SnapshotRoot(rep, man)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get snapshot root")
+	}
+
+	var mu sync.Mutex
+
+	byObjectID := map[object.ID]*DuplicateFileGroup{}
+
+	tw, err := NewTreeWalker(ctx, TreeWalkerOptions{
+		VisitDuplicates: true,
+		EntryCallback: func(ctx context.Context, entry fs.Entry, oid object.ID, entryPath string) error {
+			if _, ok := entry.(fs.File); !ok || entry.Size() == 0 {
+				return nil
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			g := byObjectID[oid]
+			if g == nil {
+				g = &DuplicateFileGroup{ObjectID: oid, Size: entry.Size()}
+				byObjectID[oid] = g
+			}
+
+			g.Paths = append(g.Paths, entryPath)
+
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create tree walker")
+	}
+
+	defer tw.Close(ctx)
+
+	if err := tw.Process(ctx, root, "."); err != nil {
+		return nil, errors.Wrap(err, "error walking snapshot tree")
+	}
+
+	result := &DuplicateFiles{}
+
+	for _, g := range byObjectID {
+		if len(g.Paths) < 2 { //nolint:gomnd
+			continue
+		}
+
+		sort.Strings(g.Paths)
+
+		result.Groups = append(result.Groups, g)
+		result.TotalDuplicateBytes += g.WastedBytes()
+	}
+
+	sort.Slice(result.Groups, func(i, j int) bool {
+		if wi, wj := result.Groups[i].WastedBytes(), result.Groups[j].WastedBytes(); wi != wj {
+			return wi > wj
+		}
+
+		return result.Groups[i].Paths[0] < result.Groups[j].Paths[0]
+	})
+
+	return result, nil
+}
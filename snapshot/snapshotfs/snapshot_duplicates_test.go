@@ -0,0 +1,54 @@
+package snapshotfs_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+func TestFindDuplicateFiles(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	sourceRoot := mockfs.NewDirectory()
+	dir1 := sourceRoot.AddDir("dir1", 0o755)
+	dir2 := sourceRoot.AddDir("dir2", 0o755)
+
+	large := bytes.Repeat([]byte{1, 2, 3, 4}, 1000)
+
+	sourceRoot.AddFile("large", large, 0o644)
+	dir1.AddFile("large-copy", large, 0o644)
+	dir2.AddFile("large-copy", large, 0o644)
+	sourceRoot.AddFile("unique", []byte{9, 9, 9}, 0o644)
+	sourceRoot.AddFile("empty1", nil, 0o644)
+	sourceRoot.AddFile("empty2", nil, 0o644)
+
+	// two identical directories, each containing the same file.
+	for _, d := range []*mockfs.Directory{sourceRoot.AddDir("same1", 0o755), sourceRoot.AddDir("same2", 0o755)} {
+		d.AddFile("small", []byte{5, 6, 7}, 0o644)
+	}
+
+	u := snapshotfs.NewUploader(env.RepositoryWriter)
+
+	man, err := u.Upload(ctx, sourceRoot, nil, snapshot.SourceInfo{Host: "host", UserName: "user", Path: "/src"})
+	require.NoError(t, err)
+
+	dups, err := snapshotfs.FindDuplicateFiles(ctx, env.RepositoryWriter, man)
+	require.NoError(t, err)
+
+	require.Len(t, dups.Groups, 2)
+
+	require.Equal(t, []string{"dir1/large-copy", "dir2/large-copy", "large"}, dups.Groups[0].Paths)
+	require.EqualValues(t, 4000, dups.Groups[0].Size)
+	require.EqualValues(t, 8000, dups.Groups[0].WastedBytes())
+
+	require.Equal(t, []string{"same1/small", "same2/small"}, dups.Groups[1].Paths)
+	require.EqualValues(t, 3, dups.Groups[1].WastedBytes())
+
+	require.EqualValues(t, 8003, dups.TotalDuplicateBytes)
+}
@@ -0,0 +1,123 @@
+package snapshotfs
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/internal/bigmap"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+)
+
+// DefaultSummaryLargestFiles is the default number of largest files included in a snapshot summary.
+const DefaultSummaryLargestFiles = 10
+
+// ComputeSummary computes aggregate statistics of the provided snapshot by walking its tree.
+// File and directory counts and logical size include duplicate files, while the stored size
+// reflects unique contents only. Up to maxLargestFiles largest files are reported.
+func ComputeSummary(ctx context.Context, rep repo.Repository, man *snapshot.Manifest, maxLargestFiles int) (*snapshot.Summary, error) {
+	root, err := SnapshotRoot(rep, man)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get snapshot root")
+	}
+
+	result := &snapshot.Summary{}
+
+	if ds := man.RootEntry.DirSummary; ds != nil {
+		result.LogicalBytes = ds.TotalFileSize
+		result.FileCount = ds.TotalFileCount
+		result.DirCount = ds.TotalDirCount
+	} else if !root.IsDir() {
+		result.LogicalBytes = root.Size()
+		result.FileCount = 1
+	}
+
+	uniqueContents, err := bigmap.NewSet(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "NewSet")
+	}
+
+	defer uniqueContents.Close(ctx)
+
+	var mu sync.Mutex
+
+	tw, err := NewTreeWalker(ctx, TreeWalkerOptions{
+		EntryCallback: func(ctx context.Context, entry fs.Entry, oid object.ID, entryPath string) error {
+			contentIDs, err := rep.VerifyObject(ctx, oid)
+			if err != nil {
+				return errors.Wrapf(err, "error verifying object %v", oid)
+			}
+
+			var (
+				cidbuf [128]byte
+				stored int64
+			)
+
+			for _, cid := range contentIDs {
+				if !uniqueContents.Put(ctx, cid.Append(cidbuf[:0])) {
+					continue
+				}
+
+				info, err := rep.ContentInfo(ctx, cid)
+				if err != nil {
+					return errors.Wrapf(err, "error getting content info for %v", cid)
+				}
+
+				stored += int64(info.GetPackedLength())
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			result.StoredBytes += stored
+
+			if !entry.IsDir() && maxLargestFiles > 0 {
+				result.LargestFiles = addLargestFile(result.LargestFiles, &snapshot.SummaryFile{Path: entryPath, Size: entry.Size()}, maxLargestFiles)
+			}
+
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create tree walker")
+	}
+
+	defer tw.Close(ctx)
+
+	rootPath := "."
+	if !root.IsDir() {
+		rootPath = root.Name()
+	}
+
+	if err := tw.Process(ctx, root, rootPath); err != nil {
+		return nil, errors.Wrap(err, "error walking snapshot tree")
+	}
+
+	return result, nil
+}
+
+// addLargestFile inserts the provided file into the list sorted by decreasing size, keeping at most max entries.
+func addLargestFile(files []*snapshot.SummaryFile, f *snapshot.SummaryFile, max int) []*snapshot.SummaryFile {
+	pos := sort.Search(len(files), func(i int) bool {
+		return files[i].Size < f.Size
+	})
+
+	if pos >= max {
+		return files
+	}
+
+	files = append(files, nil)
+	copy(files[pos+1:], files[pos:])
+	files[pos] = f
+
+	if len(files) > max {
+		files = files[:max]
+	}
+
+	return files
+}
@@ -0,0 +1,66 @@
+package snapshotfs_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+func TestSnapshotSummary(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	sourceRoot := mockfs.NewDirectory()
+	dir1 := sourceRoot.AddDir("dir1", 0o755)
+	dir2 := dir1.AddDir("dir2", 0o755)
+
+	dir1.AddFile("small", []byte{1, 2, 3}, 0o644)
+	dir2.AddFile("large", bytes.Repeat([]byte{1, 2, 3, 4}, 1000), 0o644)
+	sourceRoot.AddFile("medium", bytes.Repeat([]byte{5, 6}, 100), 0o644)
+	sourceRoot.AddFile("medium-copy", bytes.Repeat([]byte{5, 6}, 100), 0o644)
+
+	u := snapshotfs.NewUploader(env.RepositoryWriter)
+	u.ComputeSummary = true
+
+	man, err := u.Upload(ctx, sourceRoot, nil, snapshot.SourceInfo{Host: "host", UserName: "user", Path: "/src"})
+	require.NoError(t, err)
+	require.NotNil(t, man.Summary)
+
+	require.EqualValues(t, 4, man.Summary.FileCount)
+	require.EqualValues(t, 3, man.Summary.DirCount)
+	require.EqualValues(t, 3+4000+200+200, man.Summary.LogicalBytes)
+
+	// the duplicate file is stored only once.
+	require.Positive(t, man.Summary.StoredBytes)
+
+	require.Len(t, man.Summary.LargestFiles, 3)
+	require.Equal(t, &snapshot.SummaryFile{Path: "dir1/dir2/large", Size: 4000}, man.Summary.LargestFiles[0])
+	require.EqualValues(t, 200, man.Summary.LargestFiles[1].Size)
+	require.Equal(t, &snapshot.SummaryFile{Path: "dir1/small", Size: 3}, man.Summary.LargestFiles[2])
+
+	// summary is persisted in the manifest.
+	id, err := snapshot.SaveSnapshot(ctx, env.RepositoryWriter, man)
+	require.NoError(t, err)
+
+	loaded, err := snapshot.LoadSnapshot(ctx, env.RepositoryWriter, id)
+	require.NoError(t, err)
+	require.Equal(t, man.Summary, loaded.Summary)
+
+	// number of reported files can be limited.
+	s2, err := snapshotfs.ComputeSummary(ctx, env.RepositoryWriter, man, 1)
+	require.NoError(t, err)
+	require.Len(t, s2.LargestFiles, 1)
+	require.Equal(t, man.Summary.StoredBytes, s2.StoredBytes)
+
+	// without ComputeSummary, no summary is produced.
+	u = snapshotfs.NewUploader(env.RepositoryWriter)
+
+	man, err = u.Upload(ctx, sourceRoot, nil, snapshot.SourceInfo{Host: "host", UserName: "user", Path: "/src"})
+	require.NoError(t, err)
+	require.Nil(t, man.Summary)
+}
@@ -87,6 +87,10 @@ func (w *TreeWalker) TooManyErrors() bool {
 }
 
 func (w *TreeWalker) alreadyProcessed(ctx context.Context, e fs.Entry) bool {
+	if w.options.VisitDuplicates {
+		return false
+	}
+
 	var idbuf [128]byte
 
 	return !w.enqueued.Put(ctx, oidOf(e).Append(idbuf[:0]))
@@ -169,6 +173,10 @@ type TreeWalkerOptions struct {
 
 	Parallelism int
 	MaxErrors   int
+
+	// VisitDuplicates causes entries to be processed each time they are found in the tree,
+	// instead of once per object ID.
+	VisitDuplicates bool
 }
 
 // NewTreeWalker creates new tree walker.
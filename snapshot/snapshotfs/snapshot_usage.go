@@ -0,0 +1,146 @@
+package snapshotfs
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+)
+
+// SnapshotUsage describes repository storage used by a snapshot, taking deduplication into account.
+type SnapshotUsage struct {
+	Manifest *snapshot.Manifest `json:"-"`
+
+	// ExclusiveBytes is the number of stored bytes of contents referenced only by this snapshot,
+	// which would be reclaimed by deleting it.
+	ExclusiveBytes    int64 `json:"exclusiveBytes"`
+	ExclusiveContents int   `json:"exclusiveContents"`
+
+	// SharedBytes is the number of stored bytes of contents also referenced by other snapshots.
+	SharedBytes    int64 `json:"sharedBytes"`
+	SharedContents int   `json:"sharedContents"`
+}
+
+// TotalBytes returns the number of stored bytes of all contents referenced by the snapshot.
+func (u *SnapshotUsage) TotalBytes() int64 {
+	return u.ExclusiveBytes + u.SharedBytes
+}
+
+// contentUsage tracks snapshots referencing a content.
+type contentUsage struct {
+	storedSize int64
+	lastSeen   int // index of the last snapshot that referenced the content
+	refCount   int // number of snapshots referencing the content, capped at 2
+}
+
+// CalculateSnapshotUsage attributes stored bytes of contents reachable from the provided snapshots to each
+// of them, distinguishing contents referenced by a single snapshot from ones shared by several snapshots.
+// Only the provided snapshots are considered, so to find out what deleting a snapshot would reclaim,
+// all snapshots in the repository must be passed. Results are returned in the order of provided manifests.
+func CalculateSnapshotUsage(ctx context.Context, rep repo.Repository, manifests []*snapshot.Manifest) ([]*SnapshotUsage, error) {
+	// snapshots are walked one at a time, so each content is counted once per snapshot by remembering
+	// the last snapshot it was seen in, without keeping the list of contents of each snapshot.
+	usage := map[content.ID]*contentUsage{}
+
+	var result []*SnapshotUsage
+
+	for i, m := range manifests {
+		u := &SnapshotUsage{Manifest: m}
+
+		if err := walkSnapshotContents(ctx, rep, m, func(cu *contentUsage) {
+			if cu.lastSeen == i {
+				return
+			}
+
+			cu.lastSeen = i
+
+			if cu.refCount < 2 { //nolint:gomnd
+				cu.refCount++
+			}
+
+			// attribute all contents as shared, those referenced only by this snapshot are moved to exclusive below.
+			u.SharedBytes += cu.storedSize
+			u.SharedContents++
+		}, usage); err != nil {
+			return nil, errors.Wrapf(err, "error finding contents of snapshot %v", m.ID)
+		}
+
+		result = append(result, u)
+	}
+
+	for _, cu := range usage {
+		if cu.refCount == 1 {
+			u := result[cu.lastSeen]
+
+			u.SharedBytes -= cu.storedSize
+			u.SharedContents--
+			u.ExclusiveBytes += cu.storedSize
+			u.ExclusiveContents++
+		}
+	}
+
+	return result, nil
+}
+
+// walkSnapshotContents invokes the provided callback for each content reachable from the provided snapshot
+// with its usage entry, which is added to the provided map when the content is first seen.
+// Callbacks are not invoked concurrently.
+func walkSnapshotContents(ctx context.Context, rep repo.Repository, m *snapshot.Manifest, cb func(cu *contentUsage), usage map[content.ID]*contentUsage) error {
+	root, err := SnapshotRoot(rep, m)
+	if err != nil {
+		return errors.Wrap(err, "unable to get snapshot root")
+	}
+
+	var mu sync.Mutex
+
+	// each snapshot is walked with a new tree walker, because tree walker does not revisit
+	// objects it has already seen, which would hide contents shared with earlier snapshots.
+	tw, err := NewTreeWalker(ctx, TreeWalkerOptions{
+		EntryCallback: func(ctx context.Context, entry fs.Entry, oid object.ID, entryPath string) error {
+			cids, err := rep.VerifyObject(ctx, oid)
+			if err != nil {
+				return errors.Wrapf(err, "error verifying %v", oid)
+			}
+
+			for _, cid := range cids {
+				mu.Lock()
+				cu := usage[cid]
+				mu.Unlock()
+
+				if cu == nil {
+					ci, err := rep.ContentInfo(ctx, cid)
+					if err != nil {
+						return errors.Wrapf(err, "error getting content info for %v", cid)
+					}
+
+					cu = &contentUsage{storedSize: int64(ci.GetPackedLength()), lastSeen: -1}
+				}
+
+				mu.Lock()
+				if existing := usage[cid]; existing != nil {
+					cu = existing
+				} else {
+					usage[cid] = cu
+				}
+
+				cb(cu)
+				mu.Unlock()
+			}
+
+			return nil
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to create tree walker")
+	}
+
+	defer tw.Close(ctx)
+
+	return errors.Wrap(tw.Process(ctx, root, "."), "error walking snapshot tree")
+}
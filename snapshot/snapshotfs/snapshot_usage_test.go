@@ -0,0 +1,109 @@
+package snapshotfs_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/mockfs"
+	"github.com/kopia/kopia/internal/repotesting"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/object"
+	"github.com/kopia/kopia/snapshot"
+	"github.com/kopia/kopia/snapshot/snapshotfs"
+)
+
+func TestCalculateSnapshotUsage(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant)
+
+	shared := bytes.Repeat([]byte{1, 2, 3, 4}, 1000)
+
+	root1 := mockfs.NewDirectory()
+	root1.AddFile("shared", shared, 0o644)
+	root1.AddFile("only1", bytes.Repeat([]byte{5, 6}, 1000), 0o644)
+
+	// the shared file appears twice in the second snapshot, but is counted only once.
+	root2 := mockfs.NewDirectory()
+	root2.AddFile("shared", shared, 0o644)
+	root2.AddDir("sub", 0o755).AddFile("shared-copy", shared, 0o644)
+	root2.AddFile("only2", bytes.Repeat([]byte{7, 8, 9}, 1000), 0o644)
+
+	u := snapshotfs.NewUploader(env.RepositoryWriter)
+
+	man1, err := u.Upload(ctx, root1, nil, snapshot.SourceInfo{Host: "host", UserName: "user", Path: "/src1"})
+	require.NoError(t, err)
+
+	man2, err := u.Upload(ctx, root2, nil, snapshot.SourceInfo{Host: "host", UserName: "user", Path: "/src2"})
+	require.NoError(t, err)
+
+	usage, err := snapshotfs.CalculateSnapshotUsage(ctx, env.RepositoryWriter, []*snapshot.Manifest{man1, man2})
+	require.NoError(t, err)
+	require.Len(t, usage, 2)
+
+	sharedBytes := storedObjectBytes(ctx, t, env.RepositoryWriter, mustFindEntryObjectID(ctx, t, env.RepositoryWriter, man1, "shared"))
+	require.Positive(t, sharedBytes)
+
+	// directories differ between snapshots, so they are exclusive along with unique files.
+	exclusive1 := storedObjectBytes(ctx, t, env.RepositoryWriter,
+		man1.RootObjectID(),
+		mustFindEntryObjectID(ctx, t, env.RepositoryWriter, man1, "only1"))
+
+	exclusive2 := storedObjectBytes(ctx, t, env.RepositoryWriter,
+		man2.RootObjectID(),
+		mustFindEntryObjectID(ctx, t, env.RepositoryWriter, man2, "sub"),
+		mustFindEntryObjectID(ctx, t, env.RepositoryWriter, man2, "only2"))
+
+	require.Equal(t, man1, usage[0].Manifest)
+	require.Equal(t, sharedBytes, usage[0].SharedBytes)
+	require.Equal(t, exclusive1, usage[0].ExclusiveBytes)
+	require.Equal(t, 1, usage[0].SharedContents)
+	require.Equal(t, 2, usage[0].ExclusiveContents)
+
+	require.Equal(t, man2, usage[1].Manifest)
+	require.Equal(t, sharedBytes, usage[1].SharedBytes)
+	require.Equal(t, exclusive2, usage[1].ExclusiveBytes)
+	require.Equal(t, 1, usage[1].SharedContents)
+	require.Equal(t, 3, usage[1].ExclusiveContents)
+	require.Equal(t, exclusive2+sharedBytes, usage[1].TotalBytes())
+
+	// when considered alone, all contents of a snapshot are exclusive to it.
+	usage, err = snapshotfs.CalculateSnapshotUsage(ctx, env.RepositoryWriter, []*snapshot.Manifest{man2})
+	require.NoError(t, err)
+	require.Len(t, usage, 1)
+	require.Equal(t, exclusive2+sharedBytes, usage[0].ExclusiveBytes)
+	require.Zero(t, usage[0].SharedBytes)
+}
+
+func mustFindEntryObjectID(ctx context.Context, t *testing.T, rep repo.Repository, man *snapshot.Manifest, path ...string) object.ID {
+	t.Helper()
+
+	root, err := snapshotfs.SnapshotRoot(rep, man)
+	require.NoError(t, err)
+
+	e, err := snapshotfs.GetNestedEntry(ctx, root, path)
+	require.NoError(t, err)
+
+	return e.(object.HasObjectID).ObjectID()
+}
+
+func storedObjectBytes(ctx context.Context, t *testing.T, rep repo.Repository, oids ...object.ID) int64 {
+	t.Helper()
+
+	var total int64
+
+	for _, oid := range oids {
+		cids, err := rep.VerifyObject(ctx, oid)
+		require.NoError(t, err)
+
+		for _, cid := range cids {
+			ci, err := rep.ContentInfo(ctx, cid)
+			require.NoError(t, err)
+
+			total += int64(ci.GetPackedLength())
+		}
+	}
+
+	return total
+}
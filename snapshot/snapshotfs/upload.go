@@ -19,12 +19,15 @@
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/multierr"
+	"golang.org/x/sync/semaphore"
 
 	"github.com/kopia/kopia/fs"
 	"github.com/kopia/kopia/fs/ignorefs"
 	"github.com/kopia/kopia/internal/iocopy"
+	"github.com/kopia/kopia/internal/sparsefile"
 	"github.com/kopia/kopia/internal/timetrack"
 	"github.com/kopia/kopia/internal/workshare"
+	"github.com/kopia/kopia/internal/xattr"
 	"github.com/kopia/kopia/repo"
 	"github.com/kopia/kopia/repo/compression"
 	"github.com/kopia/kopia/repo/logging"
@@ -97,6 +100,15 @@ type Uploader struct {
 	// When set to true, do not ignore any files, regardless of policy settings.
 	DisableIgnoreRules bool
 
+	// When set to true, files of up to object.MaxInlineObjectLength bytes are stored
+	// directly in their object IDs instead of in separate contents, if the repository
+	// was created with inline objects enabled.
+	InlineSmallFiles bool
+
+	// When set to true, the resulting manifest includes a summary with aggregate statistics,
+	// which requires walking the uploaded tree once the upload completes.
+	ComputeSummary bool
+
 	repo repo.RepositoryWriter
 
 	// stats must be allocated on heap to enforce 64-bit alignment due to atomic access on ARM.
@@ -115,6 +127,9 @@ type Uploader struct {
 
 	workerPool *workshare.Pool
 
+	// limits the number of files being read concurrently across all directories.
+	fileReadSemaphore *semaphore.Weighted
+
 	traceEnabled bool
 }
 
@@ -235,6 +250,12 @@ func concatenateParts(ctx context.Context, rep repo.RepositoryWriter, name strin
 }
 
 func (u *Uploader) uploadFileData(ctx context.Context, parentCheckpointRegistry *checkpointRegistry, f fs.File, fname string, offset, length int64, compressor compression.Name) (*snapshot.DirEntry, error) {
+	release, err := u.acquireFileRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	file, err := f.Open(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to open file")
@@ -245,6 +266,7 @@ func (u *Uploader) uploadFileData(ctx context.Context, parentCheckpointRegistry
 		Description: "FILE:" + fname,
 		Compressor:  compressor,
 		AsyncWrites: 1, // upload chunk in parallel to writing another chunk
+		AllowInline: u.InlineSmallFiles,
 	})
 	defer writer.Close() //nolint:errcheck
 
@@ -298,6 +320,20 @@ func (u *Uploader) uploadFileData(ctx context.Context, parentCheckpointRegistry
 	return de, nil
 }
 
+// acquireFileRead blocks until the file can be read without exceeding the limit of files read in parallel
+// and returns the function that must be called when done reading.
+func (u *Uploader) acquireFileRead(ctx context.Context) (func(), error) {
+	if u.fileReadSemaphore == nil {
+		return func() {}, nil
+	}
+
+	if err := u.fileReadSemaphore.Acquire(ctx, 1); err != nil {
+		return nil, errors.Wrap(err, "unable to acquire file read slot")
+	}
+
+	return func() { u.fileReadSemaphore.Release(1) }, nil
+}
+
 func (u *Uploader) uploadSymlinkInternal(ctx context.Context, relativePath string, f fs.Symlink) (dirEntry *snapshot.DirEntry, ret error) {
 	u.Progress.HashingFile(relativePath)
 
@@ -337,6 +373,12 @@ func (u *Uploader) uploadSymlinkInternal(ctx context.Context, relativePath strin
 }
 
 func (u *Uploader) uploadStreamingFileInternal(ctx context.Context, relativePath string, f fs.StreamingFile) (dirEntry *snapshot.DirEntry, ret error) {
+	release, err := u.acquireFileRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	reader, err := f.GetReader(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to get streaming file reader")
@@ -463,6 +505,71 @@ func newDirEntry(md fs.Entry, fname string, oid object.ID) (*snapshot.DirEntry,
 	}, nil
 }
 
+// maybeStoreExtendedAttributes stores extended attributes and ACLs of a local filesystem entry in the
+// provided DirEntry, as requested by the upload policy. Failure to read them is logged but not fatal.
+func maybeStoreExtendedAttributes(ctx context.Context, e fs.Entry, de *snapshot.DirEntry, pol *policy.Policy) {
+	storeXattrs := pol.UploadPolicy.StoreExtendedAttributes.OrDefault(false)
+	storeACLs := pol.UploadPolicy.StoreACLs.OrDefault(false)
+
+	if !storeXattrs && !storeACLs {
+		return
+	}
+
+	localPath := e.LocalFilesystemPath()
+	if localPath == "" {
+		return
+	}
+
+	attrs, err := xattr.List(localPath)
+	if errors.Is(err, xattr.ErrUnsupported) {
+		uploadLog(ctx).Debugw("extended attributes not supported", "path", localPath)
+		return
+	}
+
+	if err != nil {
+		uploadLog(ctx).Errorw("unable to read extended attributes", "path", localPath, "error", err)
+		return
+	}
+
+	for n := range attrs {
+		keep := storeXattrs
+		if xattr.IsACL(n) {
+			keep = storeACLs
+		}
+
+		if !keep {
+			delete(attrs, n)
+		}
+	}
+
+	if len(attrs) > 0 {
+		de.ExtendedAttributes = attrs
+	}
+}
+
+// maybeStoreHoles stores the holes of a sparse local file in the provided DirEntry, so that they can
+// be recreated on restore. Failure to find them is logged but not fatal.
+func maybeStoreHoles(ctx context.Context, e fs.Entry, de *snapshot.DirEntry) {
+	localPath := e.LocalFilesystemPath()
+	if localPath == "" || de.FileSize == 0 {
+		return
+	}
+
+	holes, err := sparsefile.FindHoles(localPath)
+	if errors.Is(err, sparsefile.ErrUnsupported) {
+		return
+	}
+
+	if err != nil {
+		uploadLog(ctx).Errorw("unable to find holes", "path", localPath, "error", err)
+		return
+	}
+
+	for _, h := range holes {
+		de.Holes = append(de.Holes, snapshot.FileHole{Offset: h.Offset, Length: h.Length})
+	}
+}
+
 // uploadFileWithCheckpointing uploads the specified File to the repository.
 func (u *Uploader) uploadFileWithCheckpointing(ctx context.Context, relativePath string, file fs.File, pol *policy.Policy, sourceInfo snapshot.SourceInfo) (*snapshot.DirEntry, error) {
 	var cp checkpointRegistry
@@ -572,7 +679,7 @@ func (u *Uploader) uploadDirWithCheckpointing(ctx context.Context, rootDir fs.Di
 
 	localDirPathOrEmpty := rootDir.LocalFilesystemPath()
 
-	overrideDir, err := u.executeBeforeFolderAction(ctx, "before-snapshot-root", policyTree.EffectivePolicy().Actions.BeforeSnapshotRoot, localDirPathOrEmpty, &hc)
+	overrideDir, err := u.executeBeforeFolderAction(ctx, "before-snapshot-root", policyTree.ResolvedPolicy().Actions.BeforeSnapshotRoot, localDirPathOrEmpty, &hc)
 	if err != nil {
 		return nil, dirReadError{errors.Wrap(err, "error executing before-snapshot-root action")}
 	}
@@ -581,7 +688,7 @@ func (u *Uploader) uploadDirWithCheckpointing(ctx context.Context, rootDir fs.Di
 		rootDir = u.wrapIgnorefs(uploadLog(ctx), overrideDir, policyTree, true)
 	}
 
-	defer u.executeAfterFolderAction(ctx, "after-snapshot-root", policyTree.EffectivePolicy().Actions.AfterSnapshotRoot, localDirPathOrEmpty, &hc)
+	defer u.executeAfterFolderAction(ctx, "after-snapshot-root", policyTree.ResolvedPolicy().Actions.AfterSnapshotRoot, localDirPathOrEmpty, &hc)
 
 	return uploadDirInternal(ctx, u, rootDir, policyTree, previousDirs, localDirPathOrEmpty, ".", &dmb, &cp)
 }
@@ -699,7 +806,7 @@ func findCachedEntry(ctx context.Context, entryRelativePath string, entry fs.Ent
 	}
 
 	if missedEntry != nil {
-		if pol.EffectivePolicy().LoggingPolicy.Entries.CacheMiss.OrDefault(policy.LogDetailNone) >= policy.LogDetailNormal {
+		if pol.ResolvedPolicy().LoggingPolicy.Entries.CacheMiss.OrDefault(policy.LogDetailNone) >= policy.LogDetailNormal {
 			uploadLog(ctx).Debugw(
 				"cache miss",
 				"path", entryRelativePath,
@@ -732,8 +839,12 @@ func (u *Uploader) effectiveParallelFileReads(pol *policy.Policy) int {
 		return p
 	}
 
-	// use policy setting or number of CPUs.
-	max := pol.UploadPolicy.MaxParallelFileReads.OrDefault(runtime.NumCPU())
+	// use policy setting or number of CPUs, 0 means default.
+	max := pol.UploadPolicy.MaxParallelFileReads.OrDefault(0)
+	if max < 1 {
+		max = runtime.NumCPU()
+	}
+
 	if p < 1 || p > max {
 		return max
 	}
@@ -825,9 +936,12 @@ func (u *Uploader) processSingle(
 				return errors.Wrap(err, "unable to create dir entry")
 			}
 
+			maybeStoreExtendedAttributes(ctx, entry, cachedDirEntry, policyTree.ResolveForPath(entry.Name()))
+			maybeStoreHoles(ctx, entry, cachedDirEntry)
+
 			return u.processEntryUploadResult(ctx, cachedDirEntry, nil, entryRelativePath, parentDirBuilder,
 				false,
-				u.OverrideEntryLogDetail.OrDefault(policyTree.EffectivePolicy().LoggingPolicy.Entries.CacheHit.OrDefault(policy.LogDetailNone)),
+				u.OverrideEntryLogDetail.OrDefault(policyTree.ResolvedPolicy().LoggingPolicy.Entries.CacheHit.OrDefault(policy.LogDetailNone)),
 				"cached", t0)
 		}
 	}
@@ -855,12 +969,13 @@ func (u *Uploader) processSingle(
 			// otherwise a meaningless, empty snapshot is created that can't be restored.
 			var dre dirReadError
 			if errors.As(err, &dre) {
-				isIgnoredError := childTree.EffectivePolicy().ErrorHandlingPolicy.IgnoreDirectoryErrors.OrDefault(false)
+				isIgnoredError := childTree.ResolvedPolicy().ErrorHandlingPolicy.IgnoreDirectoryErrors.OrDefault(false)
 				u.reportErrorAndMaybeCancel(dre.error, isIgnoredError, parentDirBuilder, entryRelativePath)
 			} else {
 				return errors.Wrapf(err, "unable to process directory %q", entry.Name())
 			}
 		} else {
+			maybeStoreExtendedAttributes(ctx, entry, de, childTree.ResolvedPolicy())
 			parentDirBuilder.AddEntry(de)
 		}
 
@@ -868,20 +983,29 @@ func (u *Uploader) processSingle(
 
 	case fs.Symlink:
 		de, err := u.uploadSymlinkInternal(ctx, entryRelativePath, entry)
+		if err == nil {
+			maybeStoreExtendedAttributes(ctx, entry, de, policyTree.ResolveForPath(entry.Name()))
+		}
 
 		return u.processEntryUploadResult(ctx, de, err, entryRelativePath, parentDirBuilder,
-			policyTree.EffectivePolicy().ErrorHandlingPolicy.IgnoreFileErrors.OrDefault(false),
-			u.OverrideEntryLogDetail.OrDefault(policyTree.EffectivePolicy().LoggingPolicy.Entries.Snapshotted.OrDefault(policy.LogDetailNone)),
+			policyTree.ResolvedPolicy().ErrorHandlingPolicy.IgnoreFileErrors.OrDefault(false),
+			u.OverrideEntryLogDetail.OrDefault(policyTree.ResolvedPolicy().LoggingPolicy.Entries.Snapshotted.OrDefault(policy.LogDetailNone)),
 			"snapshotted symlink", t0)
 
 	case fs.File:
 		atomic.AddInt32(&u.stats.NonCachedFiles, 1)
 
-		de, err := u.uploadFileInternal(ctx, parentCheckpointRegistry, entryRelativePath, entry, policyTree.Child(entry.Name()).EffectivePolicy())
+		pol := policyTree.ResolveForPath(entry.Name())
+
+		de, err := u.uploadFileInternal(ctx, parentCheckpointRegistry, entryRelativePath, entry, pol)
+		if err == nil {
+			maybeStoreExtendedAttributes(ctx, entry, de, pol)
+			maybeStoreHoles(ctx, entry, de)
+		}
 
 		return u.processEntryUploadResult(ctx, de, err, entryRelativePath, parentDirBuilder,
-			policyTree.EffectivePolicy().ErrorHandlingPolicy.IgnoreFileErrors.OrDefault(false),
-			u.OverrideEntryLogDetail.OrDefault(policyTree.EffectivePolicy().LoggingPolicy.Entries.Snapshotted.OrDefault(policy.LogDetailNone)),
+			policyTree.ResolvedPolicy().ErrorHandlingPolicy.IgnoreFileErrors.OrDefault(false),
+			u.OverrideEntryLogDetail.OrDefault(policyTree.ResolvedPolicy().LoggingPolicy.Entries.Snapshotted.OrDefault(policy.LogDetailNone)),
 			"snapshotted file", t0)
 
 	case fs.ErrorEntry:
@@ -891,26 +1015,29 @@ func (u *Uploader) processSingle(
 		)
 
 		if errors.Is(entry.ErrorInfo(), fs.ErrUnknown) {
-			isIgnoredError = policyTree.EffectivePolicy().ErrorHandlingPolicy.IgnoreUnknownTypes.OrDefault(true)
+			isIgnoredError = policyTree.ResolvedPolicy().ErrorHandlingPolicy.IgnoreUnknownTypes.OrDefault(true)
 			prefix = "unknown entry"
 		} else {
-			isIgnoredError = policyTree.EffectivePolicy().ErrorHandlingPolicy.IgnoreFileErrors.OrDefault(false)
+			isIgnoredError = policyTree.ResolvedPolicy().ErrorHandlingPolicy.IgnoreFileErrors.OrDefault(false)
 			prefix = "error"
 		}
 
 		return u.processEntryUploadResult(ctx, nil, entry.ErrorInfo(), entryRelativePath, parentDirBuilder,
 			isIgnoredError,
-			u.OverrideEntryLogDetail.OrDefault(policyTree.EffectivePolicy().LoggingPolicy.Entries.Snapshotted.OrDefault(policy.LogDetailNone)),
+			u.OverrideEntryLogDetail.OrDefault(policyTree.ResolvedPolicy().LoggingPolicy.Entries.Snapshotted.OrDefault(policy.LogDetailNone)),
 			prefix, t0)
 
 	case fs.StreamingFile:
 		atomic.AddInt32(&u.stats.NonCachedFiles, 1)
 
 		de, err := u.uploadStreamingFileInternal(ctx, entryRelativePath, entry)
+		if err == nil {
+			maybeStoreExtendedAttributes(ctx, entry, de, policyTree.ResolveForPath(entry.Name()))
+		}
 
 		return u.processEntryUploadResult(ctx, de, err, entryRelativePath, parentDirBuilder,
-			policyTree.EffectivePolicy().ErrorHandlingPolicy.IgnoreFileErrors.OrDefault(false),
-			u.OverrideEntryLogDetail.OrDefault(policyTree.EffectivePolicy().LoggingPolicy.Entries.Snapshotted.OrDefault(policy.LogDetailNone)),
+			policyTree.ResolvedPolicy().ErrorHandlingPolicy.IgnoreFileErrors.OrDefault(false),
+			u.OverrideEntryLogDetail.OrDefault(policyTree.ResolvedPolicy().LoggingPolicy.Entries.Snapshotted.OrDefault(policy.LogDetailNone)),
 			"snapshotted streaming file", t0)
 
 	default:
@@ -1076,7 +1203,7 @@ func uploadDirInternal(
 	defer func() {
 		maybeLogEntryProcessed(
 			uploadLog(ctx),
-			u.OverrideDirLogDetail.OrDefault(policyTree.EffectivePolicy().LoggingPolicy.Directories.Snapshotted.OrDefault(policy.LogDetailNone)),
+			u.OverrideDirLogDetail.OrDefault(policyTree.ResolvedPolicy().LoggingPolicy.Directories.Snapshotted.OrDefault(policy.LogDetailNone)),
 			"snapshotted directory", dirRelativePath, resultDE, resultErr, t0)
 	}()
 
@@ -1217,7 +1344,7 @@ func (u *Uploader) Upload(
 		return nil, errors.Errorf("checkpoint interval cannot be greater than %v", DefaultCheckpointInterval)
 	}
 
-	parallel := u.effectiveParallelFileReads(policyTree.EffectivePolicy())
+	parallel := u.effectiveParallelFileReads(policyTree.ResolvedPolicy())
 
 	uploadLog(ctx).Debugw("uploading", "source", sourceInfo, "previousManifests", len(previousManifests), "parallel", parallel)
 
@@ -1225,9 +1352,24 @@ func (u *Uploader) Upload(
 		Source: sourceInfo,
 	}
 
+	// protect contents written by this upload from garbage collection until they are referenced by a snapshot.
+	// the lease is best-effort, since users may not be allowed to write it, for example when connected
+	// to a server with ACLs predating upload leases, in which case only the minimum content age applies.
+	if lease, lerr := snapshot.AcquireUploadLease(ctx, u.repo, sourceInfo); lerr != nil {
+		uploadLog(ctx).Warnf("unable to acquire upload lease: %v", lerr)
+	} else {
+		defer func() {
+			if rerr := snapshot.ReleaseUploadLease(ctx, u.repo, lease); rerr != nil {
+				uploadLog(ctx).Errorf("unable to release upload lease: %v", rerr)
+			}
+		}()
+	}
+
 	u.workerPool = workshare.NewPool(parallel - 1)
 	defer u.workerPool.Close()
 
+	u.fileReadSemaphore = semaphore.NewWeighted(int64(parallel))
+
 	u.stats = &snapshot.Stats{}
 	atomic.StoreInt64(&u.totalWrittenBytes, 0)
 
@@ -1269,7 +1411,10 @@ func (u *Uploader) Upload(
 
 	case fs.File:
 		u.Progress.EstimatedDataSize(1, entry.Size())
-		s.RootEntry, err = u.uploadFileWithCheckpointing(ctx, entry.Name(), entry, policyTree.EffectivePolicy(), sourceInfo)
+		s.RootEntry, err = u.uploadFileWithCheckpointing(ctx, entry.Name(), entry, policyTree.ResolvedPolicy(), sourceInfo)
+
+	case fs.StreamingFile:
+		s.RootEntry, err = u.uploadStreamingFileInternal(ctx, entry.Name(), entry)
 
 	default:
 		return nil, errors.Errorf("unsupported source: %v", s.Source)
@@ -1286,6 +1431,15 @@ func (u *Uploader) Upload(
 	s.EndTime = fs.UTCTimestampFromTime(u.repo.Time())
 	s.Stats = *u.stats
 
+	if u.ComputeSummary && s.RootEntry != nil {
+		summary, serr := ComputeSummary(ctx, u.repo, s, DefaultSummaryLargestFiles)
+		if serr != nil {
+			return nil, errors.Wrap(serr, "unable to compute snapshot summary")
+		}
+
+		s.Summary = summary
+	}
+
 	return s, nil
 }
 
@@ -1298,7 +1452,7 @@ func (u *Uploader) wrapIgnorefs(logger logging.Logger, entry fs.Directory, polic
 		if md.IsDir() {
 			maybeLogEntryProcessed(
 				logger,
-				policyTree.EffectivePolicy().LoggingPolicy.Directories.Ignored.OrDefault(policy.LogDetailNone),
+				policyTree.ResolvedPolicy().LoggingPolicy.Directories.Ignored.OrDefault(policy.LogDetailNone),
 				"ignored directory", fname, nil, nil, timetrack.StartTimer())
 
 			if reportIgnoreStats {
@@ -1307,7 +1461,7 @@ func (u *Uploader) wrapIgnorefs(logger logging.Logger, entry fs.Directory, polic
 		} else {
 			maybeLogEntryProcessed(
 				logger,
-				policyTree.EffectivePolicy().LoggingPolicy.Entries.Ignored.OrDefault(policy.LogDetailNone),
+				policyTree.ResolvedPolicy().LoggingPolicy.Entries.Ignored.OrDefault(policy.LogDetailNone),
 				"ignored", fname, nil, nil, timetrack.StartTimer())
 
 			if reportIgnoreStats {
@@ -10,6 +10,7 @@
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
 	"runtime/debug"
 	"sort"
 	"strings"
@@ -1613,3 +1614,129 @@ func verifyLogDetails(t *testing.T, desc string, wantDetailKeys []string, keysAn
 	sort.Strings(wantDetailKeys)
 	require.Equal(t, wantDetailKeys, gotDetailKeys, "invalid details for "+desc)
 }
+
+func TestUpload_InlineSmallFiles(t *testing.T) {
+	ctx, env := repotesting.NewEnvironment(t, repotesting.FormatNotImportant, repotesting.Options{
+		NewRepositoryOptions: func(n *repo.NewRepositoryOptions) {
+			n.ObjectFormat.InlineObjects = true
+		},
+	})
+
+	sourceRoot := mockfs.NewDirectory()
+	sourceRoot.AddFile("tiny", []byte{1, 2, 3, 4, 5}, defaultPermissions)
+	sourceRoot.AddFile("large", bytes.Repeat([]byte{1, 2, 3}, 100), defaultPermissions)
+
+	u := NewUploader(env.RepositoryWriter)
+	u.InlineSmallFiles = true
+
+	man, err := u.Upload(ctx, sourceRoot, nil, snapshot.SourceInfo{})
+	require.NoError(t, err)
+
+	root, err := SnapshotRoot(env.RepositoryWriter, man)
+	require.NoError(t, err)
+
+	tiny, err := GetNestedEntry(ctx, root, []string{"tiny"})
+	require.NoError(t, err)
+
+	data, ok := tiny.(object.HasObjectID).ObjectID().InlineData()
+	require.True(t, ok)
+	require.Equal(t, []byte{1, 2, 3, 4, 5}, data)
+
+	large, err := GetNestedEntry(ctx, root, []string{"large"})
+	require.NoError(t, err)
+
+	_, ok = large.(object.HasObjectID).ObjectID().InlineData()
+	require.False(t, ok)
+
+	r, err := tiny.(fs.File).Open(ctx)
+	require.NoError(t, err)
+
+	defer r.Close()
+
+	all, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, []byte{1, 2, 3, 4, 5}, all)
+}
+
+type concurrencyTrackingReader struct {
+	*bytes.Reader
+
+	onClose func()
+}
+
+func (r *concurrencyTrackingReader) Read(b []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+
+	return r.Reader.Read(b)
+}
+
+func (r *concurrencyTrackingReader) Close() error {
+	r.onClose()
+	return nil
+}
+
+func TestUploadLimitsParallelFileReads(t *testing.T) {
+	for _, limit := range []int{1, 3, 0} {
+		limit := limit
+
+		t.Run(fmt.Sprintf("limit-%v", limit), func(t *testing.T) {
+			ctx := testlogging.Context(t)
+			th := newUploadTestHarness(ctx, t)
+
+			defer th.cleanup()
+
+			var current, maxSeen int32
+
+			source := func() (mockfs.ReaderSeekerCloser, error) {
+				n := atomic.AddInt32(&current, 1)
+
+				for {
+					m := atomic.LoadInt32(&maxSeen)
+					if n <= m || atomic.CompareAndSwapInt32(&maxSeen, m, n) {
+						break
+					}
+				}
+
+				return &concurrencyTrackingReader{
+					Reader:  bytes.NewReader(bytes.Repeat([]byte{1, 2, 3}, 10000)),
+					onClose: func() { atomic.AddInt32(&current, -1) },
+				}, nil
+			}
+
+			sourceDir := mockfs.NewDirectory()
+
+			for i := 0; i < 5; i++ {
+				sourceDir.AddDir(fmt.Sprintf("d%v", i), defaultPermissions)
+
+				for j := 0; j < 5; j++ {
+					sourceDir.AddDir(fmt.Sprintf("d%v/d%v", i, j), defaultPermissions)
+
+					for k := 0; k < 4; k++ {
+						sourceDir.AddFileWithSource(fmt.Sprintf("d%v/d%v/f%v", i, j, k), defaultPermissions, source)
+					}
+				}
+
+				sourceDir.AddFileWithSource(fmt.Sprintf("d%v/f", i), defaultPermissions, source)
+			}
+
+			maxReads := policy.OptionalInt(limit)
+
+			pol := *policy.DefaultPolicy
+			pol.UploadPolicy.MaxParallelFileReads = &maxReads
+
+			u := NewUploader(th.repo)
+
+			_, err := u.Upload(ctx, sourceDir, policy.BuildTree(nil, &pol), snapshot.SourceInfo{})
+			require.NoError(t, err)
+
+			wantMax := limit
+			if wantMax == 0 {
+				wantMax = runtime.NumCPU()
+			}
+
+			require.Equal(t, int32(0), atomic.LoadInt32(&current))
+			require.Positive(t, maxSeen)
+			require.LessOrEqual(t, int(maxSeen), wantMax)
+		})
+	}
+}
@@ -107,6 +107,16 @@ func runInternal(ctx context.Context, rep repo.DirectRepositoryWriter, gcDelete
 	}
 	defer used.Close(ctx)
 
+	// contents written by uploads in progress may not be referenced by any snapshot yet.
+	lease, err := snapshot.OldestUploadLease(ctx, rep, maintenanceStartTime)
+	if err != nil {
+		return errors.Wrap(err, "unable to find upload leases")
+	}
+
+	if lease != nil {
+		log(ctx).Infof("Upload of %v in progress since %v, contents written since then will not be deleted.", lease.Source, lease.StartTime)
+	}
+
 	if err := findInUseContentIDs(ctx, rep, used); err != nil {
 		return errors.Wrap(err, "unable to find in-use content ID")
 	}
@@ -115,7 +125,7 @@ func runInternal(ctx context.Context, rep repo.DirectRepositoryWriter, gcDelete
 
 	// Ensure that the iteration includes deleted contents, so those can be
 	// undeleted (recovered).
-	err := rep.ContentReader().IterateContents(ctx, content.IterateOptions{IncludeDeleted: true}, func(ci content.Info) error {
+	err = rep.ContentReader().IterateContents(ctx, content.IterateOptions{IncludeDeleted: true}, func(ci content.Info) error {
 		if manifest.ContentPrefix == ci.GetContentID().Prefix() {
 			system.Add(int64(ci.GetPackedLength()))
 			return nil
@@ -136,7 +146,7 @@ func runInternal(ctx context.Context, rep repo.DirectRepositoryWriter, gcDelete
 			return nil
 		}
 
-		if maintenanceStartTime.Sub(ci.Timestamp()) < safety.MinContentAgeSubjectToGC {
+		if maintenanceStartTime.Sub(ci.Timestamp()) < safety.MinContentAgeSubjectToGC || (lease != nil && !ci.Timestamp().Before(lease.StartTime.ToTime())) {
 			log(ctx).Debugf("recent unreferenced content %v (%v bytes, modified %v)", ci.GetContentID(), ci.GetPackedLength(), ci.Timestamp())
 			tooRecent.Add(int64(ci.GetPackedLength()))
 
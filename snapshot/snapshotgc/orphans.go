@@ -0,0 +1,81 @@
+package snapshotgc
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/internal/bigmap"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/content"
+	"github.com/kopia/kopia/repo/content/index"
+	"github.com/kopia/kopia/repo/manifest"
+)
+
+// OrphanedMetadataOptions provides references to metadata items that are live without being
+// reachable from any snapshot.
+type OrphanedMetadataOptions struct {
+	// LivePrefixes lists prefixes of metadata items that are always live, such as items written by other tools.
+	LivePrefixes []content.IDPrefix
+
+	// LiveIDs lists individual metadata items that are live.
+	LiveIDs []content.ID
+
+	// MinAge is the minimum age of orphaned items, which protects items written by uploads in progress.
+	MinAge time.Duration
+}
+
+// FindOrphanedMetadata returns metadata items (contents with a non-empty ID prefix) that are not reachable
+// from any snapshot or live reference provided in the options. Contents storing manifests are reserved
+// and never reported.
+func FindOrphanedMetadata(ctx context.Context, rep repo.DirectRepository, opt OrphanedMetadataOptions) ([]content.Info, error) {
+	used, err := bigmap.NewSet(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create new set")
+	}
+	defer used.Close(ctx)
+
+	if err := findInUseContentIDs(ctx, rep, used); err != nil {
+		return nil, errors.Wrap(err, "unable to find in-use content ID")
+	}
+
+	var cidbuf [128]byte
+
+	for _, cid := range opt.LiveIDs {
+		used.Put(ctx, cid.Append(cidbuf[:0]))
+	}
+
+	livePrefixes := map[content.IDPrefix]bool{
+		manifest.ContentPrefix: true,
+	}
+
+	for _, p := range opt.LivePrefixes {
+		livePrefixes[p] = true
+	}
+
+	now := rep.Time()
+
+	var result []content.Info
+
+	if err := rep.ContentReader().IterateContents(ctx, content.IterateOptions{Range: index.AllPrefixedIDs}, func(ci content.Info) error {
+		cid := ci.GetContentID()
+
+		if livePrefixes[cid.Prefix()] || used.Contains(cid.Append(cidbuf[:0])) {
+			return nil
+		}
+
+		if now.Sub(ci.Timestamp()) < opt.MinAge {
+			log(ctx).Debugf("recent unreferenced metadata item %v (modified %v)", cid, ci.Timestamp())
+			return nil
+		}
+
+		result = append(result, ci)
+
+		return nil
+	}); err != nil {
+		return nil, errors.Wrap(err, "error iterating metadata items")
+	}
+
+	return result, nil
+}
@@ -247,6 +247,90 @@ func newTestHarness(t *testing.T, formatVersion format.Version) *testHarness {
 	return th
 }
 
+func (s *formatSpecificTestSuite) TestSnapshotGCSparesContentsNewerThanUploadLease(t *testing.T) {
+	ctx := testlogging.Context(t)
+	th := newTestHarness(t, s.formatVersion)
+
+	th.sourceDir.AddFile("f1", []byte{1, 2, 3, 4}, defaultPermissions)
+
+	si := snapshot.SourceInfo{
+		Host:     "host",
+		UserName: "user",
+		Path:     "/foo",
+	}
+
+	mustSnapshot(t, th.RepositoryWriter, th.sourceDir, si)
+	mustFlush(t, th.RepositoryWriter)
+
+	// unreferenced contents written before the upload started.
+	olderCIDs := objectIDsToContentIDs(t, create4ByteObjects(t, th.Repository, 0, 10))
+
+	// simulate upload in progress in another client.
+	r2 := th.openAnother(t)
+
+	lease, err := snapshot.AcquireUploadLease(ctx, r2, snapshot.SourceInfo{Host: "host2", UserName: "user2", Path: "/bar"})
+	require.NoError(t, err)
+	mustFlush(t, r2)
+
+	// contents written after the upload started, not referenced by any snapshot yet.
+	newerCIDs := objectIDsToContentIDs(t, create4ByteObjects(t, th.Repository, 100, 10))
+
+	th.fakeTime.Advance(maintenance.SafetyFull.MinContentAgeSubjectToGC + time.Hour)
+
+	require.NoError(t, snapshotmaintenance.Run(ctx, th.RepositoryWriter, maintenance.ModeFull, true, maintenance.SafetyFull))
+	mustFlush(t, th.RepositoryWriter)
+	require.NoError(t, th.Repository.Refresh(ctx))
+
+	checkContentDeletion(t, th.Repository, olderCIDs, true)
+	checkContentDeletion(t, th.Repository, newerCIDs, false)
+
+	// once the upload finishes and releases the lease, the contents are subject to GC.
+	require.NoError(t, snapshot.ReleaseUploadLease(ctx, r2, lease))
+	mustFlush(t, r2)
+
+	// contents may have been rewritten by the previous maintenance, refreshing their timestamps.
+	th.fakeTime.Advance(maintenance.SafetyFull.MinContentAgeSubjectToGC + time.Hour)
+
+	require.NoError(t, snapshotmaintenance.Run(ctx, th.RepositoryWriter, maintenance.ModeFull, true, maintenance.SafetyFull))
+	mustFlush(t, th.RepositoryWriter)
+	require.NoError(t, th.Repository.Refresh(ctx))
+
+	checkContentDeletion(t, th.Repository, newerCIDs, true)
+}
+
+func (s *formatSpecificTestSuite) TestSnapshotGCIgnoresExpiredUploadLease(t *testing.T) {
+	ctx := testlogging.Context(t)
+	th := newTestHarness(t, s.formatVersion)
+
+	th.sourceDir.AddFile("f1", []byte{1, 2, 3, 4}, defaultPermissions)
+
+	si := snapshot.SourceInfo{
+		Host:     "host",
+		UserName: "user",
+		Path:     "/foo",
+	}
+
+	mustSnapshot(t, th.RepositoryWriter, th.sourceDir, si)
+	mustFlush(t, th.RepositoryWriter)
+
+	// lease left behind by a crashed upload is never released.
+	r2 := th.openAnother(t)
+
+	_, err := snapshot.AcquireUploadLease(ctx, r2, si)
+	require.NoError(t, err)
+	mustFlush(t, r2)
+
+	cids := objectIDsToContentIDs(t, create4ByteObjects(t, th.Repository, 0, 10))
+
+	th.fakeTime.Advance(snapshot.DefaultUploadLeaseDuration + time.Hour)
+
+	require.NoError(t, snapshotmaintenance.Run(ctx, th.RepositoryWriter, maintenance.ModeFull, true, maintenance.SafetyFull))
+	mustFlush(t, th.RepositoryWriter)
+	require.NoError(t, th.Repository.Refresh(ctx))
+
+	checkContentDeletion(t, th.Repository, cids, true)
+}
+
 func (s *formatSpecificTestSuite) TestMaintenanceAutoLiveness(t *testing.T) {
 	ft := faketime.NewClockTimeWithOffset(0)
 
@@ -0,0 +1,111 @@
+package snapshot
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/kopia/kopia/fs"
+	"github.com/kopia/kopia/repo"
+	"github.com/kopia/kopia/repo/manifest"
+)
+
+// UploadLeaseManifestType is the value of the "type" label for upload lease manifests.
+const UploadLeaseManifestType = "upload-lease"
+
+// DefaultUploadLeaseDuration is the duration after which an upload lease that has not been released
+// (for example because the uploading process crashed) is no longer considered by garbage collection.
+const DefaultUploadLeaseDuration = 7 * 24 * time.Hour
+
+// UploadLease is a manifest stored while an upload is in progress, which prevents garbage collection
+// from deleting contents written after the upload started, before they become referenced by a snapshot.
+type UploadLease struct {
+	ID         manifest.ID     `json:"-"`
+	Source     SourceInfo      `json:"source"`
+	StartTime  fs.UTCTimestamp `json:"startTime"`
+	ExpireTime fs.UTCTimestamp `json:"expireTime"`
+}
+
+// AcquireUploadLease saves the upload lease for the given source starting at the current repository time.
+// The lease is not flushed explicitly, it becomes visible to other repository clients with the first flush
+// of the upload, together with the earliest contents it protects.
+func AcquireUploadLease(ctx context.Context, rep repo.RepositoryWriter, si SourceInfo) (*UploadLease, error) {
+	now := rep.Time()
+
+	l := &UploadLease{
+		Source:     si,
+		StartTime:  fs.UTCTimestampFromTime(now),
+		ExpireTime: fs.UTCTimestampFromTime(now.Add(DefaultUploadLeaseDuration)),
+	}
+
+	labels := sourceInfoToLabels(si)
+	labels[typeKey] = UploadLeaseManifestType
+
+	id, err := rep.PutManifest(ctx, labels, l)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to save upload lease")
+	}
+
+	l.ID = id
+
+	return l, nil
+}
+
+// ReleaseUploadLease deletes the provided upload lease.
+func ReleaseUploadLease(ctx context.Context, rep repo.RepositoryWriter, l *UploadLease) error {
+	return errors.Wrap(rep.DeleteManifest(ctx, l.ID), "unable to delete upload lease")
+}
+
+// ListUploadLeases returns upload leases that have not expired as of the provided time.
+func ListUploadLeases(ctx context.Context, rep repo.Repository, now time.Time) ([]*UploadLease, error) {
+	entries, err := rep.FindManifests(ctx, map[string]string{
+		typeKey: UploadLeaseManifestType,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to find upload leases")
+	}
+
+	var result []*UploadLease
+
+	for _, e := range entries {
+		l := &UploadLease{}
+
+		if _, err := rep.GetManifest(ctx, e.ID, l); err != nil {
+			if errors.Is(err, manifest.ErrNotFound) {
+				continue
+			}
+
+			return nil, errors.Wrapf(err, "unable to load upload lease %v", e.ID)
+		}
+
+		if !l.ExpireTime.ToTime().After(now) {
+			log(ctx).Debugf("ignoring expired upload lease %v for %v started at %v", e.ID, l.Source, l.StartTime)
+			continue
+		}
+
+		l.ID = e.ID
+
+		result = append(result, l)
+	}
+
+	return result, nil
+}
+
+// OldestUploadLease returns the active upload lease with the earliest start time or nil if there are none.
+func OldestUploadLease(ctx context.Context, rep repo.Repository, now time.Time) (*UploadLease, error) {
+	leases, err := ListUploadLeases(ctx, rep, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var oldest *UploadLease
+
+	for _, l := range leases {
+		if oldest == nil || l.StartTime.Before(oldest.StartTime) {
+			oldest = l
+		}
+	}
+
+	return oldest, nil
+}
@@ -727,6 +727,65 @@ type chunk struct {
 	}
 }
 
+func TestSnapshotRestoreEmptyDirAndSparseFile(t *testing.T) {
+	t.Parallel()
+
+	// holes of sparse files are only recorded on Linux.
+	testutil.TestSkipUnlessLinux(t)
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	sourceDir := testutil.TempDirectory(t)
+	restoreDir := filepath.Join(testutil.TempDirectory(t), "restored")
+
+	blkSize, err := stat.GetBlockSize(sourceDir)
+	require.NoError(t, err)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "empty"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "parent", "nested-empty"), 0o755))
+
+	// [data][hole x 16][data][hole x 16]
+	sparseFile := filepath.Join(sourceDir, "sparse")
+
+	f, err := os.Create(sparseFile)
+	require.NoError(t, err)
+	require.NoError(t, f.Truncate(int64(34*blkSize)))
+	_, err = f.WriteAt(bytes.Repeat([]byte{1}, int(blkSize)), 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt(bytes.Repeat([]byte{2}, int(blkSize)), int64(17*blkSize))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	verifyFileSize(t, sparseFile, 34*blkSize, 2*blkSize)
+
+	e.RunAndExpectSuccess(t, "snapshot", "create", sourceDir)
+
+	si := clitestutil.ListSnapshotsAndExpectSuccess(t, e, sourceDir)
+	require.Len(t, si, 1)
+	require.Len(t, si[0].Snapshots, 1)
+
+	// holes are recreated even without --write-sparse-files.
+	e.RunAndExpectSuccess(t, "snapshot", "restore", si[0].Snapshots[0].SnapshotID, restoreDir)
+
+	for _, d := range []string{"empty", filepath.Join("parent", "nested-empty")} {
+		entries, err := os.ReadDir(filepath.Join(restoreDir, d))
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	}
+
+	verifyFileSize(t, filepath.Join(restoreDir, "sparse"), 34*blkSize, 2*blkSize)
+
+	want, err := os.ReadFile(sparseFile)
+	require.NoError(t, err)
+
+	got, err := os.ReadFile(filepath.Join(restoreDir, "sparse"))
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
+
 func verifyFileSize(t *testing.T, fname string, logical, physical uint64) {
 	t.Helper()
 
@@ -0,0 +1,73 @@
+//go:build linux
+// +build linux
+
+package endtoend_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kopia/kopia/internal/testutil"
+	"github.com/kopia/kopia/internal/xattr"
+	"github.com/kopia/kopia/tests/clitestutil"
+	"github.com/kopia/kopia/tests/testenv"
+)
+
+func TestRestoreExtendedAttributes(t *testing.T) {
+	t.Parallel()
+
+	source := testutil.TempDirectory(t)
+	f := filepath.Join(source, "file.txt")
+	require.NoError(t, os.WriteFile(f, []byte("hello"), 0o600))
+
+	attrs := map[string][]byte{"user.kopia-test": []byte("some-value")}
+
+	if err := xattr.Set(f, attrs); err != nil {
+		if errors.Is(err, xattr.ErrUnsupported) {
+			t.Skip("extended attributes not supported by the filesystem")
+		}
+
+		require.NoError(t, err)
+	}
+
+	runner := testenv.NewInProcRunner(t)
+	e := testenv.NewCLITest(t, testenv.RepoFormatNotImportant, runner)
+
+	e.RunAndExpectSuccess(t, "repo", "create", "filesystem", "--path", e.RepoDir)
+
+	// extended attributes are not stored by default.
+	e.RunAndExpectSuccess(t, "snapshot", "create", source)
+
+	e.RunAndExpectSuccess(t, "policy", "set", source, "--store-xattrs=true")
+	e.RunAndExpectSuccess(t, "snapshot", "create", source)
+
+	si := clitestutil.ListSnapshotsAndExpectSuccess(t, e, source)
+	require.Len(t, si, 1)
+	require.Len(t, si[0].Snapshots, 2)
+
+	r1 := testutil.TempDirectory(t)
+	e.RunAndExpectSuccess(t, "restore", si[0].Snapshots[0].SnapshotID, r1)
+
+	got, err := xattr.List(filepath.Join(r1, "file.txt"))
+	require.NoError(t, err)
+	require.NotContains(t, got, "user.kopia-test")
+
+	r2 := testutil.TempDirectory(t)
+	e.RunAndExpectSuccess(t, "restore", si[0].Snapshots[1].SnapshotID, r2)
+
+	got, err = xattr.List(filepath.Join(r2, "file.txt"))
+	require.NoError(t, err)
+	require.Equal(t, attrs["user.kopia-test"], got["user.kopia-test"])
+
+	// restoring can be told to skip extended attributes.
+	r3 := testutil.TempDirectory(t)
+	e.RunAndExpectSuccess(t, "restore", si[0].Snapshots[1].SnapshotID, r3, "--skip-xattrs")
+
+	got, err = xattr.List(filepath.Join(r3, "file.txt"))
+	require.NoError(t, err)
+	require.NotContains(t, got, "user.kopia-test")
+}
@@ -142,6 +142,21 @@ func (e *CLITest) RunAndExpectSuccessWithErrOut(t *testing.T, args ...string) (s
 	return stdout, stderr
 }
 
+// RunAndGetRawStdout runs the given command, expects it to succeed and returns its unmodified stdout,
+// which is useful for commands producing binary output.
+func (e *CLITest) RunAndGetRawStdout(t *testing.T, args ...string) []byte {
+	t.Helper()
+
+	stdout, stderr, wait, _ := e.Runner.Start(t, e.cmdArgs(args), e.Environment)
+	go io.Copy(io.Discard, stderr)
+
+	data, err := io.ReadAll(stdout)
+	require.NoError(t, err)
+	require.NoError(t, wait(), "unexpected error when running 'kopia %v'", strings.Join(args, " "))
+
+	return data
+}
+
 // RunAndExpectFailure runs the given command, expects it to fail and returns its output lines.
 func (e *CLITest) RunAndExpectFailure(t *testing.T, args ...string) []string {
 	t.Helper()